@@ -97,8 +97,8 @@ Flatten Settings Map using "." syntax
   {{- if $label -}}
     {{- $sublabel = list $label $key | join "." -}}
   {{- end -}}
-  {{/* Special-case "tags" since we want this to be a JSON object */}}
-  {{- if eq $key "tags" -}}
+  {{/* Special-case "tags", the reserved resources and the zone lists since we want these to be JSON */}}
+  {{- if has $key (list "tags" "systemReserved" "kubeReserved" "allowedZones" "blockedZones") -}}
     {{- if not (kindIs "invalid" $val) -}}
       {{- $sublabel | quote | nindent 2 }}: {{ $val | toJson | quote }}
     {{- end -}}
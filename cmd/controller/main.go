@@ -15,11 +15,13 @@ limitations under the License.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/samber/lo"
 
 	"github.com/aws/karpenter/pkg/cloudprovider"
 	"github.com/aws/karpenter/pkg/context"
 	"github.com/aws/karpenter/pkg/controllers"
+	"github.com/aws/karpenter/pkg/controllers/interruption"
 	"github.com/aws/karpenter/pkg/webhooks"
 
 	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
@@ -47,9 +49,15 @@ func main() {
 		awsCtx.InstanceProvider,
 		awsCtx.KubeClient,
 		awsCtx.AMIProvider,
+		awsCtx.LaunchTemplateProvider,
+		awsCtx.SubnetProvider,
+		awsCtx.SecurityGroupProvider,
 	)
 	lo.Must0(operator.AddHealthzCheck("cloud-provider", awsCloudProvider.LivenessProbe))
+	lo.Must0(operator.AddReadyzCheck("instance-types", awsCtx.InstanceTypesProvider.ReadinessProbe))
 	cloudProvider := metrics.Decorate(awsCloudProvider)
+	sqsProvider := interruption.NewSQSProvider(sqs.New(awsCtx.Session))
+	lo.Must0(operator.AddReadyzCheck("interruption-queue", sqsProvider.ReadinessProbe))
 
 	operator.
 		WithControllers(ctx, corecontrollers.NewControllers(
@@ -65,6 +73,7 @@ func main() {
 		WithControllers(ctx, controllers.NewControllers(
 			awsCtx,
 			awsCloudProvider,
+			sqsProvider,
 		)...).
 		WithWebhooks(webhooks.NewWebhooks()...).
 		Start(ctx)
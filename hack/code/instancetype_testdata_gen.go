@@ -157,7 +157,18 @@ func getInstanceTypeInfo(info *ec2.InstanceTypeInfo) string {
 	fmt.Fprintf(src, "MaximumNetworkInterfaces: aws.Int64(%d),\n", lo.FromPtr(info.NetworkInfo.MaximumNetworkInterfaces))
 	fmt.Fprintf(src, "Ipv4AddressesPerInterface: aws.Int64(%d),\n", lo.FromPtr(info.NetworkInfo.Ipv4AddressesPerInterface))
 	fmt.Fprintf(src, "EncryptionInTransitSupported: aws.Bool(%t),\n", lo.FromPtr(info.NetworkInfo.EncryptionInTransitSupported))
+	if lo.FromPtr(info.NetworkInfo.EfaSupported) {
+		fmt.Fprintf(src, "EfaSupported: aws.Bool(true),\n")
+		fmt.Fprintf(src, "EfaInfo: &ec2.EfaInfo{\n")
+		fmt.Fprintf(src, "MaximumEfaInterfaces: aws.Int64(%d),\n", lo.FromPtr(info.NetworkInfo.EfaInfo.MaximumEfaInterfaces))
+		fmt.Fprintf(src, "},\n")
+	}
 	fmt.Fprintf(src, "},\n")
+	if info.PlacementGroupInfo != nil {
+		fmt.Fprintf(src, "PlacementGroupInfo: &ec2.PlacementGroupInfo{\n")
+		fmt.Fprintf(src, "SupportedStrategies: aws.StringSlice([]string{%s}),\n", getStringSliceData(info.PlacementGroupInfo.SupportedStrategies))
+		fmt.Fprintf(src, "},\n")
+	}
 	return src.String()
 }
 
@@ -31,6 +31,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	ec22 "github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/samber/lo"
+	"k8s.io/utils/clock"
 
 	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/providers/pricing"
@@ -71,7 +72,7 @@ func main() {
 	// record prices for each region we are interested in
 	for _, region := range []string{"us-east-1", "us-gov-west-1", "us-gov-east-1", "cn-north-1"} {
 		log.Println("fetching for", region)
-		pricingProvider := pricing.NewProvider(ctx, pricing.NewAPI(sess, region), ec2, region, make(chan struct{}))
+		pricingProvider := pricing.NewProvider(ctx, clock.RealClock{}, pricing.NewAPI(sess, region), ec2, region, make(chan struct{}))
 		for {
 			if pricingProvider.OnDemandLastUpdated().After(updateStarted) && pricingProvider.SpotLastUpdated().After(updateStarted) {
 				break
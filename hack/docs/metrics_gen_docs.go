@@ -266,6 +266,8 @@ func getIdentMapping(identName string) (string, error) {
 		"interruptionSubsystem":   "interruption",
 		"nodeTemplateSubsystem":   "nodetemplate",
 		"deprovisioningSubsystem": "deprovisioning",
+		"pricingSubsystem":        "pricing",
+		"cloudProviderSubsystem":  "cloudprovider",
 	}
 	if v, ok := identMapping[identName]; ok {
 		return v, nil
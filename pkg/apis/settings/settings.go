@@ -19,8 +19,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/samber/lo"
 	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
 	"knative.dev/pkg/configmap"
@@ -33,35 +35,134 @@ const (
 	ResourceName NodeNameConvention = "resource-name"
 )
 
+// DaemonSetDrainPolicy controls whether the pods of DaemonSets are evicted when garbage collection drains a node
+type DaemonSetDrainPolicy string
+
+const (
+	// DaemonSetDrainPolicySkip never evicts the pods of DaemonSets, they're stopped along with the instance
+	DaemonSetDrainPolicySkip DaemonSetDrainPolicy = "skip"
+	// DaemonSetDrainPolicyLast evicts the pods of DaemonSets once every other pod has been evicted, if the drain hasn't
+	// timed out by then
+	DaemonSetDrainPolicyLast DaemonSetDrainPolicy = "last"
+)
+
 type settingsKeyType struct{}
 
 var ContextKey = settingsKeyType{}
 
 var defaultSettings = &Settings{
-	ClusterName:                "",
-	ClusterEndpoint:            "",
-	DefaultInstanceProfile:     "",
-	EnablePodENI:               false,
-	EnableENILimitedPodDensity: true,
-	IsolatedVPC:                false,
-	NodeNameConvention:         IPName,
-	VMMemoryOverheadPercent:    0.075,
-	InterruptionQueueName:      "",
-	Tags:                       map[string]string{},
+	ClusterName:                  "",
+	ClusterEndpoint:              "",
+	DefaultInstanceProfile:       "",
+	EnablePodENI:                 false,
+	EnableENILimitedPodDensity:   true,
+	EnablePrefixDelegation:       false,
+	IsolatedVPC:                  false,
+	NodeNameConvention:           IPName,
+	VMMemoryOverheadPercent:      0.075,
+	InterruptionQueueName:        "",
+	Tags:                         map[string]string{},
+	EnableVersionTag:             false,
+	GCResolutionWindow:           time.Minute,
+	GCProtectionTagKey:           "",
+	InstanceDiscoveryTagKey:      "",
+	InstanceDiscoveryTagValue:    "",
+	EnableZonalInstanceListing:   false,
+	GCDrainTimeout:               0,
+	GCDaemonSetDrainPolicy:       DaemonSetDrainPolicySkip,
+	GCLogSampleSize:              10,
+	GCDeleteNodes:                true,
+	PersistLinkedMachines:        false,
+	StaleMachineGracePeriod:      5 * time.Minute,
+	AMICacheTTL:                  5 * time.Minute,
+	SpotInterruptionLeadTime:     0,
+	EnableRebalanceReplacement:   false,
+	EnableAMIDrift:               true,
+	AMIDriftReplacementBudget:    1,
+	EnableSubnetDrift:            false,
+	MaxInstanceLifetime:          0,
+	ExpirationReplacementBudget:  1,
+	MaxConcurrentLaunches:        0,
+	MinSubnetAvailableIPs:        0,
+	EnableZoneBalancing:          false,
+	MaxFleetOverrides:            300,
+	SpotFallbackThreshold:        3,
+	PricingRefreshInterval:       12 * time.Hour,
+	EnableSpotPriceLookup:        false,
+	SpotPriceLookupTTL:           time.Minute,
+	SpotPriceLookupBudget:        20,
+	UnavailableOfferingsTTL:      3 * time.Minute,
+	InstanceTypesRefreshInterval: 5 * time.Minute,
+	EC2RetryMaxAttempts:          5,
+	EC2RetryBaseDelay:            100 * time.Millisecond,
+	EC2RetryMaxDelay:             5 * time.Second,
+	EC2RequestsPerSecond:         0,
+	EC2RequestBurst:              10,
+	EnableEC2Tracing:             false,
+	EnableInstanceProfileCheck:   false,
+	EnableInstanceProfileCleanup: false,
+	AllowedZones:                 []string{},
+	BlockedZones:                 []string{},
+	SystemReserved:               v1.ResourceList{},
+	KubeReserved:                 v1.ResourceList{},
 }
 
 // +k8s:deepcopy-gen=true
 type Settings struct {
-	ClusterName                string `validate:"required"`
-	ClusterEndpoint            string
-	DefaultInstanceProfile     string
-	EnablePodENI               bool
-	EnableENILimitedPodDensity bool
-	IsolatedVPC                bool
-	NodeNameConvention         NodeNameConvention `validate:"required"`
-	VMMemoryOverheadPercent    float64            `validate:"min=0"`
-	InterruptionQueueName      string
-	Tags                       map[string]string
+	ClusterName                  string `validate:"required"`
+	ClusterEndpoint              string
+	DefaultInstanceProfile       string
+	EnablePodENI                 bool
+	EnableENILimitedPodDensity   bool
+	EnablePrefixDelegation       bool
+	IsolatedVPC                  bool
+	NodeNameConvention           NodeNameConvention `validate:"required"`
+	VMMemoryOverheadPercent      float64            `validate:"min=0"`
+	InterruptionQueueName        string
+	Tags                         map[string]string
+	EnableVersionTag             bool
+	GCResolutionWindow           time.Duration `validate:"min=0"`
+	GCProtectionTagKey           string
+	InstanceDiscoveryTagKey      string `validate:"required_with=InstanceDiscoveryTagValue"`
+	InstanceDiscoveryTagValue    string
+	EnableZonalInstanceListing   bool
+	GCDrainTimeout               time.Duration        `validate:"min=0"`
+	GCDaemonSetDrainPolicy       DaemonSetDrainPolicy `validate:"oneof=skip last"`
+	GCLogSampleSize              int64                `validate:"min=0"`
+	GCDeleteNodes                bool
+	PersistLinkedMachines        bool
+	StaleMachineGracePeriod      time.Duration `validate:"min=0"`
+	AMICacheTTL                  time.Duration `validate:"min=1s"`
+	SpotInterruptionLeadTime     time.Duration `validate:"min=0,lt=2m"`
+	EnableRebalanceReplacement   bool
+	EnableAMIDrift               bool
+	AMIDriftReplacementBudget    int64 `validate:"min=1"`
+	EnableSubnetDrift            bool
+	MaxInstanceLifetime          time.Duration `validate:"min=0"`
+	ExpirationReplacementBudget  int64         `validate:"min=1"`
+	MaxConcurrentLaunches        int64         `validate:"min=0"`
+	MinSubnetAvailableIPs        int64         `validate:"min=0"`
+	EnableZoneBalancing          bool
+	MaxFleetOverrides            int64         `validate:"min=1"`
+	SpotFallbackThreshold        int64         `validate:"min=0"`
+	PricingRefreshInterval       time.Duration `validate:"min=1m"`
+	EnableSpotPriceLookup        bool
+	SpotPriceLookupTTL           time.Duration `validate:"min=1s"`
+	SpotPriceLookupBudget        int64         `validate:"min=1"`
+	UnavailableOfferingsTTL      time.Duration `validate:"min=1s"`
+	InstanceTypesRefreshInterval time.Duration `validate:"min=1m"`
+	EC2RetryMaxAttempts          int64         `validate:"min=1"`
+	EC2RetryBaseDelay            time.Duration `validate:"min=0"`
+	EC2RetryMaxDelay             time.Duration `validate:"min=0"`
+	EC2RequestsPerSecond         float64       `validate:"min=0"`
+	EC2RequestBurst              int64         `validate:"min=1"`
+	EnableEC2Tracing             bool
+	EnableInstanceProfileCheck   bool
+	EnableInstanceProfileCleanup bool
+	AllowedZones                 []string
+	BlockedZones                 []string
+	SystemReserved               v1.ResourceList
+	KubeReserved                 v1.ResourceList
 }
 
 func (*Settings) ConfigMap() string {
@@ -78,11 +179,55 @@ func (*Settings) Inject(ctx context.Context, cm *v1.ConfigMap) (context.Context,
 		configmap.AsString("aws.defaultInstanceProfile", &s.DefaultInstanceProfile),
 		configmap.AsBool("aws.enablePodENI", &s.EnablePodENI),
 		configmap.AsBool("aws.enableENILimitedPodDensity", &s.EnableENILimitedPodDensity),
+		configmap.AsBool("aws.enablePrefixDelegation", &s.EnablePrefixDelegation),
 		configmap.AsBool("aws.isolatedVPC", &s.IsolatedVPC),
 		AsTypedString("aws.nodeNameConvention", &s.NodeNameConvention),
 		configmap.AsFloat64("aws.vmMemoryOverheadPercent", &s.VMMemoryOverheadPercent),
 		configmap.AsString("aws.interruptionQueueName", &s.InterruptionQueueName),
 		AsStringMap("aws.tags", &s.Tags),
+		configmap.AsBool("aws.enableVersionTag", &s.EnableVersionTag),
+		configmap.AsDuration("aws.gcResolutionWindow", &s.GCResolutionWindow),
+		configmap.AsString("aws.gcProtectionTagKey", &s.GCProtectionTagKey),
+		configmap.AsString("aws.instanceDiscoveryTagKey", &s.InstanceDiscoveryTagKey),
+		configmap.AsString("aws.instanceDiscoveryTagValue", &s.InstanceDiscoveryTagValue),
+		configmap.AsBool("aws.enableZonalInstanceListing", &s.EnableZonalInstanceListing),
+		configmap.AsDuration("aws.gcDrainTimeout", &s.GCDrainTimeout),
+		AsTypedString("aws.gcDaemonSetDrainPolicy", &s.GCDaemonSetDrainPolicy),
+		configmap.AsInt64("aws.gcLogSampleSize", &s.GCLogSampleSize),
+		configmap.AsBool("aws.gcDeleteNodes", &s.GCDeleteNodes),
+		configmap.AsBool("aws.persistLinkedMachines", &s.PersistLinkedMachines),
+		configmap.AsDuration("aws.staleMachineGracePeriod", &s.StaleMachineGracePeriod),
+		configmap.AsDuration("aws.amiCacheTTL", &s.AMICacheTTL),
+		configmap.AsDuration("aws.spotInterruptionLeadTime", &s.SpotInterruptionLeadTime),
+		configmap.AsBool("aws.enableRebalanceReplacement", &s.EnableRebalanceReplacement),
+		configmap.AsBool("aws.enableAMIDrift", &s.EnableAMIDrift),
+		configmap.AsInt64("aws.amiDriftReplacementBudget", &s.AMIDriftReplacementBudget),
+		configmap.AsBool("aws.enableSubnetDrift", &s.EnableSubnetDrift),
+		configmap.AsDuration("aws.maxInstanceLifetime", &s.MaxInstanceLifetime),
+		configmap.AsInt64("aws.expirationReplacementBudget", &s.ExpirationReplacementBudget),
+		configmap.AsInt64("aws.maxConcurrentLaunches", &s.MaxConcurrentLaunches),
+		configmap.AsInt64("aws.minSubnetAvailableIPs", &s.MinSubnetAvailableIPs),
+		configmap.AsBool("aws.enableZoneBalancing", &s.EnableZoneBalancing),
+		configmap.AsInt64("aws.maxFleetOverrides", &s.MaxFleetOverrides),
+		configmap.AsInt64("aws.spotFallbackThreshold", &s.SpotFallbackThreshold),
+		configmap.AsDuration("aws.pricingRefreshInterval", &s.PricingRefreshInterval),
+		configmap.AsBool("aws.enableSpotPriceLookup", &s.EnableSpotPriceLookup),
+		configmap.AsDuration("aws.spotPriceLookupTTL", &s.SpotPriceLookupTTL),
+		configmap.AsInt64("aws.spotPriceLookupBudget", &s.SpotPriceLookupBudget),
+		configmap.AsDuration("aws.unavailableOfferingsTTL", &s.UnavailableOfferingsTTL),
+		configmap.AsDuration("aws.instanceTypesRefreshInterval", &s.InstanceTypesRefreshInterval),
+		configmap.AsInt64("aws.ec2RetryMaxAttempts", &s.EC2RetryMaxAttempts),
+		configmap.AsDuration("aws.ec2RetryBaseDelay", &s.EC2RetryBaseDelay),
+		configmap.AsDuration("aws.ec2RetryMaxDelay", &s.EC2RetryMaxDelay),
+		configmap.AsFloat64("aws.ec2RequestsPerSecond", &s.EC2RequestsPerSecond),
+		configmap.AsInt64("aws.ec2RequestBurst", &s.EC2RequestBurst),
+		configmap.AsBool("aws.enableEC2Tracing", &s.EnableEC2Tracing),
+		configmap.AsBool("aws.enableInstanceProfileCheck", &s.EnableInstanceProfileCheck),
+		configmap.AsBool("aws.enableInstanceProfileCleanup", &s.EnableInstanceProfileCleanup),
+		AsStringSlice("aws.allowedZones", &s.AllowedZones),
+		AsStringSlice("aws.blockedZones", &s.BlockedZones),
+		AsResourceList("aws.systemReserved", &s.SystemReserved),
+		AsResourceList("aws.kubeReserved", &s.KubeReserved),
 	); err != nil {
 		return ctx, fmt.Errorf("parsing settings, %w", err)
 	}
@@ -101,6 +246,8 @@ func (*Settings) Inject(ctx context.Context, cm *v1.ConfigMap) (context.Context,
 func (s Settings) Validate() error {
 	return multierr.Combine(
 		s.validateEndpoint(),
+		validateReservedResources("systemReserved", s.SystemReserved),
+		validateReservedResources("kubeReserved", s.KubeReserved),
 		validator.New().Struct(s),
 	)
 }
@@ -118,6 +265,28 @@ func (s Settings) validateEndpoint() error {
 	return nil
 }
 
+func validateReservedResources(name string, reserved v1.ResourceList) error {
+	for resourceName, quantity := range reserved {
+		if resourceName != v1.ResourceCPU && resourceName != v1.ResourceMemory && resourceName != v1.ResourceEphemeralStorage {
+			return fmt.Errorf("%s contains unsupported resource \"%s\", expected one of %s, %s or %s",
+				name, resourceName, v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage)
+		}
+		if quantity.Sign() < 0 {
+			return fmt.Errorf("%s[%s] must not be negative", name, resourceName)
+		}
+	}
+	return nil
+}
+
+// IsZoneAllowed returns true if instances may be launched into the zone. An empty list of allowed zones allows every zone
+// that isn't blocked, and a zone that's both allowed and blocked is blocked.
+func (s Settings) IsZoneAllowed(zone string) bool {
+	if lo.Contains(s.BlockedZones, zone) {
+		return false
+	}
+	return len(s.AllowedZones) == 0 || lo.Contains(s.AllowedZones, zone)
+}
+
 func ToContext(ctx context.Context, s *Settings) context.Context {
 	return context.WithValue(ctx, ContextKey, s)
 }
@@ -154,3 +323,31 @@ func AsStringMap(key string, target *map[string]string) configmap.ParseFunc {
 		return nil
 	}
 }
+
+// AsStringSlice parses a value as a JSON list of strings.
+func AsStringSlice(key string, target *[]string) configmap.ParseFunc {
+	return func(data map[string]string) error {
+		if raw, ok := data[key]; ok {
+			l := []string{}
+			if err := json.Unmarshal([]byte(raw), &l); err != nil {
+				return err
+			}
+			*target = l
+		}
+		return nil
+	}
+}
+
+// AsResourceList parses a value as a JSON map of resource names to quantities.
+func AsResourceList(key string, target *v1.ResourceList) configmap.ParseFunc {
+	return func(data map[string]string) error {
+		if raw, ok := data[key]; ok {
+			m := v1.ResourceList{}
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				return err
+			}
+			*target = m
+		}
+		return nil
+	}
+}
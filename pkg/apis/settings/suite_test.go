@@ -17,6 +17,7 @@ package settings_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -48,23 +49,111 @@ var _ = Describe("Validation", func() {
 		Expect(s.DefaultInstanceProfile).To(Equal(""))
 		Expect(s.EnablePodENI).To(BeFalse())
 		Expect(s.EnableENILimitedPodDensity).To(BeTrue())
+		Expect(s.EnablePrefixDelegation).To(BeFalse())
 		Expect(s.IsolatedVPC).To(BeFalse())
 		Expect(s.NodeNameConvention).To(Equal(settings.IPName))
 		Expect(s.VMMemoryOverheadPercent).To(Equal(0.075))
 		Expect(len(s.Tags)).To(BeZero())
+		Expect(s.EnableVersionTag).To(BeFalse())
+		Expect(s.GCResolutionWindow).To(Equal(time.Minute))
+		Expect(s.GCProtectionTagKey).To(Equal(""))
+		Expect(s.InstanceDiscoveryTagKey).To(Equal(""))
+		Expect(s.InstanceDiscoveryTagValue).To(Equal(""))
+		Expect(s.EnableZonalInstanceListing).To(BeFalse())
+		Expect(s.GCDrainTimeout).To(Equal(time.Duration(0)))
+		Expect(s.GCDaemonSetDrainPolicy).To(Equal(settings.DaemonSetDrainPolicySkip))
+		Expect(s.GCLogSampleSize).To(Equal(int64(10)))
+		Expect(s.GCDeleteNodes).To(BeTrue())
+		Expect(s.PersistLinkedMachines).To(BeFalse())
+		Expect(s.StaleMachineGracePeriod).To(Equal(time.Minute * 5))
+		Expect(s.AMICacheTTL).To(Equal(time.Minute * 5))
+		Expect(s.SpotInterruptionLeadTime).To(Equal(time.Duration(0)))
+		Expect(s.EnableRebalanceReplacement).To(BeFalse())
+		Expect(s.EnableAMIDrift).To(BeTrue())
+		Expect(s.AMIDriftReplacementBudget).To(Equal(int64(1)))
+		Expect(s.EnableSubnetDrift).To(BeFalse())
+		Expect(s.MaxInstanceLifetime).To(Equal(time.Duration(0)))
+		Expect(s.ExpirationReplacementBudget).To(Equal(int64(1)))
+		Expect(s.MaxConcurrentLaunches).To(BeZero())
+		Expect(s.MinSubnetAvailableIPs).To(BeZero())
+		Expect(s.EnableZoneBalancing).To(BeFalse())
+		Expect(s.MaxFleetOverrides).To(Equal(int64(300)))
+		Expect(s.SpotFallbackThreshold).To(Equal(int64(3)))
+		Expect(s.PricingRefreshInterval).To(Equal(time.Hour * 12))
+		Expect(s.EnableSpotPriceLookup).To(BeFalse())
+		Expect(s.SpotPriceLookupTTL).To(Equal(time.Minute))
+		Expect(s.SpotPriceLookupBudget).To(Equal(int64(20)))
+		Expect(s.UnavailableOfferingsTTL).To(Equal(time.Minute * 3))
+		Expect(s.InstanceTypesRefreshInterval).To(Equal(time.Minute * 5))
+		Expect(s.EC2RetryMaxAttempts).To(BeNumerically("==", 5))
+		Expect(s.EC2RetryBaseDelay).To(Equal(time.Millisecond * 100))
+		Expect(s.EC2RetryMaxDelay).To(Equal(time.Second * 5))
+		Expect(s.EC2RequestsPerSecond).To(BeZero())
+		Expect(s.EC2RequestBurst).To(Equal(int64(10)))
+		Expect(s.EnableEC2Tracing).To(BeFalse())
+		Expect(s.EnableInstanceProfileCheck).To(BeFalse())
+		Expect(s.EnableInstanceProfileCleanup).To(BeFalse())
+		Expect(s.AllowedZones).To(BeEmpty())
+		Expect(s.BlockedZones).To(BeEmpty())
+		Expect(len(s.SystemReserved)).To(BeZero())
+		Expect(len(s.KubeReserved)).To(BeZero())
 	})
 	It("should succeed to set custom values", func() {
 		cm := &v1.ConfigMap{
 			Data: map[string]string{
-				"aws.clusterEndpoint":            "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
-				"aws.clusterName":                "my-cluster",
-				"aws.defaultInstanceProfile":     "karpenter",
-				"aws.enablePodENI":               "true",
-				"aws.enableENILimitedPodDensity": "false",
-				"aws.isolatedVPC":                "true",
-				"aws.nodeNameConvention":         "resource-name",
-				"aws.vmMemoryOverheadPercent":    "0.1",
-				"aws.tags":                       `{"tag1": "value1", "tag2": "value2", "example.com/tag": "my-value"}`,
+				"aws.clusterEndpoint":              "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":                  "my-cluster",
+				"aws.defaultInstanceProfile":       "karpenter",
+				"aws.enablePodENI":                 "true",
+				"aws.enableENILimitedPodDensity":   "false",
+				"aws.enablePrefixDelegation":       "true",
+				"aws.isolatedVPC":                  "true",
+				"aws.nodeNameConvention":           "resource-name",
+				"aws.vmMemoryOverheadPercent":      "0.1",
+				"aws.tags":                         `{"tag1": "value1", "tag2": "value2", "example.com/tag": "my-value"}`,
+				"aws.enableVersionTag":             "true",
+				"aws.gcResolutionWindow":           "5m",
+				"aws.gcProtectionTagKey":           "example.com/do-not-gc",
+				"aws.instanceDiscoveryTagKey":      "example.com/installation",
+				"aws.instanceDiscoveryTagValue":    "blue",
+				"aws.enableZonalInstanceListing":   "true",
+				"aws.gcDrainTimeout":               "2m",
+				"aws.gcDaemonSetDrainPolicy":       "last",
+				"aws.gcLogSampleSize":              "0",
+				"aws.gcDeleteNodes":                "false",
+				"aws.persistLinkedMachines":        "true",
+				"aws.staleMachineGracePeriod":      "10m",
+				"aws.amiCacheTTL":                  "10m",
+				"aws.spotInterruptionLeadTime":     "30s",
+				"aws.enableRebalanceReplacement":   "true",
+				"aws.enableAMIDrift":               "false",
+				"aws.amiDriftReplacementBudget":    "3",
+				"aws.enableSubnetDrift":            "true",
+				"aws.maxInstanceLifetime":          "720h",
+				"aws.expirationReplacementBudget":  "2",
+				"aws.maxConcurrentLaunches":        "5",
+				"aws.minSubnetAvailableIPs":        "16",
+				"aws.enableZoneBalancing":          "true",
+				"aws.maxFleetOverrides":            "50",
+				"aws.spotFallbackThreshold":        "0",
+				"aws.pricingRefreshInterval":       "1h",
+				"aws.enableSpotPriceLookup":        "true",
+				"aws.spotPriceLookupTTL":           "30s",
+				"aws.spotPriceLookupBudget":        "5",
+				"aws.unavailableOfferingsTTL":      "10m",
+				"aws.instanceTypesRefreshInterval": "30m",
+				"aws.ec2RetryMaxAttempts":          "3",
+				"aws.ec2RetryBaseDelay":            "500ms",
+				"aws.ec2RetryMaxDelay":             "30s",
+				"aws.ec2RequestsPerSecond":         "20.5",
+				"aws.ec2RequestBurst":              "50",
+				"aws.enableEC2Tracing":             "true",
+				"aws.enableInstanceProfileCheck":   "true",
+				"aws.enableInstanceProfileCleanup": "true",
+				"aws.allowedZones":                 `["us-west-2a", "us-west-2b"]`,
+				"aws.blockedZones":                 `["us-west-2b"]`,
+				"aws.systemReserved":               `{"cpu": "200m", "memory": "1Gi"}`,
+				"aws.kubeReserved":                 `{"ephemeral-storage": "5Gi"}`,
 			},
 		}
 		ctx, err := (&settings.Settings{}).Inject(ctx, cm)
@@ -73,6 +162,7 @@ var _ = Describe("Validation", func() {
 		Expect(s.DefaultInstanceProfile).To(Equal("karpenter"))
 		Expect(s.EnablePodENI).To(BeTrue())
 		Expect(s.EnableENILimitedPodDensity).To(BeFalse())
+		Expect(s.EnablePrefixDelegation).To(BeTrue())
 		Expect(s.IsolatedVPC).To(BeTrue())
 		Expect(s.NodeNameConvention).To(Equal(settings.ResourceName))
 		Expect(s.VMMemoryOverheadPercent).To(Equal(0.1))
@@ -80,6 +170,53 @@ var _ = Describe("Validation", func() {
 		Expect(s.Tags).To(HaveKeyWithValue("tag1", "value1"))
 		Expect(s.Tags).To(HaveKeyWithValue("tag2", "value2"))
 		Expect(s.Tags).To(HaveKeyWithValue("example.com/tag", "my-value"))
+		Expect(s.EnableVersionTag).To(BeTrue())
+		Expect(s.GCResolutionWindow).To(Equal(time.Minute * 5))
+		Expect(s.GCProtectionTagKey).To(Equal("example.com/do-not-gc"))
+		Expect(s.InstanceDiscoveryTagKey).To(Equal("example.com/installation"))
+		Expect(s.InstanceDiscoveryTagValue).To(Equal("blue"))
+		Expect(s.EnableZonalInstanceListing).To(BeTrue())
+		Expect(s.GCDrainTimeout).To(Equal(time.Minute * 2))
+		Expect(s.GCDaemonSetDrainPolicy).To(Equal(settings.DaemonSetDrainPolicyLast))
+		Expect(s.GCLogSampleSize).To(BeZero())
+		Expect(s.GCDeleteNodes).To(BeFalse())
+		Expect(s.PersistLinkedMachines).To(BeTrue())
+		Expect(s.StaleMachineGracePeriod).To(Equal(time.Minute * 10))
+		Expect(s.AMICacheTTL).To(Equal(time.Minute * 10))
+		Expect(s.SpotInterruptionLeadTime).To(Equal(time.Second * 30))
+		Expect(s.EnableRebalanceReplacement).To(BeTrue())
+		Expect(s.EnableAMIDrift).To(BeFalse())
+		Expect(s.AMIDriftReplacementBudget).To(Equal(int64(3)))
+		Expect(s.EnableSubnetDrift).To(BeTrue())
+		Expect(s.MaxInstanceLifetime).To(Equal(time.Hour * 720))
+		Expect(s.ExpirationReplacementBudget).To(Equal(int64(2)))
+		Expect(s.MaxConcurrentLaunches).To(Equal(int64(5)))
+		Expect(s.MinSubnetAvailableIPs).To(BeNumerically("==", 16))
+		Expect(s.EnableZoneBalancing).To(BeTrue())
+		Expect(s.MaxFleetOverrides).To(Equal(int64(50)))
+		Expect(s.SpotFallbackThreshold).To(BeZero())
+		Expect(s.PricingRefreshInterval).To(Equal(time.Hour))
+		Expect(s.EnableSpotPriceLookup).To(BeTrue())
+		Expect(s.SpotPriceLookupTTL).To(Equal(time.Second * 30))
+		Expect(s.SpotPriceLookupBudget).To(Equal(int64(5)))
+		Expect(s.UnavailableOfferingsTTL).To(Equal(time.Minute * 10))
+		Expect(s.InstanceTypesRefreshInterval).To(Equal(time.Minute * 30))
+		Expect(s.EC2RetryMaxAttempts).To(BeNumerically("==", 3))
+		Expect(s.EC2RetryBaseDelay).To(Equal(time.Millisecond * 500))
+		Expect(s.EC2RetryMaxDelay).To(Equal(time.Second * 30))
+		Expect(s.EC2RequestsPerSecond).To(Equal(20.5))
+		Expect(s.EC2RequestBurst).To(Equal(int64(50)))
+		Expect(s.EnableEC2Tracing).To(BeTrue())
+		Expect(s.EnableInstanceProfileCheck).To(BeTrue())
+		Expect(s.EnableInstanceProfileCleanup).To(BeTrue())
+		Expect(s.AllowedZones).To(ConsistOf("us-west-2a", "us-west-2b"))
+		Expect(s.BlockedZones).To(ConsistOf("us-west-2b"))
+		Expect(s.IsZoneAllowed("us-west-2a")).To(BeTrue())
+		Expect(s.IsZoneAllowed("us-west-2b")).To(BeFalse())
+		Expect(s.IsZoneAllowed("us-west-2c")).To(BeFalse())
+		Expect(s.SystemReserved.Cpu().String()).To(Equal("200m"))
+		Expect(s.SystemReserved.Memory().String()).To(Equal("1Gi"))
+		Expect(s.KubeReserved.StorageEphemeral().String()).To(Equal("5Gi"))
 	})
 	It("should fail validation with panic when clusterName not included", func() {
 		cm := &v1.ConfigMap{
@@ -111,4 +248,312 @@ var _ = Describe("Validation", func() {
 		_, err := (&settings.Settings{}).Inject(ctx, cm)
 		Expect(err).To(HaveOccurred())
 	})
+	It("should fail validation when gcResolutionWindow is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":    "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":        "my-cluster",
+				"aws.gcResolutionWindow": "-1m",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when gcDrainTimeout is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.gcDrainTimeout":  "-1m",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when gcDaemonSetDrainPolicy is unknown", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":        "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":            "my-cluster",
+				"aws.gcDaemonSetDrainPolicy": "first",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when staleMachineGracePeriod is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":         "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":             "my-cluster",
+				"aws.staleMachineGracePeriod": "-1m",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when gcLogSampleSize is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.gcLogSampleSize": "-1",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when instanceDiscoveryTagValue is specified without instanceDiscoveryTagKey", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":           "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":               "my-cluster",
+				"aws.instanceDiscoveryTagValue": "blue",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when amiDriftReplacementBudget is less than 1", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":           "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":               "my-cluster",
+				"aws.amiDriftReplacementBudget": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when maxInstanceLifetime is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":     "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":         "my-cluster",
+				"aws.maxInstanceLifetime": "-1h",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when expirationReplacementBudget is less than 1", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":             "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":                 "my-cluster",
+				"aws.expirationReplacementBudget": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when maxConcurrentLaunches is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":       "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":           "my-cluster",
+				"aws.maxConcurrentLaunches": "-1",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when ec2RequestsPerSecond is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":      "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":          "my-cluster",
+				"aws.ec2RequestsPerSecond": "-1",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when ec2RequestBurst is less than one", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.ec2RequestBurst": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when amiCacheTTL is less than a second", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.amiCacheTTL":     "0s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when spotInterruptionLeadTime is not less than the spot interruption warning", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":          "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":              "my-cluster",
+				"aws.spotInterruptionLeadTime": "2m",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when spotInterruptionLeadTime is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":          "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":              "my-cluster",
+				"aws.spotInterruptionLeadTime": "-1s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when minSubnetAvailableIPs is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":       "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":           "my-cluster",
+				"aws.minSubnetAvailableIPs": "-1",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when maxFleetOverrides is less than one", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":   "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":       "my-cluster",
+				"aws.maxFleetOverrides": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when spotFallbackThreshold is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":       "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":           "my-cluster",
+				"aws.spotFallbackThreshold": "-1",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when pricingRefreshInterval is less than a minute", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":        "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":            "my-cluster",
+				"aws.pricingRefreshInterval": "30s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when spotPriceLookupTTL is less than a second", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":    "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":        "my-cluster",
+				"aws.spotPriceLookupTTL": "0s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when spotPriceLookupBudget is less than one", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":       "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":           "my-cluster",
+				"aws.spotPriceLookupBudget": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when unavailableOfferingsTTL is less than a second", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":         "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":             "my-cluster",
+				"aws.unavailableOfferingsTTL": "0s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when instanceTypesRefreshInterval is less than a minute", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":              "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":                  "my-cluster",
+				"aws.instanceTypesRefreshInterval": "30s",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when ec2RetryMaxAttempts is less than one", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint":     "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":         "my-cluster",
+				"aws.ec2RetryMaxAttempts": "0",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when systemReserved contains an unsupported resource", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.systemReserved":  `{"nvidia.com/gpu": "1"}`,
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when kubeReserved is negative", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.kubeReserved":    `{"memory": "-1Gi"}`,
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail validation when kubeReserved is not a valid resource list", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.kubeReserved":    `{"memory": "lots"}`,
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail when allowedZones is not a valid list", func() {
+		cm := &v1.ConfigMap{
+			Data: map[string]string{
+				"aws.clusterEndpoint": "https://00000000000000000000000.gr7.us-west-2.eks.amazonaws.com",
+				"aws.clusterName":     "my-cluster",
+				"aws.allowedZones":    "us-west-2a",
+			},
+		}
+		_, err := (&settings.Settings{}).Inject(ctx, cm)
+		Expect(err).To(HaveOccurred())
+	})
 })
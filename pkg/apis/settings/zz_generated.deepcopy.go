@@ -19,7 +19,9 @@ limitations under the License.
 
 package settings
 
-import ()
+import (
+	"k8s.io/api/core/v1"
+)
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Settings) DeepCopyInto(out *Settings) {
@@ -31,6 +33,30 @@ func (in *Settings) DeepCopyInto(out *Settings) {
 			(*out)[key] = val
 		}
 	}
+	if in.AllowedZones != nil {
+		in, out := &in.AllowedZones, &out.AllowedZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BlockedZones != nil {
+		in, out := &in.BlockedZones, &out.BlockedZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SystemReserved != nil {
+		in, out := &in.SystemReserved, &out.SystemReserved
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.KubeReserved != nil {
+		in, out := &in.KubeReserved, &out.KubeReserved
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Settings.
@@ -15,6 +15,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -55,13 +60,126 @@ type AWSNodeTemplateSpec struct {
 	// this UserData to ensure nodes are being provisioned with the correct configuration.
 	// +optional
 	UserData *string `json:"userData,omitempty"`
-	AWS      `json:",inline"`
+	// UserDataMode controls how UserData is combined with the bootstrap configuration Karpenter generates.
+	// Merge (default) merges UserData with Karpenter's bootstrap configuration, while Override passes UserData
+	// to the instance verbatim, leaving node bootstrapping entirely to the user.
+	// +kubebuilder:validation:Enum:={Merge,Override}
+	// +optional
+	UserDataMode *string `json:"userDataMode,omitempty"`
+	// UserDataEncoding is the encoding of UserData. None (default) is plain text, which Karpenter encodes for the
+	// launch template, while Base64 is decoded first, so that user data that's already encoded isn't encoded twice.
+	// +kubebuilder:validation:Enum:={None,Base64}
+	// +optional
+	UserDataEncoding *string `json:"userDataEncoding,omitempty"`
+	AWS              `json:",inline"`
 	// AMISelector discovers AMIs to be used by Amazon EC2 tags.
 	// +optional
 	AMISelector map[string]string `json:"amiSelector,omitempty"`
+	// InstanceProfileSelector discovers the instance profile that instances use by IAM tags, or by the roles it contains
+	// with the key aws::roles. If several profiles match, the one whose name sorts first is used.
+	// +optional
+	InstanceProfileSelector map[string]string `json:"instanceProfileSelector,omitempty"`
 	// DetailedMonitoring controls if detailed monitoring is enabled for instances that are launched
 	// +optional
 	DetailedMonitoring *bool `json:"detailedMonitoring,omitempty"`
+	// KeyName is the name of an existing EC2 key pair that instances are launched with, e.g. for SSH access when
+	// debugging. If omitted, instances are launched without a key pair.
+	// +optional
+	KeyName *string `json:"keyName,omitempty"`
+	// CapacityReservationSelector discovers On-Demand Capacity Reservations to launch on-demand instances into by
+	// Amazon EC2 tags or by IDs with the key aws-ids.
+	// +optional
+	CapacityReservationSelector map[string]string `json:"capacityReservationSelector,omitempty"`
+	// Placement configures the placement group that instances are launched into.
+	// +optional
+	Placement *Placement `json:"placement,omitempty"`
+	// Tenancy is the tenancy of the instances that are launched, one of default, dedicated or host. Instance types
+	// that can't run on single-tenant hardware are excluded from dedicated and host launches, which only launch
+	// on-demand capacity.
+	// +kubebuilder:validation:Enum:={default,dedicated,host}
+	// +optional
+	Tenancy *string `json:"tenancy,omitempty"`
+	// HostID is the ID of the Dedicated Host that instances are launched onto. Only valid with host tenancy.
+	// +optional
+	HostID *string `json:"hostID,omitempty"`
+	// HostResourceGroupARN is the ARN of the host resource group that instances are launched into. Only valid with
+	// host tenancy.
+	// +optional
+	HostResourceGroupARN *string `json:"hostResourceGroupARN,omitempty"`
+	// PrivateDNSNameOptions configures the hostnames of instances and the DNS records that resolve them. If omitted,
+	// the hostname type is inherited from the subnet that an instance is launched into.
+	// +optional
+	PrivateDNSNameOptions *PrivateDNSNameOptions `json:"privateDNSNameOptions,omitempty"`
+	// EFA attaches an Elastic Fabric Adapter as the primary network interface of instances that are launched, and
+	// restricts launches to instance types that support EFA.
+	// +optional
+	EFA *bool `json:"efa,omitempty"`
+	// NetworkInterfaces are secondary network interfaces that are attached to instances at launch, in addition to the
+	// primary network interface. Instance types that can't attach all of the interfaces are excluded from launches.
+	// +optional
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+	// MaxPrice is the maximum hourly price in USD, e.g. "0.50", that an instance can be launched at. Spot and on-demand
+	// offerings priced above it are excluded from launches.
+	// +kubebuilder:validation:Pattern:="^[0-9]+(\\.[0-9]+)?$"
+	// +optional
+	MaxPrice *string `json:"maxPrice,omitempty"`
+	// OnDemandBaseCapacity is the number of on-demand nodes that each provisioner using this node template keeps before
+	// it launches spot. Machines that allow both capacity types are launched on-demand until the provisioner has this
+	// many on-demand nodes, and spot is preferred as usual from then on.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	OnDemandBaseCapacity *int64 `json:"onDemandBaseCapacity,omitempty"`
+	// DeletionMode controls what happens to instances when their nodes are deleted. Terminate (default) terminates
+	// instances, while Stop stops them so that they can be resumed. Instances with an instance store root device and
+	// spot instances can't be stopped, so they're terminated regardless.
+	// +kubebuilder:validation:Enum:={Terminate,Stop}
+	// +optional
+	DeletionMode *string `json:"deletionMode,omitempty"`
+	// StartupTaints are registered with nodes by their user data, along with the taints and startup taints of the
+	// provisioner, which take precedence over a startup taint with the same key and effect. Like the startup taints of
+	// the provisioner, they're ignored when scheduling and are expected to be removed once nodes are initialized.
+	// +optional
+	StartupTaints []v1.Taint `json:"startupTaints,omitempty"`
+}
+
+// Placement configures the placement group that instances are launched into
+type Placement struct {
+	// GroupName is the name of an existing placement group to launch instances into.
+	GroupName string `json:"groupName"`
+	// Strategy is the strategy of the placement group, one of cluster, spread or partition. Instance types that
+	// don't support the strategy are excluded from launches.
+	Strategy string `json:"strategy"`
+}
+
+// NetworkInterface is a secondary network interface that is attached to instances at launch
+type NetworkInterface struct {
+	// DeviceIndex is the position of the network interface in the attachment order. The primary network interface has
+	// device index 0, so secondary network interfaces start at 1.
+	// +kubebuilder:validation:Minimum:=1
+	DeviceIndex int64 `json:"deviceIndex"`
+	// SubnetID is the ID of the subnet that the network interface is created in. Instances are launched into the zone
+	// of their primary subnet, so it must be in a zone that instances can be launched into.
+	// +kubebuilder:validation:Pattern:="^subnet-[0-9a-z]+$"
+	SubnetID string `json:"subnetID"`
+	// SecurityGroupIDs are the IDs of the security groups of the network interface. If omitted, the security groups
+	// of the node template are used.
+	// +optional
+	SecurityGroupIDs []string `json:"securityGroupIDs,omitempty"`
+}
+
+// PrivateDNSNameOptions configures the hostnames of instances and the DNS records that resolve them
+type PrivateDNSNameOptions struct {
+	// HostnameType is the type of hostname of instances, one of ip-name, e.g. ip-10-0-0-1.ec2.internal, or
+	// resource-name, e.g. i-0123456789abcdef0.ec2.internal.
+	// +kubebuilder:validation:Enum:={ip-name,resource-name}
+	// +optional
+	HostnameType *string `json:"hostnameType,omitempty"`
+	// EnableResourceNameDNSARecord enables DNS A records that resolve the resource-based hostname of instances.
+	// +optional
+	EnableResourceNameDNSARecord *bool `json:"enableResourceNameDNSARecord,omitempty"`
+	// EnableResourceNameDNSAAAARecord enables DNS AAAA records that resolve the resource-based hostname of instances.
+	// +optional
+	EnableResourceNameDNSAAAARecord *bool `json:"enableResourceNameDNSAAAARecord,omitempty"`
 }
 
 // AWSNodeTemplate is the Schema for the AWSNodeTemplate API
@@ -83,3 +201,16 @@ type AWSNodeTemplateList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []AWSNodeTemplate `json:"items"`
 }
+
+// DecodedUserData returns UserData as plain text, decoding it if it's base64 encoded. Line breaks that encoders wrap
+// long output with are ignored.
+func (a *AWSNodeTemplateSpec) DecodedUserData() (*string, error) {
+	if a.UserData == nil || lo.FromPtr(a.UserDataEncoding) != UserDataEncodingBase64 {
+		return a.UserData, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(*a.UserData), ""))
+	if err != nil {
+		return nil, err
+	}
+	return lo.ToPtr(string(decoded)), nil
+}
@@ -18,20 +18,44 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/samber/lo"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/pkg/apis"
 
 	"github.com/aws/karpenter-core/pkg/utils/functional"
 )
 
 const (
-	userDataPath    = "userData"
-	amiSelectorPath = "amiSelector"
+	userDataPath                    = "userData"
+	userDataModePath                = "userDataMode"
+	userDataEncodingPath            = "userDataEncoding"
+	amiSelectorPath                 = "amiSelector"
+	instanceProfileSelectorPath     = "instanceProfileSelector"
+	capacityReservationSelectorPath = "capacityReservationSelector"
+	placementPath                   = "placement"
+	maxPricePath                    = "maxPrice"
+	deletionModePath                = "deletionMode"
+	tenancyPath                     = "tenancy"
+	hostIDPath                      = "hostID"
+	hostResourceGroupARNPath        = "hostResourceGroupARN"
+	privateDNSNameOptionsPath       = "privateDNSNameOptions"
+	efaPath                         = "efa"
+	networkInterfacesPath           = "networkInterfaces"
+	startupTaintsPath               = "startupTaints"
+	keyNamePath                     = "keyName"
+	onDemandBaseCapacityPath        = "onDemandBaseCapacity"
 )
 
 var (
-	amiRegex = regexp.MustCompile("ami-[0-9a-z]+")
+	amiRegex                 = regexp.MustCompile("ami-[0-9a-z]+")
+	capacityReservationRegex = regexp.MustCompile("cr-[0-9a-z]+")
+	subnetIDRegex            = regexp.MustCompile("^subnet-[0-9a-z]+$")
+	securityGroupIDRegex     = regexp.MustCompile("^sg-[0-9a-z]+$")
 )
 
 func (a *AWSNodeTemplate) SupportedVerbs() []admissionregistrationv1.OperationType {
@@ -54,16 +78,37 @@ func (a *AWSNodeTemplateSpec) validate(_ context.Context) (errs *apis.FieldError
 		a.validateUserData(),
 		a.validateAMISelector(),
 		a.validateAMIFamily(),
+		a.validateInstanceProfileSelector(),
+		a.validateCapacityReservationSelector(),
+		a.validatePlacement(),
+		a.validateTenancy(),
+		a.validatePrivateDNSNameOptions(),
+		a.validateEFA(),
+		a.validateNetworkInterfaces(),
+		a.validateMaxPrice(),
+		a.validateDeletionMode(),
+		a.validateStartupTaints(),
+		a.validateKeyName(),
+		a.validateOnDemandBaseCapacity(),
 	)
 }
 
 func (a *AWSNodeTemplateSpec) validateUserData() (errs *apis.FieldError) {
+	if a.UserDataMode != nil && !lo.Contains(SupportedUserDataModes, *a.UserDataMode) {
+		errs = errs.Also(apis.ErrInvalidValue(*a.UserDataMode, userDataModePath))
+	}
+	if a.UserDataEncoding != nil && !lo.Contains(SupportedUserDataEncodings, *a.UserDataEncoding) {
+		errs = errs.Also(apis.ErrInvalidValue(*a.UserDataEncoding, userDataEncodingPath))
+	}
 	if a.UserData == nil {
-		return nil
+		return errs
 	}
-	if a.LaunchTemplateName != nil {
+	if a.HasCustomLaunchTemplate() {
 		errs = errs.Also(apis.ErrMultipleOneOf(userDataPath, launchTemplatePath))
 	}
+	if _, err := a.DecodedUserData(); err != nil {
+		errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("expected base64 encoded user data, %s", err), userDataPath))
+	}
 	return errs
 }
 
@@ -81,14 +126,29 @@ func (a *AWSNodeTemplateSpec) validateAMISelector() (errs *apis.FieldError) {
 	if a.AMISelector == nil {
 		return nil
 	}
-	if a.LaunchTemplateName != nil {
+	if a.HasCustomLaunchTemplate() {
 		errs = errs.Also(apis.ErrMultipleOneOf(amiSelectorPath, launchTemplatePath))
 	}
+	if len(a.AMISelector) == 0 {
+		return errs.Also(apis.ErrGeneric("expected at least one selector term", amiSelectorPath))
+	}
 	for key, value := range a.AMISelector {
 		if key == "" || value == "" {
 			errs = errs.Also(apis.ErrInvalidValue("\"\"", fmt.Sprintf("%s['%s']", amiSelectorPath, key)))
 		}
-		if key == "aws-ids" {
+		if key == "aws::ssm" {
+			if !strings.HasPrefix(value, "/") {
+				fieldValue := fmt.Sprintf("\"%s\"", value)
+				message := fmt.Sprintf("%s['%s'] must be an ssm parameter path starting with '/'", amiSelectorPath, key)
+				errs = errs.Also(apis.ErrInvalidValue(fieldValue, message))
+			}
+			_, hasIDs := a.AMISelector["aws::ids"]
+			_, hasLegacyIDs := a.AMISelector["aws-ids"]
+			if hasIDs || hasLegacyIDs {
+				errs = errs.Also(apis.ErrMultipleOneOf(fmt.Sprintf("%s['%s']", amiSelectorPath, key), fmt.Sprintf("%s['aws::ids']", amiSelectorPath)))
+			}
+		}
+		if key == "aws-ids" || key == "aws::ids" {
 			for _, amiID := range functional.SplitCommaSeparatedString(value) {
 				if !amiRegex.MatchString(amiID) {
 					fieldValue := fmt.Sprintf("\"%s\"", amiID)
@@ -98,5 +158,214 @@ func (a *AWSNodeTemplateSpec) validateAMISelector() (errs *apis.FieldError) {
 			}
 		}
 	}
+	return errs.Also(a.validateAMISelectorTerms())
+}
+
+// validateAMISelectorTerms rejects combinations of amiSelector terms that don't resolve to a well-defined set of AMIs.
+// IDs already identify the AMIs, so they can't be narrowed by names or tags, and owners alone would match every AMI that
+// the owners have published.
+func (a *AWSNodeTemplateSpec) validateAMISelectorTerms() (errs *apis.FieldError) {
+	_, hasIDs := a.AMISelector["aws::ids"]
+	_, hasLegacyIDs := a.AMISelector["aws-ids"]
+	if hasIDs && hasLegacyIDs {
+		errs = errs.Also(apis.ErrMultipleOneOf(fmt.Sprintf("%s['aws::ids']", amiSelectorPath), fmt.Sprintf("%s['aws-ids']", amiSelectorPath)))
+	}
+	if hasIDs || hasLegacyIDs {
+		idsKey := lo.Ternary(hasIDs, "aws::ids", "aws-ids")
+		for _, key := range lo.Keys(a.AMISelector) {
+			if lo.Contains([]string{"aws::ids", "aws-ids", "aws::ssm", "aws::owners"}, key) {
+				continue
+			}
+			errs = errs.Also(apis.ErrMultipleOneOf(fmt.Sprintf("%s['%s']", amiSelectorPath, idsKey), fmt.Sprintf("%s['%s']", amiSelectorPath, key)))
+		}
+	}
+	if _, hasOwners := a.AMISelector["aws::owners"]; hasOwners && len(a.AMISelector) == 1 {
+		errs = errs.Also(apis.ErrGeneric("expected an id, name or tag selector term alongside owners", fmt.Sprintf("%s['aws::owners']", amiSelectorPath)))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateInstanceProfileSelector() (errs *apis.FieldError) {
+	if a.InstanceProfileSelector == nil {
+		return nil
+	}
+	if a.InstanceProfile != nil {
+		errs = errs.Also(apis.ErrMultipleOneOf(instanceProfileSelectorPath, instanceProfilePath))
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(instanceProfileSelectorPath, launchTemplatePath))
+	}
+	if len(a.InstanceProfileSelector) == 0 {
+		return errs.Also(apis.ErrGeneric("expected at least one selector term", instanceProfileSelectorPath))
+	}
+	for key, value := range a.InstanceProfileSelector {
+		if key == "" || value == "" {
+			errs = errs.Also(apis.ErrInvalidValue("\"\"", fmt.Sprintf("%s['%s']", instanceProfileSelectorPath, key)))
+		}
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateCapacityReservationSelector() (errs *apis.FieldError) {
+	for key, value := range a.CapacityReservationSelector {
+		if key == "" || value == "" {
+			errs = errs.Also(apis.ErrInvalidValue("\"\"", fmt.Sprintf("%s['%s']", capacityReservationSelectorPath, key)))
+		}
+		if key == "aws-ids" {
+			for _, capacityReservationID := range functional.SplitCommaSeparatedString(value) {
+				if !capacityReservationRegex.MatchString(capacityReservationID) {
+					fieldValue := fmt.Sprintf("\"%s\"", capacityReservationID)
+					message := fmt.Sprintf("%s['%s'] must be a valid capacity-reservation-id (regex: %s)", capacityReservationSelectorPath, key, capacityReservationRegex.String())
+					errs = errs.Also(apis.ErrInvalidValue(fieldValue, message))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validatePlacement() (errs *apis.FieldError) {
+	if a.Placement == nil {
+		return nil
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(placementPath, launchTemplatePath))
+	}
+	if a.Placement.GroupName == "" {
+		errs = errs.Also(apis.ErrMissingField(fmt.Sprintf("%s.groupName", placementPath)))
+	}
+	if !lo.Contains(SupportedPlacementStrategies, a.Placement.Strategy) {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s not in %v", a.Placement.Strategy, strings.Join(SupportedPlacementStrategies, ", ")), fmt.Sprintf("%s.strategy", placementPath)))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateTenancy() (errs *apis.FieldError) {
+	if a.Tenancy != nil && !lo.Contains(SupportedTenancies, *a.Tenancy) {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s not in %v", *a.Tenancy, strings.Join(SupportedTenancies, ", ")), tenancyPath))
+	}
+	if a.Tenancy != nil && a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(tenancyPath, launchTemplatePath))
+	}
+	if lo.FromPtr(a.Tenancy) != TenancyHost {
+		if a.HostID != nil {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("%s is only valid with %s tenancy", hostIDPath, TenancyHost), hostIDPath))
+		}
+		if a.HostResourceGroupARN != nil {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("%s is only valid with %s tenancy", hostResourceGroupARNPath, TenancyHost), hostResourceGroupARNPath))
+		}
+		return errs
+	}
+	switch {
+	case a.HostID == nil && a.HostResourceGroupARN == nil:
+		errs = errs.Also(apis.ErrMissingOneOf(hostIDPath, hostResourceGroupARNPath))
+	case a.HostID != nil && a.HostResourceGroupARN != nil:
+		errs = errs.Also(apis.ErrMultipleOneOf(hostIDPath, hostResourceGroupARNPath))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validatePrivateDNSNameOptions() (errs *apis.FieldError) {
+	if a.PrivateDNSNameOptions == nil {
+		return nil
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(privateDNSNameOptionsPath, launchTemplatePath))
+	}
+	if hostnameType := a.PrivateDNSNameOptions.HostnameType; hostnameType != nil && !lo.Contains(SupportedHostnameTypes, *hostnameType) {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s not in %v", *hostnameType, strings.Join(SupportedHostnameTypes, ", ")), fmt.Sprintf("%s.hostnameType", privateDNSNameOptionsPath)))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateEFA() (errs *apis.FieldError) {
+	if lo.FromPtr(a.EFA) && a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(efaPath, launchTemplatePath))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateNetworkInterfaces() (errs *apis.FieldError) {
+	if len(a.NetworkInterfaces) == 0 {
+		return nil
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(networkInterfacesPath, launchTemplatePath))
+	}
+	deviceIndexes := map[int64]bool{}
+	for i, networkInterface := range a.NetworkInterfaces {
+		if networkInterface.DeviceIndex < 1 {
+			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%d must be at least 1, device index 0 is the primary network interface", networkInterface.DeviceIndex), "deviceIndex").ViaFieldIndex(networkInterfacesPath, i))
+		} else if deviceIndexes[networkInterface.DeviceIndex] {
+			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%d is used by another network interface", networkInterface.DeviceIndex), "deviceIndex").ViaFieldIndex(networkInterfacesPath, i))
+		}
+		deviceIndexes[networkInterface.DeviceIndex] = true
+		if !subnetIDRegex.MatchString(networkInterface.SubnetID) {
+			errs = errs.Also(apis.ErrInvalidValue(networkInterface.SubnetID, "subnetID").ViaFieldIndex(networkInterfacesPath, i))
+		}
+		for j, id := range networkInterface.SecurityGroupIDs {
+			if !securityGroupIDRegex.MatchString(id) {
+				errs = errs.Also(apis.ErrInvalidArrayValue(id, "securityGroupIDs", j).ViaFieldIndex(networkInterfacesPath, i))
+			}
+		}
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateMaxPrice() (errs *apis.FieldError) {
+	if a.MaxPrice == nil {
+		return nil
+	}
+	if price, err := strconv.ParseFloat(*a.MaxPrice, 64); err != nil || price <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s must be a positive hourly price", *a.MaxPrice), maxPricePath))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateDeletionMode() (errs *apis.FieldError) {
+	if a.DeletionMode != nil && !lo.Contains(SupportedDeletionModes, *a.DeletionMode) {
+		errs = errs.Also(apis.ErrInvalidValue(*a.DeletionMode, deletionModePath))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateStartupTaints() (errs *apis.FieldError) {
+	if len(a.StartupTaints) == 0 {
+		return nil
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(startupTaintsPath, launchTemplatePath))
+	}
+	for i, taint := range a.StartupTaints {
+		for _, msg := range validation.IsQualifiedName(taint.Key) {
+			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s, %s", taint.Key, msg), "key").ViaFieldIndex(startupTaintsPath, i))
+		}
+		for _, msg := range validation.IsValidLabelValue(taint.Value) {
+			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%s, %s", taint.Value, msg), "value").ViaFieldIndex(startupTaintsPath, i))
+		}
+		if !lo.Contains([]v1.TaintEffect{v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute}, taint.Effect) {
+			errs = errs.Also(apis.ErrInvalidValue(taint.Effect, "effect").ViaFieldIndex(startupTaintsPath, i))
+		}
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateKeyName() (errs *apis.FieldError) {
+	if a.KeyName == nil {
+		return nil
+	}
+	if a.HasCustomLaunchTemplate() {
+		errs = errs.Also(apis.ErrMultipleOneOf(keyNamePath, launchTemplatePath))
+	}
+	if *a.KeyName == "" {
+		errs = errs.Also(apis.ErrInvalidValue("\"\"", keyNamePath))
+	}
+	return errs
+}
+
+func (a *AWSNodeTemplateSpec) validateOnDemandBaseCapacity() (errs *apis.FieldError) {
+	if a.OnDemandBaseCapacity != nil && *a.OnDemandBaseCapacity < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("%d must not be negative", *a.OnDemandBaseCapacity), onDemandBaseCapacityPath))
+	}
 	return errs
 }
@@ -54,6 +54,13 @@ type LaunchTemplate struct {
 	// as `launchTemplate` for backwards compatibility.
 	// +optional
 	LaunchTemplateName *string `json:"launchTemplate,omitempty"`
+	// LaunchTemplateID of a custom launch template for the node, which is referenced by its ID instead of its name.
+	// +optional
+	LaunchTemplateID *string `json:"launchTemplateID,omitempty"`
+	// LaunchTemplateVersion of the custom launch template that nodes are launched from, either a version number,
+	// $Latest or $Default. Defaults to $Latest.
+	// +optional
+	LaunchTemplateVersion *string `json:"launchTemplateVersion,omitempty"`
 	// MetadataOptions for the generated launch template of provisioned nodes.
 	//
 	// This specifies the exposure of the Instance Metadata Service to
@@ -66,13 +73,28 @@ type LaunchTemplate struct {
 	// (https://aws.github.io/aws-eks-best-practices/security/docs/iam/#restrict-access-to-the-instance-profile-assigned-to-the-worker-node)
 	// for limiting exposure of Instance Metadata and User Data to pods.
 	// If omitted, defaults to httpEndpoint enabled, with httpProtocolIPv6
-	// disabled, with httpPutResponseLimit of 2, and with httpTokens
-	// required.
+	// disabled, with httpPutResponseLimit of 2, with httpTokens
+	// required, and with instanceMetadataTags disabled.
 	// +optional
 	MetadataOptions *MetadataOptions `json:"metadataOptions,omitempty"`
 	// BlockDeviceMappings to be applied to provisioned nodes.
 	// +optionals
 	BlockDeviceMappings []*BlockDeviceMapping `json:"blockDeviceMappings,omitempty"`
+	// EncryptedByDefault encrypts every EBS volume in the generated launch template
+	// that doesn't explicitly set encrypted to false.
+	// +optional
+	EncryptedByDefault *bool `json:"encryptedByDefault,omitempty"`
+	// KMSKeyID (ARN) of the symmetric Key Management Service (KMS) CMK used to encrypt
+	// EBS volumes when EncryptedByDefault is set. Volumes that specify their own KMSKeyID
+	// use that key instead.
+	// +optional
+	KMSKeyID *string `json:"kmsKeyID,omitempty"`
+}
+
+// HasCustomLaunchTemplate returns true if nodes are launched from a custom launch template, referenced by its name or
+// ID, instead of a generated one
+func (l *LaunchTemplate) HasCustomLaunchTemplate() bool {
+	return l.LaunchTemplateName != nil || l.LaunchTemplateID != nil
 }
 
 // MetadataOptions contains parameters for specifying the exposure of the
@@ -97,13 +119,13 @@ type MetadataOptions struct {
 	// instance metadata requests. The larger the number, the further instance
 	// metadata requests can travel. Possible values are integers from 1 to 64.
 	// If metadata options is non-nil, but this parameter is not specified, the
-	// default value is 1.
+	// default value is 2.
 	// +optional
 	HTTPPutResponseHopLimit *int64 `json:"httpPutResponseHopLimit,omitempty"`
 
 	// HTTPTokens determines the state of token usage for instance metadata
 	// requests. If metadata options is non-nil, but this parameter is not
-	// specified, the default state is "optional".
+	// specified, the default state is "required".
 	//
 	// If the state is optional, one can choose to retrieve instance metadata with
 	// or without a signed token header on the request. If one retrieves the IAM
@@ -117,6 +139,12 @@ type MetadataOptions struct {
 	// 1.0 credentials are not available.
 	// +optional
 	HTTPTokens *string `json:"httpTokens,omitempty"`
+
+	// InstanceMetadataTags enables or disables access to instance tags from the
+	// instance metadata service on provisioned nodes. If metadata options is non-nil,
+	// but this parameter is not specified, the default state is "disabled".
+	// +optional
+	InstanceMetadataTags *string `json:"instanceMetadataTags,omitempty"`
 }
 
 type BlockDeviceMapping struct {
@@ -17,9 +17,11 @@ package v1alpha1
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"knative.dev/pkg/apis"
 
@@ -28,19 +30,35 @@ import (
 
 const (
 	launchTemplatePath          = "launchTemplate"
+	launchTemplateIDPath        = "launchTemplateID"
+	launchTemplateVersionPath   = "launchTemplateVersion"
 	securityGroupSelectorPath   = "securityGroupSelector"
 	fieldPathSubnetSelectorPath = "subnetSelector"
 	amiFamilyPath               = "amiFamily"
 	metadataOptionsPath         = "metadataOptions"
 	instanceProfilePath         = "instanceProfile"
 	blockDeviceMappingsPath     = "blockDeviceMappings"
+	encryptedByDefaultPath      = "encryptedByDefault"
+	kmsKeyIDPath                = "kmsKeyID"
 )
 
 var (
 	minVolumeSize      = *resource.NewScaledQuantity(1, resource.Giga)
 	maxVolumeSize      = *resource.NewScaledQuantity(64, resource.Tera)
+	minThroughput      = int64(125)
+	maxThroughput      = int64(1000)
 	subnetRegex        = regexp.MustCompile("subnet-[0-9a-z]+")
 	securityGroupRegex = regexp.MustCompile("sg-[0-9a-z]+")
+	vpcRegex           = regexp.MustCompile("vpc-[0-9a-z]+")
+	// iopsRanges are the minimum and maximum IOPS that can be provisioned for each volume type that supports IOPS
+	iopsRanges = map[string][2]int64{
+		ec2.VolumeTypeGp3: {3000, 16000},
+		ec2.VolumeTypeIo1: {100, 64000},
+		ec2.VolumeTypeIo2: {100, 64000},
+	}
+	launchTemplateIDRegex = regexp.MustCompile("^lt-[0-9a-z]+$")
+	// launchTemplateVersionRegex matches a launch template version number, $Latest or $Default
+	launchTemplateVersionRegex = regexp.MustCompile(`^([1-9][0-9]*|\$Latest|\$Default)$`)
 )
 
 func (a *AWS) Validate() (errs *apis.FieldError) {
@@ -58,12 +76,27 @@ func (a *AWS) validate() (errs *apis.FieldError) {
 		a.validateMetadataOptions(),
 		a.validateAMIFamily(),
 		a.validateBlockDeviceMappings(),
+		a.validateEncryptedByDefault(),
 	)
 }
 
 func (a *AWS) validateLaunchTemplate() (errs *apis.FieldError) {
-	if a.LaunchTemplateName == nil {
-		return nil
+	if !a.HasCustomLaunchTemplate() {
+		if a.LaunchTemplateVersion != nil {
+			errs = errs.Also(apis.ErrGeneric(fmt.Sprintf("%s requires %s or %s", launchTemplateVersionPath, launchTemplatePath, launchTemplateIDPath), launchTemplateVersionPath))
+		}
+		return errs
+	}
+	if a.LaunchTemplateName != nil && a.LaunchTemplateID != nil {
+		errs = errs.Also(apis.ErrMultipleOneOf(launchTemplatePath, launchTemplateIDPath))
+	}
+	if a.LaunchTemplateID != nil && !launchTemplateIDRegex.MatchString(*a.LaunchTemplateID) {
+		message := fmt.Sprintf("%s must be a valid launch template id (regex: %s)", launchTemplateIDPath, launchTemplateIDRegex.String())
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("\"%s\"", *a.LaunchTemplateID), message))
+	}
+	if a.LaunchTemplateVersion != nil && !launchTemplateVersionRegex.MatchString(*a.LaunchTemplateVersion) {
+		message := fmt.Sprintf("%s must be a version number, $Latest or $Default", launchTemplateVersionPath)
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf("\"%s\"", *a.LaunchTemplateVersion), message))
 	}
 	if a.SecurityGroupSelector != nil {
 		errs = errs.Also(apis.ErrMultipleOneOf(launchTemplatePath, securityGroupSelectorPath))
@@ -80,6 +113,12 @@ func (a *AWS) validateLaunchTemplate() (errs *apis.FieldError) {
 	if len(a.BlockDeviceMappings) != 0 {
 		errs = errs.Also(apis.ErrMultipleOneOf(launchTemplatePath, blockDeviceMappingsPath))
 	}
+	if a.EncryptedByDefault != nil {
+		errs = errs.Also(apis.ErrMultipleOneOf(launchTemplatePath, encryptedByDefaultPath))
+	}
+	if a.KMSKeyID != nil {
+		errs = errs.Also(apis.ErrMultipleOneOf(launchTemplatePath, kmsKeyIDPath))
+	}
 	return errs
 }
 
@@ -105,7 +144,7 @@ func (a *AWS) validateSubnets() (errs *apis.FieldError) {
 }
 
 func (a *AWS) validateSecurityGroups() (errs *apis.FieldError) {
-	if a.LaunchTemplateName != nil {
+	if a.HasCustomLaunchTemplate() {
 		return nil
 	}
 	if a.SecurityGroupSelector == nil {
@@ -124,6 +163,11 @@ func (a *AWS) validateSecurityGroups() (errs *apis.FieldError) {
 				}
 			}
 		}
+		if key == "aws-vpc-id" && !vpcRegex.MatchString(value) {
+			fieldValue := fmt.Sprintf("\"%s\"", value)
+			message := fmt.Sprintf("%s['%s'] must be a valid vpc-id (regex: %s)", securityGroupSelectorPath, key, vpcRegex.String())
+			errs = errs.Also(apis.ErrInvalidValue(fieldValue, message))
+		}
 	}
 	return errs
 }
@@ -136,6 +180,12 @@ func (a *AWS) validateTags() (errs *apis.FieldError) {
 			errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
 				"the tag with key : '' and value : '%s' is invalid because empty tag keys aren't supported", tagValue), "tags"))
 		}
+		for _, template := range tagTemplateRegex.FindAllString(tagValue, -1) {
+			if !lo.Contains(SupportedTagTemplates, template) {
+				errs = errs.Also(apis.ErrInvalidValue(fmt.Sprintf(
+					"the tag with key : '%s' and value : '%s' is invalid because %s isn't one of %s", tagKey, tagValue, template, strings.Join(SupportedTagTemplates, ", ")), "tags"))
+			}
+		}
 	}
 	return errs
 }
@@ -149,6 +199,7 @@ func (a *AWS) validateMetadataOptions() (errs *apis.FieldError) {
 		a.validateHTTPProtocolIpv6(),
 		a.validateHTTPPutResponseHopLimit(),
 		a.validateHTTPTokens(),
+		a.validateInstanceMetadataTags(),
 	).ViaField(metadataOptionsPath)
 }
 
@@ -184,6 +235,13 @@ func (a *AWS) validateHTTPTokens() *apis.FieldError {
 	return a.validateStringEnum(*a.MetadataOptions.HTTPTokens, "httpTokens", ec2.LaunchTemplateHttpTokensState_Values())
 }
 
+func (a *AWS) validateInstanceMetadataTags() *apis.FieldError {
+	if a.MetadataOptions.InstanceMetadataTags == nil {
+		return nil
+	}
+	return a.validateStringEnum(*a.MetadataOptions.InstanceMetadataTags, "instanceMetadataTags", ec2.LaunchTemplateInstanceMetadataTagsState_Values())
+}
+
 func (a *AWS) validateAMIFamily() *apis.FieldError {
 	if a.AMIFamily == nil {
 		return nil
@@ -209,6 +267,13 @@ func (a *AWS) validateBlockDeviceMappings() (errs *apis.FieldError) {
 	return errs
 }
 
+func (a *AWS) validateEncryptedByDefault() *apis.FieldError {
+	if a.KMSKeyID != nil && !lo.FromPtr(a.EncryptedByDefault) {
+		return apis.ErrGeneric(fmt.Sprintf("%s requires %s to be true", kmsKeyIDPath, encryptedByDefaultPath), kmsKeyIDPath)
+	}
+	return nil
+}
+
 func (a *AWS) validateBlockDeviceMapping(blockDeviceMapping *BlockDeviceMapping) (errs *apis.FieldError) {
 	return errs.Also(a.validateDeviceName(blockDeviceMapping), a.validateEBS(blockDeviceMapping))
 }
@@ -227,6 +292,8 @@ func (a *AWS) validateEBS(blockDeviceMapping *BlockDeviceMapping) (errs *apis.Fi
 	for _, err := range []*apis.FieldError{
 		a.validateVolumeType(blockDeviceMapping),
 		a.validateVolumeSize(blockDeviceMapping),
+		a.validateIOPS(blockDeviceMapping),
+		a.validateThroughput(blockDeviceMapping),
 	} {
 		if err != nil {
 			errs = errs.Also(err.ViaField("ebs"))
@@ -242,6 +309,36 @@ func (a *AWS) validateVolumeType(blockDeviceMapping *BlockDeviceMapping) *apis.F
 	return nil
 }
 
+func (a *AWS) validateIOPS(blockDeviceMapping *BlockDeviceMapping) *apis.FieldError {
+	if blockDeviceMapping.EBS.IOPS == nil {
+		return nil
+	}
+	volumeType := lo.FromPtr(blockDeviceMapping.EBS.VolumeType)
+	iopsRange, ok := iopsRanges[volumeType]
+	if !ok {
+		volumeTypes := lo.Keys(iopsRanges)
+		sort.Strings(volumeTypes)
+		return apis.ErrGeneric(fmt.Sprintf("iops is only supported for %s volumes", strings.Join(volumeTypes, ", ")), "iops")
+	}
+	if iops := *blockDeviceMapping.EBS.IOPS; iops < iopsRange[0] || iops > iopsRange[1] {
+		return apis.ErrOutOfBoundsValue(iops, iopsRange[0], iopsRange[1], "iops")
+	}
+	return nil
+}
+
+func (a *AWS) validateThroughput(blockDeviceMapping *BlockDeviceMapping) *apis.FieldError {
+	if blockDeviceMapping.EBS.Throughput == nil {
+		return nil
+	}
+	if lo.FromPtr(blockDeviceMapping.EBS.VolumeType) != ec2.VolumeTypeGp3 {
+		return apis.ErrGeneric(fmt.Sprintf("throughput is only supported for %s volumes", ec2.VolumeTypeGp3), "throughput")
+	}
+	if throughput := *blockDeviceMapping.EBS.Throughput; throughput < minThroughput || throughput > maxThroughput {
+		return apis.ErrOutOfBoundsValue(throughput, minThroughput, maxThroughput, "throughput")
+	}
+	return nil
+}
+
 func (a *AWS) validateVolumeSize(blockDeviceMapping *BlockDeviceMapping) *apis.FieldError {
 	// if an EBS mapping is present, one of volumeSize or snapshotID must be present
 	if blockDeviceMapping.EBS.SnapshotID != nil && blockDeviceMapping.EBS.VolumeSize == nil {
@@ -22,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/apis"
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 )
@@ -41,23 +42,73 @@ var (
 	AMIFamilyBottlerocket = "Bottlerocket"
 	AMIFamilyAL2          = "AL2"
 	AMIFamilyUbuntu       = "Ubuntu"
+	AMIFamilyWindows2019  = "Windows2019"
+	AMIFamilyWindows2022  = "Windows2022"
 	AMIFamilyCustom       = "Custom"
 	SupportedAMIFamilies  = []string{
 		AMIFamilyBottlerocket,
 		AMIFamilyAL2,
 		AMIFamilyUbuntu,
+		AMIFamilyWindows2019,
+		AMIFamilyWindows2022,
 		AMIFamilyCustom,
 	}
 	SupportedContainerRuntimesByAMIFamily = map[string]sets.String{
 		AMIFamilyBottlerocket: sets.NewString("containerd"),
 		AMIFamilyAL2:          sets.NewString("dockerd", "containerd"),
 		AMIFamilyUbuntu:       sets.NewString("dockerd", "containerd"),
+		AMIFamilyWindows2019:  sets.NewString("containerd"),
+		AMIFamilyWindows2022:  sets.NewString("containerd"),
+	}
+	PlacementStrategyCluster     = ec2.PlacementStrategyCluster
+	PlacementStrategySpread      = ec2.PlacementStrategySpread
+	PlacementStrategyPartition   = ec2.PlacementStrategyPartition
+	SupportedPlacementStrategies = []string{
+		PlacementStrategyCluster,
+		PlacementStrategySpread,
+		PlacementStrategyPartition,
+	}
+	TenancyDefault     = ec2.TenancyDefault
+	TenancyDedicated   = ec2.TenancyDedicated
+	TenancyHost        = ec2.TenancyHost
+	SupportedTenancies = []string{
+		TenancyDefault,
+		TenancyDedicated,
+		TenancyHost,
+	}
+	HostnameTypeIPName       = ec2.HostnameTypeIpName
+	HostnameTypeResourceName = ec2.HostnameTypeResourceName
+	SupportedHostnameTypes   = []string{
+		HostnameTypeIPName,
+		HostnameTypeResourceName,
+	}
+	UserDataModeMerge      = "Merge"
+	UserDataModeOverride   = "Override"
+	SupportedUserDataModes = []string{
+		UserDataModeMerge,
+		UserDataModeOverride,
+	}
+	UserDataEncodingNone       = "None"
+	UserDataEncodingBase64     = "Base64"
+	SupportedUserDataEncodings = []string{
+		UserDataEncodingNone,
+		UserDataEncodingBase64,
+	}
+	DeletionModeTerminate  = "Terminate"
+	DeletionModeStop       = "Stop"
+	SupportedDeletionModes = []string{
+		DeletionModeTerminate,
+		DeletionModeStop,
 	}
 	ResourceNVIDIAGPU   v1.ResourceName = "nvidia.com/gpu"
 	ResourceAMDGPU      v1.ResourceName = "amd.com/gpu"
 	ResourceAWSNeuron   v1.ResourceName = "aws.amazon.com/neuron"
 	ResourceHabanaGaudi v1.ResourceName = "habana.ai/gaudi"
 	ResourceAWSPodENI   v1.ResourceName = "vpc.amazonaws.com/pod-eni"
+	ResourceEFA         v1.ResourceName = "vpc.amazonaws.com/efa"
+	// ResourceInstanceStore is the capacity of the local instance store volumes, e.g. the NVMe disks of i3 instances.
+	// It isn't reported by the kubelet, so it must be advertised on the node for pods that request it to schedule.
+	ResourceInstanceStore v1.ResourceName = "karpenter.k8s.aws/instance-store"
 
 	LabelInstanceHypervisor                   = LabelDomain + "/instance-hypervisor"
 	LabelInstanceEncryptionInTransitSupported = LabelDomain + "/instance-encryption-in-transit-supported"
@@ -76,9 +127,42 @@ var (
 	LabelInstanceGPUMemory                    = LabelDomain + "/instance-gpu-memory"
 	LabelInstanceAMIID                        = LabelDomain + "/instance-ami-id"
 
+	AnnotationInstanceState        = LabelDomain + "/instance-state"
+	AnnotationGCProtected          = LabelDomain + "/gc-protected"
+	AnnotationRebalanceRecommended = LabelDomain + "/rebalance-recommended"
+	AnnotationStopped              = LabelDomain + "/stopped"
+	AnnotationGCDrainStarted       = LabelDomain + "/gc-drain-started"
+	AnnotationLaunchConfigHash     = LabelDomain + "/launch-config-hash"
+	AnnotationLaunchTemplateIDs    = LabelDomain + "/launch-template-ids"
+	AnnotationExpired              = LabelDomain + "/expired"
+	AnnotationRetainInstance       = LabelDomain + "/retain-instance"
+
+	TagSubnetWeight = LabelDomain + "/subnet-weight"
+	TagStopped      = LabelDomain + "/stopped"
+	TagVersion      = "karpenter.sh/version"
+	// TagNodeTemplate marks instance profiles that are owned by a node template. Profiles that are also tagged with
+	// karpenter.sh/managed-by for the cluster are deleted once the node template no longer exists.
+	TagNodeTemplate = LabelDomain + "/awsnodetemplate"
+
 	InterruptionInfrastructureFinalizer = Group + "/interruption-infrastructure"
 )
 
+// MachineDrifted is the condition of machines that drifted from their provisioner or node template. Its reason
+// identifies the drift detector that found the machine drifted.
+const MachineDrifted apis.ConditionType = "Drifted"
+
+// DriftReason is the reason of the MachineDrifted condition
+type DriftReason string
+
+const (
+	DriftReasonAMI                  DriftReason = "AMIDrift"
+	DriftReasonSecurityGroup        DriftReason = "SecurityGroupDrift"
+	DriftReasonSubnet               DriftReason = "SubnetDrift"
+	DriftReasonLaunchTemplate       DriftReason = "LaunchTemplateDrift"
+	DriftReasonRebalanceRecommended DriftReason = "RebalanceRecommended"
+	DriftReasonExpired              DriftReason = "Expired"
+)
+
 var (
 	Scheme             = runtime.NewScheme()
 	codec              = serializer.NewCodecFactory(Scheme, serializer.EnableStrict)
@@ -16,15 +16,21 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/Pallinder/go-randomdata"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
 	. "knative.dev/pkg/logging/testing"
 	"knative.dev/pkg/ptr"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -58,5 +64,536 @@ var _ = Describe("Validation", func() {
 			ant.Spec.UserData = ptr.String("someUserData")
 			Expect(ant.Validate(ctx)).To(Not(Succeed()))
 		})
+		It("should succeed with each supported user data mode", func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+			for _, mode := range SupportedUserDataModes {
+				ant.Spec.UserData = ptr.String("someUserData")
+				ant.Spec.UserDataMode = ptr.String(mode)
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should fail with an unsupported user data mode", func() {
+			ant.Spec.UserData = ptr.String("someUserData")
+			ant.Spec.UserDataMode = ptr.String("Append")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should succeed with base64 encoded user data", func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+			ant.Spec.UserData = ptr.String(base64.StdEncoding.EncodeToString([]byte("someUserData")))
+			ant.Spec.UserDataEncoding = ptr.String(UserDataEncodingBase64)
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with user data that isn't base64 encoded when the encoding is Base64", func() {
+			ant.Spec.UserData = ptr.String("#!/bin/bash\necho hello")
+			ant.Spec.UserDataEncoding = ptr.String(UserDataEncodingBase64)
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an unsupported user data encoding", func() {
+			ant.Spec.UserData = ptr.String("someUserData")
+			ant.Spec.UserDataEncoding = ptr.String("gzip")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("AMISelector", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with an ssm parameter path", func() {
+			ant.Spec.AMISelector = map[string]string{"aws::ssm": "/my-org/eks/al2/latest"}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail if the ssm parameter path doesn't start with a '/'", func() {
+			ant.Spec.AMISelector = map[string]string{"aws::ssm": "my-org/eks/al2/latest"}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail if an ssm parameter path is combined with ids", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws::ssm": "/my-org/eks/al2/latest",
+				"aws::ids": "ami-123",
+			}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail if the selector is empty", func() {
+			ant.Spec.AMISelector = map[string]string{}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected at least one selector term: spec.amiSelector"))
+		})
+		It("should fail with an invalid id", func() {
+			ant.Spec.AMISelector = map[string]string{"aws::ids": "ami-123,sg-456"}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("amiSelector['aws::ids'] must be a valid ami-id"))
+		})
+		It("should fail if ids are combined with tags", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws::ids": "ami-123",
+				"team":     "ml",
+			}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected exactly one, got both"))
+			Expect(err.Error()).To(ContainSubstring("spec.amiSelector['aws::ids']"))
+			Expect(err.Error()).To(ContainSubstring("spec.amiSelector['team']"))
+		})
+		It("should fail if legacy ids are combined with a name", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws-ids":   "ami-123",
+				"aws::name": "my-ami",
+			}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected exactly one, got both"))
+			Expect(err.Error()).To(ContainSubstring("spec.amiSelector['aws-ids']"))
+			Expect(err.Error()).To(ContainSubstring("spec.amiSelector['aws::name']"))
+		})
+		It("should fail if both ids and legacy ids are specified", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws::ids": "ami-123",
+				"aws-ids":  "ami-456",
+			}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected exactly one, got both"))
+			Expect(err.Error()).To(ContainSubstring("spec.amiSelector['aws-ids']"))
+		})
+		It("should fail if owners are specified without any other term", func() {
+			ant.Spec.AMISelector = map[string]string{"aws::owners": "self"}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected an id, name or tag selector term alongside owners: spec.amiSelector['aws::owners']"))
+		})
+		It("should succeed with ids and owners", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws::ids":    "ami-123",
+				"aws::owners": "self",
+			}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should succeed with a name, tags and owners", func() {
+			ant.Spec.AMISelector = map[string]string{
+				"aws::name":   "my-ami-*",
+				"team":        "ml",
+				"aws::owners": "self,123456789012",
+			}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail for a custom ami family with an empty selector", func() {
+			ant.Spec.AMIFamily = aws.String(AMIFamilyCustom)
+			ant.Spec.AMISelector = map[string]string{}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("InstanceProfileSelector", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with tags and roles", func() {
+			ant.Spec.InstanceProfileSelector = map[string]string{"team": "ml", "aws::roles": "KarpenterNodeRole"}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail if an instance profile is also specified", func() {
+			ant.Spec.InstanceProfile = aws.String("my-instance-profile")
+			ant.Spec.InstanceProfileSelector = map[string]string{"team": "ml"}
+			err := ant.Validate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected exactly one, got both"))
+			Expect(err.Error()).To(ContainSubstring("spec.instanceProfileSelector"))
+		})
+		It("should fail if the selector is empty", func() {
+			ant.Spec.InstanceProfileSelector = map[string]string{}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with empty keys or values", func() {
+			for key, value := range map[string]string{
+				"":    "value",
+				"key": "",
+			} {
+				ant.Spec.InstanceProfileSelector = map[string]string{key: value}
+				Expect(ant.Validate(ctx)).To(Not(Succeed()))
+			}
+		})
+	})
+	Context("CapacityReservationSelector", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with tags", func() {
+			ant.Spec.CapacityReservationSelector = map[string]string{"team": "ml"}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should succeed with ids", func() {
+			ant.Spec.CapacityReservationSelector = map[string]string{"aws-ids": "cr-0123456789abcdef0,cr-0fedcba9876543210"}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an invalid id", func() {
+			ant.Spec.CapacityReservationSelector = map[string]string{"aws-ids": "cr-0123456789abcdef0,sg-0fedcba9876543210"}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with empty keys or values", func() {
+			for key, value := range map[string]string{
+				"":    "value",
+				"key": "",
+			} {
+				ant.Spec.CapacityReservationSelector = map[string]string{key: value}
+				Expect(ant.Validate(ctx)).To(Not(Succeed()))
+			}
+		})
+	})
+	Context("LaunchTemplate", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with a launch template name or id", func() {
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			Expect(ant.Validate(ctx)).To(Succeed())
+			ant.Spec.LaunchTemplateName = nil
+			ant.Spec.LaunchTemplateID = ptr.String("lt-0123456789abcdef0")
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with both a launch template name and id", func() {
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.LaunchTemplateID = ptr.String("lt-0123456789abcdef0")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with a malformed launch template id", func() {
+			ant.Spec.LaunchTemplateID = ptr.String("my-launch-template")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should succeed with a version number, $Latest or $Default", func() {
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			for _, version := range []string{"1", "42", "$Latest", "$Default"} {
+				ant.Spec.LaunchTemplateVersion = ptr.String(version)
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should fail with an invalid version", func() {
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			for _, version := range []string{"0", "-1", "v1", "latest"} {
+				ant.Spec.LaunchTemplateVersion = ptr.String(version)
+				Expect(ant.Validate(ctx)).To(Not(Succeed()))
+			}
+		})
+		It("should fail with a version but no launch template", func() {
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+			ant.Spec.LaunchTemplateVersion = ptr.String("1")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("Placement", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with each supported strategy", func() {
+			for _, strategy := range SupportedPlacementStrategies {
+				ant.Spec.Placement = &Placement{GroupName: "my-group", Strategy: strategy}
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should fail without a group name", func() {
+			ant.Spec.Placement = &Placement{Strategy: PlacementStrategyCluster}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an unsupported strategy", func() {
+			ant.Spec.Placement = &Placement{GroupName: "my-group", Strategy: "nearby"}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.Placement = &Placement{GroupName: "my-group", Strategy: PlacementStrategyCluster}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("Tenancy", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with default and dedicated tenancy", func() {
+			for _, tenancy := range []string{TenancyDefault, TenancyDedicated} {
+				ant.Spec.Tenancy = ptr.String(tenancy)
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should succeed with host tenancy and a host ID", func() {
+			ant.Spec.Tenancy = ptr.String(TenancyHost)
+			ant.Spec.HostID = ptr.String("h-0123456789abcdef0")
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should succeed with host tenancy and a host resource group", func() {
+			ant.Spec.Tenancy = ptr.String(TenancyHost)
+			ant.Spec.HostResourceGroupARN = ptr.String("arn:aws:resource-groups:us-west-2:123456789012:group/my-hosts")
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an unsupported tenancy", func() {
+			ant.Spec.Tenancy = ptr.String("shared")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with host tenancy without a host ID or host resource group", func() {
+			ant.Spec.Tenancy = ptr.String(TenancyHost)
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with host tenancy and both a host ID and host resource group", func() {
+			ant.Spec.Tenancy = ptr.String(TenancyHost)
+			ant.Spec.HostID = ptr.String("h-0123456789abcdef0")
+			ant.Spec.HostResourceGroupARN = ptr.String("arn:aws:resource-groups:us-west-2:123456789012:group/my-hosts")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with a host ID without host tenancy", func() {
+			ant.Spec.Tenancy = ptr.String(TenancyDedicated)
+			ant.Spec.HostID = ptr.String("h-0123456789abcdef0")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+			ant.Spec.Tenancy = nil
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.Tenancy = ptr.String(TenancyDedicated)
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("PrivateDNSNameOptions", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with each supported hostname type", func() {
+			for _, hostnameType := range SupportedHostnameTypes {
+				ant.Spec.PrivateDNSNameOptions = &PrivateDNSNameOptions{HostnameType: ptr.String(hostnameType)}
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should succeed with only DNS records enabled", func() {
+			ant.Spec.PrivateDNSNameOptions = &PrivateDNSNameOptions{EnableResourceNameDNSARecord: ptr.Bool(true)}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an unsupported hostname type", func() {
+			ant.Spec.PrivateDNSNameOptions = &PrivateDNSNameOptions{HostnameType: ptr.String("instance-name")}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.PrivateDNSNameOptions = &PrivateDNSNameOptions{HostnameType: ptr.String(HostnameTypeResourceName)}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("EFA", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed when enabled", func() {
+			ant.Spec.EFA = ptr.Bool(true)
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.EFA = ptr.Bool(true)
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("NetworkInterfaces", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with secondary network interfaces", func() {
+			ant.Spec.NetworkInterfaces = []NetworkInterface{
+				{DeviceIndex: 1, SubnetID: "subnet-12345"},
+				{DeviceIndex: 2, SubnetID: "subnet-67890", SecurityGroupIDs: []string{"sg-12345"}},
+			}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with the device index of the primary network interface", func() {
+			ant.Spec.NetworkInterfaces = []NetworkInterface{{DeviceIndex: 0, SubnetID: "subnet-12345"}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with duplicate device indexes", func() {
+			ant.Spec.NetworkInterfaces = []NetworkInterface{
+				{DeviceIndex: 1, SubnetID: "subnet-12345"},
+				{DeviceIndex: 1, SubnetID: "subnet-67890"},
+			}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an invalid subnet ID", func() {
+			ant.Spec.NetworkInterfaces = []NetworkInterface{{DeviceIndex: 1, SubnetID: "my-subnet"}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an invalid security group ID", func() {
+			ant.Spec.NetworkInterfaces = []NetworkInterface{{DeviceIndex: 1, SubnetID: "subnet-12345", SecurityGroupIDs: []string{"my-security-group"}}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.NetworkInterfaces = []NetworkInterface{{DeviceIndex: 1, SubnetID: "subnet-12345"}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("MaxPrice", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with a positive price", func() {
+			ant.Spec.MaxPrice = ptr.String("0.50")
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with a price that isn't a number", func() {
+			ant.Spec.MaxPrice = ptr.String("fifty cents")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with a price of zero", func() {
+			ant.Spec.MaxPrice = ptr.String("0")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("DeletionMode", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with each supported deletion mode", func() {
+			for _, mode := range SupportedDeletionModes {
+				ant.Spec.DeletionMode = ptr.String(mode)
+				Expect(ant.Validate(ctx)).To(Succeed())
+			}
+		})
+		It("should fail with an unsupported deletion mode", func() {
+			ant.Spec.DeletionMode = ptr.String("Hibernate")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("StartupTaints", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with valid taints", func() {
+			ant.Spec.StartupTaints = []v1.Taint{
+				{Key: "example.com/agent-not-ready", Effect: v1.TaintEffectNoSchedule},
+				{Key: "example.com/team", Value: "ml", Effect: v1.TaintEffectNoExecute},
+			}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an invalid key", func() {
+			ant.Spec.StartupTaints = []v1.Taint{{Key: "not a key", Effect: v1.TaintEffectNoSchedule}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an invalid value", func() {
+			ant.Spec.StartupTaints = []v1.Taint{{Key: "example.com/team", Value: "not a value", Effect: v1.TaintEffectNoSchedule}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail with an invalid effect", func() {
+			ant.Spec.StartupTaints = []v1.Taint{{Key: "example.com/agent-not-ready", Effect: "NoLaunch"}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.StartupTaints = []v1.Taint{{Key: "example.com/agent-not-ready", Effect: v1.TaintEffectNoSchedule}}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("KeyName", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with a key name", func() {
+			ant.Spec.KeyName = ptr.String("my-key-pair")
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an empty key name", func() {
+			ant.Spec.KeyName = ptr.String("")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+		It("should fail when combined with a launch template", func() {
+			ant.Spec.SecurityGroupSelector = nil
+			ant.Spec.LaunchTemplateName = ptr.String("my-launch-template")
+			ant.Spec.KeyName = ptr.String("my-key-pair")
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("OnDemandBaseCapacity", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with an on-demand base capacity", func() {
+			ant.Spec.OnDemandBaseCapacity = ptr.Int64(3)
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should succeed with an on-demand base capacity of zero", func() {
+			ant.Spec.OnDemandBaseCapacity = ptr.Int64(0)
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with a negative on-demand base capacity", func() {
+			ant.Spec.OnDemandBaseCapacity = ptr.Int64(-1)
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+	Context("Tags", func() {
+		BeforeEach(func() {
+			ant.Spec.SubnetSelector = map[string]string{"foo": "bar"}
+			ant.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+		})
+		It("should succeed with supported tag templates", func() {
+			ant.Spec.Tags = map[string]string{
+				"machine":     TagTemplateMachineName,
+				"provisioner": TagTemplateProvisionerName,
+				"node":        fmt.Sprintf("team-a/%s", TagTemplateNodeName),
+			}
+			Expect(ant.Validate(ctx)).To(Succeed())
+		})
+		It("should fail with an unsupported tag template", func() {
+			ant.Spec.Tags = map[string]string{"pod": "${pod.name}"}
+			Expect(ant.Validate(ctx)).To(Not(Succeed()))
+		})
+	})
+})
+
+var _ = Describe("Tag Templates", func() {
+	It("should resolve template variables in tag values", func() {
+		resolved, unresolved := ResolveTagTemplates([]*ec2.Tag{
+			{Key: aws.String("static"), Value: aws.String("value")},
+			{Key: aws.String("owner"), Value: aws.String(fmt.Sprintf("%s/%s", TagTemplateProvisionerName, TagTemplateMachineName))},
+		}, map[string]string{TagTemplateMachineName: "default-abcde", TagTemplateProvisionerName: "default"})
+		Expect(unresolved).To(BeEmpty())
+		Expect(lo.SliceToMap(resolved, func(t *ec2.Tag) (string, string) { return *t.Key, *t.Value })).To(Equal(map[string]string{
+			"static": "value",
+			"owner":  "default/default-abcde",
+		}))
+	})
+	It("should return tags that reference a variable without a value as unresolved", func() {
+		resolved, unresolved := ResolveTagTemplates([]*ec2.Tag{
+			{Key: aws.String("node"), Value: aws.String(TagTemplateNodeName)},
+		}, map[string]string{TagTemplateMachineName: "default-abcde"})
+		Expect(resolved).To(BeEmpty())
+		Expect(unresolved).To(HaveLen(1))
+		Expect(*unresolved[0].Value).To(Equal(TagTemplateNodeName))
+	})
+	It("should sanitize substituted values that EC2 doesn't allow in tags", func() {
+		resolved, _ := ResolveTagTemplates([]*ec2.Tag{
+			{Key: aws.String("machine"), Value: aws.String(TagTemplateMachineName)},
+		}, map[string]string{TagTemplateMachineName: "bad*name?"})
+		Expect(*resolved[0].Value).To(Equal("bad_name_"))
+	})
+	It("should truncate resolved values to the maximum tag value length", func() {
+		resolved, _ := ResolveTagTemplates([]*ec2.Tag{
+			{Key: aws.String("machine"), Value: aws.String("prefix-" + TagTemplateMachineName)},
+		}, map[string]string{TagTemplateMachineName: strings.Repeat("a", 300)})
+		Expect(*resolved[0].Value).To(HaveLen(256))
+		Expect(*resolved[0].Value).To(HavePrefix("prefix-aaa"))
 	})
 })
@@ -17,6 +17,8 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -40,3 +42,48 @@ func MergeTags(ctx context.Context, custom ...map[string]string) (result []*ec2.
 	}
 	return result
 }
+
+const (
+	TagTemplateMachineName     = "${machine.name}"
+	TagTemplateProvisionerName = "${provisioner.name}"
+	TagTemplateNodeName        = "${node.name}"
+
+	// maxTagValueLength is the maximum length of an EC2 tag value
+	maxTagValueLength = 256
+)
+
+var (
+	SupportedTagTemplates = []string{TagTemplateMachineName, TagTemplateProvisionerName, TagTemplateNodeName}
+
+	tagTemplateRegex = regexp.MustCompile(`\$\{[^}]*\}`)
+	// invalidTagValueCharacters matches the characters that EC2 doesn't allow in tag values
+	invalidTagValueCharacters = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+)
+
+// HasTagTemplate returns true if the tag value references any of the template variables
+func HasTagTemplate(value string, templates ...string) bool {
+	if len(templates) == 0 {
+		return tagTemplateRegex.MatchString(value)
+	}
+	return lo.SomeBy(templates, func(t string) bool { return strings.Contains(value, t) })
+}
+
+// ResolveTagTemplates substitutes template variables in tag values. Substituted values are sanitized so that the
+// resolved tag is accepted by EC2. Tags that reference a variable without a value are returned as unresolved.
+func ResolveTagTemplates(tags []*ec2.Tag, values map[string]string) (resolved []*ec2.Tag, unresolved []*ec2.Tag) {
+	for _, tag := range tags {
+		value := aws.StringValue(tag.Value)
+		if lo.SomeBy(tagTemplateRegex.FindAllString(value, -1), func(t string) bool { _, ok := values[t]; return !ok }) {
+			unresolved = append(unresolved, tag)
+			continue
+		}
+		value = tagTemplateRegex.ReplaceAllStringFunc(value, func(t string) string {
+			return invalidTagValueCharacters.ReplaceAllString(values[t], "_")
+		})
+		if runes := []rune(value); len(runes) > maxTagValueLength {
+			value = string(runes[:maxTagValueLength])
+		}
+		resolved = append(resolved, &ec2.Tag{Key: tag.Key, Value: aws.String(value)})
+	}
+	return resolved, unresolved
+}
@@ -20,6 +20,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -151,6 +152,16 @@ func (in *AWSNodeTemplateSpec) DeepCopyInto(out *AWSNodeTemplateSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.UserDataMode != nil {
+		in, out := &in.UserDataMode, &out.UserDataMode
+		*out = new(string)
+		**out = **in
+	}
+	if in.UserDataEncoding != nil {
+		in, out := &in.UserDataEncoding, &out.UserDataEncoding
+		*out = new(string)
+		**out = **in
+	}
 	in.AWS.DeepCopyInto(&out.AWS)
 	if in.AMISelector != nil {
 		in, out := &in.AMISelector, &out.AMISelector
@@ -159,11 +170,89 @@ func (in *AWSNodeTemplateSpec) DeepCopyInto(out *AWSNodeTemplateSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.InstanceProfileSelector != nil {
+		in, out := &in.InstanceProfileSelector, &out.InstanceProfileSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.DetailedMonitoring != nil {
 		in, out := &in.DetailedMonitoring, &out.DetailedMonitoring
 		*out = new(bool)
 		**out = **in
 	}
+	if in.KeyName != nil {
+		in, out := &in.KeyName, &out.KeyName
+		*out = new(string)
+		**out = **in
+	}
+	if in.CapacityReservationSelector != nil {
+		in, out := &in.CapacityReservationSelector, &out.CapacityReservationSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(Placement)
+		**out = **in
+	}
+	if in.Tenancy != nil {
+		in, out := &in.Tenancy, &out.Tenancy
+		*out = new(string)
+		**out = **in
+	}
+	if in.HostID != nil {
+		in, out := &in.HostID, &out.HostID
+		*out = new(string)
+		**out = **in
+	}
+	if in.HostResourceGroupARN != nil {
+		in, out := &in.HostResourceGroupARN, &out.HostResourceGroupARN
+		*out = new(string)
+		**out = **in
+	}
+	if in.PrivateDNSNameOptions != nil {
+		in, out := &in.PrivateDNSNameOptions, &out.PrivateDNSNameOptions
+		*out = new(PrivateDNSNameOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EFA != nil {
+		in, out := &in.EFA, &out.EFA
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NetworkInterfaces != nil {
+		in, out := &in.NetworkInterfaces, &out.NetworkInterfaces
+		*out = make([]NetworkInterface, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MaxPrice != nil {
+		in, out := &in.MaxPrice, &out.MaxPrice
+		*out = new(string)
+		**out = **in
+	}
+	if in.OnDemandBaseCapacity != nil {
+		in, out := &in.OnDemandBaseCapacity, &out.OnDemandBaseCapacity
+		*out = new(int64)
+		**out = **in
+	}
+	if in.DeletionMode != nil {
+		in, out := &in.DeletionMode, &out.DeletionMode
+		*out = new(string)
+		**out = **in
+	}
+	if in.StartupTaints != nil {
+		in, out := &in.StartupTaints, &out.StartupTaints
+		*out = make([]v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSNodeTemplateSpec.
@@ -289,6 +378,16 @@ func (in *LaunchTemplate) DeepCopyInto(out *LaunchTemplate) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.LaunchTemplateID != nil {
+		in, out := &in.LaunchTemplateID, &out.LaunchTemplateID
+		*out = new(string)
+		**out = **in
+	}
+	if in.LaunchTemplateVersion != nil {
+		in, out := &in.LaunchTemplateVersion, &out.LaunchTemplateVersion
+		*out = new(string)
+		**out = **in
+	}
 	if in.MetadataOptions != nil {
 		in, out := &in.MetadataOptions, &out.MetadataOptions
 		*out = new(MetadataOptions)
@@ -305,6 +404,16 @@ func (in *LaunchTemplate) DeepCopyInto(out *LaunchTemplate) {
 			}
 		}
 	}
+	if in.EncryptedByDefault != nil {
+		in, out := &in.EncryptedByDefault, &out.EncryptedByDefault
+		*out = new(bool)
+		**out = **in
+	}
+	if in.KMSKeyID != nil {
+		in, out := &in.KMSKeyID, &out.KMSKeyID
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LaunchTemplate.
@@ -340,6 +449,11 @@ func (in *MetadataOptions) DeepCopyInto(out *MetadataOptions) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.InstanceMetadataTags != nil {
+		in, out := &in.InstanceMetadataTags, &out.InstanceMetadataTags
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataOptions.
@@ -352,6 +466,71 @@ func (in *MetadataOptions) DeepCopy() *MetadataOptions {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkInterface) DeepCopyInto(out *NetworkInterface) {
+	*out = *in
+	if in.SecurityGroupIDs != nil {
+		in, out := &in.SecurityGroupIDs, &out.SecurityGroupIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkInterface.
+func (in *NetworkInterface) DeepCopy() *NetworkInterface {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkInterface)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Placement) DeepCopyInto(out *Placement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Placement.
+func (in *Placement) DeepCopy() *Placement {
+	if in == nil {
+		return nil
+	}
+	out := new(Placement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrivateDNSNameOptions) DeepCopyInto(out *PrivateDNSNameOptions) {
+	*out = *in
+	if in.HostnameType != nil {
+		in, out := &in.HostnameType, &out.HostnameType
+		*out = new(string)
+		**out = **in
+	}
+	if in.EnableResourceNameDNSARecord != nil {
+		in, out := &in.EnableResourceNameDNSARecord, &out.EnableResourceNameDNSARecord
+		*out = new(bool)
+		**out = **in
+	}
+	if in.EnableResourceNameDNSAAAARecord != nil {
+		in, out := &in.EnableResourceNameDNSAAAARecord, &out.EnableResourceNameDNSAAAARecord
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrivateDNSNameOptions.
+func (in *PrivateDNSNameOptions) DeepCopy() *PrivateDNSNameOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PrivateDNSNameOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityGroupStatus) DeepCopyInto(out *SecurityGroupStatus) {
 	*out = *in
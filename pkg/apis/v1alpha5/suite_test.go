@@ -169,6 +169,12 @@ var _ = Describe("Provisioner", func() {
 					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
 				}
 			})
+			It("should not allow an invalid vpc id", func() {
+				provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+				Expect(err).ToNot(HaveOccurred())
+				provider.SecurityGroupSelector = map[string]string{"Name": "nodes", "aws-vpc-id": "my-vpc"}
+				Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+			})
 		})
 
 		Context("Labels", func() {
@@ -307,6 +313,27 @@ var _ = Describe("Provisioner", func() {
 					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
 				})
 			})
+			Context("InstanceMetadataTags", func() {
+				It("should allow enum values", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					for _, value := range ec2.LaunchTemplateInstanceMetadataTagsState_Values() {
+						provider.MetadataOptions = &v1alpha1.MetadataOptions{
+							InstanceMetadataTags: aws.String(value),
+						}
+						provisioner = test.Provisioner(test.ProvisionerOptions{Provider: provider})
+						Expect(provisioner.Validate(ctx)).To(Succeed())
+					}
+				})
+				It("should not allow non-enum values", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.MetadataOptions = &v1alpha1.MetadataOptions{
+						InstanceMetadataTags: aws.String(randomdata.SillyName()),
+					}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+			})
 			Context("BlockDeviceMappings", func() {
 				It("should not allow with a custom launch template", func() {
 					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
@@ -392,6 +419,127 @@ var _ = Describe("Provisioner", func() {
 					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
 				})
 			})
+			Context("Throughput and IOPS", func() {
+				It("should not allow throughput for non-gp3 volumes", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeIo2),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							Throughput: aws.Int64(250),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow throughput without a volume type", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							Throughput: aws.Int64(250),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow throughput below the minimum", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeGp3),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							Throughput: aws.Int64(100),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow throughput above the maximum", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeGp3),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							Throughput: aws.Int64(1001),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow iops for volume types that don't support it", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeGp2),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							IOPS:       aws.Int64(3000),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow gp3 iops outside of the gp3 range", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeGp3),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							IOPS:       aws.Int64(20000),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow io2 iops outside of the io2 range", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{{
+						DeviceName: aws.String("/dev/xvda"),
+						EBS: &v1alpha1.BlockDevice{
+							VolumeType: aws.String(ec2.VolumeTypeIo2),
+							VolumeSize: resource.NewScaledQuantity(100, resource.Giga),
+							IOPS:       aws.Int64(50),
+						},
+					}}
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+			})
+			Context("EncryptedByDefault", func() {
+				It("should not allow with a custom launch template", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.LaunchTemplateName = aws.String("my-lt")
+					provider.EncryptedByDefault = aws.Bool(true)
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow kmsKeyID with a custom launch template", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.LaunchTemplateName = aws.String("my-lt")
+					provider.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow kmsKeyID without encryptedByDefault", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+				It("should not allow kmsKeyID when encryptedByDefault is false", func() {
+					provider, err := v1alpha1.DeserializeProvider(provisioner.Spec.Provider.Raw)
+					Expect(err).ToNot(HaveOccurred())
+					provider.EncryptedByDefault = aws.Bool(false)
+					provider.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+					Expect(Validate(ctx, test.Provisioner(test.ProvisionerOptions{Provider: provider}))).ToNot(Succeed())
+				})
+			})
 		})
 	})
 })
@@ -25,10 +25,13 @@ const (
 	// DO NOT CHANGE THIS VALUE WITHOUT DUE CONSIDERATION
 	DefaultTTL = time.Minute
 	// UnavailableOfferingsTTL is the time before offerings that were marked as unavailable
-	// are removed from the cache and are available for launch again
+	// are removed from the cache and are available for launch again, if the aws.unavailableOfferingsTTL
+	// setting doesn't specify one
 	UnavailableOfferingsTTL = 3 * time.Minute
 	// InstanceTypesAndZonesTTL is the time before we refresh instance types and zones at EC2
 	InstanceTypesAndZonesTTL = 5 * time.Minute
+	// ZonePlacementTTL is the time that launches are remembered for when balancing launches across zones
+	ZonePlacementTTL = 5 * time.Minute
 )
 
 const (
@@ -17,27 +17,37 @@ package cache
 import (
 	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/patrickmn/go-cache"
 	"knative.dev/pkg/logging"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
 )
 
 // UnavailableOfferings stores any offerings that return ICE (insufficient capacity errors) when
 // attempting to launch the capacity. These offerings are ignored as long as they are in the cache on
-// GetInstanceTypes responses
+// GetInstanceTypes responses and when building launch requests. Entries expire after the
+// aws.unavailableOfferingsTTL setting. It also counts consecutive spot launches that failed with an
+// insufficient capacity error, so that launches can fall back to on-demand.
 type UnavailableOfferings struct {
 	// key: <capacityType>:<instanceType>:<zone>, value: struct{}{}
 	cache  *cache.Cache
 	SeqNum uint64
+
+	// key: <requirementsKey>, value: int64
+	spotFailuresMu sync.Mutex
+	spotFailures   *cache.Cache
 }
 
 func NewUnavailableOfferings() *UnavailableOfferings {
 	return &UnavailableOfferings{
-		cache:  cache.New(UnavailableOfferingsTTL, DefaultCleanupInterval),
-		SeqNum: 0,
+		cache:        cache.New(UnavailableOfferingsTTL, DefaultCleanupInterval),
+		SeqNum:       0,
+		spotFailures: cache.New(UnavailableOfferingsTTL, DefaultCleanupInterval),
 	}
 }
 
@@ -49,14 +59,15 @@ func (u *UnavailableOfferings) IsUnavailable(instanceType, zone, capacityType st
 
 // MarkUnavailable communicates recently observed temporary capacity shortages in the provided offerings
 func (u *UnavailableOfferings) MarkUnavailable(ctx context.Context, unavailableReason, instanceType, zone, capacityType string) {
+	ttl := settings.FromContext(ctx).UnavailableOfferingsTTL
 	// even if the key is already in the cache, we still need to call Set to extend the cached entry's TTL
 	logging.FromContext(ctx).With(
 		"reason", unavailableReason,
 		"instance-type", instanceType,
 		"zone", zone,
 		"capacity-type", capacityType,
-		"ttl", UnavailableOfferingsTTL).Debugf("removing offering from offerings")
-	u.cache.SetDefault(u.key(instanceType, zone, capacityType), struct{}{})
+		"ttl", ttl).Debugf("removing offering from offerings")
+	u.cache.Set(u.key(instanceType, zone, capacityType), struct{}{}, ttl)
 	atomic.AddUint64(&u.SeqNum, 1)
 }
 
@@ -70,8 +81,34 @@ func (u *UnavailableOfferings) Delete(instanceType string, zone string, capacity
 	u.cache.Delete(u.key(instanceType, zone, capacityType))
 }
 
+// MarkSpotFailure records that a spot launch for a set of requirements failed with an insufficient capacity error and
+// returns the number of consecutive failures. The count expires after the aws.unavailableOfferingsTTL setting.
+func (u *UnavailableOfferings) MarkSpotFailure(ctx context.Context, requirementsKey string) int64 {
+	u.spotFailuresMu.Lock()
+	defer u.spotFailuresMu.Unlock()
+	failures := u.SpotFailures(requirementsKey) + 1
+	u.spotFailures.Set(requirementsKey, failures, settings.FromContext(ctx).UnavailableOfferingsTTL)
+	return failures
+}
+
+// SpotFailures returns the number of consecutive spot launches for a set of requirements that failed with an
+// insufficient capacity error
+func (u *UnavailableOfferings) SpotFailures(requirementsKey string) int64 {
+	failures, ok := u.spotFailures.Get(requirementsKey)
+	if !ok {
+		return 0
+	}
+	return failures.(int64)
+}
+
+// ResetSpotFailures forgets the spot failures for a set of requirements once a spot launch for them succeeds
+func (u *UnavailableOfferings) ResetSpotFailures(requirementsKey string) {
+	u.spotFailures.Delete(requirementsKey)
+}
+
 func (u *UnavailableOfferings) Flush() {
 	u.cache.Flush()
+	u.spotFailures.Flush()
 }
 
 // key returns the cache key for all offerings in the cache
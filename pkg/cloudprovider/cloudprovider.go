@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/aws/karpenter-core/pkg/utils/functional"
 	"github.com/aws/karpenter/pkg/apis"
@@ -45,6 +46,9 @@ import (
 	"github.com/aws/karpenter/pkg/providers/amifamily"
 	"github.com/aws/karpenter/pkg/providers/instance"
 	"github.com/aws/karpenter/pkg/providers/instancetype"
+	"github.com/aws/karpenter/pkg/providers/launchtemplate"
+	"github.com/aws/karpenter/pkg/providers/securitygroup"
+	"github.com/aws/karpenter/pkg/providers/subnet"
 
 	coreapis "github.com/aws/karpenter-core/pkg/apis"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
@@ -59,19 +63,26 @@ func init() {
 var _ cloudprovider.CloudProvider = (*CloudProvider)(nil)
 
 type CloudProvider struct {
-	instanceTypeProvider *instancetype.Provider
-	instanceProvider     *instance.Provider
-	kubeClient           client.Client
-	amiProvider          *amifamily.Provider
+	instanceTypeProvider   *instancetype.Provider
+	instanceProvider       *instance.Provider
+	kubeClient             client.Client
+	amiProvider            *amifamily.Provider
+	launchTemplateProvider *launchtemplate.Provider
+	subnetProvider         *subnet.Provider
+	securityGroupProvider  *securitygroup.Provider
 }
 
-func New(ctx context.Context, instanceTypeProvider *instancetype.Provider,
-	instanceProvider *instance.Provider, kubeClient client.Client, amiProvider *amifamily.Provider) *CloudProvider {
+func New(ctx context.Context, instanceTypeProvider *instancetype.Provider, instanceProvider *instance.Provider,
+	kubeClient client.Client, amiProvider *amifamily.Provider, launchTemplateProvider *launchtemplate.Provider,
+	subnetProvider *subnet.Provider, securityGroupProvider *securitygroup.Provider) *CloudProvider {
 	return &CloudProvider{
-		instanceTypeProvider: instanceTypeProvider,
-		instanceProvider:     instanceProvider,
-		kubeClient:           kubeClient,
-		amiProvider:          amiProvider,
+		instanceTypeProvider:   instanceTypeProvider,
+		instanceProvider:       instanceProvider,
+		kubeClient:             kubeClient,
+		amiProvider:            amiProvider,
+		launchTemplateProvider: launchTemplateProvider,
+		subnetProvider:         subnetProvider,
+		securityGroupProvider:  securityGroupProvider,
 	}
 }
 
@@ -85,10 +96,20 @@ func (c *CloudProvider) Create(ctx context.Context, machine *v1alpha5.Machine) (
 	}
 	instanceTypes, err := c.resolveInstanceTypes(ctx, machine)
 	if err != nil {
+		// Instance types that were only eliminated because their offerings are unavailable may become available again,
+		// while requirements that exclude every instance type need to be fixed on the provisioner
+		if instancetype.IsUnavailableOfferingsError(err) {
+			return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("all requested instance types were unavailable during launch, %w", err))
+		}
 		return nil, fmt.Errorf("resolving instance types, %w", err)
 	}
-	if len(instanceTypes) == 0 {
-		return nil, cloudprovider.NewInsufficientCapacityError(fmt.Errorf("all requested instance types were unavailable during launch"))
+	machine, err = c.withOnDemandBase(ctx, nodeTemplate, machine, instanceTypes)
+	if err != nil {
+		return nil, err
+	}
+	configHash, err := c.launchTemplateProvider.ConfigHash(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("hashing launch configuration, %w", err)
 	}
 	instance, err := c.instanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
 	if err != nil {
@@ -97,7 +118,79 @@ func (c *CloudProvider) Create(ctx context.Context, machine *v1alpha5.Machine) (
 	instanceType, _ := lo.Find(instanceTypes, func(i *cloudprovider.InstanceType) bool {
 		return i.Name == aws.StringValue(instance.InstanceType)
 	})
-	return c.instanceToMachine(ctx, instance, instanceType), nil
+	created := c.instanceToMachine(ctx, instance, instanceType)
+	// Record the launch configuration so that changes to the node template are detected as drift
+	if configHash != "" {
+		created.Annotations[v1alpha1.AnnotationLaunchConfigHash] = configHash
+	}
+	if ids, ok := machine.Annotations[v1alpha1.AnnotationLaunchTemplateIDs]; ok {
+		created.Annotations[v1alpha1.AnnotationLaunchTemplateIDs] = ids
+	}
+	return created, nil
+}
+
+// withOnDemandBase returns a copy of the machine that requires on-demand capacity while its provisioner has fewer
+// on-demand machines than the on-demand base capacity of the node template. Machines that don't allow both spot and
+// on-demand, or that have no on-demand offering, are returned unchanged.
+func (c *CloudProvider) withOnDemandBase(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine,
+	instanceTypes []*cloudprovider.InstanceType) (*v1alpha5.Machine, error) {
+	base := lo.FromPtr(nodeTemplate.Spec.OnDemandBaseCapacity)
+	if base == 0 {
+		return machine, nil
+	}
+	capacityTypes := scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...).Get(v1alpha5.LabelCapacityType)
+	if !capacityTypes.Has(v1alpha5.CapacityTypeSpot) || !capacityTypes.Has(v1alpha5.CapacityTypeOnDemand) {
+		return machine, nil
+	}
+	onDemandRequirements := append(lo.Reject(machine.Spec.Requirements, func(r v1.NodeSelectorRequirement, _ int) bool {
+		return r.Key == v1alpha5.LabelCapacityType
+	}), v1.NodeSelectorRequirement{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeOnDemand}})
+	if !lo.ContainsBy(instanceTypes, func(it *cloudprovider.InstanceType) bool {
+		return len(it.Offerings.Available().Requirements(scheduling.NewNodeSelectorRequirements(onDemandRequirements...))) > 0
+	}) {
+		return machine, nil
+	}
+	onDemand, err := c.onDemandCount(ctx, machine.Labels[v1alpha5.ProvisionerNameLabelKey])
+	if err != nil {
+		return nil, err
+	}
+	if int64(onDemand) >= base {
+		return machine, nil
+	}
+	logging.FromContext(ctx).With("on-demand", onDemand, "on-demand-base", base).Debugf("launching on-demand to satisfy the on-demand base capacity")
+	machine = machine.DeepCopy()
+	machine.Spec.Requirements = onDemandRequirements
+	return machine, nil
+}
+
+// onDemandCount returns the number of on-demand machines and nodes of the provisioner that aren't being deleted, since
+// they won't count toward the base for long. Machines are counted as soon as they're launched, before their nodes
+// register, so that machines launched back-to-back see each other. A machine and its node are counted once.
+func (c *CloudProvider) onDemandCount(ctx context.Context, provisionerName string) (int, error) {
+	labels := client.MatchingLabels{
+		v1alpha5.ProvisionerNameLabelKey: provisionerName,
+		v1alpha5.LabelCapacityType:       v1alpha5.CapacityTypeOnDemand,
+	}
+	machineList := &v1alpha5.MachineList{}
+	if err := c.kubeClient.List(ctx, machineList, labels); err != nil {
+		return 0, fmt.Errorf("listing on-demand machines, %w", err)
+	}
+	nodeList := &v1.NodeList{}
+	if err := c.kubeClient.List(ctx, nodeList, labels); err != nil {
+		return 0, fmt.Errorf("listing on-demand nodes, %w", err)
+	}
+	onDemand := sets.NewString()
+	for i := range machineList.Items {
+		if m := &machineList.Items[i]; m.DeletionTimestamp.IsZero() {
+			onDemand.Insert(lo.Ternary(m.Status.ProviderID != "", utils.NormalizeProviderID(m.Status.ProviderID), m.Name))
+		}
+	}
+	for i := range nodeList.Items {
+		if n := &nodeList.Items[i]; n.DeletionTimestamp.IsZero() {
+			onDemand.Insert(lo.Ternary(n.Spec.ProviderID != "", utils.NormalizeProviderID(n.Spec.ProviderID), n.Name))
+		}
+	}
+	return onDemand.Len(), nil
 }
 
 // Link adds a tag to the cloudprovider machine to tell the cloudprovider that it's now owned by a Machine
@@ -112,10 +205,31 @@ func (c *CloudProvider) Link(ctx context.Context, machine *v1alpha5.Machine) err
 }
 
 func (c *CloudProvider) List(ctx context.Context) ([]*v1alpha5.Machine, error) {
-	instances, err := c.instanceProvider.List(ctx)
+	var zones []string
+	if settings.FromContext(ctx).EnableZonalInstanceListing {
+		var err error
+		if zones, err = c.instanceProvider.Zones(ctx); err != nil {
+			return nil, fmt.Errorf("listing zones, %w", err)
+		}
+	}
+	// Machines are built from a few fields of their instances, so the rest aren't retained while every machine is held
+	instances, err := c.instanceProvider.ListTrimmed(ctx, zones...)
 	if err != nil {
 		return nil, fmt.Errorf("listing instances, %w", err)
 	}
+	return c.instancesToMachines(ctx, instances)
+}
+
+// ListByProvisioner returns the machines for the instances launched for the provisioner
+func (c *CloudProvider) ListByProvisioner(ctx context.Context, provisionerName string) ([]*v1alpha5.Machine, error) {
+	instances, err := c.instanceProvider.ListByProvisioner(ctx, provisionerName)
+	if err != nil {
+		return nil, fmt.Errorf("listing instances, %w", err)
+	}
+	return c.instancesToMachines(ctx, instances)
+}
+
+func (c *CloudProvider) instancesToMachines(ctx context.Context, instances []*ec2.Instance) ([]*v1alpha5.Machine, error) {
 	var machines []*v1alpha5.Machine
 	for _, instance := range instances {
 		instanceType, err := c.resolveInstanceTypeFromInstance(ctx, instance)
@@ -166,6 +280,12 @@ func (c *CloudProvider) GetInstanceTypes(ctx context.Context, provisioner *v1alp
 	if err != nil {
 		return nil, err
 	}
+	// Only offer instance types that have an AMI of their architecture so that the scheduler doesn't pick an instance
+	// type that can't be launched
+	instanceTypes, err = c.amiProvider.CompatibleInstanceTypes(ctx, nodeTemplate, instanceTypes)
+	if err != nil {
+		return nil, fmt.Errorf("filtering instance types by ami compatibility, %w", err)
+	}
 	return instanceTypes, nil
 }
 
@@ -176,27 +296,51 @@ func (c *CloudProvider) Delete(ctx context.Context, machine *v1alpha5.Machine) e
 		return fmt.Errorf("getting instance ID, %w", err)
 	}
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("id", id))
+	// The instance of a machine that's annotated to retain it is kept running for investigation, detached from Karpenter
+	if _, ok := machine.Annotations[v1alpha1.AnnotationRetainInstance]; ok {
+		return c.instanceProvider.Detach(ctx, id)
+	}
+	if c.deletionMode(ctx, machine) == v1alpha1.DeletionModeStop {
+		return c.instanceProvider.Stop(ctx, id)
+	}
 	return c.instanceProvider.Delete(ctx, id)
 }
 
-func (c *CloudProvider) IsMachineDrifted(ctx context.Context, machine *v1alpha5.Machine) (bool, error) {
-	// Not needed when GetInstanceTypes removes provisioner dependency
+// deletionMode returns the deletion mode of the machine's node template. Machines are terminated when their node
+// template can't be resolved.
+func (c *CloudProvider) deletionMode(ctx context.Context, machine *v1alpha5.Machine) string {
 	provisioner := &v1alpha5.Provisioner{}
 	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: machine.Labels[v1alpha5.ProvisionerNameLabelKey]}, provisioner); err != nil {
-		return false, client.IgnoreNotFound(fmt.Errorf("getting provisioner, %w", err))
+		return v1alpha1.DeletionModeTerminate
 	}
 	if provisioner.Spec.ProviderRef == nil {
-		return false, nil
+		return v1alpha1.DeletionModeTerminate
 	}
 	nodeTemplate, err := c.resolveNodeTemplate(ctx, nil, provisioner.Spec.ProviderRef)
 	if err != nil {
-		return false, client.IgnoreNotFound(fmt.Errorf("resolving node template, %w", err))
+		return v1alpha1.DeletionModeTerminate
 	}
-	amiDrifted, err := c.isAMIDrifted(ctx, machine, provisioner, nodeTemplate)
-	if err != nil {
-		return false, err
+	return lo.FromPtrOr(nodeTemplate.Spec.DeletionMode, v1alpha1.DeletionModeTerminate)
+}
+
+// DeleteBatch deletes the passed machines in as few cloudprovider calls as possible. It returns the machines that
+// were deleted along with a combined error for the machines that failed to delete.
+func (c *CloudProvider) DeleteBatch(ctx context.Context, machines []*v1alpha5.Machine) ([]*v1alpha5.Machine, error) {
+	machinesByID := map[string]*v1alpha5.Machine{}
+	for _, machine := range machines {
+		id, err := utils.ParseInstanceID(machine.Status.ProviderID)
+		if err != nil {
+			return nil, fmt.Errorf("getting instance ID, %w", err)
+		}
+		machinesByID[id] = machine
 	}
-	return amiDrifted, nil
+	deleted, err := c.instanceProvider.DeleteBatch(ctx, lo.Keys(machinesByID))
+	return lo.Map(deleted, func(id string, _ int) *v1alpha5.Machine { return machinesByID[id] }), err
+}
+
+func (c *CloudProvider) IsMachineDrifted(ctx context.Context, machine *v1alpha5.Machine) (bool, error) {
+	drift, err := c.Drift(ctx, machine)
+	return drift != nil, err
 }
 
 // Name returns the CloudProvider implementation name.
@@ -204,37 +348,6 @@ func (c *CloudProvider) Name() string {
 	return "aws"
 }
 
-func (c *CloudProvider) isAMIDrifted(ctx context.Context, machine *v1alpha5.Machine, provisioner *v1alpha5.Provisioner, nodeTemplate *v1alpha1.AWSNodeTemplate) (bool, error) {
-	instanceTypes, err := c.GetInstanceTypes(ctx, provisioner)
-	if err != nil {
-		return false, fmt.Errorf("getting instanceTypes, %w", err)
-	}
-	nodeInstanceType, found := lo.Find(instanceTypes, func(instType *cloudprovider.InstanceType) bool {
-		return instType.Name == machine.Labels[v1.LabelInstanceTypeStable]
-	})
-	if !found {
-		return false, fmt.Errorf(`finding node instance type "%s"`, machine.Labels[v1.LabelInstanceTypeStable])
-	}
-	if nodeTemplate.Spec.LaunchTemplateName != nil {
-		return false, nil
-	}
-	amis, err := c.amiProvider.Get(ctx, nodeTemplate, []*cloudprovider.InstanceType{nodeInstanceType},
-		amifamily.GetAMIFamily(nodeTemplate.Spec.AMIFamily, &amifamily.Options{}))
-	if err != nil {
-		return false, fmt.Errorf("getting amis, %w", err)
-	}
-	// Get InstanceID to fetch from EC2
-	instanceID, err := utils.ParseInstanceID(machine.Status.ProviderID)
-	if err != nil {
-		return false, err
-	}
-	instance, err := c.instanceProvider.Get(ctx, instanceID)
-	if err != nil {
-		return false, fmt.Errorf("getting instance, %w", err)
-	}
-	return !lo.Contains(lo.Keys(amis), *instance.ImageId), nil
-}
-
 func (c *CloudProvider) resolveNodeTemplate(ctx context.Context, raw []byte, objRef *v1alpha5.ProviderRef) (*v1alpha1.AWSNodeTemplate, error) {
 	nodeTemplate := &v1alpha1.AWSNodeTemplate{}
 	if objRef != nil {
@@ -264,12 +377,7 @@ func (c *CloudProvider) resolveInstanceTypes(ctx context.Context, machine *v1alp
 	if err != nil {
 		return nil, fmt.Errorf("getting instance types, %w", err)
 	}
-	reqs := scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...)
-	return lo.Filter(instanceTypes, func(i *cloudprovider.InstanceType, _ int) bool {
-		return reqs.Compatible(i.Requirements) == nil &&
-			len(i.Offerings.Requirements(reqs).Available()) > 0 &&
-			resources.Fits(machine.Spec.Resources.Requests, i.Allocatable())
-	}), nil
+	return instancetype.Compatible(instanceTypes, scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...), machine.Spec.Resources.Requests)
 }
 
 func (c *CloudProvider) resolveInstanceTypeFromInstance(ctx context.Context, instance *ec2.Instance) (*cloudprovider.InstanceType, error) {
@@ -331,7 +439,18 @@ func (c *CloudProvider) instanceToMachine(ctx context.Context, ec2instance *ec2.
 		strings.ToLower(aws.StringValue(ec2instance.PrivateDnsName)),
 	)
 	machine.Labels = labels
+	machine.Annotations = map[string]string{
+		v1alpha1.AnnotationInstanceState: aws.StringValue(ec2instance.State.Name),
+	}
+	if key := settings.FromContext(ctx).GCProtectionTagKey; key != "" {
+		if _, ok := lo.Find(ec2instance.Tags, func(t *ec2.Tag) bool { return aws.StringValue(t.Key) == key }); ok {
+			machine.Annotations[v1alpha1.AnnotationGCProtected] = "true"
+		}
+	}
+	if _, ok := lo.Find(ec2instance.Tags, func(t *ec2.Tag) bool { return aws.StringValue(t.Key) == v1alpha1.TagStopped }); ok {
+		machine.Annotations[v1alpha1.AnnotationStopped] = "true"
+	}
 	machine.CreationTimestamp = metav1.Time{Time: aws.TimeValue(ec2instance.LaunchTime)}
-	machine.Status.ProviderID = fmt.Sprintf("aws:///%s/%s", aws.StringValue(ec2instance.Placement.AvailabilityZone), aws.StringValue(ec2instance.InstanceId))
+	machine.Status.ProviderID = utils.ProviderID(aws.StringValue(ec2instance.Placement.AvailabilityZone), aws.StringValue(ec2instance.InstanceId))
 	return machine
 }
@@ -0,0 +1,267 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/cloudprovider"
+	machineutil "github.com/aws/karpenter-core/pkg/utils/machine"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/amifamily"
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+// Drift describes why a machine drifted from its provisioner or node template. It's surfaced as the reason and message
+// of the machine's Drifted condition.
+type Drift struct {
+	Reason  v1alpha1.DriftReason
+	Message string
+}
+
+// Drift returns why the machine drifted from its provisioner or node template, or nil if it hasn't drifted. The drift
+// detectors are evaluated in order, so the reason is that of the first detector that found the machine drifted.
+func (c *CloudProvider) Drift(ctx context.Context, machine *v1alpha5.Machine) (*Drift, error) {
+	// Instances that received a rebalance recommendation are replaced before they're interrupted
+	if _, ok := machine.Annotations[v1alpha1.AnnotationRebalanceRecommended]; ok {
+		return &Drift{Reason: v1alpha1.DriftReasonRebalanceRecommended, Message: "instance received a rebalance recommendation"}, nil
+	}
+	// Instances that exceeded the maximum instance lifetime are replaced
+	if expiredAt, ok := machine.Annotations[v1alpha1.AnnotationExpired]; ok {
+		return &Drift{Reason: v1alpha1.DriftReasonExpired, Message: fmt.Sprintf("instance exceeded the maximum instance lifetime at %s", expiredAt)}, nil
+	}
+	provisioner, nodeTemplate, err := c.resolveDriftSources(ctx, machine)
+	if err != nil || nodeTemplate == nil {
+		return nil, err
+	}
+	// The instance is looked up at most once and shared by the drift detectors that need it
+	getInstance := c.lazyInstance(ctx, machine)
+	if settings.FromContext(ctx).EnableAMIDrift {
+		drift, err := c.amiDrift(ctx, machine, provisioner, nodeTemplate, getInstance)
+		if err != nil {
+			return nil, err
+		}
+		if drift != nil {
+			withinBudget, err := c.withinAMIDriftBudget(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if withinBudget {
+				return drift, nil
+			}
+			logging.FromContext(ctx).With("machine", machine.Name).Debugf("deferring ami drift, replacement budget is exhausted")
+		}
+	}
+	if settings.FromContext(ctx).EnableSubnetDrift {
+		if drift, err := c.subnetDrift(ctx, nodeTemplate, getInstance); err != nil || drift != nil {
+			return drift, err
+		}
+	}
+	return c.launchConfigDrift(ctx, machine, nodeTemplate, getInstance)
+}
+
+// resolveDriftSources returns the provisioner and node template that the machine is compared with, or a nil node
+// template if either doesn't exist or the provisioner doesn't reference a node template
+func (c *CloudProvider) resolveDriftSources(ctx context.Context, machine *v1alpha5.Machine) (*v1alpha5.Provisioner, *v1alpha1.AWSNodeTemplate, error) {
+	// Not needed when GetInstanceTypes removes provisioner dependency
+	provisioner := &v1alpha5.Provisioner{}
+	if err := c.kubeClient.Get(ctx, types.NamespacedName{Name: machine.Labels[v1alpha5.ProvisionerNameLabelKey]}, provisioner); err != nil {
+		return nil, nil, client.IgnoreNotFound(fmt.Errorf("getting provisioner, %w", err))
+	}
+	if provisioner.Spec.ProviderRef == nil {
+		return nil, nil, nil
+	}
+	nodeTemplate, err := c.resolveNodeTemplate(ctx, nil, provisioner.Spec.ProviderRef)
+	if err != nil {
+		return nil, nil, client.IgnoreNotFound(fmt.Errorf("resolving node template, %w", err))
+	}
+	return provisioner, nodeTemplate, nil
+}
+
+func (c *CloudProvider) amiDrift(ctx context.Context, machine *v1alpha5.Machine, provisioner *v1alpha5.Provisioner, nodeTemplate *v1alpha1.AWSNodeTemplate,
+	getInstance func() (*ec2.Instance, error)) (*Drift, error) {
+	instanceTypes, err := c.GetInstanceTypes(ctx, provisioner)
+	if err != nil {
+		return nil, fmt.Errorf("getting instanceTypes, %w", err)
+	}
+	nodeInstanceType, found := lo.Find(instanceTypes, func(instType *cloudprovider.InstanceType) bool {
+		return instType.Name == machine.Labels[v1.LabelInstanceTypeStable]
+	})
+	if !found {
+		return nil, fmt.Errorf(`finding node instance type "%s"`, machine.Labels[v1.LabelInstanceTypeStable])
+	}
+	if nodeTemplate.Spec.HasCustomLaunchTemplate() {
+		return nil, nil
+	}
+	amis, err := c.amiProvider.Get(ctx, nodeTemplate, []*cloudprovider.InstanceType{nodeInstanceType},
+		amifamily.GetAMIFamily(nodeTemplate.Spec.AMIFamily, &amifamily.Options{}))
+	if err != nil {
+		return nil, fmt.Errorf("getting amis, %w", err)
+	}
+	// Prefer the AMI recorded when the machine was launched over looking the instance up in EC2
+	imageID, ok := machine.Labels[v1alpha1.LabelInstanceAMIID]
+	if !ok {
+		instance, err := getInstance()
+		if err != nil {
+			return nil, err
+		}
+		imageID = aws.StringValue(instance.ImageId)
+	}
+	if lo.Contains(lo.Keys(amis), imageID) {
+		return nil, nil
+	}
+	return &Drift{Reason: v1alpha1.DriftReasonAMI, Message: fmt.Sprintf("instance ami %s isn't one of the amis that the node template resolves to", imageID)}, nil
+}
+
+// withinAMIDriftBudget returns true if fewer nodes are currently marked as drifted because of their AMI than the AMI
+// drift replacement budget allows, so that a new AMI is rolled out to a limited number of nodes at a time. Nodes that
+// drifted for other reasons don't use up the budget.
+func (c *CloudProvider) withinAMIDriftBudget(ctx context.Context) (bool, error) {
+	nodeList := &v1.NodeList{}
+	if err := c.kubeClient.List(ctx, nodeList, client.HasLabels{v1alpha5.ProvisionerNameLabelKey}); err != nil {
+		return false, fmt.Errorf("listing nodes, %w", err)
+	}
+	budget := settings.FromContext(ctx).AMIDriftReplacementBudget
+	drifted := int64(0)
+	for i := range nodeList.Items {
+		if nodeList.Items[i].Annotations[v1alpha5.VoluntaryDisruptionAnnotationKey] != v1alpha5.VoluntaryDisruptionDriftedAnnotationValue {
+			continue
+		}
+		amiDrifted, err := c.isAMIDrifted(ctx, machineutil.NewFromNode(&nodeList.Items[i]))
+		if err != nil {
+			return false, err
+		}
+		if amiDrifted {
+			if drifted++; drifted >= budget {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// isAMIDrifted returns true if the AMI drift detector is the one that found the machine drifted, i.e. the machine
+// doesn't have a reason to drift that's evaluated before its AMI and its AMI drifted
+func (c *CloudProvider) isAMIDrifted(ctx context.Context, machine *v1alpha5.Machine) (bool, error) {
+	if _, ok := machine.Annotations[v1alpha1.AnnotationRebalanceRecommended]; ok {
+		return false, nil
+	}
+	if _, ok := machine.Annotations[v1alpha1.AnnotationExpired]; ok {
+		return false, nil
+	}
+	provisioner, nodeTemplate, err := c.resolveDriftSources(ctx, machine)
+	if err != nil || nodeTemplate == nil {
+		return false, err
+	}
+	drift, err := c.amiDrift(ctx, machine, provisioner, nodeTemplate, c.lazyInstance(ctx, machine))
+	if err != nil {
+		return false, fmt.Errorf("detecting ami drift of drifted machine %s, %w", machine.Name, err)
+	}
+	return drift != nil, nil
+}
+
+// subnetDrift detects instances that were launched into a subnet that the node template no longer selects
+func (c *CloudProvider) subnetDrift(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, getInstance func() (*ec2.Instance, error)) (*Drift, error) {
+	instance, err := getInstance()
+	if err != nil {
+		return nil, err
+	}
+	if instance.SubnetId == nil {
+		return nil, nil
+	}
+	subnets, err := c.subnetProvider.List(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("getting subnets, %w", err)
+	}
+	if lo.ContainsBy(subnets, func(s *ec2.Subnet) bool { return aws.StringValue(s.SubnetId) == aws.StringValue(instance.SubnetId) }) {
+		return nil, nil
+	}
+	return &Drift{Reason: v1alpha1.DriftReasonSubnet, Message: fmt.Sprintf("instance subnet %s isn't selected by the node template", aws.StringValue(instance.SubnetId))}, nil
+}
+
+// launchConfigDrift detects machines that were launched with a different launch configuration than the node template
+// currently resolves to. Machines launched before their configuration was recorded aren't considered drifted.
+func (c *CloudProvider) launchConfigDrift(ctx context.Context, machine *v1alpha5.Machine, nodeTemplate *v1alpha1.AWSNodeTemplate,
+	getInstance func() (*ec2.Instance, error)) (*Drift, error) {
+	launched, ok := machine.Annotations[v1alpha1.AnnotationLaunchConfigHash]
+	if !ok {
+		return nil, nil
+	}
+	current, err := c.launchTemplateProvider.ConfigHash(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("hashing launch configuration, %w", err)
+	}
+	if current == "" || launched == current {
+		return nil, nil
+	}
+	// The launch configuration includes the security groups, so they're compared with the security groups of the
+	// instance to tell security group drift apart from the rest of the configuration
+	securityGroupIDs, err := c.securityGroupProvider.List(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("getting security groups, %w", err)
+	}
+	instance, err := getInstance()
+	if err != nil {
+		return nil, err
+	}
+	instanceSecurityGroupIDs := sets.NewString(lo.Map(instance.SecurityGroups, func(g *ec2.GroupIdentifier, _ int) string {
+		return aws.StringValue(g.GroupId)
+	})...)
+	if instanceSecurityGroupIDs.Len() > 0 && !instanceSecurityGroupIDs.Equal(sets.NewString(securityGroupIDs...)) {
+		return &Drift{Reason: v1alpha1.DriftReasonSecurityGroup, Message: fmt.Sprintf("instance security groups %s don't match the security groups that the node template resolves to",
+			strings.Join(instanceSecurityGroupIDs.List(), ", "))}, nil
+	}
+	return &Drift{Reason: v1alpha1.DriftReasonLaunchTemplate, Message: "instance was launched with a different launch configuration than the node template resolves to"}, nil
+}
+
+// lazyInstance returns a func that looks up the instance of the machine the first time it's called, and returns the
+// same instance or error on later calls
+func (c *CloudProvider) lazyInstance(ctx context.Context, machine *v1alpha5.Machine) func() (*ec2.Instance, error) {
+	var instance *ec2.Instance
+	var err error
+	var done bool
+	return func() (*ec2.Instance, error) {
+		if !done {
+			instance, err = c.getInstance(ctx, machine)
+			done = true
+		}
+		return instance, err
+	}
+}
+
+func (c *CloudProvider) getInstance(ctx context.Context, machine *v1alpha5.Machine) (*ec2.Instance, error) {
+	instanceID, err := utils.ParseInstanceID(machine.Status.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := c.instanceProvider.Get(ctx, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("getting instance, %w", err)
+	}
+	return instance, nil
+}
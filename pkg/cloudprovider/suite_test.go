@@ -16,8 +16,12 @@ package cloudprovider_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,12 +29,17 @@ import (
 	"github.com/samber/lo"
 	"k8s.io/client-go/tools/record"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	clock "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ssm"
@@ -43,7 +52,10 @@ import (
 	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	"github.com/aws/karpenter/pkg/cloudprovider"
+	awserrors "github.com/aws/karpenter/pkg/errors"
 	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/providers/instancetype"
 	"github.com/aws/karpenter/pkg/test"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
@@ -88,7 +100,7 @@ var _ = BeforeSuite(func() {
 	awsEnv = test.NewEnvironment(ctx, env)
 
 	fakeClock = clock.NewFakeClock(time.Now())
-	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider)
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
 	prov = provisioning.NewProvisioner(ctx, env.Client, env.KubernetesInterface.CoreV1(), events.NewRecorder(&record.FakeRecorder{}), cloudProvider, cluster)
 	provisioningController = provisioning.NewController(env.Client, prov, events.NewRecorder(&record.FakeRecorder{}))
@@ -194,11 +206,230 @@ var _ = Describe("CloudProvider", func() {
 			Expect(createFleetInput.Context).To(BeNil())
 		})
 	})
+	Context("AMI Recording", func() {
+		BeforeEach(func() {
+			nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
+			awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+				{
+					ImageId:      aws.String("ami-123"),
+					Architecture: aws.String("x86_64"),
+					CreationDate: aws.String("2022-08-15T12:00:00Z"),
+				},
+			}})
+			provisioner.SetDefaults(ctx)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		It("should record the resolved ami on the machine when launching", func() {
+			machine, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(machine.Labels).To(HaveKeyWithValue(v1alpha1.LabelInstanceAMIID, "ami-123"))
+		})
+		It("should keep the resolved ami when the machine is retrieved after launch", func() {
+			created, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).ToNot(HaveOccurred())
+
+			retrieved, err := cloudProvider.Get(ctx, created.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retrieved.Labels).To(HaveKeyWithValue(v1alpha1.LabelInstanceAMIID, "ami-123"))
+		})
+	})
+	Context("Eventual Consistency", func() {
+		var ec2api *eventuallyConsistentEC2API
+		var consistentCloudProvider *cloudprovider.CloudProvider
+		BeforeEach(func() {
+			ec2api = &eventuallyConsistentEC2API{EC2API: awsEnv.EC2API}
+			instanceProvider := instance.NewProvider(ctx, "", ec2api, awsEnv.UnavailableOfferingsCache, awsEnv.InstanceTypesProvider,
+				awsEnv.SubnetProvider, awsEnv.LaunchTemplateProvider, awsEnv.CapacityReservationProvider)
+			consistentCloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, instanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		It("should retry describing a launched instance until it's found", func() {
+			// The batched describe and the describe of the single instance both miss the instance once
+			ec2api.notFound.Store(2)
+			created, err := consistentCloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ec2api.notFound.Load()).To(BeZero())
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+
+			retrieved, err := consistentCloudProvider.Get(ctx, created.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retrieved.Name).To(Equal(created.Name))
+		})
+		It("should not retry describing a launched instance when it fails with other errors", func() {
+			awsEnv.EC2API.DescribeInstancesBehavior.Error.Set(awserr.New("UnauthorizedOperation", "", nil), fake.MaxCalls(0))
+			_, err := consistentCloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.FailedCalls()).To(Equal(2))
+		})
+	})
+	Context("Launch Template Recording", func() {
+		BeforeEach(func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		It("should record the generated launch templates on the machine when launching", func() {
+			machine := machineutil.New(&v1.Node{}, provisioner)
+			created, err := cloudProvider.Create(ctx, machine)
+			Expect(err).ToNot(HaveOccurred())
+
+			var ids []string
+			awsEnv.EC2API.LaunchTemplates.Range(func(_, lt any) bool {
+				ids = append(ids, aws.StringValue(lt.(*ec2.LaunchTemplate).LaunchTemplateId))
+				return true
+			})
+			Expect(ids).ToNot(BeEmpty())
+			Expect(created.Annotations).To(HaveKey(v1alpha1.AnnotationLaunchTemplateIDs))
+			Expect(strings.Split(created.Annotations[v1alpha1.AnnotationLaunchTemplateIDs], ",")).To(ConsistOf(ids))
+			// the machine that was launched is annotated as well, so that failed launches can be traced
+			Expect(machine.Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationLaunchTemplateIDs, created.Annotations[v1alpha1.AnnotationLaunchTemplateIDs]))
+		})
+		It("should not record custom launch templates", func() {
+			awsEnv.EC2API.LaunchTemplates.Store("test-launch-template", &ec2.LaunchTemplate{
+				LaunchTemplateName: aws.String("test-launch-template"),
+				LaunchTemplateId:   aws.String("lt-0123456789abcdef0"),
+			})
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
+			ExpectApplied(ctx, env.Client, nodeTemplate)
+			created, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(created.Annotations).ToNot(HaveKey(v1alpha1.AnnotationLaunchTemplateIDs))
+		})
+	})
+	Context("Private DNS Name", func() {
+		BeforeEach(func() {
+			nodeTemplate.Spec.PrivateDNSNameOptions = &v1alpha1.PrivateDNSNameOptions{HostnameType: aws.String(v1alpha1.HostnameTypeResourceName)}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		It("should resolve machines launched with resource-based hostnames by their provider ID", func() {
+			created, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+			Expect(err).ToNot(HaveOccurred())
+			instanceID := created.Status.ProviderID[strings.LastIndex(created.Status.ProviderID, "/")+1:]
+			Expect(created.Name).To(Equal(fake.ResourceDNSName(instanceID)))
+
+			retrieved, err := cloudProvider.Get(ctx, created.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retrieved.Name).To(Equal(created.Name))
+			Expect(retrieved.Status.ProviderID).To(Equal(created.Status.ProviderID))
+		})
+	})
+	Context("Instance Type Compatibility", func() {
+		var machine *v1alpha5.Machine
+		BeforeEach(func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			machine = machineutil.New(&v1.Node{}, provisioner)
+			machine.Spec.Requirements = append(machine.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1.LabelInstanceTypeStable,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{"m5.large"},
+			})
+		})
+		eliminated := func(err error) map[string][]string {
+			noCompatibleErr := &instancetype.NoCompatibleInstanceTypesError{}
+			ExpectWithOffset(1, errors.As(err, &noCompatibleErr)).To(BeTrue())
+			return noCompatibleErr.Eliminated
+		}
+		It("should list the requirements that eliminated each instance type", func() {
+			machine.Spec.Requirements = append(machine.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1.LabelArchStable,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{v1alpha5.ArchitectureArm64},
+			})
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudproivder.IsInsufficientCapacityError(err)).To(BeFalse())
+			Expect(eliminated(err)).To(HaveKeyWithValue(v1.LabelArchStable, ContainElement("m5.large")))
+			Expect(eliminated(err)).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, Not(ContainElement("m5.large"))))
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("%s eliminated", v1.LabelArchStable)))
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(BeZero())
+		})
+		It("should list the instance types that are too small for the resource requests", func() {
+			machine.Spec.Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("64")}
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(eliminated(err)).To(HaveKeyWithValue(instancetype.ConstraintResources, ConsistOf("m5.large")))
+			Expect(err.Error()).To(ContainSubstring("resources eliminated 1 (m5.large)"))
+		})
+		It("should return an insufficient capacity error when instance types were only eliminated by unavailable offerings", func() {
+			machine.Spec.Requirements = append(machine.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1alpha5.LabelCapacityType,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{v1alpha5.CapacityTypeOnDemand},
+			})
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+			Expect(err).ToNot(HaveOccurred())
+			m5, ok := lo.Find(instanceTypes, func(i *corecloudproivder.InstanceType) bool { return i.Name == "m5.large" })
+			Expect(ok).To(BeTrue())
+			for _, o := range m5.Offerings {
+				if o.CapacityType == v1alpha5.CapacityTypeOnDemand {
+					awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", m5.Name, o.Zone, o.CapacityType)
+				}
+			}
+			_, err = cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudproivder.IsInsufficientCapacityError(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("%s eliminated 1 (m5.large)", instancetype.ConstraintUnavailableOfferings)))
+		})
+	})
+	Context("Launch Concurrency", func() {
+		BeforeEach(func() {
+			// Machine-specific tags keep the batcher from merging the launches into a single CreateFleet call
+			nodeTemplate.Spec.Tags = map[string]string{"machine": v1alpha1.TagTemplateMachineName}
+			awsEnv.EC2API.CreateFleetDelay.Set(lo.ToPtr(100 * time.Millisecond))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		launch := func(wg *sync.WaitGroup, provisioner *v1alpha5.Provisioner, count int) {
+			for i := 0; i < count; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					machine := machineutil.New(&v1.Node{}, provisioner)
+					machine.Name = coretest.RandomName()
+					_, err := cloudProvider.Create(ctx, machine)
+					Expect(err).ToNot(HaveOccurred())
+				}()
+			}
+		}
+		It("should not limit concurrent launches by default", func() {
+			wg := &sync.WaitGroup{}
+			launch(wg, provisioner, 5)
+			wg.Wait()
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(5))
+			Expect(awsEnv.EC2API.CreateFleetConcurrency.MaxInFlight()).To(BeNumerically(">", 2))
+		})
+		It("should launch at most the limit concurrently for a node template", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MaxConcurrentLaunches: lo.ToPtr[int64](2)}))
+			wg := &sync.WaitGroup{}
+			launch(wg, provisioner, 6)
+			wg.Wait()
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(6))
+			Expect(awsEnv.EC2API.CreateFleetConcurrency.MaxInFlight()).To(Equal(2))
+		})
+		It("should limit concurrent launches for each node template independently", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MaxConcurrentLaunches: lo.ToPtr[int64](1)}))
+			otherNodeTemplate := nodeTemplate.DeepCopy()
+			otherNodeTemplate.ObjectMeta = metav1.ObjectMeta{Name: coretest.RandomName()}
+			otherProvisioner := test.Provisioner(coretest.ProvisionerOptions{
+				ProviderRef: &v1alpha5.ProviderRef{
+					APIVersion: nodeTemplate.APIVersion,
+					Kind:       nodeTemplate.Kind,
+					Name:       otherNodeTemplate.Name,
+				},
+			})
+			ExpectApplied(ctx, env.Client, otherProvisioner, otherNodeTemplate)
+			wg := &sync.WaitGroup{}
+			launch(wg, provisioner, 3)
+			launch(wg, otherProvisioner, 3)
+			wg.Wait()
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(6))
+			Expect(awsEnv.EC2API.CreateFleetConcurrency.MaxInFlight()).To(Equal(2))
+		})
+	})
 	Context("Node Drift", func() {
 		var validAMI string
 		var selectedInstanceType *corecloudproivder.InstanceType
 		var instance *ec2.Instance
 		BeforeEach(func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableAMIDrift: lo.ToPtr(true)}))
 			validAMI = fake.ImageID()
 			awsEnv.SSMAPI.GetParameterOutput = &ssm.GetParameterOutput{
 				Parameter: &ssm.Parameter{Value: aws.String(validAMI)},
@@ -287,6 +518,9 @@ var _ = Describe("CloudProvider", func() {
 			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
 			Expect(err).ToNot(HaveOccurred())
 			Expect(isDrifted).To(BeTrue())
+			drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonAMI))
 		})
 		It("should not return drifted if the AMI is valid", func() {
 			node := coretest.Node(coretest.NodeOptions{
@@ -302,6 +536,274 @@ var _ = Describe("CloudProvider", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(isDrifted).To(BeFalse())
 		})
+		It("should return drifted if a newer AMI is resolved than the one recorded on the machine", func() {
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+						v1alpha1.LabelInstanceAMIID:      validAMI,
+					},
+				},
+			})
+			awsEnv.SSMAPI.GetParameterOutput = &ssm.GetParameterOutput{
+				Parameter: &ssm.Parameter{Value: aws.String(fake.ImageID())},
+			}
+			awsEnv.SSMCache.Flush()
+			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeTrue())
+		})
+		It("should not return drifted if the AMI is not valid and AMI drift is disabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableAMIDrift: lo.ToPtr(false)}))
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+					},
+				},
+			})
+			instance.ImageId = aws.String(fake.ImageID())
+			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeFalse())
+		})
+		It("should not return drifted if the AMI is not valid and the replacement budget is exhausted", func() {
+			ExpectApplied(ctx, env.Client, coretest.Node(coretest.NodeOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+						v1alpha1.LabelInstanceAMIID:      fake.ImageID(),
+					},
+					Annotations: map[string]string{
+						v1alpha5.VoluntaryDisruptionAnnotationKey: v1alpha5.VoluntaryDisruptionDriftedAnnotationValue,
+					},
+				},
+			}))
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+					},
+				},
+			})
+			instance.ImageId = aws.String(fake.ImageID())
+			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeFalse())
+
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnableAMIDrift:            lo.ToPtr(true),
+				AMIDriftReplacementBudget: lo.ToPtr[int64](2),
+			}))
+			isDrifted, err = cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeTrue())
+		})
+		It("should not count nodes that drifted for other reasons toward the replacement budget", func() {
+			ExpectApplied(ctx, env.Client,
+				coretest.Node(coretest.NodeOptions{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+							v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+							v1alpha1.LabelInstanceAMIID:      validAMI,
+						},
+						Annotations: map[string]string{
+							v1alpha5.VoluntaryDisruptionAnnotationKey: v1alpha5.VoluntaryDisruptionDriftedAnnotationValue,
+						},
+					},
+				}),
+				coretest.Node(coretest.NodeOptions{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+							v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+							v1alpha1.LabelInstanceAMIID:      fake.ImageID(),
+						},
+						Annotations: map[string]string{
+							v1alpha5.VoluntaryDisruptionAnnotationKey: v1alpha5.VoluntaryDisruptionDriftedAnnotationValue,
+							v1alpha1.AnnotationRebalanceRecommended:   time.Now().Format(time.RFC3339),
+						},
+					},
+				}),
+			)
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+					},
+				},
+			})
+			instance.ImageId = aws.String(fake.ImageID())
+			drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).ToNot(BeNil())
+			Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonAMI))
+		})
+		It("should return drifted if the node received a rebalance recommendation", func() {
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+					},
+					Annotations: map[string]string{
+						v1alpha1.AnnotationRebalanceRecommended: time.Now().Format(time.RFC3339),
+					},
+				},
+			})
+			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeTrue())
+			drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonRebalanceRecommended))
+		})
+		It("should return drifted if the node exceeded the maximum instance lifetime", func() {
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+					},
+					Annotations: map[string]string{
+						v1alpha1.AnnotationExpired: time.Now().Format(time.RFC3339),
+					},
+				},
+			})
+			isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isDrifted).To(BeTrue())
+			drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonExpired))
+		})
+		Context("Launch Configuration", func() {
+			var node *v1.Node
+			BeforeEach(func() {
+				configHash, err := awsEnv.LaunchTemplateProvider.ConfigHash(ctx, nodeTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				securityGroupIDs, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				instance.SecurityGroups = lo.Map(securityGroupIDs, func(id string, _ int) *ec2.GroupIdentifier {
+					return &ec2.GroupIdentifier{GroupId: aws.String(id)}
+				})
+				node = coretest.Node(coretest.NodeOptions{
+					ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+							v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+						},
+						Annotations: map[string]string{
+							v1alpha1.AnnotationLaunchConfigHash: configHash,
+						},
+					},
+				})
+			})
+			It("should record the launch configuration on the machine when launching", func() {
+				created, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(created.Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationLaunchConfigHash, node.Annotations[v1alpha1.AnnotationLaunchConfigHash]))
+			})
+			It("should not return drifted if the launch configuration is unchanged", func() {
+				isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isDrifted).To(BeFalse())
+			})
+			It("should return drifted if the security group selector resolves to different security groups", func() {
+				nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"Name": "test-security-group-1"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isDrifted).To(BeTrue())
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonSecurityGroup))
+			})
+			It("should not return drifted if the security group selector changes but resolves to the same security groups", func() {
+				nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"foo": "bar"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isDrifted).To(BeFalse())
+			})
+			It("should return drifted if the user data changed", func() {
+				nodeTemplate.Spec.UserData = aws.String("#!/bin/bash\necho hello")
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isDrifted).To(BeTrue())
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonLaunchTemplate))
+			})
+			It("should not return drifted if the launch configuration wasn't recorded", func() {
+				delete(node.Annotations, v1alpha1.AnnotationLaunchConfigHash)
+				nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"Name": "test-security-group-1"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				isDrifted, err := cloudProvider.IsMachineDrifted(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isDrifted).To(BeFalse())
+			})
+		})
+		Context("Subnets", func() {
+			var node *v1.Node
+			BeforeEach(func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableSubnetDrift: lo.ToPtr(true)}))
+				instance.SubnetId = aws.String("subnet-test1")
+				node = coretest.Node(coretest.NodeOptions{
+					ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+							v1.LabelInstanceTypeStable:       selectedInstanceType.Name,
+						},
+					},
+				})
+			})
+			It("should not return drifted if the subnet of the instance is still selected", func() {
+				nodeTemplate.Spec.SubnetSelector = map[string]string{"Name": "test-subnet-1"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift).To(BeNil())
+			})
+			It("should return drifted if the subnet of the instance is no longer selected", func() {
+				nodeTemplate.Spec.SubnetSelector = map[string]string{"Name": "test-subnet-2"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonSubnet))
+				Expect(drift.Message).To(ContainSubstring("subnet-test1"))
+			})
+			It("should not return drifted if the subnet of the instance is no longer selected and subnet drift is disabled", func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableSubnetDrift: lo.ToPtr(false)}))
+				nodeTemplate.Spec.SubnetSelector = map[string]string{"Name": "test-subnet-2"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift).To(BeNil())
+			})
+			It("should look the instance up once for all of the drift detectors", func() {
+				node.Annotations = map[string]string{v1alpha1.AnnotationLaunchConfigHash: "stale"}
+				drift, err := cloudProvider.Drift(ctx, machineutil.NewFromNode(node))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(drift.Reason).To(Equal(v1alpha1.DriftReasonLaunchTemplate))
+				Expect(awsEnv.EC2API.DescribeInstancesBehavior.Calls()).To(Equal(1))
+			})
+		})
 		It("should error if the node doesn't have the instance-type label", func() {
 			node := coretest.Node(coretest.NodeOptions{
 				ProviderID: fake.ProviderID(lo.FromPtr(instance.InstanceId)),
@@ -422,6 +924,247 @@ var _ = Describe("CloudProvider", func() {
 			Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("overridden-profile"))
 		})
 	})
+	Context("Instance Listing", func() {
+		var makeInstances func(count int, zone string) []string
+		var makeProvisionerInstances func(count int, zone, provisionerName string) []string
+		BeforeEach(func() {
+			makeInstances = func(count int, zone string) []string {
+				return makeProvisionerInstances(count, zone, "default")
+			}
+			makeProvisionerInstances = func(count int, zone, provisionerName string) []string {
+				var ids []string
+				for i := 0; i < count; i++ {
+					instanceID := fake.InstanceID()
+					awsEnv.EC2API.Instances.Store(instanceID, &ec2.Instance{
+						State: &ec2.InstanceState{
+							Name: aws.String(ec2.InstanceStateNameRunning),
+						},
+						Tags: []*ec2.Tag{
+							{
+								Key:   aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)),
+								Value: aws.String("owned"),
+							},
+							{
+								Key:   aws.String(v1alpha5.ProvisionerNameLabelKey),
+								Value: aws.String(provisionerName),
+							},
+						},
+						PrivateDnsName: aws.String(fake.PrivateDNSName()),
+						Placement: &ec2.Placement{
+							AvailabilityZone: aws.String(zone),
+						},
+						LaunchTime:   aws.Time(time.Now()),
+						InstanceId:   aws.String(instanceID),
+						InstanceType: aws.String("m5.large"),
+					})
+					ids = append(ids, instanceID)
+				}
+				return ids
+			}
+		})
+		It("should consume all pages when DescribeInstances returns a NextToken", func() {
+			ids := makeInstances(2500, "test-zone-1a")
+			instances, err := awsEnv.InstanceProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.Map(instances, func(i *ec2.Instance, _ int) string { return aws.StringValue(i.InstanceId) })).To(ConsistOf(ids))
+
+			// 2500 instances with a page size of 1000 should result in 3 pages
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len()).To(Equal(3))
+			var nextTokens []string
+			for awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len() > 0 {
+				nextTokens = append(nextTokens, aws.StringValue(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Pop().NextToken))
+			}
+			Expect(nextTokens).To(ConsistOf("", "1000", "2000"))
+		})
+		It("should only retain the fields of instances that are used to build machines when listing them trimmed", func() {
+			id := makeInstances(1, "test-zone-1a")[0]
+			stored, _ := awsEnv.EC2API.Instances.Load(id)
+			stored.(*ec2.Instance).ImageId = aws.String("ami-123")
+			stored.(*ec2.Instance).SpotInstanceRequestId = aws.String("sir-123")
+			stored.(*ec2.Instance).NetworkInterfaces = []*ec2.InstanceNetworkInterface{{NetworkInterfaceId: aws.String("eni-123")}}
+			stored.(*ec2.Instance).BlockDeviceMappings = []*ec2.InstanceBlockDeviceMapping{{DeviceName: aws.String("/dev/xvda")}}
+			stored.(*ec2.Instance).SecurityGroups = []*ec2.GroupIdentifier{{GroupId: aws.String("sg-123")}}
+
+			instances, err := awsEnv.InstanceProvider.ListTrimmed(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+			Expect(instances[0].NetworkInterfaces).To(BeNil())
+			Expect(instances[0].BlockDeviceMappings).To(BeNil())
+			Expect(instances[0].SecurityGroups).To(BeNil())
+			Expect(aws.StringValue(instances[0].InstanceId)).To(Equal(id))
+			Expect(aws.StringValue(instances[0].ImageId)).To(Equal("ami-123"))
+			Expect(aws.StringValue(instances[0].SpotInstanceRequestId)).To(Equal("sir-123"))
+
+			machines, err := cloudProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(machines).To(HaveLen(1))
+			Expect(machines[0].Status.ProviderID).To(Equal(fmt.Sprintf("aws:///test-zone-1a/%s", id)))
+			Expect(machines[0].Labels).To(HaveKeyWithValue(v1.LabelTopologyZone, "test-zone-1a"))
+			Expect(machines[0].Labels).To(HaveKeyWithValue(v1alpha1.LabelInstanceAMIID, "ami-123"))
+			Expect(machines[0].Labels).To(HaveKeyWithValue(v1alpha5.LabelCapacityType, v1alpha5.CapacityTypeSpot))
+			Expect(machines[0].Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationInstanceState, ec2.InstanceStateNameRunning))
+		})
+		It("should retain every field of instances when listing them untrimmed", func() {
+			id := makeInstances(1, "test-zone-1a")[0]
+			stored, _ := awsEnv.EC2API.Instances.Load(id)
+			stored.(*ec2.Instance).NetworkInterfaces = []*ec2.InstanceNetworkInterface{{NetworkInterfaceId: aws.String("eni-123")}}
+			stored.(*ec2.Instance).IamInstanceProfile = &ec2.IamInstanceProfile{Arn: aws.String("arn:aws:iam::000000000000:instance-profile/test")}
+
+			instances, err := awsEnv.InstanceProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+			Expect(instances[0].NetworkInterfaces).To(HaveLen(1))
+			Expect(aws.StringValue(instances[0].IamInstanceProfile.Arn)).To(Equal("arn:aws:iam::000000000000:instance-profile/test"))
+
+			instances, err = awsEnv.InstanceProvider.ListByProvisioner(ctx, "default")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+			Expect(instances[0].NetworkInterfaces).To(HaveLen(1))
+		})
+		It("should list instances concurrently across zones and merge the results", func() {
+			ids := append(makeInstances(100, "test-zone-1a"), makeInstances(100, "test-zone-1b")...)
+			ids = append(ids, makeInstances(100, "test-zone-1c")...)
+			instances, err := awsEnv.InstanceProvider.List(ctx, "test-zone-1a", "test-zone-1b", "test-zone-1c")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.Map(instances, func(i *ec2.Instance, _ int) string { return aws.StringValue(i.InstanceId) })).To(ConsistOf(ids))
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len()).To(Equal(3))
+		})
+		It("should only list instances in the passed zones", func() {
+			ids := makeInstances(10, "test-zone-1a")
+			makeInstances(10, "test-zone-1b")
+			instances, err := awsEnv.InstanceProvider.List(ctx, "test-zone-1a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.Map(instances, func(i *ec2.Instance, _ int) string { return aws.StringValue(i.InstanceId) })).To(ConsistOf(ids))
+		})
+		It("should list the machines of every zone of the region concurrently when zonal instance listing is enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableZonalInstanceListing: lo.ToPtr(true)}))
+			makeInstances(100, "test-zone-1a")
+			makeInstances(100, "test-zone-1b")
+			makeInstances(100, "test-zone-1c")
+			machines, err := cloudProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(machines).To(HaveLen(300))
+			Expect(lo.CountBy(machines, func(m *v1alpha5.Machine) bool { return m.Labels[v1.LabelTopologyZone] == "test-zone-1b" })).To(Equal(100))
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len()).To(Equal(3))
+		})
+		It("should list the machines of every zone with a single listing when zonal instance listing is disabled", func() {
+			makeInstances(10, "test-zone-1a")
+			makeInstances(10, "test-zone-1b")
+			machines, err := cloudProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(machines).To(HaveLen(20))
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should only list instances for the requested provisioner", func() {
+			ids := makeProvisionerInstances(10, "test-zone-1a", "default")
+			makeProvisionerInstances(10, "test-zone-1a", "other")
+			machines, err := cloudProvider.ListByProvisioner(ctx, "default")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lo.Map(machines, func(m *v1alpha5.Machine, _ int) string { return m.Status.ProviderID })).To(ConsistOf(
+				lo.Map(ids, func(id string, _ int) string { return fmt.Sprintf("aws:///test-zone-1a/%s", id) }),
+			))
+			for _, machine := range machines {
+				Expect(machine.Labels).To(HaveKeyWithValue(v1alpha5.ProvisionerNameLabelKey, "default"))
+			}
+		})
+		It("should filter instances by provisioner through DescribeInstances", func() {
+			makeProvisionerInstances(10, "test-zone-1a", "default")
+			makeProvisionerInstances(10, "test-zone-1a", "other")
+			_, err := cloudProvider.ListByProvisioner(ctx, "other")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.DescribeInstancesBehavior.CalledWithInput.Pop()
+			Expect(input.Filters).To(ContainElement(&ec2.Filter{
+				Name:   aws.String(fmt.Sprintf("tag:%s", v1alpha5.ProvisionerNameLabelKey)),
+				Values: aws.StringSlice([]string{"other"}),
+			}))
+			Expect(input.InstanceIds).To(BeEmpty())
+		})
+		Context("Concurrent Listing", func() {
+			var ec2api *blockingEC2API
+			var instanceProvider *instance.Provider
+			BeforeEach(func() {
+				ec2api = &blockingEC2API{EC2API: awsEnv.EC2API, release: make(chan struct{})}
+				instanceProvider = instance.NewProvider(ctx, "", ec2api, awsEnv.UnavailableOfferingsCache, awsEnv.InstanceTypesProvider,
+					awsEnv.SubnetProvider, awsEnv.LaunchTemplateProvider, awsEnv.CapacityReservationProvider)
+			})
+			// listConcurrently lists instances from count goroutines once every goroutine is waiting on the same listing
+			listConcurrently := func(count int) ([][]*ec2.Instance, []error) {
+				results := make([][]*ec2.Instance, count)
+				errs := make([]error, count)
+				var started, done sync.WaitGroup
+				started.Add(count)
+				done.Add(count)
+				for i := 0; i < count; i++ {
+					go func(i int) {
+						defer GinkgoRecover()
+						defer done.Done()
+						started.Done()
+						results[i], errs[i] = instanceProvider.List(ctx)
+					}(i)
+				}
+				started.Wait()
+				Eventually(ec2api.calls.Load).Should(BeNumerically("==", 1))
+				Consistently(ec2api.calls.Load, 100*time.Millisecond).Should(BeNumerically("==", 1))
+				close(ec2api.release)
+				done.Wait()
+				return results, errs
+			}
+			It("should share a single DescribeInstances listing between concurrent callers", func() {
+				ids := makeInstances(10, "test-zone-1a")
+				results, errs := listConcurrently(10)
+				Expect(ec2api.calls.Load()).To(BeNumerically("==", 1))
+				for i := range results {
+					Expect(errs[i]).ToNot(HaveOccurred())
+					Expect(lo.Map(results[i], func(i *ec2.Instance, _ int) string { return aws.StringValue(i.InstanceId) })).To(ConsistOf(ids))
+				}
+			})
+			It("should return the error of the shared listing to every caller", func() {
+				awsEnv.EC2API.DescribeInstancesBehavior.Error.Set(awserr.New("UnauthorizedOperation", "", nil), fake.MaxCalls(1))
+				_, errs := listConcurrently(10)
+				Expect(ec2api.calls.Load()).To(BeNumerically("==", 1))
+				for _, err := range errs {
+					Expect(err).To(HaveOccurred())
+				}
+			})
+			It("should not fail the other callers when the caller that started the listing is canceled", func() {
+				ids := makeInstances(10, "test-zone-1a")
+				canceledCtx, cancel := context.WithCancel(ctx)
+				canceled := make(chan error)
+				go func() {
+					_, err := instanceProvider.List(canceledCtx)
+					canceled <- err
+				}()
+				Eventually(ec2api.calls.Load).Should(BeNumerically("==", 1))
+				var instances []*ec2.Instance
+				var err error
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					instances, err = instanceProvider.List(ctx)
+				}()
+				// The canceled caller returns without waiting for the shared listing
+				cancel()
+				Eventually(canceled).Should(Receive(MatchError(context.Canceled)))
+				close(ec2api.release)
+				Eventually(done).Should(BeClosed())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lo.Map(instances, func(i *ec2.Instance, _ int) string { return aws.StringValue(i.InstanceId) })).To(ConsistOf(ids))
+				Expect(ec2api.calls.Load()).To(BeNumerically("==", 1))
+			})
+			It("should list again once the shared listing completes", func() {
+				makeInstances(10, "test-zone-1a")
+				close(ec2api.release)
+				_, err := instanceProvider.List(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = instanceProvider.List(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ec2api.calls.Load()).To(BeNumerically("==", 2))
+			})
+		})
+	})
 	Context("Subnet Compatibility", func() {
 		// Note when debugging these tests -
 		// hard coded fixture data (ex. what the aws api will return) is maintained in fake/ec2api.go
@@ -525,4 +1268,688 @@ var _ = Describe("CloudProvider", func() {
 			Expect(fake.SubnetsFromFleetRequest(createFleetInput)).To(ConsistOf("test-subnet-2"))
 		})
 	})
+	Context("Subnet Weights", func() {
+		weightedSubnet := func(id, zone, weight string) *ec2.Subnet {
+			tags := []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(id)}}
+			if weight != "" {
+				tags = append(tags, &ec2.Tag{Key: aws.String(v1alpha1.TagSubnetWeight), Value: aws.String(weight)})
+			}
+			return &ec2.Subnet{SubnetId: aws.String(id), AvailabilityZone: aws.String(zone), AvailableIpAddressCount: aws.Int64(100), Tags: tags}
+		}
+		BeforeEach(func() {
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{MaxPods: aws.Int32(1)}
+		})
+		It("should prefer the zone with the highest weighted subnet across many launches", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				weightedSubnet("test-subnet-1", "test-zone-1a", "10"),
+				weightedSubnet("test-subnet-2", "test-zone-1b", "50"),
+				weightedSubnet("test-subnet-3", "test-zone-1c", ""),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			zones := map[string]int{}
+			for i := 0; i < 5; i++ {
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				node := ExpectScheduled(ctx, env.Client, pod)
+				zones[node.Labels[v1.LabelTopologyZone]]++
+
+				createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+				Expect(createFleetInput.OnDemandOptions.AllocationStrategy).To(Equal(aws.String(ec2.FleetOnDemandAllocationStrategyPrioritized)))
+				overrides := createFleetInput.LaunchTemplateConfigs[0].Overrides
+				Expect(aws.StringValue(overrides[0].SubnetId)).To(Equal("test-subnet-2"))
+				for _, override := range overrides {
+					Expect(aws.Float64Value(override.Priority)).To(Equal(map[string]float64{
+						"test-subnet-2": 0,
+						"test-subnet-1": 1,
+						"test-subnet-3": 2,
+					}[aws.StringValue(override.SubnetId)]))
+				}
+			}
+			Expect(zones).To(Equal(map[string]int{"test-zone-1b": 5}))
+		})
+		It("should use a prioritized spot allocation strategy when subnets are weighted", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				weightedSubnet("test-subnet-1", "test-zone-1a", "10"),
+				weightedSubnet("test-subnet-2", "test-zone-1b", "50"),
+			}})
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.SpotOptions.AllocationStrategy).To(Equal(aws.String(ec2.SpotAllocationStrategyCapacityOptimizedPrioritized)))
+			Expect(fake.SubnetsFromFleetRequest(createFleetInput)).To(ConsistOf("test-subnet-1", "test-subnet-2"))
+		})
+		It("should not prioritize zones when every subnet has the same weight", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				weightedSubnet("test-subnet-1", "test-zone-1a", "10"),
+				weightedSubnet("test-subnet-2", "test-zone-1b", "10"),
+				weightedSubnet("test-subnet-3", "test-zone-1c", "10"),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.AllocationStrategy).To(Equal(aws.String(ec2.FleetOnDemandAllocationStrategyLowestPrice)))
+			for _, override := range createFleetInput.LaunchTemplateConfigs[0].Overrides {
+				Expect(override.Priority).To(BeNil())
+			}
+		})
+		It("should treat subnets with an invalid weight as unweighted", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				weightedSubnet("test-subnet-1", "test-zone-1a", "not-a-number"),
+				weightedSubnet("test-subnet-2", "test-zone-1b", "-5"),
+				weightedSubnet("test-subnet-3", "test-zone-1c", ""),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			for _, override := range createFleetInput.LaunchTemplateConfigs[0].Overrides {
+				Expect(override.Priority).To(BeNil())
+			}
+		})
+	})
+	Context("Zone Balancing", func() {
+		zonalSubnet := func(id, zone string, tags ...*ec2.Tag) *ec2.Subnet {
+			return &ec2.Subnet{SubnetId: aws.String(id), AvailabilityZone: aws.String(zone), AvailableIpAddressCount: aws.Int64(100),
+				Tags: append([]*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(id)}}, tags...)}
+		}
+		// launch provisions a node for each pod, one at a time, and returns the number of nodes launched into each zone
+		launch := func(count int) map[string]int {
+			zones := map[string]int{}
+			for i := 0; i < count; i++ {
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				node := ExpectScheduled(ctx, env.Client, pod)
+				zones[node.Labels[v1.LabelTopologyZone]]++
+			}
+			return zones
+		}
+		BeforeEach(func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableZoneBalancing: lo.ToPtr(true)}))
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{MaxPods: aws.Int32(1)}
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				zonalSubnet("test-subnet-1", "test-zone-1a"),
+				zonalSubnet("test-subnet-2", "test-zone-1b"),
+				zonalSubnet("test-subnet-3", "test-zone-1c"),
+			}})
+		})
+		It("should spread many launches evenly across zones", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			zones := launch(30)
+			Expect(zones).To(HaveLen(3))
+			for zone, count := range zones {
+				Expect(count).To(BeNumerically("~", 10, 1), "zone %s", zone)
+			}
+		})
+		It("should spread launches across only the zones that the provisioner allows", func() {
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a", "test-zone-1b"}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			zones := launch(20)
+			Expect(zones).To(HaveLen(2))
+			for zone, count := range zones {
+				Expect(count).To(BeNumerically("~", 10, 1), "zone %s", zone)
+			}
+		})
+		It("should prioritize the zones with the fewest recent launches", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			first := launch(1)
+			launch(1)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.AllocationStrategy).To(Equal(aws.String(ec2.FleetOnDemandAllocationStrategyPrioritized)))
+			for _, override := range createFleetInput.LaunchTemplateConfigs[0].Overrides {
+				_, launched := first[aws.StringValue(override.AvailabilityZone)]
+				Expect(aws.Float64Value(override.Priority)).To(Equal(lo.Ternary[float64](launched, 1, 0)))
+			}
+		})
+		It("should use a prioritized spot allocation strategy when balancing spot launches", func() {
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			launch(2)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.SpotOptions.AllocationStrategy).To(Equal(aws.String(ec2.SpotAllocationStrategyCapacityOptimizedPrioritized)))
+		})
+		It("should prefer weighted zones over balancing launches", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				zonalSubnet("test-subnet-1", "test-zone-1a"),
+				zonalSubnet("test-subnet-2", "test-zone-1b", &ec2.Tag{Key: aws.String(v1alpha1.TagSubnetWeight), Value: aws.String("50")}),
+				zonalSubnet("test-subnet-3", "test-zone-1c"),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			Expect(launch(5)).To(Equal(map[string]int{"test-zone-1b": 5}))
+		})
+		It("should not balance launches when zone balancing is disabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings())
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			launch(5)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(5))
+			for awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len() > 0 {
+				createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+				Expect(createFleetInput.OnDemandOptions.AllocationStrategy).To(Equal(aws.String(ec2.FleetOnDemandAllocationStrategyLowestPrice)))
+				for _, override := range createFleetInput.LaunchTemplateConfigs[0].Overrides {
+					Expect(override.Priority).To(BeNil())
+				}
+			}
+		})
+	})
+	Context("On-Demand Base Capacity", func() {
+		// launch provisions a node for each pod, one at a time, and returns the capacity type of each node in launch order
+		launch := func(count int) []string {
+			var capacityTypes []string
+			for i := 0; i < count; i++ {
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				node := ExpectScheduled(ctx, env.Client, pod)
+				capacityTypes = append(capacityTypes, node.Labels[v1alpha5.LabelCapacityType])
+			}
+			return capacityTypes
+		}
+		BeforeEach(func() {
+			nodeTemplate.Spec.OnDemandBaseCapacity = aws.Int64(2)
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{MaxPods: aws.Int32(1)}
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeOnDemand}},
+			}
+		})
+		It("should launch on-demand until the base capacity is satisfied before launching spot", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			Expect(launch(5)).To(Equal([]string{
+				v1alpha5.CapacityTypeOnDemand,
+				v1alpha5.CapacityTypeOnDemand,
+				v1alpha5.CapacityTypeSpot,
+				v1alpha5.CapacityTypeSpot,
+				v1alpha5.CapacityTypeSpot,
+			}))
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(5))
+			for i := 4; i >= 0; i-- {
+				createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+				Expect(aws.StringValue(createFleetInput.TargetCapacitySpecification.DefaultTargetCapacityType)).To(Equal(
+					lo.Ternary(i < 2, v1alpha5.CapacityTypeOnDemand, v1alpha5.CapacityTypeSpot)))
+			}
+		})
+		It("should launch on-demand again once an on-demand node is removed", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			Expect(launch(3)).To(Equal([]string{v1alpha5.CapacityTypeOnDemand, v1alpha5.CapacityTypeOnDemand, v1alpha5.CapacityTypeSpot}))
+
+			nodeList := &v1.NodeList{}
+			Expect(env.Client.List(ctx, nodeList, client.MatchingLabels{v1alpha5.LabelCapacityType: v1alpha5.CapacityTypeOnDemand})).To(Succeed())
+			Expect(nodeList.Items).To(HaveLen(2))
+			ExpectDeleted(ctx, env.Client, &nodeList.Items[0])
+			Expect(launch(2)).To(Equal([]string{v1alpha5.CapacityTypeOnDemand, v1alpha5.CapacityTypeSpot}))
+		})
+		It("should count machines that don't have a node yet toward the base capacity", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			var capacityTypes []string
+			for i := 0; i < 4; i++ {
+				created, err := cloudProvider.Create(ctx, machineutil.New(&v1.Node{}, provisioner))
+				Expect(err).ToNot(HaveOccurred())
+				ExpectApplied(ctx, env.Client, coretest.Machine(v1alpha5.Machine{
+					ObjectMeta: metav1.ObjectMeta{Labels: lo.Assign(created.Labels, map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name})},
+					Status:     v1alpha5.MachineStatus{ProviderID: created.Status.ProviderID},
+				}))
+				capacityTypes = append(capacityTypes, created.Labels[v1alpha5.LabelCapacityType])
+			}
+			Expect(capacityTypes).To(Equal([]string{
+				v1alpha5.CapacityTypeOnDemand,
+				v1alpha5.CapacityTypeOnDemand,
+				v1alpha5.CapacityTypeSpot,
+				v1alpha5.CapacityTypeSpot,
+			}))
+			nodeList := &v1.NodeList{}
+			Expect(env.Client.List(ctx, nodeList)).To(Succeed())
+			Expect(nodeList.Items).To(BeEmpty())
+		})
+		It("should count a machine and its node once", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			labels := map[string]string{
+				v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+				v1alpha5.LabelCapacityType:       v1alpha5.CapacityTypeOnDemand,
+			}
+			providerID := fake.ProviderID(fake.InstanceID())
+			ExpectApplied(ctx, env.Client, coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Status:     v1alpha5.MachineStatus{ProviderID: providerID},
+			}))
+			ExpectApplied(ctx, env.Client, coretest.Node(coretest.NodeOptions{ObjectMeta: metav1.ObjectMeta{Labels: labels}, ProviderID: providerID}))
+			Expect(launch(1)).To(Equal([]string{v1alpha5.CapacityTypeOnDemand}))
+		})
+		It("should not count on-demand machines that are being deleted", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			for i := 0; i < 2; i++ {
+				machine := coretest.Machine(v1alpha5.Machine{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+						v1alpha5.LabelCapacityType:       v1alpha5.CapacityTypeOnDemand,
+					},
+					Finalizers: []string{v1alpha5.TerminationFinalizer},
+				}})
+				ExpectApplied(ctx, env.Client, machine)
+				Expect(env.Client.Delete(ctx, machine)).To(Succeed())
+			}
+			Expect(launch(1)).To(Equal([]string{v1alpha5.CapacityTypeOnDemand}))
+		})
+		It("should only count the on-demand nodes of the same provisioner", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			ExpectApplied(ctx, env.Client, coretest.Node(coretest.NodeOptions{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				v1alpha5.ProvisionerNameLabelKey: "other",
+				v1alpha5.LabelCapacityType:       v1alpha5.CapacityTypeOnDemand,
+			}}}))
+			Expect(launch(1)).To(Equal([]string{v1alpha5.CapacityTypeOnDemand}))
+		})
+		It("should launch spot when the provisioner doesn't allow on-demand", func() {
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			Expect(launch(2)).To(Equal([]string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeSpot}))
+		})
+		It("should prefer spot when the base capacity isn't set", func() {
+			nodeTemplate.Spec.OnDemandBaseCapacity = nil
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			Expect(launch(2)).To(Equal([]string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeSpot}))
+		})
+	})
+	Context("Capacity Reservations", func() {
+		capacityReservation := func(id, instanceType, zone string, available int64) *ec2.CapacityReservation {
+			return &ec2.CapacityReservation{
+				CapacityReservationId:  aws.String(id),
+				InstanceType:           aws.String(instanceType),
+				AvailabilityZone:       aws.String(zone),
+				AvailableInstanceCount: aws.Int64(available),
+				State:                  aws.String(ec2.CapacityReservationStateActive),
+				InstanceMatchCriteria:  aws.String(ec2.InstanceMatchCriteriaOpen),
+			}
+		}
+		BeforeEach(func() {
+			nodeTemplate.Spec.CapacityReservationSelector = map[string]string{"aws-ids": "cr-1"}
+		})
+		It("should launch into the instance types and zones of a capacity reservation", func() {
+			awsEnv.EC2API.DescribeCapacityReservationsOutput.Set(&ec2.DescribeCapacityReservationsOutput{CapacityReservations: []*ec2.CapacityReservation{
+				capacityReservation("cr-1", "m5.large", "test-zone-1a", 2),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "m5.large"))
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelTopologyZone, "test-zone-1a"))
+
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.CapacityReservationOptions).ToNot(BeNil())
+			Expect(createFleetInput.OnDemandOptions.CapacityReservationOptions.UsageStrategy).To(Equal(aws.String(ec2.FleetCapacityReservationUsageStrategyUseCapacityReservationsFirst)))
+			for _, ltc := range createFleetInput.LaunchTemplateConfigs {
+				for _, override := range ltc.Overrides {
+					Expect(aws.StringValue(override.InstanceType)).To(Equal("m5.large"))
+					Expect(aws.StringValue(override.AvailabilityZone)).To(Equal("test-zone-1a"))
+				}
+			}
+		})
+		It("should launch regular on-demand capacity when the capacity reservation is full", func() {
+			awsEnv.EC2API.DescribeCapacityReservationsOutput.Set(&ec2.DescribeCapacityReservationsOutput{CapacityReservations: []*ec2.CapacityReservation{
+				capacityReservation("cr-1", "m5.large", "test-zone-1a", 0),
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.CapacityReservationOptions).To(BeNil())
+			Expect(len(createFleetInput.LaunchTemplateConfigs[0].Overrides)).To(BeNumerically(">", 1))
+		})
+		It("should ignore capacity reservations that aren't active or don't have open instance matching criteria", func() {
+			expired := capacityReservation("cr-1", "m5.large", "test-zone-1a", 2)
+			expired.State = aws.String(ec2.CapacityReservationStateExpired)
+			targeted := capacityReservation("cr-2", "m5.large", "test-zone-1a", 2)
+			targeted.InstanceMatchCriteria = aws.String(ec2.InstanceMatchCriteriaTargeted)
+			awsEnv.EC2API.DescribeCapacityReservationsOutput.Set(&ec2.DescribeCapacityReservationsOutput{CapacityReservations: []*ec2.CapacityReservation{expired, targeted}})
+			nodeTemplate.Spec.CapacityReservationSelector = map[string]string{"aws-ids": "cr-1,cr-2"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.CapacityReservationOptions).To(BeNil())
+		})
+		It("should not use capacity reservations for spot launches", func() {
+			awsEnv.EC2API.DescribeCapacityReservationsOutput.Set(&ec2.DescribeCapacityReservationsOutput{CapacityReservations: []*ec2.CapacityReservation{
+				capacityReservation("cr-1", "m5.large", "test-zone-1a", 2),
+			}})
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions).To(BeNil())
+			Expect(len(createFleetInput.LaunchTemplateConfigs[0].Overrides)).To(BeNumerically(">", 1))
+		})
+		It("should not describe capacity reservations without a capacity reservation selector", func() {
+			nodeTemplate.Spec.CapacityReservationSelector = nil
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.DescribeCapacityReservationsInput.IsNil()).To(BeTrue())
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(createFleetInput.OnDemandOptions.CapacityReservationOptions).To(BeNil())
+		})
+	})
+	Context("Deletion Mode", func() {
+		var instance *ec2.Instance
+		var machine *v1alpha5.Machine
+		BeforeEach(func() {
+			instance = &ec2.Instance{
+				State: &ec2.InstanceState{
+					Name: aws.String(ec2.InstanceStateNameRunning),
+				},
+				Tags: []*ec2.Tag{
+					{
+						Key:   aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)),
+						Value: aws.String("owned"),
+					},
+					{
+						Key:   aws.String(v1alpha5.ProvisionerNameLabelKey),
+						Value: aws.String(provisioner.Name),
+					},
+				},
+				PrivateDnsName: aws.String(fake.PrivateDNSName()),
+				Placement: &ec2.Placement{
+					AvailabilityZone: aws.String("test-zone-1a"),
+				},
+				RootDeviceType: aws.String(ec2.DeviceTypeEbs),
+				LaunchTime:     aws.Time(time.Now()),
+				InstanceId:     aws.String(fake.InstanceID()),
+				InstanceType:   aws.String("m5.large"),
+			}
+			machine = coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				},
+				Status: v1alpha5.MachineStatus{
+					ProviderID: fake.ProviderID(aws.StringValue(instance.InstanceId)),
+				},
+			})
+			nodeTemplate.Spec.DeletionMode = aws.String(v1alpha1.DeletionModeStop)
+		})
+		It("should terminate the instance by default", func() {
+			nodeTemplate.Spec.DeletionMode = nil
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should stop the instance and tag it as stopped when the node template opts in", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Pop().InstanceIds).To(ConsistOf(instance.InstanceId))
+
+			retrieved, err := cloudProvider.Get(ctx, machine.Status.ProviderID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(retrieved.Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationInstanceState, ec2.InstanceStateNameStopped))
+			Expect(retrieved.Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationStopped, "true"))
+		})
+		It("should terminate an instance with an instance store root device", func() {
+			instance.RootDeviceType = aws.String(ec2.DeviceTypeInstanceStore)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should terminate a spot instance", func() {
+			instance.InstanceLifecycle = aws.String(ec2.InstanceLifecycleTypeSpot)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should terminate the instance when the node template doesn't exist", func() {
+			ExpectApplied(ctx, env.Client, provisioner)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
+		})
+		It("should retain the instance and remove its karpenter tags when the machine is annotated to retain it", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			instance.Tags = append(instance.Tags,
+				&ec2.Tag{Key: aws.String(v1alpha5.MachineNameLabelKey), Value: aws.String(machine.Name)},
+				&ec2.Tag{Key: aws.String(v1alpha5.ManagedByLabelKey), Value: aws.String(settings.FromContext(ctx).ClusterName)},
+			)
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			machine.Annotations = lo.Assign(machine.Annotations, map[string]string{v1alpha1.AnnotationRetainInstance: "true"})
+
+			Expect(cloudProvider.Delete(ctx, machine)).To(Succeed())
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+			Expect(awsEnv.EC2API.StopInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+
+			retained, err := awsEnv.InstanceProvider.Get(ctx, aws.StringValue(instance.InstanceId))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aws.StringValue(retained.State.Name)).To(Equal(ec2.InstanceStateNameRunning))
+			Expect(lo.Map(retained.Tags, func(t *ec2.Tag, _ int) string { return aws.StringValue(t.Key) })).To(ConsistOf(
+				fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName),
+			))
+			// Garbage collection no longer considers the instance
+			instances, err := awsEnv.InstanceProvider.List(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(BeEmpty())
+		})
+		It("should return a machine not found error when retaining an instance that doesn't exist", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			machine.Annotations = lo.Assign(machine.Annotations, map[string]string{v1alpha1.AnnotationRetainInstance: "true"})
+
+			err := cloudProvider.Delete(ctx, machine)
+			Expect(corecloudproivder.IsMachineNotFoundError(err)).To(BeTrue())
+			Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+	})
+	Context("Fleet Errors", func() {
+		var machine *v1alpha5.Machine
+		BeforeEach(func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			machine = machineutil.New(&v1.Node{}, provisioner)
+		})
+		fleetError := func(code, message, instanceType, zone, subnetID string) *ec2.CreateFleetError {
+			return &ec2.CreateFleetError{
+				ErrorCode:    aws.String(code),
+				ErrorMessage: aws.String(message),
+				LaunchTemplateAndOverrides: &ec2.LaunchTemplateAndOverridesResponse{
+					Overrides: &ec2.FleetLaunchTemplateOverrides{
+						InstanceType:     aws.String(instanceType),
+						AvailabilityZone: aws.String(zone),
+						SubnetId:         aws.String(subnetID),
+					},
+				},
+			}
+		}
+		It("should include the instance type, zone and subnet of each failed override", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: []*ec2.CreateFleetError{
+				fleetError("InsufficientInstanceCapacity", "There is no capacity available.", "m5.large", "test-zone-1a", "subnet-test1"),
+				fleetError("InsufficientFreeAddressesInSubnet", "There are not enough free addresses in the subnet.", "m5.large", "test-zone-1b", "subnet-test2"),
+			}})
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("InsufficientInstanceCapacity: There is no capacity available. [m5.large in test-zone-1a (subnet-test1)]"))
+			Expect(err.Error()).To(ContainSubstring("InsufficientFreeAddressesInSubnet: There are not enough free addresses in the subnet. [m5.large in test-zone-1b (subnet-test2)]"))
+			Expect(awserrors.Codes(err)).To(ConsistOf("InsufficientInstanceCapacity", "InsufficientFreeAddressesInSubnet"))
+		})
+		It("should combine the overrides that failed with the same error", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: []*ec2.CreateFleetError{
+				fleetError("InsufficientInstanceCapacity", "There is no capacity available.", "m5.large", "test-zone-1a", "subnet-test1"),
+				fleetError("InsufficientInstanceCapacity", "There is no capacity available.", "c5.large", "test-zone-1a", "subnet-test1"),
+				fleetError("InsufficientInstanceCapacity", "There is no capacity available.", "m5.large", "test-zone-1a", "subnet-test1"),
+				fleetError("VcpuLimitExceeded", "You have requested more vCPU capacity than your current limit.", "m5.large", "test-zone-1b", "subnet-test2"),
+			}})
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("InsufficientInstanceCapacity: There is no capacity available. [m5.large in test-zone-1a (subnet-test1), c5.large in test-zone-1a (subnet-test1)]"))
+			Expect(err.Error()).To(ContainSubstring("VcpuLimitExceeded: You have requested more vCPU capacity than your current limit. [m5.large in test-zone-1b (subnet-test2)]"))
+			Expect(strings.Count(err.Error(), "InsufficientInstanceCapacity")).To(Equal(1))
+		})
+		It("should bound the number of overrides listed for an error", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: lo.Map([]string{"m5.large", "m5.xlarge", "m5.2xlarge", "c5.large", "c5.xlarge", "c5.2xlarge"}, func(instanceType string, _ int) *ec2.CreateFleetError {
+				return fleetError("InsufficientInstanceCapacity", "There is no capacity available.", instanceType, "test-zone-1a", "subnet-test1")
+			})})
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("c5.xlarge in test-zone-1a (subnet-test1), ...]"))
+			Expect(err.Error()).ToNot(ContainSubstring("c5.2xlarge"))
+		})
+		It("should report errors without overrides", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: []*ec2.CreateFleetError{{
+				ErrorCode:    aws.String("InvalidParameterValue"),
+				ErrorMessage: aws.String("The parameter is invalid."),
+			}}})
+			_, err := cloudProvider.Create(ctx, machine)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("InvalidParameterValue: The parameter is invalid."))
+			Expect(err.Error()).ToNot(ContainSubstring("["))
+		})
+	})
+	Context("Launch Failure Metrics", func() {
+		fleetError := func(code string) *ec2.CreateFleetError {
+			return &ec2.CreateFleetError{
+				ErrorCode:    aws.String(code),
+				ErrorMessage: aws.String(code),
+				LaunchTemplateAndOverrides: &ec2.LaunchTemplateAndOverridesResponse{
+					Overrides: &ec2.FleetLaunchTemplateOverrides{
+						InstanceType:     aws.String("m5.large"),
+						AvailabilityZone: aws.String("test-zone-1a"),
+					},
+				},
+			}
+		}
+		expectLaunchFailure := func(reason string) {
+			before := launchFailures(reason)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			ExpectWithOffset(1, launchFailures(reason)).To(Equal(before + 1))
+		}
+		It("should count insufficient capacity errors", func() {
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"m5.large"}},
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"}},
+			}
+			awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{{CapacityType: v1alpha5.CapacityTypeOnDemand, InstanceType: "m5.large", Zone: "test-zone-1a"}})
+			expectLaunchFailure("insufficient-capacity")
+		})
+		It("should count unauthorized errors", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Error.Set(awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil))
+			expectLaunchFailure("unauthorized")
+		})
+		It("should count throttling errors", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Error.Set(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil))
+			expectLaunchFailure("throttled")
+		})
+		It("should count quota errors", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: []*ec2.CreateFleetError{fleetError("VcpuLimitExceeded")}})
+			expectLaunchFailure("quota-exceeded")
+		})
+		It("should prefer quota errors over insufficient capacity errors when fleet returns both", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{Errors: []*ec2.CreateFleetError{
+				fleetError("InsufficientInstanceCapacity"),
+				fleetError("VcpuLimitExceeded"),
+			}})
+			expectLaunchFailure("quota-exceeded")
+		})
+		It("should count other errors", func() {
+			awsEnv.EC2API.CreateFleetBehavior.Error.Set(fmt.Errorf("CreateFleet synthetic error"))
+			expectLaunchFailure("other")
+		})
+	})
 })
+
+func launchFailures(reason string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != "karpenter_cloudprovider_instance_launch_failures_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "reason" && label.GetValue() == reason {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// eventuallyConsistentEC2API doesn't find instances that are described by ID until notFound describes have missed
+// them, like DescribeInstances right after the instances were launched
+type eventuallyConsistentEC2API struct {
+	*fake.EC2API
+	notFound atomic.Int32
+}
+
+func (e *eventuallyConsistentEC2API) DescribeInstancesWithContext(ctx context.Context, input *ec2.DescribeInstancesInput, opts ...request.Option) (*ec2.DescribeInstancesOutput, error) {
+	if e.inconsistent(input) {
+		return nil, awserr.New("InvalidInstanceID.NotFound", "The instance ID does not exist", nil)
+	}
+	return e.EC2API.DescribeInstancesWithContext(ctx, input, opts...)
+}
+
+func (e *eventuallyConsistentEC2API) DescribeInstancesPagesWithContext(ctx context.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, opts ...request.Option) error {
+	if e.inconsistent(input) {
+		return awserr.New("InvalidInstanceID.NotFound", "The instance ID does not exist", nil)
+	}
+	return e.EC2API.DescribeInstancesPagesWithContext(ctx, input, fn, opts...)
+}
+
+func (e *eventuallyConsistentEC2API) inconsistent(input *ec2.DescribeInstancesInput) bool {
+	if len(input.InstanceIds) == 0 {
+		return false
+	}
+	for {
+		n := e.notFound.Load()
+		if n <= 0 {
+			return false
+		}
+		if e.notFound.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// blockingEC2API holds DescribeInstances listings until it's released so that concurrent listings overlap
+type blockingEC2API struct {
+	*fake.EC2API
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingEC2API) DescribeInstancesPagesWithContext(ctx context.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, opts ...request.Option) error {
+	b.calls.Add(1)
+	<-b.release
+	// Like the SDK, fail requests whose context is done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.EC2API.DescribeInstancesPagesWithContext(ctx, input, fn, opts...)
+}
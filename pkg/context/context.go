@@ -32,6 +32,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
@@ -45,13 +46,18 @@ import (
 	"github.com/aws/karpenter/pkg/apis/settings"
 	awscache "github.com/aws/karpenter/pkg/cache"
 	"github.com/aws/karpenter/pkg/providers/amifamily"
+	"github.com/aws/karpenter/pkg/providers/capacityreservation"
 	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/providers/instanceprofile"
 	"github.com/aws/karpenter/pkg/providers/instancetype"
 	"github.com/aws/karpenter/pkg/providers/launchtemplate"
 	"github.com/aws/karpenter/pkg/providers/pricing"
 	"github.com/aws/karpenter/pkg/providers/securitygroup"
 	"github.com/aws/karpenter/pkg/providers/subnet"
+	"github.com/aws/karpenter/pkg/utils/backoff"
 	"github.com/aws/karpenter/pkg/utils/project"
+	"github.com/aws/karpenter/pkg/utils/ratelimit"
+	"github.com/aws/karpenter/pkg/utils/tracing"
 
 	"github.com/aws/karpenter-core/pkg/cloudprovider"
 )
@@ -60,33 +66,47 @@ import (
 type Context struct {
 	cloudprovider.Context
 
-	Session                   *session.Session
-	UnavailableOfferingsCache *awscache.UnavailableOfferings
-	EC2API                    ec2iface.EC2API
-	SubnetProvider            *subnet.Provider
-	SecurityGroupProvider     *securitygroup.Provider
-	AMIProvider               *amifamily.Provider
-	AMIResolver               *amifamily.Resolver
-	LaunchTemplateProvider    *launchtemplate.Provider
-	PricingProvider           *pricing.Provider
-	InstanceTypesProvider     *instancetype.Provider
-	InstanceProvider          *instance.Provider
+	Session                     *session.Session
+	UnavailableOfferingsCache   *awscache.UnavailableOfferings
+	EC2API                      ec2iface.EC2API
+	SubnetProvider              *subnet.Provider
+	SecurityGroupProvider       *securitygroup.Provider
+	CapacityReservationProvider *capacityreservation.Provider
+	InstanceProfileProvider     *instanceprofile.Provider
+	AMIProvider                 *amifamily.Provider
+	AMIResolver                 *amifamily.Resolver
+	LaunchTemplateProvider      *launchtemplate.Provider
+	PricingProvider             *pricing.Provider
+	InstanceTypesProvider       *instancetype.Provider
+	InstanceProvider            *instance.Provider
+}
+
+// SessionConfig returns the config of the session that every AWS client is created from
+func SessionConfig() *aws.Config {
+	return request.WithRetryer(
+		&aws.Config{STSRegionalEndpoint: endpoints.RegionalSTSEndpoint},
+		client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries},
+	)
+}
+
+// NewEC2API returns the EC2 client that every provider shares. Its calls are retried with the backoff configured through
+// settings instead of the retryer of the session, and they're rate limited against a single budget.
+func NewEC2API(ctx context.Context, sess *session.Session) *ec2.EC2 {
+	ec2api := ec2.New(sess, request.WithRetryer(aws.NewConfig(), backoff.NewRetryer(ctx)))
+	ratelimit.WithRateLimiter(&ec2api.Handlers, ratelimit.FromContext(ctx))
+	tracing.WithTracing(ctx, &ec2api.Handlers)
+	return ec2api
 }
 
 func NewOrDie(ctx cloudprovider.Context) Context {
 	ctx.Context = logging.WithLogger(ctx, logging.FromContext(ctx).Named("aws"))
-	sess := withUserAgent(session.Must(session.NewSession(
-		request.WithRetryer(
-			&aws.Config{STSRegionalEndpoint: endpoints.RegionalSTSEndpoint},
-			client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries},
-		),
-	)))
+	sess := withUserAgent(session.Must(session.NewSession(SessionConfig())))
 	if *sess.Config.Region == "" {
 		logging.FromContext(ctx).Debug("retrieving region from IMDS")
 		region, err := ec2metadata.New(sess).Region()
 		*sess.Config.Region = lo.Must(region, err, "failed to get region from metadata server")
 	}
-	ec2api := ec2.New(sess)
+	ec2api := NewEC2API(ctx, sess)
 	if err := checkEC2Connectivity(ctx, ec2api); err != nil {
 		logging.FromContext(ctx).Fatalf("Checking EC2 API connectivity, %s", err)
 	}
@@ -108,17 +128,21 @@ func NewOrDie(ctx cloudprovider.Context) Context {
 	}
 
 	unavailableOfferingsCache := awscache.NewUnavailableOfferings()
-	subnetProvider := subnet.NewProvider(ec2api, cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
-	securityGroupProvider := securitygroup.NewProvider(ec2api, cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
+	subnetProvider := subnet.NewProvider(ec2api, cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval),
+		cache.New(awscache.ZonePlacementTTL, awscache.DefaultCleanupInterval))
+	securityGroupProvider := securitygroup.NewProvider(ec2api, subnetProvider, cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
+	capacityReservationProvider := capacityreservation.NewProvider(ec2api, cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
+	instanceProfileProvider := instanceprofile.NewProvider(iam.New(sess), cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
 	pricingProvider := pricing.NewProvider(
 		ctx,
+		ctx.Clock,
 		pricing.NewAPI(sess, *sess.Config.Region),
 		ec2api,
 		*sess.Config.Region,
 		ctx.StartAsync,
 	)
 	amiProvider := amifamily.NewProvider(ctx.KubeClient, ctx.KubernetesInterface, ssm.New(sess), ec2api,
-		cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval), cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval), cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
+		cache.New(settings.FromContext(ctx).AMICacheTTL, awscache.DefaultCleanupInterval), cache.New(settings.FromContext(ctx).AMICacheTTL, awscache.DefaultCleanupInterval), cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval))
 	amiResolver := amifamily.New(ctx.KubeClient, amiProvider)
 	launchTemplateProvider := launchtemplate.NewProvider(
 		ctx,
@@ -126,6 +150,8 @@ func NewOrDie(ctx cloudprovider.Context) Context {
 		ec2api,
 		amiResolver,
 		securityGroupProvider,
+		subnetProvider,
+		instanceProfileProvider,
 		lo.Must(getCABundle(ctx.RESTConfig)),
 		ctx.StartAsync,
 		kubeDNSIP,
@@ -139,6 +165,8 @@ func NewOrDie(ctx cloudprovider.Context) Context {
 		unavailableOfferingsCache,
 		pricingProvider,
 	)
+	// Pre-populate the instance types so that the first provisioning decisions after a cold start are fast
+	go instanceTypeProvider.WarmUp(ctx)
 	instanceProvider := instance.NewProvider(
 		ctx,
 		aws.StringValue(sess.Config.Region),
@@ -147,21 +175,24 @@ func NewOrDie(ctx cloudprovider.Context) Context {
 		instanceTypeProvider,
 		subnetProvider,
 		launchTemplateProvider,
+		capacityReservationProvider,
 	)
 
 	return Context{
-		Context:                   ctx,
-		Session:                   sess,
-		UnavailableOfferingsCache: unavailableOfferingsCache,
-		EC2API:                    ec2api,
-		SubnetProvider:            subnetProvider,
-		SecurityGroupProvider:     securityGroupProvider,
-		AMIProvider:               amiProvider,
-		AMIResolver:               amiResolver,
-		LaunchTemplateProvider:    launchTemplateProvider,
-		PricingProvider:           pricingProvider,
-		InstanceTypesProvider:     instanceTypeProvider,
-		InstanceProvider:          instanceProvider,
+		Context:                     ctx,
+		Session:                     sess,
+		UnavailableOfferingsCache:   unavailableOfferingsCache,
+		EC2API:                      ec2api,
+		SubnetProvider:              subnetProvider,
+		SecurityGroupProvider:       securityGroupProvider,
+		CapacityReservationProvider: capacityReservationProvider,
+		InstanceProfileProvider:     instanceProfileProvider,
+		AMIProvider:                 amiProvider,
+		AMIResolver:                 amiResolver,
+		LaunchTemplateProvider:      launchTemplateProvider,
+		PricingProvider:             pricingProvider,
+		InstanceTypesProvider:       instanceTypeProvider,
+		InstanceProvider:            instanceProvider,
 	}
 }
 
@@ -18,7 +18,14 @@ import (
 	"context"
 	"errors"
 	"testing"
-
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/eks"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -107,4 +114,27 @@ var _ = Describe("Context", func() {
 		_, err := awscontext.ResolveClusterEndpoint(ctx, fakeEKSAPI)
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("should make the configured number of attempts for a throttled EC2 call", func() {
+		retryCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			EC2RetryMaxAttempts: lo.ToPtr[int64](3),
+			EC2RetryBaseDelay:   lo.ToPtr(time.Millisecond),
+			EC2RetryMaxDelay:    lo.ToPtr(time.Millisecond),
+		}))
+		sess := session.Must(session.NewSession(awscontext.SessionConfig(), &aws.Config{
+			Region:      aws.String("us-west-2"),
+			Credentials: credentials.AnonymousCredentials,
+		}))
+		ec2api := awscontext.NewEC2API(retryCtx, sess)
+		// Every attempt that reaches the network is throttled
+		attempts := 0
+		ec2api.Handlers.Send.Clear()
+		ec2api.Handlers.Send.PushBack(func(r *request.Request) {
+			attempts++
+			r.Error = awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+		})
+		_, err := ec2api.DescribeInstancesWithContext(retryCtx, &ec2.DescribeInstancesInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(attempts).To(Equal(3))
+	})
 })
@@ -15,27 +15,45 @@ limitations under the License.
 package controllers
 
 import (
-	"github.com/aws/aws-sdk-go/service/sqs"
 	"knative.dev/pkg/logging"
 
 	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/cloudprovider"
 	awscontext "github.com/aws/karpenter/pkg/context"
+	"github.com/aws/karpenter/pkg/controllers/instanceprofile"
+	"github.com/aws/karpenter/pkg/controllers/instancetype"
 	"github.com/aws/karpenter/pkg/controllers/interruption"
+	"github.com/aws/karpenter/pkg/controllers/launchtemplate"
+	"github.com/aws/karpenter/pkg/controllers/machine/drift"
+	"github.com/aws/karpenter/pkg/controllers/machine/expiration"
+	"github.com/aws/karpenter/pkg/controllers/machine/registration"
+	"github.com/aws/karpenter/pkg/controllers/machine/stale"
+	"github.com/aws/karpenter/pkg/controllers/machine/tagging"
 	"github.com/aws/karpenter/pkg/controllers/nodetemplate"
 	"github.com/aws/karpenter/pkg/utils/project"
 
 	"github.com/aws/karpenter-core/pkg/operator/controller"
 )
 
-func NewControllers(ctx awscontext.Context, cloudProvider *cloudprovider.CloudProvider) []controller.Controller {
+func NewControllers(ctx awscontext.Context, cloudProvider *cloudprovider.CloudProvider, sqsProvider *interruption.SQSProvider) []controller.Controller {
 	logging.FromContext(ctx).With("version", project.Version).Debugf("discovered version")
 
 	controllers := []controller.Controller{
-		nodetemplate.NewController(ctx.KubeClient, ctx.SubnetProvider, ctx.SecurityGroupProvider),
+		nodetemplate.NewController(ctx.KubeClient, ctx.SubnetProvider, ctx.SecurityGroupProvider, ctx.InstanceProfileProvider),
+		tagging.NewController(ctx.KubeClient, ctx.InstanceProvider),
+		registration.NewController(ctx.KubeClient, ctx.Clock),
+		instancetype.NewController(ctx.InstanceTypesProvider),
+		launchtemplate.NewController(ctx.LaunchTemplateProvider),
+		instanceprofile.NewController(ctx.KubeClient, ctx.InstanceProvider, ctx.InstanceProfileProvider),
+		expiration.NewController(ctx.KubeClient, ctx.Clock, ctx.InstanceProvider),
+		drift.NewController(ctx.KubeClient, cloudProvider),
+		stale.NewController(ctx.KubeClient, ctx.Clock, cloudProvider),
 	}
 	if settings.FromContext(ctx).InterruptionQueueName != "" {
-		controllers = append(controllers, interruption.NewController(ctx.KubeClient, ctx.Clock, ctx.EventRecorder, interruption.NewSQSProvider(sqs.New(ctx.Session)), ctx.UnavailableOfferingsCache))
+		controllers = append(controllers,
+			interruption.NewController(ctx.KubeClient, ctx.Clock, ctx.EventRecorder, sqsProvider, ctx.UnavailableOfferingsCache),
+			interruption.NewHealthController(sqsProvider),
+		)
 	}
 	return controllers
 }
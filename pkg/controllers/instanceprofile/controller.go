@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instanceprofile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/providers/instanceprofile"
+)
+
+// GracePeriod is how long an instance profile is kept after it's created, so that a profile created for a node template
+// that was just applied isn't deleted before the node template is observed
+const GracePeriod = 10 * time.Minute
+
+// Controller periodically deletes the instance profiles owned by node templates of the cluster that no longer exist,
+// when aws.enableInstanceProfileCleanup is set. Profiles that are still used by an instance, managed by Karpenter or
+// not, are kept until the instance is terminated.
+type Controller struct {
+	kubeClient              client.Client
+	instanceProvider        *instance.Provider
+	instanceProfileProvider *instanceprofile.Provider
+}
+
+func NewController(kubeClient client.Client, instanceProvider *instance.Provider, instanceProfileProvider *instanceprofile.Provider) *Controller {
+	return &Controller{
+		kubeClient:              kubeClient,
+		instanceProvider:        instanceProvider,
+		instanceProfileProvider: instanceProfileProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "instanceprofile.garbagecollection"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	if !settings.FromContext(ctx).EnableInstanceProfileCleanup {
+		return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+	}
+	nodeTemplateList := &v1alpha1.AWSNodeTemplateList{}
+	if err := c.kubeClient.List(ctx, nodeTemplateList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing node templates, %w", err)
+	}
+	nodeTemplates := sets.NewString(lo.Map(nodeTemplateList.Items, func(n v1alpha1.AWSNodeTemplate, _ int) string { return n.Name })...)
+	if _, err := c.instanceProfileProvider.DeleteOrphaned(ctx, nodeTemplates, c.instanceProvider.IsInstanceProfileInUse, GracePeriod); err != nil {
+		return reconcile.Result{}, fmt.Errorf("deleting orphaned instance profiles, %w", err)
+	}
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.NewSingletonManagedBy(m)
+}
@@ -0,0 +1,231 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instanceprofile_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/controllers/instanceprofile"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var awsEnv *test.Environment
+var controller *instanceprofile.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "InstanceProfileGarbageCollection")
+}
+
+var _ = BeforeSuite(func() {
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	awsEnv = test.NewEnvironment(ctx, env)
+
+	controller = instanceprofile.NewController(env.Client, awsEnv.InstanceProvider, awsEnv.InstanceProfileProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+		EnableInstanceProfileCleanup: lo.ToPtr(true),
+	}))
+	awsEnv.Reset()
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("InstanceProfileGarbageCollection", func() {
+	stale := time.Now().Add(-2 * instanceprofile.GracePeriod)
+	// profile returns an instance profile containing a role, tagged as managed by Karpenter for the cluster and owned by
+	// the node template
+	profile := func(name, clusterName, nodeTemplateName string, createDate time.Time) *iam.InstanceProfile {
+		return &iam.InstanceProfile{
+			InstanceProfileName: aws.String(name),
+			Arn:                 aws.String(fmt.Sprintf("arn:aws:iam::123456789012:instance-profile/%s", name)),
+			CreateDate:          aws.Time(createDate),
+			Roles:               []*iam.Role{{RoleName: aws.String(fmt.Sprintf("%s-role", name))}},
+			Tags: []*iam.Tag{
+				{Key: aws.String(v1alpha5.ManagedByLabelKey), Value: aws.String(clusterName)},
+				{Key: aws.String(v1alpha1.TagNodeTemplate), Value: aws.String(nodeTemplateName)},
+			},
+		}
+	}
+	storeProfiles := func(profiles ...*iam.InstanceProfile) {
+		awsEnv.IAMAPI.ListInstanceProfilesBehavior.Output.Set(&iam.ListInstanceProfilesOutput{InstanceProfiles: profiles})
+	}
+	deleted := func() []string {
+		var names []string
+		for awsEnv.IAMAPI.DeleteInstanceProfileBehavior.CalledWithInput.Len() > 0 {
+			names = append(names, aws.StringValue(awsEnv.IAMAPI.DeleteInstanceProfileBehavior.CalledWithInput.Pop().InstanceProfileName))
+		}
+		return names
+	}
+
+	It("should delete the instance profiles of node templates that no longer exist", func() {
+		storeProfiles(profile("orphaned", "test-cluster", "deleted", stale))
+		result, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+		Expect(deleted()).To(ConsistOf("orphaned"))
+	})
+	It("should keep orphaned instance profiles when cleanup is disabled", func() {
+		ctx = settings.ToContext(ctx, test.Settings())
+		storeProfiles(profile("orphaned", "test-cluster", "deleted", stale))
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(awsEnv.IAMAPI.ListInstanceProfilesBehavior.Calls()).To(Equal(0))
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should keep instance profiles that aren't managed by Karpenter", func() {
+		unmanaged := profile("unmanaged", "test-cluster", "deleted", stale)
+		unmanaged.Tags = append(lo.Reject(unmanaged.Tags, func(t *iam.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey }),
+			&iam.Tag{Key: aws.String("karpenter.k8s.aws/cluster"), Value: aws.String("test-cluster")})
+		storeProfiles(unmanaged)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should remove the roles of an instance profile before deleting it", func() {
+		storeProfiles(profile("orphaned", "test-cluster", "deleted", stale))
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(awsEnv.IAMAPI.RemoveRoleFromInstanceProfileBehavior.CalledWithInput.Len()).To(Equal(1))
+		input := awsEnv.IAMAPI.RemoveRoleFromInstanceProfileBehavior.CalledWithInput.Pop()
+		Expect(aws.StringValue(input.InstanceProfileName)).To(Equal("orphaned"))
+		Expect(aws.StringValue(input.RoleName)).To(Equal("orphaned-role"))
+	})
+	It("should keep the instance profiles of node templates that exist", func() {
+		nodeTemplate := test.AWSNodeTemplate()
+		ExpectApplied(ctx, env.Client, nodeTemplate)
+		storeProfiles(profile("owned", "test-cluster", nodeTemplate.Name, stale))
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	// storeInstance adds an instance that uses the instance profile to the fake EC2 API, with the tags
+	storeInstance := func(profile *iam.InstanceProfile, state string, tags ...*ec2.Tag) {
+		instanceID := fake.InstanceID()
+		awsEnv.EC2API.Instances.Store(instanceID, &ec2.Instance{
+			State:              &ec2.InstanceState{Name: aws.String(state)},
+			PrivateDnsName:     aws.String(fake.PrivateDNSName()),
+			Placement:          &ec2.Placement{AvailabilityZone: aws.String("test-zone-1a")},
+			Tags:               tags,
+			IamInstanceProfile: &ec2.IamInstanceProfile{Arn: profile.Arn},
+			InstanceId:         aws.String(instanceID),
+			InstanceType:       aws.String("m5.large"),
+		})
+	}
+
+	It("should keep instance profiles that are still used by an instance", func() {
+		referenced := profile("referenced", "test-cluster", "deleted", stale)
+		storeProfiles(referenced)
+		storeInstance(referenced, ec2.InstanceStateNameRunning,
+			&ec2.Tag{Key: aws.String("kubernetes.io/cluster/test-cluster"), Value: aws.String("owned")},
+			&ec2.Tag{Key: aws.String(v1alpha5.ProvisionerNameLabelKey), Value: aws.String("default")},
+		)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should keep instance profiles that are still used by an instance Karpenter no longer manages", func() {
+		referenced := profile("referenced", "test-cluster", "deleted", stale)
+		storeProfiles(referenced)
+		// Detached instances keep the cluster tag, but not the tags that identify them as launched by Karpenter
+		storeInstance(referenced, ec2.InstanceStateNameStopped,
+			&ec2.Tag{Key: aws.String("kubernetes.io/cluster/test-cluster"), Value: aws.String("owned")},
+		)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should delete instance profiles whose instances were terminated", func() {
+		orphaned := profile("orphaned", "test-cluster", "deleted", stale)
+		storeProfiles(orphaned)
+		storeInstance(orphaned, ec2.InstanceStateNameTerminated)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(ConsistOf("orphaned"))
+	})
+	It("should keep instance profiles when instances can't be described", func() {
+		storeProfiles(profile("orphaned", "test-cluster", "deleted", stale))
+		awsEnv.EC2API.DescribeInstancesBehavior.Error.Set(fmt.Errorf("failed"))
+		_, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).To(HaveOccurred())
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should keep instance profiles created within the grace period", func() {
+		storeProfiles(profile("recent", "test-cluster", "deleted", time.Now()))
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should keep instance profiles that belong to another cluster or aren't owned by a node template", func() {
+		unowned := profile("unowned", "test-cluster", "", stale)
+		unowned.Tags = lo.Reject(unowned.Tags, func(t *iam.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha1.TagNodeTemplate })
+		untagged := profile("untagged", "test-cluster", "deleted", stale)
+		untagged.Tags = nil
+		storeProfiles(profile("other", "other-cluster", "deleted", stale), unowned, untagged)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(deleted()).To(BeEmpty())
+	})
+	It("should only delete the orphaned instance profiles", func() {
+		storeProfiles(
+			profile("orphaned", "test-cluster", "deleted", stale),
+			profile("owned", "test-cluster", "existing", stale),
+			profile("referenced", "test-cluster", "deleted", stale),
+			profile("recent", "test-cluster", "deleted", time.Now()),
+		)
+		inUse := func(_ context.Context, arn string) (bool, error) {
+			return arn == "arn:aws:iam::123456789012:instance-profile/referenced", nil
+		}
+		deletedCount, err := awsEnv.InstanceProfileProvider.DeleteOrphaned(ctx, sets.NewString("existing"), inUse, instanceprofile.GracePeriod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deletedCount).To(Equal(1))
+		Expect(deleted()).To(ConsistOf("orphaned"))
+	})
+	It("should fail when instance profiles can't be listed", func() {
+		storeProfiles(profile("orphaned", "test-cluster", "deleted", stale))
+		awsEnv.IAMAPI.ListInstanceProfilesBehavior.Error.Set(fmt.Errorf("failed"))
+		_, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).To(HaveOccurred())
+		Expect(deleted()).To(BeEmpty())
+	})
+})
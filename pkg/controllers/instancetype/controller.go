@@ -0,0 +1,54 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/providers/instancetype"
+)
+
+// Controller periodically re-discovers the instance types from EC2 so that newly released instance types are offered
+// without restarting Karpenter
+type Controller struct {
+	instanceTypeProvider *instancetype.Provider
+}
+
+func NewController(instanceTypeProvider *instancetype.Provider) *Controller {
+	return &Controller{
+		instanceTypeProvider: instanceTypeProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "instancetype.refresh"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	if err := c.instanceTypeProvider.Refresh(ctx); err != nil {
+		return reconcile.Result{}, fmt.Errorf("refreshing instance types, %w", err)
+	}
+	return reconcile.Result{RequeueAfter: settings.FromContext(ctx).InstanceTypesRefreshInterval}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.NewSingletonManagedBy(m)
+}
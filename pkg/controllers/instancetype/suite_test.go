@@ -0,0 +1,215 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/controllers/instancetype"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var awsEnv *test.Environment
+var controller *instancetype.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "InstanceTypeRefresh")
+}
+
+var _ = BeforeSuite(func() {
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	awsEnv = test.NewEnvironment(ctx, env)
+
+	controller = instancetype.NewController(awsEnv.InstanceTypesProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+})
+
+var _ = Describe("InstanceTypeRefresh", func() {
+	var known []*ec2.InstanceTypeInfo
+	var released *ec2.InstanceTypeInfo
+	BeforeEach(func() {
+		var err error
+		known, err = awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		m5, ok := lo.Find(known, func(i *ec2.InstanceTypeInfo) bool { return aws.StringValue(i.InstanceType) == "m5.large" })
+		Expect(ok).To(BeTrue())
+		copied := *m5
+		copied.InstanceType = aws.String("m7i.large")
+		released = &copied
+	})
+	names := func(instanceTypes []*ec2.InstanceTypeInfo) []string {
+		return lo.Map(instanceTypes, func(i *ec2.InstanceTypeInfo, _ int) string { return aws.StringValue(i.InstanceType) })
+	}
+
+	It("should discover a newly released instance type after a refresh", func() {
+		awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: append(append([]*ec2.InstanceTypeInfo{}, known...), released)})
+
+		// the instance types that were already discovered are returned until the next refresh
+		instanceTypes, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(instanceTypes)).ToNot(ContainElement("m7i.large"))
+
+		result, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+
+		instanceTypes, err = awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(instanceTypes)).To(ContainElement("m7i.large"))
+		Expect(instanceTypes).To(HaveLen(len(known) + 1))
+		Expect(instanceTypesDiscovered()).To(BeNumerically("==", len(known)+1))
+	})
+	It("should keep known instance types that aren't returned by a refresh", func() {
+		awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: []*ec2.InstanceTypeInfo{released}})
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+
+		instanceTypes, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(instanceTypes)).To(ConsistOf(append(names(known), "m7i.large")))
+	})
+	It("should requeue at the configured refresh interval", func() {
+		ctx := settings.ToContext(ctx, test.Settings(test.SettingOptions{InstanceTypesRefreshInterval: lo.ToPtr(time.Hour)}))
+		result, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+	})
+	It("should keep the known instance types when a refresh fails", func() {
+		awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: []*ec2.InstanceTypeInfo{released}})
+		awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+		_, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).To(HaveOccurred())
+
+		instanceTypes, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(instanceTypes)).To(ConsistOf(names(known)))
+	})
+	It("should be safe to get instance types while refreshing", func() {
+		awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: []*ec2.InstanceTypeInfo{released}})
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(awsEnv.InstanceTypesProvider.Refresh(ctx)).To(Succeed())
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				instanceTypes, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(len(instanceTypes)).To(BeNumerically(">=", len(known)))
+			}()
+		}
+		wg.Wait()
+		instanceTypes, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names(instanceTypes)).To(ConsistOf(append(names(known), "m7i.large")))
+	})
+	Context("Offering Availability", func() {
+		It("should report available offerings", func() {
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeOnDemand)).To(BeNumerically("==", 1))
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)).To(BeNumerically("==", 1))
+		})
+		It("should report an offering that's suppressed by an insufficient capacity error as unavailable", func() {
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)).To(BeNumerically("==", 1))
+
+			awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", "m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)).To(BeNumerically("==", 0))
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeOnDemand)).To(BeNumerically("==", 1))
+			Expect(offeringAvailable("m5.large", "test-zone-1b", ec2.UsageClassTypeSpot)).To(BeNumerically("==", 1))
+
+			awsEnv.UnavailableOfferingsCache.Delete("m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeSpot)).To(BeNumerically("==", 1))
+		})
+		It("should report offerings in blocked zones as unavailable", func() {
+			ctx := settings.ToContext(ctx, test.Settings(test.SettingOptions{BlockedZones: []string{"test-zone-1b"}}))
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+			Expect(offeringAvailable("m5.large", "test-zone-1a", ec2.UsageClassTypeOnDemand)).To(BeNumerically("==", 1))
+			Expect(offeringAvailable("m5.large", "test-zone-1b", ec2.UsageClassTypeOnDemand)).To(BeNumerically("==", 0))
+		})
+	})
+})
+
+// instanceTypesDiscovered returns the value of the gauge of discovered instance types
+func instanceTypesDiscovered() float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == "karpenter_cloudprovider_instance_types_discovered" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// offeringAvailable returns the value of the offering availability gauge of an offering, or -1 if it isn't reported
+func offeringAvailable(instanceType, zone, capacityType string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != "karpenter_cloudprovider_instance_type_offering_available" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["instance_type"] == instanceType && labels["zone"] == zone && labels["capacity_type"] == capacityType {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return -1
+}
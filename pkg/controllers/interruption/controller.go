@@ -41,6 +41,7 @@ import (
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages/statechange"
 	"github.com/aws/karpenter/pkg/utils"
 
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	"github.com/aws/karpenter-core/pkg/events"
 	"github.com/aws/karpenter-core/pkg/metrics"
@@ -50,10 +51,14 @@ import (
 type Action string
 
 const (
-	CordonAndDrain Action = "CordonAndDrain"
-	NoAction       Action = "NoAction"
+	CordonAndDrain   Action = "CordonAndDrain"
+	CordonAndReplace Action = "CordonAndReplace"
+	NoAction         Action = "NoAction"
 )
 
+// spotInterruptionWarningDuration is the time between EC2 sending a spot interruption warning and interrupting the instance
+const spotInterruptionWarningDuration = 2 * time.Minute
+
 // Controller is an AWS interruption controller.
 // It continually polls an SQS queue for events from aws.ec2 and aws.health that
 // trigger node health events or node spot interruption/rebalance events.
@@ -106,6 +111,7 @@ func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconc
 			errs[i] = c.deleteMessage(ctx, sqsMessages[i])
 			return
 		}
+		c.warnIfLate(ctx, msg)
 		if e = c.handleMessage(ctx, instanceIDMap, msg); e != nil {
 			errs[i] = fmt.Errorf("handling message, %w", e)
 			return
@@ -164,6 +170,20 @@ func (c *Controller) handleMessage(ctx context.Context, instanceIDMap map[string
 	return nil
 }
 
+// warnIfLate logs when a spot interruption warning is handled with less than the configured lead time left before the
+// interruption, e.g. because it was delayed in the queue. Messages are always acted on as soon as they're received, the
+// lead time never delays draining.
+func (c *Controller) warnIfLate(ctx context.Context, msg messages.Message) {
+	if msg.Kind() != messages.SpotInterruptionKind {
+		return
+	}
+	remaining := msg.StartTime().Add(spotInterruptionWarningDuration).Sub(c.clk.Now())
+	if leadTime := settings.FromContext(ctx).SpotInterruptionLeadTime; remaining < leadTime {
+		logging.FromContext(ctx).With("messageKind", msg.Kind(), "remaining", remaining.Round(time.Second), "lead-time", leadTime).
+			Warnf("handling spot interruption warning with less than the lead time left before the interruption")
+	}
+}
+
 // deleteMessage removes the passed SQS message from the queue and fires a metric for the deletion
 func (c *Controller) deleteMessage(ctx context.Context, msg *sqsapi.Message) error {
 	if err := c.sqsProvider.DeleteSQSMessage(ctx, msg); err != nil {
@@ -175,7 +195,7 @@ func (c *Controller) deleteMessage(ctx context.Context, msg *sqsapi.Message) err
 
 // handleNode retrieves the action for the message and then performs the appropriate action against the node
 func (c *Controller) handleNode(ctx context.Context, msg messages.Message, node *v1.Node) error {
-	action := actionForMessage(msg)
+	action := actionForMessage(ctx, msg)
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("node", node.Name))
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("action", string(action)))
 
@@ -191,9 +211,31 @@ func (c *Controller) handleNode(ctx context.Context, msg messages.Message, node
 			c.unavailableOfferingsCache.MarkUnavailable(ctx, string(msg.Kind()), instanceType, zone, v1alpha1.CapacityTypeSpot)
 		}
 	}
-	if action != NoAction {
+	switch action {
+	case CordonAndDrain:
 		return c.deleteNode(ctx, node)
+	case CordonAndReplace:
+		return c.markForReplacement(ctx, msg, node)
+	default:
+		return nil
 	}
+}
+
+// markForReplacement cordons the node and annotates it so that it's reported as drifted. Drift replaces the node
+// before draining it, rather than draining it straight away like an interruption.
+func (c *Controller) markForReplacement(ctx context.Context, msg messages.Message, node *v1.Node) error {
+	if _, ok := node.Annotations[v1alpha1.AnnotationRebalanceRecommended]; ok && node.Spec.Unschedulable {
+		return nil
+	}
+	stored := node.DeepCopy()
+	node.Spec.Unschedulable = true
+	node.Annotations = lo.Assign(node.Annotations, map[string]string{
+		v1alpha1.AnnotationRebalanceRecommended: msg.StartTime().Format(time.RFC3339),
+	})
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return client.IgnoreNotFound(fmt.Errorf("marking the node for replacement on rebalance recommendation, %w", err))
+	}
+	logging.FromContext(ctx).Infof("marked node for replacement from rebalance recommendation")
 	return nil
 }
 
@@ -258,10 +300,16 @@ func (c *Controller) makeInstanceIDMap(ctx context.Context) (map[string]*v1.Node
 	return m, nil
 }
 
-func actionForMessage(msg messages.Message) Action {
+func actionForMessage(ctx context.Context, msg messages.Message) Action {
 	switch msg.Kind() {
 	case messages.ScheduledChangeKind, messages.SpotInterruptionKind, messages.StateChangeKind:
 		return CordonAndDrain
+	case messages.RebalanceRecommendationKind:
+		if !settings.FromContext(ctx).EnableRebalanceReplacement {
+			return NoAction
+		}
+		// Replacement relies on the drift deprovisioner, so fall back to the interruption path when drift is disabled
+		return lo.Ternary(coresettings.FromContext(ctx).DriftEnabled, CordonAndReplace, CordonAndDrain)
 	default:
 		return NoAction
 	}
@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package interruption
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	awserrors "github.com/aws/karpenter/pkg/errors"
+)
+
+const healthCheckInterval = 5 * time.Minute
+
+// HealthController periodically checks that the interruption queue exists and can be read. A misconfigured queue
+// otherwise goes unnoticed until an interruption isn't handled.
+type HealthController struct {
+	sqsProvider *SQSProvider
+}
+
+func NewHealthController(sqsProvider *SQSProvider) *HealthController {
+	return &HealthController{
+		sqsProvider: sqsProvider,
+	}
+}
+
+func (c *HealthController) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	queueName := settings.FromContext(ctx).InterruptionQueueName
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("queue", queueName))
+	if err := c.sqsProvider.CheckQueue(ctx); err != nil {
+		queueHealthy.Set(0)
+		logging.FromContext(ctx).Errorf("checking interruption queue, %s, %v", guidance(err), err)
+		return reconcile.Result{RequeueAfter: healthCheckInterval}, nil
+	}
+	queueHealthy.Set(1)
+	return reconcile.Result{RequeueAfter: healthCheckInterval}, nil
+}
+
+// guidance suggests the most likely fix for a failed queue check
+func guidance(err error) string {
+	codes := awserrors.Codes(err)
+	switch {
+	case awserrors.IsNotFound(err):
+		return "create the queue or set aws.interruptionQueueName to an existing queue in the controller's region"
+	case lo.SomeBy(codes, awserrors.IsUnauthorizedCode):
+		return "grant the controller's role sqs:GetQueueUrl, sqs:GetQueueAttributes, sqs:ReceiveMessage and sqs:DeleteMessage on the queue"
+	default:
+		return "verify that the controller can reach SQS"
+	}
+}
+
+func (c *HealthController) Name() string {
+	return "interruption.health"
+}
+
+func (c *HealthController) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.NewSingletonManagedBy(m)
+}
@@ -15,6 +15,11 @@ limitations under the License.
 package scheduledchange
 
 import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/samber/lo"
+
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages"
 )
 
@@ -26,12 +31,32 @@ type Message struct {
 	Detail Detail `json:"detail"`
 }
 
+// EC2InstanceIDs returns the IDs of the affected instances. Affected entities are usually instance IDs but may be
+// instance ARNs, and the resources of the event are used when it doesn't list any affected entities.
 func (m Message) EC2InstanceIDs() []string {
-	ids := make([]string, len(m.Detail.AffectedEntities))
-	for i, entity := range m.Detail.AffectedEntities {
-		ids[i] = entity.EntityValue
+	values := lo.Map(m.Detail.AffectedEntities, func(e AffectedEntity, _ int) string { return e.EntityValue })
+	if len(values) == 0 {
+		values = m.Resources
+	}
+	return lo.Uniq(lo.FilterMap(values, func(v string, _ int) (string, bool) {
+		id := instanceID(v)
+		return id, id != ""
+	}))
+}
+
+// instanceID returns the instance ID of an instance ID or instance ARN, or an empty string for any other entity
+func instanceID(value string) string {
+	if arn.IsARN(value) {
+		parsed, err := arn.Parse(value)
+		if err != nil || parsed.Service != "ec2" {
+			return ""
+		}
+		value = strings.TrimPrefix(parsed.Resource, "instance/")
+	}
+	if !strings.HasPrefix(value, "i-") {
+		return ""
 	}
-	return ids
+	return value
 }
 
 func (Message) Kind() messages.Kind {
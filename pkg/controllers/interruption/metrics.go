@@ -64,8 +64,16 @@ var (
 		},
 		[]string{actionTypeLabel},
 	)
+	queueHealthy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: interruptionSubsystem,
+			Name:      "queue_healthy",
+			Help:      "Whether the last check of the SQS queue succeeded. 1 if the queue exists and can be read, 0 otherwise.",
+		},
+	)
 )
 
 func init() {
-	crmetrics.Registry.MustRegister(receivedMessages, deletedMessages, messageLatency, actionsPerformed)
+	crmetrics.Registry.MustRegister(receivedMessages, deletedMessages, messageLatency, actionsPerformed, queueHealthy)
 }
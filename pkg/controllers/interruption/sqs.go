@@ -18,6 +18,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sync"
 	syncatomic "sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -35,6 +37,9 @@ type SQSProvider struct {
 
 	queueURL  atomic.Lazy[string]
 	queueName syncatomic.Pointer[string]
+
+	mu        sync.RWMutex
+	healthErr error
 }
 
 func NewSQSProvider(client sqsiface.SQSAPI) *SQSProvider {
@@ -65,6 +70,43 @@ func (s *SQSProvider) QueueExists(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
+// CheckQueue verifies that the queue exists and that its attributes can be read. The result is recorded so that it's
+// reported by ReadinessProbe.
+func (s *SQSProvider) CheckQueue(ctx context.Context) error {
+	err := s.checkQueue(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthErr = err
+	return err
+}
+
+func (s *SQSProvider) checkQueue(ctx context.Context) error {
+	queueURL, err := s.queueURL.TryGet(ctx, atomic.IgnoreCacheOption)
+	if err != nil {
+		return err
+	}
+	s.queueName.Store(lo.ToPtr(settings.FromContext(ctx).InterruptionQueueName))
+	input := &sqs.GetQueueAttributesInput{
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+		QueueUrl:       aws.String(queueURL),
+	}
+	if _, err = s.client.GetQueueAttributesWithContext(ctx, input); err != nil {
+		return fmt.Errorf("getting queue attributes, %w", err)
+	}
+	return nil
+}
+
+// ReadinessProbe fails if the last queue check failed. It passes before the queue has been checked, since the queue is
+// only checked by the leader.
+func (s *SQSProvider) ReadinessProbe(_ *http.Request) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.healthErr != nil {
+		return fmt.Errorf("checking interruption queue, %w", s.healthErr)
+	}
+	return nil
+}
+
 func (s *SQSProvider) DiscoverQueueURL(ctx context.Context) (string, error) {
 	if settings.FromContext(ctx).InterruptionQueueName != lo.FromPtr(s.queueName.Load()) {
 		res, err := s.queueURL.TryGet(ctx, atomic.IgnoreCacheOption)
@@ -145,4 +187,7 @@ func (s *SQSProvider) DeleteSQSMessage(ctx context.Context, msg *sqs.Message) er
 func (s *SQSProvider) Reset() {
 	s.queueURL.Set("")
 	s.queueName.Store(nil)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthErr = nil
 }
@@ -36,6 +36,7 @@ import (
 	. "knative.dev/pkg/logging/testing"
 	_ "knative.dev/pkg/system/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
@@ -49,6 +50,7 @@ import (
 	awscache "github.com/aws/karpenter/pkg/cache"
 	"github.com/aws/karpenter/pkg/controllers/interruption"
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages"
+	"github.com/aws/karpenter/pkg/controllers/interruption/messages/rebalancerecommendation"
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages/scheduledchange"
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages/spotinterruption"
 	"github.com/aws/karpenter/pkg/controllers/interruption/messages/statechange"
@@ -98,6 +100,7 @@ var _ = BeforeEach(func() {
 	ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
 		InterruptionQueueName: lo.ToPtr("test-cluster"),
 	}))
+	fakeClock.SetTime(time.Now())
 	unavailableOfferingsCache.Flush()
 	sqsapi.Reset()
 	sqsProvider.Reset()
@@ -143,6 +146,52 @@ var _ = Describe("AWSInterruption", func() {
 			ExpectNotFound(ctx, env.Client, node)
 			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
 		})
+		It("should delete the node when a scheduled change lists the instance ARN as the affected entity", func() {
+			node := coretest.Node(coretest.NodeOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: "default",
+					},
+				},
+				ProviderID: fake.ProviderID(defaultInstanceID),
+			})
+			msg := scheduledChangeMessage(defaultInstanceID)
+			msg.Detail.AffectedEntities = []scheduledchange.AffectedEntity{
+				{EntityValue: fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", defaultRegion, defaultAccountID, defaultInstanceID)},
+			}
+			ExpectMessagesCreated(msg)
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+		It("should delete the node using the event resources when a scheduled change has no affected entities", func() {
+			node := coretest.Node(coretest.NodeOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: "default",
+					},
+				},
+				ProviderID: fake.ProviderID(defaultInstanceID),
+			})
+			msg := scheduledChangeMessage(defaultInstanceID)
+			msg.Detail.AffectedEntities = nil
+			msg.Resources = []string{fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", defaultRegion, defaultAccountID, defaultInstanceID)}
+			ExpectMessagesCreated(msg)
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+		})
+		It("should ignore affected entities of a scheduled change that aren't instances", func() {
+			msg := scheduledChangeMessage(defaultInstanceID)
+			msg.Detail.AffectedEntities = append(msg.Detail.AffectedEntities,
+				scheduledchange.AffectedEntity{EntityValue: "vol-0123456789abcdef0"},
+				scheduledchange.AffectedEntity{EntityValue: fmt.Sprintf("arn:aws:ec2:%s:%s:volume/vol-0123456789abcdef0", defaultRegion, defaultAccountID)},
+			)
+			Expect(msg.EC2InstanceIDs()).To(ConsistOf(defaultInstanceID))
+		})
 		It("should delete the node when receiving a state change message", func() {
 			var nodes []*v1.Node
 			var messages []interface{}
@@ -262,6 +311,127 @@ var _ = Describe("AWSInterruption", func() {
 			Expect(unavailableOfferingsCache.IsUnavailable("t3.large", "coretest-zone-1a", v1alpha1.CapacityTypeSpot)).To(BeTrue())
 		})
 	})
+	Context("Rebalance Recommendations", func() {
+		var node *v1.Node
+		BeforeEach(func() {
+			node = coretest.Node(coretest.NodeOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: "default",
+					},
+				},
+				ProviderID: fake.ProviderID(defaultInstanceID),
+			})
+		})
+		It("should not act on the node when replacement is disabled", func() {
+			ExpectMessagesCreated(rebalanceRecommendationMessage(defaultInstanceID))
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			node = ExpectNodeExists(ctx, env.Client, node.Name)
+			Expect(node.Spec.Unschedulable).To(BeFalse())
+			Expect(node.Annotations).ToNot(HaveKey(v1alpha1.AnnotationRebalanceRecommended))
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+		It("should cordon and mark the node for replacement rather than deleting it", func() {
+			ctx = coresettings.ToContext(ctx, coretest.Settings(coresettings.Settings{DriftEnabled: true}))
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InterruptionQueueName:      lo.ToPtr("test-cluster"),
+				EnableRebalanceReplacement: lo.ToPtr(true),
+			}))
+			ExpectMessagesCreated(rebalanceRecommendationMessage(defaultInstanceID))
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			node = ExpectNodeExists(ctx, env.Client, node.Name)
+			Expect(node.DeletionTimestamp.IsZero()).To(BeTrue())
+			Expect(node.Spec.Unschedulable).To(BeTrue())
+			Expect(node.Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationRebalanceRecommended, fakeClock.Now().Format(time.RFC3339)))
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+		It("should delete the node when replacement is enabled but drift is disabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InterruptionQueueName:      lo.ToPtr("test-cluster"),
+				EnableRebalanceReplacement: lo.ToPtr(true),
+			}))
+			ExpectMessagesCreated(rebalanceRecommendationMessage(defaultInstanceID))
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+		It("should still delete the node when the rebalance recommendation is followed by an interruption", func() {
+			ctx = coresettings.ToContext(ctx, coretest.Settings(coresettings.Settings{DriftEnabled: true}))
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InterruptionQueueName:      lo.ToPtr("test-cluster"),
+				EnableRebalanceReplacement: lo.ToPtr(true),
+			}))
+			ExpectMessagesCreated(rebalanceRecommendationMessage(defaultInstanceID))
+			ExpectApplied(ctx, env.Client, node)
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNodeExists(ctx, env.Client, node.Name)
+
+			ExpectMessagesCreated(spotInterruptionMessage(defaultInstanceID))
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+		})
+	})
+	Context("Spot Interruption Lead Time", func() {
+		var node *v1.Node
+		BeforeEach(func() {
+			node = coretest.Node(coretest.NodeOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						v1alpha5.ProvisionerNameLabelKey: "default",
+					},
+				},
+				ProviderID: fake.ProviderID(defaultInstanceID),
+			})
+		})
+		DescribeTable("should delete the node as soon as the spot interruption warning is received, whatever the lead time",
+			func(leadTime time.Duration) {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					InterruptionQueueName:    lo.ToPtr("test-cluster"),
+					SpotInterruptionLeadTime: lo.ToPtr(leadTime),
+				}))
+				ExpectMessagesCreated(spotInterruptionMessage(defaultInstanceID))
+				ExpectApplied(ctx, env.Client, node)
+
+				ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+				ExpectNotFound(ctx, env.Client, node)
+				Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+			},
+			Entry("without a lead time", time.Duration(0)),
+			Entry("with a short lead time", 30*time.Second),
+			Entry("with a long lead time", 119*time.Second),
+		)
+		It("should delete the node when the spot interruption warning is received later than the lead time", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InterruptionQueueName:    lo.ToPtr("test-cluster"),
+				SpotInterruptionLeadTime: lo.ToPtr(time.Minute),
+			}))
+			ExpectMessagesCreated(spotInterruptionMessage(defaultInstanceID))
+			ExpectApplied(ctx, env.Client, node)
+
+			fakeClock.Step(time.Second * 90)
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+		It("should delete the node immediately for messages other than spot interruption warnings", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InterruptionQueueName:    lo.ToPtr("test-cluster"),
+				SpotInterruptionLeadTime: lo.ToPtr(30 * time.Second),
+			}))
+			ExpectMessagesCreated(stateChangeMessage(defaultInstanceID, "terminated"))
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
+			ExpectNotFound(ctx, env.Client, node)
+			Expect(sqsapi.DeleteMessageBehavior.SuccessfulCalls()).To(Equal(1))
+		})
+	})
 	Context("Error Handling", func() {
 		It("should send an error on polling when QueueNotExists", func() {
 			sqsapi.ReceiveMessageBehavior.Error.Set(awsErrWithCode(sqs.ErrCodeQueueDoesNotExist), fake.MaxCalls(0))
@@ -276,6 +446,43 @@ var _ = Describe("AWSInterruption", func() {
 			ExpectReconcileSucceeded(ctx, controller, types.NamespacedName{})
 		})
 	})
+	Context("Queue Health", func() {
+		var healthController *interruption.HealthController
+		BeforeEach(func() {
+			healthController = interruption.NewHealthController(sqsProvider)
+		})
+		It("should be ready before the queue has been checked", func() {
+			Expect(sqsProvider.ReadinessProbe(nil)).To(Succeed())
+		})
+		It("should be ready when the queue exists", func() {
+			ExpectReconcileSucceeded(ctx, healthController, types.NamespacedName{})
+			Expect(sqsProvider.ReadinessProbe(nil)).To(Succeed())
+			Expect(sqsapi.GetQueueAttributesBehavior.SuccessfulCalls()).To(Equal(1))
+			Expect(queueHealthy()).To(BeNumerically("==", 1))
+		})
+		It("should not be ready when the queue doesn't exist", func() {
+			sqsapi.GetQueueURLBehavior.Error.Set(awsErrWithCode(sqs.ErrCodeQueueDoesNotExist), fake.MaxCalls(0))
+			ExpectReconcileSucceeded(ctx, healthController, types.NamespacedName{})
+			Expect(sqsProvider.ReadinessProbe(nil)).ToNot(Succeed())
+			Expect(queueHealthy()).To(BeNumerically("==", 0))
+		})
+		It("should not be ready when the queue attributes can't be read", func() {
+			sqsapi.GetQueueAttributesBehavior.Error.Set(awsErrWithCode("AccessDenied"), fake.MaxCalls(0))
+			ExpectReconcileSucceeded(ctx, healthController, types.NamespacedName{})
+			Expect(sqsProvider.ReadinessProbe(nil)).ToNot(Succeed())
+			Expect(queueHealthy()).To(BeNumerically("==", 0))
+		})
+		It("should become ready again once the queue is fixed", func() {
+			sqsapi.GetQueueURLBehavior.Error.Set(awsErrWithCode(sqs.ErrCodeQueueDoesNotExist), fake.MaxCalls(0))
+			ExpectReconcileSucceeded(ctx, healthController, types.NamespacedName{})
+			Expect(sqsProvider.ReadinessProbe(nil)).ToNot(Succeed())
+
+			sqsapi.GetQueueURLBehavior.Reset()
+			ExpectReconcileSucceeded(ctx, healthController, types.NamespacedName{})
+			Expect(sqsProvider.ReadinessProbe(nil)).To(Succeed())
+			Expect(queueHealthy()).To(BeNumerically("==", 1))
+		})
+	})
 })
 
 func ExpectMessagesCreated(messages ...interface{}) {
@@ -292,6 +499,17 @@ func ExpectMessagesCreated(messages ...interface{}) {
 	)
 }
 
+func queueHealthy() float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == "karpenter_interruption_queue_healthy" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
 func awsErrWithCode(code string) awserr.Error {
 	return awserr.New(code, "", fmt.Errorf(""))
 }
@@ -308,7 +526,7 @@ func spotInterruptionMessage(involvedInstanceID string) spotinterruption.Message
 				fmt.Sprintf("arn:aws:ec2:%s:instance/%s", defaultRegion, involvedInstanceID),
 			},
 			Source: ec2Source,
-			Time:   time.Now(),
+			Time:   fakeClock.Now(),
 		},
 		Detail: spotinterruption.Detail{
 			InstanceID:     involvedInstanceID,
@@ -317,6 +535,26 @@ func spotInterruptionMessage(involvedInstanceID string) spotinterruption.Message
 	}
 }
 
+func rebalanceRecommendationMessage(involvedInstanceID string) rebalancerecommendation.Message {
+	return rebalancerecommendation.Message{
+		Metadata: messages.Metadata{
+			Version:    "0",
+			Account:    defaultAccountID,
+			DetailType: "EC2 Instance Rebalance Recommendation",
+			ID:         string(uuid.NewUUID()),
+			Region:     defaultRegion,
+			Resources: []string{
+				fmt.Sprintf("arn:aws:ec2:%s:instance/%s", defaultRegion, involvedInstanceID),
+			},
+			Source: ec2Source,
+			Time:   fakeClock.Now(),
+		},
+		Detail: rebalancerecommendation.Detail{
+			InstanceID: involvedInstanceID,
+		},
+	}
+}
+
 func stateChangeMessage(involvedInstanceID, state string) statechange.Message {
 	return statechange.Message{
 		Metadata: messages.Metadata{
@@ -0,0 +1,58 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/providers/launchtemplate"
+)
+
+// GracePeriod is how long a launch template is kept after it's created, so that launch templates that were just
+// created for an in-flight launch aren't deleted before the launch template cache is populated
+const GracePeriod = 10 * time.Minute
+
+// Controller periodically deletes the launch templates that Karpenter created for the cluster but that are no longer
+// used, such as ones left behind by changed node templates or failed deletions
+type Controller struct {
+	launchTemplateProvider *launchtemplate.Provider
+}
+
+func NewController(launchTemplateProvider *launchtemplate.Provider) *Controller {
+	return &Controller{
+		launchTemplateProvider: launchTemplateProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "launchtemplate.garbagecollection"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	if _, err := c.launchTemplateProvider.DeleteUnused(ctx, GracePeriod); err != nil {
+		return reconcile.Result{}, fmt.Errorf("deleting unused launch templates, %w", err)
+	}
+	return reconcile.Result{RequeueAfter: 5 * time.Minute}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.NewSingletonManagedBy(m)
+}
@@ -0,0 +1,137 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/controllers/launchtemplate"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var awsEnv *test.Environment
+var controller *launchtemplate.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LaunchTemplateGarbageCollection")
+}
+
+var _ = BeforeSuite(func() {
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	awsEnv = test.NewEnvironment(ctx, env)
+
+	controller = launchtemplate.NewController(awsEnv.LaunchTemplateProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+})
+
+var _ = Describe("LaunchTemplateGarbageCollection", func() {
+	stale := time.Now().Add(-2 * launchtemplate.GracePeriod)
+
+	It("should delete launch templates that are no longer used", func() {
+		lt := storeLaunchTemplate("Karpenter-test-cluster-stale", "test-cluster", stale)
+		result, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+		Expect(launchTemplateIDs()).ToNot(ContainElement(aws.StringValue(lt.LaunchTemplateId)))
+	})
+	It("should keep launch templates that are in use", func() {
+		lt := storeLaunchTemplate("Karpenter-test-cluster-active", "test-cluster", stale)
+		awsEnv.LaunchTemplateCache.SetDefault(aws.StringValue(lt.LaunchTemplateName), lt)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(launchTemplateIDs()).To(ContainElement(aws.StringValue(lt.LaunchTemplateId)))
+	})
+	It("should keep launch templates created within the grace period", func() {
+		lt := storeLaunchTemplate("Karpenter-test-cluster-recent", "test-cluster", time.Now())
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(launchTemplateIDs()).To(ContainElement(aws.StringValue(lt.LaunchTemplateId)))
+	})
+	It("should keep launch templates that belong to another cluster", func() {
+		lt := storeLaunchTemplate("Karpenter-other-cluster-stale", "other-cluster", stale)
+		ExpectReconcileSucceeded(ctx, controller, client.ObjectKey{})
+		Expect(launchTemplateIDs()).To(ContainElement(aws.StringValue(lt.LaunchTemplateId)))
+	})
+	It("should only delete the unused launch templates", func() {
+		unused := storeLaunchTemplate("Karpenter-test-cluster-stale", "test-cluster", stale)
+		active := storeLaunchTemplate("Karpenter-test-cluster-active", "test-cluster", stale)
+		awsEnv.LaunchTemplateCache.SetDefault(aws.StringValue(active.LaunchTemplateName), active)
+		recent := storeLaunchTemplate("Karpenter-test-cluster-recent", "test-cluster", time.Now())
+
+		deleted, err := awsEnv.LaunchTemplateProvider.DeleteUnused(ctx, launchtemplate.GracePeriod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deleted).To(Equal(1))
+		Expect(launchTemplateIDs()).To(ConsistOf(aws.StringValue(active.LaunchTemplateId), aws.StringValue(recent.LaunchTemplateId)))
+		Expect(launchTemplateIDs()).ToNot(ContainElement(aws.StringValue(unused.LaunchTemplateId)))
+	})
+	It("should fail when launch templates can't be listed", func() {
+		storeLaunchTemplate("Karpenter-test-cluster-stale", "test-cluster", stale)
+		awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+		_, err := controller.Reconcile(ctx, reconcile.Request{})
+		Expect(err).To(HaveOccurred())
+		Expect(launchTemplateIDs()).To(HaveLen(1))
+	})
+})
+
+// storeLaunchTemplate adds a launch template to the fake EC2 API, tagged as managed by Karpenter for the cluster
+func storeLaunchTemplate(name, clusterName string, createTime time.Time) *ec2.LaunchTemplate {
+	lt := &ec2.LaunchTemplate{
+		LaunchTemplateName: aws.String(name),
+		LaunchTemplateId:   aws.String(fmt.Sprintf("lt-%s", coretest.RandomName())),
+		CreateTime:         aws.Time(createTime),
+		Tags:               []*ec2.Tag{{Key: aws.String("karpenter.k8s.aws/cluster"), Value: aws.String(clusterName)}},
+	}
+	awsEnv.EC2API.LaunchTemplates.Store(lt.LaunchTemplateName, lt)
+	return lt
+}
+
+// launchTemplateIDs returns the IDs of the launch templates that exist in the fake EC2 API
+func launchTemplateIDs() []string {
+	var ids []string
+	awsEnv.EC2API.LaunchTemplates.Range(func(_, value any) bool {
+		ids = append(ids, aws.StringValue(value.(*ec2.LaunchTemplate).LaunchTemplateId))
+		return true
+	})
+	return ids
+}
@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/cloudprovider"
+)
+
+var _ corecontroller.TypedController[*v1alpha5.Machine] = (*Controller)(nil)
+
+// Controller surfaces why a machine drifted as its Drifted condition, so that operators can tell which drift detector
+// found it drifted. The condition is cleared once the machine no longer drifts.
+type Controller struct {
+	kubeClient    client.Client
+	cloudProvider *cloudprovider.CloudProvider
+}
+
+func NewController(kubeClient client.Client, cloudProvider *cloudprovider.CloudProvider) corecontroller.Controller {
+	return corecontroller.Typed[*v1alpha5.Machine](kubeClient, &Controller{
+		kubeClient:    kubeClient,
+		cloudProvider: cloudProvider,
+	})
+}
+
+func (c *Controller) Name() string {
+	return "machine.drift"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, machine *v1alpha5.Machine) (reconcile.Result, error) {
+	if machine.Status.ProviderID == "" || !machine.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	drift, err := c.cloudProvider.Drift(ctx, machine)
+	if err != nil {
+		return reconcile.Result{}, corecloudprovider.IgnoreMachineNotFoundError(fmt.Errorf("detecting drift, %w", err))
+	}
+	stored := machine.DeepCopy()
+	if drift != nil {
+		machine.StatusConditions().MarkTrueWithReason(v1alpha1.MachineDrifted, string(drift.Reason), "%s", drift.Message)
+	} else if err := machine.StatusConditions().ClearCondition(v1alpha1.MachineDrifted); err != nil {
+		return reconcile.Result{}, fmt.Errorf("clearing drifted condition, %w", err)
+	}
+	if !equality.Semantic.DeepEqual(stored.Status.Conditions, machine.Status.Conditions) {
+		if err := c.kubeClient.Status().Patch(ctx, machine, client.MergeFrom(stored)); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(fmt.Errorf("patching machine status, %w", err))
+		}
+		if drift != nil {
+			logging.FromContext(ctx).With("machine", machine.Name, "reason", drift.Reason).Debugf("machine drifted, %s", drift.Message)
+		} else {
+			logging.FromContext(ctx).With("machine", machine.Name).Debugf("machine no longer drifted")
+		}
+	}
+	return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1alpha5.Machine{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
@@ -0,0 +1,197 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/cloudprovider"
+	"github.com/aws/karpenter/pkg/controllers/machine/drift"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var awsEnv *test.Environment
+var env *coretest.Environment
+var driftController corecontroller.Controller
+
+var nodeTemplate *v1alpha1.AWSNodeTemplate
+var provisioner *v1alpha5.Provisioner
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MachineDrift")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableSubnetDrift: lo.ToPtr(true)}))
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	awsEnv = test.NewEnvironment(ctx, env)
+	cloudProvider := cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
+	driftController = drift.NewController(env.Client, cloudProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+	nodeTemplate = test.AWSNodeTemplate(v1alpha1.AWSNodeTemplateSpec{
+		AWS: v1alpha1.AWS{
+			SubnetSelector:        map[string]string{"*": "*"},
+			SecurityGroupSelector: map[string]string{"*": "*"},
+		},
+	})
+	provisioner = test.Provisioner(coretest.ProvisionerOptions{
+		ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name},
+	})
+	ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("MachineDrift", func() {
+	// launch stores a running instance in the given subnet with the given security groups, along with its machine
+	launch := func(subnetID string, securityGroupIDs []string, annotations map[string]string) *v1alpha5.Machine {
+		instanceID := fake.InstanceID()
+		awsEnv.EC2API.Instances.Store(instanceID, &ec2.Instance{
+			State: &ec2.InstanceState{
+				Name: aws.String(ec2.InstanceStateNameRunning),
+			},
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			SubnetId: aws.String(subnetID),
+			SecurityGroups: lo.Map(securityGroupIDs, func(id string, _ int) *ec2.GroupIdentifier {
+				return &ec2.GroupIdentifier{GroupId: aws.String(id)}
+			}),
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String("m5.large"),
+		})
+		machine := coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Annotations: annotations,
+			},
+			Status: v1alpha5.MachineStatus{
+				ProviderID: fake.ProviderID(instanceID),
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		return machine
+	}
+	launchConfigHash := func() string {
+		hash, err := awsEnv.LaunchTemplateProvider.ConfigHash(ctx, nodeTemplate)
+		Expect(err).ToNot(HaveOccurred())
+		return hash
+	}
+	allSecurityGroups := []string{"sg-test1", "sg-test2", "sg-test3"}
+
+	It("should not set the drifted condition on machines that haven't drifted", func() {
+		machine := launch("subnet-test1", allSecurityGroups, map[string]string{v1alpha1.AnnotationLaunchConfigHash: launchConfigHash()})
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		Expect(ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted)).To(BeNil())
+	})
+	It("should set the drifted condition with the reason of the detector that found the machine drifted", func() {
+		for reason, machine := range map[v1alpha1.DriftReason]*v1alpha5.Machine{
+			v1alpha1.DriftReasonExpired:              launch("subnet-test1", allSecurityGroups, map[string]string{v1alpha1.AnnotationExpired: time.Now().Format(time.RFC3339)}),
+			v1alpha1.DriftReasonRebalanceRecommended: launch("subnet-test1", allSecurityGroups, map[string]string{v1alpha1.AnnotationRebalanceRecommended: time.Now().Format(time.RFC3339)}),
+			v1alpha1.DriftReasonSecurityGroup:        launch("subnet-test1", []string{"sg-test1"}, map[string]string{v1alpha1.AnnotationLaunchConfigHash: "stale"}),
+			v1alpha1.DriftReasonLaunchTemplate:       launch("subnet-test1", allSecurityGroups, map[string]string{v1alpha1.AnnotationLaunchConfigHash: "stale"}),
+			v1alpha1.DriftReasonSubnet:               launch("subnet-other", allSecurityGroups, nil),
+		} {
+			ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+			condition := ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted)
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.IsTrue()).To(BeTrue())
+			Expect(condition.Reason).To(Equal(string(reason)))
+			Expect(condition.Message).ToNot(BeEmpty())
+		}
+	})
+	It("should clear the drifted condition once the machine no longer drifts", func() {
+		machine := launch("subnet-test1", allSecurityGroups, map[string]string{v1alpha1.AnnotationExpired: time.Now().Format(time.RFC3339)})
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		machine = ExpectExists(ctx, env.Client, machine)
+		Expect(machine.StatusConditions().GetCondition(v1alpha1.MachineDrifted)).ToNot(BeNil())
+
+		delete(machine.Annotations, v1alpha1.AnnotationExpired)
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		Expect(ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted)).To(BeNil())
+	})
+	It("should update the reason when a different detector finds the machine drifted", func() {
+		machine := launch("subnet-other", allSecurityGroups, nil)
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		machine = ExpectExists(ctx, env.Client, machine)
+		Expect(machine.StatusConditions().GetCondition(v1alpha1.MachineDrifted).Reason).To(Equal(string(v1alpha1.DriftReasonSubnet)))
+
+		machine.Annotations = lo.Assign(machine.Annotations, map[string]string{v1alpha1.AnnotationExpired: time.Now().Format(time.RFC3339)})
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		Expect(ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted).Reason).To(Equal(string(v1alpha1.DriftReasonExpired)))
+	})
+	It("should ignore machines that haven't launched", func() {
+		machine := coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				Annotations: map[string]string{v1alpha1.AnnotationExpired: time.Now().Format(time.RFC3339)},
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		Expect(ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted)).To(BeNil())
+	})
+	It("should ignore machines whose instance no longer exists", func() {
+		machine := coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+			},
+			Status: v1alpha5.MachineStatus{
+				ProviderID: fake.ProviderID(fake.InstanceID()),
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, driftController, client.ObjectKeyFromObject(machine))
+		Expect(ExpectExists(ctx, env.Client, machine).StatusConditions().GetCondition(v1alpha1.MachineDrifted)).To(BeNil())
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expiration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+// Controller marks nodes whose instance has outlived aws.maxInstanceLifetime as expired. Expired machines are reported
+// as drifted by the cloud provider, so that the drift deprovisioner replaces them while respecting disruption budgets.
+// Nodes are only marked when the drift feature gate is enabled.
+type Controller struct {
+	kubeClient       client.Client
+	clock            clock.Clock
+	instanceProvider *instance.Provider
+}
+
+func NewController(kubeClient client.Client, clk clock.Clock, instanceProvider *instance.Provider) *Controller {
+	return &Controller{
+		kubeClient:       kubeClient,
+		clock:            clk,
+		instanceProvider: instanceProvider,
+	}
+}
+
+func (c *Controller) Name() string {
+	return "machine.expiration"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	lifetime := settings.FromContext(ctx).MaxInstanceLifetime
+	if lifetime == 0 {
+		return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+	// Expired nodes are only replaced by the drift deprovisioner, so don't mark nodes that would never be replaced
+	if !coresettings.FromContext(ctx).DriftEnabled {
+		logging.FromContext(ctx).Errorf("not expiring nodes, aws.maxInstanceLifetime requires the featureGates.driftEnabled feature gate")
+		return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+	nodeList := &v1.NodeList{}
+	if err := c.kubeClient.List(ctx, nodeList, client.HasLabels{v1alpha5.ProvisionerNameLabelKey}); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing nodes, %w", err)
+	}
+	instances, err := c.instanceProvider.List(ctx)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing instances, %w", err)
+	}
+	launchTimes := lo.SliceToMap(lo.Filter(instances, func(i *ec2.Instance, _ int) bool { return i.LaunchTime != nil }), func(i *ec2.Instance) (string, time.Time) {
+		return aws.StringValue(i.InstanceId), aws.TimeValue(i.LaunchTime)
+	})
+
+	expired := lo.CountBy(nodeList.Items, func(n v1.Node) bool {
+		_, ok := n.Annotations[v1alpha1.AnnotationExpired]
+		return ok && n.DeletionTimestamp.IsZero()
+	})
+	budget := int(settings.FromContext(ctx).ExpirationReplacementBudget) - expired
+	if budget <= 0 {
+		return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+	candidates := lo.Filter(nodeList.Items, func(n v1.Node, _ int) bool {
+		if _, ok := n.Annotations[v1alpha1.AnnotationExpired]; ok || !n.DeletionTimestamp.IsZero() {
+			return false
+		}
+		launchTime, ok := launchTimes[utils.NormalizeProviderID(n.Spec.ProviderID)]
+		return ok && !c.clock.Now().Before(launchTime.Add(lifetime))
+	})
+	// Replace the oldest instances first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return launchTimes[utils.NormalizeProviderID(candidates[i].Spec.ProviderID)].Before(launchTimes[utils.NormalizeProviderID(candidates[j].Spec.ProviderID)])
+	})
+	for i := range candidates[:lo.Min([]int{budget, len(candidates)})] {
+		if err := c.expire(ctx, &candidates[i], launchTimes[utils.NormalizeProviderID(candidates[i].Spec.ProviderID)].Add(lifetime)); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+}
+
+func (c *Controller) expire(ctx context.Context, node *v1.Node, expiredAt time.Time) error {
+	stored := node.DeepCopy()
+	node.Annotations = lo.Assign(node.Annotations, map[string]string{
+		v1alpha1.AnnotationExpired: expiredAt.Format(time.RFC3339),
+	})
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return client.IgnoreNotFound(fmt.Errorf("patching node, %w", err))
+	}
+	logging.FromContext(ctx).With("node", node.Name).Infof("marked node as expired, instance exceeded the maximum lifetime of %s", settings.FromContext(ctx).MaxInstanceLifetime)
+	return nil
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) controller.Builder {
+	return controller.NewSingletonManagedBy(m)
+}
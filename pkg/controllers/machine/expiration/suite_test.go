@@ -0,0 +1,197 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expiration_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clock "k8s.io/utils/clock/testing"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/controllers/machine/expiration"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var awsEnv *test.Environment
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var expirationController *expiration.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MachineExpiration")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	awsEnv = test.NewEnvironment(ctx, env)
+	fakeClock = clock.NewFakeClock(time.Now())
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+	fakeClock.SetTime(time.Now())
+	ctx = coresettings.ToContext(ctx, coretest.Settings(coresettings.Settings{DriftEnabled: true}))
+	ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+		MaxInstanceLifetime:         lo.ToPtr(time.Hour * 24),
+		ExpirationReplacementBudget: lo.ToPtr[int64](10),
+	}))
+	expirationController = expiration.NewController(env.Client, fakeClock, awsEnv.InstanceProvider)
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("MachineExpiration", func() {
+	// launch stores a running instance that was launched the given duration ago, along with its node
+	launch := func(age time.Duration) *v1.Node {
+		instanceID := fake.InstanceID()
+		awsEnv.EC2API.Instances.Store(instanceID, &ec2.Instance{
+			State: &ec2.InstanceState{
+				Name: aws.String(ec2.InstanceStateNameRunning),
+			},
+			Tags: []*ec2.Tag{
+				{
+					Key:   aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)),
+					Value: aws.String("owned"),
+				},
+				{
+					Key:   aws.String(v1alpha5.ProvisionerNameLabelKey),
+					Value: aws.String("default"),
+				},
+			},
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			LaunchTime:   aws.Time(fakeClock.Now().Add(-age)),
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String("m5.large"),
+		})
+		node := coretest.Node(coretest.NodeOptions{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: "default"},
+			},
+			ProviderID: fmt.Sprintf("aws:///test-zone-1a/%s", instanceID),
+		})
+		ExpectApplied(ctx, env.Client, node)
+		return node
+	}
+	expired := func(nodes ...*v1.Node) []*v1.Node {
+		return lo.Filter(nodes, func(n *v1.Node, _ int) bool {
+			_, ok := ExpectExists(ctx, env.Client, n).Annotations[v1alpha1.AnnotationExpired]
+			return ok
+		})
+	}
+
+	It("should only mark nodes whose instance exceeded the maximum lifetime as expired", func() {
+		young := launch(time.Hour)
+		old := launch(time.Hour * 25)
+		older := launch(time.Hour * 48)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+
+		Expect(expired(young, old, older)).To(ConsistOf(old, older))
+		Expect(ExpectExists(ctx, env.Client, old).Annotations).To(HaveKeyWithValue(v1alpha1.AnnotationExpired,
+			fakeClock.Now().Add(-time.Hour).Format(time.RFC3339)))
+	})
+	It("should mark a node as expired once its instance reaches the maximum lifetime", func() {
+		node := launch(time.Hour * 23)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(node)).To(BeEmpty())
+
+		fakeClock.Step(time.Hour)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(node)).To(ConsistOf(node))
+	})
+	It("should not mark nodes as expired when the maximum lifetime isn't set", func() {
+		ctx = settings.ToContext(ctx, test.Settings())
+		node := launch(time.Hour * 24 * 365)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(node)).To(BeEmpty())
+	})
+	It("should not mark nodes as expired when drift is disabled", func() {
+		ctx = coresettings.ToContext(ctx, coretest.Settings())
+		node := launch(time.Hour * 48)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(node)).To(BeEmpty())
+	})
+	It("should not mark nodes without an instance as expired", func() {
+		node := coretest.Node(coretest.NodeOptions{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: "default"},
+			},
+			ProviderID: fake.ProviderID(fake.InstanceID()),
+		})
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(node)).To(BeEmpty())
+	})
+	It("should mark the oldest nodes as expired first when the budget is limited", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			MaxInstanceLifetime:         lo.ToPtr(time.Hour * 24),
+			ExpirationReplacementBudget: lo.ToPtr[int64](2),
+		}))
+		nodes := []*v1.Node{launch(time.Hour * 30), launch(time.Hour * 72), launch(time.Hour * 48)}
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(nodes...)).To(ConsistOf(nodes[1], nodes[2]))
+	})
+	It("should count nodes that are already expired against the budget", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			MaxInstanceLifetime:         lo.ToPtr(time.Hour * 24),
+			ExpirationReplacementBudget: lo.ToPtr[int64](1),
+		}))
+		first := launch(time.Hour * 48)
+		second := launch(time.Hour * 30)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(first, second)).To(ConsistOf(first))
+
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(first, second)).To(ConsistOf(first))
+
+		ExpectDeleted(ctx, env.Client, first)
+		ExpectReconcileSucceeded(ctx, expirationController, client.ObjectKey{})
+		Expect(expired(second)).To(ConsistOf(second))
+	})
+})
@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/samber/lo"
 	"go.uber.org/multierr"
 	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/util/workqueue"
 	"knative.dev/pkg/logging"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,23 +32,44 @@ import (
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/events"
 	"github.com/aws/karpenter-core/pkg/operator/controller"
 	"github.com/aws/karpenter-core/pkg/utils/sets"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	"github.com/aws/karpenter/pkg/cloudprovider"
+	gcevents "github.com/aws/karpenter/pkg/controllers/machine/garbagecollect/events"
 	"github.com/aws/karpenter/pkg/controllers/machine/link"
+	"github.com/aws/karpenter/pkg/utils"
+	"github.com/aws/karpenter/pkg/utils/sampling"
 )
 
+// drainRequeueInterval is how often garbage collection is requeued while the nodes of orphaned instances are draining
+const drainRequeueInterval = 10 * time.Second
+
 type Controller struct {
 	kubeClient     client.Client
+	coreV1Client   corev1.CoreV1Interface
 	cloudProvider  *cloudprovider.CloudProvider
 	linkController *link.Controller // get machines recently linked by this controller
+	recorder       events.Recorder
+	InstanceStates sets.Set[string] // instance states that are considered for garbage collection
 }
 
-func NewController(kubeClient client.Client, cloudProvider *cloudprovider.CloudProvider, linkController *link.Controller) *Controller {
+func NewController(kubeClient client.Client, coreV1Client corev1.CoreV1Interface, cloudProvider *cloudprovider.CloudProvider,
+	linkController *link.Controller, recorder events.Recorder) *Controller {
 	return &Controller{
 		kubeClient:     kubeClient,
+		coreV1Client:   coreV1Client,
 		cloudProvider:  cloudProvider,
 		linkController: linkController,
+		recorder:       recorder,
+		InstanceStates: sets.New[string](
+			ec2.InstanceStateNamePending,
+			ec2.InstanceStateNameRunning,
+			ec2.InstanceStateNameStopping,
+			ec2.InstanceStateNameStopped,
+		),
 	}
 }
 
@@ -54,7 +77,12 @@ func (c *Controller) Name() string {
 	return "machine.garbagecollection"
 }
 
-func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+// Reconcile garbage collects every orphaned cloudprovider machine when the request is empty. A request named with a
+// provider ID only considers the machine with that provider ID.
+func (c *Controller) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	if err := c.linkController.Restore(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
 	machineList := &v1alpha5.MachineList{}
 	if err := c.kubeClient.List(ctx, machineList); err != nil {
 		return reconcile.Result{}, err
@@ -63,54 +91,145 @@ func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconc
 	if err := c.kubeClient.List(ctx, nodeList); err != nil {
 		return reconcile.Result{}, err
 	}
-	resolvedMachines := lo.Filter(machineList.Items, func(m v1alpha5.Machine, _ int) bool {
-		return m.Status.ProviderID != "" || m.Annotations[v1alpha5.MachineLinkedAnnotationKey] != ""
-	})
-	resolvedProviderIDs := sets.New[string](lo.Map(resolvedMachines, func(m v1alpha5.Machine, _ int) string {
-		if m.Status.ProviderID != "" {
-			return m.Status.ProviderID
-		}
-		return m.Annotations[v1alpha5.MachineLinkedAnnotationKey]
+	// Provider IDs are compared by their instance ID, since machines and nodes may carry the legacy form without the zone
+	ownedProviderIDs := sets.New[string](lo.FilterMap(machineList.Items, func(m v1alpha5.Machine, _ int) (string, bool) {
+		return utils.NormalizeProviderID(m.Status.ProviderID), m.Status.ProviderID != ""
 	})...)
-	retrieved, err := c.cloudProvider.List(ctx)
+	linkedProviderIDs := sets.New[string](lo.FilterMap(machineList.Items, func(m v1alpha5.Machine, _ int) (string, bool) {
+		return utils.NormalizeProviderID(m.Annotations[v1alpha5.MachineLinkedAnnotationKey]), m.Status.ProviderID == "" && m.Annotations[v1alpha5.MachineLinkedAnnotationKey] != ""
+	})...)
+	retrieved, err := c.retrieve(ctx, req.Name)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("listing cloudprovider machines, %w", err)
+		return reconcile.Result{}, err
 	}
 	managedRetrieved := lo.Filter(retrieved, func(m *v1alpha5.Machine, _ int) bool {
-		return m.Labels[v1alpha5.ManagedByLabelKey] != ""
+		return m.Labels[v1alpha5.ManagedByLabelKey] != "" &&
+			c.InstanceStates.Has(m.Annotations[v1alpha1.AnnotationInstanceState])
 	})
-	errs := make([]error, len(retrieved))
-	workqueue.ParallelizeUntil(ctx, 20, len(managedRetrieved), func(i int) {
-		_, recentlyLinked := c.linkController.Cache.Get(managedRetrieved[i].Status.ProviderID)
-
-		if !recentlyLinked &&
-			!resolvedProviderIDs.Has(managedRetrieved[i].Status.ProviderID) &&
-			managedRetrieved[i].CreationTimestamp.Add(time.Minute).Before(time.Now()) {
-			errs[i] = c.garbageCollect(ctx, managedRetrieved[i], nodeList)
+	skipped := map[string]int{}
+	orphaned := lo.Filter(managedRetrieved, func(m *v1alpha5.Machine, _ int) bool {
+		reason := c.skipReason(ctx, m, ownedProviderIDs, linkedProviderIDs)
+		if reason != "" {
+			skipped[reason]++
 		}
+		return reason == ""
 	})
-	return reconcile.Result{RequeueAfter: time.Minute * 5}, multierr.Combine(errs...)
+	// Only the full scan sees every instance, so a single provider ID doesn't overwrite the counts
+	if req.Name == "" {
+		examinedInstances.Set(float64(len(managedRetrieved)))
+		for _, reason := range skipReasons {
+			skippedInstances.WithLabelValues(reason).Set(float64(skipped[reason]))
+		}
+	}
+	// Hold back the instances whose nodes are still draining, if draining is enabled
+	var draining int
+	var drainErr error
+	if settings.FromContext(ctx).GCDrainTimeout > 0 {
+		orphaned, draining, drainErr = c.drainOrphans(ctx, orphaned, nodeList)
+	}
+	// Terminate all orphaned instances together so that we don't send a TerminateInstances call per instance
+	deleted, err := c.cloudProvider.DeleteBatch(ctx, orphaned)
+	// A large batch is logged as a summary, along with a sample of its instances
+	sampler := sampling.New(settings.FromContext(ctx).GCLogSampleSize)
+	errs := make([]error, len(deleted))
+	workqueue.ParallelizeUntil(ctx, 20, len(deleted), func(i int) {
+		errs[i] = c.garbageCollect(ctx, deleted[i], nodeList, sampler)
+	})
+	if len(deleted) > 0 {
+		logging.FromContext(ctx).With("count", len(deleted)).Infof("garbage collected cloudprovider machines")
+	}
+	// Only the full scan is requeued, since it's what discovers new orphans, unless there are nodes left to drain
+	requeueAfter := lo.Ternary(req.Name == "", time.Minute*5, 0)
+	if draining > 0 {
+		requeueAfter = drainRequeueInterval
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, multierr.Combine(append(errs, err, drainErr)...)
 }
 
-func (c *Controller) garbageCollect(ctx context.Context, machine *v1alpha5.Machine, nodeList *v1.NodeList) error {
-	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("provider-id", machine.Status.ProviderID))
-	if err := c.cloudProvider.Delete(ctx, machine); err != nil {
-		return corecloudprovider.IgnoreMachineNotFoundError(err)
+// skipReason returns why the managed cloudprovider machine shouldn't be garbage collected, or an empty string if it's
+// orphaned
+func (c *Controller) skipReason(ctx context.Context, m *v1alpha5.Machine, ownedProviderIDs, linkedProviderIDs sets.Set[string]) string {
+	if _, recentlyLinked := c.linkController.Cache.Get(utils.NormalizeProviderID(m.Status.ProviderID)); recentlyLinked {
+		return recentlyLinkedReason
+	}
+	if ownedProviderIDs.Has(utils.NormalizeProviderID(m.Status.ProviderID)) {
+		return hasMachineOwnerReason
+	}
+	if linkedProviderIDs.Has(utils.NormalizeProviderID(m.Status.ProviderID)) {
+		return linkedReason
+	}
+	if !m.CreationTimestamp.Add(settings.FromContext(ctx).GCResolutionWindow).Before(time.Now()) {
+		return withinResolutionWindowReason
+	}
+	if m.Annotations[v1alpha1.AnnotationGCProtected] == "true" {
+		logging.FromContext(ctx).With("provider-id", m.Status.ProviderID, "tag-key", settings.FromContext(ctx).GCProtectionTagKey).
+			Debugf("skipping garbage collection for protected cloudprovider machine")
+		return protectedReason
 	}
-	logging.FromContext(ctx).Debugf("garbage collected cloudprovider machine")
+	// Instances stopped by the Stop deletion mode don't have a machine, but are kept so that they can be resumed
+	if m.Annotations[v1alpha1.AnnotationStopped] == "true" &&
+		lo.Contains([]string{ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped}, m.Annotations[v1alpha1.AnnotationInstanceState]) {
+		return stoppedReason
+	}
+	return ""
+}
+
+// retrieve lists every cloudprovider machine, or gets the single machine with the provider ID if one is passed
+func (c *Controller) retrieve(ctx context.Context, providerID string) ([]*v1alpha5.Machine, error) {
+	if providerID == "" {
+		retrieved, err := c.cloudProvider.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing cloudprovider machines, %w", err)
+		}
+		return retrieved, nil
+	}
+	retrieved, err := c.cloudProvider.Get(ctx, providerID)
+	if err != nil {
+		if corecloudprovider.IsMachineNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting cloudprovider machine, %w", err)
+	}
+	return []*v1alpha5.Machine{retrieved}, nil
+}
+
+func (c *Controller) garbageCollect(ctx context.Context, machine *v1alpha5.Machine, nodeList *v1.NodeList, sampler *sampling.Sampler) error {
+	reason := orphanReason(machine)
+	log := sampler.Logger(ctx).With("provider-id", machine.Status.ProviderID, "reason", reason)
+	log.Debugf("garbage collected cloudprovider machine")
 
-	// Go ahead and cleanup the node if we know that it exists to make scheduling go quicker
+	id, err := utils.ParseInstanceID(machine.Status.ProviderID)
+	if err != nil {
+		return fmt.Errorf("getting instance ID, %w", err)
+	}
+	// Go ahead and cleanup the node if we know that it exists to make scheduling go quicker, unless the node lifecycle
+	// is left to another controller
 	if node, ok := lo.Find(nodeList.Items, func(n v1.Node) bool {
-		return n.Spec.ProviderID == machine.Status.ProviderID
+		return utils.NormalizeProviderID(n.Spec.ProviderID) == id
 	}); ok {
+		c.recorder.Publish(gcevents.InstanceGarbageCollected(&node, id, machine.Labels[v1.LabelTopologyZone], reason))
+		if !settings.FromContext(ctx).GCDeleteNodes {
+			return nil
+		}
 		if err := c.kubeClient.Delete(ctx, &node); err != nil {
 			return client.IgnoreNotFound(err)
 		}
-		logging.FromContext(ctx).With("node", node.Name).Debugf("garbage collected node")
+		log.With("node", node.Name).Debugf("garbage collected node")
+		return nil
 	}
+	// Without a node there's no object to publish an event on, since the cloudprovider machine doesn't exist in the
+	// cluster, so the garbage collection is only logged
 	return nil
 }
 
+// orphanReason describes why the cloudprovider machine was considered orphaned
+func orphanReason(m *v1alpha5.Machine) string {
+	if state := m.Annotations[v1alpha1.AnnotationInstanceState]; lo.Contains([]string{ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped}, state) {
+		return fmt.Sprintf("it was %s and had no owning machine", state)
+	}
+	return "it was managed by Karpenter but had no owning machine"
+}
+
 func (c *Controller) Builder(_ context.Context, m manager.Manager) controller.Builder {
 	return controller.NewSingletonManagedBy(m)
 }
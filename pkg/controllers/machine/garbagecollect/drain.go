@@ -0,0 +1,148 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollect
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+// drainOrphans drains the nodes of the orphaned machines, returning the machines that are ready to be deleted along with
+// the number of machines whose nodes are still draining
+func (c *Controller) drainOrphans(ctx context.Context, orphaned []*v1alpha5.Machine, nodeList *v1.NodeList) ([]*v1alpha5.Machine, int, error) {
+	drained := make([]bool, len(orphaned))
+	errs := make([]error, len(orphaned))
+	workqueue.ParallelizeUntil(ctx, 20, len(orphaned), func(i int) {
+		node, ok := lo.Find(nodeList.Items, func(n v1.Node) bool {
+			return utils.NormalizeProviderID(n.Spec.ProviderID) == utils.NormalizeProviderID(orphaned[i].Status.ProviderID)
+		})
+		if !ok {
+			drained[i] = true
+			return
+		}
+		drained[i], errs[i] = c.drain(ctx, &node)
+	})
+	ready := lo.Filter(orphaned, func(_ *v1alpha5.Machine, i int) bool { return drained[i] })
+	return ready, len(orphaned) - len(ready), multierr.Combine(errs...)
+}
+
+// drain cordons the node and evicts its pods through the eviction API so that PodDisruptionBudgets are respected. It
+// returns true once there are no pods left to drain, or once the drain has run for longer than the drain timeout. The
+// pods of DaemonSets are evicted last, once every other pod is gone, if the DaemonSet drain policy allows it.
+func (c *Controller) drain(ctx context.Context, node *v1.Node) (bool, error) {
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("node", node.Name))
+
+	started, err := c.cordon(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	podList := &v1.PodList{}
+	if err := c.kubeClient.List(ctx, podList, client.MatchingFields{"spec.nodeName": node.Name}); err != nil {
+		return false, fmt.Errorf("listing pods on node, %w", err)
+	}
+	pods := lo.Filter(podList.Items, func(p v1.Pod, _ int) bool { return isDrainable(p) })
+	// DaemonSet pods that were evicted are recreated on the cordoned node, since they tolerate it being unschedulable,
+	// so only the pods that were running when the drain started are evicted
+	if len(pods) == 0 && settings.FromContext(ctx).GCDaemonSetDrainPolicy == settings.DaemonSetDrainPolicyLast {
+		pods = lo.Filter(podList.Items, func(p v1.Pod, _ int) bool {
+			return isDaemonSetPod(p) && !hasCompleted(p) && !p.CreationTimestamp.Time.After(started)
+		})
+	}
+	if len(pods) == 0 {
+		return true, nil
+	}
+	if timeout := settings.FromContext(ctx).GCDrainTimeout; time.Since(started) > timeout {
+		logging.FromContext(ctx).With("pods", len(pods), "timeout", timeout).
+			Infof("timed out draining node, garbage collecting it with pods still running")
+		return true, nil
+	}
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil {
+			continue
+		}
+		c.evict(ctx, &pods[i])
+	}
+	return false, nil
+}
+
+// cordon marks the node unschedulable and annotates it with when the drain started, returning that time
+func (c *Controller) cordon(ctx context.Context, node *v1.Node) (time.Time, error) {
+	if started, err := time.Parse(time.RFC3339, node.Annotations[v1alpha1.AnnotationGCDrainStarted]); err == nil && node.Spec.Unschedulable {
+		return started, nil
+	}
+	stored := node.DeepCopy()
+	node.Spec.Unschedulable = true
+	node.Annotations = lo.Assign(node.Annotations, map[string]string{
+		v1alpha1.AnnotationGCDrainStarted: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err := c.kubeClient.Patch(ctx, node, client.MergeFrom(stored)); err != nil {
+		return time.Time{}, fmt.Errorf("cordoning node, %w", err)
+	}
+	logging.FromContext(ctx).Infof("cordoned node before garbage collecting it")
+	return time.Parse(time.RFC3339, node.Annotations[v1alpha1.AnnotationGCDrainStarted])
+}
+
+// evict requests the eviction of the pod. Evictions that are blocked by a PodDisruptionBudget are retried on the next
+// reconcile, so failures are logged rather than returned.
+func (c *Controller) evict(ctx context.Context, pod *v1.Pod) {
+	err := c.coreV1Client.Pods(pod.Namespace).EvictV1(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+	switch {
+	case err == nil, errors.IsNotFound(err):
+		return
+	case errors.IsTooManyRequests(err):
+		logging.FromContext(ctx).With("pod", client.ObjectKeyFromObject(pod)).Debugf("eviction blocked by a pod disruption budget")
+	default:
+		logging.FromContext(ctx).With("pod", client.ObjectKeyFromObject(pod)).Errorf("evicting pod, %s", err)
+	}
+}
+
+// isDrainable returns true if the pod needs to be evicted before the node is removed. Pods owned by the node or by a
+// DaemonSet would be recreated on it, and pods that have already completed don't need to be moved.
+func isDrainable(pod v1.Pod) bool {
+	if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if isDaemonSetPod(pod) {
+		return false
+	}
+	return !hasCompleted(pod)
+}
+
+func isDaemonSetPod(pod v1.Pod) bool {
+	owner := metav1.GetControllerOf(&pod)
+	return owner != nil && owner.Kind == "DaemonSet"
+}
+
+func hasCompleted(pod v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
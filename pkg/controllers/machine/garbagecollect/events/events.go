@@ -0,0 +1,35 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/aws/karpenter-core/pkg/events"
+)
+
+// InstanceGarbageCollected is published on the node of a garbage collected instance. The reason describes why the
+// instance was considered orphaned.
+func InstanceGarbageCollected(node *v1.Node, instanceID, zone, reason string) events.Event {
+	return events.Event{
+		InvolvedObject: node,
+		Type:           v1.EventTypeNormal,
+		Reason:         "InstanceGarbageCollected",
+		Message:        fmt.Sprintf("Instance %s in zone %s was terminated since %s", instanceID, zone, reason),
+		DedupeValues:   []string{instanceID},
+	}
+}
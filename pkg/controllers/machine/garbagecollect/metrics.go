@@ -0,0 +1,67 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package garbagecollect
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	machineSubsystem = "machines"
+	reasonLabel      = "reason"
+
+	hasMachineOwnerReason        = "has-machine-owner"
+	linkedReason                 = "linked"
+	recentlyLinkedReason         = "recently-linked"
+	withinResolutionWindowReason = "within-resolution-window"
+	protectedReason              = "protected"
+	stoppedReason                = "stopped"
+)
+
+var (
+	skipReasons = []string{
+		hasMachineOwnerReason,
+		linkedReason,
+		recentlyLinkedReason,
+		withinResolutionWindowReason,
+		protectedReason,
+		stoppedReason,
+	}
+
+	examinedInstances = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: machineSubsystem,
+			Name:      "garbage_collection_examined_instances",
+			Help:      "Number of managed instances examined by the last full garbage collection scan.",
+		},
+	)
+	skippedInstances = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: machineSubsystem,
+			Name:      "garbage_collection_skipped_instances",
+			Help:      "Number of managed instances that the last full garbage collection scan didn't garbage collect. Labeled by the reason the instance was skipped, which is one of has-machine-owner, linked, recently-linked, within-resolution-window, protected or stopped.",
+		},
+		[]string{reasonLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(examinedInstances, skippedInstances)
+}
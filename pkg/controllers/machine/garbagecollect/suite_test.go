@@ -22,22 +22,33 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"knative.dev/pkg/logging"
 	. "knative.dev/pkg/logging/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/events"
 	"github.com/aws/karpenter-core/pkg/operator/controller"
 	"github.com/aws/karpenter-core/pkg/operator/scheme"
 	coretest "github.com/aws/karpenter-core/pkg/test"
 	. "github.com/aws/karpenter-core/pkg/test/expectations"
+	"github.com/aws/karpenter-core/pkg/utils/sets"
 
 	"github.com/aws/karpenter/pkg/apis"
 	"github.com/aws/karpenter/pkg/apis/settings"
@@ -47,6 +58,7 @@ import (
 	"github.com/aws/karpenter/pkg/controllers/machine/link"
 	"github.com/aws/karpenter/pkg/fake"
 	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils"
 )
 
 var ctx context.Context
@@ -55,6 +67,7 @@ var env *coretest.Environment
 var garbageCollectController controller.Controller
 var linkedMachineCache *cache.Cache
 var cloudProvider *cloudprovider.CloudProvider
+var recorder *eventRecorder
 
 func TestAPIs(t *testing.T) {
 	ctx = TestContextWithLogger(t)
@@ -68,12 +81,13 @@ var _ = BeforeSuite(func() {
 	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
 	awsEnv = test.NewEnvironment(ctx, env)
 
-	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider)
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
 	linkedMachineCache = cache.New(time.Minute*10, time.Second*10)
 	linkController := &link.Controller{
 		Cache: linkedMachineCache,
 	}
-	garbageCollectController = garbagecollect.NewController(env.Client, cloudProvider, linkController)
+	recorder = &eventRecorder{}
+	garbageCollectController = garbagecollect.NewController(env.Client, env.KubernetesInterface.CoreV1(), cloudProvider, linkController, recorder)
 })
 
 var _ = AfterSuite(func() {
@@ -81,7 +95,9 @@ var _ = AfterSuite(func() {
 })
 
 var _ = BeforeEach(func() {
+	ctx = settings.ToContext(ctx, test.Settings())
 	awsEnv.Reset()
+	recorder.Reset()
 })
 
 var _ = Describe("MachineGarbageCollect", func() {
@@ -157,6 +173,174 @@ var _ = Describe("MachineGarbageCollect", func() {
 
 		ExpectNotFound(ctx, env.Client, node)
 	})
+	It("should only delete the instance when deleting the node is disabled", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{GCDeleteNodes: lo.ToPtr(false)}))
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: providerID,
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+
+		ExpectExists(ctx, env.Client, node)
+	})
+	It("should succeed when the instance was already terminated before it could be garbage collected", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+		awsEnv.EC2API.TerminateInstancesBehavior.Error.Set(awserr.New("InvalidInstanceID.NotFound",
+			fmt.Sprintf("The instance ID '%s' does not exist", aws.StringValue(instance.InstanceId)), nil), fake.MaxCalls(0))
+
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: providerID,
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.TerminateInstancesBehavior.Calls()).To(BeNumerically(">", 0))
+		ExpectNotFound(ctx, env.Client, node)
+	})
+	It("should not terminate instances individually when the batch is throttled", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+		awsEnv.EC2API.TerminateInstancesBehavior.Error.Set(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil), fake.MaxCalls(0))
+
+		ExpectReconcileFailed(ctx, garbageCollectController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.TerminateInstancesBehavior.Calls()).To(Equal(1))
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("should terminate instances individually when a single instance fails the batch", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+		awsEnv.EC2API.TerminateInstancesBehavior.Error.Set(awserr.New("IncorrectInstanceState",
+			fmt.Sprintf("The instance '%s' is not in a state from which it can be terminated", aws.StringValue(instance.InstanceId)), nil))
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.TerminateInstancesBehavior.Calls()).To(Equal(2))
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+	})
+	It("should delete a stopped instance if there is no machine owner", func() {
+		instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+	})
+	It("should not delete an instance that was stopped by the stop deletion mode", func() {
+		instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String(v1alpha1.TagStopped), Value: aws.String("true")})
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("should delete an instance that was stopped by the stop deletion mode once it's running again", func() {
+		instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String(v1alpha1.TagStopped), Value: aws.String("true")})
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+	})
+	It("should not delete a stopped instance if it already has a machine that matches it", func() {
+		instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		machine := coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: providerID,
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).ToNot(HaveOccurred())
+		ExpectExists(ctx, env.Client, machine)
+	})
+	It("should not delete a stopped instance if the stopped state isn't considered for garbage collection", func() {
+		instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		runningOnlyController := garbagecollect.NewController(env.Client, env.KubernetesInterface.CoreV1(), cloudProvider, &link.Controller{Cache: linkedMachineCache}, recorder)
+		runningOnlyController.InstanceStates = sets.New[string](ec2.InstanceStateNameRunning)
+
+		ExpectReconcileSucceeded(ctx, runningOnlyController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("should not publish an event when garbage collecting an instance without a node", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		Expect(recorder.Events()).To(BeEmpty())
+	})
+	It("should publish an event for the node when garbage collecting an instance along with the node", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: providerID,
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		evts := recorder.Events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].Reason).To(Equal("InstanceGarbageCollected"))
+		Expect(evts[0].Message).To(ContainSubstring(aws.StringValue(instance.InstanceId)))
+		Expect(evts[0].Message).To(ContainSubstring("test-zone-1a"))
+		Expect(evts[0].Message).To(ContainSubstring("managed by Karpenter but had no owning machine"))
+		involvedNode, ok := evts[0].InvolvedObject.(*v1.Node)
+		Expect(ok).To(BeTrue())
+		Expect(involvedNode.Name).To(Equal(node.Name))
+	})
+	It("should publish the reason a stopped instance was garbage collected", func() {
+		instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: providerID,
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		evts := recorder.Events()
+		Expect(evts).To(HaveLen(1))
+		Expect(evts[0].Message).To(ContainSubstring("it was stopped and had no owning machine"))
+	})
 	It("should delete many instances if they all don't have machine owners", func() {
 		// Generate 500 instances that have different instanceIDs
 		var ids []string
@@ -195,6 +379,8 @@ var _ = Describe("MachineGarbageCollect", func() {
 			ids = append(ids, instanceID)
 		}
 		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		// All instances should be terminated through a single batched call
+		Expect(awsEnv.EC2API.TerminateInstancesBehavior.CalledWithInput.Len()).To(Equal(1))
 
 		wg := sync.WaitGroup{}
 		for _, id := range ids {
@@ -210,6 +396,69 @@ var _ = Describe("MachineGarbageCollect", func() {
 		}
 		wg.Wait()
 	})
+	It("should delete the instances that can be terminated when others in the batch fail", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		protectedInstanceID := fake.InstanceID()
+		protectedInstance := &ec2.Instance{
+			State:          &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+			Tags:           instance.Tags,
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			// Launch time was 10m ago
+			LaunchTime:   aws.Time(time.Now().Add(-time.Minute * 10)),
+			InstanceId:   aws.String(protectedInstanceID),
+			InstanceType: aws.String("m5.large"),
+		}
+		awsEnv.EC2API.Instances.Store(protectedInstanceID, protectedInstance)
+		awsEnv.EC2API.TerminationProtectedInstances.Store(protectedInstanceID, struct{}{})
+
+		ExpectReconcileFailed(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		_, err = cloudProvider.Get(ctx, fmt.Sprintf("aws:///test-zone-1a/%s", protectedInstanceID))
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("should not delete an instance with the protection tag while deleting an unprotected sibling", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		protectedInstanceID := fake.InstanceID()
+		protectedInstance := &ec2.Instance{
+			State: &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+			Tags: append([]*ec2.Tag{
+				{
+					Key:   aws.String("example.com/do-not-gc"),
+					Value: aws.String("true"),
+				},
+			}, instance.Tags...),
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			// Launch time was 10m ago
+			LaunchTime:   aws.Time(time.Now().Add(-time.Minute * 10)),
+			InstanceId:   aws.String(protectedInstanceID),
+			InstanceType: aws.String("m5.large"),
+		}
+		awsEnv.EC2API.Instances.Store(protectedInstanceID, protectedInstance)
+
+		protectionCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			GCProtectionTagKey: lo.ToPtr("example.com/do-not-gc"),
+		}))
+		ExpectReconcileSucceeded(protectionCtx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		_, err = cloudProvider.Get(ctx, fmt.Sprintf("aws:///test-zone-1a/%s", protectedInstanceID))
+		Expect(err).ToNot(HaveOccurred())
+	})
 	It("should not delete all instances if they all have machine owners", func() {
 		// Generate 500 instances that have different instanceIDs
 		var ids []string
@@ -283,6 +532,31 @@ var _ = Describe("MachineGarbageCollect", func() {
 		_, err := cloudProvider.Get(ctx, providerID)
 		Expect(err).NotTo(HaveOccurred())
 	})
+	It("should not delete an instance if it is within a custom machine resolution window (5m)", func() {
+		// Launch time was 3m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 3))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		windowCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			GCResolutionWindow: lo.ToPtr(time.Minute * 5),
+		}))
+		ExpectReconcileSucceeded(windowCtx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should delete an instance if it is outside a custom machine resolution window (5m)", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		windowCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			GCResolutionWindow: lo.ToPtr(time.Minute * 5),
+		}))
+		ExpectReconcileSucceeded(windowCtx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).To(HaveOccurred())
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+	})
 	It("should not delete an instance if it was not launched by a machine", func() {
 		// Remove the "karpenter.sh/managed-by" tag (this isn't launched by a machine)
 		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool {
@@ -317,6 +591,60 @@ var _ = Describe("MachineGarbageCollect", func() {
 		Expect(err).ToNot(HaveOccurred())
 		ExpectExists(ctx, env.Client, node)
 	})
+	It("should not delete the instance or node if a machine matches it with a legacy provider ID", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		legacyProviderID := fmt.Sprintf("aws:///%s", aws.StringValue(instance.InstanceId))
+		machine := coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: legacyProviderID,
+			},
+		})
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: legacyProviderID,
+		})
+		ExpectApplied(ctx, env.Client, machine, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).ToNot(HaveOccurred())
+		ExpectExists(ctx, env.Client, node)
+	})
+	It("should delete the node with a legacy provider ID along with an instance that has no machine owner", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		node := coretest.Node(coretest.NodeOptions{
+			ProviderID: fmt.Sprintf("aws:///%s", aws.StringValue(instance.InstanceId)),
+		})
+		ExpectApplied(ctx, env.Client, node)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		ExpectNotFound(ctx, env.Client, node)
+	})
+	It("should not delete an instance if it is linked with a legacy provider ID", func() {
+		// Launch time was 10m ago
+		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+		machine := coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					v1alpha5.MachineLinkedAnnotationKey: fmt.Sprintf("aws:///%s", aws.StringValue(instance.InstanceId)),
+				},
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+
+		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+		_, err := cloudProvider.Get(ctx, providerID)
+		Expect(err).NotTo(HaveOccurred())
+	})
 	It("should not delete an instance if it is linked", func() {
 		// Launch time was 10m ago
 		instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
@@ -342,10 +670,522 @@ var _ = Describe("MachineGarbageCollect", func() {
 		awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
 
 		// Add a provider id to the recently linked cache
-		linkedMachineCache.SetDefault(providerID, nil)
+		linkedMachineCache.SetDefault(utils.NormalizeProviderID(providerID), nil)
 
 		ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
 		_, err := cloudProvider.Get(ctx, providerID)
 		Expect(err).NotTo(HaveOccurred())
 	})
+	Context("Single Provider ID", func() {
+		It("should only delete the instance with the requested provider ID", func() {
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			otherInstanceID := fake.InstanceID()
+			otherProviderID := fmt.Sprintf("aws:///test-zone-1a/%s", otherInstanceID)
+			otherInstance := &ec2.Instance{
+				State:          &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+				Tags:           instance.Tags,
+				PrivateDnsName: aws.String(fake.PrivateDNSName()),
+				Placement:      &ec2.Placement{AvailabilityZone: aws.String("test-zone-1a")},
+				InstanceId:     aws.String(otherInstanceID),
+				InstanceType:   aws.String("m5.large"),
+				LaunchTime:     aws.Time(time.Now().Add(-time.Minute * 10)),
+			}
+			awsEnv.EC2API.Instances.Store(otherInstanceID, otherInstance)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{Name: providerID})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			_, err = cloudProvider.Get(ctx, otherProviderID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should not delete the instance with the requested provider ID if it has a machine", func() {
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			machine := coretest.Machine(v1alpha5.Machine{
+				Status: v1alpha5.MachineStatus{
+					ProviderID: providerID,
+				},
+			})
+			ExpectApplied(ctx, env.Client, machine)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{Name: providerID})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should succeed when the instance with the requested provider ID doesn't exist", func() {
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{Name: providerID})
+		})
+	})
+	Context("Drain", func() {
+		var drainCtx context.Context
+		var node *v1.Node
+		BeforeEach(func() {
+			drainCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				GCDrainTimeout: lo.ToPtr(time.Minute * 5),
+			}))
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			node = coretest.Node(coretest.NodeOptions{
+				ProviderID: providerID,
+			})
+			ExpectApplied(ctx, env.Client, node)
+		})
+		It("should cordon the node and evict its pods before deleting the instance", func() {
+			pod := coretest.Pod(coretest.PodOptions{NodeName: node.Name})
+			ExpectApplied(ctx, env.Client, pod)
+
+			ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+			node = ExpectExists(ctx, env.Client, node)
+			Expect(node.Spec.Unschedulable).To(BeTrue())
+			Expect(node.Annotations).To(HaveKey(v1alpha1.AnnotationGCDrainStarted))
+			Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeFalse())
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The pod is removed once it has terminated
+			Expect(env.Client.Delete(ctx, pod, client.GracePeriodSeconds(0))).To(Succeed())
+			ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			ExpectNotFound(ctx, env.Client, node)
+		})
+		It("should delete the instance once the drain times out when a pod disruption budget blocks eviction", func() {
+			pod := coretest.Pod(coretest.PodOptions{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+				NodeName:   node.Name,
+			})
+			minAvailable := intstr.FromInt(1)
+			pdb := coretest.PodDisruptionBudget(coretest.PDBOptions{
+				Labels:       map[string]string{"app": "test"},
+				MinAvailable: &minAvailable,
+			})
+			ExpectApplied(ctx, env.Client, pod, pdb)
+
+			ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+			Expect(ExpectExists(ctx, env.Client, node).Spec.Unschedulable).To(BeTrue())
+			Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeTrue())
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).ToNot(HaveOccurred())
+
+			// The drain started longer ago than the timeout
+			node = ExpectExists(ctx, env.Client, node)
+			node.Annotations[v1alpha1.AnnotationGCDrainStarted] = time.Now().Add(-time.Minute * 10).UTC().Format(time.RFC3339)
+			ExpectApplied(ctx, env.Client, node)
+
+			ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			ExpectNotFound(ctx, env.Client, node)
+		})
+		It("should not wait on daemonset pods before deleting the instance", func() {
+			pod := coretest.Pod(coretest.PodOptions{
+				ObjectMeta: metav1.ObjectMeta{
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: "apps/v1",
+						Kind:       "DaemonSet",
+						Name:       "test-daemonset",
+						UID:        "test-uid",
+						Controller: lo.ToPtr(true),
+					}},
+				},
+				NodeName: node.Name,
+			})
+			ExpectApplied(ctx, env.Client, pod)
+
+			ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+			Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeTrue())
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			ExpectNotFound(ctx, env.Client, node)
+		})
+		Context("DaemonSet Drain Policy", func() {
+			var pod, daemonSetPod *v1.Pod
+			BeforeEach(func() {
+				drainCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					GCDrainTimeout:         lo.ToPtr(time.Minute * 5),
+					GCDaemonSetDrainPolicy: lo.ToPtr(settings.DaemonSetDrainPolicyLast),
+				}))
+				pod = coretest.Pod(coretest.PodOptions{NodeName: node.Name})
+				daemonSetPod = coretest.Pod(coretest.PodOptions{
+					ObjectMeta: metav1.ObjectMeta{
+						OwnerReferences: []metav1.OwnerReference{{
+							APIVersion: "apps/v1",
+							Kind:       "DaemonSet",
+							Name:       "test-daemonset",
+							UID:        "test-uid",
+							Controller: lo.ToPtr(true),
+						}},
+					},
+					NodeName: node.Name,
+				})
+				ExpectApplied(ctx, env.Client, pod, daemonSetPod)
+			})
+			It("should evict daemonset pods once every other pod is gone", func() {
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeFalse())
+				Expect(ExpectExists(ctx, env.Client, daemonSetPod).DeletionTimestamp.IsZero()).To(BeTrue())
+
+				// The daemonset pod is still running, so it's left until the other pod is gone
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				Expect(ExpectExists(ctx, env.Client, daemonSetPod).DeletionTimestamp.IsZero()).To(BeTrue())
+
+				Expect(env.Client.Delete(ctx, pod, client.GracePeriodSeconds(0))).To(Succeed())
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				Expect(ExpectExists(ctx, env.Client, daemonSetPod).DeletionTimestamp.IsZero()).To(BeFalse())
+				_, err := cloudProvider.Get(ctx, providerID)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(env.Client.Delete(ctx, daemonSetPod, client.GracePeriodSeconds(0))).To(Succeed())
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				_, err = cloudProvider.Get(ctx, providerID)
+				Expect(err).To(HaveOccurred())
+				Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+				ExpectNotFound(ctx, env.Client, node)
+			})
+			It("should not evict daemonset pods when the drain times out before every other pod is gone", func() {
+				pod.Labels = map[string]string{"app": "test"}
+				minAvailable := intstr.FromInt(1)
+				pdb := coretest.PodDisruptionBudget(coretest.PDBOptions{
+					Labels:       map[string]string{"app": "test"},
+					MinAvailable: &minAvailable,
+				})
+				ExpectApplied(ctx, env.Client, pod, pdb)
+
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeTrue())
+				Expect(ExpectExists(ctx, env.Client, daemonSetPod).DeletionTimestamp.IsZero()).To(BeTrue())
+
+				// The drain started longer ago than the timeout
+				node = ExpectExists(ctx, env.Client, node)
+				node.Annotations[v1alpha1.AnnotationGCDrainStarted] = time.Now().Add(-time.Minute * 10).UTC().Format(time.RFC3339)
+				ExpectApplied(ctx, env.Client, node)
+
+				ExpectReconcileSucceeded(drainCtx, garbageCollectController, client.ObjectKey{})
+				Expect(ExpectExists(ctx, env.Client, daemonSetPod).DeletionTimestamp.IsZero()).To(BeTrue())
+				_, err := cloudProvider.Get(ctx, providerID)
+				Expect(err).To(HaveOccurred())
+				Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+				ExpectNotFound(ctx, env.Client, node)
+			})
+		})
+		It("should requeue sooner while a node is draining", func() {
+			ExpectApplied(ctx, env.Client, coretest.Pod(coretest.PodOptions{NodeName: node.Name}))
+
+			result, err := garbageCollectController.Reconcile(drainCtx, reconcile.Request{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<", time.Minute))
+		})
+		It("should not drain the node when draining is disabled", func() {
+			pod := coretest.Pod(coretest.PodOptions{NodeName: node.Name})
+			ExpectApplied(ctx, env.Client, pod)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(ExpectExists(ctx, env.Client, pod).DeletionTimestamp.IsZero()).To(BeTrue())
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			ExpectNotFound(ctx, env.Client, node)
+		})
+	})
+	Context("Instance Discovery Tag", func() {
+		var blueCtx, greenCtx context.Context
+		var blueProviderID, greenProviderID string
+		// installationInstance stores an orphaned instance launched by the installation with the discovery tag value
+		installationInstance := func(installation string) string {
+			id := fake.InstanceID()
+			awsEnv.EC2API.Instances.Store(id, &ec2.Instance{
+				State: &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+				Tags: append([]*ec2.Tag{{Key: aws.String("example.com/installation"), Value: aws.String(installation)}},
+					instance.Tags...),
+				PrivateDnsName: aws.String(fake.PrivateDNSName()),
+				Placement:      &ec2.Placement{AvailabilityZone: aws.String("test-zone-1a")},
+				// Launch time was 10m ago
+				LaunchTime:   aws.Time(time.Now().Add(-time.Minute * 10)),
+				InstanceId:   aws.String(id),
+				InstanceType: aws.String("m5.large"),
+			})
+			return fmt.Sprintf("aws:///test-zone-1a/%s", id)
+		}
+		BeforeEach(func() {
+			blueCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey:   lo.ToPtr("example.com/installation"),
+				InstanceDiscoveryTagValue: lo.ToPtr("blue"),
+			}))
+			greenCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey:   lo.ToPtr("example.com/installation"),
+				InstanceDiscoveryTagValue: lo.ToPtr("green"),
+			}))
+			blueProviderID = installationInstance("blue")
+			greenProviderID = installationInstance("green")
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+		})
+		It("should only delete the instances of its own installation", func() {
+			ExpectReconcileSucceeded(blueCtx, garbageCollectController, client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, blueProviderID)
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			_, err = cloudProvider.Get(ctx, greenProviderID)
+			Expect(err).ToNot(HaveOccurred())
+
+			ExpectReconcileSucceeded(greenCtx, garbageCollectController, client.ObjectKey{})
+			_, err = cloudProvider.Get(ctx, greenProviderID)
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		})
+		It("should not delete instances without the discovery tag", func() {
+			ExpectReconcileSucceeded(blueCtx, garbageCollectController, client.ObjectKey{})
+			ExpectReconcileSucceeded(greenCtx, garbageCollectController, client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should delete instances with any value of the discovery tag when no value is specified", func() {
+			anyCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey: lo.ToPtr("example.com/installation"),
+			}))
+			ExpectReconcileSucceeded(anyCtx, garbageCollectController, client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, blueProviderID)
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			_, err = cloudProvider.Get(ctx, greenProviderID)
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+			_, err = cloudProvider.Get(ctx, providerID)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+	Context("Metrics", func() {
+		BeforeEach(func() {
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+		})
+		It("should count the examined instances without counting garbage collected instances as skipped", func() {
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(examinedInstances()).To(BeNumerically("==", 1))
+			for _, reason := range []string{"has-machine-owner", "linked", "recently-linked", "within-resolution-window", "protected", "stopped"} {
+				Expect(skippedInstances(reason)).To(BeNumerically("==", 0))
+			}
+		})
+		It("should count instances skipped because they have a machine owner", func() {
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			ExpectApplied(ctx, env.Client, coretest.Machine(v1alpha5.Machine{
+				Status: v1alpha5.MachineStatus{
+					ProviderID: providerID,
+				},
+			}))
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("has-machine-owner")).To(BeNumerically("==", 1))
+		})
+		It("should count instances skipped because they're linked", func() {
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			ExpectApplied(ctx, env.Client, coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						v1alpha5.MachineLinkedAnnotationKey: providerID,
+					},
+				},
+			}))
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("linked")).To(BeNumerically("==", 1))
+			Expect(skippedInstances("has-machine-owner")).To(BeNumerically("==", 0))
+		})
+		It("should count instances skipped because they were recently linked", func() {
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			linkedMachineCache.SetDefault(utils.NormalizeProviderID(providerID), nil)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("recently-linked")).To(BeNumerically("==", 1))
+		})
+		It("should count instances skipped because they're within the resolution window", func() {
+			instance.LaunchTime = aws.Time(time.Now())
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("within-resolution-window")).To(BeNumerically("==", 1))
+		})
+		It("should count instances skipped because they're protected", func() {
+			instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String("example.com/do-not-gc"), Value: aws.String("true")})
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			protectionCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				GCProtectionTagKey: lo.ToPtr("example.com/do-not-gc"),
+			}))
+			ExpectReconcileSucceeded(protectionCtx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("protected")).To(BeNumerically("==", 1))
+		})
+		It("should count instances skipped because they were stopped by the stop deletion mode", func() {
+			instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+			instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String(v1alpha1.TagStopped), Value: aws.String("true")})
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("stopped")).To(BeNumerically("==", 1))
+		})
+		It("should not update the counts when reconciling a single provider ID", func() {
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+			linkedMachineCache.SetDefault(utils.NormalizeProviderID(providerID), nil)
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(skippedInstances("recently-linked")).To(BeNumerically("==", 1))
+
+			linkedMachineCache.Flush()
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{Name: providerID})
+			Expect(skippedInstances("recently-linked")).To(BeNumerically("==", 1))
+		})
+	})
+	Context("Persisted Links", func() {
+		var persistCtx context.Context
+		BeforeEach(func() {
+			persistCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				PersistLinkedMachines: lo.ToPtr(true),
+			}))
+			// Launch time was 10m ago
+			instance.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+			awsEnv.EC2API.Instances.Store(aws.StringValue(instance.InstanceId), instance)
+		})
+		AfterEach(func() {
+			Expect(client.IgnoreNotFound(env.Client.Delete(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "karpenter-linked-machines"}}))).To(Succeed())
+		})
+		// restart returns a garbage collection controller whose link controller starts with an empty cache
+		restart := func(store *link.Store) controller.Controller {
+			return garbagecollect.NewController(env.Client, env.KubernetesInterface.CoreV1(), cloudProvider, &link.Controller{
+				Cache: cache.New(time.Minute*10, time.Second*10),
+				Store: store,
+			}, recorder)
+		}
+		It("should not delete an instance that was linked before a restart", func() {
+			store := link.NewStore(env.Client, "default", time.Minute)
+			Expect(store.Add(persistCtx, providerID)).To(Succeed())
+
+			ExpectReconcileSucceeded(persistCtx, restart(store), client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		It("should delete an instance whose link expired before a restart", func() {
+			store := link.NewStore(env.Client, "default", time.Nanosecond)
+			Expect(store.Add(persistCtx, providerID)).To(Succeed())
+
+			ExpectReconcileSucceeded(persistCtx, restart(store), client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		})
+		It("should not restore links when persistence is disabled", func() {
+			store := link.NewStore(env.Client, "default", time.Minute)
+			Expect(store.Add(persistCtx, providerID)).To(Succeed())
+
+			ExpectReconcileSucceeded(ctx, restart(store), client.ObjectKey{})
+			_, err := cloudProvider.Get(ctx, providerID)
+			Expect(err).To(HaveOccurred())
+			Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+		})
+	})
+	Context("Logging", func() {
+		// orphans stores orphaned copies of the instance with different instance IDs
+		orphans := func(n int) {
+			for i := 0; i < n; i++ {
+				orphan := *instance
+				orphan.InstanceId = aws.String(fake.InstanceID())
+				orphan.LaunchTime = aws.Time(time.Now().Add(-time.Minute * 10))
+				awsEnv.EC2API.Instances.Store(aws.StringValue(orphan.InstanceId), &orphan)
+			}
+		}
+		// observe returns a context that records the logs at the level
+		observe := func(level zapcore.Level) (context.Context, *observer.ObservedLogs) {
+			core, logs := observer.New(level)
+			return logging.WithLogger(ctx, zap.New(core).Sugar()), logs
+		}
+
+		It("should log a single summary at the default level when garbage collecting a batch", func() {
+			orphans(100)
+			ctx, logs := observe(zapcore.InfoLevel)
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(logs.Len()).To(Equal(1))
+			Expect(logs.All()[0].Message).To(Equal("garbage collected cloudprovider machines"))
+			Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("count", int64(100)))
+		})
+		It("should only log a sample of the batch at debug level", func() {
+			orphans(100)
+			ctx, logs := observe(zapcore.DebugLevel)
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(logs.FilterMessage("garbage collected cloudprovider machine").Len()).To(Equal(10))
+			Expect(logs.FilterMessage("garbage collected cloudprovider machines").Len()).To(Equal(1))
+		})
+		It("should log every instance of the batch when the sample size is 0", func() {
+			orphans(100)
+			ctx, logs := observe(zapcore.DebugLevel)
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{GCLogSampleSize: lo.ToPtr[int64](0)}))
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(logs.FilterMessage("garbage collected cloudprovider machine").Len()).To(Equal(100))
+		})
+		It("should not log a summary when there's nothing to garbage collect", func() {
+			ctx, logs := observe(zapcore.InfoLevel)
+			ExpectReconcileSucceeded(ctx, garbageCollectController, client.ObjectKey{})
+			Expect(logs.Len()).To(BeZero())
+		})
+	})
 })
+
+// eventRecorder captures published events so that tests can assert on their contents
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *eventRecorder) Publish(evt events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, evt)
+}
+
+func (r *eventRecorder) Events() []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]events.Event{}, r.events...)
+}
+
+func (r *eventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// examinedInstances returns the number of instances examined by the last full garbage collection scan
+func examinedInstances() float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == "karpenter_machines_garbage_collection_examined_instances" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+// skippedInstances returns the number of instances the last full garbage collection scan skipped for the reason
+func skippedInstances(reason string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != "karpenter_machines_garbage_collection_skipped_instances" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "reason" && label.GetValue() == reason {
+					return m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -33,7 +34,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/aws/karpenter-core/pkg/metrics"
+	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/cloudprovider"
+	"github.com/aws/karpenter/pkg/utils"
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
@@ -41,19 +44,27 @@ import (
 	machineutil "github.com/aws/karpenter-core/pkg/utils/machine"
 )
 
-const creationReasonLabel = "linking"
+const (
+	creationReasonLabel = "linking"
+	linkedMachineTTL    = time.Minute
+)
 
 type Controller struct {
 	kubeClient    client.Client
 	cloudProvider *cloudprovider.CloudProvider
-	Cache         *cache.Cache // exists due to eventual consistency on the controller-runtime cache
+	Cache         *cache.Cache // exists due to eventual consistency on the controller-runtime cache, keyed by normalized provider ID
+	Store         *Store       // persists the cache across restarts when aws.persistLinkedMachines is enabled
+
+	mu       sync.Mutex
+	restored bool
 }
 
 func NewController(kubeClient client.Client, cloudProvider *cloudprovider.CloudProvider) controller.Controller {
 	return &Controller{
 		kubeClient:    kubeClient,
 		cloudProvider: cloudProvider,
-		Cache:         cache.New(time.Minute, time.Second*10),
+		Cache:         cache.New(linkedMachineTTL, time.Second*10),
+		Store:         NewStore(kubeClient, "", linkedMachineTTL),
 	}
 }
 
@@ -62,6 +73,9 @@ func (c *Controller) Name() string {
 }
 
 func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	if err := c.Restore(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
 	machineList := &v1alpha5.MachineList{}
 	if err := c.kubeClient.List(ctx, machineList); err != nil {
 		return reconcile.Result{}, err
@@ -109,20 +123,49 @@ func (c *Controller) link(ctx context.Context, retrieved *v1alpha5.Machine, exis
 		}
 		logging.FromContext(ctx).With("machine", machine.Name).Debugf("generated cluster machine from cloudprovider")
 		metrics.MachinesCreatedCounter.WithLabelValues(creationReasonLabel).Inc()
-		c.Cache.SetDefault(retrieved.Status.ProviderID, nil)
+		c.Cache.SetDefault(utils.NormalizeProviderID(retrieved.Status.ProviderID), nil)
+		if settings.FromContext(ctx).PersistLinkedMachines && c.Store != nil {
+			if err := c.Store.Add(ctx, retrieved.Status.ProviderID); err != nil {
+				return fmt.Errorf("persisting linked machine, %w", err)
+			}
+		}
 	}
 	return corecloudprovider.IgnoreMachineNotFoundError(c.cloudProvider.Link(ctx, retrieved))
 }
 
+// Restore populates the cache with the machines that were linked before a restart. It only loads the store once, so
+// it's safe to call before every read of the cache.
+func (c *Controller) Restore(ctx context.Context) error {
+	if !settings.FromContext(ctx).PersistLinkedMachines || c.Store == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restored {
+		return nil
+	}
+	expirations, err := c.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("restoring linked machines, %w", err)
+	}
+	for providerID, expiration := range expirations {
+		c.Cache.Set(utils.NormalizeProviderID(providerID), nil, expiration)
+	}
+	c.restored = true
+	return nil
+}
+
 func (c *Controller) shouldCreateLinkedMachine(retrieved *v1alpha5.Machine, existingMachines []v1alpha5.Machine) bool {
 	// Machine was already created but controller-runtime cache didn't update
-	if _, ok := c.Cache.Get(retrieved.Status.ProviderID); ok {
+	if _, ok := c.Cache.Get(utils.NormalizeProviderID(retrieved.Status.ProviderID)); ok {
 		return false
 	}
-	// We have a machine registered for this, so no need to hydrate it
+	// We have a machine registered for this, so no need to hydrate it. Provider IDs are compared by their instance ID,
+	// since machines may carry the legacy form without the zone.
+	id := utils.NormalizeProviderID(retrieved.Status.ProviderID)
 	if _, ok := lo.Find(existingMachines, func(m v1alpha5.Machine) bool {
-		return m.Annotations[v1alpha5.MachineLinkedAnnotationKey] == retrieved.Status.ProviderID ||
-			m.Status.ProviderID == retrieved.Status.ProviderID
+		return utils.NormalizeProviderID(m.Annotations[v1alpha5.MachineLinkedAnnotationKey]) == id ||
+			utils.NormalizeProviderID(m.Status.ProviderID) == id
 	}); ok {
 		return false
 	}
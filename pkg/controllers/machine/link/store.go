@@ -0,0 +1,133 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/system"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+const storeName = "karpenter-linked-machines"
+
+// Store persists the provider IDs of recently linked machines in a ConfigMap so that they survive restarts. Without
+// it, instances that were linked just before a restart look orphaned to garbage collection until their machine is seen.
+type Store struct {
+	kubeClient client.Client
+	// Namespace of the ConfigMap, which defaults to the namespace that Karpenter runs in
+	Namespace string
+	ttl       time.Duration
+	mu        sync.Mutex
+}
+
+type storeEntry struct {
+	ProviderID string    `json:"providerID"`
+	LinkedAt   time.Time `json:"linkedAt"`
+}
+
+func NewStore(kubeClient client.Client, namespace string, ttl time.Duration) *Store {
+	return &Store{
+		kubeClient: kubeClient,
+		Namespace:  namespace,
+		ttl:        ttl,
+	}
+}
+
+// Add records that the machine with the provider ID was linked now. Entries older than the TTL are swept at the same time.
+func (s *Store) Add(ctx context.Context, providerID string) error {
+	id, err := utils.ParseInstanceID(providerID)
+	if err != nil {
+		return fmt.Errorf("getting instance ID, %w", err)
+	}
+	raw, err := json.Marshal(storeEntry{ProviderID: providerID, LinkedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("marshaling linked machine, %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cm := &v1.ConfigMap{}
+	if err := s.kubeClient.Get(ctx, client.ObjectKey{Namespace: s.namespace(), Name: storeName}, cm); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("getting linked machines, %w", err)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace(), Name: storeName},
+			Data:       map[string]string{id: string(raw)},
+		}
+		if err := s.kubeClient.Create(ctx, cm); err != nil {
+			return fmt.Errorf("creating linked machines, %w", err)
+		}
+		return nil
+	}
+	stored := cm.DeepCopy()
+	cm.Data = s.live(cm.Data)
+	cm.Data[id] = string(raw)
+	if err := s.kubeClient.Patch(ctx, cm, client.MergeFrom(stored)); err != nil {
+		return fmt.Errorf("patching linked machines, %w", err)
+	}
+	return nil
+}
+
+// Load returns the provider IDs of the machines linked within the TTL, along with how long until each of them expires
+func (s *Store) Load(ctx context.Context) (map[string]time.Duration, error) {
+	cm := &v1.ConfigMap{}
+	if err := s.kubeClient.Get(ctx, client.ObjectKey{Namespace: s.namespace(), Name: storeName}, cm); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting linked machines, %w", err)
+	}
+	expirations := map[string]time.Duration{}
+	for _, raw := range s.live(cm.Data) {
+		entry := storeEntry{}
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		expirations[entry.ProviderID] = s.ttl - time.Since(entry.LinkedAt)
+	}
+	return expirations, nil
+}
+
+// live returns the entries that were linked within the TTL. Entries that can't be parsed are dropped.
+func (s *Store) live(data map[string]string) map[string]string {
+	result := map[string]string{}
+	for id, raw := range data {
+		entry := storeEntry{}
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		if time.Since(entry.LinkedAt) < s.ttl {
+			result[id] = raw
+		}
+	}
+	return result
+}
+
+func (s *Store) namespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+	return system.Namespace()
+}
@@ -26,7 +26,10 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	. "knative.dev/pkg/logging/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -66,7 +69,7 @@ var _ = BeforeSuite(func() {
 	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
 	awsEnv = test.NewEnvironment(ctx, env)
 
-	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider)
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
 	linkController = link.NewController(env.Client, cloudProvider)
 })
 var _ = AfterSuite(func() {
@@ -289,6 +292,19 @@ var _ = Describe("MachineLink", func() {
 				ExpectManagedByTagExists(instance)
 			}
 		})
+		It("should link an instance with a resource-based hostname", func() {
+			instance := ExpectInstanceExists(awsEnv.EC2API, instanceID)
+			instance.PrivateDnsName = aws.String(fake.ResourceDNSName(instanceID))
+			awsEnv.EC2API.Instances.Store(instanceID, instance)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, linkController, client.ObjectKey{})
+
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(1))
+			Expect(machineList.Items[0].Annotations).To(HaveKeyWithValue(v1alpha5.MachineLinkedAnnotationKey, providerID))
+			ExpectManagedByTagExists(ExpectInstanceExists(awsEnv.EC2API, instanceID))
+		})
 		It("should link an instance using provider and no providerRef", func() {
 			raw := &runtime.RawExtension{}
 			lo.Must0(raw.UnmarshalJSON(lo.Must(json.Marshal(v1alpha1.AWS{
@@ -372,6 +388,42 @@ var _ = Describe("MachineLink", func() {
 			Expect(env.Client.List(ctx, machineList)).To(Succeed())
 			Expect(machineList.Items).To(HaveLen(1))
 		})
+		It("should not link an instance whose machine has a legacy provider ID", func() {
+			m := coretest.Machine(v1alpha5.Machine{
+				Status: v1alpha5.MachineStatus{
+					ProviderID: fmt.Sprintf("aws:///%s", instanceID),
+				},
+			})
+			node := coretest.Node(coretest.NodeOptions{
+				ProviderID: fmt.Sprintf("aws:///%s", instanceID),
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate, m, node)
+			ExpectReconcileSucceeded(ctx, linkController, client.ObjectKey{})
+
+			// the legacy provider ID resolves to the same instance, so no other machine is created for it
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(1))
+			Expect(machineList.Items[0].Name).To(Equal(m.Name))
+			ExpectManagedByTagExists(ExpectInstanceExists(awsEnv.EC2API, instanceID))
+		})
+		It("should not link an instance with a resource-based hostname that is already linked", func() {
+			instance := ExpectInstanceExists(awsEnv.EC2API, instanceID)
+			instance.PrivateDnsName = aws.String(fake.ResourceDNSName(instanceID))
+			awsEnv.EC2API.Instances.Store(instanceID, instance)
+			m := coretest.Machine(v1alpha5.Machine{
+				Status: v1alpha5.MachineStatus{
+					ProviderID: providerID,
+				},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate, m)
+			ExpectReconcileSucceeded(ctx, linkController, client.ObjectKey{})
+
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(1))
+			Expect(machineList.Items[0].Name).To(Equal(m.Name))
+		})
 		It("should not link an instance that is terminated", func() {
 			// Update the state of the existing instance
 			instance := ExpectInstanceExists(awsEnv.EC2API, instanceID)
@@ -384,6 +436,108 @@ var _ = Describe("MachineLink", func() {
 			Expect(machineList.Items).To(HaveLen(0))
 		})
 	})
+	Context("Instance Discovery Tag", func() {
+		var blueCtx, greenCtx context.Context
+		// installationInstance stores an instance launched by the installation with the discovery tag value
+		installationInstance := func(installation string) string {
+			id := fake.InstanceID()
+			awsEnv.EC2API.Instances.Store(id, &ec2.Instance{
+				State: &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+				Tags: []*ec2.Tag{
+					{Key: aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)), Value: aws.String("owned")},
+					{Key: aws.String(v1alpha5.ProvisionerNameLabelKey), Value: aws.String(provisioner.Name)},
+					{Key: aws.String("example.com/installation"), Value: aws.String(installation)},
+				},
+				PrivateDnsName: aws.String(fake.PrivateDNSName()),
+				Placement:      &ec2.Placement{AvailabilityZone: aws.String("test-zone-1a")},
+				InstanceId:     aws.String(id),
+				InstanceType:   aws.String("m5.large"),
+			})
+			return fmt.Sprintf("aws:///test-zone-1a/%s", id)
+		}
+		BeforeEach(func() {
+			blueCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey:   lo.ToPtr("example.com/installation"),
+				InstanceDiscoveryTagValue: lo.ToPtr("blue"),
+			}))
+			greenCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey:   lo.ToPtr("example.com/installation"),
+				InstanceDiscoveryTagValue: lo.ToPtr("green"),
+			}))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		})
+		It("should only link the instances of its own installation", func() {
+			blueProviderID := installationInstance("blue")
+			greenProviderID := installationInstance("green")
+
+			ExpectReconcileSucceeded(blueCtx, linkController, client.ObjectKey{})
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(1))
+			Expect(machineList.Items[0].Annotations).To(HaveKeyWithValue(v1alpha5.MachineLinkedAnnotationKey, blueProviderID))
+
+			ExpectReconcileSucceeded(greenCtx, linkController, client.ObjectKey{})
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(2))
+			Expect(lo.Map(machineList.Items, func(m v1alpha5.Machine, _ int) string {
+				return m.Annotations[v1alpha5.MachineLinkedAnnotationKey]
+			})).To(ConsistOf(blueProviderID, greenProviderID))
+		})
+		It("should not link instances without the discovery tag", func() {
+			ExpectReconcileSucceeded(blueCtx, linkController, client.ObjectKey{})
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(0))
+		})
+	})
+	Context("Persisted Links", func() {
+		var persistCtx context.Context
+		var persistedLinkController *link.Controller
+		storeKey := types.NamespacedName{Namespace: "default", Name: "karpenter-linked-machines"}
+		BeforeEach(func() {
+			persistCtx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				PersistLinkedMachines: lo.ToPtr(true),
+			}))
+			persistedLinkController = link.NewController(env.Client, cloudProvider).(*link.Controller)
+			persistedLinkController.Store.Namespace = "default"
+		})
+		AfterEach(func() {
+			Expect(client.IgnoreNotFound(env.Client.Delete(ctx, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: storeKey.Namespace, Name: storeKey.Name}}))).To(Succeed())
+		})
+		It("should record linked machines in the store", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			ExpectReconcileSucceeded(persistCtx, persistedLinkController, client.ObjectKey{})
+
+			cm := &v1.ConfigMap{}
+			Expect(env.Client.Get(ctx, storeKey, cm)).To(Succeed())
+			Expect(cm.Data).To(HaveKey(instanceID))
+			Expect(cm.Data[instanceID]).To(ContainSubstring(providerID))
+		})
+		It("should not record linked machines when persistence is disabled", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, persistedLinkController, client.ObjectKey{})
+
+			Expect(errors.IsNotFound(env.Client.Get(ctx, storeKey, &v1.ConfigMap{}))).To(BeTrue())
+		})
+		It("should restore linked machines from the store after a restart", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			ExpectReconcileSucceeded(persistCtx, persistedLinkController, client.ObjectKey{})
+			machineList := &v1alpha5.MachineList{}
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(1))
+
+			// Remove the machine to simulate a stale controller-runtime cache, then restart with an empty linked cache
+			ExpectDeleted(ctx, env.Client, &machineList.Items[0])
+			restarted := link.NewController(env.Client, cloudProvider).(*link.Controller)
+			restarted.Store.Namespace = "default"
+			ExpectReconcileSucceeded(persistCtx, restarted, client.ObjectKey{})
+
+			_, ok := restarted.Cache.Get(utils.NormalizeProviderID(providerID))
+			Expect(ok).To(BeTrue())
+			Expect(env.Client.List(ctx, machineList)).To(Succeed())
+			Expect(machineList.Items).To(HaveLen(0))
+		})
+	})
 })
 
 func ExpectInstanceExists(api *fake.EC2API, instanceID string) *ec2.Instance {
@@ -0,0 +1,113 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/clock"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+)
+
+var _ corecontroller.TypedController[*v1.Node] = (*Controller)(nil)
+
+// Controller observes how long it takes for the node of a machine to become ready after the machine is created
+type Controller struct {
+	kubeClient client.Client
+	clk        clock.Clock
+	startTime  time.Time
+
+	mu       sync.Mutex
+	observed sets.String
+}
+
+func NewController(kubeClient client.Client, clk clock.Clock) corecontroller.Controller {
+	return corecontroller.Typed[*v1.Node](kubeClient, &Controller{
+		kubeClient: kubeClient,
+		clk:        clk,
+		startTime:  clk.Now(),
+		observed:   sets.NewString(),
+	})
+}
+
+func (c *Controller) Name() string {
+	return "machine.registration"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, node *v1.Node) (reconcile.Result, error) {
+	if _, ok := node.Labels[v1alpha5.ProvisionerNameLabelKey]; !ok || node.Spec.ProviderID == "" {
+		return reconcile.Result{}, nil
+	}
+	ready, ok := lo.Find(node.Status.Conditions, func(c v1.NodeCondition) bool {
+		return c.Type == v1.NodeReady && c.Status == v1.ConditionTrue
+	})
+	// Nodes that became ready before the controller started were already observed, or their machine was created
+	// before the controller could have observed it
+	if !ok || ready.LastTransitionTime.Time.Before(c.startTime) || c.isObserved(node.Spec.ProviderID) {
+		return reconcile.Result{}, nil
+	}
+	machineList := &v1alpha5.MachineList{}
+	if err := c.kubeClient.List(ctx, machineList); err != nil {
+		return reconcile.Result{}, fmt.Errorf("listing machines, %w", err)
+	}
+	machine, ok := lo.Find(machineList.Items, func(m v1alpha5.Machine) bool {
+		return m.Status.ProviderID == node.Spec.ProviderID
+	})
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+	duration := ready.LastTransitionTime.Sub(machine.CreationTimestamp.Time)
+	registrationDuration.With(prometheus.Labels{
+		instanceTypeLabel: node.Labels[v1.LabelInstanceTypeStable],
+		capacityTypeLabel: node.Labels[v1alpha5.LabelCapacityType],
+	}).Observe(duration.Seconds())
+	c.markObserved(node.Spec.ProviderID)
+	logging.FromContext(ctx).With("node", node.Name, "machine", machine.Name, "duration", duration).Debugf("node became ready")
+	return reconcile.Result{}, nil
+}
+
+func (c *Controller) isObserved(providerID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.observed.Has(providerID)
+}
+
+func (c *Controller) markObserved(providerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observed.Insert(providerID)
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1.Node{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
@@ -0,0 +1,45 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	machineSubsystem  = "machines"
+	instanceTypeLabel = "instance_type"
+	capacityTypeLabel = "capacity_type"
+)
+
+var (
+	registrationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: machineSubsystem,
+			Name:      "registration_duration_seconds",
+			Help:      "Duration between the creation of a machine and its node becoming ready. Labeled by instance type and capacity type.",
+			Buckets:   metrics.DurationBuckets(),
+		},
+		[]string{instanceTypeLabel, capacityTypeLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(registrationDuration)
+}
@@ -0,0 +1,176 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clock "k8s.io/utils/clock/testing"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/controllers/machine/registration"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var registrationController corecontroller.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MachineRegistration")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	fakeClock = clock.NewFakeClock(time.Now())
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	fakeClock.SetTime(time.Now())
+	registrationController = registration.NewController(env.Client, fakeClock)
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("MachineRegistration", func() {
+	var machine *v1alpha5.Machine
+	var node *v1.Node
+	BeforeEach(func() {
+		providerID := fake.ProviderID(fake.InstanceID())
+		machine = coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: "default"},
+			},
+			Status: v1alpha5.MachineStatus{
+				ProviderID: providerID,
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		machine = ExpectExists(ctx, env.Client, machine)
+
+		node = coretest.Node(coretest.NodeOptions{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					v1alpha5.ProvisionerNameLabelKey: "default",
+					v1.LabelInstanceTypeStable:       "m5.large",
+					v1alpha5.LabelCapacityType:       v1alpha1.CapacityTypeOnDemand,
+				},
+			},
+			ProviderID: providerID,
+		})
+	})
+	ready := func(at time.Time) []v1.NodeCondition {
+		return []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(at)}}
+	}
+
+	It("should observe the time between machine creation and the node becoming ready", func() {
+		count, sum := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		node.Status.Conditions = ready(machine.CreationTimestamp.Add(30 * time.Second))
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+
+		newCount, newSum := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		Expect(newCount).To(Equal(count + 1))
+		Expect(newSum - sum).To(BeNumerically("~", 30))
+	})
+	It("should only observe a node once", func() {
+		count, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		node.Status.Conditions = ready(machine.CreationTimestamp.Add(30 * time.Second))
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+
+		newCount, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		Expect(newCount).To(Equal(count + 1))
+	})
+	It("should not observe a node that isn't ready", func() {
+		count, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+
+		newCount, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		Expect(newCount).To(Equal(count))
+	})
+	It("should not observe a node that became ready before the controller started", func() {
+		count, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		node.Status.Conditions = ready(fakeClock.Now().Add(-time.Hour))
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+
+		newCount, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		Expect(newCount).To(Equal(count))
+	})
+	It("should not observe a node without a machine", func() {
+		count, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		node.Spec.ProviderID = fake.ProviderID(fake.InstanceID())
+		node.Status.Conditions = ready(machine.CreationTimestamp.Add(30 * time.Second))
+		ExpectApplied(ctx, env.Client, node)
+		ExpectReconcileSucceeded(ctx, registrationController, client.ObjectKeyFromObject(node))
+
+		newCount, _ := registrationDuration("m5.large", v1alpha1.CapacityTypeOnDemand)
+		Expect(newCount).To(Equal(count))
+	})
+})
+
+// registrationDuration returns the sample count and sum of the registration duration histogram for the labels
+func registrationDuration(instanceType, capacityType string) (uint64, float64) {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != "karpenter_machines_registration_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["instance_type"] == instanceType && labels["capacity_type"] == capacityType {
+				return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,127 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/clock"
+	"knative.dev/pkg/logging"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	awscache "github.com/aws/karpenter/pkg/cache"
+	"github.com/aws/karpenter/pkg/cloudprovider"
+)
+
+// missingTTL is how long a missing instance is remembered past the grace period, so that the entries of machines that
+// are deleted before they're reconciled again expire
+const missingTTL = time.Minute * 5
+
+var _ corecontroller.TypedController[*v1alpha5.Machine] = (*Controller)(nil)
+
+// Controller deletes machines whose instance no longer exists, e.g. because it was terminated out-of-band. It's the
+// inverse of garbage collection, which terminates instances that no longer have a machine.
+type Controller struct {
+	kubeClient    client.Client
+	clk           clock.Clock
+	cloudProvider *cloudprovider.CloudProvider
+
+	mu      sync.Mutex
+	missing *cache.Cache // provider ID to when its instance was first found missing
+}
+
+func NewController(kubeClient client.Client, clk clock.Clock, cloudProvider *cloudprovider.CloudProvider) corecontroller.Controller {
+	return corecontroller.Typed[*v1alpha5.Machine](kubeClient, &Controller{
+		kubeClient:    kubeClient,
+		clk:           clk,
+		cloudProvider: cloudProvider,
+		missing:       cache.New(missingTTL, awscache.DefaultCleanupInterval),
+	})
+}
+
+func (c *Controller) Name() string {
+	return "machine.stale"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, machine *v1alpha5.Machine) (reconcile.Result, error) {
+	if machine.Status.ProviderID == "" {
+		return reconcile.Result{}, nil
+	}
+	if !machine.DeletionTimestamp.IsZero() {
+		c.forget(machine.Status.ProviderID)
+		return reconcile.Result{}, nil
+	}
+	_, err := c.cloudProvider.Get(ctx, machine.Status.ProviderID)
+	if err == nil {
+		c.forget(machine.Status.ProviderID)
+		return reconcile.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+	if !corecloudprovider.IsMachineNotFoundError(err) {
+		return reconcile.Result{}, fmt.Errorf("getting cloudprovider machine, %w", err)
+	}
+	gracePeriod := settings.FromContext(ctx).StaleMachineGracePeriod
+	if remaining := c.markMissing(machine.Status.ProviderID, gracePeriod).Add(gracePeriod).Sub(c.clk.Now()); remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+	if err := c.kubeClient.Delete(ctx, machine); err != nil {
+		if errors.IsNotFound(err) {
+			c.forget(machine.Status.ProviderID)
+		}
+		return reconcile.Result{}, client.IgnoreNotFound(fmt.Errorf("deleting machine, %w", err))
+	}
+	c.forget(machine.Status.ProviderID)
+	logging.FromContext(ctx).With("machine", machine.Name, "provider-id", machine.Status.ProviderID).Infof("deleted machine whose instance no longer exists")
+	return reconcile.Result{}, nil
+}
+
+// markMissing returns when the instance with the provider ID was first found missing, recording now if it wasn't. The
+// entry is kept until the grace period has passed and expires if the machine isn't reconciled again, e.g. because it
+// was deleted by something else.
+func (c *Controller) markMissing(providerID string, gracePeriod time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	missingSince := c.clk.Now()
+	if v, ok := c.missing.Get(providerID); ok {
+		missingSince = v.(time.Time)
+	}
+	c.missing.Set(providerID, missingSince, gracePeriod+missingTTL)
+	return missingSince
+}
+
+func (c *Controller) forget(providerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.missing.Delete(providerID)
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) corecontroller.Builder {
+	return corecontroller.Adapt(controllerruntime.
+		NewControllerManagedBy(m).
+		For(&v1alpha5.Machine{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: 10}))
+}
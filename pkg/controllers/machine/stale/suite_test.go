@@ -0,0 +1,211 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stale_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	clock "k8s.io/utils/clock/testing"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/cloudprovider"
+	"github.com/aws/karpenter/pkg/controllers/machine/stale"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var awsEnv *test.Environment
+var env *coretest.Environment
+var fakeClock *clock.FakeClock
+var cloudProvider *cloudprovider.CloudProvider
+var staleController corecontroller.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MachineStale")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	awsEnv = test.NewEnvironment(ctx, env)
+	fakeClock = clock.NewFakeClock(time.Now())
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+	fakeClock.SetTime(time.Now())
+	staleController = stale.NewController(env.Client, fakeClock, cloudProvider)
+})
+
+var _ = AfterEach(func() {
+	ExpectCleanedUp(ctx, env.Client)
+})
+
+var _ = Describe("MachineStale", func() {
+	var gracePeriod time.Duration
+	BeforeEach(func() {
+		gracePeriod = settings.FromContext(ctx).StaleMachineGracePeriod
+	})
+	// launch stores an instance in the given state, along with a machine that points at it
+	launch := func(state string) (*v1alpha5.Machine, *ec2.Instance) {
+		instanceID := fake.InstanceID()
+		instance := &ec2.Instance{
+			State: &ec2.InstanceState{
+				Name: aws.String(state),
+			},
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String("m5.large"),
+		}
+		awsEnv.EC2API.Instances.Store(instanceID, instance)
+		machine := coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: fake.ProviderID(instanceID),
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		return machine, instance
+	}
+
+	It("should not delete machines whose instance exists", func() {
+		machine, _ := launch(ec2.InstanceStateNameRunning)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		fakeClock.Step(gracePeriod + time.Minute)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectExists(ctx, env.Client, machine)
+	})
+	It("should delete a machine whose instance doesn't exist once the grace period has passed", func() {
+		machine := coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: fake.ProviderID(fake.InstanceID()),
+			},
+		})
+		ExpectApplied(ctx, env.Client, machine)
+		_, err := cloudProvider.Get(ctx, machine.Status.ProviderID)
+		Expect(corecloudprovider.IsMachineNotFoundError(err)).To(BeTrue())
+
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectExists(ctx, env.Client, machine)
+
+		fakeClock.Step(gracePeriod)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectNotFound(ctx, env.Client, machine)
+	})
+	It("should delete a machine whose instance was terminated out-of-band", func() {
+		machine, _ := launch(ec2.InstanceStateNameTerminated)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		fakeClock.Step(gracePeriod)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectNotFound(ctx, env.Client, machine)
+	})
+	It("should restart the grace period when the instance is found again", func() {
+		machine, instance := launch(ec2.InstanceStateNameTerminated)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+
+		// The instance is found again, e.g. because DescribeInstances was eventually consistent
+		fakeClock.Step(gracePeriod / 2)
+		instance.State.Name = aws.String(ec2.InstanceStateNameRunning)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+
+		instance.State.Name = aws.String(ec2.InstanceStateNameTerminated)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		fakeClock.Step(gracePeriod / 2)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectExists(ctx, env.Client, machine)
+
+		fakeClock.Step(gracePeriod / 2)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectNotFound(ctx, env.Client, machine)
+	})
+	It("should delete a machine once the configured grace period has passed", func() {
+		gracePeriodCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			StaleMachineGracePeriod: lo.ToPtr(time.Minute * 10),
+		}))
+		machine, _ := launch(ec2.InstanceStateNameTerminated)
+		ExpectReconcileSucceeded(gracePeriodCtx, staleController, client.ObjectKeyFromObject(machine))
+		fakeClock.Step(time.Minute * 5)
+		ExpectReconcileSucceeded(gracePeriodCtx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectExists(ctx, env.Client, machine)
+
+		fakeClock.Step(time.Minute * 5)
+		ExpectReconcileSucceeded(gracePeriodCtx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectNotFound(ctx, env.Client, machine)
+	})
+	It("should forget a missing instance once its machine is being deleted", func() {
+		machine, _ := launch(ec2.InstanceStateNameTerminated)
+		machine.Finalizers = []string{v1alpha5.TerminationFinalizer}
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		fakeClock.Step(gracePeriod / 2)
+
+		// The machine is deleted by something else, and a new machine is later linked to the same instance ID
+		Expect(env.Client.Delete(ctx, machine)).To(Succeed())
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectFinalizersRemoved(ctx, env.Client, machine)
+		ExpectNotFound(ctx, env.Client, machine)
+
+		relinked := coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: machine.Status.ProviderID,
+			},
+		})
+		ExpectApplied(ctx, env.Client, relinked)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(relinked))
+		fakeClock.Step(gracePeriod / 2)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(relinked))
+		ExpectExists(ctx, env.Client, relinked)
+
+		fakeClock.Step(gracePeriod / 2)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(relinked))
+		ExpectNotFound(ctx, env.Client, relinked)
+	})
+	It("should ignore machines that haven't launched", func() {
+		machine := coretest.Machine()
+		ExpectApplied(ctx, env.Client, machine)
+		fakeClock.Step(gracePeriod + time.Minute)
+		ExpectReconcileSucceeded(ctx, staleController, client.ObjectKeyFromObject(machine))
+		ExpectExists(ctx, env.Client, machine)
+	})
+})
@@ -0,0 +1,127 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagging
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	"knative.dev/pkg/logging"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+const (
+	// tagsPerSecond and tagsBurst bound the rate of CreateTags calls so that repairing a large number of instances
+	// doesn't exhaust the EC2 API request limits shared with the rest of the controllers
+	tagsPerSecond = 5
+	tagsBurst     = 10
+)
+
+// Controller re-applies the tags that Karpenter expects on instances that are owned by a live Machine. Out-of-band
+// automation that strips these tags would otherwise cause the instance to look unmanaged to garbage collection.
+type Controller struct {
+	kubeClient       client.Client
+	instanceProvider *instance.Provider
+	RateLimiter      flowcontrol.RateLimiter
+}
+
+func NewController(kubeClient client.Client, instanceProvider *instance.Provider) *Controller {
+	return &Controller{
+		kubeClient:       kubeClient,
+		instanceProvider: instanceProvider,
+		RateLimiter:      flowcontrol.NewTokenBucketRateLimiter(tagsPerSecond, tagsBurst),
+	}
+}
+
+func (c *Controller) Name() string {
+	return "machine.tagging"
+}
+
+func (c *Controller) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	machineList := &v1alpha5.MachineList{}
+	if err := c.kubeClient.List(ctx, machineList); err != nil {
+		return reconcile.Result{}, err
+	}
+	machines := lo.Filter(machineList.Items, func(m v1alpha5.Machine, _ int) bool {
+		return m.Status.ProviderID != "" && m.DeletionTimestamp.IsZero()
+	})
+	errs := make([]error, len(machines))
+	workqueue.ParallelizeUntil(ctx, 20, len(machines), func(i int) {
+		errs[i] = c.tag(ctx, &machines[i])
+	})
+	return reconcile.Result{RequeueAfter: time.Minute * 5}, multierr.Combine(errs...)
+}
+
+func (c *Controller) tag(ctx context.Context, machine *v1alpha5.Machine) error {
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("machine", machine.Name, "provider-id", machine.Status.ProviderID))
+	id, err := utils.ParseInstanceID(machine.Status.ProviderID)
+	if err != nil {
+		return fmt.Errorf("getting instance ID, %w", err)
+	}
+	ec2Instance, err := c.instanceProvider.Get(ctx, id)
+	if err != nil {
+		return corecloudprovider.IgnoreMachineNotFoundError(fmt.Errorf("getting instance, %w", err))
+	}
+	// Only missing tags are re-applied, so repeated reconciles of a fully tagged instance never call EC2
+	missing := lo.OmitByKeys(expectedTags(ctx, machine), lo.Map(ec2Instance.Tags, func(t *ec2.Tag, _ int) string {
+		return aws.StringValue(t.Key)
+	}))
+	if len(missing) == 0 {
+		return nil
+	}
+	if !c.RateLimiter.TryAccept() {
+		logging.FromContext(ctx).Debugf("deferring instance tagging, rate limit exceeded")
+		return nil
+	}
+	if err := c.instanceProvider.Tag(ctx, id, missing); err != nil {
+		return corecloudprovider.IgnoreMachineNotFoundError(err)
+	}
+	logging.FromContext(ctx).With("tags", missing).Debugf("restored missing instance tags")
+	return nil
+}
+
+// expectedTags are the tags that identify an instance as launched by Karpenter for the machine. The version tag isn't
+// restored, since it records the version that launched the instance rather than the version that repaired its tags.
+func expectedTags(ctx context.Context, machine *v1alpha5.Machine) map[string]string {
+	tags := map[string]string{
+		v1alpha5.ManagedByLabelKey:   settings.FromContext(ctx).ClusterName,
+		v1alpha5.MachineNameLabelKey: machine.Name,
+		fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName): "owned",
+	}
+	if provisionerName, ok := machine.Labels[v1alpha5.ProvisionerNameLabelKey]; ok {
+		tags[v1alpha5.ProvisionerNameLabelKey] = provisionerName
+	}
+	return tags
+}
+
+func (c *Controller) Builder(_ context.Context, m manager.Manager) controller.Builder {
+	return controller.NewSingletonManagedBy(m)
+}
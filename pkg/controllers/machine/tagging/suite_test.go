@@ -0,0 +1,188 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tagging_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"k8s.io/client-go/util/flowcontrol"
+	. "knative.dev/pkg/logging/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/operator/scheme"
+	coretest "github.com/aws/karpenter-core/pkg/test"
+	. "github.com/aws/karpenter-core/pkg/test/expectations"
+
+	"github.com/aws/karpenter/pkg/apis"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/controllers/machine/tagging"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var ctx context.Context
+var awsEnv *test.Environment
+var env *coretest.Environment
+var taggingController *tagging.Controller
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Machine")
+}
+
+var _ = BeforeSuite(func() {
+	ctx = coresettings.ToContext(ctx, coretest.Settings())
+	ctx = settings.ToContext(ctx, test.Settings())
+	env = coretest.NewEnvironment(scheme.Scheme, coretest.WithCRDs(apis.CRDs...))
+	awsEnv = test.NewEnvironment(ctx, env)
+})
+
+var _ = AfterSuite(func() {
+	Expect(env.Stop()).To(Succeed(), "Failed to stop environment")
+})
+
+var _ = BeforeEach(func() {
+	awsEnv.Reset()
+	taggingController = tagging.NewController(env.Client, awsEnv.InstanceProvider)
+})
+
+var _ = Describe("MachineTagging", func() {
+	var instance *ec2.Instance
+	var machine *v1alpha5.Machine
+	var expectedTags map[string]string
+
+	BeforeEach(func() {
+		instanceID := fake.InstanceID()
+		machine = coretest.Machine(v1alpha5.Machine{
+			Status: v1alpha5.MachineStatus{
+				ProviderID: fmt.Sprintf("aws:///test-zone-1a/%s", instanceID),
+			},
+		})
+		machine.Labels = lo.Assign(machine.Labels, map[string]string{v1alpha5.ProvisionerNameLabelKey: "default"})
+		expectedTags = map[string]string{
+			v1alpha5.ManagedByLabelKey:       settings.FromContext(ctx).ClusterName,
+			v1alpha5.MachineNameLabelKey:     machine.Name,
+			v1alpha5.ProvisionerNameLabelKey: "default",
+			fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName): "owned",
+		}
+		instance = &ec2.Instance{
+			State: &ec2.InstanceState{
+				Name: aws.String(ec2.InstanceStateNameRunning),
+			},
+			Tags: lo.MapToSlice(lo.Assign(expectedTags, map[string]string{"custom-tag": "custom-value"}), func(k, v string) *ec2.Tag {
+				return &ec2.Tag{Key: aws.String(k), Value: aws.String(v)}
+			}),
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String("test-zone-1a"),
+			},
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String("m5.large"),
+		}
+		awsEnv.EC2API.Instances.Store(instanceID, instance)
+	})
+	AfterEach(func() {
+		ExpectCleanedUp(ctx, env.Client)
+	})
+	ExpectInstanceTags := func(expected map[string]string) {
+		tags := lo.SliceToMap(instance.Tags, func(t *ec2.Tag) (string, string) { return aws.StringValue(t.Key), aws.StringValue(t.Value) })
+		for k, v := range expected {
+			ExpectWithOffset(1, tags).To(HaveKeyWithValue(k, v))
+		}
+	}
+
+	It("should restore the managed-by tag when it's removed from the instance", func() {
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey })
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+		input := awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Pop()
+		Expect(aws.StringValueSlice(input.Resources)).To(ConsistOf(aws.StringValue(instance.InstanceId)))
+		Expect(input.Tags).To(HaveLen(1))
+		Expect(aws.StringValue(input.Tags[0].Key)).To(Equal(v1alpha5.ManagedByLabelKey))
+		ExpectInstanceTags(expectedTags)
+		ExpectInstanceTags(map[string]string{"custom-tag": "custom-value"})
+	})
+	It("should restore every tag that's missing from the instance", func() {
+		instance.Tags = lo.Filter(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == "custom-tag" })
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+		ExpectInstanceTags(expectedTags)
+	})
+	It("should not overwrite tags that exist with a different value", func() {
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey })
+		for _, t := range instance.Tags {
+			if aws.StringValue(t.Key) == v1alpha5.ProvisionerNameLabelKey {
+				t.Value = aws.String("other")
+			}
+		}
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+
+		ExpectInstanceTags(map[string]string{v1alpha5.ProvisionerNameLabelKey: "other"})
+	})
+	It("should not call EC2 when the instance has every expected tag", func() {
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+	It("should only tag once when reconciled repeatedly", func() {
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey })
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+	})
+	It("should not restore the version tag", func() {
+		ctx := settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableVersionTag: lo.ToPtr(true)}))
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+	It("should defer tagging when rate limited", func() {
+		taggingController.RateLimiter = flowcontrol.NewFakeNeverRateLimiter()
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey })
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+	It("should not tag an instance for a machine that hasn't launched", func() {
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == v1alpha5.ManagedByLabelKey })
+		machine.Status.ProviderID = ""
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+	It("should succeed when the instance no longer exists", func() {
+		awsEnv.EC2API.Instances.Delete(aws.StringValue(instance.InstanceId))
+		ExpectApplied(ctx, env.Client, machine)
+		ExpectReconcileSucceeded(ctx, taggingController, client.ObjectKey{})
+		Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+	})
+})
@@ -17,9 +17,11 @@ package nodetemplate
 import (
 	"context"
 	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/multierr"
+	"knative.dev/pkg/logging"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -31,7 +33,9 @@ import (
 	"github.com/samber/lo"
 
 	corecontroller "github.com/aws/karpenter-core/pkg/operator/controller"
+	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/instanceprofile"
 	"github.com/aws/karpenter/pkg/providers/securitygroup"
 	"github.com/aws/karpenter/pkg/providers/subnet"
 )
@@ -39,16 +43,19 @@ import (
 var _ corecontroller.TypedController[*v1alpha1.AWSNodeTemplate] = (*Controller)(nil)
 
 type Controller struct {
-	kubeClient            client.Client
-	subnetProvider        *subnet.Provider
-	securityGroupProvider *securitygroup.Provider
+	kubeClient              client.Client
+	subnetProvider          *subnet.Provider
+	securityGroupProvider   *securitygroup.Provider
+	instanceProfileProvider *instanceprofile.Provider
 }
 
-func NewController(kubeClient client.Client, subnetProvider *subnet.Provider, securityGroups *securitygroup.Provider) corecontroller.Controller {
+func NewController(kubeClient client.Client, subnetProvider *subnet.Provider, securityGroups *securitygroup.Provider,
+	instanceProfileProvider *instanceprofile.Provider) corecontroller.Controller {
 	return corecontroller.Typed[*v1alpha1.AWSNodeTemplate](kubeClient, &Controller{
-		kubeClient:            kubeClient,
-		subnetProvider:        subnetProvider,
-		securityGroupProvider: securityGroups,
+		kubeClient:              kubeClient,
+		subnetProvider:          subnetProvider,
+		securityGroupProvider:   securityGroups,
+		instanceProfileProvider: instanceProfileProvider,
 	})
 }
 
@@ -56,6 +63,9 @@ func (c *Controller) Reconcile(ctx context.Context, nodeTemplate *v1alpha1.AWSNo
 	stored := nodeTemplate.DeepCopy()
 
 	err := multierr.Combine(c.resolveSubnets(ctx, nodeTemplate), c.resolveSecurityGroup(ctx, nodeTemplate))
+	if settings.FromContext(ctx).EnableInstanceProfileCheck {
+		c.checkInstanceProfile(ctx, nodeTemplate)
+	}
 
 	if patchErr := c.kubeClient.Status().Patch(ctx, nodeTemplate, client.MergeFrom(stored)); patchErr != nil {
 		err = multierr.Append(err, client.IgnoreNotFound(patchErr))
@@ -110,3 +120,25 @@ func (c *Controller) resolveSecurityGroup(ctx context.Context, nodeTemplate *v1a
 
 	return nil
 }
+
+// checkInstanceProfile warns when the role of the instance profile is missing permissions that nodes need to join the
+// cluster. The check is best-effort, so it never fails the reconcile, e.g. when the controller isn't allowed to read IAM.
+func (c *Controller) checkInstanceProfile(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) {
+	// The instance profile of a custom launch template isn't known
+	if nodeTemplate.Spec.HasCustomLaunchTemplate() {
+		return
+	}
+	name, err := c.instanceProfileProvider.Get(ctx, nodeTemplate)
+	if err != nil {
+		logging.FromContext(ctx).Debugf("skipping instance profile check, %s", err)
+		return
+	}
+	missing, err := c.instanceProfileProvider.MissingPolicies(ctx, name)
+	if err != nil {
+		logging.FromContext(ctx).With("instance-profile", name).Debugf("skipping instance profile check, %s", err)
+		return
+	}
+	if len(missing) != 0 {
+		logging.FromContext(ctx).With("instance-profile", name).Warnf("role of the instance profile is missing permissions of %s, nodes may fail to join the cluster", strings.Join(missing, ", "))
+	}
+}
@@ -19,7 +19,10 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
@@ -62,7 +65,7 @@ var _ = BeforeSuite(func() {
 	ctx = settings.ToContext(ctx, test.Settings())
 	awsEnv = test.NewEnvironment(ctx, env)
 
-	controller = nodetemplate.NewController(env.Client, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
+	controller = nodetemplate.NewController(env.Client, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider, awsEnv.InstanceProfileProvider)
 })
 
 var _ = AfterSuite(func() {
@@ -71,6 +74,7 @@ var _ = AfterSuite(func() {
 
 var _ = BeforeEach(func() {
 	ctx = injection.WithOptions(ctx, opts)
+	ctx = settings.ToContext(ctx, test.Settings())
 
 	nodeTemplate = &v1alpha1.AWSNodeTemplate{
 		ObjectMeta: metav1.ObjectMeta{
@@ -362,4 +366,103 @@ var _ = Describe("AWSNodeTemplateController", func() {
 			Expect(nodeTemplate.Status.SecurityGroups).To(BeNil())
 		})
 	})
+	Context("Instance Profile Permissions", func() {
+		BeforeEach(func() {
+			awsEnv.IAMAPI.ListInstanceProfilesBehavior.Output.Set(&iam.ListInstanceProfilesOutput{
+				InstanceProfiles: []*iam.InstanceProfile{
+					{
+						InstanceProfileName: aws.String("test-instance-profile"),
+						Roles:               []*iam.Role{{RoleName: aws.String("test-role"), Arn: aws.String("arn:aws:iam::123456789012:role/test-role")}},
+					},
+					{
+						InstanceProfileName: aws.String("test-instance-profile-without-role"),
+					},
+				},
+			})
+		})
+		It("should not report missing policies when the required policies are attached", func() {
+			awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Output.Set(&iam.ListAttachedRolePoliciesOutput{
+				AttachedPolicies: []*iam.AttachedPolicy{
+					{PolicyName: aws.String("AmazonEKSWorkerNodePolicy")},
+					{PolicyName: aws.String("AmazonEC2ContainerRegistryReadOnly")},
+					{PolicyName: aws.String("AmazonSSMManagedInstanceCore")},
+				},
+			})
+			missing, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(BeEmpty())
+			Expect(awsEnv.IAMAPI.SimulatePrincipalPolicyBehavior.Calls()).To(BeZero())
+		})
+		It("should report the required policies that aren't attached", func() {
+			missing, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(Equal([]string{"AmazonEC2ContainerRegistryReadOnly", "AmazonEKSWorkerNodePolicy"}))
+		})
+		It("should not report policies whose actions are allowed by other policies", func() {
+			awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Output.Set(&iam.ListAttachedRolePoliciesOutput{
+				AttachedPolicies: []*iam.AttachedPolicy{{PolicyName: aws.String("AmazonEKSWorkerNodePolicy")}},
+			})
+			awsEnv.IAMAPI.SimulatePrincipalPolicyBehavior.Output.Set(&iam.SimulatePolicyResponse{
+				EvaluationResults: lo.Map([]string{"ecr:GetAuthorizationToken", "ecr:BatchCheckLayerAvailability", "ecr:GetDownloadUrlForLayer", "ecr:BatchGetImage"}, func(action string, _ int) *iam.EvaluationResult {
+					return &iam.EvaluationResult{EvalActionName: aws.String(action), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeAllowed)}
+				}),
+			})
+			missing, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(BeEmpty())
+			input := awsEnv.IAMAPI.SimulatePrincipalPolicyBehavior.CalledWithInput.Pop()
+			Expect(aws.StringValue(input.PolicySourceArn)).To(Equal("arn:aws:iam::123456789012:role/test-role"))
+		})
+		It("should report policies whose actions are only partially allowed", func() {
+			awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Output.Set(&iam.ListAttachedRolePoliciesOutput{
+				AttachedPolicies: []*iam.AttachedPolicy{{PolicyName: aws.String("AmazonEC2ContainerRegistryReadOnly")}},
+			})
+			awsEnv.IAMAPI.SimulatePrincipalPolicyBehavior.Output.Set(&iam.SimulatePolicyResponse{
+				EvaluationResults: []*iam.EvaluationResult{
+					{EvalActionName: aws.String("eks:DescribeCluster"), EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeAllowed)},
+				},
+			})
+			missing, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(Equal([]string{"AmazonEKSWorkerNodePolicy"}))
+		})
+		It("should report every required policy when the instance profile has no role", func() {
+			missing, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile-without-role")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(Equal([]string{"AmazonEC2ContainerRegistryReadOnly", "AmazonEKSWorkerNodePolicy"}))
+			Expect(awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Calls()).To(BeZero())
+		})
+		It("should return an error when the role can't be read", func() {
+			awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Error.Set(awserr.New("AccessDenied", "not authorized to perform iam:ListAttachedRolePolicies", nil))
+			_, err := awsEnv.InstanceProfileProvider.MissingPolicies(ctx, "test-instance-profile")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should not check the instance profile when the check is disabled", func() {
+			ExpectApplied(ctx, env.Client, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(nodeTemplate))
+			Expect(awsEnv.IAMAPI.GetInstanceProfileBehavior.Calls()).To(BeZero())
+		})
+		It("should check the instance profile when the check is enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableInstanceProfileCheck: lo.ToPtr(true)}))
+			ExpectApplied(ctx, env.Client, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(nodeTemplate))
+			Expect(awsEnv.IAMAPI.GetInstanceProfileBehavior.Calls()).To(Equal(1))
+			Expect(awsEnv.IAMAPI.ListAttachedRolePoliciesBehavior.Calls()).To(Equal(1))
+		})
+		It("should not fail to reconcile when IAM can't be read", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableInstanceProfileCheck: lo.ToPtr(true)}))
+			awsEnv.IAMAPI.GetInstanceProfileBehavior.Error.Set(awserr.New("AccessDenied", "not authorized to perform iam:GetInstanceProfile", nil))
+			ExpectApplied(ctx, env.Client, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(nodeTemplate))
+			Expect(ExpectExists(ctx, env.Client, nodeTemplate).Status.Subnets).ToNot(BeEmpty())
+		})
+		It("should not check the instance profile of a custom launch template", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableInstanceProfileCheck: lo.ToPtr(true)}))
+			nodeTemplate.Spec.SecurityGroupSelector = nil
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
+			ExpectApplied(ctx, env.Client, nodeTemplate)
+			ExpectReconcileSucceeded(ctx, controller, client.ObjectKeyFromObject(nodeTemplate))
+			Expect(awsEnv.IAMAPI.GetInstanceProfileBehavior.Calls()).To(BeZero())
+		})
+	})
 })
@@ -20,7 +20,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -33,8 +35,10 @@ var (
 	notFoundErrorCodes = sets.NewString(
 		"InvalidInstanceID.NotFound",
 		launchTemplateNotFoundCode,
+		"InvalidLaunchTemplateId.NotFound",
 		sqs.ErrCodeQueueDoesNotExist,
 		(&eventbridge.ResourceNotFoundException{}).Code(),
+		iam.ErrCodeNoSuchEntityException,
 	)
 	// unfulfillableCapacityErrorCodes signify that capacity is temporarily unable to be launched
 	unfulfillableCapacityErrorCodes = sets.NewString(
@@ -44,6 +48,34 @@ var (
 		"UnfulfillableCapacity",
 		"Unsupported",
 	)
+	// unauthorizedErrorCodes signify that the caller isn't permitted to perform the request
+	unauthorizedErrorCodes = sets.NewString(
+		"UnauthorizedOperation",
+		"AuthFailure",
+		"AccessDenied",
+		"AccessDeniedException",
+	)
+	// throttlingErrorCodes signify that the request was rate limited
+	throttlingErrorCodes = sets.NewString(
+		"RequestLimitExceeded",
+		"Throttling",
+		"ThrottlingException",
+	)
+	// instanceErrorCodes signify that a single instance of a request that acts on several instances can't be acted on,
+	// which fails the whole request
+	instanceErrorCodes = sets.NewString(
+		"InvalidInstanceID.NotFound",
+		"IncorrectInstanceState",
+		"OperationNotPermitted",
+	)
+	// quotaExceededErrorCodes signify that an account limit prevents the request from succeeding
+	quotaExceededErrorCodes = sets.NewString(
+		"VcpuLimitExceeded",
+		"MaxSpotInstanceCountExceeded",
+		"InstanceLimitExceeded",
+		"LaunchTemplateLimitExceeded",
+		"ResourceLimitExceeded",
+	)
 )
 
 // IsNotFound returns true if the err is an AWS error (even if it's
@@ -64,7 +96,55 @@ func IsNotFound(err error) bool {
 // capacity is temporarily unavailable for launching.
 // This could be due to account limits, insufficient ec2 capacity, etc.
 func IsUnfulfillableCapacity(err *ec2.CreateFleetError) bool {
-	return unfulfillableCapacityErrorCodes.Has(*err.ErrorCode)
+	return IsUnfulfillableCapacityCode(*err.ErrorCode)
+}
+
+// IsUnfulfillableCapacityCode returns true if the AWS error code means
+// capacity is temporarily unavailable for launching.
+func IsUnfulfillableCapacityCode(code string) bool {
+	return unfulfillableCapacityErrorCodes.Has(code)
+}
+
+// IsUnauthorizedCode returns true if the AWS error code means the caller
+// isn't permitted to perform the request
+func IsUnauthorizedCode(code string) bool {
+	return unauthorizedErrorCodes.Has(code)
+}
+
+// IsThrottlingCode returns true if the AWS error code means the request
+// was rate limited
+func IsThrottlingCode(code string) bool {
+	return throttlingErrorCodes.Has(code)
+}
+
+// IsInstanceErrorCode returns true if the AWS error code means that a single
+// instance of a request that acts on several instances can't be acted on
+func IsInstanceErrorCode(code string) bool {
+	return instanceErrorCodes.Has(code)
+}
+
+// IsQuotaExceededCode returns true if the AWS error code means an account
+// limit prevents the request from succeeding
+func IsQuotaExceededCode(code string) bool {
+	return quotaExceededErrorCodes.Has(code)
+}
+
+// Codes returns the codes of all AWS errors in err, including wrapped errors
+// and errors combined with multierr
+func Codes(err error) []string {
+	var codes []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		if errs := multierr.Errors(err); len(errs) > 1 {
+			for _, e := range errs {
+				codes = append(codes, Codes(e)...)
+			}
+			return codes
+		}
+		if awsError, ok := err.(awserr.Error); ok {
+			return append(codes, awsError.Code())
+		}
+	}
+	return codes
 }
 
 func IsLaunchTemplateNotFound(err error) bool {
@@ -20,6 +20,8 @@ import (
 	"log"
 	"math"
 	"sync"
+
+	"github.com/samber/lo"
 )
 
 // AtomicPtr is intended for use in mocks to easily expose variables for use in testing.  It makes setting and retrieving
@@ -159,3 +161,36 @@ func (a *AtomicPtrSlice[T]) Pop() *T {
 	a.values = a.values[0 : len(a.values)-1]
 	return last
 }
+
+// ConcurrencyTracker records the highest number of calls that were in flight at the same time
+type ConcurrencyTracker struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+// Start records the start of a call, and returns a func that records its end
+func (c *ConcurrencyTracker) Start() func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight++
+	c.maxInFlight = lo.Max([]int{c.maxInFlight, c.inFlight})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.inFlight--
+	}
+}
+
+func (c *ConcurrencyTracker) MaxInFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxInFlight
+}
+
+func (c *ConcurrencyTracker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight = 0
+	c.maxInFlight = 0
+}
@@ -18,8 +18,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Pallinder/go-randomdata"
 	"github.com/aws/aws-sdk-go/aws"
@@ -54,13 +57,21 @@ type EC2Behavior struct {
 	DescribeAvailabilityZonesOutput     AtomicPtr[ec2.DescribeAvailabilityZonesOutput]
 	DescribeSpotPriceHistoryInput       AtomicPtr[ec2.DescribeSpotPriceHistoryInput]
 	DescribeSpotPriceHistoryOutput      AtomicPtr[ec2.DescribeSpotPriceHistoryOutput]
+	DescribeCapacityReservationsInput   AtomicPtr[ec2.DescribeCapacityReservationsInput]
+	DescribeCapacityReservationsOutput  AtomicPtr[ec2.DescribeCapacityReservationsOutput]
 	CreateFleetBehavior                 MockedFunction[ec2.CreateFleetInput, ec2.CreateFleetOutput]
+	CreateFleetDelay                    AtomicPtr[time.Duration]
+	CreateFleetConcurrency              ConcurrencyTracker
 	TerminateInstancesBehavior          MockedFunction[ec2.TerminateInstancesInput, ec2.TerminateInstancesOutput]
+	StopInstancesBehavior               MockedFunction[ec2.StopInstancesInput, ec2.StopInstancesOutput]
 	DescribeInstancesBehavior           MockedFunction[ec2.DescribeInstancesInput, ec2.DescribeInstancesOutput]
 	CreateTagsBehavior                  MockedFunction[ec2.CreateTagsInput, ec2.CreateTagsOutput]
+	DeleteTagsBehavior                  MockedFunction[ec2.DeleteTagsInput, ec2.DeleteTagsOutput]
+	CreateLaunchTemplateBehavior        MockedFunction[ec2.CreateLaunchTemplateInput, ec2.CreateLaunchTemplateOutput]
 	CalledWithCreateLaunchTemplateInput AtomicPtrSlice[ec2.CreateLaunchTemplateInput]
 	CalledWithDescribeImagesInput       AtomicPtrSlice[ec2.DescribeImagesInput]
 	Instances                           sync.Map
+	TerminationProtectedInstances       sync.Map
 	LaunchTemplates                     sync.Map
 	InsufficientCapacityPools           atomic.Slice[CapacityPool]
 	NextError                           AtomicError
@@ -74,6 +85,9 @@ type EC2API struct {
 // DefaultSupportedUsageClasses is a var because []*string can't be a const
 var DefaultSupportedUsageClasses = aws.StringSlice([]string{"on-demand", "spot"})
 
+// AccountID is the account that owns images described with the "self" owner
+const AccountID = "000000000000"
+
 // Reset must be called between tests otherwise tests will pollute
 // each other.
 func (e *EC2API) Reset() {
@@ -85,16 +99,27 @@ func (e *EC2API) Reset() {
 	e.DescribeInstanceTypeOfferingsOutput.Reset()
 	e.DescribeAvailabilityZonesOutput.Reset()
 	e.CreateFleetBehavior.Reset()
+	e.CreateFleetDelay.Reset()
+	e.CreateFleetConcurrency.Reset()
 	e.TerminateInstancesBehavior.Reset()
+	e.StopInstancesBehavior.Reset()
 	e.DescribeInstancesBehavior.Reset()
+	e.CreateLaunchTemplateBehavior.Reset()
+	e.DeleteTagsBehavior.Reset()
 	e.CalledWithCreateLaunchTemplateInput.Reset()
 	e.CalledWithDescribeImagesInput.Reset()
 	e.DescribeSpotPriceHistoryInput.Reset()
 	e.DescribeSpotPriceHistoryOutput.Reset()
+	e.DescribeCapacityReservationsInput.Reset()
+	e.DescribeCapacityReservationsOutput.Reset()
 	e.Instances.Range(func(k, v any) bool {
 		e.Instances.Delete(k)
 		return true
 	})
+	e.TerminationProtectedInstances.Range(func(k, v any) bool {
+		e.TerminationProtectedInstances.Delete(k)
+		return true
+	})
 	e.LaunchTemplates.Range(func(k, v any) bool {
 		e.LaunchTemplates.Delete(k)
 		return true
@@ -105,6 +130,10 @@ func (e *EC2API) Reset() {
 
 // nolint: gocyclo
 func (e *EC2API) CreateFleetWithContext(_ context.Context, input *ec2.CreateFleetInput, _ ...request.Option) (*ec2.CreateFleetOutput, error) {
+	defer e.CreateFleetConcurrency.Start()()
+	if !e.CreateFleetDelay.IsNil() {
+		time.Sleep(lo.FromPtr(e.CreateFleetDelay.Clone()))
+	}
 	if !e.CreateFleetBehavior.Error.IsNil() || !e.CreateFleetBehavior.Output.IsNil() {
 		return e.CreateFleetBehavior.Invoke(input)
 	}
@@ -136,18 +165,23 @@ func (e *EC2API) CreateFleetWithContext(_ context.Context, input *ec2.CreateFlee
 				continue
 			}
 			amiID := aws.String("")
+			hostnameType := ec2.HostnameTypeIpName
 			if e.CalledWithCreateLaunchTemplateInput.Len() > 0 {
 				lt := e.CalledWithCreateLaunchTemplateInput.Pop()
 				amiID = lt.LaunchTemplateData.ImageId
+				if lt.LaunchTemplateData.PrivateDnsNameOptions != nil && lt.LaunchTemplateData.PrivateDnsNameOptions.HostnameType != nil {
+					hostnameType = aws.StringValue(lt.LaunchTemplateData.PrivateDnsNameOptions.HostnameType)
+				}
 				e.CalledWithCreateLaunchTemplateInput.Add(lt)
 			}
 			instanceState := ec2.InstanceStateNameRunning
 			for i := 0; i < int(*input.TargetCapacitySpecification.TotalTargetCapacity); i++ {
+				instanceID := test.RandomName()
 				instance := &ec2.Instance{
 					ImageId:               aws.String(*amiID),
-					InstanceId:            aws.String(test.RandomName()),
+					InstanceId:            aws.String(instanceID),
 					Placement:             &ec2.Placement{AvailabilityZone: input.LaunchTemplateConfigs[0].Overrides[0].AvailabilityZone},
-					PrivateDnsName:        aws.String(randomdata.IpV4Address()),
+					PrivateDnsName:        aws.String(lo.Ternary(hostnameType == ec2.HostnameTypeResourceName, ResourceDNSName(instanceID), randomdata.IpV4Address())),
 					InstanceType:          input.LaunchTemplateConfigs[0].Overrides[0].InstanceType,
 					SpotInstanceRequestId: spotInstanceRequestID,
 					State: &ec2.InstanceState{
@@ -186,6 +220,12 @@ func (e *EC2API) TerminateInstancesWithContext(_ context.Context, input *ec2.Ter
 	if !e.TerminateInstancesBehavior.Error.IsNil() || !e.TerminateInstancesBehavior.Output.IsNil() {
 		return e.TerminateInstancesBehavior.Invoke(input)
 	}
+	// EC2 fails the entire call if any of the passed instances can't be terminated
+	for _, id := range input.InstanceIds {
+		if _, ok := e.TerminationProtectedInstances.Load(aws.StringValue(id)); ok {
+			return nil, awserr.New("OperationNotPermitted", fmt.Sprintf("The instance '%s' may not be terminated", aws.StringValue(id)), nil)
+		}
+	}
 	var instanceStateChanges []*ec2.InstanceStateChange
 	for _, id := range input.InstanceIds {
 		instanceID := *id
@@ -201,13 +241,47 @@ func (e *EC2API) TerminateInstancesWithContext(_ context.Context, input *ec2.Ter
 	return e.TerminateInstancesBehavior.WithDefault(result).Invoke(input)
 }
 
+func (e *EC2API) StopInstancesWithContext(_ context.Context, input *ec2.StopInstancesInput, _ ...request.Option) (*ec2.StopInstancesOutput, error) {
+	if !e.StopInstancesBehavior.Error.IsNil() || !e.StopInstancesBehavior.Output.IsNil() {
+		return e.StopInstancesBehavior.Invoke(input)
+	}
+	var instanceStateChanges []*ec2.InstanceStateChange
+	for _, id := range input.InstanceIds {
+		raw, ok := e.Instances.Load(aws.StringValue(id))
+		if !ok {
+			return nil, awserr.New("InvalidInstanceID.NotFound", fmt.Sprintf("The instance ID '%s' does not exist", aws.StringValue(id)), nil)
+		}
+		instance := raw.(*ec2.Instance)
+		instanceStateChanges = append(instanceStateChanges, &ec2.InstanceStateChange{
+			PreviousState: instance.State,
+			CurrentState:  &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameStopped), Code: aws.Int64(80)},
+			InstanceId:    id,
+		})
+		instance.State = &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameStopped), Code: aws.Int64(80)}
+	}
+	result := &ec2.StopInstancesOutput{StoppingInstances: instanceStateChanges}
+	return e.StopInstancesBehavior.WithDefault(result).Invoke(input)
+}
+
 func (e *EC2API) CreateLaunchTemplateWithContext(_ context.Context, input *ec2.CreateLaunchTemplateInput, _ ...request.Option) (*ec2.CreateLaunchTemplateOutput, error) {
 	if !e.NextError.IsNil() {
 		defer e.NextError.Reset()
 		return nil, e.NextError.Get()
 	}
+	if _, err := e.CreateLaunchTemplateBehavior.Invoke(input); err != nil {
+		return nil, err
+	}
 	e.CalledWithCreateLaunchTemplateInput.Add(input)
-	launchTemplate := &ec2.LaunchTemplate{LaunchTemplateName: input.LaunchTemplateName}
+	launchTemplate := &ec2.LaunchTemplate{
+		LaunchTemplateName: input.LaunchTemplateName,
+		LaunchTemplateId:   aws.String(fmt.Sprintf("lt-%s", test.RandomName())),
+		CreateTime:         aws.Time(time.Now()),
+	}
+	for _, tagSpecification := range input.TagSpecifications {
+		if aws.StringValue(tagSpecification.ResourceType) == ec2.ResourceTypeLaunchTemplate {
+			launchTemplate.Tags = append(launchTemplate.Tags, tagSpecification.Tags...)
+		}
+	}
 	e.LaunchTemplates.Store(input.LaunchTemplateName, launchTemplate)
 	return &ec2.CreateLaunchTemplateOutput{LaunchTemplate: launchTemplate}, nil
 }
@@ -223,12 +297,28 @@ func (e *EC2API) CreateTagsWithContext(_ context.Context, input *ec2.CreateTagsI
 
 		// Upsert any tags that have the same key
 		newTagKeys := sets.New[string](lo.Map(input.Tags, func(t *ec2.Tag, _ int) string { return aws.StringValue(t.Key) })...)
-		instance.Tags = lo.Filter(input.Tags, func(t *ec2.Tag, _ int) bool { return newTagKeys.Has(aws.StringValue(t.Key)) })
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return newTagKeys.Has(aws.StringValue(t.Key)) })
 		instance.Tags = append(instance.Tags, input.Tags...)
 	}
 	return e.CreateTagsBehavior.Invoke(input)
 }
 
+func (e *EC2API) DeleteTagsWithContext(_ context.Context, input *ec2.DeleteTagsInput, _ ...request.Option) (*ec2.DeleteTagsOutput, error) {
+	if !e.DeleteTagsBehavior.Error.IsNil() {
+		return e.DeleteTagsBehavior.Invoke(input)
+	}
+	for _, id := range input.Resources {
+		raw, ok := e.Instances.Load(aws.StringValue(id))
+		if !ok {
+			return nil, awserr.New("InvalidInstanceID.NotFound", fmt.Sprintf("instance with id '%s' does not exist", aws.StringValue(id)), nil)
+		}
+		instance := raw.(*ec2.Instance)
+		deletedTagKeys := sets.New[string](lo.Map(input.Tags, func(t *ec2.Tag, _ int) string { return aws.StringValue(t.Key) })...)
+		instance.Tags = lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool { return deletedTagKeys.Has(aws.StringValue(t.Key)) })
+	}
+	return e.DeleteTagsBehavior.Invoke(input)
+}
+
 func (e *EC2API) DescribeInstancesWithContext(_ context.Context, input *ec2.DescribeInstancesInput, _ ...request.Option) (*ec2.DescribeInstancesOutput, error) {
 	if !e.DescribeInstancesBehavior.Error.IsNil() || !e.DescribeInstancesBehavior.Output.IsNil() {
 		return e.DescribeInstancesBehavior.Invoke(input)
@@ -249,19 +339,50 @@ func (e *EC2API) DescribeInstancesWithContext(_ context.Context, input *ec2.Desc
 		}
 		instances = append(instances, instance.(*ec2.Instance))
 	}
+	instances = filterInstances(instances, input.Filters)
+	var nextToken *string
+	// Page through the instances in a consistent order if the caller asked for a maximum number of results
+	if input.MaxResults != nil {
+		sort.Slice(instances, func(i, j int) bool {
+			return aws.StringValue(instances[i].InstanceId) < aws.StringValue(instances[j].InstanceId)
+		})
+		start := 0
+		if input.NextToken != nil {
+			var err error
+			if start, err = strconv.Atoi(aws.StringValue(input.NextToken)); err != nil {
+				return nil, fmt.Errorf("invalid next token %s, %w", aws.StringValue(input.NextToken), err)
+			}
+		}
+		end := lo.Min([]int{start + int(aws.Int64Value(input.MaxResults)), len(instances)})
+		if end < len(instances) {
+			nextToken = aws.String(strconv.Itoa(end))
+		}
+		instances = instances[start:end]
+	}
 	result := &ec2.DescribeInstancesOutput{
-		Reservations: []*ec2.Reservation{{Instances: filterInstances(instances, input.Filters)}},
+		Reservations: []*ec2.Reservation{{Instances: instances}},
+		NextToken:    nextToken,
 	}
 	return e.DescribeInstancesBehavior.WithDefault(result).Invoke(input)
 }
 
 func (e *EC2API) DescribeInstancesPagesWithContext(ctx context.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, opts ...request.Option) error {
-	output, err := e.DescribeInstancesWithContext(ctx, input, opts...)
-	if err != nil {
-		return err
+	for {
+		output, err := e.DescribeInstancesWithContext(ctx, input, opts...)
+		if err != nil {
+			return err
+		}
+		lastPage := output.NextToken == nil
+		if !fn(output, lastPage) || lastPage {
+			return nil
+		}
+		input = &ec2.DescribeInstancesInput{
+			InstanceIds: input.InstanceIds,
+			Filters:     input.Filters,
+			MaxResults:  input.MaxResults,
+			NextToken:   output.NextToken,
+		}
 	}
-	fn(output, false)
-	return nil
 }
 
 //nolint:gocyclo
@@ -277,6 +398,16 @@ func filterInstances(instances []*ec2.Instance, filters []*ec2.Filter) []*ec2.In
 					passesFilter = false
 					break OUTER
 				}
+			case aws.StringValue(filter.Name) == "availability-zone":
+				if !lo.Contains(aws.StringValueSlice(filter.Values), aws.StringValue(instance.Placement.AvailabilityZone)) {
+					passesFilter = false
+					break OUTER
+				}
+			case aws.StringValue(filter.Name) == "iam-instance-profile.arn":
+				if instance.IamInstanceProfile == nil || !lo.Contains(aws.StringValueSlice(filter.Values), aws.StringValue(instance.IamInstanceProfile.Arn)) {
+					passesFilter = false
+					break OUTER
+				}
 			case aws.StringValue(filter.Name) == "tag-key":
 				values := sets.New(aws.StringValueSlice(filter.Values)...)
 				if _, ok := lo.Find(instance.Tags, func(t *ec2.Tag) bool {
@@ -316,17 +447,35 @@ func (e *EC2API) DescribeImagesWithContext(_ context.Context, input *ec2.Describ
 		return nil, e.NextError.Get()
 	}
 	e.CalledWithDescribeImagesInput.Add(input)
-	if !e.DescribeImagesOutput.IsNil() {
-		return e.DescribeImagesOutput.Clone(), nil
-	}
-	return &ec2.DescribeImagesOutput{
+	output := &ec2.DescribeImagesOutput{
 		Images: []*ec2.Image{
 			{
 				ImageId:      aws.String(test.RandomName()),
 				Architecture: aws.String("x86_64"),
 			},
 		},
-	}, nil
+	}
+	if !e.DescribeImagesOutput.IsNil() {
+		output = e.DescribeImagesOutput.Clone()
+	}
+	output.Images = lo.Filter(output.Images, func(image *ec2.Image, _ int) bool {
+		return ownedBy(image, aws.StringValueSlice(input.Owners))
+	})
+	return output, nil
+}
+
+// ownedBy returns true if the image is owned by one of the owners, which are either account IDs or owner aliases.
+// Images without an owner are owned by every account so that tests only need to set owners when they care about them.
+func ownedBy(image *ec2.Image, owners []string) bool {
+	if len(owners) == 0 || (image.OwnerId == nil && image.ImageOwnerAlias == nil) {
+		return true
+	}
+	return lo.ContainsBy(owners, func(owner string) bool {
+		if owner == "self" {
+			return aws.StringValue(image.OwnerId) == AccountID
+		}
+		return owner == aws.StringValue(image.OwnerId) || owner == aws.StringValue(image.ImageOwnerAlias)
+	})
 }
 
 func (e *EC2API) DescribeLaunchTemplatesWithContext(_ context.Context, input *ec2.DescribeLaunchTemplatesInput, _ ...request.Option) (*ec2.DescribeLaunchTemplatesOutput, error) {
@@ -340,14 +489,71 @@ func (e *EC2API) DescribeLaunchTemplatesWithContext(_ context.Context, input *ec
 	output := &ec2.DescribeLaunchTemplatesOutput{}
 	e.LaunchTemplates.Range(func(key, value interface{}) bool {
 		launchTemplate := value.(*ec2.LaunchTemplate)
-		if lo.Contains(aws.StringValueSlice(input.LaunchTemplateNames), aws.StringValue(launchTemplate.LaunchTemplateName)) {
+		if len(input.LaunchTemplateNames) > 0 && !lo.Contains(aws.StringValueSlice(input.LaunchTemplateNames), aws.StringValue(launchTemplate.LaunchTemplateName)) {
+			return true
+		}
+		if len(input.LaunchTemplateIds) > 0 && !lo.Contains(aws.StringValueSlice(input.LaunchTemplateIds), aws.StringValue(launchTemplate.LaunchTemplateId)) {
+			return true
+		}
+		if Filter(input.Filters, aws.StringValue(launchTemplate.LaunchTemplateId), "", launchTemplate.Tags) {
 			output.LaunchTemplates = append(output.LaunchTemplates, launchTemplate)
 		}
 		return true
 	})
-	if len(output.LaunchTemplates) == 0 {
+	if len(output.LaunchTemplates) == 0 && len(input.LaunchTemplateNames) > 0 {
 		return nil, awserr.New("InvalidLaunchTemplateName.NotFoundException", "not found", nil)
 	}
+	if len(output.LaunchTemplates) == 0 && len(input.LaunchTemplateIds) > 0 {
+		return nil, awserr.New("InvalidLaunchTemplateId.NotFound", "not found", nil)
+	}
+	return output, nil
+}
+
+func (e *EC2API) DescribeLaunchTemplatesPagesWithContext(ctx context.Context, input *ec2.DescribeLaunchTemplatesInput, fn func(*ec2.DescribeLaunchTemplatesOutput, bool) bool, opts ...request.Option) error {
+	output, err := e.DescribeLaunchTemplatesWithContext(ctx, input, opts...)
+	if err != nil {
+		return err
+	}
+	fn(output, true)
+	return nil
+}
+
+func (e *EC2API) DeleteLaunchTemplateWithContext(_ context.Context, input *ec2.DeleteLaunchTemplateInput, _ ...request.Option) (*ec2.DeleteLaunchTemplateOutput, error) {
+	if !e.NextError.IsNil() {
+		defer e.NextError.Reset()
+		return nil, e.NextError.Get()
+	}
+	var deleted *ec2.LaunchTemplate
+	e.LaunchTemplates.Range(func(key, value interface{}) bool {
+		if launchTemplate := value.(*ec2.LaunchTemplate); aws.StringValue(launchTemplate.LaunchTemplateId) == aws.StringValue(input.LaunchTemplateId) {
+			e.LaunchTemplates.Delete(key)
+			deleted = launchTemplate
+			return false
+		}
+		return true
+	})
+	if deleted == nil {
+		return nil, awserr.New("InvalidLaunchTemplateId.NotFound", "not found", nil)
+	}
+	return &ec2.DeleteLaunchTemplateOutput{LaunchTemplate: deleted}, nil
+}
+
+func (e *EC2API) DescribeCapacityReservationsWithContext(_ context.Context, input *ec2.DescribeCapacityReservationsInput, _ ...request.Option) (*ec2.DescribeCapacityReservationsOutput, error) {
+	e.DescribeCapacityReservationsInput.Set(input)
+	if !e.NextError.IsNil() {
+		defer e.NextError.Reset()
+		return nil, e.NextError.Get()
+	}
+	if e.DescribeCapacityReservationsOutput.IsNil() {
+		return &ec2.DescribeCapacityReservationsOutput{}, nil
+	}
+	output := e.DescribeCapacityReservationsOutput.Clone()
+	output.CapacityReservations = lo.Filter(output.CapacityReservations, func(cr *ec2.CapacityReservation, _ int) bool {
+		if len(input.CapacityReservationIds) > 0 && !lo.Contains(aws.StringValueSlice(input.CapacityReservationIds), aws.StringValue(cr.CapacityReservationId)) {
+			return false
+		}
+		return Filter(input.Filters, aws.StringValue(cr.CapacityReservationId), "", cr.Tags)
+	})
 	return output, nil
 }
 
@@ -405,25 +611,28 @@ func (e *EC2API) DescribeSecurityGroupsWithContext(ctx context.Context, input *e
 	if !e.DescribeSecurityGroupsOutput.IsNil() {
 		describeSecurityGroupsOutput := e.DescribeSecurityGroupsOutput.Clone()
 		describeSecurityGroupsOutput.SecurityGroups = FilterDescribeSecurtyGroups(describeSecurityGroupsOutput.SecurityGroups, input.Filters)
-		return e.DescribeSecurityGroupsOutput.Clone(), nil
+		return describeSecurityGroupsOutput, nil
 	}
 	sgs := []*ec2.SecurityGroup{
 		{
-			GroupId: aws.String("sg-test1"),
+			GroupId:   aws.String("sg-test1"),
+			GroupName: aws.String("securityGroup-test1"),
 			Tags: []*ec2.Tag{
 				{Key: aws.String("Name"), Value: aws.String("test-security-group-1")},
 				{Key: aws.String("foo"), Value: aws.String("bar")},
 			},
 		},
 		{
-			GroupId: aws.String("sg-test2"),
+			GroupId:   aws.String("sg-test2"),
+			GroupName: aws.String("securityGroup-test2"),
 			Tags: []*ec2.Tag{
 				{Key: aws.String("Name"), Value: aws.String("test-security-group-2")},
 				{Key: aws.String("foo"), Value: aws.String("bar")},
 			},
 		},
 		{
-			GroupId: aws.String("sg-test3"),
+			GroupId:   aws.String("sg-test3"),
+			GroupName: aws.String("securityGroup-test3"),
 			Tags: []*ec2.Tag{
 				{Key: aws.String("Name"), Value: aws.String("test-security-group-3")},
 				{Key: aws.String("TestTag")},
@@ -0,0 +1,149 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/samber/lo"
+)
+
+// IAMAPIBehavior must be reset between tests otherwise tests will
+// pollute each other.
+type IAMAPIBehavior struct {
+	// ListInstanceProfilesBehavior's output holds every instance profile along with its tags. Like the real API, tags
+	// are only returned when listing the tags of a single profile.
+	ListInstanceProfilesBehavior    MockedFunction[iam.ListInstanceProfilesInput, iam.ListInstanceProfilesOutput]
+	ListInstanceProfileTagsBehavior MockedFunction[iam.ListInstanceProfileTagsInput, iam.ListInstanceProfileTagsOutput]
+	GetInstanceProfileBehavior      MockedFunction[iam.GetInstanceProfileInput, iam.GetInstanceProfileOutput]
+	// ListAttachedRolePoliciesBehavior's output is returned for every role
+	ListAttachedRolePoliciesBehavior MockedFunction[iam.ListAttachedRolePoliciesInput, iam.ListAttachedRolePoliciesOutput]
+	SimulatePrincipalPolicyBehavior  MockedFunction[iam.SimulatePrincipalPolicyInput, iam.SimulatePolicyResponse]
+	// RemoveRoleFromInstanceProfileBehavior and DeleteInstanceProfileBehavior record their inputs, but don't modify the
+	// instance profiles of ListInstanceProfilesBehavior
+	RemoveRoleFromInstanceProfileBehavior MockedFunction[iam.RemoveRoleFromInstanceProfileInput, iam.RemoveRoleFromInstanceProfileOutput]
+	DeleteInstanceProfileBehavior         MockedFunction[iam.DeleteInstanceProfileInput, iam.DeleteInstanceProfileOutput]
+}
+
+type IAMAPI struct {
+	iamiface.IAMAPI
+	IAMAPIBehavior
+}
+
+// Reset must be called between tests otherwise tests will pollute
+// each other.
+func (s *IAMAPI) Reset() {
+	s.ListInstanceProfilesBehavior.Reset()
+	s.ListInstanceProfileTagsBehavior.Reset()
+	s.GetInstanceProfileBehavior.Reset()
+	s.ListAttachedRolePoliciesBehavior.Reset()
+	s.SimulatePrincipalPolicyBehavior.Reset()
+	s.RemoveRoleFromInstanceProfileBehavior.Reset()
+	s.DeleteInstanceProfileBehavior.Reset()
+}
+
+func (s *IAMAPI) ListInstanceProfilesPagesWithContext(_ context.Context, input *iam.ListInstanceProfilesInput, fn func(*iam.ListInstanceProfilesOutput, bool) bool, _ ...request.Option) error {
+	output, err := s.ListInstanceProfilesBehavior.Invoke(input)
+	if err != nil {
+		return err
+	}
+	for _, profile := range output.InstanceProfiles {
+		profile.Tags = nil
+	}
+	fn(output, true)
+	return nil
+}
+
+func (s *IAMAPI) ListInstanceProfileTagsWithContext(_ context.Context, input *iam.ListInstanceProfileTagsInput, _ ...request.Option) (*iam.ListInstanceProfileTagsOutput, error) {
+	if _, err := s.ListInstanceProfileTagsBehavior.Invoke(input); err != nil {
+		return nil, err
+	}
+	profile, err := s.instanceProfile(aws.StringValue(input.InstanceProfileName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListInstanceProfileTagsOutput{Tags: profile.Tags}, nil
+}
+
+func (s *IAMAPI) GetInstanceProfileWithContext(_ context.Context, input *iam.GetInstanceProfileInput, _ ...request.Option) (*iam.GetInstanceProfileOutput, error) {
+	if _, err := s.GetInstanceProfileBehavior.Invoke(input); err != nil {
+		return nil, err
+	}
+	profile, err := s.instanceProfile(aws.StringValue(input.InstanceProfileName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetInstanceProfileOutput{InstanceProfile: profile}, nil
+}
+
+func (s *IAMAPI) ListAttachedRolePoliciesPagesWithContext(_ context.Context, input *iam.ListAttachedRolePoliciesInput, fn func(*iam.ListAttachedRolePoliciesOutput, bool) bool, _ ...request.Option) error {
+	output, err := s.ListAttachedRolePoliciesBehavior.Invoke(input)
+	if err != nil {
+		return err
+	}
+	fn(output, true)
+	return nil
+}
+
+// SimulatePrincipalPolicyWithContext denies every action that isn't allowed by the behavior's output
+func (s *IAMAPI) SimulatePrincipalPolicyWithContext(_ context.Context, input *iam.SimulatePrincipalPolicyInput, _ ...request.Option) (*iam.SimulatePolicyResponse, error) {
+	output, err := s.SimulatePrincipalPolicyBehavior.Invoke(input)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.SimulatePolicyResponse{EvaluationResults: lo.Map(input.ActionNames, func(action *string, _ int) *iam.EvaluationResult {
+		if result, ok := lo.Find(output.EvaluationResults, func(r *iam.EvaluationResult) bool {
+			return aws.StringValue(r.EvalActionName) == aws.StringValue(action)
+		}); ok {
+			return result
+		}
+		return &iam.EvaluationResult{EvalActionName: action, EvalDecision: aws.String(iam.PolicyEvaluationDecisionTypeImplicitDeny)}
+	})}, nil
+}
+
+func (s *IAMAPI) RemoveRoleFromInstanceProfileWithContext(_ context.Context, input *iam.RemoveRoleFromInstanceProfileInput, _ ...request.Option) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	if _, err := s.instanceProfile(aws.StringValue(input.InstanceProfileName)); err != nil {
+		return nil, err
+	}
+	return s.RemoveRoleFromInstanceProfileBehavior.Invoke(input)
+}
+
+func (s *IAMAPI) DeleteInstanceProfileWithContext(_ context.Context, input *iam.DeleteInstanceProfileInput, _ ...request.Option) (*iam.DeleteInstanceProfileOutput, error) {
+	if _, err := s.instanceProfile(aws.StringValue(input.InstanceProfileName)); err != nil {
+		return nil, err
+	}
+	return s.DeleteInstanceProfileBehavior.Invoke(input)
+}
+
+// instanceProfile returns the instance profile from the output of ListInstanceProfilesBehavior, along with its tags
+func (s *IAMAPI) instanceProfile(name string) (*iam.InstanceProfile, error) {
+	var profiles []*iam.InstanceProfile
+	if !s.ListInstanceProfilesBehavior.Output.IsNil() {
+		profiles = s.ListInstanceProfilesBehavior.Output.Clone().InstanceProfiles
+	}
+	profile, ok := lo.Find(profiles, func(profile *iam.InstanceProfile) bool {
+		return aws.StringValue(profile.InstanceProfileName) == name
+	})
+	if !ok {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, fmt.Sprintf("instance profile %s not found", name), nil)
+	}
+	return profile, nil
+}
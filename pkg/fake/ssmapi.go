@@ -17,10 +17,12 @@ package fake
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mitchellh/hashstructure/v2"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
@@ -29,13 +31,22 @@ import (
 type SSMAPI struct {
 	ssmiface.SSMAPI
 	GetParameterOutput *ssm.GetParameterOutput
-	WantErr            error
+	// Parameters holds custom parameters keyed by path. Public parameters (under /aws/service/) are always
+	// resolved, while any other parameter that isn't present here is treated as not found.
+	Parameters map[string]string
+	WantErr    error
 }
 
 func (a SSMAPI) GetParameterWithContext(ctx context.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
 	if a.WantErr != nil {
 		return nil, a.WantErr
 	}
+	if value, ok := a.Parameters[aws.StringValue(input.Name)]; ok {
+		return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+	}
+	if a.Parameters != nil && !strings.HasPrefix(aws.StringValue(input.Name), "/aws/service/") {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, fmt.Sprintf("parameter %s not found", aws.StringValue(input.Name)), nil)
+	}
 	hc, _ := hashstructure.Hash(input.Name, hashstructure.FormatV2, nil)
 	if a.GetParameterOutput != nil {
 		return a.GetParameterOutput, nil
@@ -48,5 +59,6 @@ func (a SSMAPI) GetParameterWithContext(ctx context.Context, input *ssm.GetParam
 
 func (a *SSMAPI) Reset() {
 	a.GetParameterOutput = nil
+	a.Parameters = nil
 	a.WantErr = nil
 }
@@ -44,6 +44,11 @@ func PrivateDNSName() string {
 	return fmt.Sprintf("ip-192-168-%d-%d.%s.compute.internal", randomdata.Number(0, 256), randomdata.Number(0, 256), defaultRegion)
 }
 
+// ResourceDNSName returns the resource-based hostname of an instance
+func ResourceDNSName(instanceID string) string {
+	return fmt.Sprintf("%s.%s.compute.internal", instanceID, defaultRegion)
+}
+
 // SubnetsFromFleetRequest returns a unique slice of subnetIDs passed as overrides from a CreateFleetInput
 func SubnetsFromFleetRequest(createFleetInput *ec2.CreateFleetInput) []string {
 	return lo.Uniq(lo.Flatten(lo.Map(createFleetInput.LaunchTemplateConfigs, func(ltReq *ec2.FleetLaunchTemplateConfigRequest, _ int) []string {
@@ -60,8 +65,12 @@ func SubnetsFromFleetRequest(createFleetInput *ec2.CreateFleetInput) []string {
 // FilterDescribeSecurtyGroups filters the passed in security groups based on the filters passed in.
 // Filters are chained with a logical "AND"
 func FilterDescribeSecurtyGroups(sgs []*ec2.SecurityGroup, filters []*ec2.Filter) []*ec2.SecurityGroup {
+	isNameFilter := func(f *ec2.Filter, _ int) bool { return aws.StringValue(f.Name) == "group-name" }
+	nameFilters, otherFilters := lo.Filter(filters, isNameFilter), lo.Reject(filters, isNameFilter)
 	return lo.Filter(sgs, func(group *ec2.SecurityGroup, _ int) bool {
-		return Filter(filters, *group.GroupId, group.Tags)
+		return lo.EveryBy(nameFilters, func(f *ec2.Filter) bool {
+			return lo.Contains(aws.StringValueSlice(f.Values), aws.StringValue(group.GroupName))
+		}) && Filter(otherFilters, *group.GroupId, aws.StringValue(group.VpcId), group.Tags)
 	})
 }
 
@@ -69,11 +78,11 @@ func FilterDescribeSecurtyGroups(sgs []*ec2.SecurityGroup, filters []*ec2.Filter
 // Filters are chained with a logical "AND"
 func FilterDescribeSubnets(subnets []*ec2.Subnet, filters []*ec2.Filter) []*ec2.Subnet {
 	return lo.Filter(subnets, func(subnet *ec2.Subnet, _ int) bool {
-		return Filter(filters, *subnet.SubnetId, subnet.Tags)
+		return Filter(filters, *subnet.SubnetId, aws.StringValue(subnet.VpcId), subnet.Tags)
 	})
 }
 
-func Filter(filters []*ec2.Filter, id string, tags []*ec2.Tag) bool {
+func Filter(filters []*ec2.Filter, id, vpcID string, tags []*ec2.Tag) bool {
 	return lo.EveryBy(filters, func(filter *ec2.Filter) bool {
 		switch filterName := aws.StringValue(filter.Name); {
 		case filterName == "subnet-id" || filterName == "group-id":
@@ -82,6 +91,12 @@ func Filter(filters []*ec2.Filter, id string, tags []*ec2.Tag) bool {
 					return true
 				}
 			}
+		case filterName == "vpc-id":
+			for _, val := range filter.Values {
+				if vpcID == aws.StringValue(val) {
+					return true
+				}
+			}
 		case strings.HasPrefix(filterName, "tag"):
 			if matchTags(tags, filter) {
 				return true
@@ -49,6 +49,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(10),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("dl1.24xlarge"),
@@ -86,6 +89,13 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				MaximumNetworkInterfaces:     aws.Int64(60),
 				Ipv4AddressesPerInterface:    aws.Int64(50),
 				EncryptionInTransitSupported: aws.Bool(true),
+				EfaSupported:                 aws.Bool(true),
+				EfaInfo: &ec2.EfaInfo{
+					MaximumEfaInterfaces: aws.Int64(4),
+				},
+			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
 			},
 		},
 		{
@@ -124,6 +134,13 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				MaximumNetworkInterfaces:     aws.Int64(4),
 				Ipv4AddressesPerInterface:    aws.Int64(15),
 				EncryptionInTransitSupported: aws.Bool(true),
+				EfaSupported:                 aws.Bool(true),
+				EfaInfo: &ec2.EfaInfo{
+					MaximumEfaInterfaces: aws.Int64(1),
+				},
+			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
 			},
 		},
 		{
@@ -156,6 +173,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(10),
 				EncryptionInTransitSupported: aws.Bool(true),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("inf1.6xlarge"),
@@ -187,6 +207,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(30),
 				EncryptionInTransitSupported: aws.Bool(true),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("m5.large"),
@@ -210,6 +233,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(10),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("m5.metal"),
@@ -233,6 +259,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(50),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("m5.xlarge"),
@@ -256,6 +285,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(15),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("p3.8xlarge"),
@@ -291,6 +323,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(30),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"cluster", "partition", "spread"}),
+			},
 		},
 		{
 			InstanceType:                  aws.String("t3.large"),
@@ -314,6 +349,9 @@ var defaultDescribeInstanceTypesOutput = &ec2.DescribeInstanceTypesOutput{
 				Ipv4AddressesPerInterface:    aws.Int64(12),
 				EncryptionInTransitSupported: aws.Bool(false),
 			},
+			PlacementGroupInfo: &ec2.PlacementGroupInfo{
+				SupportedStrategies: aws.StringSlice([]string{"partition", "spread"}),
+			},
 		},
 	},
 }
@@ -36,10 +36,11 @@ type AL2 struct {
 // SSMAlias returns the AMI Alias to query SSM
 func (a AL2) SSMAlias(version string, instanceType *cloudprovider.InstanceType) string {
 	amiSuffix := ""
-	if !resources.IsZero(instanceType.Capacity[v1alpha1.ResourceNVIDIAGPU]) || !resources.IsZero(instanceType.Capacity[v1alpha1.ResourceAWSNeuron]) {
-		amiSuffix = "-gpu"
-	} else if instanceType.Requirements.Get(v1.LabelArchStable).Has(v1alpha5.ArchitectureArm64) {
+	// The accelerated AMI is only built for x86_64, so accelerated arm64 instance types use the arm64 AMI
+	if instanceType.Requirements.Get(v1.LabelArchStable).Has(v1alpha5.ArchitectureArm64) {
 		amiSuffix = fmt.Sprintf("-%s", v1alpha5.ArchitectureArm64)
+	} else if !resources.IsZero(instanceType.Capacity[v1alpha1.ResourceNVIDIAGPU]) || !resources.IsZero(instanceType.Capacity[v1alpha1.ResourceAWSNeuron]) {
+		amiSuffix = "-gpu"
 	}
 	return fmt.Sprintf("/aws/service/eks/optimized-ami/%s/amazon-linux-2%s/recommended/image_id", version, amiSuffix)
 }
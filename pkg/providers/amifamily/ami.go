@@ -37,6 +37,7 @@ import (
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	awserrors "github.com/aws/karpenter/pkg/errors"
 
 	"github.com/aws/karpenter-core/pkg/cloudprovider"
 	"github.com/aws/karpenter-core/pkg/scheduling"
@@ -110,11 +111,8 @@ func (p *Provider) Get(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempla
 		// Iterate through AMIs in order of creation date to use latest AMI
 		amis := sortAMIsByCreationDate(amiRequirements)
 		for _, instanceType := range instanceTypes {
-			for _, ami := range amis {
-				if err := instanceType.Requirements.Compatible(amiRequirements[ami]); err == nil {
-					amiIDs[ami.AmiID] = append(amiIDs[ami.AmiID], instanceType)
-					break
-				}
+			if ami, ok := lo.Find(amis, func(ami AMI) bool { return compatible(instanceType, amiRequirements[ami]) }); ok {
+				amiIDs[ami.AmiID] = append(amiIDs[ami.AmiID], instanceType)
 			}
 		}
 		if len(amiIDs) == 0 {
@@ -122,7 +120,7 @@ func (p *Provider) Get(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempla
 		}
 	} else {
 		for _, instanceType := range instanceTypes {
-			amiID, err := p.getDefaultAMIFromSSM(ctx, amiFamily.SSMAlias(kubernetesVersion, instanceType))
+			amiID, err := p.getAMIFromSSM(ctx, amiFamily.SSMAlias(kubernetesVersion, instanceType))
 			if err != nil {
 				return nil, err
 			}
@@ -132,7 +130,30 @@ func (p *Provider) Get(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempla
 	return amiIDs, nil
 }
 
-func (p *Provider) getDefaultAMIFromSSM(ctx context.Context, ssmQuery string) (string, error) {
+// CompatibleInstanceTypes returns the instance types that can be launched with one of the AMIs selected by the node
+// template, so that an instance type is never paired with an AMI of a different architecture. Every instance type is
+// compatible when the node template doesn't select AMIs, since the AMI family resolves its AMIs per architecture.
+func (p *Provider) CompatibleInstanceTypes(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, instanceTypes []*cloudprovider.InstanceType) ([]*cloudprovider.InstanceType, error) {
+	amiRequirements, err := p.getAMIRequirements(ctx, nodeTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if len(amiRequirements) == 0 {
+		return instanceTypes, nil
+	}
+	return lo.Filter(instanceTypes, func(instanceType *cloudprovider.InstanceType, _ int) bool {
+		return lo.SomeBy(lo.Values(amiRequirements), func(requirements scheduling.Requirements) bool {
+			return compatible(instanceType, requirements)
+		})
+	}), nil
+}
+
+// compatible returns true if the instance type satisfies the requirements of an AMI, which always include its architecture
+func compatible(instanceType *cloudprovider.InstanceType, amiRequirements scheduling.Requirements) bool {
+	return instanceType.Requirements.Compatible(amiRequirements) == nil
+}
+
+func (p *Provider) getAMIFromSSM(ctx context.Context, ssmQuery string) (string, error) {
 	if id, ok := p.ssmCache.Get(ssmQuery); ok {
 		return id.(string), nil
 	}
@@ -152,7 +173,32 @@ func (p *Provider) getAMIRequirements(ctx context.Context, nodeTemplate *v1alpha
 	if len(nodeTemplate.Spec.AMISelector) == 0 {
 		return map[AMI]scheduling.Requirements{}, nil
 	}
-	return p.selectAMIs(ctx, nodeTemplate.Spec.AMISelector)
+	amiSelector, err := p.resolveSSMParameter(ctx, nodeTemplate.Spec.AMISelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(amiSelector) == 0 {
+		return map[AMI]scheduling.Requirements{}, nil
+	}
+	return p.selectAMIs(ctx, amiSelector)
+}
+
+// resolveSSMParameter replaces an "aws::ssm" parameter path in the amiSelector with the AMI ID stored in that parameter.
+// A parameter that doesn't exist is an error rather than a reason to fall back to the AMI family defaults, since the
+// user asked for the AMIs of that parameter.
+func (p *Provider) resolveSSMParameter(ctx context.Context, amiSelector map[string]string) (map[string]string, error) {
+	path, ok := amiSelector["aws::ssm"]
+	if !ok {
+		return amiSelector, nil
+	}
+	amiID, err := p.getAMIFromSSM(ctx, path)
+	if err != nil {
+		if lo.Contains(awserrors.Codes(err), ssm.ErrCodeParameterNotFound) {
+			return nil, fmt.Errorf("ssm parameter %q from amiSelector doesn't exist, %w", path, err)
+		}
+		return nil, err
+	}
+	return lo.Assign(lo.OmitByKeys(amiSelector, []string{"aws::ssm"}), map[string]string{"aws::ids": amiID}), nil
 }
 
 func (p *Provider) selectAMIs(ctx context.Context, amiSelector map[string]string) (map[AMI]scheduling.Requirements, error) {
@@ -172,7 +218,8 @@ func (p *Provider) selectAMIs(ctx context.Context, amiSelector map[string]string
 
 func (p *Provider) fetchAMIsFromEC2(ctx context.Context, amiSelector map[string]string) ([]*ec2.Image, error) {
 	filters, owners := getFiltersAndOwners(amiSelector)
-	hash, err := hashstructure.Hash(filters, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	// Key the cache on both filters and owners so that any change to the amiSelector results in a new lookup
+	hash, err := hashstructure.Hash([]interface{}{filters, owners}, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	if err != nil {
 		return nil, err
 	}
@@ -236,10 +283,14 @@ func getFiltersAndOwners(amiSelector map[string]string) ([]*ec2.Filter, []*strin
 func sortAMIsByCreationDate(amiRequirements map[AMI]scheduling.Requirements) []AMI {
 	amis := lo.Keys(amiRequirements)
 
+	// Sort newest first, breaking ties on the image ID so that selection is deterministic
 	sort.Slice(amis, func(i, j int) bool {
 		itime, _ := time.Parse(time.RFC3339, amis[i].CreationDate)
 		jtime, _ := time.Parse(time.RFC3339, amis[j].CreationDate)
-		return itime.Unix() >= jtime.Unix()
+		if itime.Unix() != jtime.Unix() {
+			return itime.Unix() > jtime.Unix()
+		}
+		return amis[i].AmiID < amis[j].AmiID
 	})
 	return amis
 }
@@ -252,7 +303,7 @@ func (p *Provider) getRequirementsFromImage(ec2Image *ec2.Image) scheduling.Requ
 		}
 	}
 	// Always add the architecture of an image as a requirement, irrespective of what's specified in EC2 tags.
-	architecture := *ec2Image.Architecture
+	architecture := aws.StringValue(ec2Image.Architecture)
 	if value, ok := v1alpha1.AWSToKubeArchitectures[architecture]; ok {
 		architecture = value
 	}
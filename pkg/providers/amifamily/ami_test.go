@@ -19,6 +19,15 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/scheduling"
+
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -141,3 +150,49 @@ var _ = Describe("AMI Selectors", func() {
 		}))
 	})
 })
+
+var _ = Describe("AMI Sorting", func() {
+	It("should sort amis by creation date, newest first", func() {
+		amis := sortAMIsByCreationDate(map[AMI]scheduling.Requirements{
+			{AmiID: "ami-123", CreationDate: "2022-08-10T12:00:00Z"}: scheduling.NewRequirements(),
+			{AmiID: "ami-456", CreationDate: "2022-08-15T12:00:00Z"}: scheduling.NewRequirements(),
+			{AmiID: "ami-789", CreationDate: "2022-08-01T12:00:00Z"}: scheduling.NewRequirements(),
+		})
+		Expect(lo.Map(amis, func(a AMI, _ int) string { return a.AmiID })).To(Equal([]string{"ami-456", "ami-123", "ami-789"}))
+	})
+	It("should break ties on creation date by image id", func() {
+		amis := sortAMIsByCreationDate(map[AMI]scheduling.Requirements{
+			{AmiID: "ami-789", CreationDate: "2022-08-15T12:00:00Z"}: scheduling.NewRequirements(),
+			{AmiID: "ami-123", CreationDate: "2022-08-15T12:00:00Z"}: scheduling.NewRequirements(),
+			{AmiID: "ami-456", CreationDate: "2022-08-15T12:00:00Z"}: scheduling.NewRequirements(),
+			{AmiID: "ami-000", CreationDate: "2022-08-10T12:00:00Z"}: scheduling.NewRequirements(),
+		})
+		Expect(lo.Map(amis, func(a AMI, _ int) string { return a.AmiID })).To(Equal([]string{"ami-123", "ami-456", "ami-789", "ami-000"}))
+	})
+})
+
+var _ = Describe("AMI Architecture", func() {
+	instanceType := func(arch string, capacity v1.ResourceList) *cloudprovider.InstanceType {
+		return &cloudprovider.InstanceType{
+			Requirements: scheduling.NewRequirements(scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, arch)),
+			Capacity:     capacity,
+		}
+	}
+	It("should always require the architecture of the image", func() {
+		requirements := (&Provider{}).getRequirementsFromImage(&ec2.Image{ImageId: aws.String("ami-123"), Architecture: aws.String("arm64")})
+		Expect(requirements.Get(v1.LabelArchStable).Values()).To(ConsistOf(v1alpha5.ArchitectureArm64))
+		Expect(compatible(instanceType(v1alpha5.ArchitectureArm64, nil), requirements)).To(BeTrue())
+		Expect(compatible(instanceType(v1alpha5.ArchitectureAmd64, nil), requirements)).To(BeFalse())
+	})
+	It("should resolve the arm64 AL2 AMI for an arm64 instance type", func() {
+		Expect(AL2{}.SSMAlias("1.25", instanceType(v1alpha5.ArchitectureArm64, nil))).To(ContainSubstring("amazon-linux-2-arm64"))
+	})
+	It("should resolve the arm64 AL2 AMI for an accelerated arm64 instance type", func() {
+		capacity := v1.ResourceList{v1alpha1.ResourceNVIDIAGPU: resource.MustParse("1")}
+		Expect(AL2{}.SSMAlias("1.25", instanceType(v1alpha5.ArchitectureArm64, capacity))).To(ContainSubstring("amazon-linux-2-arm64"))
+	})
+	It("should resolve the accelerated AL2 AMI for an accelerated amd64 instance type", func() {
+		capacity := v1.ResourceList{v1alpha1.ResourceNVIDIAGPU: resource.MustParse("1")}
+		Expect(AL2{}.SSMAlias("1.25", instanceType(v1alpha5.ArchitectureAmd64, capacity))).To(ContainSubstring("amazon-linux-2-gpu"))
+	})
+})
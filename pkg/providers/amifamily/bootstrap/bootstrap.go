@@ -15,11 +15,38 @@ limitations under the License.
 package bootstrap
 
 import (
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 )
 
+var (
+	// kubeletLabels are the labels in the kubernetes.io and k8s.io domains that the kubelet is allowed to register the
+	// node with, along with any label in kubeletLabelNamespaces
+	// https://github.com/kubernetes/kubernetes/blob/v1.25.0/staging/src/k8s.io/kubelet/pkg/apis/well_known_labels.go
+	kubeletLabels = sets.NewString(
+		core.LabelHostname,
+		core.LabelTopologyZone,
+		core.LabelTopologyRegion,
+		core.LabelFailureDomainBetaZone,
+		core.LabelFailureDomainBetaRegion,
+		core.LabelInstanceType,
+		core.LabelInstanceTypeStable,
+		core.LabelOSStable,
+		core.LabelArchStable,
+		core.LabelWindowsBuild,
+		"beta.kubernetes.io/os",
+		"beta.kubernetes.io/arch",
+	)
+	kubeletLabelNamespaces = []string{core.LabelNamespaceSuffixKubelet, core.LabelNamespaceSuffixNode}
+	kubernetesNamespaces   = []string{"kubernetes.io", "k8s.io"}
+)
+
 // Options is the node bootstrapping parameters passed from Karpenter to the provisioning node
 type Options struct {
 	ClusterName             string
@@ -40,3 +67,26 @@ type Options struct {
 type Bootstrapper interface {
 	Script() (string, error)
 }
+
+// KubeletLabels splits the labels into the ones that the kubelet can register the node with and the keys of the ones it
+// rejects. The kubelet refuses to start when it's passed a label in the kubernetes.io or k8s.io domains that it isn't
+// allowed to set, such as the labels of the node-restriction.kubernetes.io domain.
+func KubeletLabels(labels map[string]string) (map[string]string, []string) {
+	allowed := lo.PickBy(labels, func(key string, _ string) bool { return isKubeletLabel(key) })
+	rejected := lo.Without(lo.Keys(labels), lo.Keys(allowed)...)
+	sort.Strings(rejected)
+	return allowed, rejected
+}
+
+func isKubeletLabel(key string) bool {
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok || kubeletLabels.Has(key) || !inNamespace(namespace, kubernetesNamespaces) {
+		return true
+	}
+	return inNamespace(namespace, kubeletLabelNamespaces)
+}
+
+// inNamespace returns true if the label namespace is one of the namespaces or a subdomain of one
+func inNamespace(namespace string, namespaces []string) bool {
+	return lo.SomeBy(namespaces, func(n string) bool { return namespace == n || strings.HasSuffix(namespace, "."+n) })
+}
@@ -51,12 +51,24 @@ func (b Bottlerocket) Script() (string, error) {
 	if b.KubeletConfig != nil && len(b.KubeletConfig.ClusterDNS) > 0 {
 		s.Settings.Kubernetes.ClusterDNSIP = &b.KubeletConfig.ClusterDNS[0]
 	}
+	// Kubelet settings from the provisioner take precedence, but anything the provisioner leaves unset
+	// keeps the value from custom UserData rather than being cleared
 	if b.KubeletConfig != nil {
-		s.Settings.Kubernetes.SystemReserved = resources.StringMap(b.KubeletConfig.SystemReserved)
-		s.Settings.Kubernetes.KubeReserved = resources.StringMap(b.KubeletConfig.KubeReserved)
-		s.Settings.Kubernetes.EvictionHard = b.KubeletConfig.EvictionHard
-		s.Settings.Kubernetes.ImageGCLowThresholdPercent = b.KubeletConfig.ImageGCLowThresholdPercent
-		s.Settings.Kubernetes.ImageGCHighThresholdPercent = b.KubeletConfig.ImageGCHighThresholdPercent
+		if len(b.KubeletConfig.SystemReserved) > 0 {
+			s.Settings.Kubernetes.SystemReserved = resources.StringMap(b.KubeletConfig.SystemReserved)
+		}
+		if len(b.KubeletConfig.KubeReserved) > 0 {
+			s.Settings.Kubernetes.KubeReserved = resources.StringMap(b.KubeletConfig.KubeReserved)
+		}
+		if len(b.KubeletConfig.EvictionHard) > 0 {
+			s.Settings.Kubernetes.EvictionHard = b.KubeletConfig.EvictionHard
+		}
+		if b.KubeletConfig.ImageGCLowThresholdPercent != nil {
+			s.Settings.Kubernetes.ImageGCLowThresholdPercent = b.KubeletConfig.ImageGCLowThresholdPercent
+		}
+		if b.KubeletConfig.ImageGCHighThresholdPercent != nil {
+			s.Settings.Kubernetes.ImageGCHighThresholdPercent = b.KubeletConfig.ImageGCHighThresholdPercent
+		}
 	}
 
 	s.Settings.Kubernetes.NodeTaints = map[string][]string{}
@@ -67,5 +79,9 @@ func (b Bottlerocket) Script() (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("constructing toml UserData %w", err)
 	}
+	// Make sure the merged settings still parse before handing them to the instance
+	if _, err = NewBottlerocketConfig(aws.String(string(script))); err != nil {
+		return "", fmt.Errorf("validating merged toml UserData %w", err)
+	}
 	return base64.StdEncoding.EncodeToString(script), nil
 }
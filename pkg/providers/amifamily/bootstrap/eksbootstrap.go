@@ -33,7 +33,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/ptr"
 
-	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 	"github.com/aws/karpenter-core/pkg/utils/resources"
 )
 
@@ -139,9 +138,6 @@ func (e EKS) nodeLabelArg() string {
 	keys := lo.Keys(e.Labels)
 	sort.Strings(keys) // ensures this list is deterministic, for easy testing.
 	for _, key := range keys {
-		if v1alpha5.LabelDomainExceptions.Has(key) {
-			continue
-		}
 		once.Do(func() { nodeLabelArg = "--node-labels=" })
 		labelStrings = append(labelStrings, fmt.Sprintf("%s=%v", key, e.Labels[key]))
 	}
@@ -149,13 +145,15 @@ func (e EKS) nodeLabelArg() string {
 }
 
 // joinParameterArgs joins a map of keys and values by their separator. The separator will sit between the
-// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2
+// arguments in a comma-separated list i.e. arg1<sep>val1,arg2<sep>val2. Arguments are sorted so that equivalent
+// maps always render the same user data.
 func joinParameterArgs[K comparable, V any](name string, m map[K]V, separator string) string {
 	var args []string
 
 	for k, v := range m {
 		args = append(args, fmt.Sprintf("%v%s%v", k, separator, v))
 	}
+	sort.Strings(args)
 	if len(args) > 0 {
 		return fmt.Sprintf(" %s=%s", name, strings.Join(args, ","))
 	}
@@ -0,0 +1,83 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"knative.dev/pkg/ptr"
+
+	"github.com/aws/karpenter-core/pkg/utils/resources"
+)
+
+type Windows struct {
+	Options
+}
+
+// Script generates a PowerShell script that joins the node to the cluster using the bootstrap script that ships with
+// the EKS optimized Windows AMIs. Custom UserData is expected to be PowerShell and runs before the node is bootstrapped.
+func (w Windows) Script() (string, error) {
+	var userData bytes.Buffer
+	userData.WriteString("<powershell>\n")
+	if customUserData := strings.TrimSpace(lo.FromPtr(w.CustomUserData)); customUserData != "" {
+		// Strip any tags from the custom UserData, since the script is wrapped in a single PowerShell block
+		customUserData = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(customUserData, "<powershell>"), "</powershell>"))
+		userData.WriteString(customUserData + "\n")
+	}
+	userData.WriteString("[string]$EKSBootstrapScriptFile = \"$env:ProgramFiles\\Amazon\\EKS\\Start-EKSBootstrap.ps1\"\n")
+	userData.WriteString(fmt.Sprintf("& $EKSBootstrapScriptFile -EKSClusterName '%s' -APIServerEndpoint '%s'", w.ClusterName, w.ClusterEndpoint))
+	if w.CABundle != nil {
+		userData.WriteString(fmt.Sprintf(" -Base64ClusterCA '%s'", *w.CABundle))
+	}
+	if kubeletExtraArgs := w.kubeletExtraArgs(); kubeletExtraArgs != "" {
+		userData.WriteString(fmt.Sprintf(" -KubeletExtraArgs '%s'", kubeletExtraArgs))
+	}
+	if w.KubeletConfig != nil && len(w.KubeletConfig.ClusterDNS) > 0 {
+		userData.WriteString(fmt.Sprintf(" -DNSClusterIP '%s'", w.KubeletConfig.ClusterDNS[0]))
+	}
+	userData.WriteString("\n</powershell>")
+	return base64.StdEncoding.EncodeToString(userData.Bytes()), nil
+}
+
+func (w Windows) kubeletExtraArgs() string {
+	// Labels and taints are formatted the same way as they are for the Linux bootstrap script
+	eks := EKS{Options: w.Options}
+	var kubeletExtraArgs strings.Builder
+	kubeletExtraArgs.WriteString(strings.Join(lo.Compact([]string{eks.nodeLabelArg(), eks.nodeTaintArg()}), " "))
+	if w.KubeletConfig != nil && w.KubeletConfig.MaxPods != nil {
+		kubeletExtraArgs.WriteString(fmt.Sprintf(" --max-pods=%d", ptr.Int32Value(w.KubeletConfig.MaxPods)))
+	} else if !w.AWSENILimitedPodDensity {
+		kubeletExtraArgs.WriteString(" --max-pods=110")
+	}
+	if w.KubeletConfig != nil && w.KubeletConfig.PodsPerCore != nil {
+		kubeletExtraArgs.WriteString(fmt.Sprintf(" --pods-per-core=%d", ptr.Int32Value(w.KubeletConfig.PodsPerCore)))
+	}
+	if w.KubeletConfig != nil {
+		kubeletExtraArgs.WriteString(joinParameterArgs("--system-reserved", resources.StringMap(w.KubeletConfig.SystemReserved), "="))
+		kubeletExtraArgs.WriteString(joinParameterArgs("--kube-reserved", resources.StringMap(w.KubeletConfig.KubeReserved), "="))
+		kubeletExtraArgs.WriteString(joinParameterArgs("--eviction-hard", w.KubeletConfig.EvictionHard, "<"))
+		if w.KubeletConfig.ImageGCHighThresholdPercent != nil {
+			kubeletExtraArgs.WriteString(fmt.Sprintf(" --image-gc-high-threshold=%d", ptr.Int32Value(w.KubeletConfig.ImageGCHighThresholdPercent)))
+		}
+		if w.KubeletConfig.ImageGCLowThresholdPercent != nil {
+			kubeletExtraArgs.WriteString(fmt.Sprintf(" --image-gc-low-threshold=%d", ptr.Int32Value(w.KubeletConfig.ImageGCLowThresholdPercent)))
+		}
+	}
+	return strings.Trim(kubeletExtraArgs.String(), " ")
+}
@@ -0,0 +1,50 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package amifamily
+
+import (
+	"sync"
+
+	"github.com/samber/lo"
+
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+)
+
+// Factory constructs an AMIFamily with the static launch template parameters
+type Factory func(options *Options) AMIFamily
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		v1alpha1.AMIFamilyAL2:          func(options *Options) AMIFamily { return &AL2{Options: options} },
+		v1alpha1.AMIFamilyBottlerocket: func(options *Options) AMIFamily { return &Bottlerocket{Options: options} },
+		v1alpha1.AMIFamilyUbuntu:       func(options *Options) AMIFamily { return &Ubuntu{Options: options} },
+		v1alpha1.AMIFamilyWindows2019:  func(options *Options) AMIFamily { return &Windows{Options: options, Version: windows2019} },
+		v1alpha1.AMIFamilyWindows2022:  func(options *Options) AMIFamily { return &Windows{Options: options, Version: windows2022} },
+		v1alpha1.AMIFamilyCustom:       func(options *Options) AMIFamily { return &Custom{Options: options} },
+	}
+)
+
+// Register makes an AMI family available to node templates that set spec.amiFamily to its name, replacing any
+// family already registered with the name. Families should be registered before the controllers are started, since
+// node template validation only accepts the families that are registered at that point.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+	if !lo.Contains(v1alpha1.SupportedAMIFamilies, name) {
+		v1alpha1.SupportedAMIFamilies = append(v1alpha1.SupportedAMIFamilies, name)
+	}
+}
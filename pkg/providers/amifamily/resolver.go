@@ -16,6 +16,7 @@ package amifamily
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -25,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	"github.com/aws/karpenter/pkg/providers/amifamily/bootstrap"
 
@@ -55,27 +57,46 @@ type Options struct {
 	Tags              map[string]string
 	Labels            map[string]string `hash:"ignore"`
 	KubeDNSIP         net.IP
+	// IPv6Only is set when the instances are launched into IPv6-native subnets
+	IPv6Only bool
 }
 
 // LaunchTemplate holds the dynamically generated launch template parameters
 type LaunchTemplate struct {
 	*Options
-	UserData            bootstrap.Bootstrapper
-	BlockDeviceMappings []*v1alpha1.BlockDeviceMapping
-	MetadataOptions     *v1alpha1.MetadataOptions
-	AMIID               string
-	InstanceTypes       []*cloudprovider.InstanceType `hash:"ignore"`
-	DetailedMonitoring  bool
+	UserData              bootstrap.Bootstrapper
+	BlockDeviceMappings   []*v1alpha1.BlockDeviceMapping
+	EncryptedByDefault    bool
+	KMSKeyID              *string
+	MetadataOptions       *v1alpha1.MetadataOptions
+	AMIID                 string
+	InstanceTypes         []*cloudprovider.InstanceType `hash:"ignore"`
+	DetailedMonitoring    bool
+	KeyName               *string
+	Placement             *v1alpha1.Placement
+	Tenancy               *string
+	HostID                *string
+	HostResourceGroupARN  *string
+	PrivateDNSNameOptions *v1alpha1.PrivateDNSNameOptions
+	EFA                   bool
+	NetworkInterfaces     []v1alpha1.NetworkInterface
 }
 
-// AMIFamily can be implemented to override the default logic for generating dynamic launch template parameters
+// AMIFamily can be implemented to override the default logic for generating dynamic launch template parameters.
+// Families other than the built-in ones can be made available to node templates with Register.
 type AMIFamily interface {
+	// SSMAlias returns the SSM parameter that resolves the AMI for the instance type
 	SSMAlias(version string, instanceType *cloudprovider.InstanceType) string
+	// UserData returns the bootstrapper that generates the user data joining the instance to the cluster
 	UserData(kubeletConfig *v1alpha5.KubeletConfiguration, taints []core.Taint, labels map[string]string, caBundle *string, instanceTypes []*cloudprovider.InstanceType, customUserData *string) bootstrap.Bootstrapper
 	DefaultBlockDeviceMappings() []*v1alpha1.BlockDeviceMapping
 	DefaultMetadataOptions() *v1alpha1.MetadataOptions
 	EphemeralBlockDevice() *string
 	FeatureFlags() FeatureFlags
+	// KubeReserved returns the resources reserved for the kubelet on an instance type with the cpus and max pods
+	KubeReserved(cpus, pods *resource.Quantity) core.ResourceList
+	// SystemReserved returns the resources reserved for the system daemons of the AMI
+	SystemReserved() core.ResourceList
 }
 
 // FeatureFlags describes whether the features below are enabled for a given AMIFamily
@@ -96,6 +117,46 @@ func (d DefaultFamily) FeatureFlags() FeatureFlags {
 	}
 }
 
+// KubeReserved computes the kube-reserved resources the same way as the EKS optimized AMIs, from
+// https://github.com/bottlerocket-os/bottlerocket/pull/1388/files#diff-bba9e4e3e46203be2b12f22e0d654ebd270f0b478dd34f40c31d7aa695620f2fR611
+func (d DefaultFamily) KubeReserved(cpus, pods *resource.Quantity) core.ResourceList {
+	resources := core.ResourceList{
+		core.ResourceMemory:           resource.MustParse(fmt.Sprintf("%dMi", (11*pods.Value())+255)),
+		core.ResourceEphemeralStorage: resource.MustParse("1Gi"), // default kube-reserved ephemeral-storage
+	}
+	for _, cpuRange := range []struct {
+		start      int64
+		end        int64
+		percentage float64
+	}{
+		{start: 0, end: 1000, percentage: 0.06},
+		{start: 1000, end: 2000, percentage: 0.01},
+		{start: 2000, end: 4000, percentage: 0.005},
+		{start: 4000, end: 1 << 31, percentage: 0.0025},
+	} {
+		if cpu := cpus.MilliValue(); cpu >= cpuRange.start {
+			r := float64(cpuRange.end - cpuRange.start)
+			if cpu < cpuRange.end {
+				r = float64(cpu - cpuRange.start)
+			}
+			cpuOverhead := resources.Cpu()
+			cpuOverhead.Add(*resource.NewMilliQuantity(int64(r*cpuRange.percentage), resource.DecimalSI))
+			resources[core.ResourceCPU] = *cpuOverhead
+		}
+	}
+	return resources
+}
+
+// SystemReserved returns the default system-reserved resources:
+// https://kubernetes.io/docs/tasks/administer-cluster/reserve-compute-resources/#system-reserved
+func (d DefaultFamily) SystemReserved() core.ResourceList {
+	return core.ResourceList{
+		core.ResourceCPU:              resource.MustParse("100m"),
+		core.ResourceMemory:           resource.MustParse("100Mi"),
+		core.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+	}
+}
+
 // New constructs a new launch template Resolver
 func New(kubeClient client.Client, amiProvider *Provider) *Resolver {
 	return &Resolver{
@@ -111,46 +172,117 @@ func (r Resolver) Resolve(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTem
 	if err != nil {
 		return nil, err
 	}
+	userData, err := nodeTemplate.Spec.DecodedUserData()
+	if err != nil {
+		return nil, fmt.Errorf("decoding user data, %w", err)
+	}
+	kubeletConfig := kubeletConfigWithReservedResources(ctx, machine.Spec.Kubelet)
 	var resolvedTemplates []*LaunchTemplate
 	for amiID, instanceTypes := range amiIDs {
-		resolved := &LaunchTemplate{
-			Options: options,
-			UserData: amiFamily.UserData(
-				machine.Spec.Kubelet,
-				append(machine.Spec.Taints, machine.Spec.StartupTaints...),
-				options.Labels,
-				options.CABundle,
-				instanceTypes,
-				nodeTemplate.Spec.UserData,
-			),
-			BlockDeviceMappings: nodeTemplate.Spec.BlockDeviceMappings,
-			MetadataOptions:     nodeTemplate.Spec.MetadataOptions,
-			DetailedMonitoring:  aws.BoolValue(nodeTemplate.Spec.DetailedMonitoring),
-			AMIID:               amiID,
-			InstanceTypes:       instanceTypes,
+		if !settings.FromContext(ctx).EnablePrefixDelegation || !settings.FromContext(ctx).EnableENILimitedPodDensity ||
+			(kubeletConfig != nil && kubeletConfig.MaxPods != nil) {
+			resolvedTemplates = append(resolvedTemplates, r.resolveLaunchTemplate(nodeTemplate, machine, kubeletConfig, amiFamily, amiID, userData, instanceTypes, options))
+			continue
 		}
-		if resolved.BlockDeviceMappings == nil {
-			resolved.BlockDeviceMappings = amiFamily.DefaultBlockDeviceMappings()
+		// The bootstrap scripts derive max-pods from ENI limits without accounting for prefix delegation, so the
+		// max-pods computed for the instance type is passed to the kubelet explicitly. This requires a separate
+		// launch template for each distinct max-pods value.
+		for maxPods, instanceTypes := range lo.GroupBy(instanceTypes, func(instanceType *cloudprovider.InstanceType) int64 {
+			return instanceType.Capacity.Pods().Value()
+		}) {
+			maxPodsKubeletConfig := &v1alpha5.KubeletConfiguration{}
+			if kubeletConfig != nil {
+				maxPodsKubeletConfig = kubeletConfig.DeepCopy()
+			}
+			maxPodsKubeletConfig.MaxPods = lo.ToPtr(int32(maxPods))
+			resolvedTemplates = append(resolvedTemplates, r.resolveLaunchTemplate(nodeTemplate, machine, maxPodsKubeletConfig, amiFamily, amiID, userData, instanceTypes, options))
 		}
-		if resolved.MetadataOptions == nil {
-			resolved.MetadataOptions = amiFamily.DefaultMetadataOptions()
-		}
-		resolvedTemplates = append(resolvedTemplates, resolved)
 	}
 	return resolvedTemplates, nil
 }
 
+// kubeletConfigWithReservedResources fills in the cluster-wide system-reserved and kube-reserved resources from
+// settings so that the kubelet reserves the same overhead that was subtracted from the instance type's allocatable.
+// Resources set on the provisioner take precedence.
+func kubeletConfigWithReservedResources(ctx context.Context, kubeletConfig *v1alpha5.KubeletConfiguration) *v1alpha5.KubeletConfiguration {
+	systemReserved, kubeReserved := settings.FromContext(ctx).SystemReserved, settings.FromContext(ctx).KubeReserved
+	if len(systemReserved) == 0 && len(kubeReserved) == 0 {
+		return kubeletConfig
+	}
+	if kubeletConfig == nil {
+		kubeletConfig = &v1alpha5.KubeletConfiguration{}
+	} else {
+		kubeletConfig = kubeletConfig.DeepCopy()
+	}
+	if len(systemReserved) > 0 {
+		kubeletConfig.SystemReserved = lo.Assign(systemReserved, kubeletConfig.SystemReserved)
+	}
+	if len(kubeReserved) > 0 {
+		kubeletConfig.KubeReserved = lo.Assign(kubeReserved, kubeletConfig.KubeReserved)
+	}
+	return kubeletConfig
+}
+
+// taints returns the taints that nodes register with, which are the taints and startup taints of the machine along with
+// the startup taints of the node template. A node template taint with the same key and effect as a machine taint is
+// dropped, so that nodes aren't registered with the same taint twice.
+func taints(nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine) []core.Taint {
+	taints := append(append([]core.Taint{}, machine.Spec.Taints...), machine.Spec.StartupTaints...)
+	for i := range nodeTemplate.Spec.StartupTaints {
+		taint := nodeTemplate.Spec.StartupTaints[i]
+		if !lo.ContainsBy(taints, func(t core.Taint) bool { return t.MatchTaint(&taint) }) {
+			taints = append(taints, taint)
+		}
+	}
+	return taints
+}
+
+func (r Resolver) resolveLaunchTemplate(nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine, kubeletConfig *v1alpha5.KubeletConfiguration,
+	amiFamily AMIFamily, amiID string, userData *string, instanceTypes []*cloudprovider.InstanceType, options *Options) *LaunchTemplate {
+	resolved := &LaunchTemplate{
+		Options: options,
+		UserData: amiFamily.UserData(
+			kubeletConfig,
+			taints(nodeTemplate, machine),
+			options.Labels,
+			options.CABundle,
+			instanceTypes,
+			userData,
+		),
+		BlockDeviceMappings:   nodeTemplate.Spec.BlockDeviceMappings,
+		EncryptedByDefault:    aws.BoolValue(nodeTemplate.Spec.EncryptedByDefault),
+		KMSKeyID:              nodeTemplate.Spec.KMSKeyID,
+		MetadataOptions:       nodeTemplate.Spec.MetadataOptions,
+		DetailedMonitoring:    aws.BoolValue(nodeTemplate.Spec.DetailedMonitoring),
+		KeyName:               nodeTemplate.Spec.KeyName,
+		Placement:             nodeTemplate.Spec.Placement,
+		Tenancy:               nodeTemplate.Spec.Tenancy,
+		HostID:                nodeTemplate.Spec.HostID,
+		HostResourceGroupARN:  nodeTemplate.Spec.HostResourceGroupARN,
+		PrivateDNSNameOptions: nodeTemplate.Spec.PrivateDNSNameOptions,
+		EFA:                   aws.BoolValue(nodeTemplate.Spec.EFA),
+		NetworkInterfaces:     nodeTemplate.Spec.NetworkInterfaces,
+		AMIID:                 amiID,
+		InstanceTypes:         instanceTypes,
+	}
+	if aws.StringValue(nodeTemplate.Spec.UserDataMode) == v1alpha1.UserDataModeOverride {
+		resolved.UserData = bootstrap.Custom{Options: bootstrap.Options{CustomUserData: userData}}
+	}
+	if resolved.BlockDeviceMappings == nil {
+		resolved.BlockDeviceMappings = amiFamily.DefaultBlockDeviceMappings()
+	}
+	resolved.MetadataOptions = metadataOptionsWithDefaults(resolved.MetadataOptions, amiFamily.DefaultMetadataOptions())
+	return resolved
+}
+
+// GetAMIFamily returns the registered AMI family with the name, defaulting to AL2
 func GetAMIFamily(amiFamily *string, options *Options) AMIFamily {
-	switch aws.StringValue(amiFamily) {
-	case v1alpha1.AMIFamilyBottlerocket:
-		return &Bottlerocket{Options: options}
-	case v1alpha1.AMIFamilyUbuntu:
-		return &Ubuntu{Options: options}
-	case v1alpha1.AMIFamilyCustom:
-		return &Custom{Options: options}
-	default:
-		return &AL2{Options: options}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if factory, ok := registry[aws.StringValue(amiFamily)]; ok {
+		return factory(options)
 	}
+	return registry[v1alpha1.AMIFamilyAL2](options)
 }
 
 func (o Options) DefaultMetadataOptions() *v1alpha1.MetadataOptions {
@@ -159,5 +291,20 @@ func (o Options) DefaultMetadataOptions() *v1alpha1.MetadataOptions {
 		HTTPProtocolIPv6:        aws.String(lo.Ternary(o.KubeDNSIP == nil || o.KubeDNSIP.To4() != nil, ec2.LaunchTemplateInstanceMetadataProtocolIpv6Disabled, ec2.LaunchTemplateInstanceMetadataProtocolIpv6Enabled)),
 		HTTPPutResponseHopLimit: aws.Int64(2),
 		HTTPTokens:              aws.String(ec2.LaunchTemplateHttpTokensStateRequired),
+		InstanceMetadataTags:    aws.String(ec2.LaunchTemplateInstanceMetadataTagsStateDisabled),
+	}
+}
+
+// metadataOptionsWithDefaults fills in any metadata options that aren't specified on the node template with the defaults
+func metadataOptionsWithDefaults(metadataOptions, defaults *v1alpha1.MetadataOptions) *v1alpha1.MetadataOptions {
+	if metadataOptions == nil {
+		return defaults
+	}
+	return &v1alpha1.MetadataOptions{
+		HTTPEndpoint:            lo.Ternary(metadataOptions.HTTPEndpoint != nil, metadataOptions.HTTPEndpoint, defaults.HTTPEndpoint),
+		HTTPProtocolIPv6:        lo.Ternary(metadataOptions.HTTPProtocolIPv6 != nil, metadataOptions.HTTPProtocolIPv6, defaults.HTTPProtocolIPv6),
+		HTTPPutResponseHopLimit: lo.Ternary(metadataOptions.HTTPPutResponseHopLimit != nil, metadataOptions.HTTPPutResponseHopLimit, defaults.HTTPPutResponseHopLimit),
+		HTTPTokens:              lo.Ternary(metadataOptions.HTTPTokens != nil, metadataOptions.HTTPTokens, defaults.HTTPTokens),
+		InstanceMetadataTags:    lo.Ternary(metadataOptions.InstanceMetadataTags != nil, metadataOptions.InstanceMetadataTags, defaults.InstanceMetadataTags),
 	}
 }
@@ -0,0 +1,99 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package amifamily
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/amifamily/bootstrap"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/cloudprovider"
+)
+
+const (
+	windows2019 = "2019"
+	windows2022 = "2022"
+)
+
+type Windows struct {
+	DefaultFamily
+	*Options
+	// Version is the Windows Server release, e.g. 2019 or 2022
+	Version string
+}
+
+// SSMAlias returns the AMI Alias to query SSM
+// The EKS optimized Windows AMIs are only published for x86_64
+func (w Windows) SSMAlias(version string, _ *cloudprovider.InstanceType) string {
+	return fmt.Sprintf("/aws/service/ami-windows-latest/Windows_Server-%s-English-Core-EKS_Optimized-%s/image_id", w.Version, version)
+}
+
+// UserData returns the default userdata script for the AMI Family
+func (w Windows) UserData(kubeletConfig *v1alpha5.KubeletConfiguration, taints []v1.Taint, labels map[string]string, caBundle *string, _ []*cloudprovider.InstanceType, customUserData *string) bootstrap.Bootstrapper {
+	return bootstrap.Windows{
+		Options: bootstrap.Options{
+			ClusterName:             w.Options.ClusterName,
+			ClusterEndpoint:         w.Options.ClusterEndpoint,
+			AWSENILimitedPodDensity: w.Options.AWSENILimitedPodDensity,
+			KubeletConfig:           kubeletConfig,
+			Taints:                  taints,
+			Labels:                  labels,
+			CABundle:                caBundle,
+			CustomUserData:          customUserData,
+		},
+	}
+}
+
+// DefaultBlockDeviceMappings returns the default block device mappings for the AMI Family
+// Windows needs a larger root volume than Linux to fit the OS and the container images built on top of it
+func (w Windows) DefaultBlockDeviceMappings() []*v1alpha1.BlockDeviceMapping {
+	sda1EBS := DefaultEBS
+	sda1EBS.VolumeSize = lo.ToPtr(resource.MustParse("50Gi"))
+	return []*v1alpha1.BlockDeviceMapping{{
+		DeviceName: w.EphemeralBlockDevice(),
+		EBS:        &sda1EBS,
+	}}
+}
+
+func (w Windows) EphemeralBlockDevice() *string {
+	return aws.String("/dev/sda1")
+}
+
+// SystemReserved returns the system-reserved resources for Windows, whose system services use considerably more
+// memory and disk than their Linux counterparts
+func (w Windows) SystemReserved() v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:              resource.MustParse("100m"),
+		v1.ResourceMemory:           resource.MustParse("1536Mi"),
+		v1.ResourceEphemeralStorage: resource.MustParse("10Gi"),
+	}
+}
+
+// EvictionSoftEnabled is disabled for the Windows AMIFamilies because the bootstrap script only passes
+// hard eviction thresholds through to the kubelet
+func (w Windows) FeatureFlags() FeatureFlags {
+	return FeatureFlags{
+		UsesENILimitedMemoryOverhead: false,
+		PodsPerCoreEnabled:           true,
+		EvictionSoftEnabled:          false,
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityreservation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"knative.dev/pkg/logging"
+
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+
+	"github.com/aws/karpenter-core/pkg/utils/functional"
+	"github.com/aws/karpenter-core/pkg/utils/pretty"
+)
+
+type Provider struct {
+	sync.Mutex
+	ec2api ec2iface.EC2API
+	cache  *cache.Cache
+	cm     *pretty.ChangeMonitor
+}
+
+func NewProvider(ec2api ec2iface.EC2API, cache *cache.Cache) *Provider {
+	return &Provider{
+		ec2api: ec2api,
+		cm:     pretty.NewChangeMonitor(),
+		cache:  cache,
+	}
+}
+
+// List returns the active capacity reservations matching the node template's capacity reservation selector that
+// fleet can launch into. Only reservations with open instance matching criteria are returned, since targeted
+// reservations can't be used by fleet without a resource group in the launch template.
+func (p *Provider) List(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) ([]*ec2.CapacityReservation, error) {
+	p.Lock()
+	defer p.Unlock()
+	if len(nodeTemplate.Spec.CapacityReservationSelector) == 0 {
+		return []*ec2.CapacityReservation{}, nil
+	}
+	input := getInput(nodeTemplate)
+	hash, err := hashstructure.Hash(input, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	if err != nil {
+		return nil, err
+	}
+	if capacityReservations, ok := p.cache.Get(fmt.Sprint(hash)); ok {
+		return capacityReservations.([]*ec2.CapacityReservation), nil
+	}
+	output, err := p.ec2api.DescribeCapacityReservationsWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("describing capacity reservations %s, %w", pretty.Concise(input), err)
+	}
+	capacityReservations := lo.Filter(output.CapacityReservations, func(cr *ec2.CapacityReservation, _ int) bool {
+		return aws.StringValue(cr.State) == ec2.CapacityReservationStateActive &&
+			aws.StringValue(cr.InstanceMatchCriteria) == ec2.InstanceMatchCriteriaOpen
+	})
+	p.cache.SetDefault(fmt.Sprint(hash), capacityReservations)
+	capacityReservationLog := Pretty(capacityReservations)
+	if p.cm.HasChanged("capacity-reservations", capacityReservationLog) {
+		logging.FromContext(ctx).With("capacity-reservations", capacityReservationLog).Debugf("discovered capacity reservations")
+	}
+	return capacityReservations, nil
+}
+
+func getInput(nodeTemplate *v1alpha1.AWSNodeTemplate) *ec2.DescribeCapacityReservationsInput {
+	input := &ec2.DescribeCapacityReservationsInput{}
+	for key, value := range nodeTemplate.Spec.CapacityReservationSelector {
+		if key == "aws-ids" {
+			input.CapacityReservationIds = aws.StringSlice(functional.SplitCommaSeparatedString(value))
+		} else if value == "*" {
+			input.Filters = append(input.Filters, &ec2.Filter{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String(key)},
+			})
+		} else {
+			input.Filters = append(input.Filters, &ec2.Filter{
+				Name:   aws.String(fmt.Sprintf("tag:%s", key)),
+				Values: aws.StringSlice(functional.SplitCommaSeparatedString(value)),
+			})
+		}
+	}
+	return input
+}
+
+func Pretty(capacityReservations []*ec2.CapacityReservation) []string {
+	names := []string{}
+	for _, cr := range capacityReservations {
+		names = append(names, fmt.Sprintf("%s (%s, %s, %d available)", aws.StringValue(cr.CapacityReservationId), aws.StringValue(cr.InstanceType),
+			aws.StringValue(cr.AvailabilityZone), aws.Int64Value(cr.AvailableInstanceCount)))
+	}
+	return names
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/avast/retry-go"
@@ -27,10 +29,14 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
 	"go.uber.org/multierr"
+	"golang.org/x/sync/singleflight"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
 	"knative.dev/pkg/logging"
 
 	"github.com/aws/karpenter/pkg/apis/settings"
@@ -38,10 +44,13 @@ import (
 	"github.com/aws/karpenter/pkg/batcher"
 	"github.com/aws/karpenter/pkg/cache"
 	awserrors "github.com/aws/karpenter/pkg/errors"
+	"github.com/aws/karpenter/pkg/providers/capacityreservation"
 	"github.com/aws/karpenter/pkg/providers/instancetype"
 	"github.com/aws/karpenter/pkg/providers/launchtemplate"
 	"github.com/aws/karpenter/pkg/providers/subnet"
 	"github.com/aws/karpenter/pkg/utils"
+	"github.com/aws/karpenter/pkg/utils/project"
+	"github.com/aws/karpenter/pkg/utils/sampling"
 
 	"github.com/aws/karpenter-core/pkg/utils/resources"
 
@@ -51,9 +60,21 @@ import (
 )
 
 var (
-	// MaxInstanceTypes defines the number of instance type options to pass to CreateFleet
-	MaxInstanceTypes                 = 60
+	// MaxInstanceTypes defines the number of instance type options to pass to CreateFleet. The overrides for these
+	// instance types are further limited by the aws.maxFleetOverrides setting.
+	MaxInstanceTypes                 = 100
 	instanceTypeFlexibilityThreshold = 5 // falling back to on-demand without flexibility risks insufficient capacity errors
+	// maxDescribeInstancesResults defines the page size used when listing instances with DescribeInstances
+	maxDescribeInstancesResults int64 = 1000
+	// listTimeout bounds a shared listing, since it isn't canceled along with the callers waiting on it
+	listTimeout = 2 * time.Minute
+	// MaxTerminateInstanceIDs defines the maximum number of instance IDs that EC2 accepts in a single TerminateInstances call
+	MaxTerminateInstanceIDs = 1000
+	// maxReportedFleetOverrides bounds the failed overrides listed for each fleet error in the error message
+	maxReportedFleetOverrides = 5
+
+	// errPrivateDNSNameNotSet is returned when getting an instance before its private DNS name was assigned
+	errPrivateDNSNameNotSet = errors.New("PrivateDnsName was not set")
 
 	instanceStateFilter = &ec2.Filter{
 		Name:   aws.String("instance-state-name"),
@@ -62,54 +83,75 @@ var (
 )
 
 type Provider struct {
-	region                 string
-	ec2api                 ec2iface.EC2API
-	unavailableOfferings   *cache.UnavailableOfferings
-	instanceTypeProvider   *instancetype.Provider
-	subnetProvider         *subnet.Provider
-	launchTemplateProvider *launchtemplate.Provider
-	ec2Batcher             *batcher.EC2API
+	region                      string
+	ec2api                      ec2iface.EC2API
+	unavailableOfferings        *cache.UnavailableOfferings
+	instanceTypeProvider        *instancetype.Provider
+	subnetProvider              *subnet.Provider
+	launchTemplateProvider      *launchtemplate.Provider
+	capacityReservationProvider *capacityreservation.Provider
+	ec2Batcher                  *batcher.EC2API
+	// listGroup shares in-flight DescribeInstances listings between concurrent callers with the same filters
+	listGroup singleflight.Group
+	// launchSlots bounds the launches in flight for each node template, keyed by node template name
+	launchSlotsMu sync.Mutex
+	launchSlots   map[string]chan struct{}
+	// SelectionStrategy chooses the offerings that are submitted to CreateFleet, and can be replaced to plug in a custom
+	// selection. It defaults to DefaultSelectionStrategy.
+	SelectionStrategy SelectionStrategy
 }
 
 func NewProvider(ctx context.Context, region string, ec2api ec2iface.EC2API, unavailableOfferings *cache.UnavailableOfferings,
-	instanceTypeProvider *instancetype.Provider, subnetProvider *subnet.Provider, launchTemplateProvider *launchtemplate.Provider) *Provider {
+	instanceTypeProvider *instancetype.Provider, subnetProvider *subnet.Provider, launchTemplateProvider *launchtemplate.Provider,
+	capacityReservationProvider *capacityreservation.Provider) *Provider {
 	return &Provider{
-		region:                 region,
-		ec2api:                 ec2api,
-		unavailableOfferings:   unavailableOfferings,
-		instanceTypeProvider:   instanceTypeProvider,
-		subnetProvider:         subnetProvider,
-		launchTemplateProvider: launchTemplateProvider,
-		ec2Batcher:             batcher.EC2(ctx, ec2api),
+		region:                      region,
+		ec2api:                      ec2api,
+		unavailableOfferings:        unavailableOfferings,
+		instanceTypeProvider:        instanceTypeProvider,
+		subnetProvider:              subnetProvider,
+		launchTemplateProvider:      launchTemplateProvider,
+		capacityReservationProvider: capacityReservationProvider,
+		ec2Batcher:                  batcher.EC2(ctx, ec2api),
+		launchSlots:                 map[string]chan struct{}{},
+		SelectionStrategy:           DefaultSelectionStrategy{},
 	}
 }
 
 func (p *Provider) Create(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) (*ec2.Instance, error) {
-	instanceTypes = p.filterInstanceTypes(machine, instanceTypes)
-	instanceTypes = orderInstanceTypesByPrice(instanceTypes, scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...))
-	if len(instanceTypes) > MaxInstanceTypes {
-		instanceTypes = instanceTypes[0:MaxInstanceTypes]
+	instanceTypes = p.SelectionStrategy.Select(ctx, machine, instanceTypes)
+	if len(instanceTypes) == 0 {
+		return nil, fmt.Errorf("no instance types were selected for the launch")
 	}
-
-	id, err := p.launchInstance(ctx, nodeTemplate, machine, instanceTypes)
+	capacityType := p.launchCapacityType(ctx, machine, instanceTypes)
+	release, err := p.acquireLaunchSlot(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a launch slot, %w", err)
+	}
+	id, err := p.launchInstance(ctx, nodeTemplate, machine, instanceTypes, capacityType)
 	if awserrors.IsLaunchTemplateNotFound(err) {
 		// retry once if launch template is not found. This allows karpenter to generate a new LT if the
 		// cache was out-of-sync on the first try
-		id, err = p.launchInstance(ctx, nodeTemplate, machine, instanceTypes)
+		id, err = p.launchInstance(ctx, nodeTemplate, machine, instanceTypes, capacityType)
+	}
+	release()
+	if capacityType == v1alpha5.CapacityTypeSpot {
+		p.recordSpotLaunch(ctx, machine, err)
 	}
 	if err != nil {
+		launchFailuresCounter.With(prometheus.Labels{reasonLabel: launchFailureReason(err)}).Inc()
 		return nil, err
 	}
-	// Get Instance with backoff retry since EC2 is eventually consistent
-	instance := &ec2.Instance{}
-	if err := retry.Do(
-		func() (err error) { instance, err = p.Get(ctx, aws.StringValue(id)); return err },
-		retry.Delay(1*time.Second),
-		retry.Attempts(6),
-		retry.LastErrorOnly(true),
-	); err != nil {
+	instance, err := p.getLaunched(ctx, aws.StringValue(id))
+	if err != nil {
 		return nil, fmt.Errorf("retrieving node name for instance %s, %w", aws.StringValue(id), err)
 	}
+	if instance.Placement != nil {
+		p.subnetProvider.RecordPlacement(nodeTemplate, aws.StringValue(instance.InstanceId), aws.StringValue(instance.Placement.AvailabilityZone))
+	}
+	if err := p.tagWithNodeName(ctx, nodeTemplate, machine, instance); err != nil {
+		return nil, err
+	}
 	logging.FromContext(ctx).With(
 		"id", aws.StringValue(instance.InstanceId),
 		"hostname", aws.StringValue(instance.PrivateDnsName),
@@ -120,6 +162,53 @@ func (p *Provider) Create(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTem
 	return instance, nil
 }
 
+// getLaunched gets an instance that was just launched. DescribeInstances is eventually consistent, so it may not find
+// the instance, or return it without its private DNS name, for a short while after the launch. Getting the instance is
+// retried with backoff until it's consistent, so that the machine that's returned can be retrieved by its provider ID.
+// Other errors aren't retried.
+func (p *Provider) getLaunched(ctx context.Context, id string) (*ec2.Instance, error) {
+	var instance *ec2.Instance
+	err := retry.Do(
+		func() (err error) { instance, err = p.Get(ctx, id); return err },
+		retry.Context(ctx),
+		retry.Delay(250*time.Millisecond),
+		retry.MaxDelay(4*time.Second),
+		retry.Attempts(8),
+		retry.LastErrorOnly(true),
+		retry.RetryIf(func(err error) bool {
+			return cloudprovider.IsMachineNotFoundError(err) || errors.Is(err, errPrivateDNSNameNotSet)
+		}),
+		retry.OnRetry(func(_ uint, err error) {
+			logging.FromContext(ctx).With("id", id).Debugf("launched instance isn't consistent yet, retrying, %s", err)
+		}),
+	)
+	return instance, err
+}
+
+// acquireLaunchSlot blocks until fewer than aws.maxConcurrentLaunches launches are in flight for the node template, so
+// that a large scale-up of a single node template doesn't exhaust the IPs and ENIs of its subnets. The returned func
+// releases the slot.
+func (p *Provider) acquireLaunchSlot(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (func(), error) {
+	limit := settings.FromContext(ctx).MaxConcurrentLaunches
+	if limit == 0 {
+		return func() {}, nil
+	}
+	p.launchSlotsMu.Lock()
+	slots, ok := p.launchSlots[nodeTemplate.Name]
+	// Launches that hold a slot of a previous limit release it to the channel they acquired it from
+	if !ok || int64(cap(slots)) != limit {
+		slots = make(chan struct{}, limit)
+		p.launchSlots[nodeTemplate.Name] = slots
+	}
+	p.launchSlotsMu.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (p *Provider) Link(ctx context.Context, id string) error {
 	_, err := p.ec2api.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
 		Resources: aws.StringSlice([]string{id}),
@@ -139,6 +228,93 @@ func (p *Provider) Link(ctx context.Context, id string) error {
 	return nil
 }
 
+func (p *Provider) tags(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) []*ec2.Tag {
+	required := map[string]string{
+		fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName): "owned",
+	}
+	if key := settings.FromContext(ctx).InstanceDiscoveryTagKey; key != "" {
+		required[key] = settings.FromContext(ctx).InstanceDiscoveryTagValue
+	}
+	if settings.FromContext(ctx).EnableVersionTag {
+		required[v1alpha1.TagVersion] = project.Version
+	}
+	// Custom launch templates carry their own tags, so only the tags that Karpenter relies on are merged into them
+	if nodeTemplate.Spec.HasCustomLaunchTemplate() {
+		return lo.Reject(v1alpha1.MergeTags(ctx, required), func(t *ec2.Tag, _ int) bool { return aws.StringValue(t.Key) == "Name" })
+	}
+	return v1alpha1.MergeTags(ctx, settings.FromContext(ctx).Tags, nodeTemplate.Spec.Tags, required)
+}
+
+// tagWithNodeName applies the tags that are templated with the node name, which isn't known until the instance is launched
+func (p *Provider) tagWithNodeName(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine, instance *ec2.Instance) error {
+	nodeNameTags := lo.Filter(p.tags(ctx, nodeTemplate), func(t *ec2.Tag, _ int) bool {
+		return v1alpha1.HasTagTemplate(aws.StringValue(t.Value), v1alpha1.TagTemplateNodeName)
+	})
+	if len(nodeNameTags) == 0 {
+		return nil
+	}
+	values := tagTemplateValues(machine)
+	values[v1alpha1.TagTemplateNodeName] = lo.Ternary(
+		settings.FromContext(ctx).NodeNameConvention == settings.ResourceName,
+		aws.StringValue(instance.InstanceId),
+		strings.ToLower(aws.StringValue(instance.PrivateDnsName)),
+	)
+	resolved, _ := v1alpha1.ResolveTagTemplates(nodeNameTags, values)
+	if err := p.Tag(ctx, aws.StringValue(instance.InstanceId), lo.SliceToMap(resolved, func(t *ec2.Tag) (string, string) {
+		return aws.StringValue(t.Key), aws.StringValue(t.Value)
+	})); err != nil {
+		return fmt.Errorf("tagging instance with node name, %w", err)
+	}
+	instance.Tags = append(lo.Reject(instance.Tags, func(t *ec2.Tag, _ int) bool {
+		_, ok := lo.Find(resolved, func(r *ec2.Tag) bool { return aws.StringValue(r.Key) == aws.StringValue(t.Key) })
+		return ok
+	}), resolved...)
+	return nil
+}
+
+func tagTemplateValues(machine *v1alpha5.Machine) map[string]string {
+	return map[string]string{
+		v1alpha1.TagTemplateMachineName:     machine.Name,
+		v1alpha1.TagTemplateProvisionerName: machine.Labels[v1alpha5.ProvisionerNameLabelKey],
+	}
+}
+
+// Tag creates or overwrites the passed tags on the instance
+func (p *Provider) Tag(ctx context.Context, id string, tags map[string]string) error {
+	_, err := p.ec2api.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{id}),
+		Tags: lo.MapToSlice(tags, func(k, v string) *ec2.Tag {
+			return &ec2.Tag{Key: aws.String(k), Value: aws.String(v)}
+		}),
+	})
+	if err != nil {
+		if awserrors.IsNotFound(err) {
+			return cloudprovider.NewMachineNotFoundError(fmt.Errorf("tagging instance, %w", err))
+		}
+		return fmt.Errorf("tagging instance, %w", err)
+	}
+	return nil
+}
+
+// Detach removes the tags that identify the instance as launched by Karpenter, so that it keeps running without being
+// garbage collected once its machine is deleted. The cluster tag is kept, since it isn't specific to Karpenter.
+func (p *Provider) Detach(ctx context.Context, id string) error {
+	_, err := p.ec2api.DeleteTagsWithContext(ctx, &ec2.DeleteTagsInput{
+		Resources: aws.StringSlice([]string{id}),
+		Tags: lo.Map([]string{v1alpha5.ProvisionerNameLabelKey, v1alpha5.ManagedByLabelKey, v1alpha5.MachineNameLabelKey}, func(k string, _ int) *ec2.Tag {
+			return &ec2.Tag{Key: aws.String(k)}
+		}),
+	})
+	if err != nil {
+		if awserrors.IsNotFound(err) {
+			return cloudprovider.NewMachineNotFoundError(fmt.Errorf("untagging instance, %w", err))
+		}
+		return fmt.Errorf("untagging instance, %w", err)
+	}
+	logging.FromContext(ctx).Infof("retained instance, removed the tags that identify it as launched by karpenter")
+	return nil
+}
+
 func (p *Provider) Get(ctx context.Context, id string) (*ec2.Instance, error) {
 	out, err := p.ec2Batcher.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 		InstanceIds: aws.StringSlice([]string{id}),
@@ -158,33 +334,192 @@ func (p *Provider) Get(ctx context.Context, id string) (*ec2.Instance, error) {
 		return nil, fmt.Errorf("expected a single instance, %w", err)
 	}
 	if len(aws.StringValue(instances[0].PrivateDnsName)) == 0 {
-		return nil, fmt.Errorf("got instance %s but PrivateDnsName was not set", aws.StringValue(instances[0].InstanceId))
+		return nil, fmt.Errorf("got instance %s but %w", aws.StringValue(instances[0].InstanceId), errPrivateDNSNameNotSet)
 	}
 	return instances[0], nil
 }
 
-func (p *Provider) List(ctx context.Context) ([]*ec2.Instance, error) {
+// List returns all instances for the cluster, paging through DescribeInstances results. When zones are passed,
+// instances are listed concurrently for each zone and the results are merged.
+func (p *Provider) List(ctx context.Context, zones ...string) ([]*ec2.Instance, error) {
 	// Use the machine name data to determine which instances match this machine
-	out, err := p.ec2api.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("tag-key"),
+			Values: aws.StringSlice([]string{v1alpha5.ProvisionerNameLabelKey}),
+		},
+		{
+			Name:   aws.String("tag-key"),
+			Values: aws.StringSlice([]string{fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)}),
+		},
+		instanceStateFilter,
+	}
+	filters = append(filters, discoveryFilters(ctx)...)
+	if len(zones) == 0 {
+		return p.list(ctx, filters)
+	}
+	zonalInstances := make([][]*ec2.Instance, len(zones))
+	errs := make([]error, len(zones))
+	workqueue.ParallelizeUntil(ctx, len(zones), len(zones), func(i int) {
+		zonalFilters := append(append([]*ec2.Filter{}, filters...), &ec2.Filter{
+			Name:   aws.String("availability-zone"),
+			Values: aws.StringSlice([]string{zones[i]}),
+		})
+		zonalInstances[i], errs[i] = p.list(ctx, zonalFilters)
+	})
+	if err := multierr.Combine(errs...); err != nil {
+		return nil, err
+	}
+	instances := lo.Flatten(zonalInstances)
+	// Get a consistent ordering for instances across zones
+	sort.Slice(instances, func(i, j int) bool {
+		return aws.StringValue(instances[i].InstanceId) < aws.StringValue(instances[j].InstanceId)
+	})
+	return instances, nil
+}
+
+// IsInstanceProfileInUse returns true if an instance that hasn't been terminated uses the instance profile, including
+// instances that Karpenter no longer manages, e.g. because they were detached
+func (p *Provider) IsInstanceProfileInUse(ctx context.Context, arn string) (bool, error) {
+	inUse := false
+	if err := p.ec2api.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			{
-				Name:   aws.String("tag-key"),
-				Values: aws.StringSlice([]string{v1alpha5.ProvisionerNameLabelKey}),
-			},
-			{
-				Name:   aws.String("tag-key"),
-				Values: aws.StringSlice([]string{fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)}),
+				Name:   aws.String("iam-instance-profile.arn"),
+				Values: aws.StringSlice([]string{arn}),
 			},
 			instanceStateFilter,
 		},
-	})
+		MaxResults: aws.Int64(maxDescribeInstancesResults),
+	}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+		inUse = lo.SomeBy(page.Reservations, func(r *ec2.Reservation) bool { return len(r.Instances) > 0 })
+		// Stop paging once an instance is found
+		return !inUse
+	}); err != nil {
+		return false, fmt.Errorf("describing instances using instance profile %s, %w", arn, err)
+	}
+	return inUse, nil
+}
+
+// ListTrimmed returns the same instances as List, keeping only the fields that are used to build their machines.
+// DescribeInstances can't select the fields that it returns, so without trimming, callers that hold every instance of
+// the cluster retain their network interfaces, block device mappings and security groups for as long as they're held.
+func (p *Provider) ListTrimmed(ctx context.Context, zones ...string) ([]*ec2.Instance, error) {
+	instances, err := p.List(ctx, zones...)
 	if err != nil {
+		return nil, err
+	}
+	return lo.Map(instances, func(i *ec2.Instance, _ int) *ec2.Instance { return trimInstance(i) }), nil
+}
+
+// Zones returns the availability zones of the region that are enabled for the account, so that instances can be
+// listed concurrently for each zone
+func (p *Provider) Zones(ctx context.Context) ([]string, error) {
+	out, err := p.ec2api.DescribeAvailabilityZonesWithContext(ctx, &ec2.DescribeAvailabilityZonesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("describing availability zones, %w", err)
+	}
+	return lo.Map(out.AvailabilityZones, func(zone *ec2.AvailabilityZone, _ int) string {
+		return aws.StringValue(zone.ZoneName)
+	}), nil
+}
+
+// ListByProvisioner returns the instances for the cluster that were launched for the provisioner. The provisioner is
+// filtered on by DescribeInstances, rather than after listing every instance.
+func (p *Provider) ListByProvisioner(ctx context.Context, provisionerName string) ([]*ec2.Instance, error) {
+	return p.list(ctx, append([]*ec2.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", v1alpha5.ProvisionerNameLabelKey)),
+			Values: aws.StringSlice([]string{provisionerName}),
+		},
+		{
+			Name:   aws.String("tag-key"),
+			Values: aws.StringSlice([]string{fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)}),
+		},
+		instanceStateFilter,
+	}, discoveryFilters(ctx)...))
+}
+
+// discoveryFilters returns the filters that scope listing to the instances with the instance discovery tag, so that
+// installations sharing a cluster name don't consider each other's instances
+func discoveryFilters(ctx context.Context) []*ec2.Filter {
+	key, value := settings.FromContext(ctx).InstanceDiscoveryTagKey, settings.FromContext(ctx).InstanceDiscoveryTagValue
+	if key == "" {
+		return nil
+	}
+	if value == "" {
+		return []*ec2.Filter{{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{key})}}
+	}
+	return []*ec2.Filter{{Name: aws.String(fmt.Sprintf("tag:%s", key)), Values: aws.StringSlice([]string{value})}}
+}
+
+// list describes the instances matching the filters. Concurrent calls with the same filters share a single listing,
+// including its error, since controllers that list every instance tend to run at the same time. The shared listing
+// is detached from the context of the caller that started it, so that canceling one caller doesn't fail the others,
+// while each caller stops waiting once its own context is done.
+func (p *Provider) list(ctx context.Context, filters []*ec2.Filter) ([]*ec2.Instance, error) {
+	key := strings.Join(lo.Map(filters, func(f *ec2.Filter, _ int) string {
+		return fmt.Sprintf("%s=%s", aws.StringValue(f.Name), strings.Join(aws.StringValueSlice(f.Values), ","))
+	}), ";")
+	ch := p.listGroup.DoChan(key, func() (interface{}, error) {
+		listCtx, cancel := context.WithTimeout(detachedContext{ctx}, listTimeout)
+		defer cancel()
+		return p.describeInstances(listCtx, filters)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("listing instances, %w", ctx.Err())
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		// Callers get their own slice, since the result is shared
+		return append([]*ec2.Instance{}, result.Val.([]*ec2.Instance)...), nil
+	}
+}
+
+// detachedContext keeps the values of its parent, e.g. the logger and settings, without its deadline or cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (p *Provider) describeInstances(ctx context.Context, filters []*ec2.Filter) ([]*ec2.Instance, error) {
+	out := &ec2.DescribeInstancesOutput{}
+	if err := p.ec2api.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters:    filters,
+		MaxResults: aws.Int64(maxDescribeInstancesResults),
+	}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+		out.Reservations = append(out.Reservations, page.Reservations...)
+		return true
+	}); err != nil {
 		return nil, fmt.Errorf("describing ec2 instances, %w", err)
 	}
 	instances, err := instancesFromOutput(out)
 	return instances, cloudprovider.IgnoreMachineNotFoundError(err)
 }
 
+// trimInstance returns a copy of a listed instance with only the fields that are used to build its machine
+func trimInstance(instance *ec2.Instance) *ec2.Instance {
+	trimmed := &ec2.Instance{
+		InstanceId:            instance.InstanceId,
+		InstanceType:          instance.InstanceType,
+		ImageId:               instance.ImageId,
+		State:                 instance.State,
+		Tags:                  instance.Tags,
+		LaunchTime:            instance.LaunchTime,
+		PrivateDnsName:        instance.PrivateDnsName,
+		SpotInstanceRequestId: instance.SpotInstanceRequestId,
+	}
+	if instance.Placement != nil {
+		trimmed.Placement = &ec2.Placement{AvailabilityZone: instance.Placement.AvailabilityZone}
+	}
+	return trimmed
+}
+
 func (p *Provider) Delete(ctx context.Context, id string) error {
 	if _, err := p.ec2Batcher.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
 		InstanceIds: []*string{aws.String(id)},
@@ -192,7 +527,7 @@ func (p *Provider) Delete(ctx context.Context, id string) error {
 		if awserrors.IsNotFound(err) {
 			return cloudprovider.NewMachineNotFoundError(fmt.Errorf("instance already terminated"))
 		}
-		if _, e := p.Get(ctx, id); err != nil {
+		if _, e := p.Get(ctx, id); e != nil {
 			if cloudprovider.IsMachineNotFoundError(e) {
 				return e
 			}
@@ -203,24 +538,134 @@ func (p *Provider) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (p *Provider) launchInstance(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) (*string, error) {
-	capacityType := p.getCapacityType(machine, instanceTypes)
+// Stop stops the instance rather than terminating it, so that it can be resumed later. The instance is tagged as stopped
+// by Karpenter so that garbage collection doesn't treat it as orphaned. Instances that can't be stopped are terminated.
+func (p *Provider) Stop(ctx context.Context, id string) error {
+	instance, err := p.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if reason := stopUnsupportedReason(instance); reason != "" {
+		logging.FromContext(ctx).Debugf("terminating instance instead of stopping it, %s", reason)
+		return p.Delete(ctx, id)
+	}
+	if _, err := p.ec2api.StopInstancesWithContext(ctx, &ec2.StopInstancesInput{
+		InstanceIds: aws.StringSlice([]string{id}),
+	}); err != nil {
+		if awserrors.IsNotFound(err) {
+			return cloudprovider.NewMachineNotFoundError(fmt.Errorf("stopping instance, %w", err))
+		}
+		return fmt.Errorf("stopping instance, %w", err)
+	}
+	if err := p.Tag(ctx, id, map[string]string{v1alpha1.TagStopped: "true"}); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debugf("stopped instance")
+	return nil
+}
+
+// stopUnsupportedReason returns why the instance can't be stopped, or an empty string if it can
+func stopUnsupportedReason(instance *ec2.Instance) string {
+	switch {
+	case aws.StringValue(instance.RootDeviceType) == ec2.DeviceTypeInstanceStore:
+		return "instances with an instance store root device can't be stopped"
+	case aws.StringValue(instance.InstanceLifecycle) == ec2.InstanceLifecycleTypeSpot:
+		return "spot instances can't be stopped"
+	default:
+		return ""
+	}
+}
+
+// DeleteBatch terminates the passed instances using as few TerminateInstances calls as EC2 allows. It returns the
+// IDs of the instances that were terminated (or were already gone) along with a combined error for the instances
+// that failed to terminate.
+func (p *Provider) DeleteBatch(ctx context.Context, ids []string) ([]string, error) {
+	var deleted []string
+	var errs error
+	sampler := sampling.New(settings.FromContext(ctx).GCLogSampleSize)
+	for _, chunk := range lo.Chunk(ids, MaxTerminateInstanceIDs) {
+		out, err := p.ec2api.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{
+			InstanceIds: aws.StringSlice(chunk),
+		})
+		if err != nil {
+			// Errors that aren't caused by a single instance, e.g. throttling, would fail the individual calls too
+			if !lo.ContainsBy(awserrors.Codes(err), awserrors.IsInstanceErrorCode) {
+				return deleted, multierr.Append(errs, fmt.Errorf("terminating instances in batch, %w", err))
+			}
+			logging.FromContext(ctx).Debugf("terminating instances in batch, falling back to individual termination, %s", err)
+		}
+		terminated := sets.NewString()
+		if out != nil {
+			for _, stateChange := range out.TerminatingInstances {
+				if lo.Contains([]string{ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated}, aws.StringValue(stateChange.CurrentState.Name)) {
+					terminated.Insert(aws.StringValue(stateChange.InstanceId))
+				}
+			}
+		}
+		// A single instance that can't be terminated fails the whole TerminateInstances call, so we terminate
+		// the remaining instances individually to separate the ones that succeed from the ones that fail
+		remaining := lo.Reject(chunk, func(id string, _ int) bool { return terminated.Has(id) })
+		remainingErrs := make([]error, len(remaining))
+		workqueue.ParallelizeUntil(ctx, 20, len(remaining), func(i int) {
+			err := p.Delete(ctx, remaining[i])
+			// Instances that are already gone were deleted by someone else, so there's nothing left to terminate
+			if cloudprovider.IsMachineNotFoundError(err) {
+				sampler.Logger(ctx).With("id", remaining[i]).Debugf("instance already terminated")
+				return
+			}
+			if err != nil {
+				remainingErrs[i] = fmt.Errorf("terminating instance %s, %w", remaining[i], err)
+			}
+		})
+		deleted = append(deleted, terminated.List()...)
+		for i, id := range remaining {
+			if remainingErrs[i] != nil {
+				errs = multierr.Append(errs, remainingErrs[i])
+				continue
+			}
+			deleted = append(deleted, id)
+		}
+	}
+	logging.FromContext(ctx).With("count", len(deleted)).Debugf("terminated instances")
+	return deleted, errs
+}
+
+func (p *Provider) launchInstance(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType,
+	capacityType string) (*string, error) {
 	zonalSubnets, err := p.subnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, instanceTypes, capacityType)
 	if err != nil {
 		return nil, fmt.Errorf("getting subnets, %w", err)
 	}
 	// Get Launch Template Configs, which may differ due to GPU or Architecture requirements
-	launchTemplateConfigs, err := p.getLaunchTemplateConfigs(ctx, nodeTemplate, machine, instanceTypes, zonalSubnets, capacityType)
+	priorities := subnet.ZonePriorities(zonalSubnets, p.subnetProvider.ZonePlacements(ctx, nodeTemplate))
+	launchTemplateConfigs, err := p.getLaunchTemplateConfigs(ctx, nodeTemplate, machine, instanceTypes, zonalSubnets, priorities, capacityType)
 	if err != nil {
 		return nil, fmt.Errorf("getting launch template configs, %w", err)
 	}
+	recordLaunchTemplates(machine, lo.FilterMap(launchTemplateConfigs, func(ltc *ec2.FleetLaunchTemplateConfigRequest, _ int) (string, bool) {
+		return p.launchTemplateProvider.ID(aws.StringValue(ltc.LaunchTemplateSpecification.LaunchTemplateName))
+	}))
 	if err := p.checkODFallback(machine, instanceTypes, launchTemplateConfigs); err != nil {
 		logging.FromContext(ctx).Warn(err.Error())
 	}
+	var capacityReservationOptions *ec2.CapacityReservationOptionsRequest
+	if capacityType == v1alpha5.CapacityTypeOnDemand {
+		capacityReservations, err := p.capacityReservationProvider.List(ctx, nodeTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("getting capacity reservations, %w", err)
+		}
+		// Constrain the launch to the instance types and zones of reservations with available capacity. If none are
+		// compatible, we launch regular on-demand capacity.
+		if reservedConfigs := reservedLaunchTemplateConfigs(launchTemplateConfigs, capacityReservations); len(reservedConfigs) > 0 {
+			launchTemplateConfigs = reservedConfigs
+			capacityReservationOptions = &ec2.CapacityReservationOptionsRequest{
+				UsageStrategy: aws.String(ec2.FleetCapacityReservationUsageStrategyUseCapacityReservationsFirst),
+			}
+		}
+	}
 	// Create fleet
-	tags := v1alpha1.MergeTags(ctx, settings.FromContext(ctx).Tags, nodeTemplate.Spec.Tags, map[string]string{
-		fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName): "owned",
-	})
+	// Tags templated with the node name can only be resolved once the instance is launched
+	tags, _ := v1alpha1.ResolveTagTemplates(p.tags(ctx, nodeTemplate), tagTemplateValues(machine))
 	createFleetInput := &ec2.CreateFleetInput{
 		Type:                  aws.String(ec2.FleetTypeInstant),
 		Context:               nodeTemplate.Spec.Context,
@@ -235,10 +680,16 @@ func (p *Provider) launchInstance(ctx context.Context, nodeTemplate *v1alpha1.AW
 			{ResourceType: aws.String(ec2.ResourceTypeFleet), Tags: tags},
 		},
 	}
+	// Weighted subnets and zone balancing set priorities on the overrides, which fleet only honors with a prioritized
+	// allocation strategy
+	prioritized := priorities != nil
 	if capacityType == v1alpha5.CapacityTypeSpot {
-		createFleetInput.SpotOptions = &ec2.SpotOptionsRequest{AllocationStrategy: aws.String(ec2.SpotAllocationStrategyPriceCapacityOptimized)}
+		createFleetInput.SpotOptions = &ec2.SpotOptionsRequest{AllocationStrategy: aws.String(lo.Ternary(prioritized,
+			ec2.SpotAllocationStrategyCapacityOptimizedPrioritized, ec2.SpotAllocationStrategyPriceCapacityOptimized))}
 	} else {
-		createFleetInput.OnDemandOptions = &ec2.OnDemandOptionsRequest{AllocationStrategy: aws.String(ec2.FleetOnDemandAllocationStrategyLowestPrice)}
+		createFleetInput.OnDemandOptions = &ec2.OnDemandOptionsRequest{AllocationStrategy: aws.String(lo.Ternary(prioritized,
+			ec2.FleetOnDemandAllocationStrategyPrioritized, ec2.FleetOnDemandAllocationStrategyLowestPrice)),
+			CapacityReservationOptions: capacityReservationOptions}
 	}
 
 	createFleetOutput, err := p.ec2Batcher.CreateFleet(ctx, createFleetInput)
@@ -257,10 +708,27 @@ func (p *Provider) launchInstance(ctx context.Context, nodeTemplate *v1alpha1.AW
 		return nil, fmt.Errorf("creating fleet %w", err)
 	}
 	p.updateUnavailableOfferingsCache(ctx, createFleetOutput.Errors, capacityType)
-	if len(createFleetOutput.Instances) == 0 || len(createFleetOutput.Instances[0].InstanceIds) == 0 {
+	// Fleet tries the overrides in order of the allocation strategy, so the instance may have been launched from a later
+	// override after the earlier ones failed
+	ids := lo.FlatMap(createFleetOutput.Instances, func(i *ec2.CreateFleetInstance, _ int) []*string { return i.InstanceIds })
+	if len(ids) == 0 {
 		return nil, combineFleetErrors(createFleetOutput.Errors)
 	}
-	return createFleetOutput.Instances[0].InstanceIds[0], nil
+	if len(createFleetOutput.Errors) > 0 {
+		logging.FromContext(ctx).With("id", aws.StringValue(ids[0])).Debugf("launched instance after %d fleet overrides failed, %s",
+			len(createFleetOutput.Errors), combineFleetErrors(createFleetOutput.Errors))
+	}
+	return ids[0], nil
+}
+
+// recordLaunchTemplates annotates the machine with the IDs of the launch templates that Karpenter generated for its
+// launch, so that a launch can be traced back to them even if it fails. Custom launch templates aren't recorded.
+func recordLaunchTemplates(machine *v1alpha5.Machine, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	sort.Strings(ids)
+	machine.Annotations = lo.Assign(machine.Annotations, map[string]string{v1alpha1.AnnotationLaunchTemplateIDs: strings.Join(ids, ",")})
 }
 
 func (p *Provider) checkODFallback(machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType, launchTemplateConfigs []*ec2.FleetLaunchTemplateConfigRequest) error {
@@ -286,7 +754,7 @@ func (p *Provider) checkODFallback(machine *v1alpha5.Machine, instanceTypes []*c
 }
 
 func (p *Provider) getLaunchTemplateConfigs(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, machine *v1alpha5.Machine,
-	instanceTypes []*cloudprovider.InstanceType, zonalSubnets map[string]*ec2.Subnet, capacityType string) ([]*ec2.FleetLaunchTemplateConfigRequest, error) {
+	instanceTypes []*cloudprovider.InstanceType, zonalSubnets map[string]*ec2.Subnet, priorities map[string]float64, capacityType string) ([]*ec2.FleetLaunchTemplateConfigRequest, error) {
 	var launchTemplateConfigs []*ec2.FleetLaunchTemplateConfigRequest
 	launchTemplates, err := p.launchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, map[string]string{v1alpha5.LabelCapacityType: capacityType})
 	if err != nil {
@@ -294,10 +762,10 @@ func (p *Provider) getLaunchTemplateConfigs(ctx context.Context, nodeTemplate *v
 	}
 	for launchTemplateName, instanceTypes := range launchTemplates {
 		launchTemplateConfig := &ec2.FleetLaunchTemplateConfigRequest{
-			Overrides: p.getOverrides(instanceTypes, zonalSubnets, scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...).Get(v1.LabelTopologyZone), capacityType),
+			Overrides: p.getOverrides(instanceTypes, zonalSubnets, priorities, scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...).Get(v1.LabelTopologyZone), capacityType),
 			LaunchTemplateSpecification: &ec2.FleetLaunchTemplateSpecificationRequest{
 				LaunchTemplateName: aws.String(launchTemplateName),
-				Version:            aws.String("$Latest"),
+				Version:            aws.String(lo.FromPtrOr(nodeTemplate.Spec.LaunchTemplateVersion, "$Latest")),
 			},
 		}
 		if len(launchTemplateConfig.Overrides) > 0 {
@@ -307,12 +775,77 @@ func (p *Provider) getLaunchTemplateConfigs(ctx context.Context, nodeTemplate *v
 	if len(launchTemplateConfigs) == 0 {
 		return nil, fmt.Errorf("no capacity offerings are currently available given the constraints")
 	}
-	return launchTemplateConfigs, nil
+	return limitOverrides(launchTemplateConfigs, instanceTypes, int(settings.FromContext(ctx).MaxFleetOverrides)), nil
+}
+
+// limitOverrides returns copies of the launch template configs with at most maxOverrides overrides between them. The overrides
+// of the instance types that are ordered first, which are the cheapest, are kept.
+func limitOverrides(launchTemplateConfigs []*ec2.FleetLaunchTemplateConfigRequest, instanceTypes []*cloudprovider.InstanceType, maxOverrides int) []*ec2.FleetLaunchTemplateConfigRequest {
+	overrides := lo.FlatMap(launchTemplateConfigs, func(ltc *ec2.FleetLaunchTemplateConfigRequest, _ int) []*ec2.FleetLaunchTemplateOverridesRequest {
+		return ltc.Overrides
+	})
+	if len(overrides) <= maxOverrides {
+		return launchTemplateConfigs
+	}
+	rank := map[string]int{}
+	for i, it := range instanceTypes {
+		rank[it.Name] = i
+	}
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return rank[aws.StringValue(overrides[i].InstanceType)] < rank[aws.StringValue(overrides[j].InstanceType)]
+	})
+	kept := lo.SliceToMap(overrides[:maxOverrides], func(override *ec2.FleetLaunchTemplateOverridesRequest) (*ec2.FleetLaunchTemplateOverridesRequest, struct{}) {
+		return override, struct{}{}
+	})
+	var limitedConfigs []*ec2.FleetLaunchTemplateConfigRequest
+	for _, ltc := range launchTemplateConfigs {
+		overrides := lo.Filter(ltc.Overrides, func(override *ec2.FleetLaunchTemplateOverridesRequest, _ int) bool {
+			_, ok := kept[override]
+			return ok
+		})
+		if len(overrides) > 0 {
+			limitedConfigs = append(limitedConfigs, &ec2.FleetLaunchTemplateConfigRequest{
+				LaunchTemplateSpecification: ltc.LaunchTemplateSpecification,
+				Overrides:                   overrides,
+			})
+		}
+	}
+	return limitedConfigs
+}
+
+// reservedLaunchTemplateConfigs returns copies of the launch template configs with their overrides filtered down to the
+// instance types and zones of capacity reservations that have available instances. Fleet uses the reservations first and
+// falls back to regular on-demand capacity in the same instance types and zones if the reservations fill up.
+func reservedLaunchTemplateConfigs(launchTemplateConfigs []*ec2.FleetLaunchTemplateConfigRequest, capacityReservations []*ec2.CapacityReservation) []*ec2.FleetLaunchTemplateConfigRequest {
+	type offering struct {
+		instanceType string
+		zone         string
+	}
+	reserved := map[offering]struct{}{}
+	for _, cr := range capacityReservations {
+		if aws.Int64Value(cr.AvailableInstanceCount) > 0 {
+			reserved[offering{instanceType: aws.StringValue(cr.InstanceType), zone: aws.StringValue(cr.AvailabilityZone)}] = struct{}{}
+		}
+	}
+	var reservedConfigs []*ec2.FleetLaunchTemplateConfigRequest
+	for _, ltc := range launchTemplateConfigs {
+		overrides := lo.Filter(ltc.Overrides, func(override *ec2.FleetLaunchTemplateOverridesRequest, _ int) bool {
+			_, ok := reserved[offering{instanceType: aws.StringValue(override.InstanceType), zone: aws.StringValue(override.AvailabilityZone)}]
+			return ok
+		})
+		if len(overrides) > 0 {
+			reservedConfigs = append(reservedConfigs, &ec2.FleetLaunchTemplateConfigRequest{
+				LaunchTemplateSpecification: ltc.LaunchTemplateSpecification,
+				Overrides:                   overrides,
+			})
+		}
+	}
+	return reservedConfigs
 }
 
 // getOverrides creates and returns launch template overrides for the cross product of InstanceTypes and subnets (with subnets being constrained by
 // zones and the offerings in InstanceTypes)
-func (p *Provider) getOverrides(instanceTypes []*cloudprovider.InstanceType, zonalSubnets map[string]*ec2.Subnet, zones *scheduling.Requirement, capacityType string) []*ec2.FleetLaunchTemplateOverridesRequest {
+func (p *Provider) getOverrides(instanceTypes []*cloudprovider.InstanceType, zonalSubnets map[string]*ec2.Subnet, priorities map[string]float64, zones *scheduling.Requirement, capacityType string) []*ec2.FleetLaunchTemplateOverridesRequest {
 	// Unwrap all the offerings to a flat slice that includes a pointer
 	// to the parent instance type name
 	type offeringWithParentName struct {
@@ -338,18 +871,30 @@ func (p *Provider) getOverrides(instanceTypes []*cloudprovider.InstanceType, zon
 		if !zones.Has(offering.Zone) {
 			continue
 		}
+		// The instance types may have been resolved before another launch marked this offering as unavailable
+		if p.unavailableOfferings.IsUnavailable(offering.parentInstanceTypeName, offering.Zone, capacityType) {
+			continue
+		}
 		subnet, ok := zonalSubnets[offering.Zone]
 		if !ok {
 			continue
 		}
-		overrides = append(overrides, &ec2.FleetLaunchTemplateOverridesRequest{
+		override := &ec2.FleetLaunchTemplateOverridesRequest{
 			InstanceType: aws.String(offering.parentInstanceTypeName),
 			SubnetId:     subnet.SubnetId,
 			// This is technically redundant, but is useful if we have to parse insufficient capacity errors from
 			// CreateFleet so that we can figure out the zone rather than additional API calls to look up the subnet
 			AvailabilityZone: subnet.AvailabilityZone,
-		})
+		}
+		if priorities != nil {
+			override.Priority = aws.Float64(priorities[offering.Zone])
+		}
+		overrides = append(overrides, override)
 	}
+	// Order the overrides so that the most preferred zones come first
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return aws.Float64Value(overrides[i].Priority) < aws.Float64Value(overrides[j].Priority)
+	})
 	return overrides
 }
 
@@ -423,6 +968,53 @@ func (p *Provider) getCapacityType(machine *v1alpha5.Machine, instanceTypes []*c
 	return v1alpha5.CapacityTypeOnDemand
 }
 
+// launchCapacityType returns the capacity type to launch the machine with. Spot is preferred if the machine allows it,
+// but once spot launches for the machine's requirements have failed with insufficient capacity errors
+// aws.spotFallbackThreshold times in a row, machines that also allow on-demand are launched on-demand instead.
+func (p *Provider) launchCapacityType(ctx context.Context, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) string {
+	capacityType := p.getCapacityType(machine, instanceTypes)
+	threshold := settings.FromContext(ctx).SpotFallbackThreshold
+	if capacityType != v1alpha5.CapacityTypeSpot || threshold == 0 {
+		return capacityType
+	}
+	requirements := scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...)
+	if !requirements.Get(v1alpha5.LabelCapacityType).Has(v1alpha5.CapacityTypeOnDemand) {
+		return capacityType
+	}
+	hasOnDemandOffering := lo.ContainsBy(instanceTypes, func(it *cloudprovider.InstanceType) bool {
+		return lo.ContainsBy(it.Offerings.Available(), func(o cloudprovider.Offering) bool {
+			return o.CapacityType == v1alpha5.CapacityTypeOnDemand && requirements.Get(v1.LabelTopologyZone).Has(o.Zone)
+		})
+	})
+	if !hasOnDemandOffering {
+		return capacityType
+	}
+	failures := p.unavailableOfferings.SpotFailures(spotFailuresKey(machine))
+	if failures < threshold {
+		return capacityType
+	}
+	logging.FromContext(ctx).With("spot-failures", failures).Debugf("launching on-demand after repeated spot insufficient capacity errors")
+	spotFallbacksCounter.Inc()
+	return v1alpha5.CapacityTypeOnDemand
+}
+
+// recordSpotLaunch counts the consecutive spot launches for the machine's requirements that failed with an insufficient
+// capacity error, and resets the count once a spot launch succeeds
+func (p *Provider) recordSpotLaunch(ctx context.Context, machine *v1alpha5.Machine, err error) {
+	switch {
+	case err == nil:
+		p.unavailableOfferings.ResetSpotFailures(spotFailuresKey(machine))
+	case launchFailureReason(err) == insufficientCapacityReason:
+		p.unavailableOfferings.MarkSpotFailure(ctx, spotFailuresKey(machine))
+	}
+}
+
+// spotFailuresKey identifies the set of requirements that spot failures are counted for
+func spotFailuresKey(machine *v1alpha5.Machine) string {
+	hash, _ := hashstructure.Hash(machine.Spec.Requirements, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
+	return fmt.Sprintf("%016x", hash)
+}
+
 func orderInstanceTypesByPrice(instanceTypes []*cloudprovider.InstanceType, requirements scheduling.Requirements) []*cloudprovider.InstanceType {
 	// Order instance types so that we get the cheapest instance types of the available offerings
 	sort.Slice(instanceTypes, func(i, j int) bool {
@@ -444,11 +1036,11 @@ func orderInstanceTypesByPrice(instanceTypes []*cloudprovider.InstanceType, requ
 
 // filterInstanceTypes is used to provide filtering on the list of potential instance types to further limit it to those
 // that make the most sense given our specific AWS cloudprovider.
-func (p *Provider) filterInstanceTypes(machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
+func filterInstanceTypes(machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
 	instanceTypes = filterExoticInstanceTypes(instanceTypes)
 	// If we could potentially launch either a spot or on-demand node, we want to filter out the spot instance types that
 	// are more expensive than the cheapest on-demand type.
-	if p.isMixedCapacityLaunch(machine, instanceTypes) {
+	if isMixedCapacityLaunch(machine, instanceTypes) {
 		instanceTypes = filterUnwantedSpot(instanceTypes)
 	}
 	return instanceTypes
@@ -456,7 +1048,7 @@ func (p *Provider) filterInstanceTypes(machine *v1alpha5.Machine, instanceTypes
 
 // isMixedCapacityLaunch returns true if provisioners and available offerings could potentially allow either a spot or
 // and on-demand node to launch
-func (p *Provider) isMixedCapacityLaunch(machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) bool {
+func isMixedCapacityLaunch(machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) bool {
 	requirements := scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...)
 	// requirements must allow both
 	if !requirements.Get(v1alpha5.LabelCapacityType).Has(v1alpha5.CapacityTypeSpot) ||
@@ -550,17 +1142,70 @@ func instancesFromOutput(out *ec2.DescribeInstancesOutput) ([]*ec2.Instance, err
 	return instances, nil
 }
 
+// combineFleetErrors combines the errors of the fleet overrides that failed. Overrides that failed with the same error
+// are combined into a single error that lists where each was launched, e.g. "InsufficientInstanceCapacity: ... [m5.large
+// in us-west-2a (subnet-123)]", so that the failure reported on the machine shows which zones and subnets failed and why.
 func combineFleetErrors(errors []*ec2.CreateFleetError) (errs error) {
-	unique := sets.NewString()
+	type fleetError struct{ code, message string }
+	var keys []fleetError
+	failed := map[fleetError][]string{}
 	for _, err := range errors {
-		unique.Insert(fmt.Sprintf("%s: %s", aws.StringValue(err.ErrorCode), aws.StringValue(err.ErrorMessage)))
+		key := fleetError{code: aws.StringValue(err.ErrorCode), message: aws.StringValue(err.ErrorMessage)}
+		if _, ok := failed[key]; !ok {
+			keys = append(keys, key)
+		}
+		failed[key] = append(failed[key], describeOverride(err.LaunchTemplateAndOverrides))
 	}
-	for errorCode := range unique {
-		errs = multierr.Append(errs, fmt.Errorf(errorCode))
+	for _, key := range keys {
+		overrides := lo.Uniq(lo.Compact(failed[key]))
+		message := key.message
+		if len(overrides) > 0 {
+			listed := strings.Join(lo.Slice(overrides, 0, maxReportedFleetOverrides), ", ")
+			if len(overrides) > maxReportedFleetOverrides {
+				listed += ", ..."
+			}
+			message = strings.TrimSpace(fmt.Sprintf("%s [%s]", message, listed))
+		}
+		// Keep the codes so that the failure can be categorized
+		errs = multierr.Append(errs, awserr.New(key.code, message, nil))
 	}
 	return fmt.Errorf("with fleet error(s), %w", errs)
 }
 
+// describeOverride describes where a fleet override launches, e.g. "m5.large in us-west-2a (subnet-123)"
+func describeOverride(launchTemplateAndOverrides *ec2.LaunchTemplateAndOverridesResponse) string {
+	if launchTemplateAndOverrides == nil || launchTemplateAndOverrides.Overrides == nil {
+		return ""
+	}
+	override := launchTemplateAndOverrides.Overrides
+	description := aws.StringValue(override.InstanceType)
+	if zone := aws.StringValue(override.AvailabilityZone); zone != "" {
+		description = strings.TrimSpace(fmt.Sprintf("%s in %s", description, zone))
+	}
+	if subnetID := aws.StringValue(override.SubnetId); subnetID != "" {
+		description = strings.TrimSpace(fmt.Sprintf("%s (%s)", description, subnetID))
+	}
+	return description
+}
+
+// launchFailureReason categorizes a launch failure by the AWS error codes it contains. Fleet may return several
+// errors for a single launch, so more actionable categories take precedence.
+func launchFailureReason(err error) string {
+	codes := awserrors.Codes(err)
+	switch {
+	case lo.SomeBy(codes, awserrors.IsUnauthorizedCode):
+		return unauthorizedReason
+	case lo.SomeBy(codes, awserrors.IsQuotaExceededCode):
+		return quotaExceededReason
+	case lo.SomeBy(codes, awserrors.IsThrottlingCode):
+		return throttledReason
+	case lo.SomeBy(codes, awserrors.IsUnfulfillableCapacityCode):
+		return insufficientCapacityReason
+	default:
+		return otherReason
+	}
+}
+
 func GetCapacityType(instance *ec2.Instance) string {
 	if instance.SpotInstanceRequestId != nil {
 		return v1alpha5.CapacityTypeSpot
@@ -0,0 +1,189 @@
+//go:build test_performance
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/samber/lo"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/test"
+)
+
+var zones = []string{"test-zone-1a", "test-zone-1b", "test-zone-1c"}
+
+func BenchmarkList10000(b *testing.B) {
+	benchmarkList(b, 10000)
+}
+
+func BenchmarkList1000(b *testing.B) {
+	benchmarkList(b, 1000)
+}
+
+func BenchmarkListByZone10000(b *testing.B) {
+	benchmarkList(b, 10000, zones...)
+}
+
+func BenchmarkListByZone1000(b *testing.B) {
+	benchmarkList(b, 1000, zones...)
+}
+
+func benchmarkList(b *testing.B, instanceCount int, listZones ...string) {
+	ctx := settings.ToContext(context.Background(), test.Settings())
+	ec2api := &fake.EC2API{}
+	for i := 0; i < instanceCount; i++ {
+		instanceID := fake.InstanceID()
+		ec2api.Instances.Store(instanceID, &ec2.Instance{
+			State: &ec2.InstanceState{
+				Name: aws.String(ec2.InstanceStateNameRunning),
+			},
+			Tags: []*ec2.Tag{
+				{
+					Key:   aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)),
+					Value: aws.String("owned"),
+				},
+				{
+					Key:   aws.String(v1alpha5.ProvisionerNameLabelKey),
+					Value: aws.String("default"),
+				},
+			},
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement: &ec2.Placement{
+				AvailabilityZone: aws.String(zones[i%len(zones)]),
+			},
+			LaunchTime:   aws.Time(time.Now()),
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String("m5.large"),
+		})
+	}
+	provider := instance.NewProvider(ctx, "", ec2api, nil, nil, nil, nil, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		instances, err := provider.List(ctx, listZones...)
+		if err != nil {
+			b.Fatalf("listing instances, %v", err)
+		}
+		if len(instances) != instanceCount {
+			b.Fatalf("expected %d instances, got %d", instanceCount, len(instances))
+		}
+	}
+}
+
+// BenchmarkDescribeInstancesRetained10000 measures the memory that's retained by holding every instance of a
+// DescribeInstances listing, which is what listing retained before instances were trimmed
+func BenchmarkDescribeInstancesRetained10000(b *testing.B) {
+	ctx := settings.ToContext(context.Background(), test.Settings())
+	ec2api := newUnmarshalingEC2API(ctx, 10000)
+	benchmarkRetained(b, func() ([]*ec2.Instance, error) {
+		var instances []*ec2.Instance
+		err := ec2api.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{MaxResults: aws.Int64(1000)}, func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+			instances = append(instances, lo.FlatMap(page.Reservations, func(r *ec2.Reservation, _ int) []*ec2.Instance { return r.Instances })...)
+			return true
+		})
+		return instances, err
+	})
+}
+
+// BenchmarkListRetained10000 measures the memory that's retained by holding every instance listed by the provider
+func BenchmarkListRetained10000(b *testing.B) {
+	ctx := settings.ToContext(context.Background(), test.Settings())
+	provider := instance.NewProvider(ctx, "", newUnmarshalingEC2API(ctx, 10000), nil, nil, nil, nil, nil)
+	benchmarkRetained(b, func() ([]*ec2.Instance, error) {
+		return provider.List(ctx)
+	})
+}
+
+func benchmarkRetained(b *testing.B, list func() ([]*ec2.Instance, error)) {
+	b.ReportAllocs()
+	var retained int64
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		instances, err := list()
+		if err != nil {
+			b.Fatalf("listing instances, %v", err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		retained += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		runtime.KeepAlive(instances)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
+
+// unmarshalingEC2API returns a fresh copy of each instance from DescribeInstances, like the SDK does when it
+// unmarshals a response, rather than the instances that are stored by the fake
+type unmarshalingEC2API struct {
+	*fake.EC2API
+}
+
+// newUnmarshalingEC2API stores instances with the network interfaces, block device mappings and security groups that
+// EC2 describes for a typical instance
+func newUnmarshalingEC2API(ctx context.Context, instanceCount int) *unmarshalingEC2API {
+	ec2api := &fake.EC2API{}
+	for i := 0; i < instanceCount; i++ {
+		instanceID := fake.InstanceID()
+		ec2api.Instances.Store(instanceID, &ec2.Instance{
+			State: &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+			Tags: []*ec2.Tag{
+				{Key: aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)), Value: aws.String("owned")},
+				{Key: aws.String(v1alpha5.ProvisionerNameLabelKey), Value: aws.String("default")},
+			},
+			PrivateDnsName: aws.String(fake.PrivateDNSName()),
+			Placement:      &ec2.Placement{AvailabilityZone: aws.String(zones[i%len(zones)]), Tenancy: aws.String(ec2.TenancyDefault)},
+			LaunchTime:     aws.Time(time.Now()),
+			InstanceId:     aws.String(instanceID),
+			InstanceType:   aws.String("m5.large"),
+			ImageId:        aws.String("ami-123"),
+			BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{{
+				DeviceName: aws.String("/dev/xvda"),
+				Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-123"), Status: aws.String("attached"), AttachTime: aws.Time(time.Now())},
+			}},
+			NetworkInterfaces: lo.Times(3, func(i int) *ec2.InstanceNetworkInterface {
+				return &ec2.InstanceNetworkInterface{
+					NetworkInterfaceId: aws.String(fmt.Sprintf("eni-%d", i)),
+					PrivateIpAddresses: lo.Times(10, func(j int) *ec2.InstancePrivateIpAddress {
+						return &ec2.InstancePrivateIpAddress{PrivateIpAddress: aws.String(fmt.Sprintf("10.0.%d.%d", i, j)), PrivateDnsName: aws.String(fake.PrivateDNSName())}
+					}),
+					Groups: []*ec2.GroupIdentifier{{GroupId: aws.String("sg-123"), GroupName: aws.String("default")}},
+				}
+			}),
+			SecurityGroups: []*ec2.GroupIdentifier{{GroupId: aws.String("sg-123"), GroupName: aws.String("default")}},
+		})
+	}
+	return &unmarshalingEC2API{EC2API: ec2api}
+}
+
+func (e *unmarshalingEC2API) DescribeInstancesPagesWithContext(ctx context.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, opts ...request.Option) error {
+	return e.EC2API.DescribeInstancesPagesWithContext(ctx, input, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		return fn(awsutil.CopyOf(page).(*ec2.DescribeInstancesOutput), lastPage)
+	}, opts...)
+}
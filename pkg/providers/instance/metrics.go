@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	cloudProviderSubsystem = "cloudprovider"
+	reasonLabel            = "reason"
+
+	insufficientCapacityReason = "insufficient-capacity"
+	unauthorizedReason         = "unauthorized"
+	throttledReason            = "throttled"
+	quotaExceededReason        = "quota-exceeded"
+	otherReason                = "other"
+)
+
+var (
+	launchFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "instance_launch_failures_total",
+			Help:      "Number of failed instance launches. Labeled by the reason for the failure, which is one of insufficient-capacity, unauthorized, throttled, quota-exceeded or other.",
+		},
+		[]string{reasonLabel},
+	)
+	spotFallbacksCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "instance_spot_fallbacks_total",
+			Help:      "Number of instance launches that fell back from spot to on-demand after repeated spot insufficient capacity errors.",
+		},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(launchFailuresCounter, spotFallbacksCounter)
+}
@@ -0,0 +1,46 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"context"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/scheduling"
+)
+
+// SelectionStrategy chooses the offerings that are submitted to CreateFleet when launching a machine. It's passed the
+// instance types that are compatible with the machine, whose available offerings are the candidates, and returns the
+// instance types to submit in order of preference. Instance types that are ordered first are kept when
+// aws.maxFleetOverrides limits the overrides of a launch, and their overrides are submitted first. CreateFleet still
+// picks the offering that's launched based on its allocation strategy.
+type SelectionStrategy interface {
+	Select(ctx context.Context, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType
+}
+
+// DefaultSelectionStrategy filters out exotic instance types, and spot instance types that are more expensive than the
+// cheapest on-demand instance type during mixed capacity type launches. It orders the rest by price and submits the
+// cheapest MaxInstanceTypes of them.
+type DefaultSelectionStrategy struct{}
+
+func (DefaultSelectionStrategy) Select(_ context.Context, machine *v1alpha5.Machine, instanceTypes []*cloudprovider.InstanceType) []*cloudprovider.InstanceType {
+	instanceTypes = filterInstanceTypes(machine, instanceTypes)
+	instanceTypes = orderInstanceTypesByPrice(instanceTypes, scheduling.NewNodeSelectorRequirements(machine.Spec.Requirements...))
+	if len(instanceTypes) > MaxInstanceTypes {
+		instanceTypes = instanceTypes[0:MaxInstanceTypes]
+	}
+	return instanceTypes
+}
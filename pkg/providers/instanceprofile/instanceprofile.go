@@ -0,0 +1,305 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instanceprofile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/mitchellh/hashstructure/v2"
+	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/logging"
+
+	awssettings "github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	awserrors "github.com/aws/karpenter/pkg/errors"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/utils/functional"
+	"github.com/aws/karpenter-core/pkg/utils/pretty"
+)
+
+// requiredPolicies maps the managed policies that the node role needs to join the cluster to the actions they grant
+// nodes. The CNI policy isn't required, since it's commonly granted to the aws-node service account instead.
+var requiredPolicies = map[string][]string{
+	"AmazonEKSWorkerNodePolicy": {
+		"ec2:DescribeInstances",
+		"ec2:DescribeRouteTables",
+		"ec2:DescribeSecurityGroups",
+		"ec2:DescribeSubnets",
+		"ec2:DescribeVolumes",
+		"ec2:DescribeVolumesModifications",
+		"ec2:DescribeVpcs",
+		"eks:DescribeCluster",
+	},
+	"AmazonEC2ContainerRegistryReadOnly": {
+		"ecr:GetAuthorizationToken",
+		"ecr:BatchCheckLayerAvailability",
+		"ecr:GetDownloadUrlForLayer",
+		"ecr:BatchGetImage",
+	},
+}
+
+type Provider struct {
+	sync.Mutex
+	iamapi iamiface.IAMAPI
+	cache  *cache.Cache
+	cm     *pretty.ChangeMonitor
+}
+
+func NewProvider(iamapi iamiface.IAMAPI, cache *cache.Cache) *Provider {
+	return &Provider{
+		iamapi: iamapi,
+		cm:     pretty.NewChangeMonitor(),
+		cache:  cache,
+	}
+}
+
+// Get returns the name of the instance profile that instances launched from the node template use. A profile named by
+// spec.instanceProfile is used as is, so a profile that doesn't exist fails at launch. Otherwise, the profile is resolved
+// from spec.instanceProfileSelector, falling back to the default instance profile if there's no selector.
+func (p *Provider) Get(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (string, error) {
+	if nodeTemplate.Spec.InstanceProfile != nil {
+		return aws.StringValue(nodeTemplate.Spec.InstanceProfile), nil
+	}
+	if len(nodeTemplate.Spec.InstanceProfileSelector) != 0 {
+		return p.resolve(ctx, nodeTemplate.Spec.InstanceProfileSelector)
+	}
+	defaultProfile := awssettings.FromContext(ctx).DefaultInstanceProfile
+	if defaultProfile == "" {
+		return "", errors.New("neither spec.provider.instanceProfile, spec.instanceProfileSelector nor --aws-default-instance-profile is specified")
+	}
+	return defaultProfile, nil
+}
+
+// resolve returns the name of the instance profile that matches the selector. If several profiles match, the one whose
+// name sorts first is chosen so that the same profile is used for every launch template.
+func (p *Provider) resolve(ctx context.Context, selector map[string]string) (string, error) {
+	p.Lock()
+	defer p.Unlock()
+	hash, err := hashstructure.Hash(selector, hashstructure.FormatV2, nil)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := p.cache.Get(fmt.Sprint(hash)); ok {
+		return name.(string), nil
+	}
+	var profiles []*iam.InstanceProfile
+	if err := p.iamapi.ListInstanceProfilesPagesWithContext(ctx, &iam.ListInstanceProfilesInput{}, func(output *iam.ListInstanceProfilesOutput, _ bool) bool {
+		profiles = append(profiles, output.InstanceProfiles...)
+		return true
+	}); err != nil {
+		return "", fmt.Errorf("listing instance profiles, %w", err)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return aws.StringValue(profiles[i].InstanceProfileName) < aws.StringValue(profiles[j].InstanceProfileName)
+	})
+	for _, profile := range profiles {
+		ok, err := p.matches(ctx, profile, selector)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		name := aws.StringValue(profile.InstanceProfileName)
+		p.cache.SetDefault(fmt.Sprint(hash), name)
+		if p.cm.HasChanged(fmt.Sprintf("instance-profile/%d", hash), name) {
+			logging.FromContext(ctx).With("instance-profile", name, "selector", selector).Debugf("discovered instance profile")
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("no instance profile matched instanceProfileSelector %v", selector)
+}
+
+// matches returns true if the instance profile matches every term of the selector. The aws::roles key matches profiles
+// containing one of the comma-separated roles, and every other key matches a tag, with a value of "*" matching any value.
+func (p *Provider) matches(ctx context.Context, profile *iam.InstanceProfile, selector map[string]string) (bool, error) {
+	if roles, ok := selector["aws::roles"]; ok {
+		roleNames := functional.SplitCommaSeparatedString(roles)
+		if !lo.ContainsBy(profile.Roles, func(role *iam.Role) bool { return lo.Contains(roleNames, aws.StringValue(role.RoleName)) }) {
+			return false, nil
+		}
+	}
+	tagSelector := lo.OmitByKeys(selector, []string{"aws::roles"})
+	if len(tagSelector) == 0 {
+		return true, nil
+	}
+	// Tags aren't returned when listing instance profiles, so they're listed for each profile
+	output, err := p.iamapi.ListInstanceProfileTagsWithContext(ctx, &iam.ListInstanceProfileTagsInput{
+		InstanceProfileName: profile.InstanceProfileName,
+	})
+	if err != nil {
+		return false, fmt.Errorf("listing tags of instance profile %s, %w", aws.StringValue(profile.InstanceProfileName), err)
+	}
+	tags := lo.SliceToMap(output.Tags, func(tag *iam.Tag) (string, string) {
+		return aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+	})
+	for key, value := range tagSelector {
+		if tagValue, ok := tags[key]; !ok || (value != "*" && tagValue != value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// MissingPolicies returns the required policies that the role of the instance profile neither has attached nor is
+// allowed the actions of by other policies. Errors from IAM, e.g. when the controller isn't allowed to read the role,
+// are returned so that callers can treat the check as best-effort.
+func (p *Provider) MissingPolicies(ctx context.Context, name string) ([]string, error) {
+	if missing, ok := p.cache.Get("policies/" + name); ok {
+		return missing.([]string), nil
+	}
+	output, err := p.iamapi.GetInstanceProfileWithContext(ctx, &iam.GetInstanceProfileInput{InstanceProfileName: aws.String(name)})
+	if err != nil {
+		return nil, fmt.Errorf("getting instance profile %s, %w", name, err)
+	}
+	missing := lo.Keys(requiredPolicies)
+	if len(output.InstanceProfile.Roles) != 0 {
+		if missing, err = p.missingPolicies(ctx, output.InstanceProfile.Roles[0]); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(missing)
+	p.cache.SetDefault("policies/"+name, missing)
+	return missing, nil
+}
+
+func (p *Provider) missingPolicies(ctx context.Context, role *iam.Role) ([]string, error) {
+	var attached []string
+	if err := p.iamapi.ListAttachedRolePoliciesPagesWithContext(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: role.RoleName}, func(output *iam.ListAttachedRolePoliciesOutput, _ bool) bool {
+		attached = append(attached, lo.Map(output.AttachedPolicies, func(policy *iam.AttachedPolicy, _ int) string { return aws.StringValue(policy.PolicyName) })...)
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("listing policies attached to role %s, %w", aws.StringValue(role.RoleName), err)
+	}
+	var missing []string
+	for policy, actions := range requiredPolicies {
+		if lo.Contains(attached, policy) {
+			continue
+		}
+		// The actions may be granted by an inline or customer managed policy instead
+		output, err := p.iamapi.SimulatePrincipalPolicyWithContext(ctx, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: role.Arn,
+			ActionNames:     aws.StringSlice(actions),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("simulating policies of role %s, %w", aws.StringValue(role.RoleName), err)
+		}
+		allowed := lo.FilterMap(output.EvaluationResults, func(result *iam.EvaluationResult, _ int) (string, bool) {
+			return aws.StringValue(result.EvalActionName), aws.StringValue(result.EvalDecision) == iam.PolicyEvaluationDecisionTypeAllowed
+		})
+		if len(lo.Without(actions, allowed...)) != 0 {
+			missing = append(missing, policy)
+		}
+	}
+	return missing, nil
+}
+
+// DeleteOrphaned deletes the Karpenter-managed instance profiles owned by a node template that no longer exists, after
+// removing their roles. Profiles that are still used by an instance, as reported by inUse for their ARN, and profiles
+// created within the grace period are kept, so that a profile created for a node template that was just applied isn't
+// deleted.
+func (p *Provider) DeleteOrphaned(ctx context.Context, nodeTemplates sets.String, inUse func(context.Context, string) (bool, error), gracePeriod time.Duration) (int, error) {
+	var profiles []*iam.InstanceProfile
+	if err := p.iamapi.ListInstanceProfilesPagesWithContext(ctx, &iam.ListInstanceProfilesInput{}, func(output *iam.ListInstanceProfilesOutput, _ bool) bool {
+		profiles = append(profiles, output.InstanceProfiles...)
+		return true
+	}); err != nil {
+		return 0, fmt.Errorf("listing instance profiles, %w", err)
+	}
+	var errs []error
+	deleted := 0
+	for _, profile := range profiles {
+		if profile.CreateDate == nil || time.Since(aws.TimeValue(profile.CreateDate)) < gracePeriod {
+			continue
+		}
+		owner, err := p.owner(ctx, profile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if owner == "" || nodeTemplates.Has(owner) {
+			continue
+		}
+		// Only the orphaned profiles are looked up, since they're few compared to the instances of the cluster
+		used, err := inUse(ctx, aws.StringValue(profile.Arn))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if used {
+			continue
+		}
+		if err := p.delete(ctx, profile); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logging.FromContext(ctx).With("instance-profile", aws.StringValue(profile.InstanceProfileName), "awsnodetemplate", owner).Debugf("deleted orphaned instance profile")
+		deleted++
+	}
+	return deleted, multierr.Combine(errs...)
+}
+
+// owner returns the name of the node template that owns the instance profile, or an empty string if the profile isn't
+// managed by Karpenter for the cluster or isn't owned by a node template
+func (p *Provider) owner(ctx context.Context, profile *iam.InstanceProfile) (string, error) {
+	// Tags aren't returned when listing instance profiles, so they're listed for each profile
+	output, err := p.iamapi.ListInstanceProfileTagsWithContext(ctx, &iam.ListInstanceProfileTagsInput{
+		InstanceProfileName: profile.InstanceProfileName,
+	})
+	if err != nil {
+		if awserrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("listing tags of instance profile %s, %w", aws.StringValue(profile.InstanceProfileName), err)
+	}
+	tags := lo.SliceToMap(output.Tags, func(tag *iam.Tag) (string, string) {
+		return aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+	})
+	if tags[v1alpha5.ManagedByLabelKey] != awssettings.FromContext(ctx).ClusterName {
+		return "", nil
+	}
+	return tags[v1alpha1.TagNodeTemplate], nil
+}
+
+// delete removes the roles of the instance profile, since IAM doesn't delete instance profiles that contain a role,
+// and then deletes the profile
+func (p *Provider) delete(ctx context.Context, profile *iam.InstanceProfile) error {
+	for _, role := range profile.Roles {
+		if _, err := p.iamapi.RemoveRoleFromInstanceProfileWithContext(ctx, &iam.RemoveRoleFromInstanceProfileInput{
+			InstanceProfileName: profile.InstanceProfileName,
+			RoleName:            role.RoleName,
+		}); err != nil && !awserrors.IsNotFound(err) {
+			return fmt.Errorf("removing role %s from instance profile %s, %w", aws.StringValue(role.RoleName), aws.StringValue(profile.InstanceProfileName), err)
+		}
+	}
+	if _, err := p.iamapi.DeleteInstanceProfileWithContext(ctx, &iam.DeleteInstanceProfileInput{
+		InstanceProfileName: profile.InstanceProfileName,
+	}); err != nil && !awserrors.IsNotFound(err) {
+		return fmt.Errorf("deleting instance profile %s, %w", aws.StringValue(profile.InstanceProfileName), err)
+	}
+	return nil
+}
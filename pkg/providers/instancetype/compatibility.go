@@ -0,0 +1,152 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	"github.com/aws/karpenter-core/pkg/cloudprovider"
+	"github.com/aws/karpenter-core/pkg/scheduling"
+	"github.com/aws/karpenter-core/pkg/utils/resources"
+)
+
+const (
+	// ConstraintRequirements eliminates instance types that are incompatible with the requirements in a way that can't
+	// be attributed to a single label, e.g. a custom label that instance types don't define
+	ConstraintRequirements = "requirements"
+	// ConstraintOfferings eliminates instance types that are compatible with the zone and capacity type requirements
+	// individually, but have no offering that combines an allowed zone with an allowed capacity type
+	ConstraintOfferings = "offerings"
+	// ConstraintUnavailableOfferings eliminates instance types whose offerings are all temporarily unavailable
+	ConstraintUnavailableOfferings = "unavailable-offerings"
+	// ConstraintResources eliminates instance types that are too small for the resource requests
+	ConstraintResources = "resources"
+
+	// maxReportedInstanceTypes bounds the instance types listed for each constraint in the error message
+	maxReportedInstanceTypes = 3
+)
+
+// NoCompatibleInstanceTypesError is returned when the requirements of a machine exclude every instance type. It
+// records which instance types each constraint eliminated so that over-constrained provisioners are easy to debug.
+type NoCompatibleInstanceTypesError struct {
+	// Eliminated maps each constraint to the names of the instance types it eliminated. Constraints are either a
+	// requirement label key or one of the Constraint* values. An instance type is listed under every constraint that
+	// eliminated it.
+	Eliminated map[string][]string
+}
+
+func (e *NoCompatibleInstanceTypesError) Error() string {
+	if len(e.Eliminated) == 0 {
+		return "no instance types satisfy the requirements, no instance types were offered"
+	}
+	constraints := lo.Keys(e.Eliminated)
+	sort.Strings(constraints)
+	return fmt.Sprintf("no instance types satisfy the requirements, %s", strings.Join(lo.Map(constraints, func(c string, _ int) string {
+		names := e.Eliminated[c]
+		listed := strings.Join(lo.Slice(names, 0, maxReportedInstanceTypes), ", ")
+		if len(names) > maxReportedInstanceTypes {
+			listed += ", ..."
+		}
+		return fmt.Sprintf("%s eliminated %d (%s)", c, len(names), listed)
+	}), "; "))
+}
+
+func IsNoCompatibleInstanceTypesError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var noCompatibleErr *NoCompatibleInstanceTypesError
+	return errors.As(err, &noCompatibleErr)
+}
+
+// IsUnavailableOfferingsError returns true if the error is a NoCompatibleInstanceTypesError where some instance type
+// was only eliminated because its offerings are temporarily unavailable, so launching may succeed once they're available
+func IsUnavailableOfferingsError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var noCompatibleErr *NoCompatibleInstanceTypesError
+	if !errors.As(err, &noCompatibleErr) {
+		return false
+	}
+	otherwiseEliminated := sets.NewString()
+	for c, names := range noCompatibleErr.Eliminated {
+		if c != ConstraintUnavailableOfferings {
+			otherwiseEliminated.Insert(names...)
+		}
+	}
+	return lo.SomeBy(noCompatibleErr.Eliminated[ConstraintUnavailableOfferings], func(name string) bool {
+		return !otherwiseEliminated.Has(name)
+	})
+}
+
+// Compatible returns the instance types that satisfy the requirements, have an available offering and fit the resource
+// requests. If none do, it returns a NoCompatibleInstanceTypesError describing why each instance type was eliminated.
+func Compatible(instanceTypes []*cloudprovider.InstanceType, requirements scheduling.Requirements, requests v1.ResourceList) ([]*cloudprovider.InstanceType, error) {
+	eliminated := map[string][]string{}
+	var compatible []*cloudprovider.InstanceType
+	for _, it := range instanceTypes {
+		constraints := incompatibleConstraints(it, requirements, requests)
+		if len(constraints) == 0 {
+			compatible = append(compatible, it)
+			continue
+		}
+		for _, c := range constraints {
+			eliminated[c] = append(eliminated[c], it.Name)
+		}
+	}
+	if len(compatible) == 0 {
+		return nil, &NoCompatibleInstanceTypesError{Eliminated: eliminated}
+	}
+	return compatible, nil
+}
+
+func incompatibleConstraints(instanceType *cloudprovider.InstanceType, requirements scheduling.Requirements, requests v1.ResourceList) []string {
+	var constraints []string
+	offerings := instanceType.Offerings.Requirements(requirements)
+	unavailable := len(offerings) > 0 && len(offerings.Available()) == 0
+	if err := requirements.Compatible(instanceType.Requirements); err != nil {
+		keys := lo.Filter(requirements.Keys().List(), func(key string, _ int) bool {
+			return scheduling.NewRequirements(requirements.Get(key)).Intersects(instanceType.Requirements) != nil
+		})
+		// The zone and capacity type requirements of an instance type only include its available offerings, so they're
+		// incompatible because of the unavailable offerings rather than the requirements
+		if unavailable {
+			keys = lo.Without(keys, v1.LabelTopologyZone, v1alpha5.LabelCapacityType)
+		}
+		if len(keys) > 0 {
+			constraints = append(constraints, keys...)
+		} else if !unavailable {
+			constraints = append(constraints, ConstraintRequirements)
+		}
+	}
+	if unavailable {
+		constraints = append(constraints, ConstraintUnavailableOfferings)
+	} else if len(offerings) == 0 && len(constraints) == 0 {
+		constraints = append(constraints, ConstraintOfferings)
+	}
+	if !resources.Fits(requests, instanceType.Allocatable()) {
+		constraints = append(constraints, ConstraintResources)
+	}
+	return constraints
+}
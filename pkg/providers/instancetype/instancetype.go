@@ -18,8 +18,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	awscache "github.com/aws/karpenter/pkg/cache"
 
@@ -28,10 +31,13 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/logging"
 
+	awssettings "github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	"github.com/aws/karpenter/pkg/providers/pricing"
 	"github.com/aws/karpenter/pkg/providers/subnet"
@@ -43,15 +49,23 @@ import (
 
 const (
 	InstanceTypesCacheKey           = "types"
+	InstanceTypeOfferingsCacheKey   = "offerings"
 	InstanceTypeZonesCacheKeyPrefix = "zones:"
 )
 
+// WarmUpTimeout bounds how long the caches are warmed up for on startup before the provider reports ready regardless
+var WarmUpTimeout = time.Minute
+
+// singleTenancyUnsupportedFamilies are the instance families that can't be launched with dedicated or host tenancy
+var singleTenancyUnsupportedFamilies = sets.NewString("t1", "t2")
+
 type Provider struct {
 	region          string
 	ec2api          ec2iface.EC2API
 	subnetProvider  *subnet.Provider
 	pricingProvider *pricing.Provider
 	// Has one cache entry for all the instance types (key: InstanceTypesCacheKey)
+	// Has one cache entry for the zones of all the instance types, regardless of subnets (key: InstanceTypeOfferingsCacheKey)
 	// Has one cache entry for all the zones for each subnet selector (key: InstanceTypesZonesCacheKeyPrefix:<hash_of_selector>)
 	// Values cached *before* considering insufficient capacity errors from the unavailableOfferings cache.
 	// Fully initialized Instance Types are also cached based on the set of all instance types, zones, unavailableOfferings cache,
@@ -64,6 +78,8 @@ type Provider struct {
 	cm                   *pretty.ChangeMonitor
 	// instanceTypesSeqNum is a monotonically increasing change counter used to avoid the expensive hashing operation on instance types
 	instanceTypesSeqNum uint64
+	// warmedUp is set once the caches were warmed up on startup, or the warm-up gave up
+	warmedUp atomic.Bool
 }
 
 func NewProvider(region string, cache *cache.Cache, ec2api ec2iface.EC2API, subnetProvider *subnet.Provider,
@@ -95,18 +111,158 @@ func (p *Provider) List(ctx context.Context, kc *v1alpha5.KubeletConfiguration,
 	// Compute fully initialized instance types hash key
 	instanceTypeZonesHash, _ := hashstructure.Hash(instanceTypeZones, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
 	kcHash, _ := hashstructure.Hash(kc, hashstructure.FormatV2, &hashstructure.HashOptions{SlicesAsSets: true})
-	key := fmt.Sprintf("%d-%d-%s-%016x-%016x", p.instanceTypesSeqNum, p.unavailableOfferings.SeqNum, nodeTemplate.UID, instanceTypeZonesHash, kcHash)
+	placementHash, _ := hashstructure.Hash([]interface{}{nodeTemplate.Spec.Placement, nodeTemplate.Spec.Tenancy, nodeTemplate.Spec.EFA,
+		nodeTemplate.Spec.NetworkInterfaces}, hashstructure.FormatV2, nil)
+	key := fmt.Sprintf("%d-%d-%s-%016x-%016x-%016x-%s", p.instanceTypesSeqNum, p.unavailableOfferings.SeqNum, nodeTemplate.UID, instanceTypeZonesHash, kcHash, placementHash,
+		aws.StringValue(nodeTemplate.Spec.MaxPrice))
 
 	if item, ok := p.cache.Get(key); ok {
 		return item.([]*cloudprovider.InstanceType), nil
 	}
+	// Instance types that can't be launched into the node template's placement group, onto its tenancy, with an EFA or
+	// its network interfaces, or that can't run the node template's operating system are never offered
+	instanceTypes = lo.Filter(instanceTypes, func(i *ec2.InstanceTypeInfo, _ int) bool {
+		return supportsPlacement(i, nodeTemplate.Spec.Placement) && supportsTenancy(i, nodeTemplate.Spec.Tenancy) &&
+			supportsEFA(i, nodeTemplate.Spec.EFA) && supportsNetworkInterfaces(i, nodeTemplate.Spec.NetworkInterfaces) &&
+			supportsAMIFamily(i, nodeTemplate.Spec.AMIFamily)
+	})
 	result := lo.Map(instanceTypes, func(i *ec2.InstanceTypeInfo, _ int) *cloudprovider.InstanceType {
-		return NewInstanceType(ctx, i, kc, p.region, nodeTemplate, p.createOfferings(ctx, i, instanceTypeZones[aws.StringValue(i.InstanceType)]))
+		offerings := withinTenancy(p.createOfferings(ctx, i, instanceTypeZones[aws.StringValue(i.InstanceType)]), nodeTemplate.Spec.Tenancy)
+		return NewInstanceType(ctx, i, kc, p.region, nodeTemplate, withinMaxPrice(offerings, nodeTemplate.Spec.MaxPrice))
+	})
+	// Reserved resources are configurable, so an instance type may be left without any allocatable cpu or memory, and
+	// every offering of an instance type may be priced above the node template's maximum price
+	result = lo.Filter(result, func(i *cloudprovider.InstanceType, _ int) bool {
+		return hasAllocatable(i) && len(i.Offerings) > 0
 	})
 	p.cache.SetDefault(key, result)
 	return result, nil
 }
 
+// withinMaxPrice returns the offerings that are priced at or below the maximum hourly price. The maximum price is
+// validated by the webhook, so an unparseable value doesn't exclude any offerings.
+func withinMaxPrice(offerings []cloudprovider.Offering, maxPrice *string) []cloudprovider.Offering {
+	if maxPrice == nil {
+		return offerings
+	}
+	ceiling, err := strconv.ParseFloat(*maxPrice, 64)
+	if err != nil {
+		return offerings
+	}
+	return lo.Filter(offerings, func(o cloudprovider.Offering, _ int) bool {
+		return o.Price <= ceiling
+	})
+}
+
+// hasAllocatable returns true if the instance type has cpu and memory left over once the overhead is reserved
+func hasAllocatable(instanceType *cloudprovider.InstanceType) bool {
+	overhead := instanceType.Overhead.Total()
+	for _, resourceName := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		capacity := instanceType.Capacity[resourceName]
+		if capacity.Cmp(overhead[resourceName]) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// supportsPlacement returns true if the instance type supports the strategy of the placement group. Cluster
+// placement groups, for example, don't support burstable instance types.
+func supportsPlacement(instanceType *ec2.InstanceTypeInfo, placement *v1alpha1.Placement) bool {
+	if placement == nil || instanceType.PlacementGroupInfo == nil {
+		return true
+	}
+	return lo.Contains(aws.StringValueSlice(instanceType.PlacementGroupInfo.SupportedStrategies), placement.Strategy)
+}
+
+// supportsTenancy returns true if the instance type can be launched with the tenancy. Some previous generation
+// instance families can't run on single-tenant hardware.
+func supportsTenancy(instanceType *ec2.InstanceTypeInfo, tenancy *string) bool {
+	if lo.FromPtr(tenancy) == "" || lo.FromPtr(tenancy) == v1alpha1.TenancyDefault {
+		return true
+	}
+	return !singleTenancyUnsupportedFamilies.Has(strings.Split(aws.StringValue(instanceType.InstanceType), ".")[0])
+}
+
+// supportsEFA returns true if the instance type can be launched with an EFA when the node template requests one
+func supportsEFA(instanceType *ec2.InstanceTypeInfo, efa *bool) bool {
+	return !lo.FromPtr(efa) || aws.BoolValue(instanceType.NetworkInfo.EfaSupported)
+}
+
+// supportsNetworkInterfaces returns true if the instance type can attach the primary network interface along with the
+// secondary network interfaces at their device indexes
+func supportsNetworkInterfaces(instanceType *ec2.InstanceTypeInfo, networkInterfaces []v1alpha1.NetworkInterface) bool {
+	if len(networkInterfaces) == 0 {
+		return true
+	}
+	required := lo.Max(append(lo.Map(networkInterfaces, func(ni v1alpha1.NetworkInterface, _ int) int64 {
+		return ni.DeviceIndex + 1
+	}), int64(len(networkInterfaces)+1)))
+	return aws.Int64Value(instanceType.NetworkInfo.MaximumNetworkInterfaces) >= required
+}
+
+// withinTenancy returns the offerings that can be launched with the tenancy. Spot capacity isn't offered on
+// single-tenant hardware, so only on-demand offerings are kept for dedicated and host tenancy.
+func withinTenancy(offerings []cloudprovider.Offering, tenancy *string) []cloudprovider.Offering {
+	if lo.FromPtr(tenancy) == "" || lo.FromPtr(tenancy) == v1alpha1.TenancyDefault {
+		return offerings
+	}
+	return lo.Filter(offerings, func(o cloudprovider.Offering, _ int) bool {
+		return o.CapacityType == v1alpha5.CapacityTypeOnDemand
+	})
+}
+
+// supportsAMIFamily returns true if the instance type can run the operating system of the AMI family. The EKS
+// optimized Windows AMIs are only built for x86_64 and don't ship drivers for AWS Neuron accelerators.
+func supportsAMIFamily(instanceType *ec2.InstanceTypeInfo, amiFamily *string) bool {
+	switch aws.StringValue(amiFamily) {
+	case v1alpha1.AMIFamilyWindows2019, v1alpha1.AMIFamilyWindows2022:
+		return lo.Contains(aws.StringValueSlice(instanceType.ProcessorInfo.SupportedArchitectures), ec2.ArchitectureTypeX8664) &&
+			instanceType.InferenceAcceleratorInfo == nil
+	default:
+		return true
+	}
+}
+
+// WarmUp pre-populates the cached instance types, their zonal offerings and pricing on startup, so that the first
+// provisioning decisions after a cold start are served from the cache. The warm-up is bounded by WarmUpTimeout and
+// a failed warm-up falls back to populating the caches lazily, so that startup isn't blocked when EC2 is unavailable.
+func (p *Provider) WarmUp(ctx context.Context) {
+	defer p.warmedUp.Store(true)
+	ctx, cancel := context.WithTimeout(ctx, WarmUpTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := p.warmUp(ctx); err != nil {
+		logging.FromContext(ctx).Errorf("warming up instance type caches, %s", err)
+		return
+	}
+	warmUpDuration.Set(time.Since(start).Seconds())
+	logging.FromContext(ctx).With("duration", time.Since(start)).Debugf("warmed up instance type caches")
+}
+
+func (p *Provider) warmUp(ctx context.Context) error {
+	if _, err := p.GetInstanceTypes(ctx); err != nil {
+		return err
+	}
+	if _, err := p.getInstanceTypeOfferings(ctx); err != nil {
+		return err
+	}
+	select {
+	case <-p.pricingProvider.InitialUpdate():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the initial pricing update, %w", ctx.Err())
+	}
+}
+
+// ReadinessProbe reports the provider as ready once the caches were warmed up on startup
+func (p *Provider) ReadinessProbe(_ *http.Request) error {
+	if !p.warmedUp.Load() {
+		return fmt.Errorf("warming up instance type caches")
+	}
+	return nil
+}
+
 func (p *Provider) LivenessProbe(req *http.Request) error {
 	if err := p.subnetProvider.LivenessProbe(req); err != nil {
 		return err
@@ -128,7 +284,7 @@ func (p *Provider) createOfferings(ctx context.Context, instanceType *ec2.Instan
 			var ok bool
 			switch capacityType {
 			case ec2.UsageClassTypeSpot:
-				price, ok = p.pricingProvider.SpotPrice(*instanceType.InstanceType, zone)
+				price, ok = p.pricingProvider.LookupSpotPrice(ctx, *instanceType.InstanceType, zone)
 			case ec2.UsageClassTypeOnDemand:
 				price, ok = p.pricingProvider.OnDemandPrice(*instanceType.InstanceType)
 			default:
@@ -152,7 +308,9 @@ func (p *Provider) getInstanceTypeZones(ctx context.Context, nodeTemplate *v1alp
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash the subnet selector: %w", err)
 	}
-	cacheKey := fmt.Sprintf("%s%016x", InstanceTypeZonesCacheKeyPrefix, subnetSelectorHash)
+	// Zones that aren't allowed by the settings are never offered, so the cached zones depend on them as well
+	zoneSettingsHash, _ := hashstructure.Hash([][]string{awssettings.FromContext(ctx).AllowedZones, awssettings.FromContext(ctx).BlockedZones}, hashstructure.FormatV2, nil)
+	cacheKey := fmt.Sprintf("%s%016x-%016x", InstanceTypeZonesCacheKeyPrefix, subnetSelectorHash, zoneSettingsHash)
 	if cached, ok := p.cache.Get(cacheKey); ok {
 		return cached.(map[string]sets.String), nil
 	}
@@ -165,31 +323,48 @@ func (p *Provider) getInstanceTypeZones(ctx context.Context, nodeTemplate *v1alp
 	if len(subnets) == 0 {
 		return nil, fmt.Errorf("no subnets matched selector %v", nodeTemplate.Spec.SubnetSelector)
 	}
-	zones := sets.NewString(lo.Map(subnets, func(subnet *ec2.Subnet, _ int) string {
-		return aws.StringValue(subnet.AvailabilityZone)
+	zones := sets.NewString(lo.FilterMap(subnets, func(subnet *ec2.Subnet, _ int) (string, bool) {
+		return aws.StringValue(subnet.AvailabilityZone), awssettings.FromContext(ctx).IsZoneAllowed(aws.StringValue(subnet.AvailabilityZone))
 	})...)
 
 	// Get offerings from EC2
+	offerings, err := p.getInstanceTypeOfferings(ctx)
+	if err != nil {
+		return nil, err
+	}
 	instanceTypeZones := map[string]sets.String{}
+	for instanceType, offeredZones := range offerings {
+		if intersection := offeredZones.Intersection(zones); intersection.Len() > 0 {
+			instanceTypeZones[instanceType] = intersection
+		}
+	}
+	if p.cm.HasChanged("zonal-offerings", nodeTemplate.Spec.SubnetSelector) {
+		logging.FromContext(ctx).With("subnet-selector", pretty.Concise(nodeTemplate.Spec.SubnetSelector)).Debugf("discovered EC2 instance types zonal offerings for subnets")
+	}
+	p.cache.SetDefault(cacheKey, instanceTypeZones)
+	return instanceTypeZones, nil
+}
+
+// getInstanceTypeOfferings returns the zones that each instance type is offered in, regardless of the subnets
+func (p *Provider) getInstanceTypeOfferings(ctx context.Context) (map[string]sets.String, error) {
+	if cached, ok := p.cache.Get(InstanceTypeOfferingsCacheKey); ok {
+		return cached.(map[string]sets.String), nil
+	}
+	offerings := map[string]sets.String{}
 	if err := p.ec2api.DescribeInstanceTypeOfferingsPagesWithContext(ctx, &ec2.DescribeInstanceTypeOfferingsInput{LocationType: aws.String("availability-zone")},
 		func(output *ec2.DescribeInstanceTypeOfferingsOutput, lastPage bool) bool {
 			for _, offering := range output.InstanceTypeOfferings {
-				if zones.Has(aws.StringValue(offering.Location)) {
-					if _, ok := instanceTypeZones[aws.StringValue(offering.InstanceType)]; !ok {
-						instanceTypeZones[aws.StringValue(offering.InstanceType)] = sets.NewString()
-					}
-					instanceTypeZones[aws.StringValue(offering.InstanceType)].Insert(aws.StringValue(offering.Location))
+				if _, ok := offerings[aws.StringValue(offering.InstanceType)]; !ok {
+					offerings[aws.StringValue(offering.InstanceType)] = sets.NewString()
 				}
+				offerings[aws.StringValue(offering.InstanceType)].Insert(aws.StringValue(offering.Location))
 			}
 			return true
 		}); err != nil {
 		return nil, fmt.Errorf("describing instance type zone offerings, %w", err)
 	}
-	if p.cm.HasChanged("zonal-offerings", nodeTemplate.Spec.SubnetSelector) {
-		logging.FromContext(ctx).With("subnet-selector", pretty.Concise(nodeTemplate.Spec.SubnetSelector)).Debugf("discovered EC2 instance types zonal offerings for subnets")
-	}
-	p.cache.SetDefault(cacheKey, instanceTypeZones)
-	return instanceTypeZones, nil
+	p.cache.SetDefault(InstanceTypeOfferingsCacheKey, offerings)
+	return offerings, nil
 }
 
 // GetInstanceTypes retrieves all instance types from the ec2 DescribeInstanceTypes API using some opinionated filters
@@ -205,6 +380,93 @@ func (p *Provider) GetInstanceTypes(ctx context.Context) ([]*ec2.InstanceTypeInf
 	if cached, ok := p.cache.Get(InstanceTypesCacheKey); ok {
 		return cached.([]*ec2.InstanceTypeInfo), nil
 	}
+	instanceTypes, err := p.describeInstanceTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.cm.HasChanged("instance-types", instanceTypes) {
+		logging.FromContext(ctx).With(
+			"instance-type-count", len(instanceTypes)).Debugf("discovered EC2 instance types")
+	}
+	atomic.AddUint64(&p.instanceTypesSeqNum, 1)
+	p.cache.SetDefault(InstanceTypesCacheKey, instanceTypes)
+	instanceTypesDiscovered.Set(float64(len(instanceTypes)))
+	return instanceTypes, nil
+}
+
+// Refresh re-discovers the instance types from EC2 and merges them into the known instance types, so that newly
+// released instance types can be launched without a restart. Instance types are never modified in place, so callers
+// that are still using the previously returned instance types aren't affected. The availability of their offerings is
+// reported once they're refreshed.
+func (p *Provider) Refresh(ctx context.Context) error {
+	// Describe outside of the lock so that callers of GetInstanceTypes aren't blocked for the duration of the refresh
+	discovered, err := p.describeInstanceTypes(ctx)
+	if err != nil {
+		return err
+	}
+	return p.updateOfferingAvailability(ctx, p.merge(ctx, discovered))
+}
+
+// merge merges the discovered instance types into the known instance types and returns the result
+func (p *Provider) merge(ctx context.Context, discovered []*ec2.InstanceTypeInfo) []*ec2.InstanceTypeInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var known []*ec2.InstanceTypeInfo
+	if cached, ok := p.cache.Get(InstanceTypesCacheKey); ok {
+		known = cached.([]*ec2.InstanceTypeInfo)
+	}
+	knownNames := sets.NewString(lo.Map(known, func(i *ec2.InstanceTypeInfo, _ int) string { return aws.StringValue(i.InstanceType) })...)
+	discoveredNames := sets.NewString(lo.Map(discovered, func(i *ec2.InstanceTypeInfo, _ int) string { return aws.StringValue(i.InstanceType) })...)
+	// Known instance types that weren't returned by this refresh are kept, the latest description of the rest is used
+	instanceTypes := append(lo.Reject(known, func(i *ec2.InstanceTypeInfo, _ int) bool {
+		return discoveredNames.Has(aws.StringValue(i.InstanceType))
+	}), discovered...)
+	if added := discoveredNames.Difference(knownNames); added.Len() > 0 {
+		logging.FromContext(ctx).With("instance-types", added.List()).Debugf("discovered new EC2 instance types")
+	}
+	atomic.AddUint64(&p.instanceTypesSeqNum, 1)
+	p.cache.SetDefault(InstanceTypesCacheKey, instanceTypes)
+	instanceTypesDiscovered.Set(float64(len(instanceTypes)))
+	return instanceTypes
+}
+
+// updateOfferingAvailability reports whether each offering of the instance types is available in the zones that the
+// instance types are offered in. Offerings are suppressed by a recent insufficient capacity error, a missing price or
+// the allowed and blocked zones. Constraints of a node template, e.g. its maximum price, aren't reflected.
+func (p *Provider) updateOfferingAvailability(ctx context.Context, instanceTypes []*ec2.InstanceTypeInfo) error {
+	offerings, err := p.getInstanceTypeOfferings(ctx)
+	if err != nil {
+		return err
+	}
+	// Offerings of instance types or zones that are no longer offered aren't reported
+	instanceTypeOfferingAvailable.Reset()
+	for _, instanceType := range instanceTypes {
+		name := aws.StringValue(instanceType.InstanceType)
+		for zone := range offerings[name] {
+			for capacityType := range sets.NewString(aws.StringValueSlice(instanceType.SupportedUsageClasses)...) {
+				var ok bool
+				switch capacityType {
+				case ec2.UsageClassTypeSpot:
+					_, ok = p.pricingProvider.SpotPrice(name, zone)
+				case ec2.UsageClassTypeOnDemand:
+					_, ok = p.pricingProvider.OnDemandPrice(name)
+				default:
+					continue
+				}
+				available := ok && !p.unavailableOfferings.IsUnavailable(name, zone, capacityType) && awssettings.FromContext(ctx).IsZoneAllowed(zone)
+				instanceTypeOfferingAvailable.With(prometheus.Labels{
+					instanceTypeLabel: name,
+					zoneLabel:         zone,
+					capacityTypeLabel: capacityType,
+				}).Set(lo.Ternary(available, 1.0, 0.0))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Provider) describeInstanceTypes(ctx context.Context) ([]*ec2.InstanceTypeInfo, error) {
 	var instanceTypes []*ec2.InstanceTypeInfo
 	if err := p.ec2api.DescribeInstanceTypesPagesWithContext(ctx, &ec2.DescribeInstanceTypesInput{
 		Filters: []*ec2.Filter{
@@ -223,11 +485,5 @@ func (p *Provider) GetInstanceTypes(ctx context.Context) ([]*ec2.InstanceTypeInf
 	}); err != nil {
 		return nil, fmt.Errorf("fetching instance types using ec2.DescribeInstanceTypes, %w", err)
 	}
-	if p.cm.HasChanged("instance-types", instanceTypes) {
-		logging.FromContext(ctx).With(
-			"instance-type-count", len(instanceTypes)).Debugf("discovered EC2 instance types")
-	}
-	atomic.AddUint64(&p.instanceTypesSeqNum, 1)
-	p.cache.SetDefault(InstanceTypesCacheKey, instanceTypes)
 	return instanceTypes, nil
 }
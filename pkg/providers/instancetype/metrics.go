@@ -0,0 +1,61 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instancetype
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	cloudProviderSubsystem = "cloudprovider"
+	instanceTypeLabel      = "instance_type"
+	zoneLabel              = "zone"
+	capacityTypeLabel      = "capacity_type"
+)
+
+var (
+	instanceTypesDiscovered = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "instance_types_discovered",
+			Help:      "Number of instance types discovered from EC2, updated whenever the instance types are described.",
+		},
+	)
+	warmUpDuration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "instance_types_warm_up_duration_seconds",
+			Help:      "Duration of the warm-up of the instance type, offering and pricing caches on startup in seconds. Unset if the warm-up failed.",
+		},
+	)
+	instanceTypeOfferingAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "instance_type_offering_available",
+			Help:      "Whether an offering is available, 1 if it is and 0 if it's suppressed by a recent insufficient capacity error, a missing price or the allowed and blocked zones. Updated whenever the instance types are refreshed. Labeled by instance type, zone and capacity type.",
+		},
+		[]string{instanceTypeLabel, zoneLabel, capacityTypeLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(instanceTypesDiscovered, warmUpDuration, instanceTypeOfferingAvailable)
+}
@@ -25,9 +25,12 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	awspricing "github.com/aws/aws-sdk-go/service/pricing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -38,6 +41,7 @@ import (
 	clock "k8s.io/utils/clock/testing"
 	. "knative.dev/pkg/logging/testing"
 	"knative.dev/pkg/ptr"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
@@ -57,6 +61,7 @@ import (
 	"github.com/aws/karpenter/pkg/apis"
 	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	awscache "github.com/aws/karpenter/pkg/cache"
 	"github.com/aws/karpenter/pkg/cloudprovider"
 	"github.com/aws/karpenter/pkg/fake"
 	"github.com/aws/karpenter/pkg/providers/instance"
@@ -92,7 +97,7 @@ var _ = BeforeSuite(func() {
 	awsEnv = test.NewEnvironment(ctx, env)
 
 	fakeClock = &clock.FakeClock{}
-	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider)
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
 	prov = provisioning.NewProvisioner(ctx, env.Client, env.KubernetesInterface.CoreV1(), events.NewRecorder(&record.FakeRecorder{}), cloudProvider, cluster)
 	provisioningController = provisioning.NewController(env.Client, prov, events.NewRecorder(&record.FakeRecorder{}))
@@ -235,7 +240,7 @@ var _ = Describe("Instance Types", func() {
 			}
 			return iPrice < jPrice
 		})
-		// Expect that the launch template overrides gives the 60 cheapest instance types
+		// Expect that the launch template overrides gives the cheapest instance types
 		expected := sets.NewString(lo.Map(its[:instance.MaxInstanceTypes], func(i *corecloudproivder.InstanceType, _ int) string {
 			return i.Name
 		})...)
@@ -314,6 +319,84 @@ var _ = Describe("Instance Types", func() {
 			Expect(spotPrice).To(BeNumerically("<", cheapestODPrice))
 		}
 	})
+	It("should limit the fleet overrides to the cheapest instance types", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MaxFleetOverrides: lo.ToPtr[int64](10)}))
+		instances := makeFakeInstances()
+		awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{
+			InstanceTypes: makeFakeInstances(),
+		})
+		awsEnv.EC2API.DescribeInstanceTypeOfferingsOutput.Set(&ec2.DescribeInstanceTypeOfferingsOutput{
+			InstanceTypeOfferings: makeFakeInstanceOfferings(instances),
+		})
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		pod := coretest.UnschedulablePod(coretest.PodOptions{
+			ResourceRequirements: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			},
+		})
+		ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+		ExpectScheduled(ctx, env.Client, pod)
+
+		Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+		call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+		Expect(call.LaunchTemplateConfigs).To(HaveLen(1))
+		Expect(call.LaunchTemplateConfigs[0].Overrides).To(HaveLen(10))
+
+		// every instance type that was left out is at least as expensive as the ones in the overrides
+		overrideTypes := sets.NewString(lo.Map(call.LaunchTemplateConfigs[0].Overrides, func(o *ec2.FleetLaunchTemplateOverridesRequest, _ int) string {
+			return aws.StringValue(o.InstanceType)
+		})...)
+		its, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+		Expect(err).To(BeNil())
+		reqs := scheduling.NewNodeSelectorRequirements(provisioner.Spec.Requirements...)
+		included := lo.Filter(its, func(it *corecloudproivder.InstanceType, _ int) bool { return overrideTypes.Has(it.Name) })
+		excluded := lo.Filter(its, func(it *corecloudproivder.InstanceType, _ int) bool { return !overrideTypes.Has(it.Name) })
+		Expect(included).To(HaveLen(10))
+		maxIncludedPrice := lo.Max(lo.Map(included, func(it *corecloudproivder.InstanceType, _ int) float64 {
+			return it.Offerings.Requirements(reqs).Cheapest().Price
+		}))
+		for _, it := range excluded {
+			if len(it.Offerings.Requirements(reqs).Available()) == 0 {
+				continue
+			}
+			Expect(it.Offerings.Requirements(reqs).Cheapest().Price).To(BeNumerically(">=", maxIncludedPrice))
+		}
+	})
+	It("should keep every zone of the cheapest instance type when limiting the fleet overrides", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MaxFleetOverrides: lo.ToPtr[int64](3)}))
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+		Expect(err).ToNot(HaveOccurred())
+		instanceTypes = lo.Filter(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) bool {
+			return it.Name == "m5.large" || it.Name == "m5.xlarge"
+		})
+		Expect(instanceTypes).To(HaveLen(2))
+
+		machine := coretest.Machine(v1alpha5.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+			},
+			Spec: v1alpha5.MachineSpec{
+				Requirements: []v1.NodeSelectorRequirement{
+					{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeOnDemand}},
+				},
+			},
+		})
+		_, err = awsEnv.InstanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
+		Expect(err).ToNot(HaveOccurred())
+		call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+		overrides := lo.FlatMap(call.LaunchTemplateConfigs, func(ltc *ec2.FleetLaunchTemplateConfigRequest, _ int) []*ec2.FleetLaunchTemplateOverridesRequest {
+			return ltc.Overrides
+		})
+		Expect(overrides).To(HaveLen(3))
+		for _, override := range overrides {
+			Expect(aws.StringValue(override.InstanceType)).To(Equal("m5.large"))
+		}
+		Expect(lo.Map(overrides, func(o *ec2.FleetLaunchTemplateOverridesRequest, _ int) string {
+			return aws.StringValue(o.AvailabilityZone)
+		})).To(ConsistOf("test-zone-1a", "test-zone-1b", "test-zone-1c"))
+	})
 	It("should de-prioritize metal", func() {
 		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
 		pod := coretest.UnschedulablePod(coretest.PodOptions{
@@ -519,6 +602,112 @@ var _ = Describe("Instance Types", func() {
 		}
 	})
 
+	Context("Accelerators", func() {
+		var instanceInfo []*ec2.InstanceTypeInfo
+		BeforeEach(func() {
+			var err error
+			instanceInfo, err = awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+		})
+		findInfo := func(name string) *ec2.InstanceTypeInfo {
+			info, ok := lo.Find(instanceInfo, func(i *ec2.InstanceTypeInfo) bool { return aws.StringValue(i.InstanceType) == name })
+			Expect(ok).To(BeTrue())
+			return info
+		}
+		DescribeTable("should report accelerator resources for known instance types",
+			func(instanceType string, resourceName v1.ResourceName, count int64) {
+				it := instancetype.NewInstanceType(ctx, findInfo(instanceType), nil, "", nodeTemplate, nil)
+				Expect(it.Capacity).To(HaveKey(resourceName))
+				Expect(it.Capacity.Name(resourceName, resource.DecimalSI).Value()).To(Equal(count))
+			},
+			Entry("p3.8xlarge", "p3.8xlarge", v1alpha1.ResourceNVIDIAGPU, int64(4)),
+			Entry("g4dn.8xlarge", "g4dn.8xlarge", v1alpha1.ResourceNVIDIAGPU, int64(1)),
+			Entry("dl1.24xlarge", "dl1.24xlarge", v1alpha1.ResourceHabanaGaudi, int64(8)),
+			Entry("inf1.6xlarge", "inf1.6xlarge", v1alpha1.ResourceAWSNeuron, int64(4)),
+			Entry("m5.large", "m5.large", v1alpha1.ResourceNVIDIAGPU, int64(0)),
+		)
+		It("should sum the GPUs of every device an instance type reports", func() {
+			info := *findInfo("p3.8xlarge")
+			info.GpuInfo = &ec2.GpuInfo{Gpus: []*ec2.GpuDeviceInfo{
+				{Manufacturer: aws.String("NVIDIA"), Name: aws.String("A10G"), Count: aws.Int64(4)},
+				{Manufacturer: aws.String("NVIDIA"), Name: aws.String("A10G"), Count: aws.Int64(4)},
+			}}
+			it := instancetype.NewInstanceType(ctx, &info, nil, "", nodeTemplate, nil)
+			Expect(it.Capacity.Name(v1alpha1.ResourceNVIDIAGPU, resource.DecimalSI).Value()).To(BeNumerically("==", 8))
+		})
+		It("should report each accelerator of an instance type with mixed accelerators", func() {
+			info := *findInfo("p3.8xlarge")
+			info.GpuInfo = &ec2.GpuInfo{Gpus: []*ec2.GpuDeviceInfo{
+				{Manufacturer: aws.String("Nvidia"), Name: aws.String("T4"), Count: aws.Int64(2)},
+				{Manufacturer: aws.String("AMD"), Name: aws.String("Radeon Pro V520"), Count: aws.Int64(1)},
+				{Name: aws.String("Unknown"), Count: aws.Int64(1)},
+			}}
+			info.InferenceAcceleratorInfo = &ec2.InferenceAcceleratorInfo{Accelerators: []*ec2.InferenceDeviceInfo{
+				{Manufacturer: aws.String("AWS"), Name: aws.String("Inferentia"), Count: aws.Int64(1)},
+			}}
+			it := instancetype.NewInstanceType(ctx, &info, nil, "", nodeTemplate, nil)
+			Expect(it.Capacity.Name(v1alpha1.ResourceNVIDIAGPU, resource.DecimalSI).Value()).To(BeNumerically("==", 2))
+			Expect(it.Capacity.Name(v1alpha1.ResourceAMDGPU, resource.DecimalSI).Value()).To(BeNumerically("==", 1))
+			Expect(it.Capacity.Name(v1alpha1.ResourceHabanaGaudi, resource.DecimalSI).Value()).To(BeNumerically("==", 0))
+			Expect(it.Capacity.Name(v1alpha1.ResourceAWSNeuron, resource.DecimalSI).Value()).To(BeNumerically("==", 1))
+		})
+	})
+	Context("Instance Store", func() {
+		var instanceInfo []*ec2.InstanceTypeInfo
+		BeforeEach(func() {
+			var err error
+			instanceInfo, err = awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+		})
+		findInfo := func(name string) *ec2.InstanceTypeInfo {
+			info, ok := lo.Find(instanceInfo, func(i *ec2.InstanceTypeInfo) bool { return aws.StringValue(i.InstanceType) == name })
+			Expect(ok).To(BeTrue())
+			return info
+		}
+		It("should report the capacity of every disk of an instance type as a RAID-0 array", func() {
+			info := *findInfo("m5.large")
+			info.InstanceType = aws.String("i3.4xlarge")
+			info.InstanceStorageInfo = &ec2.InstanceStorageInfo{
+				Disks:         []*ec2.DiskInfo{{Count: aws.Int64(2), SizeInGB: aws.Int64(1900), Type: aws.String(ec2.DiskTypeSsd)}},
+				NvmeSupport:   aws.String(ec2.EphemeralNvmeSupportRequired),
+				TotalSizeInGB: aws.Int64(3800),
+			}
+			it := instancetype.NewInstanceType(ctx, &info, nil, "", nodeTemplate, nil)
+			Expect(it.Capacity).To(HaveKeyWithValue(v1alpha1.ResourceInstanceStore, resource.MustParse("3800G")))
+		})
+		It("should bound the capacity of a RAID-0 array by the smallest disk", func() {
+			info := *findInfo("m5.large")
+			info.InstanceStorageInfo = &ec2.InstanceStorageInfo{
+				Disks: []*ec2.DiskInfo{
+					{Count: aws.Int64(1), SizeInGB: aws.Int64(1900)},
+					{Count: aws.Int64(2), SizeInGB: aws.Int64(950)},
+				},
+				TotalSizeInGB: aws.Int64(3800),
+			}
+			it := instancetype.NewInstanceType(ctx, &info, nil, "", nodeTemplate, nil)
+			Expect(it.Capacity).To(HaveKeyWithValue(v1alpha1.ResourceInstanceStore, resource.MustParse("2850G")))
+		})
+		It("should fall back to the total size when the disks aren't reported", func() {
+			it := instancetype.NewInstanceType(ctx, findInfo("g4dn.8xlarge"), nil, "", nodeTemplate, nil)
+			Expect(it.Capacity).To(HaveKeyWithValue(v1alpha1.ResourceInstanceStore, resource.MustParse("900G")))
+		})
+		It("should report no capacity for instance types without an instance store", func() {
+			it := instancetype.NewInstanceType(ctx, findInfo("m5.large"), nil, "", nodeTemplate, nil)
+			Expect(it.Capacity).To(HaveKeyWithValue(v1alpha1.ResourceInstanceStore, resource.MustParse("0")))
+		})
+		It("should launch instance types with an instance store for instance store resource requests", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1alpha1.ResourceInstanceStore: resource.MustParse("2000G")},
+					Limits:   v1.ResourceList{v1alpha1.ResourceInstanceStore: resource.MustParse("2000G")},
+				},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "dl1.24xlarge"))
+		})
+	})
 	Context("KubeletConfiguration Overrides", func() {
 		var info *ec2.InstanceTypeInfo
 		BeforeEach(func() {
@@ -577,6 +766,71 @@ var _ = Describe("Instance Types", func() {
 				Expect(it.Overhead.KubeReserved.Memory().String()).To(Equal("10Gi"))
 				Expect(it.Overhead.KubeReserved.StorageEphemeral().String()).To(Equal("2Gi"))
 			})
+			It("should reduce allocatable by the reserved resources configured in settings", func() {
+				defaultInstanceType := instancetype.NewInstanceType(ctx, info, nil, "", nodeTemplate, nil)
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					VMMemoryOverheadPercent: lo.ToPtr[float64](0),
+					SystemReserved: v1.ResourceList{
+						v1.ResourceCPU:    resource.MustParse("600m"),
+						v1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+					KubeReserved: v1.ResourceList{
+						v1.ResourceEphemeralStorage: resource.MustParse("5Gi"),
+					},
+				}))
+				it := instancetype.NewInstanceType(ctx, info, nil, "", nodeTemplate, nil)
+				Expect(it.Overhead.SystemReserved.Cpu().String()).To(Equal("600m"))
+				Expect(it.Overhead.SystemReserved.Memory().String()).To(Equal("1Gi"))
+				Expect(it.Overhead.KubeReserved.StorageEphemeral().String()).To(Equal("5Gi"))
+
+				// The default system-reserved is 100m cpu, 100Mi memory and the default kube-reserved ephemeral-storage is 1Gi
+				defaultAllocatable, allocatable := defaultInstanceType.Allocatable(), it.Allocatable()
+				expectedCPU := defaultAllocatable.Cpu().DeepCopy()
+				expectedCPU.Sub(resource.MustParse("500m"))
+				expectedMemory := defaultAllocatable.Memory().DeepCopy()
+				expectedMemory.Sub(resource.MustParse("924Mi"))
+				expectedStorage := defaultAllocatable.StorageEphemeral().DeepCopy()
+				expectedStorage.Sub(resource.MustParse("4Gi"))
+				Expect(allocatable.Cpu().Cmp(expectedCPU)).To(BeZero())
+				Expect(allocatable.Memory().Cmp(expectedMemory)).To(BeZero())
+				Expect(allocatable.StorageEphemeral().Cmp(expectedStorage)).To(BeZero())
+			})
+			It("should prefer the provisioner's reserved resources over the ones configured in settings", func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					VMMemoryOverheadPercent: lo.ToPtr[float64](0),
+					SystemReserved: v1.ResourceList{
+						v1.ResourceCPU:    resource.MustParse("600m"),
+						v1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+				}))
+				provisioner = test.Provisioner(coretest.ProvisionerOptions{
+					Kubelet: &v1alpha5.KubeletConfiguration{
+						SystemReserved: v1.ResourceList{
+							v1.ResourceMemory: resource.MustParse("2Gi"),
+						},
+					},
+				})
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Overhead.SystemReserved.Cpu().String()).To(Equal("600m"))
+				Expect(it.Overhead.SystemReserved.Memory().String()).To(Equal("2Gi"))
+			})
+			It("should not return instance types that have no allocatable memory left after the reserved resources", func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					SystemReserved: v1.ResourceList{
+						v1.ResourceMemory: resource.MustParse("16Gi"),
+					},
+				}))
+				instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+				Expect(err).To(BeNil())
+				Expect(instanceTypes).ToNot(BeEmpty())
+				names := lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+				Expect(names).ToNot(ContainElement("m5.large"))
+				Expect(names).ToNot(ContainElement("m5.xlarge"))
+				for _, it := range instanceTypes {
+					overhead := it.Overhead.Total()
+					Expect(it.Capacity.Memory().Cmp(*overhead.Memory())).To(BeNumerically(">", 0))
+				}
+			})
 		})
 		Context("Eviction Thresholds", func() {
 			BeforeEach(func() {
@@ -853,6 +1107,553 @@ var _ = Describe("Instance Types", func() {
 			}
 		})
 	})
+	Context("Prefix Delegation", func() {
+		DescribeTable("should compute max-pods with and without prefix delegation",
+			func(instanceType string, withoutPrefixDelegation int64, withPrefixDelegation int64) {
+				instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+				Expect(err).To(BeNil())
+				info, ok := lo.Find(instanceInfo, func(i *ec2.InstanceTypeInfo) bool { return aws.StringValue(i.InstanceType) == instanceType })
+				Expect(ok).To(BeTrue())
+
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Capacity.Pods().Value()).To(BeNumerically("==", withoutPrefixDelegation))
+				Expect(it.Requirements.Get(v1alpha1.LabelInstancePods).Values()).To(ConsistOf(fmt.Sprint(withoutPrefixDelegation)))
+
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					EnablePrefixDelegation: lo.ToPtr(true),
+				}))
+				it = instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Capacity.Pods().Value()).To(BeNumerically("==", withPrefixDelegation))
+				Expect(it.Requirements.Get(v1alpha1.LabelInstancePods).Values()).To(ConsistOf(fmt.Sprint(withPrefixDelegation)))
+			},
+			Entry("m5.large", "m5.large", int64(29), int64(110)),
+			Entry("m5.xlarge", "m5.xlarge", int64(58), int64(110)),
+			Entry("t3.large", "t3.large", int64(35), int64(110)),
+			Entry("g4dn.8xlarge", "g4dn.8xlarge", int64(58), int64(250)),
+			Entry("m5.metal", "m5.metal", int64(737), int64(250)),
+		)
+		It("should not use prefix delegation when ENI limited pod density is disabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnableENILimitedPodDensity: lo.ToPtr(false),
+				EnablePrefixDelegation:     lo.ToPtr(true),
+			}))
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			for _, info := range instanceInfo {
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Capacity.Pods().Value()).To(BeNumerically("==", 110))
+			}
+		})
+		It("should prefer max-pods from the kubelet configuration", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnablePrefixDelegation: lo.ToPtr(true),
+			}))
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			provisioner = test.Provisioner(coretest.ProvisionerOptions{Kubelet: &v1alpha5.KubeletConfiguration{MaxPods: ptr.Int32(20)}})
+			for _, info := range instanceInfo {
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Capacity.Pods().Value()).To(BeNumerically("==", 20))
+			}
+		})
+	})
+	Context("Windows", func() {
+		BeforeEach(func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyWindows2022
+		})
+		It("should only offer x86_64 instance types without inference accelerators", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			names := lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+			Expect(names).ToNot(ContainElements("c6g.large", "inf1.2xlarge", "inf1.6xlarge"))
+			Expect(names).To(ContainElements("m5.large", "g4dn.8xlarge"))
+		})
+		It("should offer all instance types for Linux AMI families", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			names := lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+			Expect(names).To(ContainElements("c6g.large", "inf1.2xlarge", "inf1.6xlarge"))
+		})
+		It("should require the windows operating system", func() {
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			for _, info := range instanceInfo {
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Requirements.Get(v1.LabelOSStable).Values()).To(ConsistOf(string(v1.Windows)))
+			}
+		})
+		It("should reserve more system resources than Linux", func() {
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			for _, info := range instanceInfo {
+				it := instancetype.NewInstanceType(ctx, info, provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+				Expect(it.Overhead.SystemReserved.Cpu().String()).To(Equal("100m"))
+				Expect(it.Overhead.SystemReserved.Memory().String()).To(Equal("1536Mi"))
+				Expect(it.Overhead.SystemReserved.StorageEphemeral().String()).To(Equal("10Gi"))
+			}
+		})
+		It("should override system reserved memory when specified", func() {
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			provisioner = test.Provisioner(coretest.ProvisionerOptions{
+				Kubelet: &v1alpha5.KubeletConfiguration{
+					SystemReserved: v1.ResourceList{
+						v1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+				},
+			})
+			it := instancetype.NewInstanceType(ctx, instanceInfo[0], provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+			Expect(it.Overhead.SystemReserved.Memory().String()).To(Equal("2Gi"))
+		})
+		It("should default ephemeral storage to the size of the Windows root volume", func() {
+			instanceInfo, err := awsEnv.InstanceTypesProvider.GetInstanceTypes(ctx)
+			Expect(err).To(BeNil())
+			it := instancetype.NewInstanceType(ctx, instanceInfo[0], provisioner.Spec.KubeletConfiguration, "", nodeTemplate, nil)
+			Expect(it.Capacity.StorageEphemeral().String()).To(Equal("50Gi"))
+		})
+	})
+	Context("Max Price", func() {
+		BeforeEach(func() {
+			awsEnv.PricingAPI.GetProductsOutput.Set(&awspricing.GetProductsOutput{
+				PriceList: []aws.JSONValue{
+					fake.NewOnDemandPrice("m5.large", 0.096),
+					fake.NewOnDemandPrice("m5.xlarge", 0.192),
+					fake.NewOnDemandPrice("m5.metal", 4.608),
+				},
+			})
+			Expect(awsEnv.PricingProvider.UpdateOnDemandPricing(ctx)).To(Succeed())
+			now := time.Now()
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(&ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: lo.Map([]lo.Tuple2[string, string]{
+					{A: "m5.large", B: "0.040"},
+					{A: "m5.xlarge", B: "0.080"},
+					{A: "m5.metal", B: "1.500"},
+				}, func(t lo.Tuple2[string, string], _ int) *ec2.SpotPrice {
+					return &ec2.SpotPrice{
+						AvailabilityZone: aws.String("test-zone-1a"),
+						InstanceType:     aws.String(t.A),
+						SpotPrice:        aws.String(t.B),
+						Timestamp:        &now,
+					}
+				}),
+			})
+			Expect(awsEnv.PricingProvider.UpdateSpotPricing(ctx)).To(Succeed())
+			nodeTemplate.Spec.MaxPrice = aws.String("0.15")
+		})
+		It("should exclude offerings priced above the max price", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			availableOfferings := map[string][]corecloudproivder.Offering{}
+			for _, it := range instanceTypes {
+				for _, offering := range it.Offerings {
+					Expect(offering.Price).To(BeNumerically("<=", 0.15))
+				}
+				availableOfferings[it.Name] = it.Offerings.Available()
+			}
+			// both capacity types of m5.large are below the max price
+			Expect(lo.Map(availableOfferings["m5.large"], func(o corecloudproivder.Offering, _ int) string { return o.CapacityType })).To(
+				ConsistOf(v1alpha5.CapacityTypeOnDemand, v1alpha5.CapacityTypeSpot))
+			// m5.xlarge is only below the max price as spot
+			Expect(lo.Map(availableOfferings["m5.xlarge"], func(o corecloudproivder.Offering, _ int) string { return o.CapacityType })).To(
+				ConsistOf(v1alpha5.CapacityTypeSpot))
+			// m5.metal is above the max price as both spot and on-demand
+			Expect(availableOfferings["m5.metal"]).To(BeEmpty())
+		})
+		It("should not exclude any offerings without a max price", func() {
+			nodeTemplate.Spec.MaxPrice = nil
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			metal, ok := lo.Find(instanceTypes, func(it *corecloudproivder.InstanceType) bool { return it.Name == "m5.metal" })
+			Expect(ok).To(BeTrue())
+			Expect(metal.Offerings.Available()).ToNot(BeEmpty())
+		})
+		It("should not launch an instance type that is priced above the max price", func() {
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"m5.metal"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+		})
+		It("should launch a capacity type that is priced below the max price", func() {
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeOnDemand}},
+				{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"m5.xlarge"}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "m5.xlarge"))
+			Expect(node.Labels).To(HaveKeyWithValue(v1alpha5.LabelCapacityType, v1alpha5.CapacityTypeSpot))
+		})
+	})
+	Context("Tenancy", func() {
+		names := func(instanceTypes []*corecloudproivder.InstanceType) []string {
+			return lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+		}
+		BeforeEach(func() {
+			instances := makeFakeInstances()
+			awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: instances})
+			awsEnv.EC2API.DescribeInstanceTypeOfferingsOutput.Set(&ec2.DescribeInstanceTypeOfferingsOutput{
+				InstanceTypeOfferings: makeFakeInstanceOfferings(instances),
+			})
+		})
+		It("should exclude instance types that don't support dedicated tenancy", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyDedicated)
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(names(instanceTypes)).To(ContainElement("t3.large"))
+			for _, name := range names(instanceTypes) {
+				Expect(name).ToNot(HavePrefix("t2."))
+			}
+		})
+		It("should not exclude any instance types with default tenancy", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(names(instanceTypes)).To(ContainElement("t2.large"))
+		})
+		It("should only offer on-demand capacity with dedicated tenancy", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyDedicated)
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			for _, it := range instanceTypes {
+				for _, offering := range it.Offerings {
+					Expect(offering.CapacityType).To(Equal(v1alpha5.CapacityTypeOnDemand))
+				}
+			}
+		})
+		It("should launch dedicated on-demand capacity when spot is allowed", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyDedicated)
+			provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+				{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeOnDemand}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1alpha5.LabelCapacityType, v1alpha5.CapacityTypeOnDemand))
+			Expect(node.Labels[v1.LabelInstanceTypeStable]).ToNot(HavePrefix("t2."))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(aws.StringValue(createFleetInput.TargetCapacitySpecification.DefaultTargetCapacityType)).To(Equal(v1alpha5.CapacityTypeOnDemand))
+			for _, ltc := range createFleetInput.LaunchTemplateConfigs {
+				for _, override := range ltc.Overrides {
+					Expect(aws.StringValue(override.InstanceType)).ToNot(HavePrefix("t2."))
+				}
+			}
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.Tenancy)).To(Equal(v1alpha1.TenancyDedicated))
+		})
+	})
+	Context("Network Bandwidth", func() {
+		bandwidth := func(instanceTypes []*corecloudproivder.InstanceType) map[string]string {
+			return lo.SliceToMap(instanceTypes, func(it *corecloudproivder.InstanceType) (string, string) {
+				return it.Name, strings.Join(it.Requirements.Get(v1alpha1.LabelInstanceNetworkBandwidth).Values(), ",")
+			})
+		}
+		BeforeEach(func() {
+			// m5.large and c6gn.8xlarge are in the generated bandwidth table, the others fall back to their network performance
+			performance := map[string]string{
+				"m5.large":     "Up to 10 Gigabit",
+				"c6gn.8xlarge": "50 Gigabit",
+				"p3.2xlarge":   "Up to 10 Gigabit",
+				"p3.8xlarge":   "10 Gigabit",
+				"p3.16xlarge":  "25 Gigabit",
+				"r6idn.metal":  "2x 100 Gigabit",
+				"g3s.xlarge":   "Moderate",
+			}
+			instances := lo.Filter(makeFakeInstances(), func(info *ec2.InstanceTypeInfo, _ int) bool {
+				_, ok := performance[aws.StringValue(info.InstanceType)]
+				return ok
+			})
+			Expect(instances).To(HaveLen(len(performance)))
+			for _, info := range instances {
+				info.NetworkInfo.NetworkPerformance = aws.String(performance[aws.StringValue(info.InstanceType)])
+			}
+			awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{InstanceTypes: instances})
+			awsEnv.EC2API.DescribeInstanceTypeOfferingsOutput.Set(&ec2.DescribeInstanceTypeOfferingsOutput{
+				InstanceTypeOfferings: makeFakeInstanceOfferings(instances),
+			})
+		})
+		It("should advertise the baseline network bandwidth in megabits", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(bandwidth(instanceTypes)).To(Equal(map[string]string{
+				"m5.large":     "750",
+				"c6gn.8xlarge": "50000",
+				"p3.2xlarge":   "",
+				"p3.8xlarge":   "10000",
+				"p3.16xlarge":  "25000",
+				"r6idn.metal":  "200000",
+				"g3s.xlarge":   "",
+			}))
+		})
+		It("should only launch instance types that satisfy a network bandwidth requirement", func() {
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1alpha1.LabelInstanceNetworkBandwidth,
+				Operator: v1.NodeSelectorOpGt,
+				Values:   []string{"24999"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			var launched []string
+			for _, ltc := range createFleetInput.LaunchTemplateConfigs {
+				for _, override := range ltc.Overrides {
+					launched = append(launched, aws.StringValue(override.InstanceType))
+				}
+			}
+			Expect(lo.Uniq(launched)).To(ConsistOf("c6gn.8xlarge", "p3.16xlarge", "r6idn.metal"))
+		})
+		It("should not schedule pods that require more network bandwidth than any instance type advertises", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				NodeRequirements: []v1.NodeSelectorRequirement{
+					{Key: v1alpha1.LabelInstanceNetworkBandwidth, Operator: v1.NodeSelectorOpGt, Values: []string{"200000"}},
+				},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+		})
+	})
+	Context("EFA", func() {
+		names := func(instanceTypes []*corecloudproivder.InstanceType) []string {
+			return lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+		}
+		It("should only offer instance types that support EFA", func() {
+			nodeTemplate.Spec.EFA = aws.Bool(true)
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(names(instanceTypes)).To(ConsistOf("dl1.24xlarge", "g4dn.8xlarge"))
+			for _, it := range instanceTypes {
+				Expect(it.Capacity).To(HaveKeyWithValue(v1alpha1.ResourceEFA, resource.MustParse("1")))
+			}
+		})
+		It("should not advertise EFA devices when EFA isn't requested", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(names(instanceTypes)).To(ContainElement("m5.large"))
+			for _, it := range instanceTypes {
+				Expect(it.Capacity[v1alpha1.ResourceEFA]).To(Equal(resource.MustParse("0")))
+			}
+		})
+		It("should launch instances with an EFA for EFA resource requests", func() {
+			nodeTemplate.Spec.EFA = aws.Bool(true)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				ResourceRequirements: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1alpha1.ResourceEFA: resource.MustParse("1")},
+					Limits:   v1.ResourceList{v1alpha1.ResourceEFA: resource.MustParse("1")},
+				},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels[v1.LabelInstanceTypeStable]).To(BeElementOf("dl1.24xlarge", "g4dn.8xlarge"))
+
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).To(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(HaveLen(1))
+			networkInterface := input.LaunchTemplateData.NetworkInterfaces[0]
+			Expect(aws.StringValue(networkInterface.InterfaceType)).To(Equal(ec2.NetworkInterfaceTypeEfa))
+			Expect(aws.Int64Value(networkInterface.DeviceIndex)).To(BeZero())
+			Expect(networkInterface.Groups).ToNot(BeEmpty())
+		})
+		It("should not launch instances with an EFA when EFA isn't requested", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).ToNot(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(BeEmpty())
+		})
+	})
+	Context("Network Interfaces", func() {
+		names := func(instanceTypes []*corecloudproivder.InstanceType) []string {
+			return lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+		}
+		It("should only offer instance types that can attach every network interface", func() {
+			nodeTemplate.Spec.NetworkInterfaces = []v1alpha1.NetworkInterface{
+				{DeviceIndex: 1, SubnetID: "subnet-test1"},
+				{DeviceIndex: 2, SubnetID: "subnet-test2"},
+				{DeviceIndex: 3, SubnetID: "subnet-test3"},
+			}
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			Expect(names(instanceTypes)).ToNot(ContainElements("m5.large", "t3.large", "c6g.large"))
+			Expect(names(instanceTypes)).To(ContainElements("m5.xlarge", "m5.metal"))
+		})
+		It("should exclude instance types that can't attach a network interface at its device index", func() {
+			nodeTemplate.Spec.NetworkInterfaces = []v1alpha1.NetworkInterface{{DeviceIndex: 8, SubnetID: "subnet-test1"}}
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(names(instanceTypes)).To(ConsistOf("dl1.24xlarge", "m5.metal"))
+		})
+		It("should not launch instances when no instance type can attach the network interfaces", func() {
+			nodeTemplate.Spec.NetworkInterfaces = []v1alpha1.NetworkInterface{{DeviceIndex: 100, SubnetID: "subnet-test1"}}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(BeZero())
+		})
+	})
+	Context("Warm Up", func() {
+		var provider *instancetype.Provider
+		BeforeEach(func() {
+			provider = instancetype.NewProvider("", cache.New(awscache.InstanceTypesAndZonesTTL, awscache.DefaultCleanupInterval), awsEnv.EC2API,
+				awsEnv.SubnetProvider, awsEnv.UnavailableOfferingsCache, awsEnv.PricingProvider)
+		})
+		It("should serve instance types and offerings from the cache after warming up", func() {
+			Expect(provider.ReadinessProbe(nil)).ToNot(Succeed())
+			provider.WarmUp(ctx)
+			Expect(provider.ReadinessProbe(nil)).To(Succeed())
+
+			// EC2 no longer returns any instance types or offerings, so they can only be served from the cache
+			awsEnv.EC2API.DescribeInstanceTypesOutput.Set(&ec2.DescribeInstanceTypesOutput{})
+			awsEnv.EC2API.DescribeInstanceTypeOfferingsOutput.Set(&ec2.DescribeInstanceTypeOfferingsOutput{})
+			instanceTypes, err := provider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			m5, ok := lo.Find(instanceTypes, func(it *corecloudproivder.InstanceType) bool { return it.Name == "m5.large" })
+			Expect(ok).To(BeTrue())
+			Expect(lo.Map(m5.Offerings, func(o corecloudproivder.Offering, _ int) string { return o.Zone })).To(ContainElements("test-zone-1a", "test-zone-1b"))
+			Expect(warmUpDuration()).To(BeNumerically(">", 0))
+		})
+		It("should report ready when the warm-up fails", func() {
+			awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+			provider.WarmUp(ctx)
+			Expect(provider.ReadinessProbe(nil)).To(Succeed())
+
+			// The instance types are populated lazily instead
+			instanceTypes, err := provider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+		})
+		It("should stop warming up once the timeout elapses", func() {
+			timeout := instancetype.WarmUpTimeout
+			instancetype.WarmUpTimeout = 100 * time.Millisecond
+			defer func() { instancetype.WarmUpTimeout = timeout }()
+			pricingCtx, cancel := context.WithCancel(ctx)
+			pricingAPI := &blockingPricingAPI{PricingAPI: &fake.PricingAPI{}, release: make(chan struct{})}
+			defer cancel()
+			defer close(pricingAPI.release)
+			provider = instancetype.NewProvider("", cache.New(awscache.InstanceTypesAndZonesTTL, awscache.DefaultCleanupInterval), awsEnv.EC2API,
+				awsEnv.SubnetProvider, awsEnv.UnavailableOfferingsCache, pricing.NewProvider(pricingCtx, fakeClock, pricingAPI, awsEnv.EC2API, "", make(chan struct{})))
+
+			provider.WarmUp(ctx)
+			Expect(provider.ReadinessProbe(nil)).To(Succeed())
+		})
+	})
+	Context("Selection Strategy", func() {
+		AfterEach(func() {
+			awsEnv.InstanceProvider.SelectionStrategy = instance.DefaultSelectionStrategy{}
+		})
+		It("should submit the instance types in the order of a custom selection strategy", func() {
+			strategy := &orderedSelectionStrategy{order: []string{"m5.xlarge", "t3.large", "m5.large"}}
+			awsEnv.InstanceProvider.SelectionStrategy = strategy
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "m5.xlarge"))
+
+			// The strategy is passed every compatible instance type as a candidate
+			Expect(strategy.candidates).To(ContainElements("m5.large", "m5.xlarge", "t3.large"))
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(call.LaunchTemplateConfigs).To(HaveLen(1))
+			Expect(lo.Uniq(lo.Map(call.LaunchTemplateConfigs[0].Overrides, func(o *ec2.FleetLaunchTemplateOverridesRequest, _ int) string {
+				return aws.StringValue(o.InstanceType)
+			}))).To(Equal(strategy.order))
+		})
+		It("should not launch an instance when the selection strategy selects no instance types", func() {
+			awsEnv.InstanceProvider.SelectionStrategy = &orderedSelectionStrategy{}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(BeZero())
+		})
+	})
+	Context("Zone Restrictions", func() {
+		launchedZones := func() []string {
+			var zones []string
+			for awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len() > 0 {
+				call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+				for _, config := range call.LaunchTemplateConfigs {
+					for _, override := range config.Overrides {
+						zones = append(zones, aws.StringValue(override.AvailabilityZone))
+					}
+				}
+			}
+			return lo.Uniq(zones)
+		}
+		It("should not offer instance types in a blocked zone", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{BlockedZones: []string{"test-zone-1a"}}))
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			for _, it := range instanceTypes {
+				for _, offering := range it.Offerings {
+					Expect(offering.Zone).ToNot(Equal("test-zone-1a"))
+				}
+			}
+		})
+		It("should only offer instance types in the allowed zones", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{AllowedZones: []string{"test-zone-1b"}}))
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, provisioner.Spec.KubeletConfiguration, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			for _, it := range instanceTypes {
+				for _, offering := range it.Offerings {
+					Expect(offering.Zone).To(Equal("test-zone-1b"))
+				}
+			}
+		})
+		It("should never launch into a blocked zone", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{BlockedZones: []string{"test-zone-1a"}}))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels[v1.LabelTopologyZone]).ToNot(Equal("test-zone-1a"))
+			Expect(launchedZones()).ToNot(ContainElement("test-zone-1a"))
+		})
+		It("should not launch when a provisioner requires a blocked zone", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{BlockedZones: []string{"test-zone-1a"}}))
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(launchedZones()).To(BeEmpty())
+		})
+		It("should launch into the intersection of the provisioner's zones and the allowed zones", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				AllowedZones: []string{"test-zone-1a", "test-zone-1b"},
+				BlockedZones: []string{"test-zone-1a"},
+			}))
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a", "test-zone-1b", "test-zone-1c"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelTopologyZone, "test-zone-1b"))
+			Expect(launchedZones()).To(ConsistOf("test-zone-1b"))
+		})
+	})
 	Context("Insufficient Capacity Error Cache", func() {
 		It("should launch instances of different type on second reconciliation attempt with Insufficient Capacity Error Cache fallback", func() {
 			awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{{CapacityType: v1alpha5.CapacityTypeOnDemand, InstanceType: "inf1.6xlarge", Zone: "test-zone-1a"}})
@@ -965,6 +1766,213 @@ var _ = Describe("Instance Types", func() {
 			node := ExpectScheduled(ctx, env.Client, pod)
 			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "inf1.6xlarge"))
 		})
+		It("should not launch an offering that was marked unavailable after the instance types were resolved", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+			Expect(err).ToNot(HaveOccurred())
+			instanceTypes = lo.Filter(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) bool {
+				return it.Name == "m5.large" || it.Name == "m5.xlarge"
+			})
+			Expect(instanceTypes).To(HaveLen(2))
+			// a concurrent launch hits an insufficient capacity error for m5.xlarge in test-zone-1a
+			awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", "m5.xlarge", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+
+			machine := coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				},
+				Spec: v1alpha5.MachineSpec{
+					Requirements: []v1.NodeSelectorRequirement{
+						{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeOnDemand}},
+						{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"}},
+					},
+				},
+			})
+			instance, err := awsEnv.InstanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aws.StringValue(instance.InstanceType)).To(Equal("m5.large"))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			for _, ltc := range createFleetInput.LaunchTemplateConfigs {
+				for _, override := range ltc.Overrides {
+					Expect(aws.StringValue(override.InstanceType)).To(Equal("m5.large"))
+				}
+			}
+		})
+		It("should return the fulfilled instance when fleet fails some of the overrides", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+			Expect(err).ToNot(HaveOccurred())
+			instanceTypes = lo.Filter(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) bool {
+				return it.Name == "m5.large" || it.Name == "m5.xlarge"
+			})
+			Expect(instanceTypes).To(HaveLen(2))
+			awsEnv.EC2API.Instances.Store("i-fulfilled", &ec2.Instance{
+				InstanceId:     aws.String("i-fulfilled"),
+				InstanceType:   aws.String("m5.xlarge"),
+				PrivateDnsName: aws.String("ip-10-0-0-1.ec2.internal"),
+				Placement:      &ec2.Placement{AvailabilityZone: aws.String("test-zone-1a")},
+				State:          &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+			})
+			// fleet couldn't launch the cheaper m5.large, and fell back to the m5.xlarge
+			awsEnv.EC2API.CreateFleetBehavior.Output.Set(&ec2.CreateFleetOutput{
+				Instances: []*ec2.CreateFleetInstance{
+					{
+						InstanceIds: aws.StringSlice([]string{"i-fulfilled"}),
+						LaunchTemplateAndOverrides: &ec2.LaunchTemplateAndOverridesResponse{
+							Overrides: &ec2.FleetLaunchTemplateOverrides{InstanceType: aws.String("m5.xlarge"), AvailabilityZone: aws.String("test-zone-1a")},
+						},
+					},
+				},
+				Errors: []*ec2.CreateFleetError{
+					{
+						ErrorCode: aws.String("InsufficientInstanceCapacity"),
+						LaunchTemplateAndOverrides: &ec2.LaunchTemplateAndOverridesResponse{
+							Overrides: &ec2.FleetLaunchTemplateOverrides{InstanceType: aws.String("m5.large"), AvailabilityZone: aws.String("test-zone-1a")},
+						},
+					},
+				},
+			})
+
+			machine := coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				},
+				Spec: v1alpha5.MachineSpec{
+					Requirements: []v1.NodeSelectorRequirement{
+						{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeOnDemand}},
+						{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"}},
+					},
+				},
+			})
+			instance, err := awsEnv.InstanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aws.StringValue(instance.InstanceId)).To(Equal("i-fulfilled"))
+			Expect(aws.StringValue(instance.InstanceType)).To(Equal("m5.xlarge"))
+
+			// the request offered both instance types, and the failed override is no longer offered
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(lo.Uniq(lo.FlatMap(createFleetInput.LaunchTemplateConfigs, func(ltc *ec2.FleetLaunchTemplateConfigRequest, _ int) []string {
+				return lo.Map(ltc.Overrides, func(o *ec2.FleetLaunchTemplateOverridesRequest, _ int) string { return aws.StringValue(o.InstanceType) })
+			}))).To(ConsistOf("m5.large", "m5.xlarge"))
+			Expect(awsEnv.UnavailableOfferingsCache.IsUnavailable("m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)).To(BeTrue())
+			Expect(awsEnv.UnavailableOfferingsCache.IsUnavailable("m5.xlarge", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)).To(BeFalse())
+		})
+		Context("Spot Fallback", func() {
+			var instanceTypes []*corecloudproivder.InstanceType
+			var machine *v1alpha5.Machine
+			launch := func() (*ec2.Instance, string, error) {
+				instance, err := awsEnv.InstanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
+				call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+				// forget the offering so that only the spot failure count decides the next capacity type
+				awsEnv.UnavailableOfferingsCache.Delete("m5.large", "test-zone-1a", v1alpha5.CapacityTypeSpot)
+				return instance, aws.StringValue(call.TargetCapacitySpecification.DefaultTargetCapacityType), err
+			}
+			BeforeEach(func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{SpotFallbackThreshold: lo.ToPtr[int64](2)}))
+				ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+				var err error
+				instanceTypes, err = cloudProvider.GetInstanceTypes(ctx, provisioner)
+				Expect(err).ToNot(HaveOccurred())
+				instanceTypes = lo.Filter(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) bool { return it.Name == "m5.large" })
+				machine = coretest.Machine(v1alpha5.Machine{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+					},
+					Spec: v1alpha5.MachineSpec{
+						Requirements: []v1.NodeSelectorRequirement{
+							{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeSpot, v1alpha5.CapacityTypeOnDemand}},
+							{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"}},
+						},
+					},
+				})
+				awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{{CapacityType: v1alpha5.CapacityTypeSpot, InstanceType: "m5.large", Zone: "test-zone-1a"}})
+			})
+			It("should launch on-demand after repeated spot insufficient capacity errors", func() {
+				for i := 0; i < 2; i++ {
+					_, capacityType, err := launch()
+					Expect(err).To(HaveOccurred())
+					Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+				}
+				before := spotFallbacks()
+				instance, capacityType, err := launch()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(capacityType).To(Equal(v1alpha5.CapacityTypeOnDemand))
+				Expect(instance.SpotInstanceRequestId).To(BeNil())
+				Expect(spotFallbacks()).To(Equal(before + 1))
+			})
+			It("should keep launching spot if the machine only allows spot", func() {
+				machine.Spec.Requirements[0].Values = []string{v1alpha5.CapacityTypeSpot}
+				for i := 0; i < 3; i++ {
+					_, capacityType, err := launch()
+					Expect(err).To(HaveOccurred())
+					Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+				}
+			})
+			It("should reset the spot failures after a successful spot launch", func() {
+				_, capacityType, err := launch()
+				Expect(err).To(HaveOccurred())
+				Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+
+				awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{})
+				_, capacityType, err = launch()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+
+				awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{{CapacityType: v1alpha5.CapacityTypeSpot, InstanceType: "m5.large", Zone: "test-zone-1a"}})
+				_, capacityType, err = launch()
+				Expect(err).To(HaveOccurred())
+				Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+			})
+			It("should not fall back to on-demand if the fallback is disabled", func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{SpotFallbackThreshold: lo.ToPtr[int64](0)}))
+				for i := 0; i < 3; i++ {
+					_, capacityType, err := launch()
+					Expect(err).To(HaveOccurred())
+					Expect(capacityType).To(Equal(v1alpha5.CapacityTypeSpot))
+				}
+			})
+		})
+		It("should fail to launch if every offering was marked unavailable after the instance types were resolved", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+			Expect(err).ToNot(HaveOccurred())
+			instanceTypes = lo.Filter(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) bool { return it.Name == "m5.large" })
+			awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", "m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+
+			machine := coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name},
+				},
+				Spec: v1alpha5.MachineSpec{
+					Requirements: []v1.NodeSelectorRequirement{
+						{Key: v1alpha5.LabelCapacityType, Operator: v1.NodeSelectorOpIn, Values: []string{v1alpha5.CapacityTypeOnDemand}},
+						{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"test-zone-1a"}},
+					},
+				},
+			})
+			_, err = awsEnv.InstanceProvider.Create(ctx, nodeTemplate, machine, instanceTypes)
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should expire unavailable offerings after the configured unavailable offerings TTL", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				UnavailableOfferingsTTL: lo.ToPtr(100 * time.Millisecond),
+			}))
+			awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", "m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+			Expect(awsEnv.UnavailableOfferingsCache.IsUnavailable("m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)).To(BeTrue())
+			Eventually(func() bool {
+				return awsEnv.UnavailableOfferingsCache.IsUnavailable("m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+			}).Should(BeFalse())
+		})
+		It("should keep unavailable offerings for the configured unavailable offerings TTL", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				UnavailableOfferingsTTL: lo.ToPtr(time.Hour),
+			}))
+			awsEnv.UnavailableOfferingsCache.MarkUnavailable(ctx, "InsufficientInstanceCapacity", "m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+			Consistently(func() bool {
+				return awsEnv.UnavailableOfferingsCache.IsUnavailable("m5.large", "test-zone-1a", v1alpha5.CapacityTypeOnDemand)
+			}, time.Second).Should(BeTrue())
+		})
 		It("should launch instances in a different zone on second reconciliation attempt with Insufficient Capacity Error Cache fallback (Habana)", func() {
 			awsEnv.EC2API.InsufficientCapacityPools.Set([]fake.CapacityPool{{CapacityType: v1alpha5.CapacityTypeOnDemand, InstanceType: "dl1.24xlarge", Zone: "test-zone-1a"}})
 			pod := coretest.UnschedulablePod(coretest.PodOptions{
@@ -1171,6 +2179,28 @@ var _ = Describe("Instance Types", func() {
 
 // generateSpotPricing creates a spot price history output for use in a mock that has all spot offerings discounted by 50%
 // vs the on-demand offering.
+func spotFallbacks() float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == "karpenter_cloudprovider_instance_spot_fallbacks_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func warmUpDuration() float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == "karpenter_cloudprovider_instance_types_warm_up_duration_seconds" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
 func generateSpotPricing(cp *cloudprovider.CloudProvider, prov *v1alpha5.Provisioner) *ec2.DescribeSpotPriceHistoryOutput {
 	rsp := &ec2.DescribeSpotPriceHistoryOutput{}
 	instanceTypes, err := cp.GetInstanceTypes(ctx, prov)
@@ -1207,7 +2237,7 @@ func makeFakeInstances() []*ec2.InstanceTypeInfo {
 	ctx := settings.ToContext(context.Background(), &settings.Settings{IsolatedVPC: true})
 	// Use keys from the static pricing data so that we guarantee pricing for the data
 	// Create uniform instance data so all of them schedule for a given pod
-	for _, it := range pricing.NewProvider(ctx, nil, nil, "us-east-1", nil).InstanceTypes() {
+	for _, it := range pricing.NewProvider(ctx, fakeClock, nil, nil, "us-east-1", nil).InstanceTypes() {
 		instanceTypes = append(instanceTypes, &ec2.InstanceTypeInfo{
 			InstanceType: aws.String(it),
 			ProcessorInfo: &ec2.ProcessorInfo{
@@ -1230,6 +2260,31 @@ func makeFakeInstances() []*ec2.InstanceTypeInfo {
 	return instanceTypes
 }
 
+// orderedSelectionStrategy selects the candidate instance types named by order, in that order, and records the names of
+// the candidates
+type orderedSelectionStrategy struct {
+	order      []string
+	candidates []string
+}
+
+func (s *orderedSelectionStrategy) Select(_ context.Context, _ *v1alpha5.Machine, instanceTypes []*corecloudproivder.InstanceType) []*corecloudproivder.InstanceType {
+	s.candidates = lo.Map(instanceTypes, func(it *corecloudproivder.InstanceType, _ int) string { return it.Name })
+	return lo.FilterMap(s.order, func(name string, _ int) (*corecloudproivder.InstanceType, bool) {
+		return lo.Find(instanceTypes, func(it *corecloudproivder.InstanceType) bool { return it.Name == name })
+	})
+}
+
+// blockingPricingAPI holds pricing updates until it's released
+type blockingPricingAPI struct {
+	*fake.PricingAPI
+	release chan struct{}
+}
+
+func (b *blockingPricingAPI) GetProductsPagesWithContext(ctx aws.Context, input *awspricing.GetProductsInput, fn func(*awspricing.GetProductsOutput, bool) bool, opts ...request.Option) error {
+	<-b.release
+	return b.PricingAPI.GetProductsPagesWithContext(ctx, input, fn, opts...)
+}
+
 func makeFakeInstanceOfferings(instanceTypes []*ec2.InstanceTypeInfo) []*ec2.InstanceTypeOffering {
 	var instanceTypeOfferings []*ec2.InstanceTypeOffering
 
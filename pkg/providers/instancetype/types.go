@@ -45,6 +45,9 @@ const (
 
 var (
 	instanceTypeScheme = regexp.MustCompile(`(^[a-z]+)(\-[0-9]+tb)?([0-9]+).*\.`)
+	// networkPerformanceScheme matches the network performance of instance types with a fixed bandwidth, e.g.
+	// "25 Gigabit" or "4x 100 Gigabit" for instance types with multiple network cards
+	networkPerformanceScheme = regexp.MustCompile(`^(?:([0-9]+)x )?([0-9]+(?:\.[0-9]+)?) (Gigabit|Megabit)$`)
 )
 
 func NewInstanceType(ctx context.Context, info *ec2.InstanceTypeInfo, kc *v1alpha5.KubeletConfiguration,
@@ -55,10 +58,10 @@ func NewInstanceType(ctx context.Context, info *ec2.InstanceTypeInfo, kc *v1alph
 		Name:         aws.StringValue(info.InstanceType),
 		Requirements: computeRequirements(ctx, info, offerings, region, amiFamily, kc),
 		Offerings:    offerings,
-		Capacity:     computeCapacity(ctx, info, amiFamily, nodeTemplate.Spec.BlockDeviceMappings, kc),
+		Capacity:     computeCapacity(ctx, info, amiFamily, nodeTemplate.Spec.BlockDeviceMappings, aws.BoolValue(nodeTemplate.Spec.EFA), kc),
 		Overhead: &cloudprovider.InstanceTypeOverhead{
-			KubeReserved:      kubeReservedResources(cpu(info), pods(ctx, info, amiFamily, kc), eniLimitedPods(info), amiFamily, kc),
-			SystemReserved:    systemReservedResources(kc),
+			KubeReserved:      kubeReservedResources(ctx, cpu(info), pods(ctx, info, amiFamily, kc), eniLimitedPods(info), amiFamily, kc),
+			SystemReserved:    systemReservedResources(ctx, amiFamily, kc),
 			EvictionThreshold: evictionThreshold(memory(ctx, info), amiFamily, kc),
 		},
 	}
@@ -70,7 +73,7 @@ func computeRequirements(ctx context.Context, info *ec2.InstanceTypeInfo, offeri
 		// Well Known Upstream
 		scheduling.NewRequirement(v1.LabelInstanceTypeStable, v1.NodeSelectorOpIn, aws.StringValue(info.InstanceType)),
 		scheduling.NewRequirement(v1.LabelArchStable, v1.NodeSelectorOpIn, getArchitecture(info)),
-		scheduling.NewRequirement(v1.LabelOSStable, v1.NodeSelectorOpIn, string(v1.Linux)),
+		scheduling.NewRequirement(v1.LabelOSStable, v1.NodeSelectorOpIn, string(operatingSystem(amiFamily))),
 		scheduling.NewRequirement(v1.LabelTopologyZone, v1.NodeSelectorOpIn, lo.Map(offerings.Available(), func(o cloudprovider.Offering, _ int) string { return o.Zone })...),
 		scheduling.NewRequirement(v1.LabelTopologyRegion, v1.NodeSelectorOpIn, region),
 		// Well Known to Karpenter
@@ -107,7 +110,7 @@ func computeRequirements(ctx context.Context, info *ec2.InstanceTypeInfo, offeri
 		requirements[v1alpha1.LabelInstanceLocalNVME].Insert(fmt.Sprint(aws.Int64Value(info.InstanceStorageInfo.TotalSizeInGB)))
 	}
 	// Network bandwidth
-	if bandwidth, ok := InstanceTypeBandwidthMegabits[aws.StringValue(info.InstanceType)]; ok {
+	if bandwidth, ok := networkBandwidth(info); ok {
 		requirements[v1alpha1.LabelInstanceNetworkBandwidth].Insert(fmt.Sprint(bandwidth))
 	}
 	// GPU Labels
@@ -121,6 +124,42 @@ func computeRequirements(ctx context.Context, info *ec2.InstanceTypeInfo, offeri
 	return requirements
 }
 
+// networkBandwidth returns the baseline network bandwidth of the instance type in megabits. Instance types that are
+// missing from the generated bandwidth table fall back to the network performance reported by EC2, as long as it's a
+// fixed bandwidth. Burstable ("Up to 10 Gigabit") and qualitative ("Moderate") performance doesn't tell the baseline,
+// so no bandwidth is advertised for those.
+func networkBandwidth(info *ec2.InstanceTypeInfo) (int64, bool) {
+	if bandwidth, ok := InstanceTypeBandwidthMegabits[aws.StringValue(info.InstanceType)]; ok {
+		return bandwidth, true
+	}
+	parts := networkPerformanceScheme.FindStringSubmatch(strings.TrimSpace(aws.StringValue(info.NetworkInfo.NetworkPerformance)))
+	if parts == nil {
+		return 0, false
+	}
+	bandwidth, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, false
+	}
+	if parts[3] == "Gigabit" {
+		bandwidth *= 1000
+	}
+	if parts[1] != "" {
+		cards, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		bandwidth *= cards
+	}
+	return int64(bandwidth), true
+}
+
+func operatingSystem(amiFamily amifamily.AMIFamily) v1.OSName {
+	if _, ok := amiFamily.(*amifamily.Windows); ok {
+		return v1.Windows
+	}
+	return v1.Linux
+}
+
 func getArchitecture(info *ec2.InstanceTypeInfo) string {
 	for _, architecture := range info.ProcessorInfo.SupportedArchitectures {
 		if value, ok := v1alpha1.AWSToKubeArchitectures[aws.StringValue(architecture)]; ok {
@@ -131,18 +170,20 @@ func getArchitecture(info *ec2.InstanceTypeInfo) string {
 }
 
 func computeCapacity(ctx context.Context, info *ec2.InstanceTypeInfo, amiFamily amifamily.AMIFamily,
-	blockDeviceMappings []*v1alpha1.BlockDeviceMapping, kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
+	blockDeviceMappings []*v1alpha1.BlockDeviceMapping, efa bool, kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
 
 	return v1.ResourceList{
-		v1.ResourceCPU:               *cpu(info),
-		v1.ResourceMemory:            *memory(ctx, info),
-		v1.ResourceEphemeralStorage:  *ephemeralStorage(amiFamily, blockDeviceMappings),
-		v1.ResourcePods:              *pods(ctx, info, amiFamily, kc),
-		v1alpha1.ResourceAWSPodENI:   *awsPodENI(ctx, aws.StringValue(info.InstanceType)),
-		v1alpha1.ResourceNVIDIAGPU:   *nvidiaGPUs(info),
-		v1alpha1.ResourceAMDGPU:      *amdGPUs(info),
-		v1alpha1.ResourceAWSNeuron:   *awsNeurons(info),
-		v1alpha1.ResourceHabanaGaudi: *habanaGaudis(info),
+		v1.ResourceCPU:                 *cpu(info),
+		v1.ResourceMemory:              *memory(ctx, info),
+		v1.ResourceEphemeralStorage:    *ephemeralStorage(amiFamily, blockDeviceMappings),
+		v1.ResourcePods:                *pods(ctx, info, amiFamily, kc),
+		v1alpha1.ResourceAWSPodENI:     *awsPodENI(ctx, aws.StringValue(info.InstanceType)),
+		v1alpha1.ResourceNVIDIAGPU:     *nvidiaGPUs(info),
+		v1alpha1.ResourceAMDGPU:        *amdGPUs(info),
+		v1alpha1.ResourceAWSNeuron:     *awsNeurons(info),
+		v1alpha1.ResourceHabanaGaudi:   *habanaGaudis(info),
+		v1alpha1.ResourceEFA:           *efas(info, efa),
+		v1alpha1.ResourceInstanceStore: *instanceStore(info),
 	}
 }
 
@@ -159,6 +200,9 @@ func memory(ctx context.Context, info *ec2.InstanceTypeInfo) *resource.Quantity
 
 // Setting ephemeral-storage to be either the default value or what is defined in blockDeviceMappings
 func ephemeralStorage(amiFamily amifamily.AMIFamily, blockDeviceMappings []*v1alpha1.BlockDeviceMapping) *resource.Quantity {
+	if len(blockDeviceMappings) == 0 {
+		blockDeviceMappings = amiFamily.DefaultBlockDeviceMappings()
+	}
 	if len(blockDeviceMappings) != 0 {
 		switch amiFamily.(type) {
 		case *amifamily.Custom:
@@ -186,49 +230,63 @@ func awsPodENI(ctx context.Context, name string) *resource.Quantity {
 }
 
 func nvidiaGPUs(info *ec2.InstanceTypeInfo) *resource.Quantity {
-	count := int64(0)
-	if info.GpuInfo != nil {
-		for _, gpu := range info.GpuInfo.Gpus {
-			if *gpu.Manufacturer == "NVIDIA" {
-				count += *gpu.Count
-			}
-		}
-	}
-	return resources.Quantity(fmt.Sprint(count))
+	return resources.Quantity(fmt.Sprint(gpuCount(info, "NVIDIA")))
 }
 
 func amdGPUs(info *ec2.InstanceTypeInfo) *resource.Quantity {
-	count := int64(0)
-	if info.GpuInfo != nil {
-		for _, gpu := range info.GpuInfo.Gpus {
-			if *gpu.Manufacturer == "AMD" {
-				count += *gpu.Count
-			}
-		}
-	}
-	return resources.Quantity(fmt.Sprint(count))
+	return resources.Quantity(fmt.Sprint(gpuCount(info, "AMD")))
 }
 
 func awsNeurons(info *ec2.InstanceTypeInfo) *resource.Quantity {
 	count := int64(0)
 	if info.InferenceAcceleratorInfo != nil {
 		for _, accelerator := range info.InferenceAcceleratorInfo.Accelerators {
-			count += *accelerator.Count
+			count += aws.Int64Value(accelerator.Count)
 		}
 	}
 	return resources.Quantity(fmt.Sprint(count))
 }
 
+// efas returns the number of EFA devices that are advertised by the EFA device plugin. Instances are only launched with
+// an EFA as their primary network interface, so at most one is advertised.
+func efas(info *ec2.InstanceTypeInfo, efa bool) *resource.Quantity {
+	if !efa || !aws.BoolValue(info.NetworkInfo.EfaSupported) {
+		return resources.Quantity("0")
+	}
+	return resources.Quantity("1")
+}
+
+// instanceStore returns the capacity of the instance store volumes. Instances with multiple disks assemble them as a
+// RAID-0 array, which stripes across every disk, so its capacity is the number of disks times the smallest disk.
+func instanceStore(info *ec2.InstanceTypeInfo) *resource.Quantity {
+	if info.InstanceStorageInfo == nil {
+		return resources.Quantity("0")
+	}
+	disks := info.InstanceStorageInfo.Disks
+	if len(disks) == 0 {
+		return resources.Quantity(fmt.Sprintf("%dG", aws.Int64Value(info.InstanceStorageInfo.TotalSizeInGB)))
+	}
+	count := lo.SumBy(disks, func(d *ec2.DiskInfo) int64 { return aws.Int64Value(d.Count) })
+	size := lo.Min(lo.Map(disks, func(d *ec2.DiskInfo, _ int) int64 { return aws.Int64Value(d.SizeInGB) }))
+	return resources.Quantity(fmt.Sprintf("%dG", count*size))
+}
+
 func habanaGaudis(info *ec2.InstanceTypeInfo) *resource.Quantity {
+	return resources.Quantity(fmt.Sprint(gpuCount(info, "Habana")))
+}
+
+// gpuCount sums the GPUs of every device the instance type reports for the manufacturer. Instance types may report
+// more than one device, and EC2 isn't consistent about the casing of manufacturer names.
+func gpuCount(info *ec2.InstanceTypeInfo, manufacturer string) int64 {
 	count := int64(0)
 	if info.GpuInfo != nil {
 		for _, gpu := range info.GpuInfo.Gpus {
-			if *gpu.Manufacturer == "Habana" {
-				count += *gpu.Count
+			if strings.EqualFold(aws.StringValue(gpu.Manufacturer), manufacturer) {
+				count += aws.Int64Value(gpu.Count)
 			}
 		}
 	}
-	return resources.Quantity(fmt.Sprint(count))
+	return count
 }
 
 // The number of pods per node is calculated using the formula:
@@ -238,49 +296,35 @@ func eniLimitedPods(info *ec2.InstanceTypeInfo) *resource.Quantity {
 	return resources.Quantity(fmt.Sprint(*info.NetworkInfo.MaximumNetworkInterfaces*(*info.NetworkInfo.Ipv4AddressesPerInterface-1) + 2))
 }
 
-func systemReservedResources(kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
-	// default system-reserved resources: https://kubernetes.io/docs/tasks/administer-cluster/reserve-compute-resources/#system-reserved
-	resources := v1.ResourceList{
-		v1.ResourceCPU:              resource.MustParse("100m"),
-		v1.ResourceMemory:           resource.MustParse("100Mi"),
-		v1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+// With prefix delegation, each secondary IPv4 address slot on an ENI is a /28 prefix of 16 addresses. The number of
+// pods is then capped at 110 for instance types with fewer than 30 vCPUs and at 250 otherwise, matching the
+// recommendations of the EKS max pods calculator.
+// https://github.com/awslabs/amazon-eks-ami/blob/master/files/max-pods-calculator.sh
+func prefixDelegatedPods(info *ec2.InstanceTypeInfo) *resource.Quantity {
+	count := *info.NetworkInfo.MaximumNetworkInterfaces*(*info.NetworkInfo.Ipv4AddressesPerInterface-1)*16 + 2
+	limit := int64(110)
+	if aws.Int64Value(info.VCpuInfo.DefaultVCpus) >= 30 {
+		limit = 250
 	}
+	return resources.Quantity(fmt.Sprint(lo.Min([]int64{count, limit})))
+}
+
+func systemReservedResources(ctx context.Context, amiFamily amifamily.AMIFamily, kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
+	resources := amiFamily.SystemReserved()
+	// Cluster-wide overrides from settings take precedence over the defaults, but not over the provisioner
+	resources = lo.Assign(resources, awssettings.FromContext(ctx).SystemReserved)
 	if kc != nil && kc.SystemReserved != nil {
 		return lo.Assign(resources, kc.SystemReserved)
 	}
 	return resources
 }
 
-func kubeReservedResources(cpus, pods, eniLimitedPods *resource.Quantity, amiFamily amifamily.AMIFamily, kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
+func kubeReservedResources(ctx context.Context, cpus, pods, eniLimitedPods *resource.Quantity, amiFamily amifamily.AMIFamily, kc *v1alpha5.KubeletConfiguration) v1.ResourceList {
 	if amiFamily.FeatureFlags().UsesENILimitedMemoryOverhead {
 		pods = eniLimitedPods
 	}
-	resources := v1.ResourceList{
-		v1.ResourceMemory:           resource.MustParse(fmt.Sprintf("%dMi", (11*pods.Value())+255)),
-		v1.ResourceEphemeralStorage: resource.MustParse("1Gi"), // default kube-reserved ephemeral-storage
-	}
-	// kube-reserved Computed from
-	// https://github.com/bottlerocket-os/bottlerocket/pull/1388/files#diff-bba9e4e3e46203be2b12f22e0d654ebd270f0b478dd34f40c31d7aa695620f2fR611
-	for _, cpuRange := range []struct {
-		start      int64
-		end        int64
-		percentage float64
-	}{
-		{start: 0, end: 1000, percentage: 0.06},
-		{start: 1000, end: 2000, percentage: 0.01},
-		{start: 2000, end: 4000, percentage: 0.005},
-		{start: 4000, end: 1 << 31, percentage: 0.0025},
-	} {
-		if cpu := cpus.MilliValue(); cpu >= cpuRange.start {
-			r := float64(cpuRange.end - cpuRange.start)
-			if cpu < cpuRange.end {
-				r = float64(cpu - cpuRange.start)
-			}
-			cpuOverhead := resources.Cpu()
-			cpuOverhead.Add(*resource.NewMilliQuantity(int64(r*cpuRange.percentage), resource.DecimalSI))
-			resources[v1.ResourceCPU] = *cpuOverhead
-		}
-	}
+	resources := amiFamily.KubeReserved(cpus, pods)
+	resources = lo.Assign(resources, awssettings.FromContext(ctx).KubeReserved)
 	if kc != nil && kc.KubeReserved != nil {
 		return lo.Assign(resources, kc.KubeReserved)
 	}
@@ -330,6 +374,8 @@ func pods(ctx context.Context, info *ec2.InstanceTypeInfo, amiFamily amifamily.A
 		count = int64(ptr.Int32Value(kc.MaxPods))
 	case !awssettings.FromContext(ctx).EnableENILimitedPodDensity:
 		count = 110
+	case awssettings.FromContext(ctx).EnablePrefixDelegation:
+		count = prefixDelegatedPods(info).Value()
 	default:
 		count = eniLimitedPods(info).Value()
 	}
@@ -16,10 +16,12 @@ package launchtemplate
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"math"
 	"net"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -28,8 +30,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
+	"go.uber.org/multierr"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/util/flowcontrol"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 
@@ -37,7 +42,10 @@ import (
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	awserrors "github.com/aws/karpenter/pkg/errors"
 	"github.com/aws/karpenter/pkg/providers/amifamily"
+	"github.com/aws/karpenter/pkg/providers/amifamily/bootstrap"
+	"github.com/aws/karpenter/pkg/providers/instanceprofile"
 	"github.com/aws/karpenter/pkg/providers/securitygroup"
+	"github.com/aws/karpenter/pkg/providers/subnet"
 
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
 
@@ -48,30 +56,43 @@ import (
 const (
 	launchTemplateNameFormat = "Karpenter-%s-%s"
 	karpenterManagedTagKey   = "karpenter.k8s.aws/cluster"
+
+	// The launch template quota applies to the whole region, so creation backs off as a whole
+	creationBackoffID      = "creation"
+	creationBackoffInitial = time.Minute
+	creationBackoffMax     = time.Minute * 10
 )
 
 type Provider struct {
 	sync.Mutex
-	ec2api                ec2iface.EC2API
-	amiFamily             *amifamily.Resolver
-	securityGroupProvider *securitygroup.Provider
-	cache                 *cache.Cache
-	caBundle              *string
-	cm                    *pretty.ChangeMonitor
-	KubeDNSIP             net.IP
-	ClusterEndpoint       string
+	ec2api                  ec2iface.EC2API
+	amiFamily               *amifamily.Resolver
+	securityGroupProvider   *securitygroup.Provider
+	subnetProvider          *subnet.Provider
+	instanceProfileProvider *instanceprofile.Provider
+	cache                   *cache.Cache
+	caBundle                *string
+	cm                      *pretty.ChangeMonitor
+	KubeDNSIP               net.IP
+	ClusterEndpoint         string
+	// CreationBackoff delays creating launch templates after quota errors
+	CreationBackoff *flowcontrol.Backoff
 }
 
-func NewProvider(ctx context.Context, cache *cache.Cache, ec2api ec2iface.EC2API, amiFamily *amifamily.Resolver, securityGroupProvider *securitygroup.Provider, caBundle *string, startAsync <-chan struct{}, kubeDNSIP net.IP, clusterEndpoint string) *Provider {
+func NewProvider(ctx context.Context, cache *cache.Cache, ec2api ec2iface.EC2API, amiFamily *amifamily.Resolver, securityGroupProvider *securitygroup.Provider,
+	subnetProvider *subnet.Provider, instanceProfileProvider *instanceprofile.Provider, caBundle *string, startAsync <-chan struct{}, kubeDNSIP net.IP, clusterEndpoint string) *Provider {
 	l := &Provider{
-		ec2api:                ec2api,
-		amiFamily:             amiFamily,
-		securityGroupProvider: securityGroupProvider,
-		cache:                 cache,
-		caBundle:              caBundle,
-		cm:                    pretty.NewChangeMonitor(),
-		KubeDNSIP:             kubeDNSIP,
-		ClusterEndpoint:       clusterEndpoint,
+		ec2api:                  ec2api,
+		amiFamily:               amiFamily,
+		securityGroupProvider:   securityGroupProvider,
+		subnetProvider:          subnetProvider,
+		instanceProfileProvider: instanceProfileProvider,
+		cache:                   cache,
+		caBundle:                caBundle,
+		cm:                      pretty.NewChangeMonitor(),
+		KubeDNSIP:               kubeDNSIP,
+		ClusterEndpoint:         clusterEndpoint,
+		CreationBackoff:         flowcontrol.NewBackOff(creationBackoffInitial, creationBackoffMax),
 	}
 	l.cache.OnEvicted(l.cachedEvictedFunc(ctx))
 	go func() {
@@ -92,8 +113,12 @@ func (p *Provider) EnsureAll(ctx context.Context, nodeTemplate *v1alpha1.AWSNode
 	p.Lock()
 	defer p.Unlock()
 	// If Launch Template is directly specified then just use it
-	if nodeTemplate.Spec.LaunchTemplateName != nil {
-		return map[string][]*cloudprovider.InstanceType{ptr.StringValue(nodeTemplate.Spec.LaunchTemplateName): instanceTypes}, nil
+	if nodeTemplate.Spec.HasCustomLaunchTemplate() {
+		name, err := p.resolveCustomLaunchTemplate(ctx, nodeTemplate)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]*cloudprovider.InstanceType{name: instanceTypes}, nil
 	}
 	options, err := p.createAmiOptions(ctx, nodeTemplate, lo.Assign(machine.Labels, additionalLabels))
 	if err != nil {
@@ -115,6 +140,90 @@ func (p *Provider) EnsureAll(ctx context.Context, nodeTemplate *v1alpha1.AWSNode
 	return launchTemplates, nil
 }
 
+// ID returns the ID of a launch template that was generated and cached by EnsureAll
+func (p *Provider) ID(name string) (string, bool) {
+	launchTemplate, ok := p.cache.Get(name)
+	if !ok {
+		return "", false
+	}
+	id := aws.StringValue(launchTemplate.(*ec2.LaunchTemplate).LaunchTemplateId)
+	return id, id != ""
+}
+
+// launchConfig is the part of a node template's resolved configuration that instances only pick up when they're
+// replaced. AMIs are excluded, since they're covered by AMI drift.
+type launchConfig struct {
+	SecurityGroupIDs      []string                        `json:"securityGroupIDs"`
+	InstanceProfile       string                          `json:"instanceProfile"`
+	UserData              *string                         `json:"userData,omitempty"`
+	UserDataMode          *string                         `json:"userDataMode,omitempty"`
+	UserDataEncoding      *string                         `json:"userDataEncoding,omitempty"`
+	MetadataOptions       *v1alpha1.MetadataOptions       `json:"metadataOptions,omitempty"`
+	BlockDeviceMappings   []*v1alpha1.BlockDeviceMapping  `json:"blockDeviceMappings,omitempty"`
+	EncryptedByDefault    *bool                           `json:"encryptedByDefault,omitempty"`
+	KMSKeyID              *string                         `json:"kmsKeyID,omitempty"`
+	DetailedMonitoring    *bool                           `json:"detailedMonitoring,omitempty"`
+	KeyName               *string                         `json:"keyName,omitempty"`
+	Tenancy               *string                         `json:"tenancy,omitempty"`
+	HostID                *string                         `json:"hostID,omitempty"`
+	HostResourceGroupARN  *string                         `json:"hostResourceGroupARN,omitempty"`
+	PrivateDNSNameOptions *v1alpha1.PrivateDNSNameOptions `json:"privateDNSNameOptions,omitempty"`
+	EFA                   *bool                           `json:"efa,omitempty"`
+	NetworkInterfaces     []v1alpha1.NetworkInterface     `json:"networkInterfaces,omitempty"`
+	IPv6Only              bool                            `json:"ipv6Only,omitempty"`
+}
+
+// ConfigHash returns a hash of the launch configuration that the node template currently resolves to, so that
+// instances launched with a different configuration can be detected as drifted. An empty hash is returned for custom
+// launch templates, since their contents aren't managed by Karpenter.
+func (p *Provider) ConfigHash(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (string, error) {
+	if nodeTemplate.Spec.HasCustomLaunchTemplate() {
+		return "", nil
+	}
+	securityGroupIDs, err := p.securityGroupProvider.List(ctx, nodeTemplate)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(securityGroupIDs)
+	instanceProfile, err := p.instanceProfileProvider.Get(ctx, nodeTemplate)
+	if err != nil {
+		return "", err
+	}
+	ipv6Only, err := p.subnetProvider.IPv6Only(ctx, nodeTemplate)
+	if err != nil {
+		return "", err
+	}
+	// Volume sizes are quantities, whose values are unexported, so the configuration is hashed once it's serialized
+	raw, err := json.Marshal(launchConfig{
+		SecurityGroupIDs:      securityGroupIDs,
+		InstanceProfile:       instanceProfile,
+		UserData:              nodeTemplate.Spec.UserData,
+		UserDataMode:          nodeTemplate.Spec.UserDataMode,
+		UserDataEncoding:      nodeTemplate.Spec.UserDataEncoding,
+		MetadataOptions:       nodeTemplate.Spec.MetadataOptions,
+		BlockDeviceMappings:   nodeTemplate.Spec.BlockDeviceMappings,
+		EncryptedByDefault:    nodeTemplate.Spec.EncryptedByDefault,
+		KMSKeyID:              nodeTemplate.Spec.KMSKeyID,
+		DetailedMonitoring:    nodeTemplate.Spec.DetailedMonitoring,
+		KeyName:               nodeTemplate.Spec.KeyName,
+		Tenancy:               nodeTemplate.Spec.Tenancy,
+		HostID:                nodeTemplate.Spec.HostID,
+		HostResourceGroupARN:  nodeTemplate.Spec.HostResourceGroupARN,
+		PrivateDNSNameOptions: nodeTemplate.Spec.PrivateDNSNameOptions,
+		EFA:                   nodeTemplate.Spec.EFA,
+		NetworkInterfaces:     nodeTemplate.Spec.NetworkInterfaces,
+		IPv6Only:              ipv6Only,
+	})
+	if err != nil {
+		return "", fmt.Errorf("serializing launch configuration, %w", err)
+	}
+	hash, err := hashstructure.Hash(string(raw), hashstructure.FormatV2, nil)
+	if err != nil {
+		return "", fmt.Errorf("hashing launch configuration, %w", err)
+	}
+	return fmt.Sprint(hash), nil
+}
+
 // Invalidate deletes a launch template from cache if it exists
 func (p *Provider) Invalidate(ctx context.Context, ltName string, ltID string) {
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("launch-template-name", ltName, "launch-template-id", ltID))
@@ -135,7 +244,7 @@ func launchTemplateName(options *amifamily.LaunchTemplate) string {
 }
 
 func (p *Provider) createAmiOptions(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, labels map[string]string) (*amifamily.Options, error) {
-	instanceProfile, err := p.getInstanceProfile(ctx, nodeTemplate)
+	instanceProfile, err := p.instanceProfileProvider.Get(ctx, nodeTemplate)
 	if err != nil {
 		return nil, err
 	}
@@ -147,6 +256,14 @@ func (p *Provider) createAmiOptions(ctx context.Context, nodeTemplate *v1alpha1.
 	if len(securityGroupsIDs) == 0 {
 		return nil, fmt.Errorf("no security groups exist given constraints")
 	}
+	ipv6Only, err := p.subnetProvider.IPv6Only(ctx, nodeTemplate)
+	if err != nil {
+		return nil, err
+	}
+	labels, rejected := bootstrap.KubeletLabels(labels)
+	if len(rejected) != 0 && p.cm.HasChanged("rejected-labels/"+nodeTemplate.Name, rejected) {
+		logging.FromContext(ctx).With("labels", rejected).Warnf("omitting labels that the kubelet can't register the node with from the user data")
+	}
 	return &amifamily.Options{
 		ClusterName:             awssettings.FromContext(ctx).ClusterName,
 		ClusterEndpoint:         p.ClusterEndpoint,
@@ -157,9 +274,36 @@ func (p *Provider) createAmiOptions(ctx context.Context, nodeTemplate *v1alpha1.
 		Labels:                  labels,
 		CABundle:                p.caBundle,
 		KubeDNSIP:               p.KubeDNSIP,
+		IPv6Only:                ipv6Only,
 	}, nil
 }
 
+// resolveCustomLaunchTemplate returns the name of the launch template that the node template references by name or ID,
+// after verifying that it exists along with its pinned version. Custom launch templates aren't cached, since evicting
+// a launch template from the cache deletes it.
+func (p *Provider) resolveCustomLaunchTemplate(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (string, error) {
+	input := &ec2.DescribeLaunchTemplatesInput{}
+	if nodeTemplate.Spec.LaunchTemplateID != nil {
+		input.LaunchTemplateIds = []*string{nodeTemplate.Spec.LaunchTemplateID}
+	} else {
+		input.LaunchTemplateNames = []*string{nodeTemplate.Spec.LaunchTemplateName}
+	}
+	output, err := p.ec2api.DescribeLaunchTemplatesWithContext(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("describing launch templates, %w", err)
+	}
+	if len(output.LaunchTemplates) != 1 {
+		return "", fmt.Errorf("expected to find one launch template, but found %d", len(output.LaunchTemplates))
+	}
+	launchTemplate := output.LaunchTemplates[0]
+	// $Latest and $Default always resolve, so only version numbers need to be checked
+	if version, err := strconv.ParseInt(ptr.StringValue(nodeTemplate.Spec.LaunchTemplateVersion), 10, 64); err == nil && version > aws.Int64Value(launchTemplate.LatestVersionNumber) {
+		return "", fmt.Errorf("launch template %s has no version %d, the latest version is %d",
+			aws.StringValue(launchTemplate.LaunchTemplateName), version, aws.Int64Value(launchTemplate.LatestVersionNumber))
+	}
+	return aws.StringValue(launchTemplate.LaunchTemplateName), nil
+}
+
 func (p *Provider) ensureLaunchTemplate(ctx context.Context, options *amifamily.LaunchTemplate) (*ec2.LaunchTemplate, error) {
 	var launchTemplate *ec2.LaunchTemplate
 	name := launchTemplateName(options)
@@ -198,59 +342,172 @@ func (p *Provider) createLaunchTemplate(ctx context.Context, options *amifamily.
 	if err != nil {
 		return nil, err
 	}
+	interfaces := networkInterfaces(options)
+	data := &ec2.RequestLaunchTemplateData{
+		BlockDeviceMappings: p.blockDeviceMappings(ctx, options),
+		IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileSpecificationRequest{
+			Name: aws.String(options.InstanceProfile),
+		},
+		Monitoring: &ec2.LaunchTemplatesMonitoringRequest{
+			Enabled: aws.Bool(options.DetailedMonitoring),
+		},
+		KeyName:               options.KeyName,
+		Placement:             placement(options),
+		PrivateDnsNameOptions: privateDNSNameOptions(options),
+		NetworkInterfaces:     interfaces,
+		SecurityGroupIds:      lo.Ternary(len(interfaces) == 0, aws.StringSlice(options.SecurityGroupsIDs), nil),
+		UserData:              aws.String(userData),
+		ImageId:               aws.String(options.AMIID),
+		MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+			HttpEndpoint:            options.MetadataOptions.HTTPEndpoint,
+			HttpProtocolIpv6:        options.MetadataOptions.HTTPProtocolIPv6,
+			HttpPutResponseHopLimit: options.MetadataOptions.HTTPPutResponseHopLimit,
+			HttpTokens:              options.MetadataOptions.HTTPTokens,
+			InstanceMetadataTags:    options.MetadataOptions.InstanceMetadataTags,
+		},
+		TagSpecifications: []*ec2.LaunchTemplateTagSpecificationRequest{
+			// Network interfaces can't be tagged through CreateFleet, so they pick up the same tags as the instance here
+			{ResourceType: aws.String(ec2.ResourceTypeNetworkInterface), Tags: v1alpha1.MergeTags(ctx, staticTags(options.Tags), map[string]string{
+				fmt.Sprintf("kubernetes.io/cluster/%s", options.ClusterName): "owned",
+			})},
+		},
+	}
+	now := p.CreationBackoff.Clock.Now()
+	if p.CreationBackoff.IsInBackOffSinceUpdate(creationBackoffID, now) {
+		return nil, fmt.Errorf("backing off launch template creation after reaching the launch template quota")
+	}
 	output, err := p.ec2api.CreateLaunchTemplateWithContext(ctx, &ec2.CreateLaunchTemplateInput{
 		LaunchTemplateName: aws.String(launchTemplateName(options)),
-		LaunchTemplateData: &ec2.RequestLaunchTemplateData{
-			BlockDeviceMappings: p.blockDeviceMappings(options.BlockDeviceMappings),
-			IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileSpecificationRequest{
-				Name: aws.String(options.InstanceProfile),
-			},
-			Monitoring: &ec2.LaunchTemplatesMonitoringRequest{
-				Enabled: aws.Bool(options.DetailedMonitoring),
-			},
-			SecurityGroupIds: aws.StringSlice(options.SecurityGroupsIDs),
-			UserData:         aws.String(userData),
-			ImageId:          aws.String(options.AMIID),
-			MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptionsRequest{
-				HttpEndpoint:            options.MetadataOptions.HTTPEndpoint,
-				HttpProtocolIpv6:        options.MetadataOptions.HTTPProtocolIPv6,
-				HttpPutResponseHopLimit: options.MetadataOptions.HTTPPutResponseHopLimit,
-				HttpTokens:              options.MetadataOptions.HTTPTokens,
-			},
-			TagSpecifications: []*ec2.LaunchTemplateTagSpecificationRequest{
-				{ResourceType: aws.String(ec2.ResourceTypeNetworkInterface), Tags: v1alpha1.MergeTags(ctx, options.Tags)},
-			},
-		},
+		LaunchTemplateData: data,
 		TagSpecifications: []*ec2.TagSpecification{
 			{
 				ResourceType: aws.String(ec2.ResourceTypeLaunchTemplate),
-				Tags:         v1alpha1.MergeTags(ctx, options.Tags, map[string]string{karpenterManagedTagKey: options.ClusterName}),
+				Tags:         v1alpha1.MergeTags(ctx, staticTags(options.Tags), map[string]string{karpenterManagedTagKey: options.ClusterName}),
 			},
 		},
 	})
 	if err != nil {
+		reason := creationFailureReason(err)
+		creationFailuresCounter.With(prometheus.Labels{reasonLabel: reason}).Inc()
+		// Throttled calls are retried by the EC2 client, while the quota isn't freed up until launch templates are deleted
+		if reason == quotaExceededReason {
+			p.CreationBackoff.Next(creationBackoffID, now)
+			logging.FromContext(ctx).With("backoff", p.CreationBackoff.Get(creationBackoffID)).Warnf("backing off launch template creation, reached the launch template quota")
+		}
 		return nil, err
 	}
+	p.CreationBackoff.Reset(creationBackoffID)
 	logging.FromContext(ctx).With("launch-template-id", aws.StringValue(output.LaunchTemplate.LaunchTemplateId)).Debugf("created launch template")
 	return output.LaunchTemplate, nil
 }
 
-func (p *Provider) blockDeviceMappings(blockDeviceMappings []*v1alpha1.BlockDeviceMapping) []*ec2.LaunchTemplateBlockDeviceMappingRequest {
-	if len(blockDeviceMappings) == 0 {
+// creationFailureReason categorizes a launch template creation failure by its AWS error code
+func creationFailureReason(err error) string {
+	codes := awserrors.Codes(err)
+	switch {
+	case lo.SomeBy(codes, awserrors.IsUnauthorizedCode):
+		return unauthorizedReason
+	case lo.SomeBy(codes, awserrors.IsQuotaExceededCode):
+		return quotaExceededReason
+	case lo.SomeBy(codes, awserrors.IsThrottlingCode):
+		return throttledReason
+	default:
+		return otherReason
+	}
+}
+
+// networkInterfaces requests an EFA as the primary network interface, assigns the primary network interface an IPv6
+// address in IPv6-native subnets and attaches the secondary network interfaces of the node template. Security groups
+// can't be set on both the launch template and its network interfaces, so they move to the primary interface, and
+// secondary interfaces without their own security groups inherit them.
+func networkInterfaces(options *amifamily.LaunchTemplate) []*ec2.LaunchTemplateInstanceNetworkInterfaceSpecificationRequest {
+	if !options.EFA && !options.IPv6Only && len(options.NetworkInterfaces) == 0 {
+		return nil
+	}
+	primary := &ec2.LaunchTemplateInstanceNetworkInterfaceSpecificationRequest{
+		DeviceIndex:         aws.Int64(0),
+		Groups:              aws.StringSlice(options.SecurityGroupsIDs),
+		DeleteOnTermination: aws.Bool(true),
+	}
+	if options.EFA {
+		primary.InterfaceType = aws.String(ec2.NetworkInterfaceTypeEfa)
+	}
+	// IPv6-native subnets don't assign IPv4 addresses, so the interface needs an IPv6 address to be reachable
+	if options.IPv6Only {
+		primary.Ipv6AddressCount = aws.Int64(1)
+	}
+	return append([]*ec2.LaunchTemplateInstanceNetworkInterfaceSpecificationRequest{primary},
+		lo.Map(options.NetworkInterfaces, func(ni v1alpha1.NetworkInterface, _ int) *ec2.LaunchTemplateInstanceNetworkInterfaceSpecificationRequest {
+			return &ec2.LaunchTemplateInstanceNetworkInterfaceSpecificationRequest{
+				DeviceIndex:         aws.Int64(ni.DeviceIndex),
+				SubnetId:            aws.String(ni.SubnetID),
+				Groups:              aws.StringSlice(lo.Ternary(len(ni.SecurityGroupIDs) > 0, ni.SecurityGroupIDs, options.SecurityGroupsIDs)),
+				DeleteOnTermination: aws.Bool(true),
+			}
+		})...)
+}
+
+// privateDNSNameOptions returns the private DNS name options of the node template. Instances in IPv6-native subnets
+// can't be named after their IPv4 address, so they default to resource names that resolve to their IPv6 address.
+func privateDNSNameOptions(options *amifamily.LaunchTemplate) *ec2.LaunchTemplatePrivateDnsNameOptionsRequest {
+	if options.PrivateDNSNameOptions == nil {
+		if options.IPv6Only {
+			return &ec2.LaunchTemplatePrivateDnsNameOptionsRequest{
+				HostnameType:                    aws.String(ec2.HostnameTypeResourceName),
+				EnableResourceNameDnsAAAARecord: aws.Bool(true),
+			}
+		}
+		return nil
+	}
+	return &ec2.LaunchTemplatePrivateDnsNameOptionsRequest{
+		HostnameType:                    options.PrivateDNSNameOptions.HostnameType,
+		EnableResourceNameDnsARecord:    options.PrivateDNSNameOptions.EnableResourceNameDNSARecord,
+		EnableResourceNameDnsAAAARecord: options.PrivateDNSNameOptions.EnableResourceNameDNSAAAARecord,
+	}
+}
+
+func placement(options *amifamily.LaunchTemplate) *ec2.LaunchTemplatePlacementRequest {
+	if options.Placement == nil && options.Tenancy == nil {
+		return nil
+	}
+	request := &ec2.LaunchTemplatePlacementRequest{
+		Tenancy:              options.Tenancy,
+		HostId:               options.HostID,
+		HostResourceGroupArn: options.HostResourceGroupARN,
+	}
+	if options.Placement != nil {
+		request.GroupName = aws.String(options.Placement.GroupName)
+	}
+	return request
+}
+
+func (p *Provider) blockDeviceMappings(ctx context.Context, options *amifamily.LaunchTemplate) []*ec2.LaunchTemplateBlockDeviceMappingRequest {
+	if len(options.BlockDeviceMappings) == 0 {
 		// The EC2 API fails with empty slices and expects nil.
 		return nil
 	}
 	var blockDeviceMappingsRequest []*ec2.LaunchTemplateBlockDeviceMappingRequest
-	for _, blockDeviceMapping := range blockDeviceMappings {
+	for _, blockDeviceMapping := range options.BlockDeviceMappings {
+		encrypted, kmsKeyID := blockDeviceMapping.EBS.Encrypted, blockDeviceMapping.EBS.KMSKeyID
+		if options.EncryptedByDefault {
+			// An explicitly unencrypted volume takes precedence over the node template default
+			if encrypted != nil && !*encrypted {
+				logging.FromContext(ctx).With("device-name", aws.StringValue(blockDeviceMapping.DeviceName)).
+					Warnf("block device mapping explicitly disables encryption, overriding encryptedByDefault")
+			} else {
+				encrypted = aws.Bool(true)
+				kmsKeyID = lo.Ternary(kmsKeyID != nil, kmsKeyID, options.KMSKeyID)
+			}
+		}
 		blockDeviceMappingsRequest = append(blockDeviceMappingsRequest, &ec2.LaunchTemplateBlockDeviceMappingRequest{
 			DeviceName: blockDeviceMapping.DeviceName,
 			Ebs: &ec2.LaunchTemplateEbsBlockDeviceRequest{
 				DeleteOnTermination: blockDeviceMapping.EBS.DeleteOnTermination,
-				Encrypted:           blockDeviceMapping.EBS.Encrypted,
+				Encrypted:           encrypted,
 				VolumeType:          blockDeviceMapping.EBS.VolumeType,
 				Iops:                blockDeviceMapping.EBS.IOPS,
 				Throughput:          blockDeviceMapping.EBS.Throughput,
-				KmsKeyId:            blockDeviceMapping.EBS.KMSKeyID,
+				KmsKeyId:            kmsKeyID,
 				SnapshotId:          blockDeviceMapping.EBS.SnapshotID,
 				VolumeSize:          p.volumeSize(blockDeviceMapping.EBS.VolumeSize),
 			},
@@ -287,6 +544,58 @@ func (p *Provider) hydrateCache(ctx context.Context) {
 	logging.FromContext(ctx).With("item-count", p.cache.ItemCount()).Debugf("finished hydrating the launch template cache")
 }
 
+// DeleteUnused deletes the launch templates created by Karpenter for the current cluster that are no longer in the
+// cache, since they're no longer resolved by any node template. Launch templates created within the grace period are
+// kept, so that templates which are about to be used by an in-flight launch aren't deleted.
+func (p *Provider) DeleteUnused(ctx context.Context, gracePeriod time.Duration) (int, error) {
+	clusterName := awssettings.FromContext(ctx).ClusterName
+	var unused []*ec2.LaunchTemplate
+	if err := p.ec2api.DescribeLaunchTemplatesPagesWithContext(ctx, &ec2.DescribeLaunchTemplatesInput{
+		Filters: []*ec2.Filter{{Name: aws.String(fmt.Sprintf("tag:%s", karpenterManagedTagKey)), Values: []*string{aws.String(clusterName)}}},
+	}, func(output *ec2.DescribeLaunchTemplatesOutput, _ bool) bool {
+		unused = append(unused, output.LaunchTemplates...)
+		return true
+	}); err != nil {
+		return 0, fmt.Errorf("describing launch templates, %w", err)
+	}
+	var errs []error
+	deleted := 0
+	for _, lt := range unused {
+		if lt.CreateTime == nil || time.Since(aws.TimeValue(lt.CreateTime)) < gracePeriod {
+			continue
+		}
+		ok, err := p.deleteUncached(ctx, lt)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			logging.FromContext(ctx).With("launch-template-name", aws.StringValue(lt.LaunchTemplateName), "launch-template-id", aws.StringValue(lt.LaunchTemplateId)).Debugf("deleted unused launch template")
+			deleted++
+		}
+	}
+	return deleted, multierr.Combine(errs...)
+}
+
+// deleteUncached deletes the launch template unless it's cached, returning whether it was deleted. Launches resolve
+// their launch templates through the cache while holding the lock, so a launch template that isn't cached can't be
+// picked up by a launch until the lock is released. The lock is only held for a single deletion, so that launches
+// aren't blocked until every unused launch template is deleted.
+func (p *Provider) deleteUncached(ctx context.Context, lt *ec2.LaunchTemplate) (bool, error) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.cache.Get(aws.StringValue(lt.LaunchTemplateName)); ok {
+		return false, nil
+	}
+	if _, err := p.ec2api.DeleteLaunchTemplateWithContext(ctx, &ec2.DeleteLaunchTemplateInput{LaunchTemplateId: lt.LaunchTemplateId}); err != nil {
+		if awserrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("deleting launch template %s, %w", aws.StringValue(lt.LaunchTemplateId), err)
+	}
+	return true, nil
+}
+
 func (p *Provider) cachedEvictedFunc(ctx context.Context) func(string, interface{}) {
 	return func(key string, lt interface{}) {
 		p.Lock()
@@ -303,13 +612,8 @@ func (p *Provider) cachedEvictedFunc(ctx context.Context) func(string, interface
 	}
 }
 
-func (p *Provider) getInstanceProfile(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (string, error) {
-	if nodeTemplate.Spec.InstanceProfile != nil {
-		return aws.StringValue(nodeTemplate.Spec.InstanceProfile), nil
-	}
-	defaultProfile := awssettings.FromContext(ctx).DefaultInstanceProfile
-	if defaultProfile == "" {
-		return "", errors.New("neither spec.provider.instanceProfile nor --aws-default-instance-profile is specified")
-	}
-	return defaultProfile, nil
+// staticTags omits tags whose values are templated with machine metadata, since launch templates are shared across
+// machines. Templated tags are resolved on the instance at launch instead.
+func staticTags(tags map[string]string) map[string]string {
+	return lo.OmitBy(tags, func(_ string, value string) bool { return v1alpha1.HasTagTemplate(value) })
 }
@@ -0,0 +1,48 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package launchtemplate
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	cloudProviderSubsystem = "cloudprovider"
+	reasonLabel            = "reason"
+
+	unauthorizedReason  = "unauthorized"
+	throttledReason     = "throttled"
+	quotaExceededReason = "quota-exceeded"
+	otherReason         = "other"
+)
+
+var (
+	creationFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: cloudProviderSubsystem,
+			Name:      "launch_template_creation_failures_total",
+			Help:      "Number of failed launch template creations. Labeled by the reason for the failure, which is one of unauthorized, throttled, quota-exceeded or other.",
+		},
+		[]string{reasonLabel},
+	)
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(creationFailuresCounter)
+}
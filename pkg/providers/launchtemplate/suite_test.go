@@ -22,6 +22,7 @@ import (
 	"math"
 	"net"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"testing"
@@ -30,6 +31,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
@@ -39,6 +41,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 	clock "k8s.io/utils/clock/testing"
 	. "knative.dev/pkg/logging/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -47,12 +50,16 @@ import (
 	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 	"github.com/aws/karpenter/pkg/cloudprovider"
+	"github.com/aws/karpenter/pkg/fake"
+	"github.com/aws/karpenter/pkg/providers/amifamily"
 	"github.com/aws/karpenter/pkg/providers/amifamily/bootstrap"
 	"github.com/aws/karpenter/pkg/providers/instancetype"
 	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/project"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/apis/v1alpha5"
+	corecloudprovider "github.com/aws/karpenter-core/pkg/cloudprovider"
 	"github.com/aws/karpenter-core/pkg/controllers/provisioning"
 	"github.com/aws/karpenter-core/pkg/controllers/state"
 	"github.com/aws/karpenter-core/pkg/events"
@@ -89,7 +96,7 @@ var _ = BeforeSuite(func() {
 	awsEnv = test.NewEnvironment(ctx, env)
 
 	fakeClock = &clock.FakeClock{}
-	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider)
+	cloudProvider = cloudprovider.New(ctx, awsEnv.InstanceTypesProvider, awsEnv.InstanceProvider, env.Client, awsEnv.AMIProvider, awsEnv.LaunchTemplateProvider, awsEnv.SubnetProvider, awsEnv.SecurityGroupProvider)
 	cluster = state.NewCluster(fakeClock, env.Client, cloudProvider)
 	prov = provisioning.NewProvisioner(ctx, env.Client, env.KubernetesInterface.CoreV1(), events.NewRecorder(&record.FakeRecorder{}), cloudProvider, cluster)
 })
@@ -203,9 +210,16 @@ var _ = Describe("LaunchTemplates", func() {
 		}
 	})
 	Context("LaunchTemplateName", func() {
+		BeforeEach(func() {
+			awsEnv.EC2API.LaunchTemplates.Store("test-launch-template", &ec2.LaunchTemplate{
+				LaunchTemplateName:  aws.String("test-launch-template"),
+				LaunchTemplateId:    aws.String("lt-0123456789abcdef0"),
+				LatestVersionNumber: aws.Int64(3),
+			})
+			nodeTemplate.Spec.SecurityGroupSelector = nil
+		})
 		It("should allow a launch template to be specified", func() {
 			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
-			nodeTemplate.Spec.SecurityGroupSelector = nil
 			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
 			pod := coretest.UnschedulablePod()
 			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
@@ -216,8 +230,134 @@ var _ = Describe("LaunchTemplates", func() {
 			launchTemplate := input.LaunchTemplateConfigs[0].LaunchTemplateSpecification
 			Expect(*launchTemplate.LaunchTemplateName).To(Equal("test-launch-template"))
 			Expect(*launchTemplate.Version).To(Equal("$Latest"))
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(BeZero())
+		})
+		It("should launch from the pinned version of the launch template", func() {
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
+			nodeTemplate.Spec.LaunchTemplateVersion = aws.String("2")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(input.LaunchTemplateConfigs).To(HaveLen(1))
+			launchTemplate := input.LaunchTemplateConfigs[0].LaunchTemplateSpecification
+			Expect(*launchTemplate.LaunchTemplateName).To(Equal("test-launch-template"))
+			Expect(*launchTemplate.Version).To(Equal("2"))
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(BeZero())
+		})
+		It("should launch from a launch template referenced by its id", func() {
+			nodeTemplate.Spec.LaunchTemplateID = aws.String("lt-0123456789abcdef0")
+			nodeTemplate.Spec.LaunchTemplateVersion = aws.String("$Default")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(input.LaunchTemplateConfigs).To(HaveLen(1))
+			launchTemplate := input.LaunchTemplateConfigs[0].LaunchTemplateSpecification
+			Expect(*launchTemplate.LaunchTemplateName).To(Equal("test-launch-template"))
+			Expect(*launchTemplate.Version).To(Equal("$Default"))
+		})
+		It("should only merge the tags that karpenter requires", func() {
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
+			nodeTemplate.Spec.Tags = map[string]string{"custom-tag": "custom-value"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			for _, tagSpecification := range input.TagSpecifications {
+				keys := lo.Map(tagSpecification.Tags, func(t *ec2.Tag, _ int) string { return aws.StringValue(t.Key) })
+				Expect(keys).To(ContainElements(v1alpha5.ProvisionerNameLabelKey, fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName)))
+				Expect(keys).ToNot(ContainElements("custom-tag", "Name"))
+			}
+		})
+		It("should not launch when the launch template doesn't exist", func() {
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("missing-launch-template")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(BeZero())
+		})
+		It("should not launch when the launch template id doesn't exist", func() {
+			nodeTemplate.Spec.LaunchTemplateID = aws.String("lt-00000000000000000")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(BeZero())
+		})
+		It("should not launch when the pinned version doesn't exist", func() {
+			nodeTemplate.Spec.LaunchTemplateName = aws.String("test-launch-template")
+			nodeTemplate.Spec.LaunchTemplateVersion = aws.String("4")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(BeZero())
 		})
 	})
+	Context("Creation Failures", func() {
+		var backoffClock *clock.FakeClock
+		var creationBackoff *flowcontrol.Backoff
+		var machine *v1alpha5.Machine
+		var instanceTypes []*corecloudprovider.InstanceType
+		BeforeEach(func() {
+			backoffClock = clock.NewFakeClock(time.Now())
+			creationBackoff = awsEnv.LaunchTemplateProvider.CreationBackoff
+			awsEnv.LaunchTemplateProvider.CreationBackoff = flowcontrol.NewFakeBackOff(time.Minute, time.Minute*10, backoffClock)
+			machine = coretest.Machine(v1alpha5.Machine{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{v1alpha5.ProvisionerNameLabelKey: provisioner.Name}},
+			})
+			var err error
+			instanceTypes, err = awsEnv.InstanceTypesProvider.List(ctx, &v1alpha5.KubeletConfiguration{}, nodeTemplate)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			awsEnv.LaunchTemplateProvider.CreationBackoff = creationBackoff
+		})
+		It("should back off creating launch templates after a quota error", func() {
+			awsEnv.EC2API.CreateLaunchTemplateBehavior.Error.Set(awserr.New("LaunchTemplateLimitExceeded", "Launch template limit exceeded.", nil), fake.MaxCalls(0))
+			_, err := awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.FailedCalls()).To(Equal(1))
+
+			// Creation isn't attempted again until the backoff elapses
+			_, err = awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.FailedCalls()).To(Equal(1))
+
+			backoffClock.Step(time.Minute)
+			_, err = awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.FailedCalls()).To(Equal(2))
+
+			// The backoff doubles with every failure and is reset once a launch template is created
+			awsEnv.EC2API.CreateLaunchTemplateBehavior.Error.Reset()
+			backoffClock.Step(time.Minute)
+			_, err = awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+			Expect(err).To(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.SuccessfulCalls()).To(BeZero())
+			backoffClock.Step(time.Minute)
+			launchTemplates, err := awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.SuccessfulCalls()).To(Equal(len(launchTemplates)))
+		})
+		DescribeTable("should not back off creating launch templates after errors other than quota errors",
+			func(code string) {
+				awsEnv.EC2API.CreateLaunchTemplateBehavior.Error.Set(awserr.New(code, "", nil), fake.MaxCalls(1))
+				_, err := awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+				Expect(err).To(HaveOccurred())
+				launchTemplates, err := awsEnv.LaunchTemplateProvider.EnsureAll(ctx, nodeTemplate, machine, instanceTypes, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(awsEnv.EC2API.CreateLaunchTemplateBehavior.SuccessfulCalls()).To(Equal(len(launchTemplates)))
+			},
+			Entry("throttling", "RequestLimitExceeded"),
+			Entry("invalid parameter", "InvalidParameterValue"),
+		)
+	})
 	Context("Cache", func() {
 		It("should use same launch template for equivalent constraints", func() {
 			t1 := v1.Toleration{
@@ -325,6 +465,46 @@ var _ = Describe("LaunchTemplates", func() {
 			node := ExpectScheduled(ctx, env.Client, pod)
 			Expect(node.Labels).To(HaveKeyWithValue(v1alpha1.LabelInstanceAMIID, "ami-123"))
 		})
+		It("should pass custom labels to the kubelet and omit the ones it rejects", func() {
+			provisioner.Spec.Labels = map[string]string{
+				"example.com/team":                   "ml",
+				"node.kubernetes.io/lifecycle":       "batch",
+				"node-restriction.kubernetes.io/pii": "true",
+				"kops.k8s.io/instancegroup":          "nodes",
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			nodeLabels := regexp.MustCompile(`--node-labels=([^\s']+)`).FindStringSubmatch(string(userData))
+			Expect(nodeLabels).To(HaveLen(2))
+			Expect(strings.Split(nodeLabels[1], ",")).To(ContainElements("example.com/team=ml", "node.kubernetes.io/lifecycle=batch"))
+			Expect(nodeLabels[1]).ToNot(ContainSubstring("node-restriction.kubernetes.io"))
+			Expect(nodeLabels[1]).ToNot(ContainSubstring("kops.k8s.io"))
+		})
+		It("should pass custom labels to the kubelet and omit the ones it rejects with Bottlerocket", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+			provisioner.Spec.Labels = map[string]string{
+				"example.com/team":                   "ml",
+				"node-restriction.kubernetes.io/pii": "true",
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			config, err := bootstrap.NewBottlerocketConfig(lo.ToPtr(string(userData)))
+			Expect(err).To(BeNil())
+			Expect(config.Settings.Kubernetes.NodeLabels).To(HaveKeyWithValue("example.com/team", "ml"))
+			Expect(config.Settings.Kubernetes.NodeLabels).ToNot(HaveKey("node-restriction.kubernetes.io/pii"))
+		})
 	})
 	Context("Tags", func() {
 		It("should tag with provisioner name", func() {
@@ -375,6 +555,73 @@ var _ = Describe("LaunchTemplates", func() {
 			Expect(*createFleetInput.TagSpecifications[2].ResourceType).To(Equal(ec2.ResourceTypeFleet))
 			ExpectTags(createFleetInput.TagSpecifications[2].Tags, nodeTemplate.Spec.Tags)
 		})
+		It("should request that tags be applied to instances, volumes and network interfaces", func() {
+			nodeTemplate.Spec.Tags = map[string]string{"cost-center": "team-a"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			tags := map[string]string{
+				"cost-center":                    "team-a",
+				v1alpha5.ProvisionerNameLabelKey: provisioner.Name,
+				fmt.Sprintf("kubernetes.io/cluster/%s", settings.FromContext(ctx).ClusterName): "owned",
+			}
+
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			fleetTags := lo.SliceToMap(createFleetInput.TagSpecifications, func(t *ec2.TagSpecification) (string, []*ec2.Tag) {
+				return aws.StringValue(t.ResourceType), t.Tags
+			})
+			Expect(fleetTags).To(HaveKey(ec2.ResourceTypeInstance))
+			ExpectTags(fleetTags[ec2.ResourceTypeInstance], tags)
+			Expect(fleetTags).To(HaveKey(ec2.ResourceTypeVolume))
+			ExpectTags(fleetTags[ec2.ResourceTypeVolume], tags)
+
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			launchTemplateTags := lo.SliceToMap(input.LaunchTemplateData.TagSpecifications, func(t *ec2.LaunchTemplateTagSpecificationRequest) (string, []*ec2.Tag) {
+				return aws.StringValue(t.ResourceType), t.Tags
+			})
+			Expect(launchTemplateTags).To(HaveKey(ec2.ResourceTypeNetworkInterface))
+			ExpectTags(launchTemplateTags[ec2.ResourceTypeNetworkInterface], tags)
+		})
+		It("should tag instances with the instance discovery tag", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				InstanceDiscoveryTagKey:   lo.ToPtr("example.com/installation"),
+				InstanceDiscoveryTagValue: lo.ToPtr("blue"),
+			}))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(*createFleetInput.TagSpecifications[0].ResourceType).To(Equal(ec2.ResourceTypeInstance))
+			ExpectTags(createFleetInput.TagSpecifications[0].Tags, map[string]string{"example.com/installation": "blue"})
+		})
+		It("should tag instances with the Karpenter version when enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableVersionTag: lo.ToPtr(true)}))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(*createFleetInput.TagSpecifications[0].ResourceType).To(Equal(ec2.ResourceTypeInstance))
+			ExpectTags(createFleetInput.TagSpecifications[0].Tags, map[string]string{v1alpha1.TagVersion: project.Version})
+		})
+		It("should not tag instances with the Karpenter version by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			_, ok := lo.Find(createFleetInput.TagSpecifications[0].Tags, func(t *ec2.Tag) bool {
+				return aws.StringValue(t.Key) == v1alpha1.TagVersion
+			})
+			Expect(ok).To(BeFalse())
+		})
 		It("should override default tag names", func() {
 			// these tags are defaulted, so ensure users can override them
 			nodeTemplate.Spec.Tags = map[string]string{
@@ -463,6 +710,110 @@ var _ = Describe("LaunchTemplates", func() {
 			ExpectTags(createFleetInput.TagSpecifications[2].Tags, nodeTemplate.Spec.Tags)
 			ExpectTagsNotFound(createFleetInput.TagSpecifications[0].Tags, settingsTags)
 		})
+		It("should resolve tag templates on the launched instance", func() {
+			nodeTemplate.Spec.Tags = map[string]string{
+				"static":      "value",
+				"provisioner": fmt.Sprintf("team-a/%s", v1alpha1.TagTemplateProvisionerName),
+				"node":        v1alpha1.TagTemplateNodeName,
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			for _, tagSpecification := range createFleetInput.TagSpecifications {
+				ExpectTags(tagSpecification.Tags, map[string]string{
+					"static":      "value",
+					"provisioner": fmt.Sprintf("team-a/%s", provisioner.Name),
+				})
+				// The node name isn't known until the instance is launched
+				ExpectTagsNotFound(tagSpecification.Tags, map[string]string{"node": v1alpha1.TagTemplateNodeName})
+			}
+			Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(1))
+			createTagsInput := awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Pop()
+			ExpectTags(createTagsInput.Tags, map[string]string{"node": node.Name})
+		})
+		It("should not include templated tags in the launch template", func() {
+			nodeTemplate.Spec.Tags = map[string]string{
+				"static":      "value",
+				"provisioner": v1alpha1.TagTemplateProvisionerName,
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			ExpectTags(input.TagSpecifications[0].Tags, map[string]string{"static": "value"})
+			Expect(lo.ContainsBy(input.TagSpecifications[0].Tags, func(t *ec2.Tag) bool { return *t.Key == "provisioner" })).To(BeFalse())
+			Expect(lo.ContainsBy(input.LaunchTemplateData.TagSpecifications[0].Tags, func(t *ec2.Tag) bool { return *t.Key == "provisioner" })).To(BeFalse())
+		})
+		It("should not tag the instance after launch without node name templates", func() {
+			nodeTemplate.Spec.Tags = map[string]string{"provisioner": v1alpha1.TagTemplateProvisionerName}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateTagsBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+	})
+	Context("Metadata Options", func() {
+		It("should default metadata options to IMDSv2 with a hop limit of 2", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.MetadataOptions).To(Equal(&ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+				HttpEndpoint:            aws.String(ec2.LaunchTemplateInstanceMetadataEndpointStateEnabled),
+				HttpProtocolIpv6:        aws.String(ec2.LaunchTemplateInstanceMetadataProtocolIpv6Disabled),
+				HttpPutResponseHopLimit: aws.Int64(2),
+				HttpTokens:              aws.String(ec2.LaunchTemplateHttpTokensStateRequired),
+				InstanceMetadataTags:    aws.String(ec2.LaunchTemplateInstanceMetadataTagsStateDisabled),
+			}))
+		})
+		It("should apply the metadata options specified in the node template", func() {
+			nodeTemplate.Spec.MetadataOptions = &v1alpha1.MetadataOptions{
+				HTTPEndpoint:            aws.String(ec2.LaunchTemplateInstanceMetadataEndpointStateEnabled),
+				HTTPProtocolIPv6:        aws.String(ec2.LaunchTemplateInstanceMetadataProtocolIpv6Enabled),
+				HTTPPutResponseHopLimit: aws.Int64(1),
+				HTTPTokens:              aws.String(ec2.LaunchTemplateHttpTokensStateOptional),
+				InstanceMetadataTags:    aws.String(ec2.LaunchTemplateInstanceMetadataTagsStateEnabled),
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.MetadataOptions).To(Equal(&ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+				HttpEndpoint:            aws.String(ec2.LaunchTemplateInstanceMetadataEndpointStateEnabled),
+				HttpProtocolIpv6:        aws.String(ec2.LaunchTemplateInstanceMetadataProtocolIpv6Enabled),
+				HttpPutResponseHopLimit: aws.Int64(1),
+				HttpTokens:              aws.String(ec2.LaunchTemplateHttpTokensStateOptional),
+				InstanceMetadataTags:    aws.String(ec2.LaunchTemplateInstanceMetadataTagsStateEnabled),
+			}))
+		})
+		It("should default metadata options that aren't specified in the node template", func() {
+			nodeTemplate.Spec.MetadataOptions = &v1alpha1.MetadataOptions{
+				HTTPPutResponseHopLimit: aws.Int64(1),
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.MetadataOptions).To(Equal(&ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+				HttpEndpoint:            aws.String(ec2.LaunchTemplateInstanceMetadataEndpointStateEnabled),
+				HttpProtocolIpv6:        aws.String(ec2.LaunchTemplateInstanceMetadataProtocolIpv6Disabled),
+				HttpPutResponseHopLimit: aws.Int64(1),
+				HttpTokens:              aws.String(ec2.LaunchTemplateHttpTokensStateRequired),
+				InstanceMetadataTags:    aws.String(ec2.LaunchTemplateInstanceMetadataTagsStateDisabled),
+			}))
+		})
 	})
 	Context("Block Device Mappings", func() {
 		It("should default AL2 block device mappings", func() {
@@ -527,6 +878,111 @@ var _ = Describe("LaunchTemplates", func() {
 				KmsKeyId:            aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"),
 			}))
 		})
+		It("should pass through gp3 throughput and iops", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
+			nodeTemplate.Spec.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{
+				{
+					DeviceName: aws.String("/dev/xvda"),
+					EBS: &v1alpha1.BlockDevice{
+						VolumeType: aws.String("gp3"),
+						VolumeSize: lo.ToPtr(resource.MustParse("100Gi")),
+						IOPS:       aws.Int64(6000),
+						Throughput: aws.Int64(500),
+					},
+				},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs).To(Equal(&ec2.LaunchTemplateEbsBlockDeviceRequest{
+				VolumeSize: aws.Int64(100),
+				VolumeType: aws.String("gp3"),
+				Iops:       aws.Int64(6000),
+				Throughput: aws.Int64(500),
+			}))
+		})
+		It("should encrypt every block device mapping when encryptedByDefault is set", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
+			nodeTemplate.Spec.EncryptedByDefault = aws.Bool(true)
+			nodeTemplate.Spec.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+			nodeTemplate.Spec.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{
+				{
+					DeviceName: aws.String("/dev/xvda"),
+					EBS: &v1alpha1.BlockDevice{
+						VolumeType: aws.String("gp3"),
+						VolumeSize: lo.ToPtr(resource.MustParse("100Gi")),
+					},
+				},
+				{
+					DeviceName: aws.String("/dev/xvdb"),
+					EBS: &v1alpha1.BlockDevice{
+						VolumeType: aws.String("gp3"),
+						VolumeSize: lo.ToPtr(resource.MustParse("200Gi")),
+						KMSKeyID:   aws.String("arn:aws:kms:us-west-2:111122223333:key/other"),
+					},
+				},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.BlockDeviceMappings).To(HaveLen(2))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.Encrypted).To(Equal(aws.Bool(true)))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.KmsKeyId).To(Equal(aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[1].Ebs.Encrypted).To(Equal(aws.Bool(true)))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[1].Ebs.KmsKeyId).To(Equal(aws.String("arn:aws:kms:us-west-2:111122223333:key/other")))
+		})
+		It("should encrypt default block device mappings with the kms key when encryptedByDefault is set", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
+			nodeTemplate.Spec.EncryptedByDefault = aws.Bool(true)
+			nodeTemplate.Spec.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.BlockDeviceMappings).To(HaveLen(1))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.Encrypted).To(Equal(aws.Bool(true)))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.KmsKeyId).To(Equal(aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")))
+		})
+		It("should not encrypt a block device mapping that explicitly disables encryption when encryptedByDefault is set", func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
+			nodeTemplate.Spec.EncryptedByDefault = aws.Bool(true)
+			nodeTemplate.Spec.KMSKeyID = aws.String("arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")
+			nodeTemplate.Spec.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{
+				{
+					DeviceName: aws.String("/dev/xvda"),
+					EBS: &v1alpha1.BlockDevice{
+						VolumeType: aws.String("gp3"),
+						VolumeSize: lo.ToPtr(resource.MustParse("100Gi")),
+					},
+				},
+				{
+					DeviceName: aws.String("/dev/xvdb"),
+					EBS: &v1alpha1.BlockDevice{
+						Encrypted:  aws.Bool(false),
+						VolumeType: aws.String("gp3"),
+						VolumeSize: lo.ToPtr(resource.MustParse("200Gi")),
+					},
+				},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.BlockDeviceMappings).To(HaveLen(2))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.Encrypted).To(Equal(aws.Bool(true)))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[1].Ebs.Encrypted).To(Equal(aws.Bool(false)))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings[1].Ebs.KmsKeyId).To(BeNil())
+		})
 		It("should round up for custom block device mappings when specified in gigabytes", func() {
 			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyAL2
 			nodeTemplate.Spec.BlockDeviceMappings = []*v1alpha1.BlockDeviceMapping{
@@ -866,29 +1322,179 @@ var _ = Describe("LaunchTemplates", func() {
 			Expect(overhead.Memory().String()).To(Equal("1665Mi"))
 		})
 	})
-	Context("User Data", func() {
-		It("should not specify --use-max-pods=false when using ENI-based pod density", func() {
-			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+	Context("Registered AMI Family", func() {
+		BeforeEach(func() {
+			amifamily.Register("TestFamily", func(options *amifamily.Options) amifamily.AMIFamily {
+				return &testFamily{Options: options}
+			})
+			nodeTemplate.Spec.AMIFamily = aws.String("TestFamily")
+		})
+		It("should accept the registered AMI family when validating the node template", func() {
+			Expect(nodeTemplate.Validate(ctx)).To(Succeed())
+		})
+		It("should resolve the AMI and generate the user data with the registered AMI family", func() {
+			kubernetesVersion, err := awsEnv.AMIProvider.KubeServerVersion(ctx)
+			Expect(err).To(BeNil())
+			awsEnv.SSMAPI.Parameters = map[string]string{
+				fmt.Sprintf("/test-family/%s/image_id", kubernetesVersion): "ami-test-family",
+			}
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
 			pod := coretest.UnschedulablePod()
 			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
 			ExpectScheduled(ctx, env.Client, pod)
 			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
 			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.ImageId)).To(Equal("ami-test-family"))
 			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
 			Expect(err).To(BeNil())
-			Expect(string(userData)).NotTo(ContainSubstring("--use-max-pods false"))
+			Expect(string(userData)).To(Equal("#!/bin/bash\n/opt/test-family/join.sh 'test-cluster'"))
+			Expect(input.LaunchTemplateData.BlockDeviceMappings).To(HaveLen(1))
+			Expect(aws.StringValue(input.LaunchTemplateData.BlockDeviceMappings[0].DeviceName)).To(Equal("/dev/sdb"))
 		})
-		It("should specify --use-max-pods=false when not using ENI-based pod density", func() {
-			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
-				EnableENILimitedPodDensity: lo.ToPtr(false),
-			}))
-
-			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
-			pod := coretest.UnschedulablePod()
-			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
-			ExpectScheduled(ctx, env.Client, pod)
-			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
-			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+		It("should compute the resource overhead with the registered AMI family", func() {
+			instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, &v1alpha5.KubeletConfiguration{}, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(instanceTypes).ToNot(BeEmpty())
+			for _, it := range instanceTypes {
+				Expect(it.Overhead.SystemReserved.Memory().String()).To(Equal("1Gi"))
+			}
+		})
+	})
+	Context("Windows", func() {
+		BeforeEach(func() {
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyWindows2022
+			provisioner = test.Provisioner(coretest.ProvisionerOptions{
+				Requirements: []v1.NodeSelectorRequirement{{
+					Key:      v1.LabelOSStable,
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{string(v1.Windows)},
+				}},
+				ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name},
+			})
+		})
+		DescribeTable("should resolve the EKS optimized Windows AMI",
+			func(amiFamily string, version string) {
+				nodeTemplate.Spec.AMIFamily = aws.String(amiFamily)
+				kubernetesVersion, err := awsEnv.AMIProvider.KubeServerVersion(ctx)
+				Expect(err).To(BeNil())
+				awsEnv.SSMAPI.Parameters = map[string]string{
+					fmt.Sprintf("/aws/service/ami-windows-latest/Windows_Server-%s-English-Core-EKS_Optimized-%s/image_id", version, kubernetesVersion): "ami-windows",
+				}
+				ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				Expect(aws.StringValue(input.LaunchTemplateData.ImageId)).To(Equal("ami-windows"))
+			},
+			Entry("Windows2019", v1alpha1.AMIFamilyWindows2019, "2019"),
+			Entry("Windows2022", v1alpha1.AMIFamilyWindows2022, "2022"),
+		)
+		It("should generate a PowerShell script that joins the node to the cluster", func() {
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelOSStable, string(v1.Windows)))
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).To(HavePrefix("<powershell>\n"))
+			Expect(string(userData)).To(HaveSuffix("\n</powershell>"))
+			Expect(string(userData)).To(ContainSubstring(`[string]$EKSBootstrapScriptFile = "$env:ProgramFiles\Amazon\EKS\Start-EKSBootstrap.ps1"`))
+			Expect(string(userData)).To(ContainSubstring("& $EKSBootstrapScriptFile -EKSClusterName 'test-cluster' -APIServerEndpoint 'https://test-cluster' -Base64ClusterCA 'ca-bundle'"))
+			Expect(string(userData)).To(ContainSubstring(fmt.Sprintf("-KubeletExtraArgs '--node-labels=karpenter.sh/capacity-type=on-demand,karpenter.sh/provisioner-name=%s", provisioner.Name)))
+			Expect(string(userData)).ToNot(ContainSubstring("/etc/eks/bootstrap.sh"))
+		})
+		It("should pass kubelet configuration to the bootstrap script", func() {
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
+				MaxPods:    aws.Int32(10),
+				ClusterDNS: []string{"10.0.10.100"},
+			}
+			provisioner.Spec.Taints = []v1.Taint{{Key: "os", Value: "windows", Effect: v1.TaintEffectNoSchedule}}
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{
+				Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}},
+			})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).To(ContainSubstring("--register-with-taints=os=windows:NoSchedule"))
+			Expect(string(userData)).To(ContainSubstring("--max-pods=10'"))
+			Expect(string(userData)).To(ContainSubstring("-DNSClusterIP '10.0.10.100'"))
+		})
+		It("should pass eviction thresholds and pods-per-core to the bootstrap script", func() {
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
+				PodsPerCore: aws.Int32(4),
+				EvictionHard: map[string]string{
+					"nodefs.available": "15%",
+					"memory.available": "500Mi",
+				},
+			}
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).To(ContainSubstring(" --pods-per-core=4 --eviction-hard=memory.available<500Mi,nodefs.available<15%'"))
+		})
+		It("should run custom user data before joining the node to the cluster", func() {
+			nodeTemplate.Spec.UserData = aws.String("<powershell>\nWrite-Host \"Running custom user data script\"\n</powershell>")
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(strings.Count(string(userData), "<powershell>")).To(Equal(1))
+			Expect(strings.Count(string(userData), "</powershell>")).To(Equal(1))
+			Expect(string(userData)).To(HavePrefix("<powershell>\nWrite-Host \"Running custom user data script\"\n[string]$EKSBootstrapScriptFile"))
+		})
+		It("should default to a 50Gi root volume", func() {
+			ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.BlockDeviceMappings).To(HaveLen(1))
+			Expect(aws.StringValue(input.LaunchTemplateData.BlockDeviceMappings[0].DeviceName)).To(Equal("/dev/sda1"))
+			Expect(aws.Int64Value(input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.VolumeSize)).To(BeNumerically("==", 50))
+		})
+	})
+	Context("User Data", func() {
+		It("should not specify --use-max-pods=false when using ENI-based pod density", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).NotTo(ContainSubstring("--use-max-pods false"))
+		})
+		It("should specify --use-max-pods=false when not using ENI-based pod density", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnableENILimitedPodDensity: lo.ToPtr(false),
+			}))
+
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
 			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
 			Expect(err).To(BeNil())
 			Expect(string(userData)).To(ContainSubstring("--use-max-pods false"))
@@ -907,6 +1513,69 @@ var _ = Describe("LaunchTemplates", func() {
 			Expect(string(userData)).To(ContainSubstring("--use-max-pods false"))
 			Expect(string(userData)).To(ContainSubstring("--max-pods=10"))
 		})
+		It("should pass the prefix delegation max-pods for each instance type when prefix delegation is enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnablePrefixDelegation: lo.ToPtr(true),
+			}))
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1.LabelInstanceTypeStable,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{"m5.large", "m5.xlarge", "m5.metal"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			// m5.large and m5.xlarge share a max-pods value of 110, while m5.metal allows 250 pods
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(2))
+			var maxPods []string
+			for awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len() > 0 {
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(ContainSubstring("--use-max-pods false"))
+				maxPods = append(maxPods, regexp.MustCompile(`--max-pods=(\d+)`).FindStringSubmatch(string(userData))[1])
+			}
+			Expect(maxPods).To(ConsistOf("110", "250"))
+		})
+		It("should pass max-pods from the provisioner when prefix delegation is enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnablePrefixDelegation: lo.ToPtr(true),
+			}))
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{MaxPods: aws.Int32(10)}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).To(ContainSubstring("--max-pods=10"))
+		})
+		It("should set max-pods in the Bottlerocket settings when prefix delegation is enabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnablePrefixDelegation: lo.ToPtr(true),
+			}))
+			nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+			provisioner.Spec.Requirements = append(provisioner.Spec.Requirements, v1.NodeSelectorRequirement{
+				Key:      v1.LabelInstanceTypeStable,
+				Operator: v1.NodeSelectorOpIn,
+				Values:   []string{"m5.large"},
+			})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			config := &bootstrap.BottlerocketConfig{}
+			Expect(config.UnmarshalTOML(userData)).To(Succeed())
+			Expect(config.Settings.Kubernetes.MaxPods).ToNot(BeNil())
+			Expect(*config.Settings.Kubernetes.MaxPods).To(BeNumerically("==", 110))
+		})
 		It("should specify --system-reserved when overriding system reserved values", func() {
 			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
 				SystemReserved: v1.ResourceList{
@@ -933,6 +1602,32 @@ var _ = Describe("LaunchTemplates", func() {
 				Expect(rem[:i]).To(ContainSubstring(fmt.Sprintf("%v=%v", k.String(), v.String())))
 			}
 		})
+		It("should specify --system-reserved and --kube-reserved when configured in settings", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				SystemReserved: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("500m"),
+					v1.ResourceMemory: resource.MustParse("1Gi"),
+				},
+				KubeReserved: v1.ResourceList{
+					v1.ResourceEphemeralStorage: resource.MustParse("2Gi"),
+				},
+			}))
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
+				SystemReserved: v1.ResourceList{
+					v1.ResourceMemory: resource.MustParse("2Gi"),
+				},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+			Expect(string(userData)).To(ContainSubstring("--system-reserved=cpu=500m,memory=2Gi"))
+			Expect(string(userData)).To(ContainSubstring("--kube-reserved=ephemeral-storage=2Gi"))
+		})
 		It("should specify --kube-reserved when overriding system reserved values", func() {
 			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
 				KubeReserved: v1.ResourceList{
@@ -1052,6 +1747,56 @@ var _ = Describe("LaunchTemplates", func() {
 
 			Expect(string(userData)).To(ContainSubstring(fmt.Sprintf("--eviction-max-pod-grace-period=%d", 300)))
 		})
+		It("should render eviction thresholds with their exact values in a stable order", func() {
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
+				EvictionHard: map[string]string{
+					"nodefs.inodesFree": "5%",
+					"memory.available":  "500Mi",
+					"nodefs.available":  "15%",
+				},
+				EvictionSoft: map[string]string{
+					"nodefs.available": "20%",
+					"memory.available": "1Gi",
+				},
+				EvictionSoftGracePeriod: map[string]metav1.Duration{
+					"nodefs.available": {Duration: time.Minute * 2},
+					"memory.available": {Duration: time.Minute},
+				},
+				EvictionMaxPodGracePeriod: aws.Int32(60),
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+
+			Expect(string(userData)).To(ContainSubstring(" --eviction-hard=memory.available<500Mi,nodefs.available<15%,nodefs.inodesFree<5%" +
+				" --eviction-soft=memory.available<1Gi,nodefs.available<20%" +
+				" --eviction-soft-grace-period=memory.available=1m0s,nodefs.available=2m0s" +
+				" --eviction-max-pod-grace-period=60"))
+		})
+		It("should pass --max-pods alongside kubelet overrides when not using ENI-based pod density", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnableENILimitedPodDensity: lo.ToPtr(false),
+			}))
+			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
+				EvictionHard: map[string]string{"memory.available": "10%"},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+			Expect(err).To(BeNil())
+
+			Expect(string(userData)).To(ContainSubstring("--use-max-pods false"))
+			Expect(string(userData)).To(ContainSubstring(" --max-pods=110 --eviction-hard=memory.available<10%'"))
+		})
 		It("should specify --pods-per-core", func() {
 			provisioner.Spec.KubeletConfiguration = &v1alpha5.KubeletConfiguration{
 				PodsPerCore: aws.Int32(2),
@@ -1191,6 +1936,65 @@ var _ = Describe("LaunchTemplates", func() {
 			Expect(err).To(BeNil())
 			Expect(string(userData)).To(ContainSubstring("--image-gc-low-threshold=50"))
 		})
+		Context("Node Template Startup Taints", func() {
+			BeforeEach(func() {
+				provisioner.Spec.Taints = []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoExecute}}
+				provisioner.Spec.StartupTaints = []v1.Taint{{Key: "baz", Value: "bin", Effect: v1.TaintEffectNoExecute}}
+			})
+			It("should register nodes with the startup taints of the node template and the taints of the provisioner", func() {
+				nodeTemplate.Spec.StartupTaints = []v1.Taint{{Key: "example.com/agent", Value: "not-ready", Effect: v1.TaintEffectNoSchedule}}
+				ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+				pod := coretest.UnschedulablePod(coretest.PodOptions{
+					Tolerations: []v1.Toleration{{Key: "foo", Operator: v1.TolerationOpExists}},
+				})
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(ContainSubstring("--register-with-taints=foo=bar:NoExecute,baz=bin:NoExecute,example.com/agent=not-ready:NoSchedule"))
+			})
+			It("should not register nodes with a startup taint of the node template that the provisioner already has", func() {
+				nodeTemplate.Spec.StartupTaints = []v1.Taint{
+					{Key: "foo", Value: "other", Effect: v1.TaintEffectNoExecute},
+					{Key: "baz", Value: "bin", Effect: v1.TaintEffectNoExecute},
+					{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule},
+				}
+				ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+				pod := coretest.UnschedulablePod(coretest.PodOptions{
+					Tolerations: []v1.Toleration{{Key: "foo", Operator: v1.TolerationOpExists}},
+				})
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(MatchRegexp("--register-with-taints=foo=bar:NoExecute,baz=bin:NoExecute,foo=bar:NoSchedule[ ']"))
+			})
+			It("should register Bottlerocket nodes with the startup taints of the node template", func() {
+				nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+				nodeTemplate.Spec.StartupTaints = []v1.Taint{{Key: "example.com/agent", Value: "not-ready", Effect: v1.TaintEffectNoSchedule}}
+				ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+				pod := coretest.UnschedulablePod(coretest.PodOptions{
+					Tolerations: []v1.Toleration{{Key: "foo", Operator: v1.TolerationOpExists}},
+				})
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				config := &bootstrap.BottlerocketConfig{}
+				Expect(config.UnmarshalTOML(userData)).To(Succeed())
+				Expect(config.Settings.Kubernetes.NodeTaints).To(Equal(map[string][]string{
+					"foo":               {"bar:NoExecute"},
+					"baz":               {"bin:NoExecute"},
+					"example.com/agent": {"not-ready:NoSchedule"},
+				}))
+			})
+		})
 		Context("Bottlerocket", func() {
 			It("should merge in custom user data", func() {
 				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
@@ -1381,6 +2185,62 @@ var _ = Describe("LaunchTemplates", func() {
 				Expect(config.Settings.Kubernetes.MaxPods).ToNot(BeNil())
 				Expect(*config.Settings.Kubernetes.MaxPods).To(BeNumerically("==", 10))
 			})
+			It("should merge custom settings and kubelet configuration into a single toml document", func() {
+				nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+				nodeTemplate.Spec.UserData = aws.String(`
+[settings.host-containers.admin]
+enabled = true
+
+[settings.host-containers.control]
+enabled = false
+
+[settings.kernel.sysctl]
+"vm.max_map_count" = "262144"
+
+[settings.kubernetes]
+cluster-name = 'replaceme'
+
+[settings.kubernetes.eviction-hard]
+"memory.available" = "12%"
+`)
+				provisioner = test.Provisioner(coretest.ProvisionerOptions{
+					ProviderRef: &v1alpha5.ProviderRef{
+						Name: nodeTemplate.Name,
+					},
+					Kubelet: &v1alpha5.KubeletConfiguration{
+						MaxPods:                     aws.Int32(10),
+						ImageGCHighThresholdPercent: aws.Int32(80),
+					},
+				})
+				ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(strings.Count(string(userData), "[settings.kubernetes]")).To(Equal(1))
+				config := &bootstrap.BottlerocketConfig{}
+				Expect(config.UnmarshalTOML(userData)).To(Succeed())
+
+				// Karpenter's required settings win over the custom user data
+				Expect(aws.StringValue(config.Settings.Kubernetes.ClusterName)).To(Equal("test-cluster"))
+				Expect(aws.StringValue(config.Settings.Kubernetes.APIServer)).To(Equal("https://test-cluster"))
+				Expect(*config.Settings.Kubernetes.MaxPods).To(BeNumerically("==", 10))
+				Expect(*config.Settings.Kubernetes.ImageGCHighThresholdPercent).To(BeNumerically("==", 80))
+				Expect(string(userData)).To(ContainSubstring("image-gc-high-threshold-percent = 80"))
+
+				// Custom settings the provisioner doesn't configure are kept
+				Expect(config.Settings.Kubernetes.EvictionHard).To(Equal(map[string]string{"memory.available": "12%"}))
+				Expect(config.SettingsRaw).To(HaveKeyWithValue("host-containers", map[string]interface{}{
+					"admin":   map[string]interface{}{"enabled": true},
+					"control": map[string]interface{}{"enabled": false},
+				}))
+				Expect(config.SettingsRaw).To(HaveKeyWithValue("kernel", map[string]interface{}{
+					"sysctl": map[string]interface{}{"vm.max_map_count": "262144"},
+				}))
+			})
 		})
 		Context("AL2 Custom UserData", func() {
 			It("should merge in custom user data", func() {
@@ -1450,15 +2310,184 @@ var _ = Describe("LaunchTemplates", func() {
 				Expect(expectedUserData).To(Equal(string(userData)))
 			})
 		})
-		Context("Custom AMI Selector", func() {
-			It("should use ami selector specified in AWSNodeTemplate", func() {
-				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
-				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
-					{
-						ImageId:      aws.String("ami-123"),
-						Architecture: aws.String("x86_64"),
-						CreationDate: aws.String("2022-08-15T12:00:00Z")},
-				}})
+		Context("User Data Mode", func() {
+			BeforeEach(func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					EnableENILimitedPodDensity: lo.ToPtr(false),
+				}))
+			})
+			It("should merge custom shell script user data with the AL2 bootstrap script in Merge mode", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeMerge)
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(ContainSubstring(`echo "Running custom user data script"`))
+				Expect(string(userData)).To(ContainSubstring("/etc/eks/bootstrap.sh 'test-cluster'"))
+			})
+			It("should merge custom MIME multipart user data with the AL2 bootstrap script in Merge mode", func() {
+				content, err := os.ReadFile("testdata/al2_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeMerge)
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(ContainSubstring(`echo "Running custom user data script"`))
+				Expect(string(userData)).To(ContainSubstring("/etc/eks/bootstrap.sh 'test-cluster'"))
+			})
+			It("should merge custom user data with the Bottlerocket settings in Merge mode", func() {
+				content, err := os.ReadFile("testdata/br_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeMerge)
+				nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+				ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				config := &bootstrap.BottlerocketConfig{}
+				Expect(config.UnmarshalTOML(userData)).To(Succeed())
+				Expect(config.Settings.Kubernetes.APIServer).To(Equal(aws.String("https://test-cluster")))
+				Expect(config.Settings.Kubernetes.ClusterName).To(Equal(aws.String("test-cluster")))
+				Expect(string(userData)).To(ContainSubstring("time-servers = ['169.254.169.123']"))
+				Expect(string(userData)).To(ContainSubstring("hostname = 'test.local'"))
+			})
+			It("should pass AL2 custom user data through untouched in Override mode", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(Equal(string(content)))
+			})
+			It("should pass Bottlerocket custom user data through untouched in Override mode", func() {
+				content, err := os.ReadFile("testdata/br_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+				ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				Expect(err).To(BeNil())
+				Expect(string(userData)).To(Equal(string(content)))
+			})
+		})
+		Context("User Data Encoding", func() {
+			BeforeEach(func() {
+				ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+					EnableENILimitedPodDensity: lo.ToPtr(false),
+				}))
+			})
+			// launchTemplateUserData provisions a node with the node template and returns its user data, decoded once
+			launchTemplateUserData := func() string {
+				ExpectApplied(ctx, env.Client, nodeTemplate, provisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				ExpectWithOffset(1, awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				userData, err := base64.StdEncoding.DecodeString(*input.LaunchTemplateData.UserData)
+				ExpectWithOffset(1, err).To(BeNil())
+				return string(userData)
+			}
+			It("should encode plain text user data once", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				Expect(launchTemplateUserData()).To(Equal(string(content)))
+			})
+			It("should encode plain text user data once when the encoding is None", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(string(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				nodeTemplate.Spec.UserDataEncoding = aws.String(v1alpha1.UserDataEncodingNone)
+				Expect(launchTemplateUserData()).To(Equal(string(content)))
+			})
+			It("should not encode base64 encoded user data twice", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(base64.StdEncoding.EncodeToString(content))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				nodeTemplate.Spec.UserDataEncoding = aws.String(v1alpha1.UserDataEncodingBase64)
+				Expect(launchTemplateUserData()).To(Equal(string(content)))
+			})
+			It("should decode base64 encoded user data that's wrapped across lines", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				encoded := base64.StdEncoding.EncodeToString(content)
+				nodeTemplate.Spec.UserData = aws.String(strings.Join(lo.ChunkString(encoded, 76), "\n"))
+				nodeTemplate.Spec.UserDataMode = aws.String(v1alpha1.UserDataModeOverride)
+				nodeTemplate.Spec.UserDataEncoding = aws.String(v1alpha1.UserDataEncodingBase64)
+				Expect(launchTemplateUserData()).To(Equal(string(content)))
+			})
+			It("should merge base64 encoded user data with the AL2 bootstrap script", func() {
+				content, err := os.ReadFile("testdata/al2_no_mime_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(base64.StdEncoding.EncodeToString(content))
+				nodeTemplate.Spec.UserDataEncoding = aws.String(v1alpha1.UserDataEncodingBase64)
+				userData := launchTemplateUserData()
+				Expect(userData).To(ContainSubstring(`echo "Running custom user data script"`))
+				Expect(userData).To(ContainSubstring("/etc/eks/bootstrap.sh 'test-cluster'"))
+			})
+			It("should merge base64 encoded user data with the Bottlerocket settings", func() {
+				content, err := os.ReadFile("testdata/br_userdata_input.golden")
+				Expect(err).To(BeNil())
+				nodeTemplate.Spec.UserData = aws.String(base64.StdEncoding.EncodeToString(content))
+				nodeTemplate.Spec.UserDataEncoding = aws.String(v1alpha1.UserDataEncodingBase64)
+				nodeTemplate.Spec.AMIFamily = &v1alpha1.AMIFamilyBottlerocket
+				userData := launchTemplateUserData()
+				config := &bootstrap.BottlerocketConfig{}
+				Expect(config.UnmarshalTOML([]byte(userData))).To(Succeed())
+				Expect(config.Settings.Kubernetes.ClusterName).To(Equal(aws.String("test-cluster")))
+				Expect(userData).To(ContainSubstring("hostname = 'test.local'"))
+			})
+		})
+		Context("Custom AMI Selector", func() {
+			It("should use ami selector specified in AWSNodeTemplate", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						ImageId:      aws.String("ami-123"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z")},
+				}})
 				ExpectApplied(ctx, env.Client, nodeTemplate)
 				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
 				ExpectApplied(ctx, env.Client, newProvisioner)
@@ -1469,6 +2498,191 @@ var _ = Describe("LaunchTemplates", func() {
 				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
 				Expect("ami-123").To(Equal(*input.LaunchTemplateData.ImageId))
 			})
+			It("should use the ami from the ssm parameter specified in the ami selector", func() {
+				awsEnv.SSMAPI.Parameters = map[string]string{"/my-org/eks/al2/latest": "ami-123"}
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::ssm": "/my-org/eks/al2/latest"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						ImageId:      aws.String("ami-123"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z")},
+				}})
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+				Expect("ami-123").To(Equal(*input.LaunchTemplateData.ImageId))
+				actualFilter := awsEnv.EC2API.CalledWithDescribeImagesInput.Pop().Filters
+				Expect(actualFilter).To(Equal([]*ec2.Filter{
+					{
+						Name:   aws.String("image-id"),
+						Values: aws.StringSlice([]string{"ami-123"}),
+					},
+				}))
+			})
+			It("should not launch with the default amis when the ssm parameter in the ami selector doesn't exist", func() {
+				awsEnv.SSMAPI.Parameters = map[string]string{}
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::ssm": "/my-org/eks/al2/missing"}
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectNotScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithDescribeImagesInput.Len()).To(Equal(0))
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(0))
+			})
+			It("should select the newest ami matching a name wildcard, including amis shared from another account", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::name": "my-eks-node-*", "aws::owners": "self,123456789012"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						Name:         aws.String("my-eks-node-1"),
+						ImageId:      aws.String("ami-123"),
+						OwnerId:      aws.String("000000000000"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-10T12:00:00Z"),
+					},
+					{
+						Name:         aws.String("my-eks-node-3"),
+						ImageId:      aws.String("ami-789"),
+						OwnerId:      aws.String("123456789012"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-20T12:00:00Z"),
+					},
+					{
+						Name:         aws.String("my-eks-node-2"),
+						ImageId:      aws.String("ami-456"),
+						OwnerId:      aws.String("000000000000"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z"),
+					},
+				}})
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				input := awsEnv.EC2API.CalledWithDescribeImagesInput.Pop()
+				Expect(input.Owners).To(ConsistOf(aws.String("self"), aws.String("123456789012")))
+				Expect(input.Filters).To(ConsistOf(&ec2.Filter{
+					Name:   aws.String("name"),
+					Values: aws.StringSlice([]string{"my-eks-node-*"}),
+				}))
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				Expect(*awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop().LaunchTemplateData.ImageId).To(Equal("ami-789"))
+			})
+			It("should discover amis shared from another account when the account is an owner", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::name": "shared-eks-node", "aws::owners": "111122223333"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						Name:         aws.String("shared-eks-node"),
+						ImageId:      aws.String("ami-shared"),
+						OwnerId:      aws.String("111122223333"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z"),
+					},
+				}})
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithDescribeImagesInput.Pop().Owners).To(ConsistOf(aws.String("111122223333")))
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				Expect(*awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop().LaunchTemplateData.ImageId).To(Equal("ami-shared"))
+			})
+			It("should not discover amis shared from another account when owners aren't specified", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::name": "shared-eks-node"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						Name:         aws.String("shared-eks-node"),
+						ImageId:      aws.String("ami-shared"),
+						OwnerId:      aws.String("111122223333"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z"),
+					},
+				}})
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectNotScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithDescribeImagesInput.Pop().Owners).To(ConsistOf(aws.String("self"), aws.String("amazon")))
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(0))
+			})
+			It("should break ties on creation date by image id when selecting by name wildcard", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"aws::name": "my-eks-node-*"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						Name:         aws.String("my-eks-node-b"),
+						ImageId:      aws.String("ami-456"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z"),
+					},
+					{
+						Name:         aws.String("my-eks-node-a"),
+						ImageId:      aws.String("ami-123"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z"),
+					},
+					{
+						Name:         aws.String("my-eks-node-old"),
+						ImageId:      aws.String("ami-000"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-01T12:00:00Z"),
+					},
+				}})
+				ExpectApplied(ctx, env.Client, nodeTemplate)
+				newProvisioner := test.Provisioner(coretest.ProvisionerOptions{ProviderRef: &v1alpha5.ProviderRef{Name: nodeTemplate.Name}})
+				ExpectApplied(ctx, env.Client, newProvisioner)
+				pod := coretest.UnschedulablePod()
+				ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+				ExpectScheduled(ctx, env.Client, pod)
+				Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+				Expect(*awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop().LaunchTemplateData.ImageId).To(Equal("ami-123"))
+			})
+			It("should not call DescribeImages again for the same ami selector within the cache TTL", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						ImageId:      aws.String("ami-123"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z")},
+				}})
+				instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, &v1alpha5.KubeletConfiguration{}, nodeTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				amiFamily := amifamily.GetAMIFamily(nodeTemplate.Spec.AMIFamily, &amifamily.Options{})
+				_, err = awsEnv.AMIProvider.Get(ctx, nodeTemplate, instanceTypes, amiFamily)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = awsEnv.AMIProvider.Get(ctx, nodeTemplate, instanceTypes, amiFamily)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(awsEnv.EC2API.CalledWithDescribeImagesInput.Len()).To(Equal(1))
+			})
+			It("should call DescribeImages again when the ami selector changes", func() {
+				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
+				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+					{
+						ImageId:      aws.String("ami-123"),
+						Architecture: aws.String("x86_64"),
+						CreationDate: aws.String("2022-08-15T12:00:00Z")},
+				}})
+				instanceTypes, err := awsEnv.InstanceTypesProvider.List(ctx, &v1alpha5.KubeletConfiguration{}, nodeTemplate)
+				Expect(err).ToNot(HaveOccurred())
+				amiFamily := amifamily.GetAMIFamily(nodeTemplate.Spec.AMIFamily, &amifamily.Options{})
+				_, err = awsEnv.AMIProvider.Get(ctx, nodeTemplate, instanceTypes, amiFamily)
+				Expect(err).ToNot(HaveOccurred())
+				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster", "aws::owners": "self"}
+				_, err = awsEnv.AMIProvider.Get(ctx, nodeTemplate, instanceTypes, amiFamily)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(awsEnv.EC2API.CalledWithDescribeImagesInput.Len()).To(Equal(2))
+			})
 			It("should copy over userData untouched when AMIFamily is Custom", func() {
 				nodeTemplate.Spec.UserData = aws.String("special user data")
 				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
@@ -1593,6 +2807,84 @@ var _ = Describe("LaunchTemplates", func() {
 				Expect("ami-456").To(Equal(*input.LaunchTemplateData.ImageId))
 			})
 
+			Context("Architecture", func() {
+				BeforeEach(func() {
+					awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+						{
+							ImageId:      aws.String("ami-amd64"),
+							Architecture: aws.String("x86_64"),
+							CreationDate: aws.String("2022-01-01T12:00:00Z"),
+						},
+						{
+							ImageId:      aws.String("ami-arm64"),
+							Architecture: aws.String("arm64"),
+							CreationDate: aws.String("2022-01-01T12:00:00Z"),
+						},
+					}})
+					nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
+				})
+				// launchedImages returns the AMI of each launch template that the instance types were launched with
+				launchedImages := func() map[string]string {
+					images := map[string]string{}
+					for awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len() > 0 {
+						input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+						images[aws.StringValue(input.LaunchTemplateName)] = aws.StringValue(input.LaunchTemplateData.ImageId)
+					}
+					result := map[string]string{}
+					for awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len() > 0 {
+						for _, ltc := range awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop().LaunchTemplateConfigs {
+							for _, override := range ltc.Overrides {
+								result[aws.StringValue(override.InstanceType)] = images[aws.StringValue(ltc.LaunchTemplateSpecification.LaunchTemplateName)]
+							}
+						}
+					}
+					return result
+				}
+				It("should pair each instance type with an AMI of its architecture", func() {
+					provisioner.Spec.Requirements = []v1.NodeSelectorRequirement{
+						{Key: v1.LabelInstanceTypeStable, Operator: v1.NodeSelectorOpIn, Values: []string{"m5.large", "c6g.large"}},
+					}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectScheduled(ctx, env.Client, pod)
+					images := launchedImages()
+					Expect(images).To(HaveKeyWithValue("m5.large", "ami-amd64"))
+					Expect(images).To(HaveKeyWithValue("c6g.large", "ami-arm64"))
+				})
+				It("should launch an arm64 instance type with the arm64 AMI", func() {
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelArchStable: v1alpha5.ArchitectureArm64}})
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					node := ExpectScheduled(ctx, env.Client, pod)
+					Expect(node.Labels).To(HaveKeyWithValue(v1.LabelArchStable, v1alpha5.ArchitectureArm64))
+					Expect(lo.Uniq(lo.Values(launchedImages()))).To(ConsistOf("ami-arm64"))
+				})
+				It("should launch an amd64 instance type with the amd64 AMI", func() {
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelArchStable: v1alpha5.ArchitectureAmd64}})
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					node := ExpectScheduled(ctx, env.Client, pod)
+					Expect(node.Labels).To(HaveKeyWithValue(v1.LabelArchStable, v1alpha5.ArchitectureAmd64))
+					Expect(lo.Uniq(lo.Values(launchedImages()))).To(ConsistOf("ami-amd64"))
+				})
+				It("should not offer instance types without an AMI of their architecture", func() {
+					awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{
+						{ImageId: aws.String("ami-amd64"), Architecture: aws.String("x86_64"), CreationDate: aws.String("2022-01-01T12:00:00Z")},
+					}})
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					instanceTypes, err := cloudProvider.GetInstanceTypes(ctx, provisioner)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(instanceTypes).ToNot(BeEmpty())
+					for _, it := range instanceTypes {
+						Expect(it.Requirements.Get(v1.LabelArchStable).Has(v1alpha5.ArchitectureAmd64)).To(BeTrue())
+					}
+					pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelArchStable: v1alpha5.ArchitectureArm64}})
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectNotScheduled(ctx, env.Client, pod)
+					Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(0))
+				})
+			})
 			It("should fail if no amis match selector.", func() {
 				awsEnv.EC2API.DescribeImagesOutput.Set(&ec2.DescribeImagesOutput{Images: []*ec2.Image{}})
 				nodeTemplate.Spec.AMISelector = map[string]string{"karpenter.sh/discovery": "my-cluster"}
@@ -1662,6 +2954,84 @@ var _ = Describe("LaunchTemplates", func() {
 				input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
 				Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("overridden-profile"))
 			})
+			Context("Instance Profile Selector", func() {
+				BeforeEach(func() {
+					awsEnv.IAMAPI.ListInstanceProfilesBehavior.Output.Set(&iam.ListInstanceProfilesOutput{
+						InstanceProfiles: []*iam.InstanceProfile{
+							{
+								InstanceProfileName: aws.String("test-profile-gpu"),
+								Roles:               []*iam.Role{{RoleName: aws.String("test-role-gpu")}},
+								Tags:                []*iam.Tag{{Key: aws.String("team"), Value: aws.String("ml")}, {Key: aws.String("tier"), Value: aws.String("gpu")}},
+							},
+							{
+								InstanceProfileName: aws.String("test-profile-default"),
+								Roles:               []*iam.Role{{RoleName: aws.String("test-role-default")}},
+								Tags:                []*iam.Tag{{Key: aws.String("team"), Value: aws.String("ml")}},
+							},
+							{
+								InstanceProfileName: aws.String("test-profile-web"),
+								Roles:               []*iam.Role{{RoleName: aws.String("test-role-web")}},
+								Tags:                []*iam.Tag{{Key: aws.String("team"), Value: aws.String("web")}},
+							},
+						},
+					})
+				})
+				It("should use the instance profile matching the tags", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"team": "web"}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectScheduled(ctx, env.Client, pod)
+					Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+					input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+					Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("test-profile-web"))
+				})
+				It("should use the instance profile matching every tag", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"team": "ml", "tier": "*"}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectScheduled(ctx, env.Client, pod)
+					input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+					Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("test-profile-gpu"))
+				})
+				It("should use the instance profile whose name sorts first when several match", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"team": "ml"}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectScheduled(ctx, env.Client, pod)
+					input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+					Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("test-profile-default"))
+				})
+				It("should use the instance profile containing the role without listing tags", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"aws::roles": "test-role-gpu,test-role-missing"}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectScheduled(ctx, env.Client, pod)
+					input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+					Expect(*input.LaunchTemplateData.IamInstanceProfile.Name).To(Equal("test-profile-gpu"))
+					Expect(awsEnv.IAMAPI.ListInstanceProfileTagsBehavior.Calls()).To(Equal(0))
+				})
+				It("should not launch when no instance profile matches", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"team": "data"}
+					ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+					pod := coretest.UnschedulablePod()
+					ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+					ExpectNotScheduled(ctx, env.Client, pod)
+					Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(0))
+				})
+				It("should cache the resolved instance profile", func() {
+					nodeTemplate.Spec.InstanceProfileSelector = map[string]string{"team": "web"}
+					for i := 0; i < 2; i++ {
+						name, err := awsEnv.InstanceProfileProvider.Get(ctx, nodeTemplate)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(name).To(Equal("test-profile-web"))
+					}
+					Expect(awsEnv.IAMAPI.ListInstanceProfilesBehavior.Calls()).To(Equal(1))
+				})
+			})
 		})
 	})
 	Context("Detailed Monitoring", func() {
@@ -1687,6 +3057,282 @@ var _ = Describe("LaunchTemplates", func() {
 			Expect(aws.BoolValue(input.LaunchTemplateData.Monitoring.Enabled)).To(BeTrue())
 		})
 	})
+	Context("Key Name", func() {
+		It("should not set a key name by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.KeyName).To(BeNil())
+		})
+		It("should pass the key name to the launch template at creation", func() {
+			nodeTemplate.Spec.KeyName = aws.String("my-key-pair")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.KeyName)).To(Equal("my-key-pair"))
+		})
+	})
+	Context("Placement", func() {
+		It("should not set a placement group by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.Placement).To(BeNil())
+		})
+		It("should pass the placement group to the launch template at creation", func() {
+			nodeTemplate.Spec.Placement = &v1alpha1.Placement{GroupName: "my-group", Strategy: v1alpha1.PlacementStrategyCluster}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.GroupName)).To(Equal("my-group"))
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(1))
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			Expect(aws.StringValue(createFleetInput.LaunchTemplateConfigs[0].LaunchTemplateSpecification.LaunchTemplateName)).To(Equal(aws.StringValue(input.LaunchTemplateName)))
+		})
+		It("should not launch instance types that don't support cluster placement groups", func() {
+			nodeTemplate.Spec.Placement = &v1alpha1.Placement{GroupName: "my-group", Strategy: v1alpha1.PlacementStrategyCluster}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelInstanceTypeStable: "t3.large"}})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectNotScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Len()).To(Equal(0))
+		})
+		It("should exclude instance types that don't support cluster placement groups from the fleet request", func() {
+			nodeTemplate.Spec.Placement = &v1alpha1.Placement{GroupName: "my-group", Strategy: v1alpha1.PlacementStrategyCluster}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			createFleetInput := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			for _, ltc := range createFleetInput.LaunchTemplateConfigs {
+				for _, override := range ltc.Overrides {
+					Expect(aws.StringValue(override.InstanceType)).ToNot(Equal("t3.large"))
+				}
+			}
+		})
+		It("should launch instance types that support spread placement groups", func() {
+			nodeTemplate.Spec.Placement = &v1alpha1.Placement{GroupName: "my-group", Strategy: v1alpha1.PlacementStrategySpread}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelInstanceTypeStable: "t3.large"}})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			node := ExpectScheduled(ctx, env.Client, pod)
+			Expect(node.Labels).To(HaveKeyWithValue(v1.LabelInstanceTypeStable, "t3.large"))
+		})
+	})
+	Context("Network Interfaces", func() {
+		It("should pass secondary network interfaces to the launch template at creation", func() {
+			nodeTemplate.Spec.NetworkInterfaces = []v1alpha1.NetworkInterface{
+				{DeviceIndex: 1, SubnetID: "subnet-test1"},
+				{DeviceIndex: 2, SubnetID: "subnet-test2", SecurityGroupIDs: []string{"sg-test4"}},
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).To(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(HaveLen(3))
+
+			primary := input.LaunchTemplateData.NetworkInterfaces[0]
+			Expect(aws.Int64Value(primary.DeviceIndex)).To(BeZero())
+			Expect(primary.InterfaceType).To(BeNil())
+			Expect(primary.SubnetId).To(BeNil())
+			Expect(primary.Groups).ToNot(BeEmpty())
+
+			secondary := input.LaunchTemplateData.NetworkInterfaces[1]
+			Expect(aws.Int64Value(secondary.DeviceIndex)).To(BeNumerically("==", 1))
+			Expect(aws.StringValue(secondary.SubnetId)).To(Equal("subnet-test1"))
+			Expect(secondary.Groups).To(Equal(primary.Groups))
+			Expect(aws.BoolValue(secondary.DeleteOnTermination)).To(BeTrue())
+
+			tertiary := input.LaunchTemplateData.NetworkInterfaces[2]
+			Expect(aws.Int64Value(tertiary.DeviceIndex)).To(BeNumerically("==", 2))
+			Expect(aws.StringValue(tertiary.SubnetId)).To(Equal("subnet-test2"))
+			Expect(aws.StringValueSlice(tertiary.Groups)).To(ConsistOf("sg-test4"))
+		})
+		It("should not pass network interfaces to the launch template by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).ToNot(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(BeEmpty())
+		})
+	})
+	Context("IPv6-Only Subnets", func() {
+		ipv6Subnet := func(id, zone string) *ec2.Subnet {
+			return &ec2.Subnet{SubnetId: aws.String(id), AvailabilityZone: aws.String(zone), AvailableIpAddressCount: aws.Int64(0), Ipv6Native: aws.Bool(true),
+				Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(id)}}}
+		}
+		BeforeEach(func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				ipv6Subnet("subnet-ipv6-1", "test-zone-1a"),
+				ipv6Subnet("subnet-ipv6-2", "test-zone-1b"),
+			}})
+		})
+		It("should assign an IPv6 address to the primary network interface", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).To(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(HaveLen(1))
+			primary := input.LaunchTemplateData.NetworkInterfaces[0]
+			Expect(aws.Int64Value(primary.DeviceIndex)).To(BeZero())
+			Expect(aws.Int64Value(primary.Ipv6AddressCount)).To(BeNumerically("==", 1))
+			Expect(primary.PrivateIpAddress).To(BeNil())
+			Expect(primary.SecondaryPrivateIpAddressCount).To(BeNil())
+			Expect(primary.Groups).ToNot(BeEmpty())
+		})
+		It("should name instances after their resource name by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.PrivateDnsNameOptions.HostnameType)).To(Equal(ec2.HostnameTypeResourceName))
+			Expect(aws.BoolValue(input.LaunchTemplateData.PrivateDnsNameOptions.EnableResourceNameDnsAAAARecord)).To(BeTrue())
+		})
+		It("should keep the private DNS name options of the node template", func() {
+			nodeTemplate.Spec.PrivateDNSNameOptions = &v1alpha1.PrivateDNSNameOptions{
+				HostnameType:                    aws.String(v1alpha1.HostnameTypeResourceName),
+				EnableResourceNameDNSAAAARecord: aws.Bool(false),
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.BoolValue(input.LaunchTemplateData.PrivateDnsNameOptions.EnableResourceNameDnsAAAARecord)).To(BeFalse())
+		})
+		It("should assign an IPv6 address along with an EFA", func() {
+			nodeTemplate.Spec.EFA = aws.Bool(true)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod(coretest.PodOptions{NodeSelector: map[string]string{v1.LabelInstanceTypeStable: "dl1.24xlarge"}})
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(HaveLen(1))
+			Expect(aws.StringValue(input.LaunchTemplateData.NetworkInterfaces[0].InterfaceType)).To(Equal(ec2.NetworkInterfaceTypeEfa))
+			Expect(aws.Int64Value(input.LaunchTemplateData.NetworkInterfaces[0].Ipv6AddressCount)).To(BeNumerically("==", 1))
+		})
+		It("should launch into IPv6-only subnets regardless of the minimum available IPs", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MinSubnetAvailableIPs: lo.ToPtr[int64](10)}))
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			call := awsEnv.EC2API.CreateFleetBehavior.CalledWithInput.Pop()
+			subnetIDs := lo.FlatMap(call.LaunchTemplateConfigs, func(ltc *ec2.FleetLaunchTemplateConfigRequest, _ int) []string {
+				return lo.Map(ltc.Overrides, func(o *ec2.FleetLaunchTemplateOverridesRequest, _ int) string { return aws.StringValue(o.SubnetId) })
+			})
+			Expect(lo.Uniq(subnetIDs)).To(ConsistOf("subnet-ipv6-1", "subnet-ipv6-2"))
+		})
+		It("should launch with IPv4 addresses when some subnets assign them", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				ipv6Subnet("subnet-ipv6-1", "test-zone-1a"),
+				{SubnetId: aws.String("subnet-ipv4-1"), AvailabilityZone: aws.String("test-zone-1b"), AvailableIpAddressCount: aws.Int64(100),
+					Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("subnet-ipv4-1")}}},
+			}})
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.SecurityGroupIds).ToNot(BeEmpty())
+			Expect(input.LaunchTemplateData.NetworkInterfaces).To(BeEmpty())
+			Expect(input.LaunchTemplateData.PrivateDnsNameOptions).To(BeNil())
+		})
+	})
+	Context("Private DNS Name Options", func() {
+		It("should not set private DNS name options by default", func() {
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(input.LaunchTemplateData.PrivateDnsNameOptions).To(BeNil())
+		})
+		It("should pass the private DNS name options to the launch template at creation", func() {
+			nodeTemplate.Spec.PrivateDNSNameOptions = &v1alpha1.PrivateDNSNameOptions{
+				HostnameType:                    aws.String(v1alpha1.HostnameTypeResourceName),
+				EnableResourceNameDNSARecord:    aws.Bool(true),
+				EnableResourceNameDNSAAAARecord: aws.Bool(false),
+			}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.PrivateDnsNameOptions.HostnameType)).To(Equal(v1alpha1.HostnameTypeResourceName))
+			Expect(aws.BoolValue(input.LaunchTemplateData.PrivateDnsNameOptions.EnableResourceNameDnsARecord)).To(BeTrue())
+			Expect(aws.BoolValue(input.LaunchTemplateData.PrivateDnsNameOptions.EnableResourceNameDnsAAAARecord)).To(BeFalse())
+		})
+	})
+	Context("Tenancy", func() {
+		It("should pass dedicated tenancy to the launch template at creation", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyDedicated)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			Expect(awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Len()).To(Equal(1))
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.Tenancy)).To(Equal(v1alpha1.TenancyDedicated))
+			Expect(input.LaunchTemplateData.Placement.GroupName).To(BeNil())
+			Expect(input.LaunchTemplateData.Placement.HostId).To(BeNil())
+		})
+		It("should pass the host ID to the launch template with host tenancy", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyHost)
+			nodeTemplate.Spec.HostID = aws.String("h-0123456789abcdef0")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.Tenancy)).To(Equal(v1alpha1.TenancyHost))
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.HostId)).To(Equal("h-0123456789abcdef0"))
+		})
+		It("should pass the host resource group to the launch template with host tenancy", func() {
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyHost)
+			nodeTemplate.Spec.HostResourceGroupARN = aws.String("arn:aws:resource-groups:us-west-2:123456789012:group/my-hosts")
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.Tenancy)).To(Equal(v1alpha1.TenancyHost))
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.HostResourceGroupArn)).To(Equal("arn:aws:resource-groups:us-west-2:123456789012:group/my-hosts"))
+		})
+		It("should combine the tenancy with the placement group", func() {
+			nodeTemplate.Spec.Placement = &v1alpha1.Placement{GroupName: "my-group", Strategy: v1alpha1.PlacementStrategySpread}
+			nodeTemplate.Spec.Tenancy = aws.String(v1alpha1.TenancyDedicated)
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			pod := coretest.UnschedulablePod()
+			ExpectProvisioned(ctx, env.Client, cluster, prov, pod)
+			ExpectScheduled(ctx, env.Client, pod)
+			input := awsEnv.EC2API.CalledWithCreateLaunchTemplateInput.Pop()
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.GroupName)).To(Equal("my-group"))
+			Expect(aws.StringValue(input.LaunchTemplateData.Placement.Tenancy)).To(Equal(v1alpha1.TenancyDedicated))
+		})
+	})
 })
 
 // ExpectTags verifies that the expected tags are a subset of the tags found
@@ -1706,3 +3352,37 @@ func ExpectTagsNotFound(tags []*ec2.Tag, expectNotFound map[string]string) {
 		ExpectWithOffset(1, !ok || v != elem).To(BeTrue())
 	}
 }
+
+// testFamily is an AMI family that's registered by the tests, rather than built in
+type testFamily struct {
+	amifamily.DefaultFamily
+	*amifamily.Options
+}
+
+func (t testFamily) SSMAlias(version string, _ *corecloudprovider.InstanceType) string {
+	return fmt.Sprintf("/test-family/%s/image_id", version)
+}
+
+func (t testFamily) UserData(_ *v1alpha5.KubeletConfiguration, _ []v1.Taint, _ map[string]string, _ *string, _ []*corecloudprovider.InstanceType, _ *string) bootstrap.Bootstrapper {
+	return bootstrap.Custom{Options: bootstrap.Options{
+		CustomUserData: aws.String(fmt.Sprintf("#!/bin/bash\n/opt/test-family/join.sh '%s'", t.ClusterName)),
+	}}
+}
+
+func (t testFamily) DefaultBlockDeviceMappings() []*v1alpha1.BlockDeviceMapping {
+	return []*v1alpha1.BlockDeviceMapping{{
+		DeviceName: t.EphemeralBlockDevice(),
+		EBS:        &amifamily.DefaultEBS,
+	}}
+}
+
+func (t testFamily) EphemeralBlockDevice() *string {
+	return aws.String("/dev/sdb")
+}
+
+func (t testFamily) SystemReserved() v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("100m"),
+		v1.ResourceMemory: resource.MustParse("1Gi"),
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/utils/clock"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/aws/karpenter-core/pkg/metrics"
+)
+
+const (
+	pricingSubsystem   = "pricing"
+	partitionLabel     = "partition"
+	capacityTypeLabel  = "capacity_type"
+	onDemandLabelValue = "on-demand"
+	spotLabelValue     = "spot"
+)
+
+var (
+	lastUpdateTimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, pricingSubsystem, "last_update_time_seconds"),
+		"Unix time of the last successful pricing update. Labeled by the partition and the capacity type of the prices.",
+		[]string{partitionLabel, capacityTypeLabel}, nil,
+	)
+	lastUpdateAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, pricingSubsystem, "last_update_age_seconds"),
+		"Age of the last successful pricing update when the metric is scraped. Labeled by the partition and the capacity type of the prices.",
+		[]string{partitionLabel, capacityTypeLabel}, nil,
+	)
+	lastUpdates = &lastUpdateCollector{updates: map[lastUpdateKey]lastUpdate{}}
+)
+
+type lastUpdateKey struct {
+	partition    string
+	capacityType string
+}
+
+type lastUpdate struct {
+	clk  clock.Clock
+	time time.Time
+}
+
+// lastUpdateCollector reports the time of the last successful pricing updates, along with their age. The age is
+// computed when it's collected, so that it keeps increasing between pricing refreshes.
+type lastUpdateCollector struct {
+	mu      sync.RWMutex
+	updates map[lastUpdateKey]lastUpdate
+}
+
+func (c *lastUpdateCollector) record(clk clock.Clock, partition, capacityType string, updated time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates[lastUpdateKey{partition: partition, capacityType: capacityType}] = lastUpdate{clk: clk, time: updated}
+}
+
+func (c *lastUpdateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastUpdateTimeDesc
+	ch <- lastUpdateAgeDesc
+}
+
+func (c *lastUpdateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for key, update := range c.updates {
+		ch <- prometheus.MustNewConstMetric(lastUpdateTimeDesc, prometheus.GaugeValue, float64(update.time.UnixNano())/float64(time.Second), key.partition, key.capacityType)
+		ch <- prometheus.MustNewConstMetric(lastUpdateAgeDesc, prometheus.GaugeValue, update.clk.Since(update.time).Seconds(), key.partition, key.capacityType)
+	}
+}
+
+func init() {
+	crmetrics.Registry.MustRegister(lastUpdates)
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -26,16 +27,21 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/pricing"
 	"github.com/aws/aws-sdk-go/service/pricing/pricingiface"
+	"github.com/patrickmn/go-cache"
 	"github.com/samber/lo"
 	"go.uber.org/multierr"
+	"k8s.io/utils/clock"
 	"knative.dev/pkg/logging"
 
 	"github.com/aws/karpenter/pkg/apis/settings"
+	awscache "github.com/aws/karpenter/pkg/cache"
+	"github.com/aws/karpenter/pkg/utils"
 
 	"github.com/aws/karpenter-core/pkg/utils/pretty"
 )
@@ -47,6 +53,7 @@ import (
 // fails, the previous pricing information is retained and used which may be the static initial pricing data if pricing
 // updates never succeed.
 type Provider struct {
+	clk     clock.Clock
 	ec2     ec2iface.EC2API
 	pricing pricingiface.PricingAPI
 	region  string
@@ -57,6 +64,16 @@ type Provider struct {
 	onDemandPrices     map[string]float64
 	spotUpdateTime     time.Time
 	spotPrices         map[string]zonal
+
+	// spotLookups caches the spot prices looked up per instance type and zone, and spotLookupCalls counts the lookups
+	// made since spotLookupWindow began so that they can be bounded
+	spotLookupMu     sync.Mutex
+	spotLookups      *cache.Cache
+	spotLookupWindow time.Time
+	spotLookupCalls  int64
+
+	// initialUpdate is closed once the pricing was first updated on startup
+	initialUpdate chan struct{}
 }
 
 // zonalPricing is used to capture the per-zone price
@@ -81,51 +98,88 @@ func newZonalPricing(defaultPrice float64) zonal {
 	return z
 }
 
-// pricingUpdatePeriod is how often we try to update our pricing information after the initial update on startup
-const pricingUpdatePeriod = 12 * time.Hour
+// staticPricingRegions are the regions whose static pricing data is used for the regions of each partition that don't
+// have static pricing data of their own
+var staticPricingRegions = map[string]string{
+	endpoints.AwsPartitionID:      "us-east-1",
+	endpoints.AwsCnPartitionID:    "cn-north-1",
+	endpoints.AwsUsGovPartitionID: "us-gov-west-1",
+}
 
-// NewPricingAPI returns a pricing API configured based on a particular region
+// NewPricingAPI returns a pricing API configured based on a particular region, or nil if the partition of the region
+// doesn't have a pricing API endpoint
 func NewAPI(sess *session.Session, region string) pricingiface.PricingAPI {
 	if sess == nil {
 		return nil
 	}
-	// pricing API doesn't have an endpoint in all regions
-	pricingAPIRegion := "us-east-1"
-	if strings.HasPrefix(region, "ap-") || strings.HasPrefix(region, "cn-") {
-		pricingAPIRegion = "ap-south-1"
+	pricingAPIRegion, ok := apiRegion(region)
+	if !ok {
+		return nil
 	}
 	return pricing.New(sess, &aws.Config{Region: aws.String(pricingAPIRegion)})
 }
 
-func NewProvider(ctx context.Context, pricing pricingiface.PricingAPI, ec2Api ec2iface.EC2API, region string, startAsync <-chan struct{}) *Provider {
+// apiRegion returns the region of the pricing API endpoint that serves the region. The pricing API only has endpoints
+// in a few regions, and none in the aws-us-gov partition.
+func apiRegion(region string) (string, bool) {
+	switch utils.Partition(region) {
+	case endpoints.AwsPartitionID:
+		if strings.HasPrefix(region, "ap-") {
+			return "ap-south-1", true
+		}
+		return "us-east-1", true
+	case endpoints.AwsCnPartitionID:
+		return "cn-northwest-1", true
+	default:
+		return "", false
+	}
+}
+
+func NewProvider(ctx context.Context, clk clock.Clock, pricing pricingiface.PricingAPI, ec2Api ec2iface.EC2API, region string, startAsync <-chan struct{}) *Provider {
 	// see if we've got region specific pricing data
 	staticPricing, ok := initialOnDemandPrices[region]
 	if !ok {
-		// and if not, fall back to the always available us-east-1
-		staticPricing = initialOnDemandPrices["us-east-1"]
+		// and if not, fall back to a region of the same partition, since prices differ between partitions
+		staticRegion, ok := staticPricingRegions[utils.Partition(region)]
+		if !ok {
+			staticRegion = "us-east-1"
+		}
+		logging.FromContext(ctx).With("region", region).Debugf("no static pricing data for region, using static pricing data for %s", staticRegion)
+		staticPricing = initialOnDemandPrices[staticRegion]
 	}
 
 	p := &Provider{
+		clk:                clk,
 		region:             region,
 		onDemandUpdateTime: initialPriceUpdate,
 		onDemandPrices:     staticPricing,
 		spotUpdateTime:     initialPriceUpdate,
 		// default our spot pricing to the same as the on-demand pricing until a price update
-		spotPrices: populateInitialSpotPricing(staticPricing),
-		ec2:        ec2Api,
-		pricing:    pricing,
-		cm:         pretty.NewChangeMonitor(),
+		spotPrices:    populateInitialSpotPricing(staticPricing),
+		ec2:           ec2Api,
+		pricing:       pricing,
+		cm:            pretty.NewChangeMonitor(),
+		spotLookups:   cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval),
+		initialUpdate: make(chan struct{}),
 	}
 	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).Named("pricing"))
 
 	if settings.FromContext(ctx).IsolatedVPC {
-		logging.FromContext(ctx).Infof("assuming isolated VPC, pricing information will not be updated")
+		logging.FromContext(ctx).Infof("assuming isolated VPC, pricing information will not be updated, %s", fallbackMessage(initialPriceUpdate))
+		close(p.initialUpdate)
 	} else {
+		if p.pricing == nil {
+			logging.FromContext(ctx).With("partition", utils.Partition(region)).
+				Infof("no pricing API endpoint in partition, on-demand pricing information will not be updated, %s", fallbackMessage(initialPriceUpdate))
+		}
+		// refreshInterval is how often we try to update our pricing information after the initial update on startup
+		refreshInterval := settings.FromContext(ctx).PricingRefreshInterval
 		go func() {
 			// perform an initial price update at startup
 			p.updatePricing(ctx)
+			close(p.initialUpdate)
 
-			startup := time.Now()
+			startup := p.clk.Now()
 			// wait for leader election or to be signaled to exit
 			select {
 			case <-startAsync:
@@ -134,7 +188,7 @@ func NewProvider(ctx context.Context, pricing pricingiface.PricingAPI, ec2Api ec
 			}
 			// if it took many hours to be elected leader, we want to re-fetch pricing before we start our periodic
 			// polling
-			if time.Since(startup) > pricingUpdatePeriod {
+			if p.clk.Since(startup) > refreshInterval {
 				p.updatePricing(ctx)
 			}
 
@@ -142,7 +196,7 @@ func NewProvider(ctx context.Context, pricing pricingiface.PricingAPI, ec2Api ec
 				select {
 				case <-ctx.Done():
 					return
-				case <-time.After(pricingUpdatePeriod):
+				case <-p.clk.After(refreshInterval):
 					p.updatePricing(ctx)
 				}
 			}
@@ -151,6 +205,12 @@ func NewProvider(ctx context.Context, pricing pricingiface.PricingAPI, ec2Api ec
 	return p
 }
 
+// InitialUpdate returns a channel that's closed once the pricing was first updated on startup, or immediately if the
+// pricing isn't updated in an isolated VPC. Failed updates count as well, the initial pricing data is used instead.
+func (p *Provider) InitialUpdate() <-chan struct{} {
+	return p.initialUpdate
+}
+
 // InstanceTypes returns the list of all instance types for which either a spot or on-demand price is known.
 func (p *Provider) InstanceTypes() []string {
 	p.mu.RLock()
@@ -203,23 +263,53 @@ func (p *Provider) SpotPrice(instanceType string, zone string) (float64, bool) {
 
 func (p *Provider) updatePricing(ctx context.Context) {
 	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := p.UpdateOnDemandPricing(ctx); err != nil {
-			logging.FromContext(ctx).Errorf("updating on-demand pricing, %s, using existing pricing data from %s", err, err.lastUpdateTime.Format(time.RFC3339))
-		}
-	}()
+	// On-demand pricing can't be updated in partitions without a pricing API endpoint
+	if p.pricing != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.UpdateOnDemandPricing(ctx); err != nil {
+				logging.FromContext(ctx).Errorf("updating on-demand pricing, %s, %s", err, fallbackMessage(err.lastUpdateTime))
+			}
+		}()
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		if err := p.UpdateSpotPricing(ctx); err != nil {
-			logging.FromContext(ctx).Errorf("updating spot pricing, %s, using existing pricing data from %s", err, err.lastUpdateTime.Format(time.RFC3339))
+			logging.FromContext(ctx).Errorf("updating spot pricing, %s, %s", err, fallbackMessage(err.lastUpdateTime))
 		}
 	}()
 
 	wg.Wait()
+	p.recordStaleness(ctx)
+}
+
+// fallbackMessage describes the pricing data that is used when a pricing update fails
+func fallbackMessage(lastUpdateTime time.Time) string {
+	if lastUpdateTime.Equal(initialPriceUpdate) {
+		return fmt.Sprintf("using static pricing data generated at %s", lastUpdateTime.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("using existing pricing data from %s", lastUpdateTime.Format(time.RFC3339))
+}
+
+// recordStaleness records the time of the last successful pricing updates for the metrics, warning when pricing hasn't
+// been updated for more than twice the refresh interval, which means that at least one refresh has been missed
+func (p *Provider) recordStaleness(ctx context.Context) {
+	threshold := 2 * settings.FromContext(ctx).PricingRefreshInterval
+	updates := map[string]time.Time{spotLabelValue: p.SpotLastUpdated()}
+	// On-demand pricing isn't expected to be updated in partitions without a pricing API endpoint
+	if p.pricing != nil {
+		updates[onDemandLabelValue] = p.OnDemandLastUpdated()
+	}
+	for capacityType, lastUpdated := range updates {
+		lastUpdates.record(p.clk, utils.Partition(p.region), capacityType, lastUpdated)
+		if age := p.clk.Since(lastUpdated); age > threshold {
+			logging.FromContext(ctx).With("capacity-type", capacityType, "last-updated", lastUpdated.Format(time.RFC3339)).
+				Warnf("pricing data is stale, last successful update was %s ago", age.Round(time.Second))
+		}
+	}
 }
 
 func (p *Provider) UpdateOnDemandPricing(ctx context.Context) *Err {
@@ -275,7 +365,7 @@ func (p *Provider) UpdateOnDemandPricing(ctx context.Context) *Err {
 	}
 
 	p.onDemandPrices = lo.Assign(onDemandPrices, onDemandMetalPrices)
-	p.onDemandUpdateTime = time.Now()
+	p.onDemandUpdateTime = p.clk.Now()
 	if p.cm.HasChanged("on-demand-prices", p.onDemandPrices) {
 		logging.FromContext(ctx).With("instance-type-count", len(p.onDemandPrices)).Infof("updated on-demand pricing")
 	}
@@ -346,7 +436,7 @@ func (p *Provider) onDemandPage(prices map[string]float64) func(output *pricing.
 
 	return func(output *pricing.GetProductsOutput, b bool) bool {
 		currency := "USD"
-		if p.region == "cn-north-1" {
+		if utils.Partition(p.region) == endpoints.AwsCnPartitionID {
 			currency = "CNY"
 		}
 		for _, outer := range output.PriceList {
@@ -385,7 +475,7 @@ func (p *Provider) UpdateSpotPricing(ctx context.Context) *Err {
 	err := p.ec2.DescribeSpotPriceHistoryPagesWithContext(ctx, &ec2.DescribeSpotPriceHistoryInput{
 		ProductDescriptions: []*string{aws.String("Linux/UNIX"), aws.String("Linux/UNIX (Amazon VPC)")},
 		// get the latest spot price for each instance type
-		StartTime: aws.Time(time.Now()),
+		StartTime: aws.Time(p.clk.Now()),
 	}, func(output *ec2.DescribeSpotPriceHistoryOutput, b bool) bool {
 		for _, sph := range output.SpotPriceHistory {
 			spotPriceStr := aws.StringValue(sph.SpotPrice)
@@ -427,7 +517,7 @@ func (p *Provider) UpdateSpotPricing(ctx context.Context) *Err {
 		totalOfferings += len(zoneData)
 	}
 
-	p.spotUpdateTime = time.Now()
+	p.spotUpdateTime = p.clk.Now()
 	if p.cm.HasChanged("spot-prices", p.spotPrices) {
 		logging.FromContext(ctx).With(
 			"instance-type-count", len(p.onDemandPrices),
@@ -436,6 +526,75 @@ func (p *Provider) UpdateSpotPricing(ctx context.Context) *Err {
 	return nil
 }
 
+// LookupSpotPrice returns the latest spot price for an instance type in a zone from the EC2 spot price history when
+// spot price lookups are enabled. Looked up prices are cached for aws.spotPriceLookupTTL and at most
+// aws.spotPriceLookupBudget lookups are made within that window. If lookups are disabled, the lookup fails or the
+// budget is spent, the last known spot price from the bulk pricing update is returned instead.
+func (p *Provider) LookupSpotPrice(ctx context.Context, instanceType string, zone string) (float64, bool) {
+	if !settings.FromContext(ctx).EnableSpotPriceLookup || settings.FromContext(ctx).IsolatedVPC {
+		return p.SpotPrice(instanceType, zone)
+	}
+	key := fmt.Sprintf("%s/%s", instanceType, zone)
+	if price, ok := p.spotLookups.Get(key); ok {
+		return price.(float64), true
+	}
+	if !p.reserveSpotLookup(ctx) {
+		return p.SpotPrice(instanceType, zone)
+	}
+	price, err := p.lookupSpotPrice(ctx, instanceType, zone)
+	if err != nil {
+		logging.FromContext(ctx).With("instance-type", instanceType, "zone", zone).Debugf("falling back to the last known spot price, %s", err)
+		return p.SpotPrice(instanceType, zone)
+	}
+	p.spotLookups.Set(key, price, settings.FromContext(ctx).SpotPriceLookupTTL)
+	return price, true
+}
+
+// reserveSpotLookup returns true if another spot price lookup fits within the budget of the current lookup window
+func (p *Provider) reserveSpotLookup(ctx context.Context) bool {
+	p.spotLookupMu.Lock()
+	defer p.spotLookupMu.Unlock()
+	if p.clk.Since(p.spotLookupWindow) >= settings.FromContext(ctx).SpotPriceLookupTTL {
+		p.spotLookupWindow = p.clk.Now()
+		p.spotLookupCalls = 0
+	}
+	if p.spotLookupCalls >= settings.FromContext(ctx).SpotPriceLookupBudget {
+		return false
+	}
+	p.spotLookupCalls++
+	return true
+}
+
+func (p *Provider) lookupSpotPrice(ctx context.Context, instanceType string, zone string) (float64, error) {
+	var latest *ec2.SpotPrice
+	if err := p.ec2.DescribeSpotPriceHistoryPagesWithContext(ctx, &ec2.DescribeSpotPriceHistoryInput{
+		AvailabilityZone:    aws.String(zone),
+		InstanceTypes:       []*string{aws.String(instanceType)},
+		ProductDescriptions: []*string{aws.String("Linux/UNIX"), aws.String("Linux/UNIX (Amazon VPC)")},
+		StartTime:           aws.Time(p.clk.Now()),
+	}, func(output *ec2.DescribeSpotPriceHistoryOutput, _ bool) bool {
+		for _, sph := range output.SpotPriceHistory {
+			if sph.Timestamp == nil || aws.StringValue(sph.InstanceType) != instanceType || aws.StringValue(sph.AvailabilityZone) != zone {
+				continue
+			}
+			if latest == nil || sph.Timestamp.After(*latest.Timestamp) {
+				latest = sph
+			}
+		}
+		return true
+	}); err != nil {
+		return 0, fmt.Errorf("describing spot price history, %w", err)
+	}
+	if latest == nil {
+		return 0, fmt.Errorf("no spot price history found")
+	}
+	price, err := strconv.ParseFloat(aws.StringValue(latest.SpotPrice), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing spot price, %w", err)
+	}
+	return price, nil
+}
+
 func (p *Provider) LivenessProbe(req *http.Request) error {
 	// ensure we don't deadlock and nolint for the empty critical section
 	p.mu.Lock()
@@ -21,12 +21,16 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	awspricing "github.com/aws/aws-sdk-go/service/pricing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/samber/lo"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
 	. "knative.dev/pkg/logging/testing"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	coresettings "github.com/aws/karpenter-core/pkg/apis/settings"
 	"github.com/aws/karpenter-core/pkg/operator/injection"
@@ -82,18 +86,53 @@ var _ = AfterEach(func() {
 var _ = Describe("Pricing", func() {
 	It("should return static on-demand data if pricing API fails", func() {
 		awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		price, ok := p.OnDemandPrice("c5.large")
 		Expect(ok).To(BeTrue())
 		Expect(price).To(BeNumerically(">", 0))
 	})
 	It("should return static spot data if EC2 describeSpotPriceHistory API fails", func() {
 		awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		price, ok := p.SpotPrice("c5.large", "test-zone-1a")
 		Expect(ok).To(BeTrue())
 		Expect(price).To(BeNumerically(">", 0))
 	})
+	It("should return static spot data if only the EC2 describeSpotPriceHistory API fails", func() {
+		awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+		awsEnv.PricingAPI.GetProductsOutput.Set(&awspricing.GetProductsOutput{
+			PriceList: []aws.JSONValue{
+				fake.NewOnDemandPrice("c5.large", 1.20),
+			},
+		})
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		price, ok := p.SpotPrice("c5.large", "test-zone-1a")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically(">", 0))
+	})
+	It("should return static on-demand and spot data if both pricing APIs fail", func() {
+		awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
+		awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		Consistently(func(g Gomega) {
+			for _, instanceType := range []string{"c5.large", "m5.xlarge", "r5.2xlarge"} {
+				price, ok := p.OnDemandPrice(instanceType)
+				g.Expect(ok).To(BeTrue())
+				g.Expect(price).To(BeNumerically(">", 0))
+				price, ok = p.SpotPrice(instanceType, "test-zone-1a")
+				g.Expect(ok).To(BeTrue())
+				g.Expect(price).To(BeNumerically(">", 0))
+			}
+		}).Should(Succeed())
+	})
+	It("should return static data from us-east-1 for regions without static pricing", func() {
+		awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
+		awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "test-region-1", make(chan struct{}))
+		price, ok := p.OnDemandPrice("c5.large")
+		Expect(ok).To(BeTrue())
+		Expect(price).To(BeNumerically(">", 0))
+	})
 	It("should update on-demand pricing with response from the pricing API", func() {
 		// modify our API before creating the pricing provider as it performs an initial update on creation. The pricing
 		// API provides on-demand prices, the ec2 API provides spot prices
@@ -104,7 +143,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.OnDemandPrice("c98.large")
@@ -152,7 +191,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.SpotPrice("c98.large", "test-zone-1b")
@@ -188,7 +227,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		price, ok := p.SpotPrice("c98.large", "test-zone-1a")
@@ -217,7 +256,7 @@ var _ = Describe("Pricing", func() {
 			},
 		})
 		updateStart := time.Now()
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
 
 		_, ok := p.SpotPrice("c99.large", "test-zone-1b")
@@ -245,10 +284,283 @@ var _ = Describe("Pricing", func() {
 				fake.NewOnDemandPrice("c99.large", 1.23),
 			},
 		})
-		p := pricing.NewProvider(ctx, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+		p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
 		Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }, 5*time.Second).Should(BeTrue())
 		inp := awsEnv.EC2API.DescribeSpotPriceHistoryInput.Clone()
 		Expect(lo.Map(inp.ProductDescriptions, func(x *string, _ int) string { return *x })).
 			To(ContainElements("Linux/UNIX", "Linux/UNIX (Amazon VPC)"))
 	})
+	Context("Spot Price Lookup", func() {
+		var p *pricing.Provider
+		BeforeEach(func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableSpotPriceLookup: lo.ToPtr(true)}))
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(spotPriceHistory(map[string]string{
+				"test-zone-1a": "1.20",
+				"test-zone-1b": "1.10",
+			}))
+			updateStart := time.Now()
+			p = pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "", make(chan struct{}))
+			Eventually(func() bool { return p.SpotLastUpdated().After(updateStart) }).Should(BeTrue())
+
+			// the spot price history has moved on since the bulk pricing update
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(spotPriceHistory(map[string]string{
+				"test-zone-1a": "1.40",
+				"test-zone-1b": "1.30",
+			}))
+		})
+		It("should return the zone specific price from the spot price history", func() {
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1b")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.30))
+
+			input := awsEnv.EC2API.DescribeSpotPriceHistoryInput.Clone()
+			Expect(aws.StringValue(input.AvailabilityZone)).To(Equal("test-zone-1b"))
+			Expect(aws.StringValueSlice(input.InstanceTypes)).To(ConsistOf("c98.large"))
+
+			// the bulk price is left untouched
+			price, ok = p.SpotPrice("c98.large", "test-zone-1b")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.10))
+		})
+		It("should return the latest price from the spot price history", func() {
+			now := time.Now()
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(&ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []*ec2.SpotPrice{
+					{
+						AvailabilityZone: aws.String("test-zone-1a"),
+						InstanceType:     aws.String("c98.large"),
+						SpotPrice:        aws.String("1.40"),
+						Timestamp:        aws.Time(now.Add(-time.Hour)),
+					},
+					{
+						AvailabilityZone: aws.String("test-zone-1a"),
+						InstanceType:     aws.String("c98.large"),
+						SpotPrice:        aws.String("1.50"),
+						Timestamp:        aws.Time(now),
+					},
+				},
+			})
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.50))
+		})
+		It("should cache looked up prices", func() {
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.40))
+
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(spotPriceHistory(map[string]string{
+				"test-zone-1a": "1.60",
+			}))
+			price, ok = p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.40))
+		})
+		It("should fall back to the bulk price if the lookup fails", func() {
+			awsEnv.EC2API.NextError.Set(fmt.Errorf("failed"))
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.20))
+		})
+		It("should fall back to the bulk price if the spot price history has no price for the zone", func() {
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(spotPriceHistory(map[string]string{
+				"test-zone-1a": "1.40",
+			}))
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1b")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.10))
+		})
+		It("should fall back to the bulk price once the lookup budget is spent", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+				EnableSpotPriceLookup: lo.ToPtr(true),
+				SpotPriceLookupBudget: lo.ToPtr[int64](1),
+			}))
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.40))
+
+			price, ok = p.LookupSpotPrice(ctx, "c98.large", "test-zone-1b")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.10))
+		})
+		It("should return the bulk price if spot price lookups are disabled", func() {
+			ctx = settings.ToContext(ctx, test.Settings())
+			price, ok := p.LookupSpotPrice(ctx, "c98.large", "test-zone-1a")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 1.20))
+		})
+	})
+	Context("Refresh", func() {
+		var fakeClock *clocktesting.FakeClock
+		var startAsync chan struct{}
+		BeforeEach(func() {
+			fakeClock = clocktesting.NewFakeClock(time.Now())
+			startAsync = make(chan struct{})
+			close(startAsync)
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{PricingRefreshInterval: lo.ToPtr(time.Hour)}))
+			awsEnv.PricingAPI.GetProductsOutput.Set(&awspricing.GetProductsOutput{
+				PriceList: []aws.JSONValue{
+					fake.NewOnDemandPrice("c98.large", 1.20),
+				},
+			})
+			awsEnv.EC2API.DescribeSpotPriceHistoryOutput.Set(&ec2.DescribeSpotPriceHistoryOutput{
+				SpotPriceHistory: []*ec2.SpotPrice{
+					{
+						AvailabilityZone: aws.String("test-zone-1a"),
+						InstanceType:     aws.String("c98.large"),
+						SpotPrice:        aws.String("0.60"),
+						Timestamp:        aws.Time(fakeClock.Now()),
+					},
+				},
+			})
+		})
+		It("should refresh pricing at the configured interval", func() {
+			start := fakeClock.Now()
+			p := pricing.NewProvider(ctx, fakeClock, awsEnv.PricingAPI, awsEnv.EC2API, "", startAsync)
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			Expect(p.OnDemandLastUpdated()).To(Equal(start))
+			Expect(p.SpotLastUpdated()).To(Equal(start))
+
+			// no refresh happens before the interval has passed
+			fakeClock.Step(59 * time.Minute)
+			Consistently(p.OnDemandLastUpdated).Should(Equal(start))
+
+			fakeClock.Step(time.Minute)
+			Eventually(p.OnDemandLastUpdated).Should(Equal(start.Add(time.Hour)))
+			Eventually(p.SpotLastUpdated).Should(Equal(start.Add(time.Hour)))
+
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Hour)
+			Eventually(p.OnDemandLastUpdated).Should(Equal(start.Add(2 * time.Hour)))
+			Eventually(p.SpotLastUpdated).Should(Equal(start.Add(2 * time.Hour)))
+		})
+		It("should report the age of the last successful update", func() {
+			pricing.NewProvider(ctx, fakeClock, awsEnv.PricingAPI, awsEnv.EC2API, "", startAsync)
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			Expect(lastUpdateAge("on-demand")).To(BeNumerically("==", 0))
+			Expect(lastUpdateAge("spot")).To(BeNumerically("==", 0))
+
+			// on-demand pricing updates now fail, so on-demand pricing gets older while spot pricing stays fresh
+			awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
+			fakeClock.Step(time.Hour)
+			Eventually(func() float64 { return lastUpdateAge("on-demand") }).Should(BeNumerically("==", time.Hour.Seconds()))
+			Expect(lastUpdateAge("spot")).To(BeNumerically("==", 0))
+
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			fakeClock.Step(time.Hour)
+			Eventually(func() float64 { return lastUpdateAge("on-demand") }).Should(BeNumerically("==", 2*time.Hour.Seconds()))
+			Expect(lastUpdateAge("spot")).To(BeNumerically("==", 0))
+		})
+		It("should report the age of the last successful update when it's scraped rather than when pricing is refreshed", func() {
+			pricing.NewProvider(ctx, fakeClock, awsEnv.PricingAPI, awsEnv.EC2API, "", startAsync)
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			Expect(lastUpdateAge("spot")).To(BeNumerically("==", 0))
+
+			// no refresh happens before the interval has passed, but the age keeps increasing
+			fakeClock.Step(30 * time.Minute)
+			Expect(lastUpdateAge("spot")).To(BeNumerically("==", (30 * time.Minute).Seconds()))
+		})
+		It("should report the time of the last successful update", func() {
+			start := fakeClock.Now()
+			pricing.NewProvider(ctx, fakeClock, awsEnv.PricingAPI, awsEnv.EC2API, "", startAsync)
+			Eventually(fakeClock.HasWaiters).Should(BeTrue())
+			Expect(lastUpdateMetric("karpenter_pricing_last_update_time_seconds", "aws", "spot")).To(BeNumerically("~", float64(start.UnixNano())/float64(time.Second), 0.001))
+		})
+	})
+	Context("Partitions", func() {
+		DescribeTable("should use the pricing API endpoint of the partition",
+			func(region string, endpoint string) {
+				api := pricing.NewAPI(session.Must(session.NewSession()), region)
+				Expect(api.(*awspricing.Pricing).Endpoint).To(Equal(endpoint))
+			},
+			Entry("aws", "us-west-2", "https://api.pricing.us-east-1.amazonaws.com"),
+			Entry("aws in asia pacific", "ap-northeast-1", "https://api.pricing.ap-south-1.amazonaws.com"),
+			Entry("aws-cn", "cn-north-1", "https://api.pricing.cn-northwest-1.amazonaws.com.cn"),
+			Entry("aws-cn in another region", "cn-northwest-1", "https://api.pricing.cn-northwest-1.amazonaws.com.cn"),
+		)
+		DescribeTable("should not use a pricing API in partitions without a pricing API endpoint",
+			func(region string) {
+				Expect(pricing.NewAPI(session.Must(session.NewSession()), region)).To(BeNil())
+			},
+			Entry("aws-us-gov", "us-gov-west-1"),
+			Entry("aws-us-gov in another region", "us-gov-east-1"),
+		)
+		DescribeTable("should fall back to the static pricing data of the partition",
+			func(region string, staticRegion string) {
+				awsEnv.PricingAPI.NextError.Set(fmt.Errorf("failed"))
+				p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, region, make(chan struct{}))
+				static := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, staticRegion, make(chan struct{}))
+				price, ok := p.OnDemandPrice("m5.large")
+				Expect(ok).To(BeTrue())
+				Expect(price).To(Equal(lo.Must(static.OnDemandPrice("m5.large"))))
+			},
+			Entry("aws", "test-region-1", "us-east-1"),
+			Entry("aws-cn", "cn-northwest-1", "cn-north-1"),
+			Entry("aws-us-gov", "us-gov-test-1", "us-gov-west-1"),
+		)
+		It("should parse on-demand prices in CNY in the aws-cn partition", func() {
+			awsEnv.PricingAPI.GetProductsOutput.Set(&awspricing.GetProductsOutput{
+				PriceList: []aws.JSONValue{
+					fake.NewOnDemandPriceInCurrency("c98.large", 8.12, "CNY"),
+					fake.NewOnDemandPrice("c99.large", 1.23),
+				},
+			})
+			updateStart := time.Now()
+			p := pricing.NewProvider(ctx, clock.RealClock{}, awsEnv.PricingAPI, awsEnv.EC2API, "cn-northwest-1", make(chan struct{}))
+			Eventually(func() bool { return p.OnDemandLastUpdated().After(updateStart) }).Should(BeTrue())
+
+			price, ok := p.OnDemandPrice("c98.large")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically("==", 8.12))
+			_, ok = p.OnDemandPrice("c99.large")
+			Expect(ok).To(BeFalse())
+		})
+		It("should use static on-demand pricing without a pricing API in the aws-us-gov partition", func() {
+			p := pricing.NewProvider(ctx, clock.RealClock{}, nil, awsEnv.EC2API, "us-gov-west-1", make(chan struct{}))
+			Eventually(p.InitialUpdate()).Should(BeClosed())
+			price, ok := p.OnDemandPrice("m5.large")
+			Expect(ok).To(BeTrue())
+			Expect(price).To(BeNumerically(">", 0))
+		})
+	})
 })
+
+// lastUpdateAge returns the age of the last successful pricing update of the capacity type in the aws partition
+func lastUpdateAge(capacityType string) float64 {
+	return lastUpdateMetric("karpenter_pricing_last_update_age_seconds", "aws", capacityType)
+}
+
+func lastUpdateMetric(name, partition, capacityType string) float64 {
+	families, err := crmetrics.Registry.Gather()
+	ExpectWithOffset(2, err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["partition"] == partition && labels["capacity_type"] == capacityType {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return -1
+}
+
+// spotPriceHistory returns the spot price history of c98.large with a price for each zone
+func spotPriceHistory(prices map[string]string) *ec2.DescribeSpotPriceHistoryOutput {
+	now := time.Now()
+	output := &ec2.DescribeSpotPriceHistoryOutput{}
+	for zone, price := range prices {
+		output.SpotPriceHistory = append(output.SpotPriceHistory, &ec2.SpotPrice{
+			AvailabilityZone: aws.String(zone),
+			InstanceType:     aws.String("c98.large"),
+			SpotPrice:        aws.String(price),
+			Timestamp:        &now,
+		})
+	}
+	return output
+}
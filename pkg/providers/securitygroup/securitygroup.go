@@ -17,6 +17,7 @@ package securitygroup
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,26 +26,30 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/mitchellh/hashstructure/v2"
 	"github.com/patrickmn/go-cache"
+	"github.com/samber/lo"
 	"knative.dev/pkg/logging"
 
 	"github.com/aws/karpenter-core/pkg/utils/functional"
 	"github.com/aws/karpenter-core/pkg/utils/pretty"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
+	"github.com/aws/karpenter/pkg/providers/subnet"
 )
 
 type Provider struct {
 	sync.Mutex
-	ec2api ec2iface.EC2API
-	cache  *cache.Cache
-	cm     *pretty.ChangeMonitor
+	ec2api         ec2iface.EC2API
+	subnetProvider *subnet.Provider
+	cache          *cache.Cache
+	cm             *pretty.ChangeMonitor
 }
 
 const TTL = 5 * time.Minute
 
-func NewProvider(ec2api ec2iface.EC2API, cache *cache.Cache) *Provider {
+func NewProvider(ec2api ec2iface.EC2API, subnetProvider *subnet.Provider, cache *cache.Cache) *Provider {
 	return &Provider{
-		ec2api: ec2api,
-		cm:     pretty.NewChangeMonitor(),
+		ec2api:         ec2api,
+		subnetProvider: subnetProvider,
+		cm:             pretty.NewChangeMonitor(),
 		// TODO: Remove cache for v1beta1, utilize resolved security groups from the AWSNodeTemplate.status
 		cache: cache,
 	}
@@ -56,13 +61,32 @@ func (p *Provider) List(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempl
 	// Get SecurityGroups
 	// TODO: When removing custom launchTemplates for v1beta1, security groups will be required.
 	// The check will not be necessary
-	filters := p.getFilters(nodeTemplate)
-	if len(filters) == 0 {
+	filterSets := getFilterSets(nodeTemplate)
+	if len(filterSets) == 0 {
 		return []string{}, nil
 	}
-	securityGroups, err := p.getSecurityGroups(ctx, filters)
-	if err != nil {
-		return nil, err
+	// Constrain security groups to the VPC of the selected subnets, since security group names and tags are often reused across VPCs
+	if _, ok := nodeTemplate.Spec.SecurityGroupSelector["aws-vpc-id"]; !ok {
+		vpcFilter, err := p.getVPCFilter(ctx, nodeTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if vpcFilter != nil {
+			filterSets = lo.Map(filterSets, func(filters []*ec2.Filter, _ int) []*ec2.Filter { return append(filters, vpcFilter) })
+		}
+	}
+	var securityGroups []*ec2.SecurityGroup
+	for _, filters := range filterSets {
+		output, err := p.getSecurityGroups(ctx, filters)
+		if err != nil {
+			return nil, err
+		}
+		securityGroups = append(securityGroups, output...)
+	}
+	// A security group that's matched by both its ID and its name is only attached once
+	securityGroups = lo.UniqBy(securityGroups, func(s *ec2.SecurityGroup) string { return aws.StringValue(s.GroupId) })
+	if p.cm.HasChanged("security-groups", securityGroups) {
+		logging.FromContext(ctx).With("security-groups", p.securityGroupIds(securityGroups)).Debugf("discovered security groups")
 	}
 	// Convert to IDs
 	securityGroupIds := []string{}
@@ -72,14 +96,28 @@ func (p *Provider) List(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempl
 	return securityGroupIds, nil
 }
 
-func (p *Provider) getFilters(nodeTemplate *v1alpha1.AWSNodeTemplate) []*ec2.Filter {
+// getFilterSets returns the filters of each way that the selector identifies security groups. Security groups are
+// resolved by their IDs (aws-ids) and by their names (aws::name) independently, and the results are combined. Tags
+// and the VPC narrow down every set of filters, or form the only set when the selector doesn't identify any groups.
+func getFilterSets(nodeTemplate *v1alpha1.AWSNodeTemplate) [][]*ec2.Filter {
+	var identities []*ec2.Filter
 	filters := []*ec2.Filter{}
 	for key, value := range nodeTemplate.Spec.SecurityGroupSelector {
 		if key == "aws-ids" {
-			filters = append(filters, &ec2.Filter{
+			identities = append(identities, &ec2.Filter{
 				Name:   aws.String("group-id"),
 				Values: aws.StringSlice(functional.SplitCommaSeparatedString(value)),
 			})
+		} else if key == "aws::name" {
+			identities = append(identities, &ec2.Filter{
+				Name:   aws.String("group-name"),
+				Values: aws.StringSlice(functional.SplitCommaSeparatedString(value)),
+			})
+		} else if key == "aws-vpc-id" {
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(value)},
+			})
 		} else if value == "*" {
 			filters = append(filters, &ec2.Filter{
 				Name:   aws.String("tag-key"),
@@ -92,7 +130,33 @@ func (p *Provider) getFilters(nodeTemplate *v1alpha1.AWSNodeTemplate) []*ec2.Fil
 			})
 		}
 	}
-	return filters
+	if len(identities) == 0 {
+		return lo.Ternary(len(filters) == 0, nil, [][]*ec2.Filter{filters})
+	}
+	// Resolve IDs before names so that security groups are listed in a stable order
+	sort.Slice(identities, func(i, j int) bool { return aws.StringValue(identities[i].Name) < aws.StringValue(identities[j].Name) })
+	return lo.Map(identities, func(identity *ec2.Filter, _ int) []*ec2.Filter {
+		return append([]*ec2.Filter{identity}, filters...)
+	})
+}
+
+// getVPCFilter returns a filter for the VPC of the node template's subnets, or nil if the VPC can't be resolved
+func (p *Provider) getVPCFilter(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (*ec2.Filter, error) {
+	subnets, err := p.subnetProvider.List(ctx, nodeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("resolving vpc from subnets, %w", err)
+	}
+	vpcIDs := lo.Uniq(lo.FilterMap(subnets, func(s *ec2.Subnet, _ int) (string, bool) {
+		return aws.StringValue(s.VpcId), aws.StringValue(s.VpcId) != ""
+	}))
+	switch len(vpcIDs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &ec2.Filter{Name: aws.String("vpc-id"), Values: aws.StringSlice(vpcIDs)}, nil
+	default:
+		return nil, fmt.Errorf("subnets matching selector %v span multiple vpcs %v, security groups must be selected from a single vpc", nodeTemplate.Spec.SubnetSelector, vpcIDs)
+	}
 }
 
 func (p *Provider) getSecurityGroups(ctx context.Context, filters []*ec2.Filter) ([]*ec2.SecurityGroup, error) {
@@ -108,9 +172,6 @@ func (p *Provider) getSecurityGroups(ctx context.Context, filters []*ec2.Filter)
 		return nil, fmt.Errorf("describing security groups %+v, %w", filters, err)
 	}
 	p.cache.SetDefault(fmt.Sprint(hash), output.SecurityGroups)
-	if p.cm.HasChanged("security-groups", output.SecurityGroups) {
-		logging.FromContext(ctx).With("security-groups", p.securityGroupIds(output.SecurityGroups)).Debugf("discovered security groups")
-	}
 	return output.SecurityGroups, nil
 }
 
@@ -189,4 +189,91 @@ var _ = Describe("Security Group Provider", func() {
 			"sg-test2",
 		))
 	})
+	It("should discover security groups by name", func() {
+		nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"aws::name": "securityGroup-test2"}
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(resolvedSecurityGroups).To(ConsistOf("sg-test2"))
+	})
+	It("should discover security groups by names", func() {
+		nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"aws::name": "securityGroup-test1,securityGroup-test3"}
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(resolvedSecurityGroups).To(ConsistOf("sg-test1", "sg-test3"))
+	})
+	It("should discover security groups by names intersected with tags", func() {
+		nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"aws::name": "securityGroup-test1,securityGroup-test3", "TestTag": "*"}
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(resolvedSecurityGroups).To(ConsistOf("sg-test3"))
+	})
+	It("should combine security groups discovered by IDs and by names without duplicates", func() {
+		nodeTemplate.Spec.SecurityGroupSelector = map[string]string{
+			"aws-ids":   "sg-test1,sg-test2",
+			"aws::name": "securityGroup-test2,securityGroup-test3",
+		}
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(resolvedSecurityGroups).To(HaveLen(3))
+		Expect(resolvedSecurityGroups).To(ConsistOf("sg-test1", "sg-test2", "sg-test3"))
+	})
+	It("should not discover security groups by a name that doesn't exist", func() {
+		nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"aws::name": "securityGroup-missing"}
+		ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+		resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(resolvedSecurityGroups).To(BeEmpty())
+	})
+	Context("VPC", func() {
+		BeforeEach(func() {
+			awsEnv.EC2API.DescribeSecurityGroupsOutput.Set(&ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{
+				{GroupId: aws.String("sg-dev1"), VpcId: aws.String("vpc-dev"), Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("nodes")}}},
+				{GroupId: aws.String("sg-prod1"), VpcId: aws.String("vpc-prod"), Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("nodes")}}},
+			}})
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				{SubnetId: aws.String("subnet-dev1"), VpcId: aws.String("vpc-dev"), AvailabilityZone: aws.String("test-zone-1a"),
+					Tags: []*ec2.Tag{{Key: aws.String("env"), Value: aws.String("dev")}}},
+				{SubnetId: aws.String("subnet-prod1"), VpcId: aws.String("vpc-prod"), AvailabilityZone: aws.String("test-zone-1a"),
+					Tags: []*ec2.Tag{{Key: aws.String("env"), Value: aws.String("prod")}}},
+			}})
+			nodeTemplate.Spec.SecurityGroupSelector = map[string]string{"Name": "nodes"}
+		})
+		It("should only discover security groups in the vpc of the selected subnets", func() {
+			nodeTemplate.Spec.SubnetSelector = map[string]string{"env": "prod"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(resolvedSecurityGroups).To(ConsistOf("sg-prod1"))
+		})
+		It("should only discover security groups in the vpc specified by the selector", func() {
+			nodeTemplate.Spec.SubnetSelector = map[string]string{"env": "prod"}
+			nodeTemplate.Spec.SecurityGroupSelector["aws-vpc-id"] = "vpc-dev"
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(resolvedSecurityGroups).To(ConsistOf("sg-dev1"))
+		})
+		It("should return an error when the selected subnets span multiple vpcs", func() {
+			nodeTemplate.Spec.SubnetSelector = map[string]string{"env": "*"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			_, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("span multiple vpcs"))
+		})
+		It("should discover security groups across vpcs when the subnets' vpc is unknown", func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				{SubnetId: aws.String("subnet-test1"), AvailabilityZone: aws.String("test-zone-1a"),
+					Tags: []*ec2.Tag{{Key: aws.String("env"), Value: aws.String("dev")}}},
+			}})
+			nodeTemplate.Spec.SubnetSelector = map[string]string{"env": "dev"}
+			ExpectApplied(ctx, env.Client, provisioner, nodeTemplate)
+			resolvedSecurityGroups, err := awsEnv.SecurityGroupProvider.List(ctx, nodeTemplate)
+			Expect(err).To(BeNil())
+			Expect(resolvedSecurityGroups).To(ConsistOf("sg-dev1", "sg-prod1"))
+		})
+	})
 })
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,6 +30,7 @@ import (
 	"github.com/samber/lo"
 	"knative.dev/pkg/logging"
 
+	"github.com/aws/karpenter/pkg/apis/settings"
 	"github.com/aws/karpenter/pkg/apis/v1alpha1"
 
 	"github.com/aws/karpenter-core/pkg/cloudprovider"
@@ -42,9 +44,16 @@ type Provider struct {
 	cache       *cache.Cache
 	cm          *pretty.ChangeMonitor
 	inflightIPs map[string]int64
+	placements  *cache.Cache
 }
 
-func NewProvider(ec2api ec2iface.EC2API, cache *cache.Cache) *Provider {
+// placement records the zone that an instance of a node template was launched into
+type placement struct {
+	nodeTemplate string
+	zone         string
+}
+
+func NewProvider(ec2api ec2iface.EC2API, cache *cache.Cache, placementCache *cache.Cache) *Provider {
 	return &Provider{
 		ec2api: ec2api,
 		cm:     pretty.NewChangeMonitor(),
@@ -53,6 +62,8 @@ func NewProvider(ec2api ec2iface.EC2API, cache *cache.Cache) *Provider {
 		cache: cache,
 		// inflightIPs is used to track IPs from known launched instances
 		inflightIPs: map[string]int64{},
+		// placements tracks the zones of recently launched instances, keyed by instance ID
+		placements: placementCache,
 	}
 }
 
@@ -86,7 +97,8 @@ func (p *Provider) List(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTempl
 	return output.Subnets, nil
 }
 
-// ZonalSubnetsForLaunch returns a mapping of zone to the subnet with the most available IP addresses and deducts the passed ips from the available count
+// ZonalSubnetsForLaunch returns a mapping of zone to the subnet with the most available IP addresses and deducts the passed ips from the available count.
+// Subnets with fewer available IP addresses than the configured minimum, or in a zone that isn't allowed, are skipped.
 func (p *Provider) ZonalSubnetsForLaunch(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate, instanceTypes []*cloudprovider.InstanceType, capacityType string) (map[string]*ec2.Subnet, error) {
 	subnets, err := p.List(ctx, nodeTemplate)
 	if err != nil {
@@ -97,34 +109,68 @@ func (p *Provider) ZonalSubnetsForLaunch(ctx context.Context, nodeTemplate *v1al
 	}
 	p.Lock()
 	defer p.Unlock()
+	subnets = lo.Filter(subnets, func(subnet *ec2.Subnet, _ int) bool {
+		return settings.FromContext(ctx).IsZoneAllowed(aws.StringValue(subnet.AvailabilityZone))
+	})
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("all subnets matching selector %v are in zones that aren't allowed", nodeTemplate.Spec.SubnetSelector)
+	}
+	if minIPs := settings.FromContext(ctx).MinSubnetAvailableIPs; minIPs > 0 {
+		// IPv6-native subnets don't have any IPv4 addresses to run out of
+		subnets = lo.Filter(subnets, func(subnet *ec2.Subnet, _ int) bool {
+			return IsIPv6Only(subnet) || p.availableIPAddressCount(subnet) >= minIPs
+		})
+		if len(subnets) == 0 {
+			return nil, fmt.Errorf("all subnets matching selector %v have fewer than %d available IP addresses", nodeTemplate.Spec.SubnetSelector, minIPs)
+		}
+	}
 	// sort subnets in ascending order of available IP addresses and populate map with most available subnet per AZ
 	zonalSubnets := map[string]*ec2.Subnet{}
 	sort.Slice(subnets, func(i, j int) bool {
-		iIPs := aws.Int64Value(subnets[i].AvailableIpAddressCount)
-		jIPs := aws.Int64Value(subnets[j].AvailableIpAddressCount)
-		// override ip count from ec2.Subnet if we've tracked launches
-		if ips, ok := p.inflightIPs[*subnets[i].SubnetId]; ok {
-			iIPs = ips
-		}
-		if ips, ok := p.inflightIPs[*subnets[j].SubnetId]; ok {
-			jIPs = ips
-		}
-		return iIPs < jIPs
+		return p.availableIPAddressCount(subnets[i]) < p.availableIPAddressCount(subnets[j])
 	})
 	for _, subnet := range subnets {
 		zonalSubnets[*subnet.AvailabilityZone] = subnet
 	}
 	for _, subnet := range zonalSubnets {
 		predictedIPsUsed := p.minPods(instanceTypes, *subnet.AvailabilityZone, capacityType)
-		prevIPs := *subnet.AvailableIpAddressCount
-		if trackedIPs, ok := p.inflightIPs[*subnet.SubnetId]; ok {
-			prevIPs = trackedIPs
-		}
-		p.inflightIPs[*subnet.SubnetId] = prevIPs - predictedIPsUsed
+		p.inflightIPs[*subnet.SubnetId] = p.availableIPAddressCount(subnet) - predictedIPsUsed
 	}
 	return zonalSubnets, nil
 }
 
+// IPv6Only returns true if every subnet selected by the node template is IPv6-native. The launch templates of a node
+// template are shared by all of its subnets, so instances are only launched without IPv4 addresses if none of its
+// subnets assign them.
+func (p *Provider) IPv6Only(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) (bool, error) {
+	subnets, err := p.List(ctx, nodeTemplate)
+	if err != nil {
+		return false, err
+	}
+	return len(subnets) > 0 && lo.EveryBy(subnets, IsIPv6Only), nil
+}
+
+// IsIPv6Only returns true if the subnet is IPv6-native, so that instances launched into it are only assigned IPv6 addresses
+func IsIPv6Only(subnet *ec2.Subnet) bool {
+	return aws.BoolValue(subnet.Ipv6Native)
+}
+
+// AvailableIPAddressCount returns the number of IP addresses available in the subnet, accounting for IPs used by
+// instances launched since the subnet was last described
+func (p *Provider) AvailableIPAddressCount(subnet *ec2.Subnet) int64 {
+	p.RLock()
+	defer p.RUnlock()
+	return p.availableIPAddressCount(subnet)
+}
+
+func (p *Provider) availableIPAddressCount(subnet *ec2.Subnet) int64 {
+	// override ip count from ec2.Subnet if we've tracked launches
+	if ips, ok := p.inflightIPs[aws.StringValue(subnet.SubnetId)]; ok {
+		return ips
+	}
+	return aws.Int64Value(subnet.AvailableIpAddressCount)
+}
+
 // UpdateInflightIPs is used to refresh the in-memory IP usage by adding back unused IPs after a CreateFleet response is returned
 func (p *Provider) UpdateInflightIPs(createFleetInput *ec2.CreateFleetInput, createFleetOutput *ec2.CreateFleetOutput, instanceTypes []*cloudprovider.InstanceType,
 	subnets []*ec2.Subnet, capacityType string) {
@@ -184,6 +230,68 @@ func (p *Provider) UpdateInflightIPs(createFleetInput *ec2.CreateFleetInput, cre
 	}
 }
 
+// RecordPlacement records that the instance was launched into the zone, so that later launches of the node template
+// can prefer the zones that it was launched into the least
+func (p *Provider) RecordPlacement(nodeTemplate *v1alpha1.AWSNodeTemplate, id string, zone string) {
+	if id == "" || zone == "" {
+		return
+	}
+	p.placements.SetDefault(id, placement{nodeTemplate: nodeTemplate.Name, zone: zone})
+}
+
+// ZonePlacements returns the number of instances of the node template that were recently launched into each zone. Nil
+// is returned when zone balancing is disabled.
+func (p *Provider) ZonePlacements(ctx context.Context, nodeTemplate *v1alpha1.AWSNodeTemplate) map[string]int {
+	if !settings.FromContext(ctx).EnableZoneBalancing {
+		return nil
+	}
+	placements := map[string]int{}
+	for _, item := range p.placements.Items() {
+		if pl := item.Object.(placement); pl.nodeTemplate == nodeTemplate.Name {
+			placements[pl.zone]++
+		}
+	}
+	return placements
+}
+
+// Weight returns the launch weight of a subnet from its subnet weight tag. Subnets without a valid weight have a weight of 0.
+func Weight(subnet *ec2.Subnet) int64 {
+	tag, ok := lo.Find(subnet.Tags, func(t *ec2.Tag) bool { return aws.StringValue(t.Key) == v1alpha1.TagSubnetWeight })
+	if !ok {
+		return 0
+	}
+	weight, err := strconv.ParseInt(aws.StringValue(tag.Value), 10, 64)
+	if err != nil || weight < 0 {
+		return 0
+	}
+	return weight
+}
+
+// ZonePriorities returns the fleet override priority for each zone based on the weight of the subnet chosen for that zone.
+// Zones with the same weight are prioritized by the number of instances that were recently launched into them, fewest
+// first, so that launches are balanced across zones. The most preferred zones have a priority of 0. Nil is returned
+// when every zone is equally preferred, since there is no preference between zones.
+func ZonePriorities(zonalSubnets map[string]*ec2.Subnet, placements map[string]int) map[string]float64 {
+	type rank struct {
+		weight     int64
+		placements int
+	}
+	ranks := lo.MapValues(zonalSubnets, func(subnet *ec2.Subnet, zone string) rank {
+		return rank{weight: Weight(subnet), placements: placements[zone]}
+	})
+	distinctRanks := lo.Uniq(lo.Values(ranks))
+	if len(distinctRanks) <= 1 {
+		return nil
+	}
+	sort.Slice(distinctRanks, func(i, j int) bool {
+		if distinctRanks[i].weight != distinctRanks[j].weight {
+			return distinctRanks[i].weight > distinctRanks[j].weight
+		}
+		return distinctRanks[i].placements < distinctRanks[j].placements
+	})
+	return lo.MapValues(ranks, func(r rank, _ string) float64 { return float64(lo.IndexOf(distinctRanks, r)) })
+}
+
 func (p *Provider) LivenessProbe(req *http.Request) error {
 	p.Lock()
 	//nolint: staticcheck
@@ -21,6 +21,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
@@ -180,4 +181,85 @@ var _ = Describe("Subnet Provider", func() {
 			"subnet-test2 (test-zone-1b)",
 		))
 	})
+	It("should cache subnets between lookups", func() {
+		awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("test-subnet-1"), AvailabilityZone: aws.String("test-zone-1a"), AvailableIpAddressCount: aws.Int64(100)},
+		}})
+		subnets, err := awsEnv.SubnetProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(subnet.Pretty(subnets)).To(ConsistOf("test-subnet-1 (test-zone-1a)"))
+		awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("test-subnet-2"), AvailabilityZone: aws.String("test-zone-1a"), AvailableIpAddressCount: aws.Int64(100)},
+		}})
+		subnets, err = awsEnv.SubnetProvider.List(ctx, nodeTemplate)
+		Expect(err).To(BeNil())
+		Expect(subnet.Pretty(subnets)).To(ConsistOf("test-subnet-1 (test-zone-1a)"))
+	})
+	Context("Available IP Addresses", func() {
+		BeforeEach(func() {
+			awsEnv.EC2API.DescribeSubnetsOutput.Set(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+				{SubnetId: aws.String("test-subnet-1"), AvailabilityZone: aws.String("test-zone-1a"), AvailableIpAddressCount: aws.Int64(5)},
+				{SubnetId: aws.String("test-subnet-2"), AvailabilityZone: aws.String("test-zone-1a"), AvailableIpAddressCount: aws.Int64(20)},
+				{SubnetId: aws.String("test-subnet-3"), AvailabilityZone: aws.String("test-zone-1b"), AvailableIpAddressCount: aws.Int64(50)},
+				{SubnetId: aws.String("test-subnet-4"), AvailabilityZone: aws.String("test-zone-1c"), AvailableIpAddressCount: aws.Int64(8)},
+			}})
+		})
+		It("should expose the available IP address count of a subnet", func() {
+			subnets, err := awsEnv.SubnetProvider.List(ctx, nodeTemplate)
+			Expect(err).To(BeNil())
+			for _, s := range subnets {
+				Expect(awsEnv.SubnetProvider.AvailableIPAddressCount(s)).To(Equal(aws.Int64Value(s.AvailableIpAddressCount)))
+			}
+		})
+		It("should not skip subnets when no minimum is configured", func() {
+			zonalSubnets, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(BeNil())
+			Expect(zonalSubnets).To(HaveLen(3))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1a"].SubnetId)).To(Equal("test-subnet-2"))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1b"].SubnetId)).To(Equal("test-subnet-3"))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1c"].SubnetId)).To(Equal("test-subnet-4"))
+		})
+		It("should skip subnets with fewer available IP addresses than the minimum", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MinSubnetAvailableIPs: aws.Int64(10)}))
+			zonalSubnets, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(BeNil())
+			Expect(zonalSubnets).To(HaveLen(2))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1a"].SubnetId)).To(Equal("test-subnet-2"))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1b"].SubnetId)).To(Equal("test-subnet-3"))
+			Expect(zonalSubnets).ToNot(HaveKey("test-zone-1c"))
+		})
+		It("should include subnets with exactly the minimum available IP addresses", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MinSubnetAvailableIPs: aws.Int64(50)}))
+			zonalSubnets, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(BeNil())
+			Expect(zonalSubnets).To(HaveLen(1))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1b"].SubnetId)).To(Equal("test-subnet-3"))
+		})
+		It("should return an error when every subnet is below the minimum", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{MinSubnetAvailableIPs: aws.Int64(51)}))
+			_, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fewer than 51 available IP addresses"))
+		})
+		It("should skip subnets in blocked zones", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{BlockedZones: []string{"test-zone-1a"}}))
+			zonalSubnets, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(BeNil())
+			Expect(zonalSubnets).To(HaveLen(2))
+			Expect(zonalSubnets).ToNot(HaveKey("test-zone-1a"))
+		})
+		It("should only include subnets in allowed zones", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{AllowedZones: []string{"test-zone-1c"}}))
+			zonalSubnets, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(BeNil())
+			Expect(zonalSubnets).To(HaveLen(1))
+			Expect(aws.StringValue(zonalSubnets["test-zone-1c"].SubnetId)).To(Equal("test-subnet-4"))
+		})
+		It("should return an error when every subnet is in a zone that isn't allowed", func() {
+			ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{AllowedZones: []string{"test-zone-1d"}}))
+			_, err := awsEnv.SubnetProvider.ZonalSubnetsForLaunch(ctx, nodeTemplate, nil, corev1alpha5.CapacityTypeOnDemand)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("zones that aren't allowed"))
+		})
+	})
 })
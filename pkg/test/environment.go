@@ -18,6 +18,7 @@ import (
 	"context"
 	"net"
 
+	"k8s.io/utils/clock"
 	"knative.dev/pkg/ptr"
 
 	"github.com/patrickmn/go-cache"
@@ -25,7 +26,9 @@ import (
 	awscache "github.com/aws/karpenter/pkg/cache"
 	"github.com/aws/karpenter/pkg/fake"
 	"github.com/aws/karpenter/pkg/providers/amifamily"
+	"github.com/aws/karpenter/pkg/providers/capacityreservation"
 	"github.com/aws/karpenter/pkg/providers/instance"
+	"github.com/aws/karpenter/pkg/providers/instanceprofile"
 	"github.com/aws/karpenter/pkg/providers/instancetype"
 	"github.com/aws/karpenter/pkg/providers/launchtemplate"
 	"github.com/aws/karpenter/pkg/providers/pricing"
@@ -39,6 +42,7 @@ type Environment struct {
 	// API
 	EC2API     *fake.EC2API
 	SSMAPI     *fake.SSMAPI
+	IAMAPI     *fake.IAMAPI
 	PricingAPI *fake.PricingAPI
 
 	// Cache
@@ -49,23 +53,29 @@ type Environment struct {
 	UnavailableOfferingsCache *awscache.UnavailableOfferings
 	LaunchTemplateCache       *cache.Cache
 	SubnetCache               *cache.Cache
+	ZonePlacementCache        *cache.Cache
 	SecurityGroupCache        *cache.Cache
+	CapacityReservationCache  *cache.Cache
+	InstanceProfileCache      *cache.Cache
 
 	// Providers
-	InstanceTypesProvider  *instancetype.Provider
-	InstanceProvider       *instance.Provider
-	SubnetProvider         *subnet.Provider
-	SecurityGroupProvider  *securitygroup.Provider
-	PricingProvider        *pricing.Provider
-	AMIProvider            *amifamily.Provider
-	AMIResolver            *amifamily.Resolver
-	LaunchTemplateProvider *launchtemplate.Provider
+	InstanceTypesProvider       *instancetype.Provider
+	InstanceProvider            *instance.Provider
+	SubnetProvider              *subnet.Provider
+	SecurityGroupProvider       *securitygroup.Provider
+	CapacityReservationProvider *capacityreservation.Provider
+	InstanceProfileProvider     *instanceprofile.Provider
+	PricingProvider             *pricing.Provider
+	AMIProvider                 *amifamily.Provider
+	AMIResolver                 *amifamily.Resolver
+	LaunchTemplateProvider      *launchtemplate.Provider
 }
 
 func NewEnvironment(ctx context.Context, env *coretest.Environment) *Environment {
 	// API
 	ec2api := &fake.EC2API{}
 	ssmapi := &fake.SSMAPI{}
+	iamapi := &fake.IAMAPI{}
 
 	// cache
 	ssmCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
@@ -75,13 +85,18 @@ func NewEnvironment(ctx context.Context, env *coretest.Environment) *Environment
 	unavailableOfferingsCache := awscache.NewUnavailableOfferings()
 	launchTemplateCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
 	subnetCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
+	zonePlacementCache := cache.New(awscache.ZonePlacementTTL, awscache.DefaultCleanupInterval)
 	securityGroupCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
+	capacityReservationCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
+	instanceProfileCache := cache.New(awscache.DefaultTTL, awscache.DefaultCleanupInterval)
 	fakePricingAPI := &fake.PricingAPI{}
 
 	// Providers
-	pricingProvider := pricing.NewProvider(ctx, fakePricingAPI, ec2api, "", make(chan struct{}))
-	subnetProvider := subnet.NewProvider(ec2api, subnetCache)
-	securityGroupProvider := securitygroup.NewProvider(ec2api, securityGroupCache)
+	pricingProvider := pricing.NewProvider(ctx, clock.RealClock{}, fakePricingAPI, ec2api, "", make(chan struct{}))
+	subnetProvider := subnet.NewProvider(ec2api, subnetCache, zonePlacementCache)
+	securityGroupProvider := securitygroup.NewProvider(ec2api, subnetProvider, securityGroupCache)
+	capacityReservationProvider := capacityreservation.NewProvider(ec2api, capacityReservationCache)
+	instanceProfileProvider := instanceprofile.NewProvider(iamapi, instanceProfileCache)
 	amiProvider := amifamily.NewProvider(env.Client, env.KubernetesInterface, ssmapi, ec2api, ssmCache, ec2Cache, kubernetesVersionCache)
 	amiResolver := amifamily.New(env.Client, amiProvider)
 	instanceTypesProvider := instancetype.NewProvider("", instanceTypeCache, ec2api, subnetProvider, unavailableOfferingsCache, pricingProvider)
@@ -92,6 +107,8 @@ func NewEnvironment(ctx context.Context, env *coretest.Environment) *Environment
 			ec2api,
 			amiResolver,
 			securityGroupProvider,
+			subnetProvider,
+			instanceProfileProvider,
 			ptr.String("ca-bundle"),
 			make(chan struct{}),
 			net.ParseIP("10.0.100.10"),
@@ -105,11 +122,13 @@ func NewEnvironment(ctx context.Context, env *coretest.Environment) *Environment
 			instanceTypesProvider,
 			subnetProvider,
 			launchTemplateProvider,
+			capacityReservationProvider,
 		)
 
 	return &Environment{
 		EC2API:     ec2api,
 		SSMAPI:     ssmapi,
+		IAMAPI:     iamapi,
 		PricingAPI: fakePricingAPI,
 
 		SSMCache:                  ssmCache,
@@ -118,23 +137,29 @@ func NewEnvironment(ctx context.Context, env *coretest.Environment) *Environment
 		InstanceTypeCache:         instanceTypeCache,
 		LaunchTemplateCache:       launchTemplateCache,
 		SubnetCache:               subnetCache,
+		ZonePlacementCache:        zonePlacementCache,
 		SecurityGroupCache:        securityGroupCache,
+		CapacityReservationCache:  capacityReservationCache,
+		InstanceProfileCache:      instanceProfileCache,
 		UnavailableOfferingsCache: unavailableOfferingsCache,
 
-		InstanceTypesProvider:  instanceTypesProvider,
-		InstanceProvider:       instanceProvider,
-		SubnetProvider:         subnetProvider,
-		SecurityGroupProvider:  securityGroupProvider,
-		PricingProvider:        pricingProvider,
-		AMIProvider:            amiProvider,
-		AMIResolver:            amiResolver,
-		LaunchTemplateProvider: launchTemplateProvider,
+		InstanceTypesProvider:       instanceTypesProvider,
+		InstanceProvider:            instanceProvider,
+		SubnetProvider:              subnetProvider,
+		SecurityGroupProvider:       securityGroupProvider,
+		CapacityReservationProvider: capacityReservationProvider,
+		InstanceProfileProvider:     instanceProfileProvider,
+		PricingProvider:             pricingProvider,
+		AMIProvider:                 amiProvider,
+		AMIResolver:                 amiResolver,
+		LaunchTemplateProvider:      launchTemplateProvider,
 	}
 }
 
 func (env *Environment) Reset() {
 	env.EC2API.Reset()
 	env.SSMAPI.Reset()
+	env.IAMAPI.Reset()
 	env.PricingAPI.Reset()
 
 	env.SSMCache.Flush()
@@ -144,5 +169,8 @@ func (env *Environment) Reset() {
 	env.UnavailableOfferingsCache.Flush()
 	env.LaunchTemplateCache.Flush()
 	env.SubnetCache.Flush()
+	env.ZonePlacementCache.Flush()
 	env.SecurityGroupCache.Flush()
+	env.CapacityReservationCache.Flush()
+	env.InstanceProfileCache.Flush()
 }
@@ -16,24 +16,70 @@ package test
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/samber/lo"
+	v1 "k8s.io/api/core/v1"
 
 	awssettings "github.com/aws/karpenter/pkg/apis/settings"
 )
 
 type SettingOptions struct {
-	ClusterName                *string
-	ClusterEndpoint            *string
-	DefaultInstanceProfile     *string
-	EnablePodENI               *bool
-	EnableENILimitedPodDensity *bool
-	IsolatedVPC                *bool
-	NodeNameConvention         *awssettings.NodeNameConvention
-	VMMemoryOverheadPercent    *float64
-	InterruptionQueueName      *string
-	Tags                       map[string]string
+	ClusterName                  *string
+	ClusterEndpoint              *string
+	DefaultInstanceProfile       *string
+	EnablePodENI                 *bool
+	EnableENILimitedPodDensity   *bool
+	EnablePrefixDelegation       *bool
+	IsolatedVPC                  *bool
+	NodeNameConvention           *awssettings.NodeNameConvention
+	VMMemoryOverheadPercent      *float64
+	InterruptionQueueName        *string
+	Tags                         map[string]string
+	EnableVersionTag             *bool
+	GCResolutionWindow           *time.Duration
+	GCProtectionTagKey           *string
+	InstanceDiscoveryTagKey      *string
+	InstanceDiscoveryTagValue    *string
+	EnableZonalInstanceListing   *bool
+	GCDrainTimeout               *time.Duration
+	GCDaemonSetDrainPolicy       *awssettings.DaemonSetDrainPolicy
+	GCLogSampleSize              *int64
+	GCDeleteNodes                *bool
+	PersistLinkedMachines        *bool
+	StaleMachineGracePeriod      *time.Duration
+	AMICacheTTL                  *time.Duration
+	SpotInterruptionLeadTime     *time.Duration
+	EnableRebalanceReplacement   *bool
+	EnableAMIDrift               *bool
+	AMIDriftReplacementBudget    *int64
+	EnableSubnetDrift            *bool
+	MaxInstanceLifetime          *time.Duration
+	ExpirationReplacementBudget  *int64
+	MaxConcurrentLaunches        *int64
+	MinSubnetAvailableIPs        *int64
+	EnableZoneBalancing          *bool
+	MaxFleetOverrides            *int64
+	SpotFallbackThreshold        *int64
+	PricingRefreshInterval       *time.Duration
+	EnableSpotPriceLookup        *bool
+	SpotPriceLookupTTL           *time.Duration
+	SpotPriceLookupBudget        *int64
+	UnavailableOfferingsTTL      *time.Duration
+	InstanceTypesRefreshInterval *time.Duration
+	EC2RetryMaxAttempts          *int64
+	EC2RetryBaseDelay            *time.Duration
+	EC2RetryMaxDelay             *time.Duration
+	EC2RequestsPerSecond         *float64
+	EC2RequestBurst              *int64
+	EnableEC2Tracing             *bool
+	EnableInstanceProfileCheck   *bool
+	EnableInstanceProfileCleanup *bool
+	AllowedZones                 []string
+	BlockedZones                 []string
+	SystemReserved               v1.ResourceList
+	KubeReserved                 v1.ResourceList
 }
 
 func Settings(overrides ...SettingOptions) *awssettings.Settings {
@@ -44,15 +90,59 @@ func Settings(overrides ...SettingOptions) *awssettings.Settings {
 		}
 	}
 	return &awssettings.Settings{
-		ClusterName:                lo.FromPtrOr(options.ClusterName, "test-cluster"),
-		ClusterEndpoint:            lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
-		DefaultInstanceProfile:     lo.FromPtrOr(options.DefaultInstanceProfile, "test-instance-profile"),
-		EnablePodENI:               lo.FromPtrOr(options.EnablePodENI, true),
-		EnableENILimitedPodDensity: lo.FromPtrOr(options.EnableENILimitedPodDensity, true),
-		IsolatedVPC:                lo.FromPtrOr(options.IsolatedVPC, false),
-		NodeNameConvention:         lo.FromPtrOr(options.NodeNameConvention, awssettings.IPName),
-		VMMemoryOverheadPercent:    lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
-		InterruptionQueueName:      lo.FromPtrOr(options.InterruptionQueueName, ""),
-		Tags:                       options.Tags,
+		ClusterName:                  lo.FromPtrOr(options.ClusterName, "test-cluster"),
+		ClusterEndpoint:              lo.FromPtrOr(options.ClusterEndpoint, "https://test-cluster"),
+		DefaultInstanceProfile:       lo.FromPtrOr(options.DefaultInstanceProfile, "test-instance-profile"),
+		EnablePodENI:                 lo.FromPtrOr(options.EnablePodENI, true),
+		EnableENILimitedPodDensity:   lo.FromPtrOr(options.EnableENILimitedPodDensity, true),
+		EnablePrefixDelegation:       lo.FromPtrOr(options.EnablePrefixDelegation, false),
+		IsolatedVPC:                  lo.FromPtrOr(options.IsolatedVPC, false),
+		NodeNameConvention:           lo.FromPtrOr(options.NodeNameConvention, awssettings.IPName),
+		VMMemoryOverheadPercent:      lo.FromPtrOr(options.VMMemoryOverheadPercent, 0.075),
+		InterruptionQueueName:        lo.FromPtrOr(options.InterruptionQueueName, ""),
+		Tags:                         options.Tags,
+		EnableVersionTag:             lo.FromPtrOr(options.EnableVersionTag, false),
+		GCResolutionWindow:           lo.FromPtrOr(options.GCResolutionWindow, time.Minute),
+		GCProtectionTagKey:           lo.FromPtrOr(options.GCProtectionTagKey, ""),
+		InstanceDiscoveryTagKey:      lo.FromPtrOr(options.InstanceDiscoveryTagKey, ""),
+		InstanceDiscoveryTagValue:    lo.FromPtrOr(options.InstanceDiscoveryTagValue, ""),
+		EnableZonalInstanceListing:   lo.FromPtrOr(options.EnableZonalInstanceListing, false),
+		GCDrainTimeout:               lo.FromPtrOr(options.GCDrainTimeout, 0),
+		GCDaemonSetDrainPolicy:       lo.FromPtrOr(options.GCDaemonSetDrainPolicy, awssettings.DaemonSetDrainPolicySkip),
+		GCLogSampleSize:              lo.FromPtrOr(options.GCLogSampleSize, 10),
+		GCDeleteNodes:                lo.FromPtrOr(options.GCDeleteNodes, true),
+		PersistLinkedMachines:        lo.FromPtrOr(options.PersistLinkedMachines, false),
+		StaleMachineGracePeriod:      lo.FromPtrOr(options.StaleMachineGracePeriod, 5*time.Minute),
+		AMICacheTTL:                  lo.FromPtrOr(options.AMICacheTTL, 5*time.Minute),
+		SpotInterruptionLeadTime:     lo.FromPtrOr(options.SpotInterruptionLeadTime, 0),
+		EnableRebalanceReplacement:   lo.FromPtrOr(options.EnableRebalanceReplacement, false),
+		EnableAMIDrift:               lo.FromPtrOr(options.EnableAMIDrift, true),
+		AMIDriftReplacementBudget:    lo.FromPtrOr(options.AMIDriftReplacementBudget, 1),
+		EnableSubnetDrift:            lo.FromPtrOr(options.EnableSubnetDrift, false),
+		MaxInstanceLifetime:          lo.FromPtrOr(options.MaxInstanceLifetime, 0),
+		ExpirationReplacementBudget:  lo.FromPtrOr(options.ExpirationReplacementBudget, 1),
+		MaxConcurrentLaunches:        lo.FromPtrOr(options.MaxConcurrentLaunches, 0),
+		MinSubnetAvailableIPs:        lo.FromPtrOr(options.MinSubnetAvailableIPs, 0),
+		EnableZoneBalancing:          lo.FromPtrOr(options.EnableZoneBalancing, false),
+		MaxFleetOverrides:            lo.FromPtrOr(options.MaxFleetOverrides, 300),
+		SpotFallbackThreshold:        lo.FromPtrOr(options.SpotFallbackThreshold, 3),
+		PricingRefreshInterval:       lo.FromPtrOr(options.PricingRefreshInterval, 12*time.Hour),
+		EnableSpotPriceLookup:        lo.FromPtrOr(options.EnableSpotPriceLookup, false),
+		SpotPriceLookupTTL:           lo.FromPtrOr(options.SpotPriceLookupTTL, time.Minute),
+		SpotPriceLookupBudget:        lo.FromPtrOr(options.SpotPriceLookupBudget, 20),
+		UnavailableOfferingsTTL:      lo.FromPtrOr(options.UnavailableOfferingsTTL, 3*time.Minute),
+		InstanceTypesRefreshInterval: lo.FromPtrOr(options.InstanceTypesRefreshInterval, 5*time.Minute),
+		EC2RetryMaxAttempts:          lo.FromPtrOr(options.EC2RetryMaxAttempts, 5),
+		EC2RetryBaseDelay:            lo.FromPtrOr(options.EC2RetryBaseDelay, 100*time.Millisecond),
+		EC2RetryMaxDelay:             lo.FromPtrOr(options.EC2RetryMaxDelay, 5*time.Second),
+		EC2RequestsPerSecond:         lo.FromPtrOr(options.EC2RequestsPerSecond, 0),
+		EC2RequestBurst:              lo.FromPtrOr(options.EC2RequestBurst, 10),
+		EnableEC2Tracing:             lo.FromPtrOr(options.EnableEC2Tracing, false),
+		EnableInstanceProfileCheck:   lo.FromPtrOr(options.EnableInstanceProfileCheck, false),
+		EnableInstanceProfileCleanup: lo.FromPtrOr(options.EnableInstanceProfileCleanup, false),
+		AllowedZones:                 options.AllowedZones,
+		BlockedZones:                 options.BlockedZones,
+		SystemReserved:               options.SystemReserved,
+		KubeReserved:                 options.KubeReserved,
 	}
 }
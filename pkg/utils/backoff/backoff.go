@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/samber/lo"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+	awserrors "github.com/aws/karpenter/pkg/errors"
+)
+
+// Backoff configures how throttled EC2 calls are retried, with exponential backoff and full jitter so that controllers
+// that are throttled at the same time don't retry in lockstep
+type Backoff struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter picks the delay before a retry from the range [0, d]
+	Jitter func(d time.Duration) time.Duration
+}
+
+// FromContext returns the backoff configured through settings
+func FromContext(ctx context.Context) Backoff {
+	return Backoff{
+		MaxAttempts: int(settings.FromContext(ctx).EC2RetryMaxAttempts),
+		BaseDelay:   settings.FromContext(ctx).EC2RetryBaseDelay,
+		MaxDelay:    settings.FromContext(ctx).EC2RetryMaxDelay,
+		Jitter:      fullJitter,
+	}
+}
+
+var _ request.Retryer = Retryer{}
+
+// Retryer is the retryer of the EC2 client, so that every EC2 call is retried in one place, up to the maximum number of
+// attempts of the backoff. Throttled calls wait for the jittered delay of the backoff, while other errors are retried
+// as they would be by the SDK's default retryer.
+type Retryer struct {
+	client.DefaultRetryer
+	Backoff Backoff
+}
+
+// NewRetryer returns a retryer with the backoff configured through settings
+func NewRetryer(ctx context.Context) Retryer {
+	b := FromContext(ctx)
+	return Retryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: b.MaxAttempts - 1},
+		Backoff:        b,
+	}
+}
+
+// MaxRetries returns the number of retries after the first attempt
+func (r Retryer) MaxRetries() int {
+	return r.Backoff.MaxAttempts - 1
+}
+
+// ShouldRetry returns true if the request was throttled, unless waiting for the longest delay of the next attempt would
+// pass the deadline of the context. Other errors are retried if the default retryer would retry them.
+func (r Retryer) ShouldRetry(req *request.Request) bool {
+	if !IsRetryable(req.Error) {
+		return r.DefaultRetryer.ShouldRetry(req)
+	}
+	deadline, ok := req.Context().Deadline()
+	return !ok || !time.Now().Add(r.Backoff.bound(req.RetryCount+1)).After(deadline)
+}
+
+// RetryRules returns how long to wait before retrying the request
+func (r Retryer) RetryRules(req *request.Request) time.Duration {
+	if IsRetryable(req.Error) {
+		return r.Backoff.Delay(req.RetryCount + 1)
+	}
+	return r.DefaultRetryer.RetryRules(req)
+}
+
+// Delay returns how long to wait after the attempt before retrying. The upper bound of the delay doubles with every
+// attempt, up to the max delay.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Jitter == nil {
+		return b.bound(attempt)
+	}
+	return b.Jitter(b.bound(attempt))
+}
+
+func (b Backoff) bound(attempt int) time.Duration {
+	// Stop doubling before the delay can overflow
+	if attempt >= 32 {
+		return b.MaxDelay
+	}
+	return lo.Min([]time.Duration{b.BaseDelay * time.Duration(1<<(attempt-1)), b.MaxDelay})
+}
+
+// IsRetryable returns true if the EC2 call was throttled
+func IsRetryable(err error) bool {
+	return lo.SomeBy(awserrors.Codes(err), awserrors.IsThrottlingCode)
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1)) //nolint:gosec
+}
@@ -0,0 +1,171 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backoff_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+	awserrors "github.com/aws/karpenter/pkg/errors"
+	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/backoff"
+)
+
+var ctx context.Context
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Backoff")
+}
+
+var _ = BeforeEach(func() {
+	ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+		EC2RetryMaxAttempts: lo.ToPtr[int64](4),
+		EC2RetryBaseDelay:   lo.ToPtr(time.Millisecond),
+		EC2RetryMaxDelay:    lo.ToPtr(4 * time.Millisecond),
+	}))
+})
+
+// fakeEC2 counts the requests that reach it and fails the first of them with the error, without calling EC2
+type fakeEC2 struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *fakeEC2) client(retryer request.Retryer) *ec2.EC2 {
+	api := ec2.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.AnonymousCredentials,
+	})), request.WithRetryer(aws.NewConfig(), retryer))
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		f.calls++
+		if f.calls <= f.failures {
+			r.Error = f.err
+			return
+		}
+		r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+	})
+	api.Handlers.Unmarshal.Clear()
+	api.Handlers.UnmarshalMeta.Clear()
+	return api
+}
+
+var _ = Describe("Backoff", func() {
+	var throttled error
+	BeforeEach(func() {
+		throttled = awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+	})
+
+	Context("Retryer", func() {
+		It("should retry a throttled call until it succeeds", func() {
+			fake := &fakeEC2{failures: 2, err: throttled}
+			_, err := fake.client(backoff.NewRetryer(ctx)).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fake.calls).To(Equal(3))
+		})
+		It("should return the error once it has made the maximum number of attempts", func() {
+			fake := &fakeEC2{failures: 10, err: throttled}
+			_, err := fake.client(backoff.NewRetryer(ctx)).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(awserrors.Codes(err)).To(ContainElement("RequestLimitExceeded"))
+			Expect(fake.calls).To(Equal(4))
+		})
+		It("should not retry an error that isn't retryable", func() {
+			fake := &fakeEC2{failures: 10, err: awserr.New("UnauthorizedOperation", "", nil)}
+			_, err := fake.client(backoff.NewRetryer(ctx)).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(err).To(HaveOccurred())
+			Expect(fake.calls).To(Equal(1))
+		})
+		It("should retry every page of a paginated call", func() {
+			fake := &fakeEC2{failures: 1, err: throttled}
+			Expect(fake.client(backoff.NewRetryer(ctx)).DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{}, func(_ *ec2.DescribeInstancesOutput, _ bool) bool {
+				return true
+			})).To(Succeed())
+			Expect(fake.calls).To(Equal(2))
+		})
+		It("should stop retrying when the next attempt would pass the deadline of the context", func() {
+			retryer := backoff.NewRetryer(ctx)
+			retryer.Backoff.BaseDelay = time.Minute
+			retryer.Backoff.MaxDelay = time.Minute
+			deadlineCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			fake := &fakeEC2{failures: 10, err: throttled}
+			_, err := fake.client(retryer).DescribeInstancesWithContext(deadlineCtx, &ec2.DescribeInstancesInput{})
+			Expect(awserrors.Codes(err)).To(ContainElement("RequestLimitExceeded"))
+			Expect(fake.calls).To(Equal(1))
+		})
+		It("should apply jitter to the delay before every retry", func() {
+			retryer := backoff.NewRetryer(ctx)
+			var bounds []time.Duration
+			retryer.Backoff.Jitter = func(d time.Duration) time.Duration {
+				bounds = append(bounds, d)
+				return 0
+			}
+			fake := &fakeEC2{failures: 3, err: throttled}
+			_, err := fake.client(retryer).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bounds).To(Equal([]time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond}))
+		})
+		It("should not retry when a single attempt is configured", func() {
+			singleAttemptCtx := settings.ToContext(ctx, test.Settings(test.SettingOptions{EC2RetryMaxAttempts: lo.ToPtr[int64](1)}))
+			fake := &fakeEC2{failures: 10, err: throttled}
+			_, err := fake.client(backoff.NewRetryer(singleAttemptCtx)).DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(err).To(HaveOccurred())
+			Expect(fake.calls).To(Equal(1))
+		})
+		It("should recognize throttling errors that are wrapped", func() {
+			Expect(backoff.IsRetryable(fmt.Errorf("describing instances, %w", throttled))).To(BeTrue())
+			Expect(backoff.IsRetryable(fmt.Errorf("failed"))).To(BeFalse())
+		})
+	})
+	Context("Delay", func() {
+		It("should double the delay with every attempt up to the max delay", func() {
+			b := backoff.Backoff{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+			Expect(lo.Map([]int{1, 2, 3, 4, 5, 100}, func(attempt int, _ int) time.Duration { return b.Delay(attempt) })).To(Equal([]time.Duration{
+				time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+			}))
+		})
+		It("should pick jittered delays up to the bound", func() {
+			b := backoff.FromContext(ctx)
+			b.BaseDelay = time.Second
+			b.MaxDelay = time.Minute
+			delays := lo.Times(100, func(_ int) time.Duration { return b.Delay(3) })
+			for _, delay := range delays {
+				Expect(delay).To(BeNumerically(">=", 0))
+				Expect(delay).To(BeNumerically("<=", 4*time.Second))
+			}
+			Expect(len(lo.Uniq(delays))).To(BeNumerically(">", 1))
+		})
+	})
+})
@@ -0,0 +1,52 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+)
+
+// HandlerName identifies the rate limiting handler in the handler lists of a client
+const HandlerName = "karpenter.RateLimitHandler"
+
+// FromContext returns the token bucket rate limiter configured through settings, or nil if EC2 requests aren't rate
+// limited
+func FromContext(ctx context.Context) flowcontrol.RateLimiter {
+	if settings.FromContext(ctx).EC2RequestsPerSecond == 0 {
+		return nil
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(float32(settings.FromContext(ctx).EC2RequestsPerSecond), int(settings.FromContext(ctx).EC2RequestBurst))
+}
+
+// WithRateLimiter makes every request of the client, including pages and retries, wait for a token from the rate
+// limiter before it's sent. Clients that share a rate limiter share its budget, so that controllers that scale up at
+// the same time can't collectively exceed the API request limits even though each of them backs off on its own.
+func WithRateLimiter(handlers *request.Handlers, limiter flowcontrol.RateLimiter) {
+	if limiter == nil {
+		return
+	}
+	// Requests are signed before every attempt, so waiting here rate limits retries made by the SDK as well
+	handlers.Sign.PushFrontNamed(request.NamedHandler{Name: HandlerName, Fn: func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = awserr.New(request.CanceledErrorCode, "waiting for the rate limiter", err)
+		}
+	}})
+}
@@ -0,0 +1,145 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/ratelimit"
+)
+
+var ctx context.Context
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RateLimit")
+}
+
+// fakeEC2 records the time of every request that reaches it and responds without calling EC2
+type fakeEC2 struct {
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (f *fakeEC2) client() *ec2.EC2 {
+	api := ec2.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.AnonymousCredentials,
+	})))
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls = append(f.calls, time.Now())
+		r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+	})
+	api.Handlers.Unmarshal.Clear()
+	api.Handlers.UnmarshalMeta.Clear()
+	return api
+}
+
+// maxCallsWithin returns the largest number of calls made within any window of the duration
+func (f *fakeEC2) maxCallsWithin(window time.Duration) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return lo.Max(lo.Map(f.calls, func(start time.Time, _ int) int {
+		return lo.CountBy(f.calls, func(t time.Time) bool { return !t.Before(start) && t.Before(start.Add(window)) })
+	}))
+}
+
+var _ = Describe("RateLimit", func() {
+	var fake *fakeEC2
+	BeforeEach(func() {
+		fake = &fakeEC2{}
+	})
+
+	It("should keep the aggregate call rate of concurrent callers under the limit", func() {
+		limiter := flowcontrol.NewTokenBucketRateLimiter(50, 5)
+		api := fake.client()
+		ratelimit.WithRateLimiter(&api.Handlers, limiter)
+
+		start := time.Now()
+		workqueue.ParallelizeUntil(ctx, 30, 30, func(_ int) {
+			defer GinkgoRecover()
+			_, err := api.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+		Expect(fake.calls).To(HaveLen(30))
+		// The burst is spent immediately, and every other call waits for a token that's refilled at 50 per second
+		Expect(time.Since(start)).To(BeNumerically(">=", 450*time.Millisecond))
+		Expect(fake.maxCallsWithin(100 * time.Millisecond)).To(BeNumerically("<=", 5+5+1))
+	})
+	It("should share the budget between clients that share a rate limiter", func() {
+		limiter := flowcontrol.NewTokenBucketRateLimiter(50, 5)
+		apis := []*ec2.EC2{fake.client(), fake.client()}
+		lo.ForEach(apis, func(api *ec2.EC2, _ int) { ratelimit.WithRateLimiter(&api.Handlers, limiter) })
+
+		start := time.Now()
+		workqueue.ParallelizeUntil(ctx, 30, 30, func(i int) {
+			defer GinkgoRecover()
+			_, err := apis[i%len(apis)].DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+		Expect(fake.calls).To(HaveLen(30))
+		Expect(time.Since(start)).To(BeNumerically(">=", 450*time.Millisecond))
+	})
+	It("should fail a request whose context is done while it waits for the rate limiter", func() {
+		limiter := flowcontrol.NewTokenBucketRateLimiter(0.01, 1)
+		api := fake.client()
+		ratelimit.WithRateLimiter(&api.Handlers, limiter)
+
+		_, err := api.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{})
+		Expect(err).ToNot(HaveOccurred())
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = api.DescribeSubnetsWithContext(timeoutCtx, &ec2.DescribeSubnetsInput{})
+		Expect(err).To(HaveOccurred())
+		Expect(fake.calls).To(HaveLen(1))
+	})
+	It("should not rate limit requests by default", func() {
+		ctx = settings.ToContext(ctx, test.Settings())
+		Expect(ratelimit.FromContext(ctx)).To(BeNil())
+	})
+	It("should rate limit requests when a rate is configured", func() {
+		ctx = settings.ToContext(ctx, test.Settings(test.SettingOptions{
+			EC2RequestsPerSecond: lo.ToPtr(10.0),
+			EC2RequestBurst:      lo.ToPtr[int64](2),
+		}))
+		limiter := ratelimit.FromContext(ctx)
+		Expect(limiter).ToNot(BeNil())
+		Expect(limiter.QPS()).To(BeNumerically("==", 10))
+	})
+})
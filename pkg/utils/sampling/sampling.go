@@ -0,0 +1,45 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sampling
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+)
+
+// Sampler bounds the per-item logs of a batch, e.g. of the hundreds of instances that garbage collection may terminate
+// at once, so that a large batch is logged as a summary along with a sample of its items. A Sampler is safe for
+// concurrent use by the workers of a batch.
+type Sampler struct {
+	size    int64
+	sampled atomic.Int64
+}
+
+// New returns a Sampler that logs the first size items of a batch. A size of 0 logs every item.
+func New(size int64) *Sampler {
+	return &Sampler{size: size}
+}
+
+// Logger returns the logger of the context if the item is part of the sample, or a logger that discards every log
+// otherwise
+func (s *Sampler) Logger(ctx context.Context) *zap.SugaredLogger {
+	if s.size == 0 || s.sampled.Add(1) <= s.size {
+		return logging.FromContext(ctx)
+	}
+	return zap.NewNop().Sugar()
+}
@@ -0,0 +1,78 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sampling_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"knative.dev/pkg/logging"
+
+	"github.com/aws/karpenter/pkg/utils/sampling"
+)
+
+var ctx context.Context
+var logs *observer.ObservedLogs
+
+func TestAPIs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sampling")
+}
+
+var _ = BeforeEach(func() {
+	var core zapcore.Core
+	core, logs = observer.New(zapcore.DebugLevel)
+	ctx = logging.WithLogger(context.Background(), zap.New(core).Sugar())
+})
+
+var _ = Describe("Sampling", func() {
+	It("should only log the first items of the batch", func() {
+		sampler := sampling.New(3)
+		for i := 0; i < 10; i++ {
+			sampler.Logger(ctx).With("item", i).Debugf("logged item")
+		}
+		Expect(logs.Len()).To(Equal(3))
+		for i, entry := range logs.All() {
+			Expect(entry.ContextMap()).To(HaveKeyWithValue("item", int64(i)))
+		}
+	})
+	It("should log every item of the batch when the size is 0", func() {
+		sampler := sampling.New(0)
+		for i := 0; i < 10; i++ {
+			sampler.Logger(ctx).Debugf("logged item")
+		}
+		Expect(logs.Len()).To(Equal(10))
+	})
+	It("should log the size of the sample when used concurrently", func() {
+		sampler := sampling.New(5)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				sampler.Logger(ctx).Debugf("logged item")
+			}()
+		}
+		wg.Wait()
+		Expect(logs.Len()).To(Equal(5))
+	})
+})
@@ -0,0 +1,62 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aws/karpenter/pkg/utils"
+)
+
+func TestAPIs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Utils")
+}
+
+var _ = Describe("Utils", func() {
+	DescribeTable("should derive the partition from the region",
+		func(region string, partition string) {
+			Expect(utils.Partition(region)).To(Equal(partition))
+		},
+		Entry("aws", "us-west-2", "aws"),
+		Entry("aws-cn", "cn-north-1", "aws-cn"),
+		Entry("aws-cn in another region", "cn-northwest-1", "aws-cn"),
+		Entry("aws-us-gov", "us-gov-west-1", "aws-us-gov"),
+		Entry("aws-us-gov in another region", "us-gov-east-1", "aws-us-gov"),
+		Entry("an unknown region of a partition", "us-gov-test-1", "aws-us-gov"),
+		Entry("an unknown region", "test-region-1", "aws"),
+	)
+	DescribeTable("should parse the instance ID of provider IDs in every partition",
+		func(zone string) {
+			providerID := utils.ProviderID(zone, "i-01234567890abcdef")
+			Expect(providerID).To(Equal("aws:///" + zone + "/i-01234567890abcdef"))
+			Expect(utils.ParseInstanceID(providerID)).To(Equal("i-01234567890abcdef"))
+			Expect(utils.NormalizeProviderID(providerID)).To(Equal("i-01234567890abcdef"))
+		},
+		Entry("aws", "us-west-2a"),
+		Entry("aws-cn", "cn-north-1a"),
+		Entry("aws-us-gov", "us-gov-west-1a"),
+	)
+	It("should parse the instance ID of legacy provider IDs without the zone", func() {
+		Expect(utils.ParseInstanceID("aws:///i-01234567890abcdef")).To(Equal("i-01234567890abcdef"))
+	})
+	It("should fail to parse provider IDs of other cloud providers", func() {
+		_, err := utils.ParseInstanceID("gce://project/us-central1-a/instance")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,155 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"knative.dev/pkg/logging"
+	. "knative.dev/pkg/logging/testing"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+	"github.com/aws/karpenter/pkg/test"
+	"github.com/aws/karpenter/pkg/utils/tracing"
+)
+
+var ctx context.Context
+
+func TestAPIs(t *testing.T) {
+	ctx = TestContextWithLogger(t)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing")
+}
+
+var userData = base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\necho secret-token"))
+
+// client returns an EC2 client that responds without calling EC2. The send function can fill in the response of a
+// request or fail it.
+func client(send func(r *request.Request)) *ec2.EC2 {
+	api := ec2.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.AnonymousCredentials,
+	})))
+	api.Handlers.Send.Clear()
+	api.Handlers.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+		send(r)
+	})
+	api.Handlers.Unmarshal.Clear()
+	api.Handlers.UnmarshalMeta.Clear()
+	api.Handlers.UnmarshalError.Clear()
+	api.Handlers.Retry.Clear()
+	return api
+}
+
+var _ = Describe("Tracing", func() {
+	var logs *observer.ObservedLogs
+	var traceCtx context.Context
+	var api *ec2.EC2
+	BeforeEach(func() {
+		var core zapcore.Core
+		core, logs = observer.New(zapcore.DebugLevel)
+		traceCtx = logging.WithLogger(ctx, zap.New(core).Sugar())
+		api = client(func(r *request.Request) {})
+	})
+	createLaunchTemplate := func() {
+		_, err := api.CreateLaunchTemplateWithContext(traceCtx, &ec2.CreateLaunchTemplateInput{
+			LaunchTemplateName: aws.String("karpenter.k8s.aws/test"),
+			LaunchTemplateData: &ec2.RequestLaunchTemplateData{
+				ImageId:  aws.String("ami-123"),
+				UserData: aws.String(userData),
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("should log the request of a create call when tracing is enabled", func() {
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableEC2Tracing: lo.ToPtr(true)})), &api.Handlers)
+		createLaunchTemplate()
+		Expect(logs.Len()).To(Equal(1))
+		fields := logs.All()[0].ContextMap()
+		Expect(fields).To(HaveKeyWithValue("operation", "CreateLaunchTemplate"))
+		Expect(fields["request"]).To(ContainSubstring("karpenter.k8s.aws/test"))
+		Expect(fields["request"]).To(ContainSubstring("ami-123"))
+		Expect(fields).To(HaveKey("response"))
+	})
+	It("should not log anything when tracing is disabled", func() {
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings()), &api.Handlers)
+		createLaunchTemplate()
+		Expect(logs.Len()).To(Equal(0))
+	})
+	It("should redact user data from the request", func() {
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableEC2Tracing: lo.ToPtr(true)})), &api.Handlers)
+		createLaunchTemplate()
+		Expect(logs.Len()).To(Equal(1))
+		request := logs.All()[0].ContextMap()["request"]
+		Expect(request).ToNot(ContainSubstring(userData))
+		Expect(request).To(ContainSubstring(`"UserData":"` + tracing.RedactedValue + `"`))
+	})
+	It("should redact user data from the response", func() {
+		api = client(func(r *request.Request) {
+			if output, ok := r.Data.(*ec2.DescribeLaunchTemplateVersionsOutput); ok {
+				output.LaunchTemplateVersions = []*ec2.LaunchTemplateVersion{{
+					LaunchTemplateName: aws.String("karpenter.k8s.aws/test"),
+					LaunchTemplateData: &ec2.ResponseLaunchTemplateData{UserData: aws.String(userData)},
+				}}
+			}
+		})
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableEC2Tracing: lo.ToPtr(true)})), &api.Handlers)
+		_, err := api.DescribeLaunchTemplateVersionsWithContext(traceCtx, &ec2.DescribeLaunchTemplateVersionsInput{LaunchTemplateName: aws.String("karpenter.k8s.aws/test")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logs.Len()).To(Equal(1))
+		response := logs.All()[0].ContextMap()["response"]
+		Expect(response).To(ContainSubstring("karpenter.k8s.aws/test"))
+		Expect(response).ToNot(ContainSubstring(userData))
+	})
+	It("should log the error of a failed call", func() {
+		api = client(func(r *request.Request) {
+			r.Error = awserr.New("UnauthorizedOperation", "not authorized to terminate instances", nil)
+		})
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableEC2Tracing: lo.ToPtr(true)})), &api.Handlers)
+		_, err := api.TerminateInstancesWithContext(traceCtx, &ec2.TerminateInstancesInput{InstanceIds: aws.StringSlice([]string{"i-123"})})
+		Expect(err).To(HaveOccurred())
+		Expect(logs.Len()).To(Equal(1))
+		fields := logs.All()[0].ContextMap()
+		Expect(fields).To(HaveKeyWithValue("operation", "TerminateInstances"))
+		Expect(fields["request"]).To(ContainSubstring("i-123"))
+		Expect(fields["error"]).To(ContainSubstring("UnauthorizedOperation"))
+		Expect(fields).ToNot(HaveKey("response"))
+	})
+	It("should not log calls that aren't create, describe or terminate calls", func() {
+		tracing.WithTracing(settings.ToContext(ctx, test.Settings(test.SettingOptions{EnableEC2Tracing: lo.ToPtr(true)})), &api.Handlers)
+		_, err := api.DeleteLaunchTemplateWithContext(traceCtx, &ec2.DeleteLaunchTemplateInput{LaunchTemplateName: aws.String("karpenter.k8s.aws/test")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logs.Len()).To(Equal(0))
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/logging"
+
+	"github.com/aws/karpenter/pkg/apis/settings"
+)
+
+const (
+	// HandlerName identifies the tracing handler in the handler lists of a client
+	HandlerName = "karpenter.TracingHandler"
+	// RedactedValue replaces the value of redacted fields in traced requests and responses
+	RedactedValue = "REDACTED"
+)
+
+var (
+	// tracedOperations are the prefixes of the names of the operations that are traced
+	tracedOperations = []string{"Create", "Describe", "Terminate"}
+	// redactedFields are redacted wherever they appear in a request or response, since they can contain secrets
+	redactedFields = sets.NewString("UserData", "KeyMaterial", "PasswordData")
+)
+
+// WithTracing logs the request and response of every create, describe and terminate call of the client when EC2
+// tracing is enabled through settings. Fields that can contain secrets, like user data, are redacted.
+func WithTracing(ctx context.Context, handlers *request.Handlers) {
+	if !settings.FromContext(ctx).EnableEC2Tracing {
+		return
+	}
+	// Complete runs once a request is done, after the SDK's retries, so that every call is logged once
+	handlers.Complete.PushBackNamed(request.NamedHandler{Name: HandlerName, Fn: func(r *request.Request) {
+		if !lo.SomeBy(tracedOperations, func(prefix string) bool { return strings.HasPrefix(r.Operation.Name, prefix) }) {
+			return
+		}
+		logger := logging.FromContext(r.Context()).With(
+			"operation", r.Operation.Name,
+			"request-id", r.RequestID,
+			"retries", r.RetryCount,
+			"request", redact(r.Params),
+		)
+		if r.Error != nil {
+			logger.With("error", r.Error.Error()).Infof("traced ec2 request")
+			return
+		}
+		logger.With("response", redact(r.Data)).Infof("traced ec2 request")
+	}})
+}
+
+// redact returns the JSON encoding of the request or response with the redacted fields replaced
+func redact(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("unable to encode, %s", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// Numbers are kept as they were encoded, rather than rounded to float64
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Sprintf("unable to decode, %s", err)
+	}
+	redacted, err := json.Marshal(redactFields(decoded))
+	if err != nil {
+		return fmt.Sprintf("unable to encode, %s", err)
+	}
+	return string(redacted)
+}
+
+func redactFields(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if redactedFields.Has(key) {
+				value[key] = RedactedValue
+				continue
+			}
+			value[key] = redactFields(field)
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redactFields(value[i])
+		}
+	}
+	return v
+}
@@ -17,12 +17,22 @@ package utils
 import (
 	"fmt"
 	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 )
 
 var (
-	instanceIDRegex = regexp.MustCompile(`aws:///(?P<AZ>.*)/(?P<InstanceID>.*)`)
+	// Provider IDs are usually of the form aws:///<zone>/<instance-id>, but nodes that were registered before the zone
+	// was included carry the legacy form aws:///<instance-id>. The aws scheme is used in every partition, including
+	// the aws-cn and aws-us-gov partitions.
+	instanceIDRegex = regexp.MustCompile(`^aws:///(?:(?P<AZ>[^/]*)/)?(?P<InstanceID>[^/]+)$`)
 )
 
+// ProviderID returns the provider ID of the instance in the zone
+func ProviderID(zone, instanceID string) string {
+	return fmt.Sprintf("aws:///%s/%s", zone, instanceID)
+}
+
 // ParseInstanceID parses the provider ID stored on the node to get the instance ID
 // associated with a node
 func ParseInstanceID(providerID string) (string, error) {
@@ -37,3 +47,22 @@ func ParseInstanceID(providerID string) (string, error) {
 	}
 	return "", fmt.Errorf("parsing instance id %s", providerID)
 }
+
+// NormalizeProviderID returns the instance ID of the provider ID, so that provider IDs with and without the zone
+// match the same instance. Provider IDs that can't be parsed are returned as they are.
+func NormalizeProviderID(providerID string) string {
+	if id, err := ParseInstanceID(providerID); err == nil {
+		return id
+	}
+	return providerID
+}
+
+// Partition returns the ID of the partition of the region, e.g. aws-cn or aws-us-gov, so that endpoints and pricing
+// aren't assumed to be those of the commercial partition. Regions that aren't known to the SDK are matched by the
+// region pattern of each partition, and fall back to the commercial partition.
+func Partition(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.ID()
+	}
+	return endpoints.AwsPartitionID
+}
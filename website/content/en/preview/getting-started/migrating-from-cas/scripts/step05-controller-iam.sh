@@ -37,11 +37,17 @@ cat << EOF > controller-policy.json
                 "ec2:DescribeInstanceTypes",
                 "ec2:DescribeInstanceTypeOfferings",
                 "ec2:DescribeAvailabilityZones",
+                "ec2:DescribeCapacityReservations",
                 "ec2:DeleteLaunchTemplate",
                 "ec2:CreateTags",
                 "ec2:CreateLaunchTemplate",
                 "ec2:CreateFleet",
                 "ec2:DescribeSpotPriceHistory",
+                "iam:GetInstanceProfile",
+                "iam:ListAttachedRolePolicies",
+                "iam:ListInstanceProfiles",
+                "iam:ListInstanceProfileTags",
+                "iam:SimulatePrincipalPolicy",
                 "pricing:GetProducts"
             ],
             "Effect": "Allow",
@@ -49,7 +55,10 @@ cat << EOF > controller-policy.json
             "Sid": "Karpenter"
         },
         {
-            "Action": "ec2:TerminateInstances",
+            "Action": [
+                "ec2:TerminateInstances",
+                "ec2:StopInstances"
+            ],
             "Condition": {
                 "StringLike": {
                     "ec2:ResourceTag/Name": "*karpenter*"